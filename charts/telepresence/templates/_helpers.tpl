@@ -61,6 +61,15 @@ app: traffic-manager
 telepresence: manager
 {{- end }}
 
+{{/*
+High availability is enabled explicitly, or implied by running more than one replica.
+*/}}
+{{- define "telepresence.highAvailability" -}}
+{{- if or .Values.highAvailability.enabled (gt (int (default 1 .Values.replicaCount)) 1) }}
+{{- print "true" }}
+{{- end }}
+{{- end -}}
+
 {{/*
 Client RBAC name suffix
 */}}
@@ -75,7 +84,7 @@ RBAC rules required to create an intercept in a namespace; excludes any rules th
 - apiGroups:
   - ""
   resources: ["pods"]
-  verbs: ["get", "list", "create", "watch", "delete"]
+  verbs: ["get", "list", "create", "watch", "delete", "intercept"]
 - apiGroups:
   - ""
   resources: ["services"]
@@ -86,8 +95,12 @@ RBAC rules required to create an intercept in a namespace; excludes any rules th
   verbs: ["create"]
 - apiGroups:
   - "apps"
-  resources: ["deployments", "replicasets", "statefulsets"]
-  verbs: ["get", "list", "update", "patch"]
+  resources: ["deployments", "replicasets", "statefulsets", "daemonsets"]
+  verbs: ["get", "list", "update", "patch", "intercept"]
+- apiGroups:
+  - "argoproj.io"
+  resources: ["rollouts"]
+  verbs: ["get", "list", "update", "patch", "intercept"]
 - apiGroups:
   - "getambassador.io"
   resources: ["hosts", "mappings"]
@@ -15,6 +15,7 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/logging"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 func main() {
@@ -60,9 +61,26 @@ func main() {
 			os.Exit(1)
 		}
 		ctx = client.WithConfig(ctx, cfg)
+		shutdownTracing, err := tracing.Init(ctx, "cli", cfg.Tracing.OTLPEndpoint)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize tracing: %v", err)
+			os.Exit(1)
+		}
 		cmd = cli.Command(ctx)
-		if err := cmd.ExecuteContext(ctx); err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "%s: error: %v\n", cmd.CommandPath(), err)
+
+		// The root span of the trace is named after the executed subcommand, e.g. "telepresence intercept".
+		execCmd := cmd
+		if sub, _, err := cmd.Find(os.Args[1:]); err == nil {
+			execCmd = sub
+		}
+		ctx, span := tracing.Start(ctx, execCmd.CommandPath())
+		err = cmd.ExecuteContext(ctx)
+		tracing.End(span, err)
+		_ = shutdownTracing(context.Background())
+		if err != nil {
+			if !cli.PrintStructuredError(execCmd, err) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: error: %v\n", cmd.CommandPath(), err)
+			}
 			if errcat.GetCategory(err) > errcat.NoLogs {
 				summarizeLogs(ctx, cmd)
 				// If the user gets here, it might be an actual bug that they found, so
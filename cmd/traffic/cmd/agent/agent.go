@@ -10,13 +10,18 @@ import (
 	"time"
 
 	"github.com/sethvargo/go-envconfig"
+	corev1 "k8s.io/api/core/v1"
 
+	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/dpipe"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/metrics"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
@@ -26,23 +31,36 @@ type Config struct {
 	Namespace   string `env:"_TEL_AGENT_NAMESPACE,default="`
 	PodIP       string `env:"_TEL_AGENT_POD_IP,default="`
 	AgentPort   int32  `env:"_TEL_AGENT_PORT,default=9900"`
+	Protocol    string `env:"_TEL_AGENT_PROTOCOL,default=TCP"`
 	AppMounts   string `env:"_TEL_AGENT_APP_MOUNTS,default=/tel_app_mounts"`
 	AppPort     int32  `env:"_TEL_AGENT_APP_PORT,required"`
+	ExtraPorts  string `env:"_TEL_AGENT_EXTRA_PORTS,default="`
 	ManagerHost string `env:"_TEL_AGENT_MANAGER_HOST,default=traffic-manager"`
 	ManagerPort int32  `env:"_TEL_AGENT_MANAGER_PORT,default=8081"`
+	MetricsPort int32  `env:"_TEL_AGENT_METRICS_PORT,default=0"`
+
+	OTLPEndpoint string `env:"_TEL_AGENT_OTLP_ENDPOINT,default="`
+
+	HTTPSniffTimeout time.Duration `env:"_TEL_AGENT_HTTP_SNIFF_TIMEOUT,default=0s"`
 }
 
 var skipKeys = map[string]bool{
 	// Keys found in the Config
-	"_TEL_AGENT_NAME":         true,
-	"_TEL_AGENT_NAMESPACE":    true,
-	"_TEL_AGENT_POD_IP":       true,
-	"_TEL_AGENT_PORT":         true,
-	"_TEL_AGENT_APP_MOUNTS":   true,
-	"_TEL_AGENT_APP_PORT":     true,
-	"_TEL_AGENT_MANAGER_HOST": true,
-	"_TEL_AGENT_MANAGER_PORT": true,
-	"_TEL_AGENT_LOG_LEVEL":    true,
+	"_TEL_AGENT_NAME":          true,
+	"_TEL_AGENT_NAMESPACE":     true,
+	"_TEL_AGENT_POD_IP":        true,
+	"_TEL_AGENT_PORT":          true,
+	"_TEL_AGENT_PROTOCOL":      true,
+	"_TEL_AGENT_APP_MOUNTS":    true,
+	"_TEL_AGENT_APP_PORT":      true,
+	"_TEL_AGENT_EXTRA_PORTS":   true,
+	"_TEL_AGENT_MANAGER_HOST":  true,
+	"_TEL_AGENT_MANAGER_PORT":  true,
+	"_TEL_AGENT_METRICS_PORT":  true,
+	"_TEL_AGENT_OTLP_ENDPOINT": true,
+	"_TEL_AGENT_LOG_LEVEL":     true,
+
+	"_TEL_AGENT_HTTP_SNIFF_TIMEOUT": true,
 
 	// Keys that aren't useful when running on the local machine
 	"HOME":     true,
@@ -208,6 +226,14 @@ func Main(ctx context.Context, args ...string) error {
 	}
 	dlog.Infof(ctx, "%+v", config)
 
+	shutdownTracing, err := tracing.Init(ctx, "traffic-agent", config.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(dcontext.WithoutCancel(ctx))
+	}()
+
 	info := &rpc.AgentInfo{
 		Name:        config.Name,
 		PodIp:       config.PodIP,
@@ -224,6 +250,11 @@ func Main(ctx context.Context, args ...string) error {
 			Product: "telepresence",
 			Version: version.Version,
 		},
+		{
+			Name:    "http",
+			Product: "telepresence",
+			Version: version.Version,
+		},
 	}
 	info.Mechanisms = mechanisms
 
@@ -245,22 +276,59 @@ func Main(ctx context.Context, args ...string) error {
 		dlog.Info(ctx, "Not starting sftp-server ($APP_MOUNTS is empty or $USER is set)")
 	}
 
-	forwarderChan := make(chan *forwarder.Forwarder)
+	extraPorts, err := install.ParsePortMappings(config.ExtraPorts)
+	if err != nil {
+		return err
+	}
 
-	// Manage the forwarder
-	g.Go("forward", func(ctx context.Context) error {
-		ctx = tunnel.WithPool(ctx, tunnel.NewPool())
-		lisAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%d", config.AgentPort))
-		if err != nil {
-			close(forwarderChan)
-			return err
+	// Manage the forwarders, one for each port that the agent fronts. The first one is the
+	// forwarder for the primary port.
+	pool := tunnel.NewPool()
+	portMappings := append([]install.PortMapping{{
+		AgentPort: corev1.ContainerPort{ContainerPort: config.AgentPort, Protocol: corev1.Protocol(strings.ToUpper(config.Protocol))},
+		AppPort:   int(config.AppPort),
+	}}, extraPorts...)
+	forwarders := make([]*forwarder.Forwarder, len(portMappings))
+
+	// Events describing the traffic that the forwarders route to intercepts. They are reported
+	// to the traffic-manager by the client.
+	events := make(chan *rpc.InterceptEvent, 1000)
+	for i, pm := range portMappings {
+		var fwd *forwarder.Forwarder
+		lisAddr := fmt.Sprintf(":%d", pm.AgentPort.ContainerPort)
+		if pm.AgentPort.Protocol == corev1.ProtocolUDP {
+			udpAddr, err := net.ResolveUDPAddr("udp", lisAddr)
+			if err != nil {
+				return err
+			}
+			fwd = forwarder.NewUDPForwarder(udpAddr, "", int32(pm.AppPort))
+		} else {
+			tcpAddr, err := net.ResolveTCPAddr("tcp", lisAddr)
+			if err != nil {
+				return err
+			}
+			fwd = forwarder.NewForwarder(tcpAddr, "", int32(pm.AppPort))
+			fwd.SetHTTPSniffTimeout(config.HTTPSniffTimeout)
 		}
+		fwd.SetInterceptEventHandler(func(ev *rpc.InterceptEvent) {
+			select {
+			case events <- ev:
+			default:
+				// Drop the event rather than slowing down the traffic
+			}
+		})
+		forwarders[i] = fwd
+		g.Go(fmt.Sprintf("forward-%d", pm.AgentPort.ContainerPort), func(ctx context.Context) error {
+			return fwd.Serve(tunnel.WithPool(ctx, pool))
+		})
+	}
 
-		forwarder := forwarder.NewForwarder(lisAddr, "", config.AppPort)
-		forwarderChan <- forwarder
-
-		return forwarder.Serve(ctx)
-	})
+	if config.MetricsPort != 0 {
+		reg := newMetricsRegistry(portMappings, forwarders, pool)
+		g.Go("metrics", func(ctx context.Context) error {
+			return metrics.Serve(ctx, fmt.Sprintf(":%d", config.MetricsPort), reg)
+		})
+	}
 
 	// Talk to the Traffic Manager
 	g.Go("client", func(ctx context.Context) error {
@@ -270,16 +338,11 @@ func Main(ctx context.Context, args ...string) error {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
-		forwarder := <-forwarderChan
-		if forwarder == nil {
-			return nil
-		}
-
 		sftpPort := <-sftpPortCh
-		state := NewState(forwarder, config.ManagerHost, config.Namespace, config.PodIP, sftpPort)
+		state := NewState(forwarders, config.ManagerHost, config.Namespace, config.PodIP, sftpPort)
 
 		for {
-			if err := TalkToManager(ctx, gRPCAddress, info, state); err != nil {
+			if err := TalkToManager(ctx, gRPCAddress, info, state, events); err != nil {
 				dlog.Info(ctx, err)
 			}
 
@@ -11,15 +11,22 @@ import (
 	"time"
 
 	"github.com/blang/semver"
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
@@ -27,7 +34,7 @@ func GetAmbassadorCloudConnectionInfo(ctx context.Context, address string) (*rpc
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+	conn, err := grpc.DialContext(ctx, address, append(tracing.DialOptions(), grpc.WithInsecure(), grpc.WithBlock())...)
 	if err != nil {
 		return &rpc.AmbassadorCloudConnection{}, err
 	}
@@ -41,15 +48,20 @@ func GetAmbassadorCloudConnectionInfo(ctx context.Context, address string) (*rpc
 	return cloudConnectInfo, nil
 }
 
-func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, state State) error {
+func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, state State, events <-chan *rpc.InterceptEvent) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+	dial := func(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+		return grpc.DialContext(ctx, address, append(append(tracing.DialOptions(), grpc.WithInsecure(), grpc.WithBlock()), opts...)...)
+	}
+	conn, err := dial()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer func() {
+		conn.Close()
+	}()
 
 	manager := rpc.NewManagerClient(conn)
 
@@ -66,6 +78,19 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	}
 
 	session, err := manager.ArriveAsAgent(ctx, info)
+	if status.Code(err) == codes.Unauthenticated {
+		// The traffic-manager requires that the agent proves that it runs in the pod that it
+		// claims to run in, using the token of the pod's service account, on every call.
+		if _, err = os.Stat(serviceAccountTokenFile); err != nil {
+			return fmt.Errorf("unable to read the service account token: %w", err)
+		}
+		conn.Close()
+		if conn, err = dial(grpc.WithPerRPCCredentials(serviceAccountToken{})); err != nil {
+			return err
+		}
+		manager = rpc.NewManagerClient(conn)
+		session, err = manager.ArriveAsAgent(ctx, info)
+	}
 	if err != nil {
 		return err
 	}
@@ -111,6 +136,13 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	}
 	go lookupHostWaitLoop(ctx, manager, session, lrStream)
 
+	// Deal with DNS queries dispatched to this agent during intercepts
+	drStream, err := manager.WatchLookupDNS(ctx, session)
+	if err != nil {
+		return err
+	}
+	go lookupDNSWaitLoop(ctx, manager, session, drStream)
+
 	// Deal with dial requests from the manager
 	dialerStream, err := manager.WatchDial(ctx, session)
 	if err != nil {
@@ -125,6 +157,9 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	}
 	go logLevelWaitLoop(ctx, logLevelStream)
 
+	// Report the traffic that is routed to intercepts
+	go interceptEventsLoop(ctx, manager, session, events)
+
 	// Loop calling Remain
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -143,12 +178,8 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 		case <-ctx.Done():
 			return nil
 		case snapshot := <-snapshots:
-			reviews := state.HandleIntercepts(ctx, snapshot.Intercepts)
-			for _, review := range reviews {
-				review.Session = session
-				if _, err := manager.ReviewIntercept(ctx, review); err != nil {
-					return err
-				}
+			if err := reviewIntercepts(ctx, manager, session, state, snapshot.Intercepts); err != nil {
+				return err
 			}
 		case <-ticker.C:
 		}
@@ -159,6 +190,28 @@ func TalkToManager(ctx context.Context, address string, info *rpc.AgentInfo, sta
 	}
 }
 
+// serviceAccountTokenFile is the file of the token of the service account that the pod runs as. The
+// traffic-agent container keeps the path of the mount of the service account.
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// serviceAccountToken is a credentials.PerRPCCredentials that sends the token of the service account
+// of the pod to the traffic-manager. The token is read for each call, because the kubelet rotates it.
+type serviceAccountToken struct{}
+
+func (serviceAccountToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := os.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the service account token: %w", err)
+	}
+	return map[string]string{"authorization": "Bearer " + strings.TrimSpace(string(token))}, nil
+}
+
+// RequireTransportSecurity returns false because the traffic-manager is reached over the cluster
+// network without TLS.
+func (serviceAccountToken) RequireTransportSecurity() bool {
+	return false
+}
+
 func interceptWaitLoop(ctx context.Context, cancel context.CancelFunc, snapshots chan<- *rpc.InterceptInfoSnapshot, stream rpc.Manager_WatchInterceptsClient) {
 	defer cancel() // Drop the gRPC connection if we leave this function
 	for {
@@ -173,6 +226,49 @@ func interceptWaitLoop(ctx context.Context, cancel context.CancelFunc, snapshots
 	}
 }
 
+// interceptEventsLoop reports the events that describe the traffic that is routed to intercepts to
+// the traffic-manager. The messages of the stream don't carry the session, so it's sent in the
+// metadata of the stream. It returns when the stream fails, e.g. because the traffic-manager is too
+// old to support it, and events are then dropped by the forwarders.
+func interceptEventsLoop(ctx context.Context, manager rpc.ManagerClient, session *rpc.SessionInfo, events <-chan *rpc.InterceptEvent) {
+	stream, err := manager.ReportInterceptEvents(metadata.AppendToOutgoingContext(ctx, install.AgentSessionIDMetadata, session.SessionId))
+	if err != nil {
+		dlog.Debugf(ctx, "ReportInterceptEvents: %+v", err)
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			if err := stream.Send(ev); err != nil {
+				if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+					dlog.Debugf(ctx, "intercept event stream send: %+v", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// reviewIntercepts lets the state review the given intercepts and reports the resulting reviews
+// to the traffic-manager.
+func reviewIntercepts(ctx context.Context, manager rpc.ManagerClient, session *rpc.SessionInfo, state State, cepts []*rpc.InterceptInfo) (err error) {
+	ctx, span := tracing.Start(ctx, "ReviewIntercepts", attribute.Int("telepresence.intercepts", len(cepts)))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	reviews := state.HandleIntercepts(ctx, cepts)
+	for _, review := range reviews {
+		review.Session = session
+		if _, err = manager.ReviewIntercept(ctx, review); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func lookupHostWaitLoop(ctx context.Context, manager rpc.ManagerClient, session *rpc.SessionInfo, lookupHostStream rpc.Manager_WatchLookupHostClient) {
 	for ctx.Err() == nil {
 		lr, err := lookupHostStream.Recv()
@@ -219,6 +315,45 @@ func lookupAndRespond(ctx context.Context, manager rpc.ManagerClient, session *r
 	}
 }
 
+func lookupDNSWaitLoop(ctx context.Context, manager rpc.ManagerClient, session *rpc.SessionInfo, lookupDNSStream rpc.Manager_WatchLookupDNSClient) {
+	for ctx.Err() == nil {
+		dr, err := lookupDNSStream.Recv()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				dlog.Debugf(ctx, "DNS request stream recv: %+v", err)
+			}
+			return
+		}
+		go lookupDNSAndRespond(ctx, manager, session, dr)
+	}
+}
+
+func lookupDNSAndRespond(ctx context.Context, manager rpc.ManagerClient, session *rpc.SessionInfo, dr *rpc.DNSRequest) {
+	qType := dns.Type(dr.Type)
+	dlog.Debugf(ctx, "DNSRequest for %s %s", qType, dr.Name)
+	response := rpc.DNSAgentResponse{
+		Session: session,
+		Request: dr,
+	}
+
+	rrs, rcode, err := dnsproxy.Lookup(ctx, uint16(dr.Type), dr.Name)
+	if err != nil {
+		dlog.Errorf(ctx, "LookupDNS: %v", err)
+	} else {
+		dlog.Debugf(ctx, "DNS response for %s %s -> %s, %d RRs", qType, dr.Name, dns.RcodeToString[rcode], len(rrs))
+		response.Response = &rpc.DNSResponse{Rcode: int32(rcode)}
+		if response.Response.Rrs, err = dnsproxy.PackRRs(rrs); err != nil {
+			dlog.Errorf(ctx, "LookupDNS: %v", err)
+			response.Response = nil
+		}
+	}
+	if _, err = manager.AgentLookupDNSResponse(ctx, &response); err != nil {
+		if ctx.Err() == nil {
+			dlog.Debugf(ctx, "DNS response: %+v %v", err, &response)
+		}
+	}
+}
+
 // GetLogLevel will return the log level that this agent should use
 func GetLogLevel() string {
 	level, ok := os.LookupEnv(install.EnvPrefix + "LOG_LEVEL")
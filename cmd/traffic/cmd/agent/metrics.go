@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/metrics"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+const metricsSubsystem = "agent"
+
+var (
+	forwarderConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, metricsSubsystem, "forwarder_connections_total"),
+		"Number of connections that a forwarder has routed to the app container or to intercepts.",
+		[]string{"port", "protocol", "target"}, nil)
+
+	tunnelConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, metricsSubsystem, "tunnel_connections"),
+		"Number of connections that are currently open through the tunnels to the traffic-manager.",
+		nil, nil)
+)
+
+// agentCollector collects the connection counts of the forwarders and the tunnel pool of the
+// agent when the metrics are scraped.
+type agentCollector struct {
+	portMappings []install.PortMapping
+	forwarders   []*forwarder.Forwarder
+	pool         *tunnel.Pool
+}
+
+func (c *agentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- forwarderConnectionsDesc
+	ch <- tunnelConnectionsDesc
+}
+
+func (c *agentCollector) Collect(ch chan<- prometheus.Metric) {
+	for i, fwd := range c.forwarders {
+		pm := c.portMappings[i]
+		port := strconv.Itoa(int(pm.AgentPort.ContainerPort))
+		proto := strings.ToLower(string(pm.AgentPort.Protocol))
+		app, intercepted := fwd.Connections()
+		ch <- prometheus.MustNewConstMetric(forwarderConnectionsDesc, prometheus.CounterValue, float64(app), port, proto, "app")
+		ch <- prometheus.MustNewConstMetric(forwarderConnectionsDesc, prometheus.CounterValue, float64(intercepted), port, proto, "intercept")
+	}
+	ch <- prometheus.MustNewConstMetric(tunnelConnectionsDesc, prometheus.GaugeValue, float64(c.pool.Len()))
+}
+
+// newMetricsRegistry returns a registry with the metrics of the given forwarders and tunnel pool.
+func newMetricsRegistry(portMappings []install.PortMapping, forwarders []*forwarder.Forwarder, pool *tunnel.Pool) *prometheus.Registry {
+	reg := metrics.NewRegistry()
+	reg.MustRegister(&agentCollector{portMappings: portMappings, forwarders: forwarders, pool: pool})
+	return reg
+}
@@ -2,7 +2,10 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/blang/semver"
 
@@ -18,23 +21,29 @@ type State interface {
 
 // State of the Traffic Agent.
 type state struct {
-	forwarder   *forwarder.Forwarder
+	// forwarders contains one forwarder per app port that the agent fronts. The first one
+	// forwards the primary port, i.e. the port used by intercepts that don't declare any ports.
+	forwarders  []*forwarder.Forwarder
 	managerHost string
-	appHost     string
-	appPort     int32
-	chosenID    string
+	chosen      []*chosenIntercept
 	namespace   string
 	podIP       string
 	sftpPort    int32
 }
 
-func NewState(forwarder *forwarder.Forwarder, managerHost, namespace, podIP string, sftpPort int32) State {
-	host, port := forwarder.Target()
+// chosenIntercept is an intercept that the agent has accepted, in the order of acceptance.
+type chosenIntercept struct {
+	id        string
+	mechanism string
+	predicate *forwarder.Predicate
+	appPorts  []int32
+	mirror    bool
+}
+
+func NewState(forwarders []*forwarder.Forwarder, managerHost, namespace, podIP string, sftpPort int32) State {
 	return &state{
-		forwarder:   forwarder,
+		forwarders:  forwarders,
 		managerHost: managerHost,
-		appHost:     host,
-		appPort:     port,
 		namespace:   namespace,
 		podIP:       podIP,
 		sftpPort:    sftpPort,
@@ -42,108 +51,282 @@ func NewState(forwarder *forwarder.Forwarder, managerHost, namespace, podIP stri
 }
 
 func (s *state) SetManager(sessionInfo *manager.SessionInfo, manager manager.ManagerClient, version semver.Version) {
-	s.forwarder.SetManager(sessionInfo, manager, version)
+	for _, f := range s.forwarders {
+		f.SetManager(sessionInfo, manager, version)
+	}
 }
 
-func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
-	var chosenIntercept, activeIntercept *manager.InterceptInfo
+// appPorts returns the app ports that the given intercept spans, or an error if one of them isn't
+// fronted by this agent or can't be intercepted using the intercept's mechanism.
+func (s *state) appPorts(cept *manager.InterceptInfo) ([]int32, error) {
+	var appPorts []int32
+	if len(cept.Spec.Ports) == 0 {
+		_, port := s.forwarders[0].Target()
+		appPorts = []int32{port}
+	} else {
+		appPorts = make([]int32, len(cept.Spec.Ports))
+		for i, ip := range cept.Spec.Ports {
+			if s.forwarderFor(ip.ContainerPort) == nil {
+				return nil, fmt.Errorf("the traffic-agent doesn't front container port %d (service port %s)", ip.ContainerPort, ip.ServicePortIdentifier)
+			}
+			appPorts[i] = ip.ContainerPort
+		}
+	}
+	if cept.Spec.Mechanism == "http" {
+		if cept.Spec.Mirror {
+			return nil, errors.New("the http mechanism cannot be used to mirror traffic")
+		}
+		for _, port := range appPorts {
+			if s.forwarderFor(port).Protocol() == "udp" {
+				return nil, fmt.Errorf("the http mechanism cannot intercept UDP port %d", port)
+			}
+		}
+	}
+	if cept.Spec.Mirror {
+		for _, port := range appPorts {
+			if s.forwarderFor(port).Protocol() == "udp" {
+				return nil, fmt.Errorf("UDP port %d cannot be mirrored", port)
+			}
+		}
+	}
+	return appPorts, nil
+}
 
-	dlog.Debug(ctx, "HandleIntercepts called")
+// protocols returns the protocols of the ports that the given intercept spans and that are fronted
+// by this agent.
+func (s *state) protocols(cept *manager.InterceptInfo) []string {
+	if len(cept.Spec.Ports) == 0 {
+		return []string{s.forwarders[0].Protocol()}
+	}
+	var protocols []string
+	for _, ip := range cept.Spec.Ports {
+		if f := s.forwarderFor(ip.ContainerPort); f != nil {
+			protocols = append(protocols, f.Protocol())
+		}
+	}
+	return protocols
+}
 
-	// Find the chosen intercept if it still exists
-	if s.chosenID != "" {
-		for _, cept := range cepts {
-			if cept.Id == s.chosenID {
-				chosenIntercept = cept
-				break
-			}
+func (s *state) forwarderFor(appPort int32) *forwarder.Forwarder {
+	for _, f := range s.forwarders {
+		if _, port := f.Target(); port == appPort {
+			return f
 		}
+	}
+	return nil
+}
 
-		if chosenIntercept != nil {
-			// The chosen intercept still exists
-			if chosenIntercept.Disposition == manager.InterceptDispositionType_ACTIVE {
-				// and is active
-				activeIntercept = chosenIntercept
-			}
+func (s *state) HandleIntercepts(ctx context.Context, cepts []*manager.InterceptInfo) []*manager.ReviewInterceptRequest {
+	dlog.Debug(ctx, "HandleIntercepts called")
+
+	ceptsByID := make(map[string]*manager.InterceptInfo, len(cepts))
+	for _, cept := range cepts {
+		ceptsByID[cept.Id] = cept
+	}
+
+	// Forget about chosen intercepts that no longer exist
+	chosen := s.chosen[:0]
+	for _, ci := range s.chosen {
+		if _, ok := ceptsByID[ci.id]; ok {
+			chosen = append(chosen, ci)
 		} else {
 			// The chosen intercept was deleted by the user
-			dlog.Info(ctx, "The previously-active intercept has been deleted")
-			s.chosenID = ""
+			dlog.Infof(ctx, "The previously-chosen intercept %q has been deleted", ci.id)
 		}
-	} else {
-		// Attach to already ACTIVE intercept if there is one.
-		for _, cept := range cepts {
-			if cept.Disposition == manager.InterceptDispositionType_ACTIVE {
-				chosenIntercept = cept
-				s.chosenID = cept.Id
-				activeIntercept = cept
-				break
+	}
+	s.chosen = chosen
+
+	reviews := []*manager.ReviewInterceptRequest{}
+
+	// Attach to already ACTIVE intercepts that we don't know about, e.g. because the agent was
+	// restarted. Those that this agent can't serve are reported as AGENT_ERROR, so that they don't
+	// remain ACTIVE without receiving any traffic.
+	for _, cept := range cepts {
+		if cept.Disposition == manager.InterceptDispositionType_ACTIVE && s.findChosen(cept.Id) == nil {
+			predicate, err := forwarder.ParsePredicate(cept.Id, cept.Spec.Mechanism, cept.Spec.MechanismArgs)
+			if err == nil {
+				var appPorts []int32
+				if appPorts, err = s.appPorts(cept); err == nil {
+					s.chosen = append(s.chosen, &chosenIntercept{id: cept.Id, mechanism: cept.Spec.Mechanism, predicate: predicate, appPorts: appPorts, mirror: cept.Spec.Mirror})
+					continue
+				}
 			}
+			dlog.Infof(ctx, "Setting active intercept %q as AGENT_ERROR: %v", cept.Id, err)
+			reviews = append(reviews, &manager.ReviewInterceptRequest{
+				Id:          cept.Id,
+				Disposition: manager.InterceptDispositionType_AGENT_ERROR,
+				Message:     err.Error(),
+			})
 		}
 	}
 
 	// Update forwarding
-	s.forwarder.SetIntercepting(activeIntercept)
+	for _, f := range s.forwarders {
+		_, appPort := f.Target()
+		var activeIntercepts []*manager.InterceptInfo
+		for _, ci := range s.chosen {
+			if cept := ceptsByID[ci.id]; cept.Disposition == manager.InterceptDispositionType_ACTIVE && containsPort(ci.appPorts, appPort) {
+				activeIntercepts = append(activeIntercepts, cept)
+			}
+		}
+		f.SetIntercepting(activeIntercepts)
+	}
 
 	// Review waiting intercepts
-	reviews := []*manager.ReviewInterceptRequest{}
 	for _, cept := range cepts {
-		if cept.Disposition == manager.InterceptDispositionType_WAITING {
-			// This intercept is ready to be active
-			switch {
-			case chosenIntercept != nil && cept.Id == chosenIntercept.Id:
-				// We've already chosen this one and marked it active, but it's not
-				// active yet in this snapshot.  We could probably just do nothing
-				// and it would probably change to ACTIVE in the very next snapshot
-				// because we already marked it active from a previous snapshot and
-				// that just hasn't propagated yet.  But let's go ahead and tell the
-				// manager to mark it ACTIVE again anyway, just to be safe.
-				dlog.Infof(ctx, "Setting intercept %q as ACTIVE (again?)", cept.Id)
-				reviews = append(reviews, &manager.ReviewInterceptRequest{
-					Id:                cept.Id,
-					Disposition:       manager.InterceptDispositionType_ACTIVE,
-					PodIp:             s.podIP,
-					SftpPort:          s.sftpPort,
-					MechanismArgsDesc: "all TCP connections",
-				})
-			case chosenIntercept == nil:
-				// We don't have an intercept in play, so choose this one. All
-				// agents will get intercepts in the same order every time, so
-				// this will yield a consistent result. Note that the intercept
-				// will not become active at this time. That will happen later,
-				// once the manager assigns a port.
-				dlog.Infof(ctx, "Setting intercept %q as ACTIVE", cept.Id)
-				s.chosenID = cept.Id
-				chosenIntercept = cept
-				reviews = append(reviews, &manager.ReviewInterceptRequest{
-					Id:                cept.Id,
-					Disposition:       manager.InterceptDispositionType_ACTIVE,
-					PodIp:             s.podIP,
-					SftpPort:          s.sftpPort,
-					MechanismArgsDesc: "all TCP connections",
-				})
-			default:
-				// We already have an intercept in play, so reject this one.
-				dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; as it conflicts with %q as the current chosen-to-be-ACTIVE intercept", cept.Id, s.chosenID)
-				var msg string
-				if chosenIntercept.Disposition == manager.InterceptDispositionType_ACTIVE {
-					msg = fmt.Sprintf("Conflicts with the currently-served intercept %q", s.chosenID)
-				} else {
-					msg = fmt.Sprintf("Conflicts with the currently-waiting-to-be-served intercept %q", s.chosenID)
-				}
-				reviews = append(reviews, &manager.ReviewInterceptRequest{
-					Id:                cept.Id,
-					Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
-					Message:           msg,
-					MechanismArgsDesc: "all TCP connections",
-				})
+		if cept.Disposition != manager.InterceptDispositionType_WAITING {
+			continue
+		}
+		predicate, err := forwarder.ParsePredicate(cept.Id, cept.Spec.Mechanism, cept.Spec.MechanismArgs)
+		if err != nil {
+			dlog.Infof(ctx, "Setting intercept %q as BAD_ARGS: %v", cept.Id, err)
+			reviews = append(reviews, &manager.ReviewInterceptRequest{
+				Id:          cept.Id,
+				Disposition: manager.InterceptDispositionType_BAD_ARGS,
+				Message:     err.Error(),
+			})
+			continue
+		}
+		desc := predicate.Description(cept.Spec.Mechanism, s.protocols(cept)...)
+		appPorts, err := s.appPorts(cept)
+		if err != nil {
+			dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR: %v", cept.Id, err)
+			reviews = append(reviews, &manager.ReviewInterceptRequest{
+				Id:                cept.Id,
+				Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+				Message:           err.Error(),
+				MechanismArgsDesc: desc,
+			})
+			continue
+		}
+
+		if s.findChosen(cept.Id) != nil {
+			// We've already chosen this one and marked it active, but it's not
+			// active yet in this snapshot.  We could probably just do nothing
+			// and it would probably change to ACTIVE in the very next snapshot
+			// because we already marked it active from a previous snapshot and
+			// that just hasn't propagated yet.  But let's go ahead and tell the
+			// manager to mark it ACTIVE again anyway, just to be safe.
+			dlog.Infof(ctx, "Setting intercept %q as ACTIVE (again?)", cept.Id)
+			reviews = append(reviews, &manager.ReviewInterceptRequest{
+				Id:                cept.Id,
+				Disposition:       manager.InterceptDispositionType_ACTIVE,
+				PodIp:             s.podIP,
+				SftpPort:          s.sftpPort,
+				MechanismArgsDesc: desc,
+			})
+			continue
+		}
+
+		if conflict := s.findConflict(cept.Spec.Mirror, cept.Spec.Mechanism, predicate, appPorts); conflict != nil {
+			// The traffic selected by this intercept is already claimed by a chosen
+			// intercept, so reject this one.
+			dlog.Infof(ctx, "Setting intercept %q as AGENT_ERROR; as it conflicts with %q as a chosen-to-be-ACTIVE intercept", cept.Id, conflict.id)
+			var msg string
+			if ceptsByID[conflict.id].Disposition == manager.InterceptDispositionType_ACTIVE {
+				msg = fmt.Sprintf("Conflicts with the currently-served intercept %q", conflict.id)
+			} else {
+				msg = fmt.Sprintf("Conflicts with the currently-waiting-to-be-served intercept %q", conflict.id)
 			}
+			reviews = append(reviews, &manager.ReviewInterceptRequest{
+				Id:                cept.Id,
+				Disposition:       manager.InterceptDispositionType_AGENT_ERROR,
+				Message:           msg,
+				MechanismArgsDesc: desc,
+			})
+			continue
+		}
+
+		// Choose this one. All agents will get intercepts in the same order every time, so
+		// this will yield a consistent result. Note that the intercept will not become
+		// active at this time. That will happen later, once the manager assigns a port.
+		var msg string
+		var ids []string
+		for _, ci := range s.chosen {
+			if !cept.Spec.Mirror && !ci.mirror && overlaps(ci.appPorts, appPorts) {
+				ids = append(ids, strconv.Quote(ci.id))
+			}
+		}
+		if len(ids) > 0 {
+			msg = fmt.Sprintf("Shares the workload with intercept %s; traffic that matches several intercepts is routed to the one that was accepted first",
+				strings.Join(ids, ", "))
 		}
+		dlog.Infof(ctx, "Setting intercept %q as ACTIVE", cept.Id)
+		s.chosen = append(s.chosen, &chosenIntercept{id: cept.Id, mechanism: cept.Spec.Mechanism, predicate: predicate, appPorts: appPorts, mirror: cept.Spec.Mirror})
+		reviews = append(reviews, &manager.ReviewInterceptRequest{
+			Id:                cept.Id,
+			Disposition:       manager.InterceptDispositionType_ACTIVE,
+			Message:           msg,
+			PodIp:             s.podIP,
+			SftpPort:          s.sftpPort,
+			MechanismArgsDesc: desc,
+		})
 	}
 
 	return reviews
 }
 
+func (s *state) findChosen(id string) *chosenIntercept {
+	for _, ci := range s.chosen {
+		if ci.id == id {
+			return ci
+		}
+	}
+	return nil
+}
+
+// findConflict returns the first chosen intercept that conflicts with the given mechanism, predicate,
+// and app ports, or nil if no such intercept exists. Two intercepts that share an app port conflict
+// when one of them claims all traffic or when they claim exactly the same traffic. An intercept that
+// isn't an "http" intercept claims whole connections, so it also conflicts with an "http" intercept
+// that selects requests from the same sources. Other overlaps are permitted and resolved by the
+// forwarder, which routes traffic to the intercept that was chosen first. Mirror intercepts don't
+// take any traffic away from the workload or from other intercepts, so they never conflict.
+func (s *state) findConflict(mirror bool, mechanism string, predicate *forwarder.Predicate, appPorts []int32) *chosenIntercept {
+	if mirror {
+		return nil
+	}
+	for _, ci := range s.chosen {
+		if ci.mirror || !overlaps(ci.appPorts, appPorts) {
+			continue
+		}
+		if predicate.IsUnconditional() || ci.predicate.IsUnconditional() {
+			return ci
+		}
+		if (mechanism == "http") != (ci.mechanism == "http") {
+			if predicate.SourcesOverlap(ci.predicate) {
+				return ci
+			}
+		} else if predicate.Equal(ci.predicate) {
+			return ci
+		}
+	}
+	return nil
+}
+
+func containsPort(ports []int32, port int32) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b []int32) bool {
+	for _, p := range a {
+		if containsPort(b, p) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *state) Intercepting() bool {
-	return s.forwarder.Intercepting()
+	for _, f := range s.forwarders {
+		if f.Intercepting() {
+			return true
+		}
+	}
+	return false
 }
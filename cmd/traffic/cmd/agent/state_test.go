@@ -20,11 +20,11 @@ const (
 	mgrHost       = "managerHost"
 )
 
-func makeFS(t *testing.T) (*forwarder.Forwarder, agent.State) {
-	lAddr, err := net.ResolveTCPAddr("tcp", ":1111")
+func makeForwarder(t *testing.T, port int32) *forwarder.Forwarder {
+	lAddr, err := net.ResolveTCPAddr("tcp", ":0")
 	assert.NoError(t, err)
 
-	f := forwarder.NewForwarder(lAddr, appHost, appPort)
+	f := forwarder.NewForwarder(lAddr, appHost, port)
 	go func() {
 		if err := f.Serve(context.Background()); err != nil {
 			panic(err)
@@ -32,12 +32,28 @@ func makeFS(t *testing.T) (*forwarder.Forwarder, agent.State) {
 	}()
 
 	assert.Eventually(t, func() bool {
-		_, port := f.Target()
-		return port == appPort
+		_, p := f.Target()
+		return p == port
 	}, 1*time.Second, 10*time.Millisecond)
+	return f
+}
 
-	s := agent.NewState(f, mgrHost, "default", "xyz", 0)
+func makeUDPForwarder(t *testing.T, port int32) *forwarder.Forwarder {
+	lAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
 
+	f := forwarder.NewUDPForwarder(lAddr, appHost, port)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = f.Serve(ctx)
+	}()
+	return f
+}
+
+func makeFS(t *testing.T) (*forwarder.Forwarder, agent.State) {
+	f := makeForwarder(t, appPort)
+	s := agent.NewState([]*forwarder.Forwarder{f}, mgrHost, "default", "xyz", 0)
 	return f, s
 }
 
@@ -131,9 +147,380 @@ func TestState_HandleIntercepts(t *testing.T) {
 	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[0].Disposition)
 	a.Equal("Conflicts with the currently-served intercept \"intercept-01\"", reviews[0].Message)
 
+	// An unhealthy intercept keeps its claim, but the traffic is forwarded to the app container
+
+	cepts[0].Disposition = rpc.InterceptDispositionType_UNHEALTHY
+
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.False(f.Intercepting())
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[0].Disposition)
+
+	// The traffic is routed to the intercept again when it recovers
+
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.True(f.Intercepting())
+
 	// Handle resets state on an empty intercept list again
 
 	reviews = s.HandleIntercepts(ctx, nil)
 	a.Len(reviews, 0)
 	a.False(f.Intercepting())
 }
+
+func TestState_HandleIntercepts_HTTP(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	cepts := []*rpc.InterceptInfo{
+		{
+			Spec: &rpc.InterceptSpec{
+				Name:          "cept1Name",
+				Client:        "user@host1",
+				Agent:         "agentName",
+				Mechanism:     "http",
+				MechanismArgs: []string{"--match=x-foo"},
+				Namespace:     "default",
+			},
+			Id:          "intercept-01",
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		},
+		{
+			Spec: &rpc.InterceptSpec{
+				Name:          "cept2Name",
+				Client:        "user@host2",
+				Agent:         "agentName",
+				Mechanism:     "http",
+				MechanismArgs: []string{"--match=auto", "--match=x-foo=bar.*"},
+				Namespace:     "default",
+			},
+			Id:          "intercept-02",
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		},
+	}
+
+	// Intercepts with bad args are rejected and never chosen
+
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 2)
+	a.False(f.Intercepting())
+
+	a.Equal(rpc.InterceptDispositionType_BAD_ARGS, reviews[0].Disposition)
+	a.Contains(reviews[0].Message, `invalid --match "x-foo"`)
+
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Equal("HTTP requests that match all of the headers:\n"+
+		"  'x-telepresence-intercept-id: intercept-02'\n"+
+		"  'x-foo: bar.*'", reviews[1].MechanismArgsDesc)
+
+	// Handle updates forwarding
+
+	cepts = cepts[1:]
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	a.False(f.Intercepting())
+}
+
+func TestState_HandleIntercepts_Multiple(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	makeCept := func(id, mechanism string, args ...string) *rpc.InterceptInfo {
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:          id + "Name",
+				Client:        "user@" + id,
+				Agent:         "agentName",
+				Mechanism:     mechanism,
+				MechanismArgs: args,
+				Namespace:     "default",
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+
+	cepts := []*rpc.InterceptInfo{
+		makeCept("intercept-01", "http", "--path-prefix=/api"),
+		makeCept("intercept-02", "http", "--match=auto"),
+		makeCept("intercept-03", "http", "--path-prefix=/api"),
+		makeCept("intercept-04", "tcp", "--source=10.1.0.0/16"),
+		makeCept("intercept-05", "tcp"),
+		makeCept("intercept-06", "http", "--path-prefix=api"),
+	}
+
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 6)
+	a.False(f.Intercepting())
+
+	// Intercepts with different predicates share the agent
+
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(`HTTP requests with path prefix "/api"`, reviews[0].MechanismArgsDesc)
+	a.Empty(reviews[0].Message)
+
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Contains(reviews[1].Message, `Shares the workload with intercept "intercept-01"`)
+
+	// Intercepts with equal predicates, or that would claim all traffic, are rejected
+
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[2].Disposition)
+	a.Equal("Conflicts with the currently-waiting-to-be-served intercept \"intercept-01\"", reviews[2].Message)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[4].Disposition)
+	a.Equal(rpc.InterceptDispositionType_BAD_ARGS, reviews[5].Disposition)
+
+	// A tcp intercept takes the connections of its sources away from the http intercepts
+
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[3].Disposition)
+	a.Equal("all TCP connections from 10.1.0.0/16", reviews[3].MechanismArgsDesc)
+	a.Equal("Conflicts with the currently-waiting-to-be-served intercept \"intercept-01\"", reviews[3].Message)
+
+	// Handle updates forwarding
+
+	cepts = []*rpc.InterceptInfo{cepts[0], cepts[1]}
+	for _, cept := range cepts {
+		cept.Disposition = rpc.InterceptDispositionType_ACTIVE
+	}
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f.Intercepting())
+
+	// Removing one intercept leaves the others in place
+
+	cepts = cepts[1:]
+	cepts = append(cepts, makeCept("intercept-07", "http", "--path-prefix=/api"))
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 1)
+	a.True(f.Intercepting())
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Contains(reviews[0].Message, `Shares the workload with intercept "intercept-02"`)
+
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	a.False(f.Intercepting())
+}
+
+func TestState_HandleIntercepts_TCPSource(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	_, s := makeFS(t)
+
+	makeCept := func(id, mechanism string, args ...string) *rpc.InterceptInfo {
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:          id + "Name",
+				Client:        "user@" + id,
+				Agent:         "agentName",
+				Mechanism:     mechanism,
+				MechanismArgs: args,
+				Namespace:     "default",
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+
+	reviews := s.HandleIntercepts(ctx, []*rpc.InterceptInfo{
+		makeCept("intercept-01", "tcp", "--source=10.1.0.0/16"),
+		makeCept("intercept-02", "http", "--match=x-foo=bar"),
+		makeCept("intercept-03", "http", "--source=10.1.2.0/24", "--path-prefix=/api"),
+		makeCept("intercept-04", "http", "--source=10.2.0.0/16"),
+		makeCept("intercept-05", "tcp", "--source=10.2.3.4"),
+	})
+	a.Len(reviews, 5)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+
+	// The tcp intercept shadows the http intercepts that select requests from its sources, whatever
+	// their headers and path prefixes
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[1].Disposition)
+	a.Equal("Conflicts with the currently-waiting-to-be-served intercept \"intercept-01\"", reviews[1].Message)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[2].Disposition)
+	a.Equal("Conflicts with the currently-waiting-to-be-served intercept \"intercept-01\"", reviews[2].Message)
+
+	// Sources that don't overlap don't conflict
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[3].Disposition)
+
+	// A tcp intercept can't shadow an http intercept that was chosen before it either
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[4].Disposition)
+	a.Equal("Conflicts with the currently-waiting-to-be-served intercept \"intercept-04\"", reviews[4].Message)
+}
+
+func TestState_HandleIntercepts_Mirror(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	_, s := makeFS(t)
+
+	makeCept := func(id, mechanism string, mirror bool) *rpc.InterceptInfo {
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:      id + "Name",
+				Client:    "user@" + id,
+				Agent:     "agentName",
+				Mechanism: mechanism,
+				Namespace: "default",
+				Mirror:    mirror,
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+
+	reviews := s.HandleIntercepts(ctx, []*rpc.InterceptInfo{
+		makeCept("intercept-01", "tcp", false),
+		makeCept("intercept-02", "tcp", true),
+		makeCept("intercept-03", "tcp", true),
+		makeCept("intercept-04", "http", true),
+	})
+	a.Len(reviews, 4)
+
+	// Mirrors never conflict with other intercepts, nor with each other
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Empty(reviews[1].Message)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[2].Disposition)
+	a.Empty(reviews[2].Message)
+
+	// The http mechanism routes requests, so it can't mirror
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[3].Disposition)
+	a.Equal("the http mechanism cannot be used to mirror traffic", reviews[3].Message)
+}
+
+func TestState_HandleIntercepts_MultiplePorts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f1 := makeForwarder(t, appPort)
+	f2 := makeForwarder(t, appPort+1)
+	s := agent.NewState([]*forwarder.Forwarder{f1, f2}, mgrHost, "default", "xyz", 0)
+
+	makeCept := func(id string, ports ...*rpc.InterceptPort) *rpc.InterceptInfo {
+		return &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:      id + "Name",
+				Client:    "user@" + id,
+				Agent:     "agentName",
+				Mechanism: "tcp",
+				Namespace: "default",
+				Ports:     ports,
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+	}
+
+	cepts := []*rpc.InterceptInfo{
+		makeCept("intercept-01",
+			&rpc.InterceptPort{ServicePortIdentifier: "http", ContainerPort: appPort, TargetPort: 8080},
+			&rpc.InterceptPort{ServicePortIdentifier: "grpc", ContainerPort: appPort + 1, TargetPort: 8081}),
+		makeCept("intercept-02",
+			&rpc.InterceptPort{ServicePortIdentifier: "grpc", ContainerPort: appPort + 1, TargetPort: 8081}),
+		makeCept("intercept-03",
+			&rpc.InterceptPort{ServicePortIdentifier: "admin", ContainerPort: appPort + 2, TargetPort: 8082}),
+	}
+
+	reviews := s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 3)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+
+	// An intercept that overlaps one of the ports of an accepted intercept conflicts with it
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[1].Disposition)
+	a.Contains(reviews[1].Message, `"intercept-01"`)
+
+	// A port that the agent doesn't front cannot be intercepted
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[2].Disposition)
+	a.Contains(reviews[2].Message, "doesn't front container port")
+
+	cepts = cepts[:1]
+	cepts[0].Disposition = rpc.InterceptDispositionType_ACTIVE
+	reviews = s.HandleIntercepts(ctx, cepts)
+	a.Len(reviews, 0)
+	a.True(f1.Intercepting())
+	a.True(f2.Intercepting())
+
+	reviews = s.HandleIntercepts(ctx, nil)
+	a.Len(reviews, 0)
+	a.False(f1.Intercepting())
+	a.False(f2.Intercepting())
+}
+
+func TestState_HandleIntercepts_UDP(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f1 := makeForwarder(t, appPort)
+	f2 := makeUDPForwarder(t, appPort+1)
+	s := agent.NewState([]*forwarder.Forwarder{f1, f2}, mgrHost, "default", "xyz", 0)
+
+	makeCept := func(id, mechanism string, args []string, ports ...int32) *rpc.InterceptInfo {
+		cept := &rpc.InterceptInfo{
+			Spec: &rpc.InterceptSpec{
+				Name:          id + "Name",
+				Client:        "user@" + id,
+				Agent:         "agentName",
+				Mechanism:     mechanism,
+				MechanismArgs: args,
+				Namespace:     "default",
+			},
+			Id:          id,
+			Disposition: rpc.InterceptDispositionType_WAITING,
+		}
+		for _, port := range ports {
+			cept.Spec.Ports = append(cept.Spec.Ports, &rpc.InterceptPort{ContainerPort: port})
+		}
+		return cept
+	}
+
+	reviews := s.HandleIntercepts(ctx, []*rpc.InterceptInfo{
+		makeCept("intercept-01", "tcp", []string{"--source=10.1.0.0/16"}, appPort+1),
+		makeCept("intercept-02", "tcp", []string{"--source=10.2.0.0/16"}, appPort, appPort+1),
+		makeCept("intercept-03", "tcp", []string{"--source=10.3.0.0/16"}, appPort),
+		makeCept("intercept-04", "http", nil, appPort+1),
+	})
+	a.Len(reviews, 4)
+
+	// The description names the protocols of the intercepted ports
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[0].Disposition)
+	a.Equal("all UDP datagrams from 10.1.0.0/16", reviews[0].MechanismArgsDesc)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[1].Disposition)
+	a.Equal("all TCP connections and UDP datagrams from 10.2.0.0/16", reviews[1].MechanismArgsDesc)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, reviews[2].Disposition)
+	a.Equal("all TCP connections from 10.3.0.0/16", reviews[2].MechanismArgsDesc)
+
+	// The http mechanism can't intercept UDP
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[3].Disposition)
+	a.Equal("the http mechanism cannot intercept UDP port 5001", reviews[3].Message)
+}
+
+func TestState_HandleIntercepts_ActiveWithBadArgs(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assert.New(t)
+	f, s := makeFS(t)
+
+	// An ACTIVE intercept that this agent can't parse, e.g. because it was accepted by an agent
+	// of another version, is reported rather than left active without any traffic.
+	reviews := s.HandleIntercepts(ctx, []*rpc.InterceptInfo{{
+		Spec: &rpc.InterceptSpec{
+			Name:          "cept1Name",
+			Client:        "user@host1",
+			Agent:         "agentName",
+			Mechanism:     "http",
+			MechanismArgs: []string{"--http-match=bogus"},
+			Namespace:     "default",
+		},
+		Id:          "intercept-01",
+		Disposition: rpc.InterceptDispositionType_ACTIVE,
+	}})
+	a.Len(reviews, 1)
+	a.Equal("intercept-01", reviews[0].Id)
+	a.Equal(rpc.InterceptDispositionType_AGENT_ERROR, reviews[0].Disposition)
+	a.NotEmpty(reviews[0].Message)
+	a.False(f.Intercepting())
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/coreos/go-iptables/iptables"
 	"github.com/sethvargo/go-envconfig"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 )
@@ -21,36 +22,67 @@ type config struct {
 	AgentPort     int    `env:"AGENT_PORT,required"`
 	AppPort       int    `env:"APP_PORT,required"`
 	AgentProtocol string `env:"AGENT_PROTOCOL,required"`
+	ExtraPorts    string `env:"EXTRA_PORTS,default="`
 }
 
 func configureIptables(ctx context.Context, iptables *iptables.IPTables, loopback string, cfg config) error {
 	// These iptables rules implement routing such that a packet directed to the appPort will hit the agentPort instead.
 	// If there's no mesh this is simply request -> agent -> app (or intercept)
 	// However, if there's a service mesh we want to make sure we don't bypass the mesh, so the traffic will flow request -> mesh -> agent -> app
-	appPort := strconv.Itoa(cfg.AppPort)
-	agentPort := strconv.Itoa(cfg.AgentPort)
+	extraPorts, err := install.ParsePortMappings(cfg.ExtraPorts)
+	if err != nil {
+		return err
+	}
 	agentUID := strconv.FormatInt(install.AgentUID, 10)
 	// Clearing the inbound chain will create it if it doesn't exist, or clear it out if it does.
-	err := iptables.ClearChain(nat, inboundChain)
+	err = iptables.ClearChain(nat, inboundChain)
 	if err != nil {
 		return fmt.Errorf("failed to clear chain %s: %w", inboundChain, err)
 	}
-	// Use our inbound chain to direct traffic coming into the app port to the agent port.
-	err = iptables.AppendUnique(nat, inboundChain,
-		"-p", cfg.AgentProtocol, "--dport", appPort,
-		"-j", "REDIRECT", "--to-ports", agentPort)
-	if err != nil {
-		return fmt.Errorf("failed to append rule to %s: %w", inboundChain, err)
+	// Use our inbound chain to direct traffic coming into the app ports to the agent ports.
+	// The protocols are kept in the order that they're first seen.
+	var protocols []string
+	redirect := func(protocol string, appPort, agentPort int) error {
+		if protocol == "" {
+			protocol = string(corev1.ProtocolTCP)
+		}
+		known := false
+		for _, p := range protocols {
+			if p == protocol {
+				known = true
+				break
+			}
+		}
+		if !known {
+			protocols = append(protocols, protocol)
+		}
+		err := iptables.AppendUnique(nat, inboundChain,
+			"-p", protocol, "--dport", strconv.Itoa(appPort),
+			"-j", "REDIRECT", "--to-ports", strconv.Itoa(agentPort))
+		if err != nil {
+			return fmt.Errorf("failed to append rule to %s: %w", inboundChain, err)
+		}
+		return nil
+	}
+	if err = redirect(cfg.AgentProtocol, cfg.AppPort, cfg.AgentPort); err != nil {
+		return err
+	}
+	for _, pm := range extraPorts {
+		if err = redirect(string(pm.AgentPort.Protocol), pm.AppPort, int(pm.AgentPort.ContainerPort)); err != nil {
+			return err
+		}
 	}
 	// Direct everything coming into PREROUTING into our own inbound chain.
 	// We do this as an append instead of an insert because this will prevent us from interfering with a service mesh
 	// if one exists. If a service mesh exists, its PREROUTING rules will kick in before ours, ensuring traffic
 	// coming into the pod does not bypass the mesh.
-	err = iptables.AppendUnique(nat, "PREROUTING",
-		"-p", cfg.AgentProtocol,
-		"-j", inboundChain)
-	if err != nil {
-		return fmt.Errorf("failed to append prerouting rule to direct to %s: %w", inboundChain, err)
+	for _, protocol := range protocols {
+		err = iptables.AppendUnique(nat, "PREROUTING",
+			"-p", protocol,
+			"-j", inboundChain)
+		if err != nil {
+			return fmt.Errorf("failed to append prerouting rule to direct to %s: %w", inboundChain, err)
+		}
 	}
 	// Any traffic heading out of the loopback and into the app port (other than traffic from the agent) needs to
 	// be redirected to the agent. This will ensure that if there's a service mesh, when the mesh's proxy goes to
@@ -65,19 +97,21 @@ func configureIptables(ctx context.Context, iptables *iptables.IPTables, loopbac
 	// it needs to be redirected. This is so that if the traffic agent requests its own IP, it doesn't just
 	// serve the app but actually goes through the agent, and thus through any intercepts.
 	// This is needed to support requesting an intercepted pod by IP (or to intercept a headless service).
-	err = iptables.Insert(nat, "OUTPUT", 1,
-		"-o", loopback,
-		"-p", cfg.AgentProtocol,
-		"!", "-d", "127.0.0.1/32",
-		"-m", "owner", "--gid-owner", agentUID,
-		"-j", inboundChain)
-	if err != nil {
-		return fmt.Errorf("failed to insert --gid-owner rule in OUTPUT: %w", err)
+	for _, protocol := range protocols {
+		err = iptables.Insert(nat, "OUTPUT", 1,
+			"-o", loopback,
+			"-p", protocol,
+			"!", "-d", "127.0.0.1/32",
+			"-m", "owner", "--gid-owner", agentUID,
+			"-j", inboundChain)
+		if err != nil {
+			return fmt.Errorf("failed to insert --gid-owner rule in OUTPUT: %w", err)
+		}
 	}
 	// Finally, any other traffic heading out of the traffic agent should pass by unperturbed -- it should obviously not be
 	// redirected back into the agent, but it also should not pass through a mesh proxy.
 	// This will include not just agent->manager traffic but also the agent requesting 127.0.0.1:appPort to serve the application
-	err = iptables.Insert(nat, "OUTPUT", 2,
+	err = iptables.Insert(nat, "OUTPUT", 1+len(protocols),
 		"-m", "owner", "--gid-owner", agentUID,
 		"-j", "RETURN")
 	if err != nil {
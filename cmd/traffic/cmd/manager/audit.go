@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/audit"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+// runAudit writes the audit events of the client sessions, agent sessions, and intercepts to the
+// audit log and, when enabled, as Kubernetes Events of the intercepted workloads. The audit log
+// is written to stdout, which the traffic-manager doesn't log to, unless it's the path of a file.
+// A file is only readable by the traffic-manager's user, and it's never rotated.
+func (m *Manager) runAudit(ctx context.Context) error {
+	env := managerutil.GetEnv(ctx)
+	var sinks []audit.Sink
+	switch env.AuditLog {
+	case "":
+	case "stdout":
+		sinks = append(sinks, audit.NewJSONSink(os.Stdout))
+	default:
+		f, err := os.OpenFile(env.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("unable to open the audit log: %w", err)
+		}
+		defer f.Close()
+		sinks = append(sinks, audit.NewJSONSink(f))
+	}
+	if env.AuditKubernetesEvents {
+		sinks = append(sinks, audit.NewKubernetesSink(managerutil.GetK8sClientset(ctx), "traffic-manager"))
+	}
+	return audit.NewLogger(m.clock.Now, sinks...).Run(ctx,
+		m.state.WatchClients(ctx, nil),
+		m.state.WatchAgents(ctx, nil),
+		m.state.WatchIntercepts(ctx, nil))
+}
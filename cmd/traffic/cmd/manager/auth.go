@@ -0,0 +1,400 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+// interceptVerb is the custom verb that a client must be allowed to perform on a workload in order to
+// intercept it when client authentication is enabled.
+const interceptVerb = "intercept"
+
+// serviceAccountPrefix is the prefix of the usernames of service accounts.
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// podNameExtra is the key of the extra user info that names the pod that a bound service account
+// token was issued to.
+const podNameExtra = "authentication.kubernetes.io/pod-name"
+
+// tokenReviewTTL is the longest time that the result of a successful TokenReview is cached. A
+// result is never cached beyond the expiry of the token that it reviewed.
+const tokenReviewTTL = time.Minute
+
+// tokenReviews caches the results of successful TokenReviews, keyed by the SHA-256 hash of the
+// reviewed token, so that the clients and agents that call the traffic-manager often, e.g. once
+// per DNS query, don't cause a TokenReview on the API server for every call. The zero value is
+// ready to use.
+type tokenReviews struct {
+	sync.Mutex
+	reviews map[[sha256.Size]byte]*tokenReview
+}
+
+type tokenReview struct {
+	user    *authnv1.UserInfo
+	expires time.Time
+}
+
+// get returns the cached user of the token with the given hash, or nil when no unexpired review of
+// the token is cached.
+func (tr *tokenReviews) get(key [sha256.Size]byte, now time.Time) *authnv1.UserInfo {
+	tr.Lock()
+	defer tr.Unlock()
+	if r, ok := tr.reviews[key]; ok {
+		if now.Before(r.expires) {
+			return r.user
+		}
+		delete(tr.reviews, key)
+	}
+	return nil
+}
+
+// put caches the user of the token with the given hash until the given time, and drops the reviews
+// that have expired.
+func (tr *tokenReviews) put(key [sha256.Size]byte, user *authnv1.UserInfo, now, expires time.Time) {
+	tr.Lock()
+	defer tr.Unlock()
+	if tr.reviews == nil {
+		tr.reviews = make(map[[sha256.Size]byte]*tokenReview)
+	}
+	for k, r := range tr.reviews {
+		if !now.Before(r.expires) {
+			delete(tr.reviews, k)
+		}
+	}
+	tr.reviews[key] = &tokenReview{user: user, expires: expires}
+}
+
+// tokenExpiry returns the time when the given token expires, and false if the token isn't a JWT
+// with an "exp" claim. The token isn't verified; the expiry only limits the time that a review of
+// the token is cached.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*claims.Exp, 0), true
+}
+
+// bearerToken returns the bearer token in the "authorization" metadata of the given incoming
+// context, or an empty string if there is none.
+func bearerToken(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			if strings.HasPrefix(auth, "Bearer ") {
+				return strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+	}
+	return ""
+}
+
+// agentTokens records the hash of the token that each agent session was last authenticated with,
+// so that the later calls of an agent don't need to verify its pod again. The zero value is ready
+// to use.
+type agentTokens struct {
+	sync.Mutex
+	tokens map[string][sha256.Size]byte
+}
+
+func (at *agentTokens) matches(sessionID string, key [sha256.Size]byte) bool {
+	at.Lock()
+	defer at.Unlock()
+	k, ok := at.tokens[sessionID]
+	return ok && k == key
+}
+
+// set records the token hash of the given session, and drops the sessions that no longer exist.
+func (at *agentTokens) set(sessionID string, key [sha256.Size]byte, exists func(string) bool) {
+	at.Lock()
+	defer at.Unlock()
+	if at.tokens == nil {
+		at.tokens = make(map[string][sha256.Size]byte)
+	}
+	for id := range at.tokens {
+		if !exists(id) {
+			delete(at.tokens, id)
+		}
+	}
+	at.tokens[sessionID] = key
+}
+
+// authenticate verifies the bearer token in the "authorization" metadata of the given incoming
+// context, and returns the Kubernetes user that it identifies.
+func (m *Manager) authenticate(ctx context.Context) (*rpc.KubernetesUser, error) {
+	u, err := m.reviewToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.KubernetesUser{Username: u.Username, Uid: u.UID, Groups: u.Groups}, nil
+}
+
+// reviewToken verifies the bearer token in the "authorization" metadata of the given incoming
+// context using a TokenReview, and returns the info of the user that it identifies. The results of
+// successful reviews are cached for at most tokenReviewTTL.
+func (m *Manager) reviewToken(ctx context.Context) (*authnv1.UserInfo, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "the traffic-manager requires that clients authenticate with a Kubernetes bearer token")
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := m.clock.Now()
+	if u := m.tokens.get(key, now); u != nil {
+		return u, nil
+	}
+
+	tr, err := managerutil.GetK8sClientset(ctx).AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		dlog.Errorf(ctx, "TokenReview failed: %v", err)
+		return nil, status.Errorf(codes.Internal, "unable to review the token of the client: %v", err)
+	}
+	if !tr.Status.Authenticated {
+		msg := "the token of the client is not valid"
+		if tr.Status.Error != "" {
+			msg += ": " + tr.Status.Error
+		}
+		return nil, status.Error(codes.Unauthenticated, msg)
+	}
+	expires := now.Add(tokenReviewTTL)
+	if exp, ok := tokenExpiry(token); ok && exp.Before(expires) {
+		expires = exp
+	}
+	m.tokens.put(key, &tr.Status.User, now, expires)
+	return &tr.Status.User, nil
+}
+
+// authenticateClient verifies the caller of an RPC that acts on the session with the given ID when
+// client authentication is enabled. The caller of a client session must be the Kubernetes user that
+// the session was established for, so that the ID of a session can't be used on its own to act on
+// behalf of that user. The caller of an agent session must be the traffic-agent of that session, see
+// authenticateAgentSession. A caller without a session must be a valid user. The authenticated user
+// is returned, or nil when client authentication is disabled or when the session isn't a client
+// session.
+func (m *Manager) authenticateClient(ctx context.Context, sessionID string) (*rpc.KubernetesUser, error) {
+	if !managerutil.GetEnv(ctx).ClientAuth {
+		return nil, nil
+	}
+	if sessionID == "" {
+		return m.authenticate(ctx)
+	}
+	client := m.state.GetClient(sessionID)
+	if client == nil {
+		if agent := m.state.GetAgent(sessionID); agent != nil {
+			return nil, m.authenticateAgentSession(ctx, sessionID, agent)
+		}
+		return nil, nil
+	}
+	user, err := m.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if su := client.KubernetesUser; su == nil || su.Username != user.Username || su.Uid != user.Uid {
+		return nil, status.Errorf(codes.PermissionDenied, "user %s is not the user of the session of %s", user.Username, client.Name)
+	}
+	return user, nil
+}
+
+// authenticateAgent verifies that the bearer token of an arriving traffic-agent is the token of the
+// service account of the pod that the agent claims to run in, and that this pod has a traffic-agent
+// container and belongs to the workload of the agent.
+func (m *Manager) authenticateAgent(ctx context.Context, agent *rpc.AgentInfo) error {
+	u, err := m.reviewToken(ctx)
+	if err != nil {
+		return err
+	}
+	denied := func(format string, args ...interface{}) error {
+		return status.Errorf(codes.PermissionDenied, "traffic-agent %s.%s is not authorized: %s", agent.Name, agent.Namespace, fmt.Sprintf(format, args...))
+	}
+	sa := strings.Split(strings.TrimPrefix(u.Username, serviceAccountPrefix), ":")
+	if !strings.HasPrefix(u.Username, serviceAccountPrefix) || len(sa) != 2 || sa[0] != agent.Namespace {
+		return denied("%s is not a service account in namespace %s", u.Username, agent.Namespace)
+	}
+
+	pod, err := findPod(ctx, agent.PodIp, agent.Namespace)
+	if err != nil {
+		return denied("%v", err)
+	}
+	podSA := pod.Spec.ServiceAccountName
+	if podSA == "" {
+		podSA = "default"
+	}
+	if podSA != sa[1] {
+		return denied("pod %s runs as service account %s, not as %s", pod.Name, podSA, sa[1])
+	}
+	if names, ok := u.Extra[podNameExtra]; ok && (len(names) != 1 || names[0] != pod.Name) {
+		return denied("the token wasn't issued to pod %s", pod.Name)
+	}
+	hasAgent := false
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == install.AgentContainerName {
+			hasAgent = true
+			break
+		}
+	}
+	if !hasAgent {
+		return denied("pod %s has no %s container", pod.Name, install.AgentContainerName)
+	}
+	if _, err = workloadKindOf(ctx, pod, agent.Name); err != nil {
+		return denied("%v", err)
+	}
+	return nil
+}
+
+// authenticateAgentSession verifies that the caller of an RPC that acts on the agent session with
+// the given ID is the traffic-agent of that session. The caller must present the token that the
+// session was last authenticated with, or a token that passes authenticateAgent for the agent of the
+// session, e.g. because the service account token of its pod was rotated.
+func (m *Manager) authenticateAgentSession(ctx context.Context, sessionID string, agent *rpc.AgentInfo) error {
+	if _, err := m.reviewToken(ctx); err != nil {
+		return err
+	}
+	key := sha256.Sum256([]byte(bearerToken(ctx)))
+	if m.agentTokens.matches(sessionID, key) {
+		return nil
+	}
+	if err := m.authenticateAgent(ctx, agent); err != nil {
+		return err
+	}
+	m.agentTokens.set(sessionID, key, func(id string) bool { return m.state.GetAgent(id) != nil })
+	return nil
+}
+
+// authenticateAgentStream returns the agent session of the caller of a stream that an agent opens
+// without naming its session in the messages of the stream, such as ReportInterceptEvents. The agent
+// names the session in the metadata of the stream instead. A nil agent is returned when client
+// authentication is disabled and the caller doesn't name a session.
+func (m *Manager) authenticateAgentStream(ctx context.Context) (string, *rpc.AgentInfo, error) {
+	var sessionID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(install.AgentSessionIDMetadata); len(ids) > 0 {
+			sessionID = ids[0]
+		}
+	}
+	var agent *rpc.AgentInfo
+	if sessionID != "" {
+		agent = m.state.GetAgent(sessionID)
+	}
+	if !managerutil.GetEnv(ctx).ClientAuth {
+		return sessionID, agent, nil
+	}
+	if agent == nil {
+		return "", nil, status.Errorf(codes.Unauthenticated, "the traffic-manager requires that traffic-agents name their session")
+	}
+	if err := m.authenticateAgentSession(ctx, sessionID, agent); err != nil {
+		return "", nil, err
+	}
+	return sessionID, agent, nil
+}
+
+// authorizeIntercept uses a SubjectAccessReview to verify that the given user is allowed to perform
+// the interceptVerb on the workload of the given intercept spec. The WorkloadKind of the spec must
+// have been resolved by the traffic-manager.
+func authorizeIntercept(ctx context.Context, user *rpc.KubernetesUser, spec *rpc.InterceptSpec) error {
+	group, resource, ok := workloadResource(spec.WorkloadKind)
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "unable to authorize the intercept of %s.%s: unknown kind of workload %q",
+			spec.Agent, spec.Namespace, spec.WorkloadKind)
+	}
+	if user == nil {
+		return status.Errorf(codes.PermissionDenied, "an unauthenticated client is not allowed to intercept %s %s.%s",
+			resource, spec.Agent, spec.Namespace)
+	}
+	sar, err := managerutil.GetK8sClientset(ctx).AuthorizationV1().SubjectAccessReviews().Create(ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: spec.Namespace,
+				Verb:      interceptVerb,
+				Group:     group,
+				Resource:  resource,
+				Name:      spec.Agent,
+			},
+			User:   user.Username,
+			UID:    user.Uid,
+			Groups: user.Groups,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		dlog.Errorf(ctx, "SubjectAccessReview failed: %v", err)
+		return status.Errorf(codes.Internal, "unable to review the access of the client: %v", err)
+	}
+	if !sar.Status.Allowed {
+		msg := fmt.Sprintf("user %s is not allowed to %s %s %s.%s", user.Username, interceptVerb, resource, spec.Agent, spec.Namespace)
+		if sar.Status.Reason != "" {
+			msg += ": " + sar.Status.Reason
+		}
+		return status.Error(codes.PermissionDenied, msg)
+	}
+	return nil
+}
+
+// authorizeInterceptChange verifies, when client authentication is enabled, that the caller of an
+// RPC that acts on the session with the given ID is allowed to intercept the workload of the
+// intercept with the given ID, so that an intercept can only be changed or removed by a user that
+// would be allowed to create it. The kind of the workload is the kind that was determined when the
+// intercept was created.
+func (m *Manager) authorizeInterceptChange(ctx context.Context, sessionID, interceptID string) error {
+	if !managerutil.GetEnv(ctx).ClientAuth {
+		return nil
+	}
+	user, err := m.authenticateClient(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	ii, ok := m.state.GetIntercept(interceptID)
+	if !ok {
+		// The caller reports that the intercept doesn't exist
+		return nil
+	}
+	return authorizeIntercept(ctx, user, ii.Spec)
+}
+
+// workloadResource returns the API group and resource of the given kind of workload, and false when
+// the kind is unknown.
+func workloadResource(kind string) (group, resource string, ok bool) {
+	switch kind {
+	case "Deployment":
+		return "apps", "deployments", true
+	case "ReplicaSet":
+		return "apps", "replicasets", true
+	case "StatefulSet":
+		return "apps", "statefulsets", true
+	case "DaemonSet":
+		return "apps", "daemonsets", true
+	case "Rollout":
+		return "argoproj.io", "rollouts", true
+	case "Pod":
+		return "", "pods", true
+	default:
+		return "", "", false
+	}
+}
@@ -0,0 +1,250 @@
+package manager_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	appsv1 "k8s.io/api/apps/v1"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+func TestClientAuth(t *testing.T) {
+	ctx := dlog.NewTestContext(t, true)
+	testClients := testdata.GetTestClients(t)
+
+	// The hello and other deployments, and the db statefulset, each with one pod
+	controller := func(kind, name string) []metav1.OwnerReference {
+		isController := true
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+	}
+	pod := func(name, ip string, owner []metav1.OwnerReference) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owner},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "traffic-agent"}}},
+			Status:     corev1.PodStatus{PodIP: ip},
+		}
+	}
+	replicaSet := func(name, deployment string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: controller("Deployment", deployment)},
+		}
+	}
+	fakeClient := newTestK8sClient()
+	for _, obj := range []runtime.Object{
+		replicaSet("hello-6d4f8", "hello"),
+		pod("hello-6d4f8-x2x7c", "10.1.0.11", controller("ReplicaSet", "hello-6d4f8")),
+		replicaSet("other-77b9c", "other"),
+		pod("other-77b9c-k8v2d", "10.1.0.12", controller("ReplicaSet", "other-77b9c")),
+		pod("db-0", "10.1.0.13", controller("StatefulSet", "db")),
+	} {
+		require.NoError(t, fakeClient.Tracker().Add(obj))
+	}
+	var aliceReviews int32
+	fakeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tr := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if tr.Spec.Token == "alice-token" {
+			atomic.AddInt32(&aliceReviews, 1)
+		}
+		switch tr.Spec.Token {
+		case "alice-token":
+			tr.Status.Authenticated = true
+			tr.Status.User = authnv1.UserInfo{Username: "alice", UID: "alice-uid", Groups: []string{"developers"}}
+		case "bob-token":
+			tr.Status.Authenticated = true
+			tr.Status.User = authnv1.UserInfo{Username: "bob", UID: "bob-uid", Groups: []string{"developers"}}
+		case "agent-token":
+			tr.Status.Authenticated = true
+			tr.Status.User = authnv1.UserInfo{Username: "system:serviceaccount:default:default", UID: "default-uid"}
+		default:
+			tr.Status.Error = "invalid bearer token"
+		}
+		return true, tr, nil
+	})
+	var revoked atomic.Value
+	revoked.Store(false)
+	fakeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		ra := sar.Spec.ResourceAttributes
+		// Alice may intercept the deployments named hello and db, but there's no deployment named db
+		if !revoked.Load().(bool) && sar.Spec.User == "alice" && ra.Verb == "intercept" && ra.Group == "apps" && ra.Resource == "deployments" && (ra.Name == "hello" || ra.Name == "db") {
+			sar.Status.Allowed = true
+		} else {
+			sar.Status.Reason = "no RBAC policy matched"
+		}
+		return true, sar, nil
+	})
+
+	conn := getTestClientConnWithEnv(t, fakeClient, &managerutil.Env{
+		MaxReceiveSize:  resource.Quantity{},
+		PodCIDRStrategy: "environment",
+		PodCIDRs:        "192.168.0.0/16",
+		ClientAuth:      true,
+	})
+	defer conn.Close()
+	client := rpc.NewManagerClient(conn)
+
+	// A client without a token is asked to authenticate
+	_, err := client.ArriveAsClient(ctx, testClients["alice"])
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// A client with an invalid token is rejected
+	badCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer mallory-token")
+	_, err = client.ArriveAsClient(badCtx, testClients["alice"])
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "invalid bearer token")
+
+	aliceCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice-token")
+	sess, err := client.ArriveAsClient(aliceCtx, testClients["alice"])
+	require.NoError(t, err)
+
+	// The review of the token is cached, so frequent calls don't cause a TokenReview each
+	for i := 0; i < 5; i++ {
+		_, err = client.Remain(aliceCtx, &rpc.RemainRequest{Session: sess})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&aliceReviews))
+
+	agent := func(name, ip string) *rpc.AgentInfo {
+		return &rpc.AgentInfo{
+			Name:       name,
+			Namespace:  "default",
+			PodIp:      ip,
+			Product:    "telepresence",
+			Version:    "1",
+			Mechanisms: []*rpc.AgentInfo_Mechanism{{Name: "tcp", Product: "oss", Version: "1"}},
+		}
+	}
+
+	// An agent without a token is asked to authenticate
+	_, err = client.ArriveAsAgent(ctx, agent("hello", "10.1.0.11"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// An agent must present the token of the service account of its pod
+	_, err = client.ArriveAsAgent(aliceCtx, agent("hello", "10.1.0.11"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "alice is not a service account in namespace default")
+
+	// An agent can't claim to be the agent of another workload
+	agentCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer agent-token")
+	_, err = client.ArriveAsAgent(agentCtx, agent("other", "10.1.0.11"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "pod hello-6d4f8-x2x7c.default belongs to Deployment hello, not to other")
+
+	agentSessions := make(map[string]*rpc.SessionInfo)
+	for name, ip := range map[string]string{"hello": "10.1.0.11", "other": "10.1.0.12", "db": "10.1.0.13"} {
+		agentSessions[name], err = client.ArriveAsAgent(agentCtx, agent(name, ip))
+		require.NoError(t, err)
+	}
+
+	spec := func(name, agent, kind string) *rpc.InterceptSpec {
+		return &rpc.InterceptSpec{
+			Name:         name,
+			Namespace:    "default",
+			Client:       testClients["alice"].Name,
+			Agent:        agent,
+			WorkloadKind: kind,
+			Mechanism:    "tcp",
+			TargetHost:   "asdf",
+			TargetPort:   9876,
+		}
+	}
+
+	// Alice isn't allowed to intercept other workloads
+	_, err = client.CreateIntercept(aliceCtx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("other", "other", "Deployment")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "user alice is not allowed to intercept deployments other.default: no RBAC policy matched")
+
+	// The kind of workload that the client claims is ignored
+	_, err = client.CreateIntercept(aliceCtx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("db", "db", "Deployment")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "user alice is not allowed to intercept statefulsets db.default: no RBAC policy matched")
+
+	// A workload without an agent has no known kind
+	_, err = client.CreateIntercept(aliceCtx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("absent", "absent", "Deployment")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "unable to determine the kind of workload absent.default")
+
+	// The session ID alone doesn't authenticate the client, and it doesn't authenticate other users
+	_, err = client.CreateIntercept(ctx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("hello", "hello", "Deployment")})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	bobCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer bob-token")
+	_, err = client.CreateIntercept(bobCtx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("hello", "hello", "Deployment")})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "user bob is not the user of the session")
+
+	ii, err := client.CreateIntercept(aliceCtx, &rpc.CreateInterceptRequest{Session: sess, InterceptSpec: spec("hello", "hello", "StatefulSet")})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", ii.Spec.Name)
+	assert.Equal(t, "Deployment", ii.Spec.WorkloadKind)
+
+	// The calls of an agent must carry the token of the agent's session
+	dnsResponse := &rpc.DNSAgentResponse{
+		Session: agentSessions["hello"],
+		Request: &rpc.DNSRequest{Session: sess, Name: "hello", Type: 1},
+	}
+	_, err = client.AgentLookupDNSResponse(ctx, dnsResponse)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.AgentLookupDNSResponse(aliceCtx, dnsResponse)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.AgentLookupDNSResponse(agentCtx, dnsResponse)
+	require.NoError(t, err)
+
+	// An agent must name its session when it reports intercept events, and may only report the
+	// events of the intercepts of its own workload
+	reportEvent := func(ctx context.Context, agentName string) error {
+		if agentName != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, install.AgentSessionIDMetadata, agentSessions[agentName].SessionId)
+		}
+		stream, err := client.ReportInterceptEvents(ctx)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(&rpc.InterceptEvent{InterceptId: ii.Id}); err != nil && err != io.EOF {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	assert.Equal(t, codes.Unauthenticated, status.Code(reportEvent(agentCtx, "")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(reportEvent(ctx, "hello")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(reportEvent(agentCtx, "other")))
+	require.NoError(t, reportEvent(agentCtx, "hello"))
+
+	_, err = client.RemoveIntercept(bobCtx, &rpc.RemoveInterceptRequest2{Session: sess, Name: "hello"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// An intercept can't be changed or removed by a user that's no longer allowed to intercept
+	revoked.Store(true)
+	_, err = client.UpdateIntercept(aliceCtx, &rpc.UpdateInterceptRequest{
+		Session:             sess,
+		Name:                "hello",
+		PreviewDomainAction: &rpc.UpdateInterceptRequest_RemovePreviewDomain{RemovePreviewDomain: true},
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "user alice is not allowed to intercept deployments hello.default")
+	_, err = client.RemoveIntercept(aliceCtx, &rpc.RemoveInterceptRequest2{Session: sess, Name: "hello"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	revoked.Store(false)
+	_, err = client.RemoveIntercept(aliceCtx, &rpc.RemoveInterceptRequest2{Session: sess, Name: "hello"})
+	require.NoError(t, err)
+}
@@ -67,6 +67,10 @@ func validateIntercept(spec *rpc.InterceptSpec) string {
 		return "namespace must not be empty"
 	case spec.Mechanism == "":
 		return "mechanism must not be empty"
+	case spec.MaxLifetime != nil && spec.MaxLifetime.AsDuration() <= 0:
+		return "max lifetime must be positive"
+	case spec.IdleTimeout != nil && spec.IdleTimeout.AsDuration() <= 0:
+		return "idle timeout must be positive"
 	}
 
 	return ""
@@ -0,0 +1,311 @@
+// Package audit records who did what with intercepts, so that questions like "who intercepted
+// payments-api in staging last Tuesday, and for how long?" can be answered after the fact.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
+)
+
+// EventType is the type of an audit Event.
+type EventType string
+
+const (
+	ClientArrived     = EventType("client-arrived")
+	ClientDeparted    = EventType("client-departed")
+	AgentInstalled    = EventType("agent-installed")
+	InterceptCreated  = EventType("intercept-created")
+	InterceptReviewed = EventType("intercept-reviewed")
+	InterceptUpdated  = EventType("intercept-updated")
+	InterceptRemoved  = EventType("intercept-removed")
+)
+
+// Event is an entry of the audit log.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+
+	// Session is the ID of the session of the client or agent.
+	Session string `json:"session,omitempty"`
+
+	// Client is the name of the client, i.e. "user@host".
+	Client string `json:"client,omitempty"`
+
+	// User is the Kubernetes user that the client authenticated as.
+	User string `json:"user,omitempty"`
+
+	Intercept     string   `json:"intercept,omitempty"`
+	WorkloadKind  string   `json:"workloadKind,omitempty"`
+	Workload      string   `json:"workload,omitempty"`
+	Namespace     string   `json:"namespace,omitempty"`
+	Mechanism     string   `json:"mechanism,omitempty"`
+	MechanismArgs []string `json:"mechanismArgs,omitempty"`
+
+	Disposition         string `json:"disposition,omitempty"`
+	PreviousDisposition string `json:"previousDisposition,omitempty"`
+	Message             string `json:"message,omitempty"`
+
+	// Duration is how long an intercept lasted. It's only set when it's removed.
+	Duration string `json:"duration,omitempty"`
+}
+
+// Describe returns a one-line human readable description of the event.
+func (e *Event) Describe() string {
+	who := e.Client
+	if e.User != "" {
+		who = fmt.Sprintf("%s (%s)", e.Client, e.User)
+	}
+	sb := strings.Builder{}
+	switch e.Type {
+	case ClientArrived:
+		fmt.Fprintf(&sb, "Client %s arrived", who)
+	case ClientDeparted:
+		fmt.Fprintf(&sb, "Client %s departed", who)
+	case AgentInstalled:
+		fmt.Fprintf(&sb, "Traffic-agent of %s.%s arrived", e.Workload, e.Namespace)
+	case InterceptCreated:
+		fmt.Fprintf(&sb, "%s created intercept %s with disposition %s", who, e.Intercept, e.Disposition)
+	case InterceptReviewed:
+		fmt.Fprintf(&sb, "Intercept %s of %s was reviewed with disposition %s", e.Intercept, who, e.Disposition)
+	case InterceptUpdated:
+		fmt.Fprintf(&sb, "Intercept %s of %s changed disposition from %s to %s", e.Intercept, who, e.PreviousDisposition, e.Disposition)
+	case InterceptRemoved:
+		fmt.Fprintf(&sb, "Intercept %s of %s was removed after %s", e.Intercept, who, e.Duration)
+	default:
+		sb.WriteString(string(e.Type))
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	}
+	return sb.String()
+}
+
+// A Sink receives the events of the audit log.
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+}
+
+// Logger turns the changes to the client sessions, agent sessions, and intercepts of the
+// traffic-manager into audit events, and writes them to its sinks.
+type Logger struct {
+	now   func() time.Time
+	sinks []Sink
+
+	// What's known from the snapshots that have been received so far
+	clients    map[string]*rpc.ClientInfo
+	agents     map[string]*rpc.AgentInfo
+	intercepts map[string]*rpc.InterceptInfo
+}
+
+// NewLogger returns a Logger that writes to the given sinks, using the given function to obtain
+// the time of the events.
+func NewLogger(now func() time.Time, sinks ...Sink) *Logger {
+	return &Logger{now: now, sinks: sinks}
+}
+
+// Run writes the events that the given subscriptions give rise to, until the given context is
+// cancelled or one of the subscriptions ends. The state at the time of subscription is where the
+// audit log starts from, so it doesn't give rise to any events.
+func (l *Logger) Run(
+	ctx context.Context,
+	clients <-chan watchable.ClientMapSnapshot,
+	agents <-chan watchable.AgentMapSnapshot,
+	intercepts <-chan watchable.InterceptMapSnapshot,
+) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case snapshot, ok := <-clients:
+			if !ok {
+				return nil
+			}
+			l.clientsChanged(ctx, snapshot)
+		case snapshot, ok := <-agents:
+			if !ok {
+				return nil
+			}
+			l.agentsChanged(ctx, snapshot)
+		case snapshot, ok := <-intercepts:
+			if !ok {
+				return nil
+			}
+			l.interceptsChanged(ctx, snapshot)
+		}
+	}
+}
+
+// undoFirstUpdates calls undo with the index of each update of the first snapshot of a subscription,
+// the last one first. The first snapshot includes the updates that were made between the subscription
+// and the first read. They are undone to get the state at the time of the subscription, so that they're
+// written as events.
+func undoFirstUpdates(count int, undo func(i int)) {
+	for i := count - 1; i >= 0; i-- {
+		undo(i)
+	}
+}
+
+func (l *Logger) clientsChanged(ctx context.Context, snapshot watchable.ClientMapSnapshot) {
+	if l.clients == nil {
+		l.clients = make(map[string]*rpc.ClientInfo, len(snapshot.State))
+		for k, v := range snapshot.State {
+			l.clients[k] = v
+		}
+		undoFirstUpdates(len(snapshot.Updates), func(i int) {
+			switch update := snapshot.Updates[i]; {
+			case update.Delete:
+				l.clients[update.Key] = update.Value
+			case update.Previous != nil:
+				l.clients[update.Key] = update.Previous
+			default:
+				delete(l.clients, update.Key)
+			}
+		})
+	}
+	for _, update := range snapshot.Updates {
+		event := &Event{Session: update.Key, Client: update.Value.Name}
+		if ku := update.Value.KubernetesUser; ku != nil {
+			event.User = ku.Username
+		}
+		if update.Delete {
+			delete(l.clients, update.Key)
+			event.Type = ClientDeparted
+		} else {
+			_, known := l.clients[update.Key]
+			l.clients[update.Key] = update.Value
+			if known {
+				continue
+			}
+			event.Type = ClientArrived
+		}
+		l.write(ctx, event)
+	}
+}
+
+func (l *Logger) agentsChanged(ctx context.Context, snapshot watchable.AgentMapSnapshot) {
+	if l.agents == nil {
+		l.agents = make(map[string]*rpc.AgentInfo, len(snapshot.State))
+		for k, v := range snapshot.State {
+			l.agents[k] = v
+		}
+		undoFirstUpdates(len(snapshot.Updates), func(i int) {
+			switch update := snapshot.Updates[i]; {
+			case update.Delete:
+				l.agents[update.Key] = update.Value
+			case update.Previous != nil:
+				l.agents[update.Key] = update.Previous
+			default:
+				delete(l.agents, update.Key)
+			}
+		})
+	}
+	for _, update := range snapshot.Updates {
+		if update.Delete {
+			delete(l.agents, update.Key)
+			continue
+		}
+		if _, known := l.agents[update.Key]; known {
+			l.agents[update.Key] = update.Value
+			continue
+		}
+		// Only the first traffic-agent of a workload is of interest. The others are replicas.
+		installed := true
+		for _, agent := range l.agents {
+			if agent.Name == update.Value.Name && agent.Namespace == update.Value.Namespace {
+				installed = false
+				break
+			}
+		}
+		l.agents[update.Key] = update.Value
+		if installed {
+			l.write(ctx, &Event{
+				Type:      AgentInstalled,
+				Session:   update.Key,
+				Workload:  update.Value.Name,
+				Namespace: update.Value.Namespace,
+			})
+		}
+	}
+}
+
+func (l *Logger) interceptsChanged(ctx context.Context, snapshot watchable.InterceptMapSnapshot) {
+	if l.intercepts == nil {
+		l.intercepts = make(map[string]*rpc.InterceptInfo, len(snapshot.State))
+		for k, v := range snapshot.State {
+			l.intercepts[k] = v
+		}
+		undoFirstUpdates(len(snapshot.Updates), func(i int) {
+			switch update := snapshot.Updates[i]; {
+			case update.Delete:
+				l.intercepts[update.Key] = update.Value
+			case update.Previous != nil:
+				l.intercepts[update.Key] = update.Previous
+			default:
+				delete(l.intercepts, update.Key)
+			}
+		})
+	}
+	for _, update := range snapshot.Updates {
+		cept := update.Value
+		old, known := l.intercepts[update.Key]
+		event := l.interceptEvent(cept)
+		switch {
+		case update.Delete:
+			delete(l.intercepts, update.Key)
+			event.Type = InterceptRemoved
+			if cept.Created != nil {
+				event.Duration = l.now().Sub(cept.Created.AsTime()).Round(time.Second).String()
+			}
+		case !known:
+			l.intercepts[update.Key] = cept
+			event.Type = InterceptCreated
+		default:
+			l.intercepts[update.Key] = cept
+			if old.Disposition == cept.Disposition {
+				continue
+			}
+			event.PreviousDisposition = old.Disposition.String()
+			if old.Disposition == rpc.InterceptDispositionType_WAITING {
+				event.Type = InterceptReviewed
+			} else {
+				event.Type = InterceptUpdated
+			}
+		}
+		l.write(ctx, event)
+	}
+}
+
+func (l *Logger) interceptEvent(cept *rpc.InterceptInfo) *Event {
+	spec := cept.Spec
+	event := &Event{
+		Session:       cept.ClientSession.GetSessionId(),
+		Client:        spec.Client,
+		Intercept:     spec.Name,
+		WorkloadKind:  spec.WorkloadKind,
+		Workload:      spec.Agent,
+		Namespace:     spec.Namespace,
+		Mechanism:     spec.Mechanism,
+		MechanismArgs: spec.MechanismArgs,
+		Disposition:   cept.Disposition.String(),
+		Message:       cept.Message,
+	}
+	if client, ok := l.clients[event.Session]; ok && client.KubernetesUser != nil {
+		event.User = client.KubernetesUser.Username
+	}
+	return event
+}
+
+func (l *Logger) write(ctx context.Context, event *Event) {
+	event.Time = l.now()
+	for _, sink := range l.sinks {
+		if err := sink.Write(ctx, event); err != nil {
+			dlog.Errorf(ctx, "unable to write audit event: %v", err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package audit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/audit"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+type chanSink chan *audit.Event
+
+func (s chanSink) Write(_ context.Context, event *audit.Event) error {
+	s <- event
+	return nil
+}
+
+// fakeClock is a clock that the test advances while the logger reads it.
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.Lock()
+	c.now = c.now.Add(d)
+	c.Unlock()
+}
+
+func TestLogger(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	testClients := testdata.GetTestClients(t)
+	testAgents := testdata.GetTestAgents(t)
+
+	clock := &fakeClock{now: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	now := clock.Now()
+
+	s := state.NewState(ctx)
+	events := make(chanSink, 10)
+	jsonLog := &bytes.Buffer{}
+	clientset := fake.NewSimpleClientset()
+	logger := audit.NewLogger(clock.Now, events, audit.NewJSONSink(jsonLog), audit.NewKubernetesSink(clientset, "traffic-manager"))
+	clients, agents, intercepts := s.WatchClients(ctx, nil), s.WatchAgents(ctx, nil), s.WatchIntercepts(ctx, nil)
+	done := make(chan error)
+	go func() { done <- logger.Run(ctx, clients, agents, intercepts) }()
+
+	next := func() *audit.Event {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for an audit event")
+			return nil
+		}
+	}
+
+	aliceID := s.AddClient(testClients["alice"], now)
+	event := next()
+	assert.Equal(t, audit.ClientArrived, event.Type)
+	assert.Equal(t, aliceID, event.Session)
+	assert.Equal(t, "alice@squirtle.bigcorp.com", event.Client)
+
+	// Only the first traffic-agent of a workload is installed
+	s.AddAgent(testAgents["demo1"], now)
+	event = next()
+	assert.Equal(t, audit.AgentInstalled, event.Type)
+	assert.Equal(t, "demo", event.Workload)
+	s.AddAgent(testAgents["demo2"], now)
+	s.AddAgent(testAgents["helloPro"], now)
+	event = next()
+	assert.Equal(t, audit.AgentInstalled, event.Type)
+	assert.Equal(t, "hello-pro", event.Workload)
+
+	cept, err := s.AddIntercept(aliceID, "", &rpc.InterceptSpec{
+		Name:          "hello",
+		Client:        testClients["alice"].Name,
+		Agent:         "hello-pro",
+		Namespace:     "default",
+		Mechanism:     "http",
+		MechanismArgs: []string{"--http-match=auto"},
+	}, now)
+	require.NoError(t, err)
+	event = next()
+	assert.Equal(t, audit.InterceptCreated, event.Type)
+	assert.Equal(t, "hello", event.Intercept)
+	assert.Equal(t, "default", event.Namespace)
+	assert.Equal(t, []string{"--http-match=auto"}, event.MechanismArgs)
+	assert.Equal(t, rpc.InterceptDispositionType_WAITING.String(), event.Disposition)
+
+	clock.Add(time.Second)
+	s.UpdateIntercept(cept.Id, func(ii *rpc.InterceptInfo) {
+		ii.Disposition = rpc.InterceptDispositionType_ACTIVE
+		ii.Message = ""
+	})
+	event = next()
+	assert.Equal(t, audit.InterceptReviewed, event.Type)
+	assert.Equal(t, rpc.InterceptDispositionType_WAITING.String(), event.PreviousDisposition)
+	assert.Equal(t, rpc.InterceptDispositionType_ACTIVE.String(), event.Disposition)
+
+	clock.Add(90*time.Minute - time.Second)
+	s.RemoveIntercept(cept.Id)
+	event = next()
+	assert.Equal(t, audit.InterceptRemoved, event.Type)
+	assert.Equal(t, "1h30m0s", event.Duration)
+	assert.Equal(t, "Intercept hello of alice@squirtle.bigcorp.com was removed after 1h30m0s", event.Describe())
+
+	s.RemoveSession(ctx, aliceID)
+	event = next()
+	assert.Equal(t, audit.ClientDeparted, event.Type)
+	assert.Equal(t, aliceID, event.Session)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	// The JSON log contains one line per event
+	dec := json.NewDecoder(jsonLog)
+	var types []audit.EventType
+	for dec.More() {
+		var e audit.Event
+		require.NoError(t, dec.Decode(&e))
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []audit.EventType{
+		audit.ClientArrived,
+		audit.AgentInstalled,
+		audit.AgentInstalled,
+		audit.InterceptCreated,
+		audit.InterceptReviewed,
+		audit.InterceptRemoved,
+		audit.ClientDeparted,
+	}, types)
+
+	// Only the events of intercepts are recorded as Kubernetes Events of the workload
+	kes, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var reasons []string
+	for _, ke := range kes.Items {
+		assert.Equal(t, corev1.ObjectReference{Kind: "Deployment", APIVersion: "apps/v1", Name: "hello-pro", Namespace: "default"}, ke.InvolvedObject)
+		reasons = append(reasons, ke.Reason)
+	}
+	assert.ElementsMatch(t, []string{"InterceptCreated", "InterceptReviewed", "InterceptRemoved"}, reasons)
+}
+
+func TestLogger_ChangesBeforeFirstRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	testClients := testdata.GetTestClients(t)
+	testAgents := testdata.GetTestAgents(t)
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// Bob and his intercept arrive before the subscription, so no events are written for them
+	s := state.NewState(ctx)
+	bobID := s.AddClient(testClients["bob"], now)
+	bobCept, err := s.AddIntercept(bobID, "", &rpc.InterceptSpec{
+		Name:      "bobs-hello",
+		Client:    testClients["bob"].Name,
+		Agent:     "hello-pro",
+		Namespace: "default",
+		Mechanism: "tcp",
+	}, now)
+	require.NoError(t, err)
+	clients, agents, intercepts := s.WatchClients(ctx, nil), s.WatchAgents(ctx, nil), s.WatchIntercepts(ctx, nil)
+
+	// The changes that are made before the logger reads the first snapshot are written as events
+	aliceID := s.AddClient(testClients["alice"], now)
+	agentID := s.AddAgent(testAgents["helloPro"], now)
+	// A change to an intercept that existed before the subscription isn't mistaken for its creation
+	s.UpdateIntercept(bobCept.Id, func(ii *rpc.InterceptInfo) {
+		ii.Disposition = rpc.InterceptDispositionType_ACTIVE
+	})
+	_, err = s.AddIntercept(aliceID, "", &rpc.InterceptSpec{
+		Name:      "hello",
+		Client:    testClients["alice"].Name,
+		Agent:     "hello-pro",
+		Namespace: "default",
+		Mechanism: "tcp",
+	}, now)
+	require.NoError(t, err)
+	s.RemoveSession(ctx, bobID)
+
+	events := make(chanSink, 10)
+	logger := audit.NewLogger(func() time.Time { return now }, events)
+	done := make(chan error)
+	go func() { done <- logger.Run(ctx, clients, agents, intercepts) }()
+
+	var received []*audit.Event
+	for len(received) < 7 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for an audit event, got %d", len(received))
+		}
+	}
+	cancel()
+	require.NoError(t, <-done)
+	assert.Empty(t, events)
+
+	// The events of the clients, agents, and intercepts are interleaved in no particular order
+	type eventKey struct {
+		Type      audit.EventType
+		Session   string
+		Intercept string
+	}
+	keys := make([]eventKey, len(received))
+	for i, event := range received {
+		keys[i] = eventKey{Type: event.Type, Session: event.Session, Intercept: event.Intercept}
+	}
+	assert.ElementsMatch(t, []eventKey{
+		{Type: audit.ClientArrived, Session: aliceID},
+		{Type: audit.AgentInstalled, Session: agentID},
+		{Type: audit.InterceptUpdated, Session: bobID, Intercept: "bobs-hello"},
+		{Type: audit.InterceptReviewed, Session: bobID, Intercept: "bobs-hello"},
+		{Type: audit.InterceptCreated, Session: aliceID, Intercept: "hello"},
+		{Type: audit.InterceptRemoved, Session: bobID, Intercept: "bobs-hello"},
+		{Type: audit.ClientDeparted, Session: bobID},
+	}, keys)
+}
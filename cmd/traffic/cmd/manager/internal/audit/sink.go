@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type jsonSink struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSink returns a Sink that writes each event as a line of JSON to the given writer.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonSink) Write(_ context.Context, event *Event) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.enc.Encode(event)
+}
+
+type kubernetesSink struct {
+	clientset kubernetes.Interface
+	component string
+}
+
+// NewKubernetesSink returns a Sink that records the events that concern intercepts as Kubernetes
+// Events of the intercepted workloads. Other events are ignored.
+func NewKubernetesSink(clientset kubernetes.Interface, component string) Sink {
+	return &kubernetesSink{clientset: clientset, component: component}
+}
+
+func (s *kubernetesSink) Write(ctx context.Context, event *Event) error {
+	if !strings.HasPrefix(string(event.Type), "intercept-") {
+		return nil
+	}
+	kind, apiVersion := workloadKind(event.WorkloadKind)
+	ts := metav1.NewTime(event.Time)
+	ke := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// Named like the events of the client-go event recorder
+			Name:      fmt.Sprintf("%s.%x", event.Workload, event.Time.UnixNano()),
+			Namespace: event.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       kind,
+			APIVersion: apiVersion,
+			Name:       event.Workload,
+			Namespace:  event.Namespace,
+		},
+		Reason:         reason(event.Type),
+		Message:        event.Describe(),
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: s.component},
+		FirstTimestamp: ts,
+		LastTimestamp:  ts,
+		Count:          1,
+	}
+	_, err := s.clientset.CoreV1().Events(event.Namespace).Create(ctx, ke, metav1.CreateOptions{})
+	return err
+}
+
+// reason returns the CamelCase form of the given event type, e.g. "InterceptCreated" for
+// "intercept-created".
+func reason(t EventType) string {
+	parts := strings.Split(string(t), "-")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// workloadKind returns the kind and API version of the workload with the given kind, as reported
+// by the client.
+func workloadKind(kind string) (string, string) {
+	switch kind {
+	case "ReplicaSet", "StatefulSet", "DaemonSet":
+		return kind, "apps/v1"
+	case "Rollout":
+		return kind, "argoproj.io/v1alpha1"
+	case "Pod":
+		return kind, "v1"
+	default:
+		// Clients that don't report the kind of workload only intercept deployments
+		return "Deployment", "apps/v1"
+	}
+}
@@ -39,6 +39,10 @@ type Info interface {
 	// GetTrafficAgentPods acquires all pods that have a `traffic-agent`
 	// container in their spec
 	GetTrafficAgentPods(context.Context, string) ([]*corev1.Pod, error)
+
+	// LookupAddr returns the fully qualified name of the pod or service that uses the given IP, or
+	// an empty string if no such pod or service is known.
+	LookupAddr(net.IP) string
 }
 
 type subnetRetriever interface {
@@ -53,6 +57,9 @@ type info struct {
 
 	// clusterID is the UID of the default namespace
 	clusterID string
+
+	// reverse is the index used by LookupAddr
+	reverse *reverseWatcher
 }
 
 func NewInfo(ctx context.Context) Info {
@@ -126,6 +133,9 @@ func NewInfo(ctx context.Context) Info {
 	}
 	dlog.Infof(ctx, "Using cluster domain %q", oi.ClusterDomain)
 
+	oi.reverse = newReverseWatcher(oi.ClusterDomain)
+	go oi.reverse.run(ctx, strings.Fields(managerutil.GetEnv(ctx).ManagedNamespaces))
+
 	// make an attempt to create a service with ClusterIP that is out of range and then
 	// check the error message for the correct range as suggested tin the second answer here:
 	//   https://stackoverflow.com/questions/44190607/how-do-you-find-the-cluster-service-cidr-of-a-kubernetes-cluster
@@ -290,6 +300,10 @@ func (oi *info) GetClusterID() string {
 	return oi.clusterID
 }
 
+func (oi *info) LookupAddr(ip net.IP) string {
+	return oi.reverse.lookup(ip)
+}
+
 // clusterInfo must be called with accLock locked
 func (oi *info) clusterInfo() *rpc.ClusterInfo {
 	ci := &rpc.ClusterInfo{
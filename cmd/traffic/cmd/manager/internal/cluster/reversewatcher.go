@@ -0,0 +1,256 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// reverseWatcher maintains an index of the names of the pods and services in the cluster, keyed
+// by their IPs. It's used when answering reverse (PTR) DNS queries.
+type reverseWatcher struct {
+	clusterDomain string
+	names         map[iputil.IPKey]string
+	lock          sync.RWMutex // Protects all access to names
+}
+
+func newReverseWatcher(clusterDomain string) *reverseWatcher {
+	return &reverseWatcher{
+		clusterDomain: clusterDomain,
+		names:         make(map[iputil.IPKey]string),
+	}
+}
+
+// run starts reflectors for the pods and services in the given namespaces, or in all namespaces when
+// none are given, and keeps the index up-to-date until the given context is cancelled. The reflectors
+// feed reverseStores rather than informer caches, so only the IPs and names of the objects are retained.
+func (w *reverseWatcher) run(ctx context.Context, namespaces []string) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	client := managerutil.GetK8sClientset(ctx).CoreV1()
+	var synced []cache.InformerSynced
+	for _, ns := range namespaces {
+		ns := ns
+		pods := newReverseStore(w, func(obj interface{}) ([]iputil.IPKey, string) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				return podIPKeys(ctx, pod), w.podName(pod)
+			}
+			return nil, ""
+		})
+		svcs := newReverseStore(w, func(obj interface{}) ([]iputil.IPKey, string) {
+			if svc, ok := obj.(*corev1.Service); ok {
+				return serviceIPKeys(svc), w.serviceName(svc)
+			}
+			return nil, ""
+		})
+		podLW := &cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return client.Pods(ns).List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return client.Pods(ns).Watch(ctx, opts)
+			},
+		}
+		svcLW := &cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return client.Services(ns).List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return client.Services(ns).Watch(ctx, opts)
+			},
+		}
+		go cache.NewReflector(podLW, &corev1.Pod{}, pods, 0).Run(ctx.Done())
+		go cache.NewReflector(svcLW, &corev1.Service{}, svcs, 0).Run(ctx.Done())
+		synced = append(synced, pods.hasSynced, svcs.hasSynced)
+	}
+
+	if cache.WaitForCacheSync(ctx.Done(), synced...) {
+		w.lock.RLock()
+		dlog.Infof(ctx, "Reverse DNS index initialized with %d IPs", len(w.names))
+		w.lock.RUnlock()
+	}
+	<-ctx.Done()
+}
+
+// lookup returns the fully qualified name of the pod or service that uses the given IP, or an
+// empty string if no such pod or service is known.
+func (w *reverseWatcher) lookup(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.names[iputil.IPKey(ip)]
+}
+
+// podName returns the name of the given pod. That's the DNS name given by its hostname and subdomain
+// when both are set, and "<name>.<namespace>.pod.<cluster domain>" otherwise. Pods that use the host
+// network don't have IPs of their own and are therefore not named.
+func (w *reverseWatcher) podName(pod *corev1.Pod) string {
+	if pod.Spec.HostNetwork {
+		return ""
+	}
+	if pod.Spec.Hostname != "" && pod.Spec.Subdomain != "" {
+		return pod.Spec.Hostname + "." + pod.Spec.Subdomain + "." + pod.Namespace + ".svc." + w.clusterDomain
+	}
+	return pod.Name + "." + pod.Namespace + ".pod." + w.clusterDomain
+}
+
+// serviceName returns the DNS name of the given service.
+func (w *reverseWatcher) serviceName(svc *corev1.Service) string {
+	return svc.Name + "." + svc.Namespace + ".svc." + w.clusterDomain
+}
+
+func (w *reverseWatcher) add(ips []iputil.IPKey, name string) {
+	if name == "" {
+		return
+	}
+	w.lock.Lock()
+	for _, ip := range ips {
+		w.names[ip] = name
+	}
+	w.lock.Unlock()
+}
+
+// drop removes the given IPs from the index unless they have been reassigned to another name.
+func (w *reverseWatcher) drop(ips []iputil.IPKey, name string) {
+	w.lock.Lock()
+	for _, ip := range ips {
+		if w.names[ip] == name {
+			delete(w.names, ip)
+		}
+	}
+	w.lock.Unlock()
+}
+
+func serviceIPKeys(svc *corev1.Service) []iputil.IPKey {
+	clusterIPs := svc.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && svc.Spec.ClusterIP != "" {
+		clusterIPs = []string{svc.Spec.ClusterIP}
+	}
+	ips := make([]iputil.IPKey, 0, len(clusterIPs))
+	for _, s := range clusterIPs {
+		// Headless services have the ClusterIP "None", which doesn't parse.
+		if ip := iputil.Parse(s); ip != nil {
+			ips = append(ips, iputil.IPKey(ip))
+		}
+	}
+	return ips
+}
+
+// reverseEntry is what a reverseStore retains of a pod or service.
+type reverseEntry struct {
+	ips  []iputil.IPKey
+	name string
+}
+
+// reverseStore is a cache.Store that keeps the reverseWatcher's index up-to-date with the objects
+// that a reflector lists and watches. It retains the IPs and name of each object instead of the
+// object itself, which is enough to remove the object from the index when it changes or is deleted.
+type reverseStore struct {
+	w       *reverseWatcher
+	extract func(obj interface{}) ([]iputil.IPKey, string)
+	entries map[string]reverseEntry
+	synced  bool
+	lock    sync.Mutex // Protects all access to entries and synced
+}
+
+func newReverseStore(w *reverseWatcher, extract func(obj interface{}) ([]iputil.IPKey, string)) *reverseStore {
+	return &reverseStore{
+		w:       w,
+		extract: extract,
+		entries: make(map[string]reverseEntry),
+	}
+}
+
+func (s *reverseStore) hasSynced() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.synced
+}
+
+func (s *reverseStore) Add(obj interface{}) error {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return err
+	}
+	ips, name := s.extract(obj)
+	s.lock.Lock()
+	s.unlockedSet(key, reverseEntry{ips: ips, name: name})
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *reverseStore) Update(obj interface{}) error {
+	return s.Add(obj)
+}
+
+func (s *reverseStore) Delete(obj interface{}) error {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.unlockedDelete(key)
+	s.lock.Unlock()
+	return nil
+}
+
+// Replace is called by the reflector with the full list of objects each time it lists them.
+func (s *reverseStore) Replace(objs []interface{}, _ string) error {
+	entries := make(map[string]reverseEntry, len(objs))
+	for _, obj := range objs {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return err
+		}
+		ips, name := s.extract(obj)
+		entries[key] = reverseEntry{ips: ips, name: name}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key := range s.entries {
+		if _, ok := entries[key]; !ok {
+			s.unlockedDelete(key)
+		}
+	}
+	for key, entry := range entries {
+		s.unlockedSet(key, entry)
+	}
+	s.synced = true
+	return nil
+}
+
+func (s *reverseStore) unlockedSet(key string, entry reverseEntry) {
+	if old, ok := s.entries[key]; ok {
+		s.w.drop(old.ips, old.name)
+	}
+	s.entries[key] = entry
+	s.w.add(entry.ips, entry.name)
+}
+
+func (s *reverseStore) unlockedDelete(key string) {
+	if old, ok := s.entries[key]; ok {
+		delete(s.entries, key)
+		s.w.drop(old.ips, old.name)
+	}
+}
+
+// The reflector doesn't read from its store, so there's nothing to list or get.
+
+func (s *reverseStore) List() []interface{}                        { return nil }
+func (s *reverseStore) ListKeys() []string                         { return nil }
+func (s *reverseStore) Get(interface{}) (interface{}, bool, error) { return nil, false, nil }
+func (s *reverseStore) GetByKey(string) (interface{}, bool, error) { return nil, false, nil }
+func (s *reverseStore) Resync() error                              { return nil }
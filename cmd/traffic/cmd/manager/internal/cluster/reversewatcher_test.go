@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+func Test_reverseWatcher(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	w := newReverseWatcher("cluster.local.")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo-5f8d7c", Namespace: "default"},
+		Status:     corev1.PodStatus{PodIP: "192.168.0.1"},
+	}
+	w.add(podIPKeys(ctx, pod), w.podName(pod))
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10"},
+	}
+	w.add(serviceIPKeys(svc), w.serviceName(svc))
+
+	headless := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "headless", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "None"},
+	}
+	assert.Empty(t, serviceIPKeys(headless))
+
+	assert.Equal(t, "echo-5f8d7c.default.pod.cluster.local.", w.lookup(net.ParseIP("192.168.0.1")))
+	assert.Equal(t, "echo.default.svc.cluster.local.", w.lookup(net.ParseIP("10.96.0.10")))
+	assert.Equal(t, "", w.lookup(net.ParseIP("10.96.0.11")))
+
+	// The IP of a deleted pod is reused by a new pod before the deletion is seen.
+	stateful := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{Hostname: "db-0", Subdomain: "db"},
+		Status:     corev1.PodStatus{PodIP: "192.168.0.1"},
+	}
+	w.add(podIPKeys(ctx, stateful), w.podName(stateful))
+	w.drop(podIPKeys(ctx, pod), w.podName(pod))
+	assert.Equal(t, "db-0.db.default.svc.cluster.local.", w.lookup(net.ParseIP("192.168.0.1")))
+
+	w.drop(podIPKeys(ctx, stateful), w.podName(stateful))
+	assert.Equal(t, "", w.lookup(net.ParseIP("192.168.0.1")))
+}
+
+func Test_reverseStore(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	w := newReverseWatcher("cluster.local.")
+	s := newReverseStore(w, func(obj interface{}) ([]iputil.IPKey, string) {
+		pod := obj.(*corev1.Pod)
+		return podIPKeys(ctx, pod), w.podName(pod)
+	})
+	newPod := func(name, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Status:     corev1.PodStatus{PodIP: ip},
+		}
+	}
+
+	assert.False(t, s.hasSynced())
+	assert.NoError(t, s.Replace([]interface{}{newPod("a", "192.168.0.1"), newPod("b", "192.168.0.2")}, "1"))
+	assert.True(t, s.hasSynced())
+	assert.Equal(t, "a.default.pod.cluster.local.", w.lookup(net.ParseIP("192.168.0.1")))
+	assert.Equal(t, "b.default.pod.cluster.local.", w.lookup(net.ParseIP("192.168.0.2")))
+
+	// An update drops the IP that the pod used before
+	assert.NoError(t, s.Update(newPod("a", "192.168.0.3")))
+	assert.Equal(t, "", w.lookup(net.ParseIP("192.168.0.1")))
+	assert.Equal(t, "a.default.pod.cluster.local.", w.lookup(net.ParseIP("192.168.0.3")))
+
+	// A deletion that the reflector missed is seen as a deleted final state
+	assert.NoError(t, s.Delete(cache.DeletedFinalStateUnknown{Key: "default/b", Obj: newPod("b", "192.168.0.2")}))
+	assert.Equal(t, "", w.lookup(net.ParseIP("192.168.0.2")))
+
+	// A relist drops the pods that are gone
+	assert.NoError(t, s.Replace([]interface{}{newPod("c", "192.168.0.4")}, "2"))
+	assert.Equal(t, "", w.lookup(net.ParseIP("192.168.0.3")))
+	assert.Equal(t, "c.default.pod.cluster.local.", w.lookup(net.ParseIP("192.168.0.4")))
+}
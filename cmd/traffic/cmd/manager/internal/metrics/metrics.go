@@ -0,0 +1,207 @@
+// Package metrics contains the Prometheus metrics of the traffic-manager.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/metrics"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+const subsystem = "manager"
+
+// Values of the direction label of TunnelBytes
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// Values of the tunnel label of TunnelBytes
+const (
+	TunnelClient = "client"
+	TunnelAgent  = "agent"
+	TunnelStream = "stream"
+)
+
+// Values of the resolver label of LookupHostDuration and LookupDNSDuration
+const (
+	ResolverIndex   = "index"
+	ResolverAgents  = "agents"
+	ResolverManager = "manager"
+)
+
+// queryTypes are the DNS query types that are reported by name in the type label of
+// LookupDNSDuration. Other types are reported as "other", so that clients can't create an unbounded
+// number of series.
+var queryTypes = map[uint16]struct{}{
+	dns.TypeA:     {},
+	dns.TypeAAAA:  {},
+	dns.TypeCNAME: {},
+	dns.TypeMX:    {},
+	dns.TypeNS:    {},
+	dns.TypePTR:   {},
+	dns.TypeSRV:   {},
+	dns.TypeTXT:   {},
+}
+
+// Values of the result label of WebhookAdmissions
+const (
+	AdmissionPatched   = "patched"
+	AdmissionUnchanged = "unchanged"
+	AdmissionDenied    = "denied"
+)
+
+var (
+	// TunnelStreams is the number of streams that are currently open through the Tunnel call.
+	TunnelStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "tunnel_streams_open",
+		Help:      "Number of tunnel streams that are currently open.",
+	})
+
+	// TunnelBytes is the number of payload bytes that have passed through the Tunnel call, and the
+	// ClientTunnel and AgentTunnel calls used by older clients and traffic-agents.
+	TunnelBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "tunnel_bytes_total",
+		Help:      "Number of payload bytes sent and received through the Tunnel, ClientTunnel, and AgentTunnel calls.",
+	}, []string{"tunnel", "direction"})
+
+	// LookupHostDuration is the latency of the LookupHost call, partitioned by the resolver that
+	// produced the answer.
+	LookupHostDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "lookup_host_duration_seconds",
+		Help:      "Latency of the LookupHost call.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"resolver"})
+
+	// LookupDNSDuration is the latency of the LookupDNS call, partitioned by the resolver that
+	// produced the answer and the query type.
+	LookupDNSDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "lookup_dns_duration_seconds",
+		Help:      "Latency of the LookupDNS call.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"resolver", "type"})
+
+	// WebhookAdmissions is the number of admission reviews that the agent injector has responded to.
+	WebhookAdmissions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "webhook_admissions_total",
+		Help:      "Number of admission reviews that the agent injector webhook has responded to.",
+	}, []string{"result"})
+
+	// WebhookErrors is the number of requests to the agent injector that couldn't be handled.
+	WebhookErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: subsystem,
+		Name:      "webhook_errors_total",
+		Help:      "Number of requests that the agent injector webhook failed to handle.",
+	})
+)
+
+var (
+	sessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, subsystem, "sessions"),
+		"Number of sessions by type.",
+		[]string{"type"}, nil)
+
+	interceptsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, subsystem, "intercepts"),
+		"Number of intercepts by disposition.",
+		[]string{"disposition"}, nil)
+
+	tunnelConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.Namespace, subsystem, "tunnel_connections"),
+		"Number of connections that are currently multiplexed over client tunnels.",
+		nil, nil)
+)
+
+// stateCollector collects the sessions, intercepts, and tunnel connections of the state when
+// the metrics are scraped.
+type stateCollector struct {
+	state *state.State
+}
+
+func (c stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionsDesc
+	ch <- interceptsDesc
+	ch <- tunnelConnectionsDesc
+}
+
+func (c stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(len(c.state.GetAllClients())), "client")
+	ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(len(c.state.GetAllAgents())), "agent")
+
+	// Report all dispositions, so that a disposition that no intercept has is reported as zero
+	// rather than being absent.
+	counts := make(map[rpc.InterceptDispositionType]int, len(rpc.InterceptDispositionType_name))
+	for _, ii := range c.state.GetAllIntercepts() {
+		counts[ii.Disposition]++
+	}
+	for v, name := range rpc.InterceptDispositionType_name {
+		if v == int32(rpc.InterceptDispositionType_UNSPECIFIED) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(interceptsDesc, prometheus.GaugeValue, float64(counts[rpc.InterceptDispositionType(v)]), name)
+	}
+
+	ch <- prometheus.MustNewConstMetric(tunnelConnectionsDesc, prometheus.GaugeValue, float64(c.state.TunnelConnections()))
+}
+
+// CountingTunnel returns a stream that adds the payload bytes that pass through the given stream
+// to the TunnelBytes of the given tunnel.
+func CountingTunnel(tunnel string, stream connpool.BidiStream) connpool.BidiStream {
+	return metrics.CountingStream(stream,
+		TunnelBytes.WithLabelValues(tunnel, DirectionSent),
+		TunnelBytes.WithLabelValues(tunnel, DirectionReceived))
+}
+
+// CountingTunnelStream returns a stream that adds the payload bytes that pass through the given
+// stream to the TunnelBytes of the Tunnel call.
+func CountingTunnelStream(stream tunnel.Stream) tunnel.Stream {
+	return metrics.CountingTunnelStream(stream,
+		TunnelBytes.WithLabelValues(TunnelStream, DirectionSent),
+		TunnelBytes.WithLabelValues(TunnelStream, DirectionReceived))
+}
+
+// QueryType returns the value of the type label of LookupDNSDuration for the given DNS query type.
+func QueryType(qType uint32) string {
+	if _, ok := queryTypes[uint16(qType)]; ok {
+		return dns.TypeToString[uint16(qType)]
+	}
+	return "other"
+}
+
+// Handler returns a http.Handler that serves the metrics of the traffic-manager, using the given
+// state.
+func Handler(s *state.State) http.Handler {
+	reg := metrics.NewRegistry()
+	Register(reg, s)
+	return metrics.Handler(reg)
+}
+
+// Register registers the metrics of the traffic-manager with the given registerer.
+func Register(reg prometheus.Registerer, s *state.State) {
+	reg.MustRegister(
+		stateCollector{state: s},
+		TunnelStreams,
+		TunnelBytes,
+		LookupHostDuration,
+		LookupDNSDuration,
+		WebhookAdmissions,
+		WebhookErrors,
+	)
+}
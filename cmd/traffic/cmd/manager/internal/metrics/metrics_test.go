@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+func TestStateCollector(t *testing.T) {
+	s := state.NewState(context.Background())
+	now := time.Now()
+	c1 := s.AddClient(&rpc.ClientInfo{Name: "c1"}, now)
+	s.AddClient(&rpc.ClientInfo{Name: "c2"}, now)
+	s.AddAgent(&rpc.AgentInfo{Name: "echo", Namespace: "default"}, now)
+
+	ii, err := s.AddIntercept(c1, "", &rpc.InterceptSpec{Name: "i1", Agent: "other", Namespace: "default"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, rpc.InterceptDispositionType_NO_AGENT, ii.Disposition)
+	ii, err = s.AddIntercept(c1, "", &rpc.InterceptSpec{Name: "i2", Agent: "echo", Namespace: "default"}, now)
+	require.NoError(t, err)
+	s.UpdateIntercept(ii.Id, func(ii *rpc.InterceptInfo) {
+		ii.Disposition = rpc.InterceptDispositionType_ACTIVE
+	})
+
+	expected := `
+# HELP telepresence_manager_sessions Number of sessions by type.
+# TYPE telepresence_manager_sessions gauge
+telepresence_manager_sessions{type="agent"} 1
+telepresence_manager_sessions{type="client"} 2
+# HELP telepresence_manager_tunnel_connections Number of connections that are currently multiplexed over client tunnels.
+# TYPE telepresence_manager_tunnel_connections gauge
+telepresence_manager_tunnel_connections 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(stateCollector{state: s}, strings.NewReader(expected),
+		"telepresence_manager_sessions", "telepresence_manager_tunnel_connections"))
+
+	// All dispositions are reported, including those that no intercept has.
+	assert.Equal(t, len(rpc.InterceptDispositionType_name)-1+3, testutil.CollectAndCount(stateCollector{state: s}))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(stateCollector{state: s}))
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	counts := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != "telepresence_manager_intercepts" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			counts[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, float64(1), counts["ACTIVE"])
+	assert.Equal(t, float64(1), counts["NO_AGENT"])
+	assert.Equal(t, float64(0), counts["UNHEALTHY"])
+	assert.NotContains(t, counts, "UNSPECIFIED")
+}
+
+// echoStream is a tunnel.Stream that receives the messages that are sent to it.
+type echoStream struct {
+	tunnel.Stream
+	msgs chan tunnel.Message
+}
+
+func (s *echoStream) Send(_ context.Context, msg tunnel.Message) error {
+	s.msgs <- msg
+	return nil
+}
+
+func (s *echoStream) Receive(context.Context) (tunnel.Message, error) {
+	return <-s.msgs, nil
+}
+
+func TestCountingTunnelStream(t *testing.T) {
+	ctx := context.Background()
+	sent := testutil.ToFloat64(TunnelBytes.WithLabelValues(TunnelStream, DirectionSent))
+	received := testutil.ToFloat64(TunnelBytes.WithLabelValues(TunnelStream, DirectionReceived))
+
+	s := CountingTunnelStream(&echoStream{msgs: make(chan tunnel.Message, 2)})
+	require.NoError(t, s.Send(ctx, tunnel.NewMessage(tunnel.Normal, []byte("hello"))))
+	require.NoError(t, s.Send(ctx, tunnel.NewMessage(tunnel.KeepAlive, nil)))
+	for i := 0; i < 2; i++ {
+		_, err := s.Receive(ctx)
+		require.NoError(t, err)
+	}
+
+	// Only the payload of data messages is counted
+	assert.Equal(t, sent+5, testutil.ToFloat64(TunnelBytes.WithLabelValues(TunnelStream, DirectionSent)))
+	assert.Equal(t, received+5, testutil.ToFloat64(TunnelBytes.WithLabelValues(TunnelStream, DirectionReceived)))
+}
+
+func TestQueryType(t *testing.T) {
+	assert.Equal(t, "A", QueryType(uint32(dns.TypeA)))
+	assert.Equal(t, "PTR", QueryType(uint32(dns.TypePTR)))
+	assert.Equal(t, "other", QueryType(uint32(dns.TypeHINFO)))
+	assert.Equal(t, "other", QueryType(4711))
+}
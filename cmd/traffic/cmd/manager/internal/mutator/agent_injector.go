@@ -81,57 +81,79 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 		return nil, err
 	}
 
-	// The ServicePortAnnotation is expected to contain a string that identifies the service port.
-	portNameOrNumber := pod.Annotations[install.ServicePortAnnotation]
-	servicePort, appContainer, containerPortIndex, err := install.FindMatchingPort(pod.Spec.Containers, portNameOrNumber, svc)
-	if err != nil {
-		err := fmt.Errorf("unable to find port to intercept; try the %s annotation: %w", install.ServicePortAnnotation, err)
-		dlog.Error(ctx, err)
-		return nil, err
-	}
-	if appContainer.Name == install.AgentContainerName {
-		dlog.Infof(ctx, "service %s/%s is already pointing at agent container %s; skipping", svc.Namespace, svc.Name, appContainer.Name)
-		return nil, nil
+	// The ServicePortAnnotation is expected to contain a string that identifies the service port, or a
+	// comma separated list of such strings when the agent should front several ports of the same container.
+	portNameOrNumbers := strings.Split(pod.Annotations[install.ServicePortAnnotation], ",")
+	var appContainer *corev1.Container
+	var takenOver []*takenOverPort
+	for _, portNameOrNumber := range portNameOrNumbers {
+		servicePort, container, containerPortIndex, err := install.FindMatchingPort(pod.Spec.Containers, portNameOrNumber, svc)
+		if err != nil {
+			err := fmt.Errorf("unable to find port to intercept; try the %s annotation: %w", install.ServicePortAnnotation, err)
+			dlog.Error(ctx, err)
+			return nil, err
+		}
+		if container.Name == install.AgentContainerName {
+			dlog.Infof(ctx, "service %s/%s is already pointing at agent container %s; skipping", svc.Namespace, svc.Name, container.Name)
+			return nil, nil
+		}
+		if appContainer == nil {
+			appContainer = container
+		} else if appContainer != container {
+			err := fmt.Errorf("the ports %q of service %s/%s are not all exposed by the same container", pod.Annotations[install.ServicePortAnnotation], svc.Namespace, svc.Name)
+			dlog.Error(ctx, err)
+			return nil, err
+		}
+
+		var appPort corev1.ContainerPort
+		switch {
+		case containerPortIndex >= 0:
+			appPort = appContainer.Ports[containerPortIndex]
+		case servicePort.TargetPort.Type == intstr.Int:
+			appPort = corev1.ContainerPort{
+				Protocol:      servicePort.Protocol,
+				ContainerPort: servicePort.TargetPort.IntVal,
+			}
+		default:
+			// This really shouldn't have happened: the target port is a string, but we weren't able to
+			// find a corresponding container port. This should've been caught in FindMatchingPort, but in
+			// case it isn't, just return an error.
+			return nil, fmt.Errorf("container port unexpectedly not found in %s", refPodName)
+		}
+		takenOver = append(takenOver, &takenOverPort{svcPort: servicePort, appPort: appPort})
 	}
 
 	env := managerutil.GetEnv(ctx)
 	ports := appContainer.Ports
 	for i := range ports {
-		if ports[i].ContainerPort == env.AgentPort {
-			err := fmt.Errorf("the %s pod container %s is exposing the same port (%d) as the %s sidecar", refPodName, appContainer.Name, env.AgentPort, install.AgentContainerName)
-			dlog.Info(ctx, err)
-			return nil, err
-		}
-	}
-
-	var appPort corev1.ContainerPort
-	switch {
-	case containerPortIndex >= 0:
-		appPort = appContainer.Ports[containerPortIndex]
-	case servicePort.TargetPort.Type == intstr.Int:
-		appPort = corev1.ContainerPort{
-			Protocol:      servicePort.Protocol,
-			ContainerPort: servicePort.TargetPort.IntVal,
+		for ai := range takenOver {
+			agentPort := env.AgentPort + int32(ai)
+			if ports[i].ContainerPort == agentPort {
+				err := fmt.Errorf("the %s pod container %s is exposing the same port (%d) as the %s sidecar", refPodName, appContainer.Name, agentPort, install.AgentContainerName)
+				dlog.Info(ctx, err)
+				return nil, err
+			}
 		}
-	default:
-		// This really shouldn't have happened: the target port is a string, but we weren't able to
-		// find a corresponding container port. This should've been caught in FindMatchingPort, but in
-		// case it isn't, just return an error.
-		return nil, fmt.Errorf("container port unexpectedly not found in %s", refPodName)
 	}
 
 	// Create patch operations to add the traffic-agent sidecar
 	dlog.Infof(ctx, "Injecting %s into pod %s", install.AgentContainerName, refPodName)
 
 	var patches []patchOperation
+	var redirected []int
+	for i, tp := range takenOver {
+		if tp.svcPort.TargetPort.Type == intstr.Int || svc.Spec.ClusterIP == "None" {
+			redirected = append(redirected, i)
+		} else {
+			patches = hidePorts(&pod, appContainer, tp.svcPort.TargetPort.StrVal, i, patches)
+		}
+	}
 	setGID := false
-	if servicePort.TargetPort.Type == intstr.Int || svc.Spec.ClusterIP == "None" {
-		patches = addInitContainer(ctx, &pod, servicePort, &appPort, patches)
+	if len(redirected) > 0 {
+		patches = addInitContainer(ctx, &pod, takenOver, redirected, patches)
 		setGID = true
-	} else {
-		patches = hidePorts(&pod, appContainer, servicePort.TargetPort.StrVal, patches)
 	}
-	patches, err = addAgentContainer(ctx, svc, &pod, servicePort, appContainer, &appPort, setGID, podName, podNamespace, patches)
+	patches, err = addAgentContainer(ctx, svc, &pod, takenOver, appContainer, setGID, podName, podNamespace, patches)
 	if err != nil {
 		return nil, err
 	}
@@ -139,20 +161,40 @@ func agentInjector(ctx context.Context, req *admission.AdmissionRequest) ([]patc
 	return patches, nil
 }
 
-func addInitContainer(ctx context.Context, pod *corev1.Pod, svcPort *corev1.ServicePort, appPort *corev1.ContainerPort, patches []patchOperation) []patchOperation {
-	env := managerutil.GetEnv(ctx)
-	proto := svcPort.Protocol
+// takenOverPort is a service port that the traffic-agent will front, and the container port that
+// the agent forwards to.
+type takenOverPort struct {
+	svcPort *corev1.ServicePort
+	appPort corev1.ContainerPort
+}
+
+// agentPort returns the port that the traffic-agent will use for the port at the given index.
+func (tp *takenOverPort) agentPort(ctx context.Context, index int) corev1.ContainerPort {
+	proto := tp.svcPort.Protocol
 	if proto == "" {
-		proto = appPort.Protocol
+		proto = tp.appPort.Protocol
 	}
-	containerPort := corev1.ContainerPort{
+	return corev1.ContainerPort{
 		Protocol:      proto,
-		ContainerPort: env.AgentPort,
+		ContainerPort: managerutil.GetEnv(ctx).AgentPort + int32(index),
+	}
+}
+
+// addInitContainer creates a patch operation that adds an init container which redirects the ports
+// at the given indexes of the takenOver ports to the traffic-agent.
+func addInitContainer(ctx context.Context, pod *corev1.Pod, takenOver []*takenOverPort, indexes []int, patches []patchOperation) []patchOperation {
+	env := managerutil.GetEnv(ctx)
+	first := takenOver[indexes[0]]
+	var extraPorts []install.PortMapping
+	for _, i := range indexes[1:] {
+		tp := takenOver[i]
+		extraPorts = append(extraPorts, install.PortMapping{AgentPort: tp.agentPort(ctx, i), AppPort: int(tp.appPort.ContainerPort)})
 	}
 	container := install.InitContainer(
 		env.AgentRegistry+"/"+env.AgentImage,
-		containerPort,
-		int(appPort.ContainerPort),
+		first.agentPort(ctx, indexes[0]),
+		int(first.appPort.ContainerPort),
+		extraPorts,
 	)
 
 	if pod.Spec.InitContainers == nil {
@@ -201,9 +243,8 @@ func addAgentContainer(
 	ctx context.Context,
 	svc *corev1.Service,
 	pod *corev1.Pod,
-	svcPort *corev1.ServicePort,
+	takenOver []*takenOverPort,
 	appContainer *corev1.Container,
-	appPort *corev1.ContainerPort,
 	setGID bool,
 	podName, namespace string,
 	patches []patchOperation,
@@ -218,26 +259,29 @@ func addAgentContainer(
 		}
 	}
 
-	dlog.Debugf(ctx, "using service %q port %q when intercepting %s",
-		svc.Name,
-		func() string {
-			if svcPort.Name != "" {
-				return svcPort.Name
-			}
-			return strconv.Itoa(int(svcPort.Port))
-		}(), refPodName)
+	for _, tp := range takenOver {
+		svcPort := tp.svcPort
+		dlog.Debugf(ctx, "using service %q port %q when intercepting %s",
+			svc.Name,
+			func() string {
+				if svcPort.Name != "" {
+					return svcPort.Name
+				}
+				return strconv.Itoa(int(svcPort.Port))
+			}(), refPodName)
+	}
 
 	agentName := ""
 	if pod.OwnerReferences != nil {
 	owners:
 		for _, owner := range pod.OwnerReferences {
 			switch owner.Kind {
-			case "StatefulSet":
-				// If the pod is owned by a statefulset, the workload's name is the same as the statefulset's
+			case "StatefulSet", "DaemonSet":
+				// If the pod is owned by a statefulset or a daemonset, the workload's name is the same as the owner's
 				agentName = owner.Name
 				break owners
 			case "ReplicaSet":
-				// If it's owned by a replicaset, then it's the same as the deployment e.g. "my-echo-697464c6c5" -> "my-echo"
+				// If it's owned by a replicaset, then it's the same as the deployment or the Argo Rollout e.g. "my-echo-697464c6c5" -> "my-echo"
 				tokens := strings.Split(owner.Name, "-")
 				agentName = strings.Join(tokens[:len(tokens)-1], "-")
 				break owners
@@ -254,36 +298,51 @@ func addAgentContainer(
 		}
 	}
 
-	proto := svcPort.Protocol
-	if proto == "" {
-		proto = appPort.Protocol
+	// A symbolic target port is taken over by the agent, so its container port must use the same name.
+	agentPort := func(i int) corev1.ContainerPort {
+		tp := takenOver[i]
+		containerPort := tp.agentPort(ctx, i)
+		if tp.svcPort.TargetPort.Type == intstr.String {
+			containerPort.Name = tp.svcPort.TargetPort.StrVal
+		}
+		return containerPort
 	}
-	containerPort := corev1.ContainerPort{
-		Protocol:      proto,
-		ContainerPort: env.AgentPort,
+	var extraPorts []install.PortMapping
+	for i, tp := range takenOver[1:] {
+		extraPorts = append(extraPorts, install.PortMapping{AgentPort: agentPort(i + 1), AppPort: int(tp.appPort.ContainerPort)})
+	}
+	agentContainer := install.AgentContainer(
+		agentName,
+		env.AgentRegistry+"/"+env.AgentImage,
+		appContainer,
+		agentPort(0),
+		int(takenOver[0].appPort.ContainerPort),
+		extraPorts,
+		env.ManagerNamespace,
+		setGID,
+	)
+	if env.AgentMetricsPort != 0 {
+		install.EnableAgentMetrics(&agentContainer, env.AgentMetricsPort)
+	}
+	if env.HTTPSniffTimeout != 0 {
+		install.SetAgentHTTPSniffTimeout(&agentContainer, env.HTTPSniffTimeout)
 	}
-	if svcPort.TargetPort.Type == intstr.String {
-		containerPort.Name = svcPort.TargetPort.StrVal
+	if env.OTLPEndpoint != "" {
+		install.EnableAgentTracing(&agentContainer, env.OTLPEndpoint)
 	}
 	patches = append(patches, patchOperation{
-		Op:   "add",
-		Path: "/spec/containers/-",
-		Value: install.AgentContainer(
-			agentName,
-			env.AgentRegistry+"/"+env.AgentImage,
-			appContainer,
-			containerPort,
-			int(appPort.ContainerPort),
-			env.ManagerNamespace,
-			setGID,
-		)})
+		Op:    "add",
+		Path:  "/spec/containers/-",
+		Value: agentContainer,
+	})
 
 	return patches, nil
 }
 
 // hidePorts  will replace the symbolic name of a container port with a generated name. It will perform
-// the same replacement on all references to that port from the probes of the container
-func hidePorts(pod *corev1.Pod, cn *corev1.Container, portName string, patches []patchOperation) []patchOperation {
+// the same replacement on all references to that port from the probes of the container. The ordinal
+// keeps the generated names unique when several ports of the container are hidden.
+func hidePorts(pod *corev1.Pod, cn *corev1.Container, portName string, ordinal int, patches []patchOperation) []patchOperation {
 	cns := pod.Spec.Containers
 	var containerPath string
 	for i := range cns {
@@ -293,7 +352,7 @@ func hidePorts(pod *corev1.Pod, cn *corev1.Container, portName string, patches [
 		}
 	}
 
-	hiddenPortName := install.HiddenPortName(portName, 0)
+	hiddenPortName := install.HiddenPortName(portName, ordinal)
 	hidePort := func(path string) {
 		patches = append(patches, patchOperation{
 			Op:    "replace",
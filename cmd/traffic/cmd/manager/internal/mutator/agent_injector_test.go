@@ -89,6 +89,16 @@ func TestTrafficAgentInjector(t *testing.T) {
 			},
 		}, nil
 	}
+	multiPortSvcFinder := func(c context.Context, client *kates.Client, portNameOrNumber, svcName, namespace string, labels map[string]string) (*kates.Service, error) {
+		svc := defaultSvc.DeepCopy()
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{
+			Name:       "rpc",
+			Protocol:   "TCP",
+			Port:       81,
+			TargetPort: intstr.FromString("grpc"),
+		})
+		return svc, nil
+	}
 	multiSvcFinder := func(c context.Context, client *kates.Client, portNameOrNumber, svcName, namespace string, labels map[string]string) (*kates.Service, error) {
 		// simulate not being given a service name and finding multiple services
 		if svcName == "" {
@@ -613,6 +623,62 @@ func TestTrafficAgentInjector(t *testing.T) {
 			"",
 			defaultSvcFinder,
 		},
+		{
+			"Apply Patch: Multiple ports",
+			toAdmissionRequest(podResource, corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						install.InjectAnnotation:      "enabled",
+						install.ServicePortAnnotation: "proxied,rpc",
+					},
+					Labels: map[string]string{
+						"service": "some-name",
+					},
+					Namespace: "some-ns",
+					Name:      "some-name"},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "some-app-name",
+						Image: "some-app-image",
+						Ports: []corev1.ContainerPort{
+							{Name: "http", ContainerPort: 8888},
+							{Name: "grpc", ContainerPort: 9090},
+						}},
+					},
+				},
+			}),
+			`[{"op":"replace","path":"/spec/containers/0/ports/0/name","value":"tm-http"},` +
+				`{"op":"replace","path":"/spec/containers/0/ports/1/name","value":"tm-grpc"},` +
+				`{"op":"add","path":"/spec/containers/-","value":{` +
+				`"name":"traffic-agent",` +
+				`"image":"docker.io/datawire/tel2:2.3.1",` +
+				`"args":["agent"],` +
+				`"ports":[{"name":"http","containerPort":9900,"protocol":"TCP"},{"name":"grpc","containerPort":9901,"protocol":"TCP"}],` +
+				`"env":[` +
+				`{"name":"TELEPRESENCE_CONTAINER","value":"some-app-name"},` +
+				`{"name":"_TEL_AGENT_LOG_LEVEL","value":"info"},` +
+				`{"name":"_TEL_AGENT_NAME","value":"some-name"},` +
+				`{"name":"_TEL_AGENT_NAMESPACE","valueFrom":{"fieldRef":{"fieldPath":"metadata.namespace"}}},` +
+				`{"name":"_TEL_AGENT_POD_IP","valueFrom":{"fieldRef":{"fieldPath":"status.podIP"}}},` +
+				`{"name":"_TEL_AGENT_APP_PORT","value":"8888"},` +
+				`{"name":"_TEL_AGENT_PORT","value":"9900"},` +
+				`{"name":"_TEL_AGENT_EXTRA_PORTS","value":"9901:9090"},` +
+				`{"name":"_TEL_AGENT_MANAGER_HOST","value":"traffic-manager.default"}` +
+				`],` +
+				`"resources":{},` +
+				`"volumeMounts":[` +
+				`{"name":"traffic-annotations","mountPath":"/tel_pod_info"}` +
+				`],` +
+				`"readinessProbe":{"exec":{"command":["/bin/stat","/tmp/agent/ready"]}}` +
+				`}},` +
+				`{"op":"add","path":"/spec/volumes/-","value":{` +
+				`"name":"traffic-annotations",` +
+				`"downwardAPI":{"items":[{"path":"annotations","fieldRef":{"fieldPath":"metadata.annotations"}}]}` +
+				`}}` +
+				`]`,
+			"",
+			multiPortSvcFinder,
+		},
 	}
 
 	for _, test := range tests {
@@ -19,6 +19,7 @@ import (
 
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/metrics"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 )
 
@@ -66,6 +67,7 @@ func ServeMutator(ctx context.Context) error {
 		bytes, statusCode, err := serveMutatingFunc(ctx, r, agentInjector)
 		if err != nil {
 			dlog.Errorf(ctx, "error handling webhook request: %v", err)
+			metrics.WebhookErrors.Inc()
 			w.WriteHeader(statusCode)
 			bytes = []byte(err.Error())
 		} else {
@@ -156,6 +158,7 @@ func serveMutatingFunc(ctx context.Context, r *http.Request, mf mutatorFunc) ([]
 		// If the handler returned an error, still allow the object creation, and incorporate
 		// the error message into the response
 		dlog.Errorf(ctx, "mutating function error: %v", err)
+		metrics.WebhookAdmissions.WithLabelValues(metrics.AdmissionDenied).Inc()
 		response.Allowed = false
 		response.Result = &metav1.Status{
 			Message: err.Error(),
@@ -169,6 +172,11 @@ func serveMutatingFunc(ctx context.Context, r *http.Request, mf mutatorFunc) ([]
 		response.Patch = patchBytes
 		patchType := admission.PatchTypeJSONPatch
 		response.PatchType = &patchType
+		if len(patchOps) > 0 {
+			metrics.WebhookAdmissions.WithLabelValues(metrics.AdmissionPatched).Inc()
+		} else {
+			metrics.WebhookAdmissions.WithLabelValues(metrics.AdmissionUnchanged).Inc()
+		}
 	}
 
 	// Return the AdmissionReview with a response as JSON.
@@ -0,0 +1,150 @@
+// Package policy contains the rules that platform teams use to restrict what intercepts developers can create.
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+)
+
+// Policy is a document of rules that intercepts must comply with. A zero Policy allows everything.
+type Policy struct {
+	// AllowedNamespaces are the namespaces where workloads may be intercepted. The names may contain
+	// shell patterns, e.g. "team-*". All namespaces are allowed when it's empty.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// DeniedNamespaces are the namespaces where workloads may never be intercepted, even when they're
+	// also allowed. The names may contain shell patterns.
+	DeniedNamespaces []string `json:"deniedNamespaces,omitempty"`
+
+	// MaxInterceptDuration is how long an intercept may last. There's no limit when it's zero.
+	MaxInterceptDuration metav1.Duration `json:"maxInterceptDuration,omitempty"`
+
+	// ProductionSelector is a label selector that identifies production workloads. Global intercepts,
+	// i.e. intercepts that don't select the requests that they intercept using headers, are denied on
+	// such workloads.
+	ProductionSelector string `json:"productionSelector,omitempty"`
+
+	// MaxInterceptsPerUser is how many intercepts each user may have. There's no limit when it's zero.
+	MaxInterceptsPerUser int `json:"maxInterceptsPerUser,omitempty"`
+
+	productionSelector labels.Selector
+}
+
+// Parse parses and validates the given YAML or JSON policy document.
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("unable to parse policy: %w", err)
+	}
+	for _, pattern := range append(p.AllowedNamespaces, p.DeniedNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q: %w", pattern, err)
+		}
+	}
+	if p.MaxInterceptDuration.Duration < 0 {
+		return nil, fmt.Errorf("invalid maxInterceptDuration %s: must not be negative", p.MaxInterceptDuration.Duration)
+	}
+	if p.MaxInterceptsPerUser < 0 {
+		return nil, fmt.Errorf("invalid maxInterceptsPerUser %d: must not be negative", p.MaxInterceptsPerUser)
+	}
+	if p.ProductionSelector != "" {
+		var err error
+		if p.productionSelector, err = labels.Parse(p.ProductionSelector); err != nil {
+			return nil, fmt.Errorf("invalid productionSelector %q: %w", p.ProductionSelector, err)
+		}
+	}
+	return p, nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNamespace returns a message that explains why workloads in the given namespace may not be
+// intercepted, or an empty string if they may.
+func (p *Policy) CheckNamespace(namespace string) string {
+	if p == nil {
+		return ""
+	}
+	if matchesAny(p.DeniedNamespaces, namespace) || len(p.AllowedNamespaces) > 0 && !matchesAny(p.AllowedNamespaces, namespace) {
+		return fmt.Sprintf("workloads in namespace %q may not be intercepted", namespace)
+	}
+	return ""
+}
+
+// InterceptDuration returns how long an intercept may last, or zero if there's no limit.
+func (p *Policy) InterceptDuration() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.MaxInterceptDuration.Duration
+}
+
+// RestrictsUsers returns true if the policy contains rules that apply to each user separately. The
+// identity of a user is only verified when clients are authenticated.
+func (p *Policy) RestrictsUsers() bool {
+	return p != nil && p.MaxInterceptsPerUser > 0
+}
+
+// CheckInterceptCount returns a message that explains why a user that already has the given number
+// of intercepts may not create another one, or an empty string if they may.
+func (p *Policy) CheckInterceptCount(count int) string {
+	if p == nil || p.MaxInterceptsPerUser == 0 || count < p.MaxInterceptsPerUser {
+		return ""
+	}
+	return fmt.Sprintf("users may have at most %d intercepts", p.MaxInterceptsPerUser)
+}
+
+// RestrictsGlobalIntercepts returns true if global intercepts are denied on production workloads.
+func (p *Policy) RestrictsGlobalIntercepts() bool {
+	return p != nil && p.productionSelector != nil
+}
+
+// CheckGlobalIntercept returns a message that explains why the given intercept spec may not be used
+// on a workload with the given labels, or an empty string if it may.
+func (p *Policy) CheckGlobalIntercept(spec *rpc.InterceptSpec, workloadLabels map[string]string) string {
+	if !p.RestrictsGlobalIntercepts() || !IsGlobal(spec) || !p.productionSelector.Matches(labels.Set(workloadLabels)) {
+		return ""
+	}
+	return fmt.Sprintf("global intercepts are not allowed on production workloads (matching %q), use a personal intercept instead",
+		p.ProductionSelector)
+}
+
+// IsGlobal returns true if the given intercept spec intercepts requests regardless of their headers,
+// i.e. when it's a "tcp" intercept, or an "http" intercept that is created with `--http-match=all`
+// or that only selects requests by path prefix or source. An "http" spec with mechanism args that
+// can't be parsed, and a spec with an unknown mechanism, are considered global.
+func IsGlobal(spec *rpc.InterceptSpec) bool {
+	if spec.Mechanism != "http" {
+		return true
+	}
+	p, err := forwarder.ParsePredicate(spec.Name, spec.Mechanism, spec.MechanismArgs)
+	return err != nil || len(p.Headers) == 0
+}
+
+// Identity returns the name of the user of the given client that per-user rules apply to.
+func Identity(client *rpc.ClientInfo) string {
+	if ku := client.GetKubernetesUser(); ku != nil && ku.Username != "" {
+		return ku.Username
+	}
+	// The client name is "user@host"
+	name := client.GetName()
+	if i := strings.LastIndexByte(name, '@'); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
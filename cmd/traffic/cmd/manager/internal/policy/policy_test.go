@@ -0,0 +1,122 @@
+package policy_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/extensions"
+)
+
+const testPolicy = `
+allowedNamespaces: ["team-*", "default"]
+deniedNamespaces: ["team-payments"]
+maxInterceptDuration: 2h
+productionSelector: environment=production
+maxInterceptsPerUser: 2
+`
+
+func TestParse(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, p.MaxInterceptDuration.Duration)
+	assert.Equal(t, 2, p.MaxInterceptsPerUser)
+	assert.True(t, p.RestrictsGlobalIntercepts())
+
+	p, err = policy.Parse(nil)
+	require.NoError(t, err)
+	assert.False(t, p.RestrictsGlobalIntercepts())
+
+	for name, doc := range map[string]string{
+		"unknown field":     "maxIntercepts: 2",
+		"bad pattern":       `allowedNamespaces: ["team-["]`,
+		"bad duration":      "maxInterceptDuration: forever",
+		"negative duration": "maxInterceptDuration: -1h",
+		"negative count":    "maxInterceptsPerUser: -1",
+		"bad selector":      "productionSelector: environment in (",
+	} {
+		_, err = policy.Parse([]byte(doc))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPolicy_CheckNamespace(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Empty(t, p.CheckNamespace("default"))
+	assert.Empty(t, p.CheckNamespace("team-checkout"))
+	assert.Equal(t, `workloads in namespace "team-payments" may not be intercepted`, p.CheckNamespace("team-payments"))
+	assert.NotEmpty(t, p.CheckNamespace("kube-system"))
+
+	var none *policy.Policy
+	assert.Empty(t, none.CheckNamespace("kube-system"))
+}
+
+func TestPolicy_InterceptDuration(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, p.InterceptDuration())
+
+	var none *policy.Policy
+	assert.Zero(t, none.InterceptDuration())
+}
+
+func TestPolicy_CheckInterceptCount(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	assert.Empty(t, p.CheckInterceptCount(1))
+	assert.Equal(t, "users may have at most 2 intercepts", p.CheckInterceptCount(2))
+}
+
+func TestPolicy_CheckGlobalIntercept(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	production := map[string]string{"app": "echo", "environment": "production"}
+	staging := map[string]string{"app": "echo", "environment": "staging"}
+	global := &rpc.InterceptSpec{Mechanism: "tcp"}
+
+	// httpSpec returns an http intercept spec with the mechanism args that the CLI sends for the
+	// given flags of the http mechanism.
+	httpSpec := func(flags map[string]string) *rpc.InterceptSpec {
+		spec := &rpc.InterceptSpec{Name: "echo", Mechanism: "http"}
+		for flagname, value := range flags {
+			typ := extensions.TypeEnum("string-array")
+			if flagname == "path-prefix" {
+				typ = "string"
+			}
+			v, err := typ.NewFlagValue(json.RawMessage(value))
+			require.NoError(t, err)
+			spec.MechanismArgs = append(spec.MechanismArgs, v.AsArgs(flagname)...)
+		}
+		return spec
+	}
+	personal := httpSpec(map[string]string{"match": `["auto"]`})
+	headers := httpSpec(map[string]string{"match": `["x-user=alice"]`, "path-prefix": `"/api"`})
+	allRequests := httpSpec(map[string]string{"match": `["all"]`})
+	pathPrefix := httpSpec(map[string]string{"path-prefix": `"/api"`})
+	source := httpSpec(map[string]string{"source": `["10.0.0.0/8"]`})
+
+	assert.NotEmpty(t, p.CheckGlobalIntercept(global, production))
+	assert.NotEmpty(t, p.CheckGlobalIntercept(allRequests, production))
+	assert.NotEmpty(t, p.CheckGlobalIntercept(pathPrefix, production))
+	assert.NotEmpty(t, p.CheckGlobalIntercept(source, production))
+	assert.Empty(t, p.CheckGlobalIntercept(personal, production))
+	assert.Empty(t, p.CheckGlobalIntercept(headers, production))
+	assert.Empty(t, p.CheckGlobalIntercept(global, staging))
+
+	// Intercepts with mechanisms that aren't known to select requests by headers are global
+	assert.NotEmpty(t, p.CheckGlobalIntercept(&rpc.InterceptSpec{Name: "echo", Mechanism: "grpc"}, production))
+}
+
+func TestIdentity(t *testing.T) {
+	assert.Equal(t, "alice", policy.Identity(&rpc.ClientInfo{Name: "alice@squirtle.bigcorp.com"}))
+	assert.Equal(t, "alice@bigcorp.com", policy.Identity(&rpc.ClientInfo{
+		Name:           "alice@squirtle.bigcorp.com",
+		KubernetesUser: &rpc.KubernetesUser{Username: "alice@bigcorp.com"},
+	}))
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// DocumentKey is the key of the policy document in the data of the ConfigMap.
+const DocumentKey = "policy.yaml"
+
+// Watch watches the ConfigMap with the given name and namespace, and calls update with the policy that
+// it contains each time it changes, until the given context is cancelled. The update is called with nil
+// when the ConfigMap is deleted. A ConfigMap with an invalid policy is logged and otherwise ignored, so
+// that the previous policy remains in effect.
+func Watch(ctx context.Context, clientset kubernetes.Interface, name, namespace string, update func(*Policy)) {
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+
+	set := func(obj interface{}) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		p, err := Parse([]byte(cm.Data[DocumentKey]))
+		if err != nil {
+			dlog.Errorf(ctx, "ConfigMap %s.%s: %v", name, namespace, err)
+			return
+		}
+		dlog.Infof(ctx, "Using the policy in ConfigMap %s.%s", name, namespace)
+		update(p)
+	}
+	informerFactory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: set,
+		UpdateFunc: func(_, newObj interface{}) {
+			set(newObj)
+		},
+		DeleteFunc: func(interface{}) {
+			dlog.Infof(ctx, "ConfigMap %s.%s was deleted, intercepts are no longer restricted by a policy", name, namespace)
+			update(nil)
+		},
+	})
+	informerFactory.Start(ctx.Done())
+	<-ctx.Done()
+}
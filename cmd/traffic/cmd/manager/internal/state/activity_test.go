@@ -0,0 +1,71 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+func TestExpireIntercepts_AgentTraffic(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assertNew(t)
+	clock := &FakeClock{}
+	alice := testdata.GetTestClients(t)["alice"]
+	agent := testdata.GetTestAgents(t)["hello"]
+
+	s := state.NewState(ctx)
+	aliceID := s.AddClient(alice, clock.Now())
+
+	add := func(name string) string {
+		_, err := s.AddIntercept(aliceID, "", &rpc.InterceptSpec{
+			Name:        name,
+			Client:      alice.Name,
+			Agent:       agent.Name,
+			Namespace:   agent.Namespace,
+			Mechanism:   "tcp",
+			IdleTimeout: durationpb.New(10 * time.Minute),
+		}, clock.Now())
+		require.NoError(t, err)
+		return aliceID + ":" + name
+	}
+	exists := func(id string) bool {
+		_, ok := s.GetIntercept(id)
+		return ok
+	}
+	// expireUntil advances the clock one minute at a time and expires intercepts at each step
+	expireUntil := func(minute int) {
+		for clock.When < minute*60 {
+			clock.When += 60
+			s.ExpireIntercepts(ctx, clock.Now())
+		}
+	}
+
+	// A long-lived connection keeps the intercept alive although no events are reported
+	id := add("hello")
+	done := s.TrackAgentStream(aliceID, agent)
+	expireUntil(30)
+	a.True(exists(id))
+
+	// The idle timeout starts when the connection is closed
+	done()
+	expireUntil(40)
+	a.True(exists(id))
+	expireUntil(41)
+	a.False(exists(id))
+
+	// Traffic on a muxed tunnel counts as activity too
+	id = add("hello-mux")
+	expireUntil(45)
+	s.MarkAgentTraffic(aliceID, agent)
+	expireUntil(55)
+	a.True(exists(id))
+	expireUntil(56)
+	a.False(exists(id))
+}
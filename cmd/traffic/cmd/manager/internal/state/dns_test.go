@@ -0,0 +1,56 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+func TestAgentsLookupDNS_AgentWithoutWatch(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assertNew(t)
+	clock := &FakeClock{}
+	testAgents := testdata.GetTestAgents(t)
+	testClients := testdata.GetTestClients(t)
+
+	s := state.NewState(ctx)
+	aliceID := s.AddClient(testClients["alice"], clock.Now())
+	helloID := s.AddAgent(testAgents["hello"], clock.Now())
+	_, err := s.AddIntercept(aliceID, "", &rpc.InterceptSpec{
+		Name:      "hello",
+		Client:    testClients["alice"].Name,
+		Agent:     testAgents["hello"].Name,
+		Namespace: testAgents["hello"].Namespace,
+		Mechanism: "tcp",
+	}, clock.Now())
+	require.NoError(t, err)
+
+	// An agent that predates WatchLookupDNS never reads its requests, so the lookup times out
+	// rather than waiting for the agent to accept the request.
+	request := &rpc.DNSRequest{Session: &rpc.SessionInfo{SessionId: aliceID}, Name: "hello", Type: 1}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, count, err := s.AgentsLookupDNS(ctx, aliceID, request)
+		a.NoError(err)
+		a.Equal(0, count)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AgentsLookupDNS blocked on an agent that doesn't read its requests")
+	}
+
+	// A response that arrives after the lookup ended is dropped
+	s.PostDNSResponse(&rpc.DNSAgentResponse{
+		Session:  &rpc.SessionInfo{SessionId: helloID},
+		Request:  request,
+		Response: &rpc.DNSResponse{},
+	})
+}
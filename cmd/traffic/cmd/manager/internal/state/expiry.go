@@ -0,0 +1,199 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// maxExpiryWarning is how long before an intercept expires that its client is warned, at most. The
+// warning is given earlier than that when it's a tenth of the limit that the intercept expires because of.
+const maxExpiryWarning = 5 * time.Minute
+
+// MarkInterceptActivity records that traffic was routed to the given intercept at the given time, so
+// that it doesn't reach its idle timeout.
+func (s *State) MarkInterceptActivity(interceptID string, now time.Time) {
+	s.mu.Lock()
+	if now.After(s.activity[interceptID]) {
+		s.activity[interceptID] = now
+	}
+	s.mu.Unlock()
+}
+
+// agentTrafficKey returns the key of the traffic that the traffic-agents of the given workload route
+// to the given client session.
+func agentTrafficKey(clientSessionID, name, namespace string) string {
+	return clientSessionID + "/" + name + "." + namespace
+}
+
+// trackAgentStream records that a tunnel stream from the given traffic-agent to the given client
+// session is open until the returned function is called. The intercepts of the client on the
+// workload of the agent don't reach their idle timeout while such a stream is open, so that a
+// long-lived connection keeps its intercept alive even when the agent reports no events about it.
+func (s *State) trackAgentStream(clientSessionID string, agent *rpc.AgentInfo) (done func()) {
+	key := agentTrafficKey(clientSessionID, agent.Name, agent.Namespace)
+	s.mu.Lock()
+	s.agentStreams[key]++
+	s.agentTraffic[key] = struct{}{}
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		if s.agentStreams[key]--; s.agentStreams[key] <= 0 {
+			delete(s.agentStreams, key)
+		}
+		s.agentTraffic[key] = struct{}{}
+		s.mu.Unlock()
+	}
+}
+
+// markAgentTraffic records that the given traffic-agent routed traffic to the given client session.
+func (s *State) markAgentTraffic(clientSessionID string, agent *rpc.AgentInfo) {
+	key := agentTrafficKey(clientSessionID, agent.Name, agent.Namespace)
+	s.mu.Lock()
+	s.agentTraffic[key] = struct{}{}
+	s.mu.Unlock()
+}
+
+// unlockedInterceptExpiry (1) assumes that s.mu is already locked, and (2) returns when the given
+// intercept expires, the limit that makes it expire, and a description of that limit. The returned
+// time is zero when the intercept never expires.
+func (s *State) unlockedInterceptExpiry(cept *rpc.InterceptInfo) (expires time.Time, limit time.Duration, what string) {
+	if cept.Created == nil {
+		return time.Time{}, 0, ""
+	}
+	created := cept.Created.AsTime()
+	if ml := cept.Spec.MaxLifetime.AsDuration(); ml > 0 {
+		expires, limit, what = created.Add(ml), ml, "max lifetime"
+	}
+	if pd := s.policy.InterceptDuration(); pd > 0 {
+		if policyExpires := created.Add(pd); expires.IsZero() || policyExpires.Before(expires) {
+			expires, limit, what = policyExpires, pd, "max duration allowed by the policy"
+		}
+	}
+	if it := cept.Spec.IdleTimeout.AsDuration(); it > 0 {
+		last := s.activity[cept.Id]
+		if last.Before(created) {
+			last = created
+		}
+		if idleExpires := last.Add(it); expires.IsZero() || idleExpires.Before(expires) {
+			expires, limit, what = idleExpires, it, "idle timeout"
+		}
+	}
+	return expires, limit, what
+}
+
+// ExpireIntercepts removes the intercepts that have reached their max lifetime or idle timeout, and
+// warns the clients of the intercepts that are about to.
+func (s *State) ExpireIntercepts(ctx context.Context, now time.Time) {
+	intercepts := s.intercepts.LoadAll()
+
+	s.mu.Lock()
+	for id := range s.activity {
+		if _, ok := intercepts[id]; !ok {
+			delete(s.activity, id)
+		}
+	}
+	for id := range s.expiryWarnings {
+		if _, ok := intercepts[id]; !ok {
+			delete(s.expiryWarnings, id)
+		}
+	}
+
+	// Traffic that the traffic-manager routed from the agents to the client since the last time
+	// counts as activity, as do tunnel streams that are still open.
+	for id, cept := range intercepts {
+		key := agentTrafficKey(cept.ClientSession.GetSessionId(), cept.Spec.Agent, cept.Spec.Namespace)
+		if _, ok := s.agentTraffic[key]; ok || s.agentStreams[key] > 0 {
+			if now.After(s.activity[id]) {
+				s.activity[id] = now
+			}
+		}
+	}
+	s.agentTraffic = make(map[string]struct{})
+	s.mu.Unlock()
+
+	for id, cept := range intercepts {
+		s.mu.Lock()
+		expires, limit, what := s.unlockedInterceptExpiry(cept)
+		warn := false
+		if !expires.IsZero() && now.Before(expires) {
+			lead := limit / 10
+			if lead > maxExpiryWarning {
+				lead = maxExpiryWarning
+			}
+			if !now.Add(lead).Before(expires) && !s.expiryWarnings[id].Equal(expires) {
+				s.expiryWarnings[id] = expires
+				warn = true
+			}
+		}
+		s.mu.Unlock()
+
+		notification := &rpc.Notification{
+			InterceptName: cept.Spec.Name,
+			Time:          timestamppb.New(now),
+			Expires:       timestamppb.New(expires),
+		}
+		switch {
+		case expires.IsZero():
+			continue
+		case !now.Before(expires):
+			if !s.RemoveIntercept(id) {
+				continue
+			}
+			dlog.Infof(ctx, "Intercept %s removed. It reached its %s of %s", id, what, limit)
+			notification.Type = rpc.Notification_INTERCEPT_EXPIRED
+			notification.Message = fmt.Sprintf("Intercept %s was removed because it reached its %s of %s", cept.Spec.Name, what, limit)
+		case warn:
+			notification.Type = rpc.Notification_INTERCEPT_EXPIRING
+			notification.Message = fmt.Sprintf("Intercept %s will be removed in %s when it reaches its %s of %s",
+				cept.Spec.Name, expires.Sub(now).Round(time.Second), what, limit)
+		default:
+			continue
+		}
+		s.postNotification(cept.ClientSession.SessionId, notification)
+	}
+}
+
+// WatchNotifications returns a channel that receives the notifications for the given client session.
+// The channel is closed when the given context is cancelled. Notifications are dropped rather than
+// delivered late when the receiver can't keep up.
+func (s *State) WatchNotifications(ctx context.Context, sessionID string) <-chan *rpc.Notification {
+	ch := make(chan *rpc.Notification, 10)
+	s.mu.Lock()
+	ws, ok := s.notifyWatchers[sessionID]
+	if !ok {
+		ws = make(map[chan *rpc.Notification]struct{})
+		s.notifyWatchers[sessionID] = ws
+	}
+	ws[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(ws, ch)
+		if len(ws) == 0 {
+			delete(s.notifyWatchers, sessionID)
+		}
+		close(ch)
+		s.mu.Unlock()
+	}()
+	return ch
+}
+
+// postNotification delivers the given notification to the watchers of the given client session.
+func (s *State) postNotification(sessionID string, notification *rpc.Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.notifyWatchers[sessionID] {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+func TestExpireIntercepts(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assertNew(t)
+	clock := &FakeClock{}
+	testClients := testdata.GetTestClients(t)
+
+	s := state.NewState(ctx)
+	aliceID := s.AddClient(testClients["alice"], clock.Now())
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	notifications := s.WatchNotifications(wctx, aliceID)
+	next := func() *rpc.Notification {
+		select {
+		case n := <-notifications:
+			return n
+		default:
+			return nil
+		}
+	}
+
+	spec := func(name string, maxLifetime, idleTimeout time.Duration) *rpc.InterceptSpec {
+		spec := &rpc.InterceptSpec{
+			Name:      name,
+			Client:    testClients["alice"].Name,
+			Agent:     name,
+			Namespace: "default",
+			Mechanism: "tcp",
+		}
+		if maxLifetime > 0 {
+			spec.MaxLifetime = durationpb.New(maxLifetime)
+		}
+		if idleTimeout > 0 {
+			spec.IdleTimeout = durationpb.New(idleTimeout)
+		}
+		return spec
+	}
+
+	_, err := s.AddIntercept(aliceID, "", spec("hello", time.Hour, 0), clock.Now())
+	require.NoError(t, err)
+	_, err = s.AddIntercept(aliceID, "", spec("echo", 0, 10*time.Minute), clock.Now())
+	require.NoError(t, err)
+	_, err = s.AddIntercept(aliceID, "", spec("forever", 0, 0), clock.Now())
+	require.NoError(t, err)
+
+	exists := func(name string) bool {
+		_, ok := s.GetIntercept(aliceID + ":" + name)
+		return ok
+	}
+
+	// Activity postpones the idle timeout
+	clock.When = 5 * 60
+	s.MarkInterceptActivity(aliceID+":echo", clock.Now())
+	s.ExpireIntercepts(ctx, clock.Now())
+	a.Nil(next())
+
+	// The client is warned a tenth of the idle timeout before it's reached, and only once
+	clock.When = 14*60 + 30
+	s.ExpireIntercepts(ctx, clock.Now())
+	n := next()
+	require.NotNil(t, n)
+	a.Equal(rpc.Notification_INTERCEPT_EXPIRING, n.Type)
+	a.Equal("echo", n.InterceptName)
+	a.Equal(clock.Now().Add(30*time.Second), n.Expires.AsTime())
+	s.ExpireIntercepts(ctx, clock.Now())
+	a.Nil(next())
+
+	clock.When = 15 * 60
+	s.ExpireIntercepts(ctx, clock.Now())
+	n = next()
+	require.NotNil(t, n)
+	a.Equal(rpc.Notification_INTERCEPT_EXPIRED, n.Type)
+	a.Equal("Intercept echo was removed because it reached its idle timeout of 10m0s", n.Message)
+	a.False(exists("echo"))
+	a.True(exists("hello"))
+
+	// The warning of the max lifetime is given at most 5 minutes in advance
+	clock.When = 54 * 60
+	s.ExpireIntercepts(ctx, clock.Now())
+	a.Nil(next())
+	clock.When = 55 * 60
+	s.ExpireIntercepts(ctx, clock.Now())
+	n = next()
+	require.NotNil(t, n)
+	a.Equal(rpc.Notification_INTERCEPT_EXPIRING, n.Type)
+	a.Equal("hello", n.InterceptName)
+
+	clock.When = 60 * 60
+	s.ExpireIntercepts(ctx, clock.Now())
+	n = next()
+	require.NotNil(t, n)
+	a.Equal(rpc.Notification_INTERCEPT_EXPIRED, n.Type)
+	a.False(exists("hello"))
+	a.True(exists("forever"))
+}
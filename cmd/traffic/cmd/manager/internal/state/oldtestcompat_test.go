@@ -37,3 +37,11 @@ func (s *State) Mark(sessionID string, now time.Time) bool {
 	}
 	return s.MarkSession(req, now)
 }
+
+func (s *State) TrackAgentStream(clientSessionID string, agent *rpc.AgentInfo) func() {
+	return s.trackAgentStream(clientSessionID, agent)
+}
+
+func (s *State) MarkAgentTraffic(clientSessionID string, agent *rpc.AgentInfo) {
+	s.markAgentTraffic(clientSessionID, agent)
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/store"
+)
+
+// Restore adds the client sessions and intercepts of the given records to the state. The restored
+// sessions are considered present at the given time, which should leave the clients enough time to
+// reconnect and resume sending Remain calls. Intercepts that were ACTIVE are sent back to WAITING, so
+// that the traffic-agents, once they have arrived again, review them. Intercepts whose client session
+// isn't restored are dropped.
+func (s *State) Restore(ctx context.Context, records *store.Records, lastMarked time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID, client := range records.Clients {
+		if _, loaded := s.clients.LoadOrStore(sessionID, client); loaded {
+			continue
+		}
+		s.sessions[sessionID] = s.newClientSessionState(client, lastMarked)
+		dlog.Debugf(ctx, "Session %s restored", sessionID)
+	}
+
+	for interceptID, intercept := range records.Intercepts {
+		if _, ok := s.sessions[intercept.ClientSession.GetSessionId()]; !ok {
+			dlog.Debugf(ctx, "Intercept %s not restored. Its client session is gone", interceptID)
+			continue
+		}
+		if intercept.Disposition == rpc.InterceptDispositionType_ACTIVE {
+			intercept.Disposition = rpc.InterceptDispositionType_WAITING
+			intercept.Message = "Waiting for Agent approval"
+		}
+		if _, loaded := s.intercepts.LoadOrStore(interceptID, intercept); loaded {
+			continue
+		}
+		s.interceptAPIKeys[interceptID] = intercept.ApiKey
+
+		// The activity of the intercept is unknown, so it gets the same grace period as its session
+		s.activity[interceptID] = lastMarked
+		dlog.Debugf(ctx, "Intercept %s restored", interceptID)
+	}
+}
+
+// Persist saves the client sessions and intercepts to the given store until the given context is
+// cancelled. Changes are saved at most once per interval, and a final save is made when the context
+// is cancelled. Failures to save are logged and retried on the next interval.
+func (s *State) Persist(ctx context.Context, st store.Store, interval time.Duration) error {
+	clientsCh := s.clients.Subscribe(ctx)
+	interceptsCh := s.intercepts.Subscribe(ctx)
+
+	// Wait for the initial snapshots, so that a save never drops the records of either kind.
+	records := store.NewRecords()
+	cs, ok := <-clientsCh
+	if !ok {
+		return nil
+	}
+	records.Clients = cs.State
+	is, ok := <-interceptsCh
+	if !ok {
+		return nil
+	}
+	records.Intercepts = is.State
+
+	save := func(ctx context.Context) bool {
+		if err := st.Save(ctx, records); err != nil {
+			dlog.Errorf(ctx, "failed to persist state: %v", err)
+			return false
+		}
+		return true
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	dirty := true
+	for {
+		select {
+		case cs, ok := <-clientsCh:
+			if !ok {
+				clientsCh = nil
+				continue
+			}
+			records.Clients = cs.State
+			dirty = true
+		case is, ok := <-interceptsCh:
+			if !ok {
+				interceptsCh = nil
+				continue
+			}
+			records.Intercepts = is.State
+			dirty = true
+		case <-ticker.C:
+			if dirty && save(ctx) {
+				dirty = false
+			}
+		case <-ctx.Done():
+			if dirty {
+				ctx, cancel := context.WithTimeout(dcontext.WithoutCancel(ctx), 5*time.Second)
+				save(ctx)
+				cancel()
+			}
+			return nil
+		}
+	}
+}
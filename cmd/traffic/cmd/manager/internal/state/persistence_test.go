@@ -0,0 +1,81 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/store"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+func TestPersistAndRestore(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assertNew(t)
+	clock := &FakeClock{}
+	testClients := testdata.GetTestClients(t)
+	testAgents := testdata.GetTestAgents(t)
+
+	s := state.NewState(ctx)
+	st := store.NewMemory()
+	persistCtx, cancel := context.WithCancel(ctx)
+	persistDone := make(chan error)
+	go func() { persistDone <- s.Persist(persistCtx, st, 10*time.Millisecond) }()
+
+	aliceID := s.AddClient(testClients["alice"], clock.Now())
+	s.AddAgent(testAgents["hello"], clock.Now())
+	cept, err := s.AddIntercept(aliceID, "alice-api-key", &rpc.InterceptSpec{
+		Name:      "hello",
+		Client:    testClients["alice"].Name,
+		Agent:     "hello",
+		Namespace: "default",
+		Mechanism: "tcp",
+	}, clock.Now())
+	require.NoError(t, err)
+	s.UpdateIntercept(cept.Id, func(ii *rpc.InterceptInfo) {
+		ii.Disposition = rpc.InterceptDispositionType_ACTIVE
+		ii.Message = ""
+	})
+
+	var records *store.Records
+	require.Eventually(t, func() bool {
+		records, err = st.Load(ctx)
+		require.NoError(t, err)
+		return len(records.Clients) == 1 && len(records.Intercepts) == 1 &&
+			records.Intercepts[cept.Id].Disposition == rpc.InterceptDispositionType_ACTIVE
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	a.NoError(<-persistDone)
+
+	// The intercept of a client that isn't persisted is dropped
+	records.Intercepts["gone:hello"] = &rpc.InterceptInfo{
+		Spec:          &rpc.InterceptSpec{Name: "hello", Agent: "hello", Namespace: "default"},
+		Id:            "gone:hello",
+		ClientSession: &rpc.SessionInfo{SessionId: "gone"},
+	}
+
+	// A new traffic-manager takes over
+	clock.When = 30
+	s = state.NewState(ctx)
+	s.Restore(ctx, records, clock.Now())
+
+	a.Equal(testClients["alice"], s.GetClient(aliceID))
+	a.True(s.MarkSession(&rpc.RemainRequest{Session: &rpc.SessionInfo{SessionId: aliceID}}, clock.Now()))
+	a.Empty(s.GetAllAgents())
+	intercepts := s.GetAllIntercepts()
+	a.Len(intercepts, 1)
+	restored := intercepts[cept.Id]
+	a.NotNil(restored)
+	a.Equal(rpc.InterceptDispositionType_WAITING, restored.Disposition)
+	a.Equal("alice-api-key", s.GetInterceptAPIKey())
+
+	// The restored session expires unless the client remains
+	s.ExpireSessions(ctx, clock.Now().Add(time.Second))
+	a.Nil(s.GetClient(aliceID))
+	a.Empty(s.GetAllIntercepts())
+}
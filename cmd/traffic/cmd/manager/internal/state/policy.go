@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"sort"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
+)
+
+// SetPolicy sets the policy that intercepts must comply with. A nil policy allows everything.
+func (s *State) SetPolicy(p *policy.Policy) {
+	s.mu.Lock()
+	s.policy = p
+	s.mu.Unlock()
+}
+
+// GetPolicy returns the policy that intercepts must comply with, or nil if there is none.
+func (s *State) GetPolicy() *policy.Policy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy
+}
+
+// unlockedCheckPolicy (1) assumes that s.mu is already locked, and (2) returns a message that explains
+// why the given new intercept violates the policy, or an empty string if it complies with it.
+func (s *State) unlockedCheckPolicy(cept *rpc.InterceptInfo) string {
+	p := s.policy
+	if p == nil {
+		return ""
+	}
+	if msg := p.CheckNamespace(cept.Spec.Namespace); msg != "" {
+		return msg
+	}
+	if p.MaxInterceptsPerUser > 0 {
+		if client, ok := s.clients.Load(cept.ClientSession.SessionId); ok {
+			if msg := p.CheckInterceptCount(s.unlockedCountIntercepts(policy.Identity(client))); msg != "" {
+				return msg
+			}
+		}
+	}
+	return ""
+}
+
+// unlockedCountIntercepts (1) assumes that s.mu is already locked, and (2) returns the number of
+// intercepts of the given user that haven't been denied by the policy.
+func (s *State) unlockedCountIntercepts(user string) int {
+	clients := s.clients.LoadAll()
+	return len(s.intercepts.LoadAllMatching(func(_ string, ii *rpc.InterceptInfo) bool {
+		if ii.Disposition == rpc.InterceptDispositionType_POLICY_DENIED {
+			return false
+		}
+		client, ok := clients[ii.ClientSession.SessionId]
+		return ok && policy.Identity(client) == user
+	}))
+}
+
+// EnforcePolicy moves all intercepts that no longer comply with the policy, because it changed, to
+// the POLICY_DENIED disposition. Intercepts that last longer than the policy allows are removed by
+// ExpireIntercepts instead. When a user has more
+// intercepts than the policy allows, the ones that were created last are denied. The checkGlobal
+// function returns a message that explains why a global intercept spec may not be used on its
+// workload, or an empty string if it may. It's only called when the policy restricts global
+// intercepts, and global intercepts aren't checked again when it's nil.
+func (s *State) EnforcePolicy(ctx context.Context, checkGlobal func(*rpc.InterceptSpec) string) {
+	p := s.GetPolicy()
+	if p == nil {
+		return
+	}
+	clients := s.clients.LoadAll()
+	cepts := s.intercepts.LoadAll()
+
+	// The oldest intercepts of a user are the ones that count towards the limit
+	ids := make([]string, 0, len(cepts))
+	for id := range cepts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := cepts[ids[i]].Created.AsTime(), cepts[ids[j]].Created.AsTime()
+		if ti.Equal(tj) {
+			return ids[i] < ids[j]
+		}
+		return ti.Before(tj)
+	})
+
+	counts := make(map[string]int)
+	for _, id := range ids {
+		cept := cepts[id]
+		if cept.Disposition == rpc.InterceptDispositionType_POLICY_DENIED {
+			continue
+		}
+		msg := p.CheckNamespace(cept.Spec.Namespace)
+		if msg == "" && checkGlobal != nil && p.RestrictsGlobalIntercepts() && policy.IsGlobal(cept.Spec) {
+			msg = checkGlobal(cept.Spec)
+		}
+		if msg == "" && p.MaxInterceptsPerUser > 0 {
+			if client, ok := clients[cept.ClientSession.GetSessionId()]; ok {
+				user := policy.Identity(client)
+				if msg = p.CheckInterceptCount(counts[user]); msg == "" {
+					counts[user]++
+				}
+			}
+		}
+		if msg == "" {
+			continue
+		}
+		dlog.Infof(ctx, "Intercept %s violates the policy: %s", id, msg)
+		s.UpdateIntercept(id, func(ii *rpc.InterceptInfo) {
+			ii.Disposition = rpc.InterceptDispositionType_POLICY_DENIED
+			ii.Message = msg
+		})
+	}
+}
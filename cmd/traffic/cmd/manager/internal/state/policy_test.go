@@ -0,0 +1,121 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
+	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
+)
+
+func TestPolicy(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	a := assertNew(t)
+	clock := &FakeClock{}
+	testClients := testdata.GetTestClients(t)
+
+	s := state.NewState(ctx)
+	aliceID := s.AddClient(testClients["alice"], clock.Now())
+	bobID := s.AddClient(testClients["bob"], clock.Now())
+
+	spec := func(client *rpc.ClientInfo, name, namespace string) *rpc.InterceptSpec {
+		return &rpc.InterceptSpec{
+			Name:      name,
+			Client:    client.Name,
+			Agent:     name,
+			Namespace: namespace,
+			Mechanism: "tcp",
+		}
+	}
+
+	p, err := policy.Parse([]byte(`
+deniedNamespaces: ["kube-*"]
+maxInterceptDuration: 1h
+maxInterceptsPerUser: 1
+`))
+	require.NoError(t, err)
+	s.SetPolicy(p)
+
+	// Workloads in denied namespaces can't be intercepted
+	cept, err := s.AddIntercept(aliceID, "", spec(testClients["alice"], "dns", "kube-system"), clock.Now())
+	require.NoError(t, err)
+	a.Equal(rpc.InterceptDispositionType_POLICY_DENIED, cept.Disposition)
+	a.Equal(`workloads in namespace "kube-system" may not be intercepted`, cept.Message)
+
+	// Denied intercepts don't count, but other intercepts of the same user do
+	cept, err = s.AddIntercept(aliceID, "", spec(testClients["alice"], "hello", "default"), clock.Now())
+	require.NoError(t, err)
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, cept.Disposition)
+	a.Equal(clock.Now(), cept.Created.AsTime())
+	cept, err = s.AddIntercept(aliceID, "", spec(testClients["alice"], "echo", "default"), clock.Now())
+	require.NoError(t, err)
+	a.Equal(rpc.InterceptDispositionType_POLICY_DENIED, cept.Disposition)
+	a.Equal("users may have at most 1 intercepts", cept.Message)
+
+	clock.When = 30 * 60
+	cept, err = s.AddIntercept(bobID, "", spec(testClients["bob"], "echo-easy", "default"), clock.Now())
+	require.NoError(t, err)
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, cept.Disposition)
+
+	disposition := func(id string) rpc.InterceptDispositionType {
+		ii, ok := s.GetIntercept(id)
+		require.True(t, ok)
+		return ii.Disposition
+	}
+
+	// Intercepts are removed when they last too long, and their clients are told why
+	notifications := s.WatchNotifications(ctx, aliceID)
+	clock.When = 60 * 60
+	s.ExpireIntercepts(ctx, clock.Now())
+	_, ok := s.GetIntercept(aliceID + ":hello")
+	a.False(ok)
+	// The denied intercepts expire too, so the notifications arrive in no particular order
+	var messages []string
+	for i := 0; i < 3; i++ {
+		n := <-notifications
+		a.Equal(rpc.Notification_INTERCEPT_EXPIRED, n.Type)
+		messages = append(messages, n.Message)
+	}
+	a.Contains(messages, "Intercept hello was removed because it reached its max duration allowed by the policy of 1h0m0s")
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":echo-easy"))
+
+	// A new policy applies to existing intercepts
+	p, err = policy.Parse([]byte(`allowedNamespaces: ["dev"]`))
+	require.NoError(t, err)
+	s.SetPolicy(p)
+	s.EnforcePolicy(ctx, nil)
+	a.Equal(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":echo-easy"))
+
+	// A new limit of intercepts per user denies the intercepts that were created last
+	s.SetPolicy(nil)
+	clock.When = 70 * 60
+	for _, name := range []string{"first", "second", "third"} {
+		clock.When++
+		cept, err = s.AddIntercept(bobID, "", spec(testClients["bob"], name, "default"), clock.Now())
+		require.NoError(t, err)
+	}
+	p, err = policy.Parse([]byte(`maxInterceptsPerUser: 2`))
+	require.NoError(t, err)
+	s.SetPolicy(p)
+	s.EnforcePolicy(ctx, nil)
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":first"))
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":second"))
+	a.Equal(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":third"))
+
+	// A new production selector applies to existing global intercepts
+	p, err = policy.Parse([]byte(`productionSelector: environment=production`))
+	require.NoError(t, err)
+	s.SetPolicy(p)
+	s.EnforcePolicy(ctx, func(spec *rpc.InterceptSpec) string {
+		if spec.Name == "second" {
+			return "global intercepts are not allowed on production workloads"
+		}
+		return ""
+	})
+	a.NotEqual(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":first"))
+	a.Equal(rpc.InterceptDispositionType_POLICY_DENIED, disposition(bobID+":second"))
+}
@@ -8,16 +8,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/miekg/dns"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
@@ -188,6 +192,8 @@ type agentSessionState struct {
 	agent           *rpc.AgentInfo
 	lookups         chan *rpc.LookupHostRequest
 	lookupResponses map[string]chan *rpc.LookupHostResponse
+	dnsRequests     chan *rpc.DNSRequest
+	dnsResponses    map[string]chan *rpc.DNSResponse
 }
 
 func (ss *agentSessionState) Cancel() {
@@ -195,6 +201,10 @@ func (ss *agentSessionState) Cancel() {
 	for _, lr := range ss.lookupResponses {
 		close(lr)
 	}
+	close(ss.dnsRequests)
+	for _, dr := range ss.dnsResponses {
+		close(dr)
+	}
 	ss.sessionState.Cancel()
 }
 
@@ -219,12 +229,19 @@ type State struct {
 	//  7. `interceptAPIKeys` need to be created and updated in-sync with `intercepts` (but not deleted
 	//      in-sync with `intercepts`; that happens separately, in `RemoveInterceptAPIKey())
 	intercepts       watchable.InterceptMap
-	agents           watchable.AgentMap                   // info for agent sessions
-	clients          watchable.ClientMap                  // info for client sessions
-	sessions         map[string]SessionState              // info for all sessions
-	interceptAPIKeys map[string]string                    // InterceptIDs mapped to the APIKey used to create them
-	listeners        map[string]connpool.Handler          // listeners for all intercepts
-	agentsByName     map[string]map[string]*rpc.AgentInfo // indexed copy of `agents`
+	agents           watchable.AgentMap                               // info for agent sessions
+	clients          watchable.ClientMap                              // info for client sessions
+	sessions         map[string]SessionState                          // info for all sessions
+	interceptAPIKeys map[string]string                                // InterceptIDs mapped to the APIKey used to create them
+	listeners        map[string]connpool.Handler                      // listeners for all intercepts
+	agentsByName     map[string]map[string]*rpc.AgentInfo             // indexed copy of `agents`
+	eventWatchers    map[string]map[chan *rpc.InterceptEvent]struct{} // watchers of the events of each intercept
+	policy           *policy.Policy                                   // the rules that intercepts must comply with
+	activity         map[string]time.Time                             // last time that traffic was routed to each intercept
+	agentStreams     map[string]int                                   // open tunnel streams from traffic-agents to clients, keyed by agentTrafficKey
+	agentTraffic     map[string]struct{}                              // traffic routed from traffic-agents to clients since the intercepts were last expired
+	expiryWarnings   map[string]time.Time                             // the expiry that the client of each intercept was warned about
+	notifyWatchers   map[string]map[chan *rpc.Notification]struct{}   // watchers of the notifications of each client session
 	timedLogLevel    log.TimedLevel
 	logLevelCond     sync.Cond
 }
@@ -236,6 +253,12 @@ func NewState(ctx context.Context) *State {
 		interceptAPIKeys: make(map[string]string),
 		agentsByName:     make(map[string]map[string]*rpc.AgentInfo),
 		listeners:        make(map[string]connpool.Handler),
+		eventWatchers:    make(map[string]map[chan *rpc.InterceptEvent]struct{}),
+		activity:         make(map[string]time.Time),
+		agentStreams:     make(map[string]int),
+		agentTraffic:     make(map[string]struct{}),
+		expiryWarnings:   make(map[string]time.Time),
+		notifyWatchers:   make(map[string]map[chan *rpc.Notification]struct{}),
 		timedLogLevel:    log.NewTimedLevel(os.Getenv("LOG_LEVEL"), log.SetLevel),
 		logLevelCond:     sync.Cond{L: &sync.Mutex{}},
 	}
@@ -257,6 +280,8 @@ func (s *State) unlockedCheckAgentsForIntercept(intercept *rpc.InterceptInfo) (e
 		// Continue through; we can trasition to an error state from here.
 	case rpc.InterceptDispositionType_WAITING:
 		// Continue through; we can trasition to an error state from here.
+	case rpc.InterceptDispositionType_UNHEALTHY:
+		// Continue through; we can trasition to an error state from here.
 	// error states ////////////////////////////////////////////////////////
 	case rpc.InterceptDispositionType_NO_CLIENT:
 		// Don't overwrite this error state.
@@ -273,6 +298,9 @@ func (s *State) unlockedCheckAgentsForIntercept(intercept *rpc.InterceptInfo) (e
 	case rpc.InterceptDispositionType_BAD_ARGS:
 		// Don't overwrite this error state.
 		return intercept.Disposition, intercept.Message
+	case rpc.InterceptDispositionType_POLICY_DENIED:
+		// Don't overwrite this error state.
+		return intercept.Disposition, intercept.Message
 	}
 
 	// main ////////////////////////////////////////////////////////////////
@@ -427,8 +455,13 @@ func (s *State) addClient(sessionID string, client *rpc.ClientInfo, now time.Tim
 	if oldClient, hasConflict := s.clients.LoadOrStore(sessionID, client); hasConflict {
 		panic(fmt.Errorf("duplicate id %q, existing %+v, new %+v", sessionID, oldClient, client))
 	}
+	s.sessions[sessionID] = s.newClientSessionState(client, now)
+	return sessionID
+}
+
+func (s *State) newClientSessionState(client *rpc.ClientInfo, now time.Time) *clientSessionState {
 	ctx, cancel := context.WithCancel(s.ctx)
-	s.sessions[sessionID] = &clientSessionState{
+	return &clientSessionState{
 		sessionState: sessionState{
 			done:       ctx.Done(),
 			cancel:     cancel,
@@ -439,7 +472,6 @@ func (s *State) addClient(sessionID string, client *rpc.ClientInfo, now time.Tim
 		pool:         tunnel.NewPool(),
 		agentTunnels: make(map[string]*agentTunnel),
 	}
-	return sessionID
 }
 
 func (s *State) GetClient(sessionID string) *rpc.ClientInfo {
@@ -488,6 +520,8 @@ func (s *State) AddAgent(agent *rpc.AgentInfo, now time.Time) string {
 		},
 		lookups:         make(chan *rpc.LookupHostRequest),
 		lookupResponses: make(map[string]chan *rpc.LookupHostResponse),
+		dnsRequests:     make(chan *rpc.DNSRequest),
+		dnsResponses:    make(map[string]chan *rpc.DNSResponse),
 		agent:           agent,
 	}
 
@@ -544,7 +578,17 @@ func (s *State) WatchAgents(
 
 // Intercepts //////////////////////////////////////////////////////////////////////////////////////
 
-func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec) (*rpc.InterceptInfo, error) {
+func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec, now time.Time) (*rpc.InterceptInfo, error) {
+	return s.addIntercept(sessionID, apiKey, spec, now, "")
+}
+
+// AddDeniedIntercept adds an intercept that violates the policy for the given reason. It is added in the
+// POLICY_DENIED disposition, so that the client can tell why.
+func (s *State) AddDeniedIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec, now time.Time, reason string) (*rpc.InterceptInfo, error) {
+	return s.addIntercept(sessionID, apiKey, spec, now, reason)
+}
+
+func (s *State) addIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec, now time.Time, denied string) (*rpc.InterceptInfo, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -558,7 +602,8 @@ func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec)
 		ClientSession: &rpc.SessionInfo{
 			SessionId: sessionID,
 		},
-		ApiKey: apiKey,
+		ApiKey:  apiKey,
+		Created: timestamppb.New(now),
 	}
 
 	// Wrap each potential-state-change in a
@@ -566,6 +611,16 @@ func (s *State) AddIntercept(sessionID, apiKey string, spec *rpc.InterceptSpec)
 	//     if cept.Disposition == rpc.InterceptDispositionType_WAITING { … }
 	//
 	// so that we don't need to worry about different state-changes stomping on eachother.
+	if cept.Disposition == rpc.InterceptDispositionType_WAITING {
+		if denied == "" {
+			denied = s.unlockedCheckPolicy(cept)
+		}
+		if denied != "" {
+			cept.Disposition = rpc.InterceptDispositionType_POLICY_DENIED
+			cept.Message = denied
+		}
+	}
+
 	if cept.Disposition == rpc.InterceptDispositionType_WAITING {
 		if errCode, errMsg := s.unlockedCheckAgentsForIntercept(cept); errCode != 0 {
 			cept.Disposition = errCode
@@ -640,6 +695,8 @@ func (s *State) RemoveIntercept(interceptID string) bool {
 	_, didDelete := s.intercepts.LoadAndDelete(interceptID)
 	if didDelete {
 		s.mu.Lock()
+		delete(s.activity, interceptID)
+		delete(s.expiryWarnings, interceptID)
 		l, ok := s.listeners[interceptID]
 		if ok {
 			delete(s.listeners, interceptID)
@@ -684,6 +741,24 @@ func (s *State) GetIntercept(interceptID string) (*rpc.InterceptInfo, bool) {
 	return s.intercepts.Load(interceptID)
 }
 
+func (s *State) GetAllIntercepts() map[string]*rpc.InterceptInfo {
+	return s.intercepts.LoadAll()
+}
+
+// TunnelConnections returns the number of connections that are currently multiplexed over the
+// ClientTunnels of all client sessions.
+func (s *State) TunnelConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, ss := range s.sessions {
+		if cs, ok := ss.(*clientSessionState); ok {
+			count += cs.pool.Len()
+		}
+	}
+	return count
+}
+
 func (s *State) WatchIntercepts(
 	ctx context.Context,
 	filter func(sessionID string, intercept *rpc.InterceptInfo) bool,
@@ -695,6 +770,45 @@ func (s *State) WatchIntercepts(
 	}
 }
 
+// WatchInterceptEvents returns a channel that receives the events that the traffic-agents report for
+// the given intercept. The channel is closed when the given context is cancelled. Events are dropped
+// rather than delivered late when the receiver can't keep up.
+func (s *State) WatchInterceptEvents(ctx context.Context, interceptID string) <-chan *rpc.InterceptEvent {
+	ch := make(chan *rpc.InterceptEvent, 100)
+	s.mu.Lock()
+	ws, ok := s.eventWatchers[interceptID]
+	if !ok {
+		ws = make(map[chan *rpc.InterceptEvent]struct{})
+		s.eventWatchers[interceptID] = ws
+	}
+	ws[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(ws, ch)
+		if len(ws) == 0 {
+			delete(s.eventWatchers, interceptID)
+		}
+		close(ch)
+		s.mu.Unlock()
+	}()
+	return ch
+}
+
+// PostInterceptEvent delivers an event reported by a traffic-agent to the watchers of its intercept.
+func (s *State) PostInterceptEvent(event *rpc.InterceptEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.eventWatchers[event.InterceptId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
 func (s *State) ClientTunnel(ctx context.Context, muxTunnel connpool.MuxTunnel) error {
 	sessionID := managerutil.GetSessionID(ctx)
 	s.mu.Lock()
@@ -780,7 +894,7 @@ func (s *State) Tunnel(ctx context.Context, stream tunnel.Stream) error {
 	// A traffic-agent must always extend the tunnel to the client that it is currently intercepted
 	// by, and hence, start by sending the sessionID of that client on the tunnel.
 	var peerSession SessionState
-	if _, ok := ss.(*agentSessionState); ok {
+	if as, ok := ss.(*agentSessionState); ok {
 		// traffic-agent, so obtain the desired client session
 		m, err := stream.Receive(ctx)
 		if err != nil {
@@ -793,6 +907,9 @@ func (s *State) Tunnel(ctx context.Context, stream tunnel.Stream) error {
 		s.mu.Lock()
 		peerSession = s.sessions[peerID]
 		s.mu.Unlock()
+		if peerSession != nil {
+			defer s.trackAgentStream(peerID, as.agent)()
+		}
 	} else {
 		peerSession = s.getRandomAgentSession(sessionID)
 	}
@@ -919,6 +1036,7 @@ func (s *State) AgentTunnel(ctx context.Context, clientSessionInfo *rpc.SessionI
 					return status.Error(codes.Internal, err.Error())
 				}
 			}
+			s.markAgentTraffic(clientSessionInfo.GetSessionId(), as.agent)
 			dlog.Debugf(ctx, ">> FRWD %s to client", msg.ID())
 			if err = cs.muxTunnel.Send(ctx, msg); err != nil {
 				dlog.Errorf(ctx, "Send to client failed: %v", err)
@@ -1044,6 +1162,157 @@ func (s *State) WatchLookupHost(agentSessionID string) <-chan *rpc.LookupHostReq
 	return ss.(*agentSessionState).lookups
 }
 
+// AgentsLookupDNS will send the given request to all agents currently intercepted by the client identified with
+// the clientSessionID, it will then wait for results to arrive, collect those results, and return the union of
+// the RRs that they found together with a count of how many agents that replied.
+func (s *State) AgentsLookupDNS(ctx context.Context, clientSessionID string, request *rpc.DNSRequest) (*rpc.DNSResponse, int, error) {
+	iceptAgentIDs := s.getAgentsInterceptedByClient(clientSessionID)
+	result := &rpc.DNSResponse{Rcode: dns.RcodeNameError}
+	iceptCount := len(iceptAgentIDs)
+	if iceptCount == 0 {
+		return result, 0, nil
+	}
+
+	rsMu := sync.Mutex{} // prevent concurrent updates of the rrs slice
+	agentTimeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	var rrs []dns.RR
+	var unpackErr error
+	count := 0
+	wg := sync.WaitGroup{}
+	wg.Add(iceptCount)
+	for _, agentSessionID := range iceptAgentIDs {
+		go func(agentSessionID string) {
+			defer func() {
+				s.endDNSLookup(agentSessionID, request)
+				wg.Done()
+			}()
+
+			rsCh := s.startDNSLookup(agentTimeout, agentSessionID, request)
+			if rsCh == nil {
+				return
+			}
+			select {
+			case <-agentTimeout.Done():
+				return
+			case rs := <-rsCh:
+				if rs == nil {
+					// Channel closed
+					return
+				}
+				agentRRs, err := dnsproxy.UnpackRRs(rs.Rrs)
+				rsMu.Lock()
+				defer rsMu.Unlock()
+				if err != nil {
+					unpackErr = err
+					return
+				}
+				count++
+				if rs.Rcode == dns.RcodeSuccess {
+					result.Rcode = dns.RcodeSuccess
+				}
+			nextRR:
+				for _, arr := range agentRRs {
+					for _, rr := range rrs {
+						if dns.IsDuplicate(rr, arr) {
+							continue nextRR
+						}
+					}
+					rrs = append(rrs, arr)
+				}
+			}
+		}(agentSessionID)
+	}
+	wg.Wait() // wait for timeout or that all agents have responded
+	if count == 0 && unpackErr != nil {
+		return nil, 0, unpackErr
+	}
+	var err error
+	if result.Rrs, err = dnsproxy.PackRRs(rrs); err != nil {
+		return nil, 0, err
+	}
+	return result, count, nil
+}
+
+// PostDNSResponse receives DNS responses from an agent and places them in the channel
+// that corresponds to the DNS request. Responses that arrive after the lookup ended, or
+// that duplicate an earlier response, are dropped.
+func (s *State) PostDNSResponse(response *rpc.DNSAgentResponse) {
+	responseID := dnsResponseID(response.Request)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if as, ok := s.sessions[response.Session.SessionId].(*agentSessionState); ok {
+		if rch, ok := as.dnsResponses[responseID]; ok {
+			select {
+			case rch <- response.Response:
+			default:
+			}
+		}
+	}
+}
+
+func dnsResponseID(request *rpc.DNSRequest) string {
+	return fmt.Sprintf("%s:%s:%d", request.Session.SessionId, request.Name, request.Type)
+}
+
+// startDNSLookup sends the given request to the agent with the given session ID and returns the
+// channel of its response. The request is dropped when the given context is done before the agent
+// accepts it, which is always the case with agents that predate WatchLookupDNS, since they never
+// read their requests.
+func (s *State) startDNSLookup(ctx context.Context, agentSessionID string, request *rpc.DNSRequest) <-chan *rpc.DNSResponse {
+	responseID := dnsResponseID(request)
+	var (
+		rch chan *rpc.DNSResponse
+		as  *agentSessionState
+		ok  bool
+	)
+	s.mu.Lock()
+	if as, ok = s.sessions[agentSessionID].(*agentSessionState); ok {
+		if rch, ok = as.dnsResponses[responseID]; !ok {
+			rch = make(chan *rpc.DNSResponse, 1)
+			as.dnsResponses[responseID] = rch
+		}
+	}
+	s.mu.Unlock()
+	if as != nil {
+		// the as.dnsRequests channel may be closed at this point, so guard for panic. The
+		// rch channel is then closed by the Cancel of the session that closed as.dnsRequests.
+		func() {
+			defer func() {
+				_ = recover()
+			}()
+			select {
+			case <-ctx.Done():
+			case as.dnsRequests <- request:
+			}
+		}()
+	}
+	return rch
+}
+
+func (s *State) endDNSLookup(agentSessionID string, request *rpc.DNSRequest) {
+	responseID := dnsResponseID(request)
+	s.mu.Lock()
+	if as, ok := s.sessions[agentSessionID].(*agentSessionState); ok {
+		if rch, ok := as.dnsResponses[responseID]; ok {
+			delete(as.dnsResponses, responseID)
+			close(rch)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) WatchLookupDNS(agentSessionID string) <-chan *rpc.DNSRequest {
+	s.mu.Lock()
+	ss, ok := s.sessions[agentSessionID]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return ss.(*agentSessionState).dnsRequests
+}
+
 // SetTempLogLevel sets the temporary log-level for the traffic-manager and all agents and,
 // if a duration is given, it also starts a timer that will reset the log-level once it
 // fires.
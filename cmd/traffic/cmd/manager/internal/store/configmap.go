@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+const (
+	clientsKey    = "clients.json"
+	interceptsKey = "intercepts.json"
+)
+
+type configMap struct {
+	client    kubernetes.Interface
+	name      string
+	namespace string
+}
+
+// NewConfigMap returns a Store that persists the records in the ConfigMap with the given name and
+// namespace. The ConfigMap is created when it doesn't exist. Each kind of record is stored as a JSON
+// object under its own key, where the values are the protobuf JSON mapping of each record.
+//
+// The API keys of the records are credentials, so they are kept out of the ConfigMap and stored in
+// a Secret with the same name and namespace instead, using the same keys, where each value is a JSON
+// object that maps a record ID to its API key.
+func NewConfigMap(client kubernetes.Interface, name, namespace string) Store {
+	return &configMap{client: client, name: name, namespace: namespace}
+}
+
+func (c *configMap) Load(ctx context.Context) (*Records, error) {
+	cm, err := c.client.CoreV1().ConfigMaps(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return NewRecords(), nil
+		}
+		return nil, fmt.Errorf("unable to get ConfigMap %s.%s: %w", c.name, c.namespace, err)
+	}
+	records := NewRecords()
+	if err = unmarshalRecords(cm.Data[clientsKey], func(id string, data []byte) error {
+		ci := &rpc.ClientInfo{}
+		records.Clients[id] = ci
+		return protojson.Unmarshal(data, ci)
+	}); err != nil {
+		return nil, fmt.Errorf("unable to load %s from ConfigMap %s.%s: %w", clientsKey, c.name, c.namespace, err)
+	}
+	if err = unmarshalRecords(cm.Data[interceptsKey], func(id string, data []byte) error {
+		ii := &rpc.InterceptInfo{}
+		records.Intercepts[id] = ii
+		return protojson.Unmarshal(data, ii)
+	}); err != nil {
+		return nil, fmt.Errorf("unable to load %s from ConfigMap %s.%s: %w", interceptsKey, c.name, c.namespace, err)
+	}
+
+	secret, err := c.client.CoreV1().Secrets(c.namespace).Get(ctx, c.name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return records, nil
+		}
+		return nil, fmt.Errorf("unable to get Secret %s.%s: %w", c.name, c.namespace, err)
+	}
+	var apiKeys map[string]string
+	if apiKeys, err = unmarshalAPIKeys(secret.Data[clientsKey]); err != nil {
+		return nil, fmt.Errorf("unable to load %s from Secret %s.%s: %w", clientsKey, c.name, c.namespace, err)
+	}
+	for id, ci := range records.Clients {
+		ci.ApiKey = apiKeys[id]
+	}
+	if apiKeys, err = unmarshalAPIKeys(secret.Data[interceptsKey]); err != nil {
+		return nil, fmt.Errorf("unable to load %s from Secret %s.%s: %w", interceptsKey, c.name, c.namespace, err)
+	}
+	for id, ii := range records.Intercepts {
+		ii.ApiKey = apiKeys[id]
+	}
+	return records, nil
+}
+
+func (c *configMap) Save(ctx context.Context, records *Records) error {
+	records = records.Clone()
+	clients := make(map[string]proto.Message, len(records.Clients))
+	clientKeys := make(map[string]string)
+	for id, ci := range records.Clients {
+		if ci.ApiKey != "" {
+			clientKeys[id] = ci.ApiKey
+			ci.ApiKey = ""
+		}
+		clients[id] = ci
+	}
+	intercepts := make(map[string]proto.Message, len(records.Intercepts))
+	interceptKeys := make(map[string]string)
+	for id, ii := range records.Intercepts {
+		if ii.ApiKey != "" {
+			interceptKeys[id] = ii.ApiKey
+			ii.ApiKey = ""
+		}
+		intercepts[id] = ii
+	}
+	data := make(map[string]string, 2)
+	var err error
+	if data[clientsKey], err = marshalRecords(clients); err != nil {
+		return err
+	}
+	if data[interceptsKey], err = marshalRecords(intercepts); err != nil {
+		return err
+	}
+	secretData := make(map[string][]byte, 2)
+	if secretData[clientsKey], err = json.Marshal(clientKeys); err != nil {
+		return err
+	}
+	if secretData[interceptsKey], err = json.Marshal(interceptKeys); err != nil {
+		return err
+	}
+
+	// Nothing is saved when either object would be rejected, so that the Secret and the ConfigMap
+	// stay consistent with each other.
+	if size := dataSize(data); size > corev1.MaxSecretSize {
+		return fmt.Errorf("unable to save ConfigMap %s.%s: the %d clients and %d intercepts need %d bytes, but at most %d bytes can be stored",
+			c.name, c.namespace, len(clients), len(intercepts), size, corev1.MaxSecretSize)
+	}
+	if size := secretDataSize(secretData); size > corev1.MaxSecretSize {
+		return fmt.Errorf("unable to save Secret %s.%s: the API keys of %d clients and %d intercepts need %d bytes, but at most %d bytes can be stored",
+			c.name, c.namespace, len(clientKeys), len(interceptKeys), size, corev1.MaxSecretSize)
+	}
+
+	// The Secret is saved first, so that the ConfigMap never refers to records that have no API key
+	// when it should.
+	secrets := c.client.CoreV1().Secrets(c.namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, c.name, metav1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			_, err = secrets.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: c.namespace},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       secretData,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		secret.Data = secretData
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save Secret %s.%s: %w", c.name, c.namespace, err)
+	}
+
+	api := c.client.CoreV1().ConfigMaps(c.namespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := api.Get(ctx, c.name, metav1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			_, err = api.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: c.name, Namespace: c.namespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		cm.Data = data
+		_, err = api.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save ConfigMap %s.%s: %w", c.name, c.namespace, err)
+	}
+	return nil
+}
+
+// dataSize returns the size of the given ConfigMap data, as the API server measures it.
+func dataSize(data map[string]string) int {
+	size := 0
+	for k, v := range data {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// secretDataSize returns the size of the given Secret data, as the API server measures it.
+func secretDataSize(data map[string][]byte) int {
+	size := 0
+	for k, v := range data {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+func marshalRecords(records map[string]proto.Message) (string, error) {
+	rm := make(map[string]json.RawMessage, len(records))
+	for id, r := range records {
+		data, err := protojson.Marshal(r)
+		if err != nil {
+			return "", err
+		}
+		rm[id] = data
+	}
+	data, err := json.Marshal(rm)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func unmarshalRecords(data string, unmarshal func(id string, data []byte) error) error {
+	if data == "" {
+		return nil
+	}
+	var rm map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &rm); err != nil {
+		return err
+	}
+	for id, r := range rm {
+		if err := unmarshal(id, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalAPIKeys(data []byte) (map[string]string, error) {
+	var apiKeys map[string]string
+	if len(data) == 0 {
+		return apiKeys, nil
+	}
+	if err := json.Unmarshal(data, &apiKeys); err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
@@ -0,0 +1,75 @@
+// Package store contains the backends that the traffic-manager uses to persist the parts of its
+// state that must survive a restart, rollout, or failover of the traffic-manager.
+package store
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// Records are the client sessions and intercepts that a Store persists. Agent sessions are not
+// persisted, because the traffic-agents arrive again as soon as they lose their connection.
+type Records struct {
+	Clients    map[string]*rpc.ClientInfo    // client sessions, keyed by session ID
+	Intercepts map[string]*rpc.InterceptInfo // intercepts, keyed by intercept ID
+}
+
+// Store is a backend that persists Records.
+type Store interface {
+	// Load returns the records that were last saved, or empty records if nothing has been saved.
+	Load(ctx context.Context) (*Records, error)
+
+	// Save replaces the persisted records with the given records.
+	Save(ctx context.Context, records *Records) error
+}
+
+// NewRecords returns empty Records.
+func NewRecords() *Records {
+	return &Records{
+		Clients:    make(map[string]*rpc.ClientInfo),
+		Intercepts: make(map[string]*rpc.InterceptInfo),
+	}
+}
+
+// Clone returns a deep copy of the records.
+func (r *Records) Clone() *Records {
+	c := &Records{
+		Clients:    make(map[string]*rpc.ClientInfo, len(r.Clients)),
+		Intercepts: make(map[string]*rpc.InterceptInfo, len(r.Intercepts)),
+	}
+	for id, ci := range r.Clients {
+		c.Clients[id] = proto.Clone(ci).(*rpc.ClientInfo)
+	}
+	for id, ii := range r.Intercepts {
+		c.Intercepts[id] = proto.Clone(ii).(*rpc.InterceptInfo)
+	}
+	return c
+}
+
+type memory struct {
+	sync.Mutex
+	records *Records
+}
+
+// NewMemory returns a Store that keeps the records in memory, and hence, doesn't persist anything
+// beyond the life of the traffic-manager process.
+func NewMemory() Store {
+	return &memory{records: NewRecords()}
+}
+
+func (m *memory) Load(_ context.Context) (*Records, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.records.Clone(), nil
+}
+
+func (m *memory) Save(_ context.Context, records *Records) error {
+	m.Lock()
+	m.records = records.Clone()
+	m.Unlock()
+	return nil
+}
@@ -0,0 +1,150 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/store"
+)
+
+func testRecords() *store.Records {
+	records := store.NewRecords()
+	records.Clients["2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a"] = &rpc.ClientInfo{
+		Name:      "alice@squirtle.bigcorp.com",
+		InstallId: "install_id_for_alice",
+		Product:   "telepresence",
+		Version:   "v2.4.7",
+		ApiKey:    "alice-api-key",
+	}
+	records.Intercepts["2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a:hello"] = &rpc.InterceptInfo{
+		Spec: &rpc.InterceptSpec{
+			Name:      "hello",
+			Client:    "alice@squirtle.bigcorp.com",
+			Agent:     "hello",
+			Namespace: "default",
+			Mechanism: "tcp",
+		},
+		Id:            "2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a:hello",
+		ClientSession: &rpc.SessionInfo{SessionId: "2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a"},
+		Disposition:   rpc.InterceptDispositionType_ACTIVE,
+		PodIp:         "10.1.0.12",
+		ApiKey:        "alice-api-key",
+	}
+	return records
+}
+
+func assertRecordsEqual(t *testing.T, expected, actual *store.Records) {
+	t.Helper()
+	require.Len(t, actual.Clients, len(expected.Clients))
+	for id, ci := range expected.Clients {
+		assert.True(t, proto.Equal(ci, actual.Clients[id]), "client %s", id)
+	}
+	require.Len(t, actual.Intercepts, len(expected.Intercepts))
+	for id, ii := range expected.Intercepts {
+		assert.True(t, proto.Equal(ii, actual.Intercepts[id]), "intercept %s", id)
+	}
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func() store.Store{
+		"memory": store.NewMemory,
+		"configmap": func() store.Store {
+			return store.NewConfigMap(fake.NewSimpleClientset(), "traffic-manager-state", "ambassador")
+		},
+	}
+	for name, newStore := range stores {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			st := newStore()
+
+			// Nothing saved yet
+			records, err := st.Load(ctx)
+			require.NoError(t, err)
+			assertRecordsEqual(t, store.NewRecords(), records)
+
+			// Create
+			expected := testRecords()
+			require.NoError(t, st.Save(ctx, expected))
+			records, err = st.Load(ctx)
+			require.NoError(t, err)
+			assertRecordsEqual(t, expected, records)
+
+			// Replace
+			for id := range expected.Intercepts {
+				delete(expected.Intercepts, id)
+			}
+			require.NoError(t, st.Save(ctx, expected))
+			records, err = st.Load(ctx)
+			require.NoError(t, err)
+			assertRecordsEqual(t, expected, records)
+		})
+	}
+}
+
+func TestConfigMap_format(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	st := store.NewConfigMap(client, "traffic-manager-state", "ambassador")
+	require.NoError(t, st.Save(ctx, testRecords()))
+
+	cm, err := client.CoreV1().ConfigMaps("ambassador").Get(ctx, "traffic-manager-state", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a": {
+			"name": "alice@squirtle.bigcorp.com",
+			"installId": "install_id_for_alice",
+			"product": "telepresence",
+			"version": "v2.4.7"
+		}
+	}`, cm.Data["clients.json"])
+	assert.Contains(t, cm.Data, "intercepts.json")
+	assert.NotContains(t, cm.Data["intercepts.json"], "alice-api-key")
+
+	// The API keys are kept in a Secret
+	secret, err := client.CoreV1().Secrets("ambassador").Get(ctx, "traffic-manager-state", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a": "alice-api-key"}`, string(secret.Data["clients.json"]))
+	assert.Contains(t, string(secret.Data["intercepts.json"]), "alice-api-key")
+
+	cm.Data["intercepts.json"] = "{"
+	_, err = client.CoreV1().ConfigMaps("ambassador").Update(ctx, cm, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	_, err = st.Load(ctx)
+	assert.Error(t, err)
+}
+
+func TestConfigMap_tooLarge(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	st := store.NewConfigMap(client, "traffic-manager-state", "ambassador")
+	expected := testRecords()
+	require.NoError(t, st.Save(ctx, expected))
+
+	// A ConfigMap can't hold more than 1 MiB, so a save that needs more fails and leaves the saved
+	// records as they were.
+	records := testRecords()
+	for i := 0; i < 2000; i++ {
+		id := fmt.Sprintf("2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a:hello-%d", i)
+		ii := proto.Clone(records.Intercepts["2ba6b9a4-4f9c-4d6e-9b8e-0b2f6e3f6d1a:hello"]).(*rpc.InterceptInfo)
+		ii.Id = id
+		ii.Message = strings.Repeat("x", 1000)
+		records.Intercepts[id] = ii
+	}
+	err := st.Save(ctx, records)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2001 intercepts")
+
+	records, err = st.Load(ctx)
+	require.NoError(t, err)
+	assertRecordsEqual(t, expected, records)
+}
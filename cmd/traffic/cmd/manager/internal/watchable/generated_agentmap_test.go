@@ -279,7 +279,7 @@ func TestAgentMap_Subscribe(t *testing.T) {
 				"f": {Name: "F"},
 			},
 			Updates: []watchable.AgentMapUpdate{
-				{Key: "c", Value: &manager.AgentInfo{Name: "c"}},
+				{Key: "c", Value: &manager.AgentInfo{Name: "c"}, Previous: &manager.AgentInfo{Name: "C"}},
 				{Key: "c", Delete: true, Value: &manager.AgentInfo{Name: "c"}},
 			},
 		},
@@ -352,7 +352,7 @@ func TestAgentMap_SubscribeSubset(t *testing.T) {
 				"c": {Name: "C"},
 			},
 			Updates: []watchable.AgentMapUpdate{
-				{Key: "a", Value: &manager.AgentInfo{Name: "a"}},
+				{Key: "a", Value: &manager.AgentInfo{Name: "a"}, Previous: &manager.AgentInfo{Name: "A"}},
 			},
 		},
 		snapshot)
@@ -279,7 +279,7 @@ func TestClientMap_Subscribe(t *testing.T) {
 				"f": {Name: "F"},
 			},
 			Updates: []watchable.ClientMapUpdate{
-				{Key: "c", Value: &manager.ClientInfo{Name: "c"}},
+				{Key: "c", Value: &manager.ClientInfo{Name: "c"}, Previous: &manager.ClientInfo{Name: "C"}},
 				{Key: "c", Delete: true, Value: &manager.ClientInfo{Name: "c"}},
 			},
 		},
@@ -352,7 +352,7 @@ func TestClientMap_SubscribeSubset(t *testing.T) {
 				"c": {Name: "C"},
 			},
 			Updates: []watchable.ClientMapUpdate{
-				{Key: "a", Value: &manager.ClientInfo{Name: "a"}},
+				{Key: "a", Value: &manager.ClientInfo{Name: "a"}, Previous: &manager.ClientInfo{Name: "A"}},
 			},
 		},
 		snapshot)
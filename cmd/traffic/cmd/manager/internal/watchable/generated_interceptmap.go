@@ -16,6 +16,10 @@ type InterceptMapUpdate struct {
 	Key    string
 	Delete bool // Whether this is deleting the entry for .Key, or setting it to .Value.
 	Value  *manager.InterceptInfo
+
+	// Previous is the value that .Key had before it was set to .Value, or nil if it had none.
+	// It's not set when .Delete is true.
+	Previous *manager.InterceptInfo `json:",omitempty"`
 }
 
 // InterceptMapSnapshot contains a snapshot of the current state of a InterceptMap, as well as a list of
@@ -351,6 +355,7 @@ func (tm *InterceptMap) coalesce(
 			}
 		} else {
 			if old, haveOld := cur[update.Key]; !haveOld || !proto.Equal(old, update.Value) {
+				update.Previous = old
 				snapshot.Updates = append(snapshot.Updates, update)
 				cur[update.Key] = update.Value
 				if snapshot.State != nil {
@@ -279,7 +279,7 @@ func TestInterceptMap_Subscribe(t *testing.T) {
 				"f": {Id: "F"},
 			},
 			Updates: []watchable.InterceptMapUpdate{
-				{Key: "c", Value: &manager.InterceptInfo{Id: "c"}},
+				{Key: "c", Value: &manager.InterceptInfo{Id: "c"}, Previous: &manager.InterceptInfo{Id: "C"}},
 				{Key: "c", Delete: true, Value: &manager.InterceptInfo{Id: "c"}},
 			},
 		},
@@ -352,7 +352,7 @@ func TestInterceptMap_SubscribeSubset(t *testing.T) {
 				"c": {Id: "C"},
 			},
 			Updates: []watchable.InterceptMapUpdate{
-				{Key: "a", Value: &manager.InterceptInfo{Id: "a"}},
+				{Key: "a", Value: &manager.InterceptInfo{Id: "a"}, Previous: &manager.InterceptInfo{Id: "A"}},
 			},
 		},
 		snapshot)
@@ -17,6 +17,10 @@ type MAPTYPEUpdate struct {
 	Key    string
 	Delete bool // Whether this is deleting the entry for .Key, or setting it to .Value.
 	Value  VALTYPE
+
+	// Previous is the value that .Key had before it was set to .Value, or nil if it had none.
+	// It's not set when .Delete is true.
+	Previous VALTYPE `json:",omitempty"`
 }
 
 // MAPTYPESnapshot contains a snapshot of the current state of a MAPTYPE, as well as a list of
@@ -352,6 +356,7 @@ func (tm *MAPTYPE) coalesce(
 			}
 		} else {
 			if old, haveOld := cur[update.Key]; !haveOld || !proto.Equal(old, update.Value) {
+				update.Previous = old
 				snapshot.Updates = append(snapshot.Updates, update)
 				cur[update.Key] = update.Value
 				if snapshot.State != nil {
@@ -280,7 +280,7 @@ func TestMAPTYPE_Subscribe(t *testing.T) {
 				"f": {TESTFIELD: "F"},
 			},
 			Updates: []watchable.MAPTYPEUpdate{
-				{Key: "c", Value: VALCTOR{TESTFIELD: "c"}},
+				{Key: "c", Value: VALCTOR{TESTFIELD: "c"}, Previous: VALCTOR{TESTFIELD: "C"}},
 				{Key: "c", Delete: true, Value: VALCTOR{TESTFIELD: "c"}},
 			},
 		},
@@ -353,7 +353,7 @@ func TestMAPTYPE_SubscribeSubset(t *testing.T) {
 				"c": {TESTFIELD: "C"},
 			},
 			Updates: []watchable.MAPTYPEUpdate{
-				{Key: "a", Value: VALCTOR{TESTFIELD: "a"}},
+				{Key: "a", Value: VALCTOR{TESTFIELD: "a"}, Previous: VALCTOR{TESTFIELD: "A"}},
 			},
 		},
 		snapshot)
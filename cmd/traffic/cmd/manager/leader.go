@@ -0,0 +1,200 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/store"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+const (
+	// leaderLabel is the label of the pod of the elected traffic-manager. The traffic-manager service
+	// selects on it when leader election is enabled, so that clients and agents only reach the leader.
+	leaderLabel = "telepresence.io/traffic-manager-leader"
+
+	// leaseName is the name of the Lease that the traffic-manager replicas compete for.
+	leaseName = "traffic-manager"
+
+	// restoreGracePeriod is the time that clients are given to reconnect to a traffic-manager that
+	// restored their sessions before those sessions expire.
+	restoreGracePeriod = time.Minute
+)
+
+// newStore returns the store that the state of the traffic-manager is persisted in.
+func newStore(ctx context.Context) (store.Store, error) {
+	env := managerutil.GetEnv(ctx)
+	switch env.StateStore {
+	case "", "memory":
+		return store.NewMemory(), nil
+	case "configmap":
+		return store.NewConfigMap(managerutil.GetK8sClientset(ctx), env.StateConfigMap, env.ManagerNamespace), nil
+	default:
+		return nil, fmt.Errorf(`invalid TELEPRESENCE_STATE_STORE %q, must be either "memory" or "configmap"`, env.StateStore)
+	}
+}
+
+// lead restores the state from the given store, and then lets this replica serve clients and agents
+// and persists the state until the given context is cancelled or one of its goroutines fails.
+func (m *Manager) lead(ctx context.Context, st store.Store) error {
+	records, err := st.Load(ctx)
+	if err != nil {
+		return err
+	}
+	m.state.Restore(ctx, records, m.clock.Now().Add(restoreGracePeriod))
+	atomic.StoreInt32(&m.leading, 1)
+	defer atomic.StoreInt32(&m.leading, 0)
+
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{})
+	g.Go("intercept-gc", m.runInterceptGCLoop)
+
+	// This goroutine is responsible for informing System A of intercepts (and
+	// relevant metadata like domains) that have been garbage collected. This
+	// ensures System A doesn't list preview URLs + intercepts that no longer
+	// exist.
+	g.Go("systema-gc", m.runSystemAGCLoop)
+
+	g.Go("state-store", func(ctx context.Context) error {
+		return m.state.Persist(ctx, st, time.Second)
+	})
+
+	env := managerutil.GetEnv(ctx)
+	if env.PolicyConfigMap != "" {
+		g.Go("policy", m.watchPolicy)
+	}
+	if env.AuditLog != "" || env.AuditKubernetesEvents {
+		g.Go("audit", m.runAudit)
+	}
+	return g.Wait()
+}
+
+// leaderOnlyOptions returns the gRPC server options that make a replica refuse the calls of the
+// Manager service while it doesn't lead. Every replica serves the health service and the metrics, so
+// that probes and scrapes of the replicas that follow succeed.
+func (m *Manager) leaderOnlyOptions() []grpc.ServerOption {
+	managerMethod := "/" + rpc.Manager_ServiceDesc.ServiceName + "/"
+	check := func(fullMethod string) error {
+		if strings.HasPrefix(fullMethod, managerMethod) && atomic.LoadInt32(&m.leading) == 0 {
+			return status.Error(codes.Unavailable, "this traffic-manager replica is not the leader")
+		}
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := check(info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// runLeaderElection competes for the traffic-manager Lease with the other replicas and calls lead
+// once this replica is elected. The pod of the leader is labeled with leaderLabel. An error is
+// returned when the leadership is lost, so that the process restarts as a follower with a fresh
+// state rather than continuing with a state that the new leader has taken over.
+func (m *Manager) runLeaderElection(ctx context.Context, lead func(context.Context) error) error {
+	env := managerutil.GetEnv(ctx)
+	if env.PodName == "" {
+		return errors.New("POD_NAME must be set when TELEPRESENCE_LEADER_ELECTION is enabled")
+	}
+	clientset := managerutil.GetK8sClientset(ctx)
+
+	// The pod keeps its labels when its container restarts, so a former leader must not be
+	// reachable until it's elected again.
+	if err := setLeaderLabel(ctx, env.PodName, false); err != nil {
+		return err
+	}
+
+	leCtx, leCancel := context.WithCancel(ctx)
+	defer leCancel()
+	started := make(chan struct{})
+	leadErr := make(chan error, 1)
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: leaseName, Namespace: env.ManagerNamespace},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: env.PodName},
+		},
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				close(started)
+				dlog.Infof(ctx, "Elected as the leader")
+				err := setLeaderLabel(ctx, env.PodName, true)
+				if err == nil {
+					err = lead(ctx)
+				}
+				if lerr := setLeaderLabel(dcontext.WithoutCancel(ctx), env.PodName, false); lerr != nil {
+					dlog.Error(ctx, lerr)
+				}
+				leadErr <- err
+
+				// Stop renewing the lease, so that another replica can take over
+				leCancel()
+			},
+			OnStoppedLeading: func() {},
+			OnNewLeader: func(identity string) {
+				if identity != env.PodName {
+					dlog.Infof(ctx, "The leader is %s", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	le.Run(leCtx)
+
+	select {
+	case <-started:
+	default:
+		// The context was cancelled before this replica was elected
+		return nil
+	}
+	if err = <-leadErr; err == nil && ctx.Err() == nil {
+		err = errors.New("no longer the leader")
+	}
+	return err
+}
+
+// setLeaderLabel adds or removes the leaderLabel of the given pod in the manager namespace.
+func setLeaderLabel(ctx context.Context, podName string, leader bool) error {
+	value := "null"
+	if leader {
+		value = `"true"`
+	}
+	patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%s}}}`, leaderLabel, value)
+	env := managerutil.GetEnv(ctx)
+	pods := managerutil.GetK8sClientset(ctx).CoreV1().Pods(env.ManagerNamespace)
+	if _, err := pods.Patch(ctx, podName, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("unable to label pod %s.%s: %w", podName, env.ManagerNamespace, err)
+	}
+	return nil
+}
@@ -13,14 +13,17 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
+	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dhttp"
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/rpc/v2/systema"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/metrics"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/mutator"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/watchable"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
 )
 
@@ -43,23 +46,38 @@ func Main(ctx context.Context, args ...string) error {
 	}
 	ctx = managerutil.WithK8SClientset(ctx, clientset)
 
+	shutdownTracing, err := tracing.Init(ctx, "traffic-manager", managerutil.GetEnv(ctx).OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(dcontext.WithoutCancel(ctx))
+	}()
+
 	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{
 		EnableSignalHandling: true,
 	})
 	mgr := NewManager(ctx)
-
-	// Serve HTTP (including gRPC)
-	g.Go("httpd", mgr.serveHTTP)
+	st, err := newStore(ctx)
+	if err != nil {
+		return err
+	}
 
 	g.Go("agent-injector", mutator.ServeMutator)
 
-	g.Go("intercept-gc", mgr.runInterceptGCLoop)
+	// Serve HTTP (including gRPC) on every replica
+	g.Go("httpd", mgr.serveHTTP)
 
-	// This goroutine is responsible for informing System A of intercepts (and
-	// relevant metadata like domains) that have been garbage collected. This
-	// ensures System A doesn't list preview URLs + intercepts that no longer
-	// exist.
-	g.Go("systema-gc", mgr.runSystemAGCLoop)
+	lead := func(ctx context.Context) error {
+		return mgr.lead(ctx, st)
+	}
+	if managerutil.GetEnv(ctx).LeaderElection {
+		g.Go("leader-election", func(ctx context.Context) error {
+			return mgr.runLeaderElection(ctx, lead)
+		})
+	} else {
+		g.Go("manager", lead)
+	}
 
 	// Wait for exit
 	return g.Wait()
@@ -69,15 +87,17 @@ func (m *Manager) serveHTTP(ctx context.Context) error {
 	env := managerutil.GetEnv(ctx)
 	host := env.ServerHost
 	port := env.ServerPort
-	opts := []grpc.ServerOption{}
+	opts := append(tracing.ServerOptions(), m.leaderOnlyOptions()...)
 	if mz, ok := env.MaxReceiveSize.AsInt64(); ok {
 		opts = append(opts, grpc.MaxRecvMsgSize(int(mz)))
 	}
 
 	grpcHandler := grpc.NewServer(opts...)
-	httpHandler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	httpHandler := http.NewServeMux()
+	httpHandler.Handle("/metrics", metrics.Handler(m.state))
+	httpHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Hello World from: %s\n", r.URL.Path)
-	}))
+	})
 	sc := &dhttp.ServerConfig{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
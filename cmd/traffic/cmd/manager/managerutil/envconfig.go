@@ -3,6 +3,7 @@ package managerutil
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -17,14 +18,31 @@ type Env struct {
 	SystemAHost string `env:"SYSTEMA_HOST,default=app.getambassador.io"`
 	SystemAPort string `env:"SYSTEMA_PORT,default=443"`
 
-	ManagerNamespace string            `env:"MANAGER_NAMESPACE,default="`
-	AgentRegistry    string            `env:"TELEPRESENCE_REGISTRY,default=docker.io/datawire"`
-	AgentImage       string            `env:"TELEPRESENCE_AGENT_IMAGE,default="`
-	AgentPort        int32             `env:"TELEPRESENCE_AGENT_PORT,default=9900"`
-	MaxReceiveSize   resource.Quantity `env:"TELEPRESENCE_MAX_RECEIVE_SIZE,default=4Mi"`
+	ManagerNamespace  string            `env:"MANAGER_NAMESPACE,default="`
+	ManagedNamespaces string            `env:"MANAGED_NAMESPACES,default="`
+	AgentRegistry     string            `env:"TELEPRESENCE_REGISTRY,default=docker.io/datawire"`
+	AgentImage        string            `env:"TELEPRESENCE_AGENT_IMAGE,default="`
+	AgentPort         int32             `env:"TELEPRESENCE_AGENT_PORT,default=9900"`
+	AgentMetricsPort  int32             `env:"TELEPRESENCE_AGENT_METRICS_PORT,default=0"`
+	MaxReceiveSize    resource.Quantity `env:"TELEPRESENCE_MAX_RECEIVE_SIZE,default=4Mi"`
+	OTLPEndpoint      string            `env:"TELEPRESENCE_OTLP_ENDPOINT,default="`
+	ClientAuth        bool              `env:"TELEPRESENCE_CLIENT_AUTH,default=false"`
+	PolicyConfigMap   string            `env:"TELEPRESENCE_POLICY_CONFIGMAP,default="`
+
+	InterceptMaxLifetime time.Duration `env:"TELEPRESENCE_INTERCEPT_MAX_LIFETIME,default=0s"`
+	InterceptIdleTimeout time.Duration `env:"TELEPRESENCE_INTERCEPT_IDLE_TIMEOUT,default=0s"`
+	HTTPSniffTimeout     time.Duration `env:"TELEPRESENCE_HTTP_SNIFF_TIMEOUT,default=0s"`
+
+	AuditLog              string `env:"TELEPRESENCE_AUDIT_LOG,default="`
+	AuditKubernetesEvents bool   `env:"TELEPRESENCE_AUDIT_KUBERNETES_EVENTS,default=false"`
 
 	PodCIDRStrategy string `env:"POD_CIDR_STRATEGY,default=auto"`
 	PodCIDRs        string `env:"POD_CIDRS,default="`
+
+	PodName        string `env:"POD_NAME,default="`
+	StateStore     string `env:"TELEPRESENCE_STATE_STORE,default=memory"`
+	StateConfigMap string `env:"TELEPRESENCE_STATE_CONFIGMAP,default=traffic-manager-state"`
+	LeaderElection bool   `env:"TELEPRESENCE_LEADER_ELECTION,default=false"`
 }
 
 type envKey struct{}
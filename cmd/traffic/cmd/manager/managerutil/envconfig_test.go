@@ -39,6 +39,8 @@ func TestEnvconfig(t *testing.T) {
 		AgentPort:       9900,
 		MaxReceiveSize:  resource.MustParse("4Mi"),
 		PodCIDRStrategy: "auto",
+		StateStore:      "memory",
+		StateConfigMap:  "traffic-manager-state",
 	}
 
 	testcases := map[string]struct {
@@ -57,6 +59,18 @@ func TestEnvconfig(t *testing.T) {
 				e.SystemAHost = "app.getambassador.io"
 			},
 		},
+		"high-availability": {
+			Input: map[string]string{
+				"POD_NAME":                     "traffic-manager-6d8f9c7b5-x2x9k",
+				"TELEPRESENCE_STATE_STORE":     "configmap",
+				"TELEPRESENCE_LEADER_ELECTION": "true",
+			},
+			Output: func(e *managerutil.Env) {
+				e.PodName = "traffic-manager-6d8f9c7b5-x2x9k"
+				e.StateStore = "configmap"
+				e.LeaderElection = true
+			},
+		},
 	}
 
 	for tcName, tc := range testcases {
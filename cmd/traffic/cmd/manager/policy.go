@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+// watchPolicy keeps the policy of the state up-to-date with the policy ConfigMap, and moves the
+// intercepts that no longer comply with it to the POLICY_DENIED disposition each time it changes.
+func (m *Manager) watchPolicy(ctx context.Context) error {
+	env := managerutil.GetEnv(ctx)
+	policy.Watch(ctx, managerutil.GetK8sClientset(ctx), env.PolicyConfigMap, env.ManagerNamespace, func(p *policy.Policy) {
+		if p.RestrictsUsers() && !env.ClientAuth {
+			dlog.Warn(ctx, "Client authentication is disabled, so the per-user rules of the policy rely on "+
+				"the user names that clients report, which they can change")
+		}
+		m.state.SetPolicy(p)
+		m.state.EnforcePolicy(ctx, func(spec *rpc.InterceptSpec) string {
+			return m.checkExistingGlobalIntercept(ctx, p, spec)
+		})
+	})
+	return nil
+}
+
+// checkExistingGlobalIntercept is like checkGlobalIntercept, but for an intercept that already
+// exists. The kind of its workload is resolved again, because it's only resolved when the intercept
+// is created if the policy or client authentication needs it. The kind in the spec is used when
+// the workload has no traffic-agent at the moment, e.g. because its pod is being replaced.
+func (m *Manager) checkExistingGlobalIntercept(ctx context.Context, p *policy.Policy, spec *rpc.InterceptSpec) string {
+	spec = proto.Clone(spec).(*rpc.InterceptSpec)
+	if kind, err := resolveWorkloadKind(ctx, m.state.GetAgentsByName(spec.Agent, spec.Namespace), spec.Agent, spec.Namespace); err == nil {
+		spec.WorkloadKind = kind
+	} else {
+		dlog.Debugf(ctx, "unable to determine the kind of workload %s.%s: %v", spec.Agent, spec.Namespace, err)
+	}
+	return checkGlobalIntercept(ctx, p, spec)
+}
+
+// checkGlobalIntercept returns a message that explains why the given global intercept spec may not be
+// used on its workload, or an empty string if it may. The WorkloadKind of the spec must have been
+// resolved by the traffic-manager. The intercept is denied when the labels of the workload can't be
+// determined.
+func checkGlobalIntercept(ctx context.Context, p *policy.Policy, spec *rpc.InterceptSpec) string {
+	labels, err := workloadLabels(ctx, spec.WorkloadKind, spec.Agent, spec.Namespace)
+	if err != nil {
+		dlog.Errorf(ctx, "unable to get the labels of %s %s.%s: %v", spec.WorkloadKind, spec.Agent, spec.Namespace, err)
+		return fmt.Sprintf("unable to verify that %s.%s isn't a production workload", spec.Agent, spec.Namespace)
+	}
+	return p.CheckGlobalIntercept(spec, labels)
+}
+
+// workloadLabels returns the labels of the workload with the given kind, name, and namespace.
+func workloadLabels(ctx context.Context, kind, name, namespace string) (map[string]string, error) {
+	clientset := managerutil.GetK8sClientset(ctx)
+	apps := clientset.AppsV1()
+	var meta metav1.Object
+	var err error
+	switch kind {
+	case "ReplicaSet":
+		meta, err = apps.ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "StatefulSet":
+		meta, err = apps.StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "DaemonSet":
+		meta, err = apps.DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Pod":
+		meta, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Deployment":
+		meta, err = apps.Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Rollout":
+		// Argo Rollouts aren't known to the clientset
+		var data []byte
+		data, err = clientset.Discovery().RESTClient().Get().
+			AbsPath("/apis/argoproj.io/v1alpha1/namespaces", namespace, "rollouts", name).
+			DoRaw(ctx)
+		if err == nil {
+			om := &metav1.PartialObjectMetadata{}
+			if err = json.Unmarshal(data, om); err == nil {
+				meta = om
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown kind of workload %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta.GetLabels(), nil
+}
@@ -3,6 +3,7 @@ package manager
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"net"
@@ -12,9 +13,11 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
@@ -23,9 +26,12 @@ import (
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/rpc/v2/systema"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/cluster"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/metrics"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/policy"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/state"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
@@ -43,6 +49,11 @@ type Manager struct {
 	state       *state.State
 	systema     *systemaPool
 	clusterInfo cluster.Info
+	tokens      tokenReviews
+	agentTokens agentTokens
+
+	// leading is 1 while this replica leads, and is accessed atomically
+	leading int32
 
 	rpc.UnsafeManagerServer
 }
@@ -133,6 +144,16 @@ func (m *Manager) ArriveAsClient(ctx context.Context, client *rpc.ClientInfo) (*
 		return nil, status.Errorf(codes.InvalidArgument, val)
 	}
 
+	client.KubernetesUser = nil
+	if managerutil.GetEnv(ctx).ClientAuth {
+		user, err := m.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		client.KubernetesUser = user
+		dlog.Debugf(ctx, "Client %s authenticated as %s", client.Name, user.Username)
+	}
+
 	sessionID := m.state.AddClient(client, m.clock.Now())
 
 	return &rpc.SessionInfo{
@@ -148,16 +169,30 @@ func (m *Manager) ArriveAsAgent(ctx context.Context, agent *rpc.AgentInfo) (*rpc
 		return nil, status.Errorf(codes.InvalidArgument, val)
 	}
 
+	if managerutil.GetEnv(ctx).ClientAuth {
+		// The agent learns the client sessions of the intercepts of its workload, so only a
+		// traffic-agent that runs in a pod of that workload is accepted.
+		if err := m.authenticateAgent(ctx, agent); err != nil {
+			return nil, err
+		}
+	}
+
 	sessionID := m.state.AddAgent(agent, m.clock.Now())
+	if managerutil.GetEnv(ctx).ClientAuth {
+		m.agentTokens.set(sessionID, sha256.Sum256([]byte(bearerToken(ctx))), func(id string) bool { return m.state.GetAgent(id) != nil })
+	}
 
 	return &rpc.SessionInfo{SessionId: sessionID}, nil
 }
 
 // Remain indicates that the session is still valid.
-func (m *Manager) Remain(_ context.Context, req *rpc.RemainRequest) (*empty.Empty, error) {
+func (m *Manager) Remain(ctx context.Context, req *rpc.RemainRequest) (*empty.Empty, error) {
 	// ctx = WithSessionInfo(ctx, req.GetSession())
 	// dlog.Debug(ctx, "Remain called")
 
+	if _, err := m.authenticateClient(ctx, req.GetSession().GetSessionId()); err != nil {
+		return nil, err
+	}
 	if ok := m.state.MarkSession(req, m.clock.Now()); !ok {
 		return nil, status.Errorf(codes.NotFound, "Session %q not found", req.GetSession().GetSessionId())
 	}
@@ -170,6 +205,9 @@ func (m *Manager) Depart(ctx context.Context, session *rpc.SessionInfo) (*empty.
 	ctx = managerutil.WithSessionInfo(ctx, session)
 	dlog.Debug(ctx, "Depart called")
 
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return nil, err
+	}
 	m.state.RemoveSession(ctx, session.GetSessionId())
 
 	return &empty.Empty{}, nil
@@ -181,6 +219,9 @@ func (m *Manager) WatchAgents(session *rpc.SessionInfo, stream rpc.Manager_Watch
 
 	dlog.Debug(ctx, "WatchAgents called")
 
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return err
+	}
 	snapshotCh := m.state.WatchAgents(ctx, nil)
 	sessionDone, err := m.state.SessionDone(session.GetSessionId())
 	if err != nil {
@@ -220,6 +261,9 @@ func (m *Manager) WatchIntercepts(session *rpc.SessionInfo, stream rpc.Manager_W
 
 	dlog.Debug(ctx, "WatchIntercepts called")
 
+	if _, err := m.authenticateClient(ctx, sessionID); err != nil {
+		return err
+	}
 	var filter func(id string, info *rpc.InterceptInfo) bool
 	if sessionID == "" {
 		// No sessonID; watch everything
@@ -238,6 +282,7 @@ func (m *Manager) WatchIntercepts(session *rpc.SessionInfo, stream rpc.Manager_W
 			switch info.Disposition {
 			case rpc.InterceptDispositionType_WAITING,
 				rpc.InterceptDispositionType_ACTIVE,
+				rpc.InterceptDispositionType_UNHEALTHY,
 				rpc.InterceptDispositionType_AGENT_ERROR:
 				// agent-owned state: include the intercept
 				dlog.Debugf(ctx, "Intercept %s.%s valid. Disposition: %s", info.Spec.Agent, info.Spec.Namespace, info.Disposition)
@@ -308,12 +353,49 @@ func (m *Manager) CreateIntercept(ctx context.Context, ciReq *rpc.CreateIntercep
 	if m.state.GetClient(sessionID) == nil {
 		return nil, status.Errorf(codes.NotFound, "Client session %q not found", sessionID)
 	}
+	user, err := m.authenticateClient(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
 
 	if val := validateIntercept(spec); val != "" {
 		return nil, status.Errorf(codes.InvalidArgument, val)
 	}
 
-	return m.state.AddIntercept(sessionID, apiKey, spec)
+	env := managerutil.GetEnv(ctx)
+	p := m.state.GetPolicy()
+	restricted := p.RestrictsGlobalIntercepts() && policy.IsGlobal(spec)
+	if env.ClientAuth || restricted {
+		// The kind of workload that the client reports can't be trusted when it decides what the
+		// client is allowed to do.
+		kind, err := resolveWorkloadKind(ctx, m.state.GetAgentsByName(spec.Agent, spec.Namespace), spec.Agent, spec.Namespace)
+		if err != nil {
+			if env.ClientAuth {
+				return nil, status.Errorf(codes.PermissionDenied, "unable to determine the kind of workload %s.%s: %v", spec.Agent, spec.Namespace, err)
+			}
+			dlog.Errorf(ctx, "unable to determine the kind of workload %s.%s: %v", spec.Agent, spec.Namespace, err)
+		}
+		spec.WorkloadKind = kind
+	}
+	if env.ClientAuth {
+		if err := authorizeIntercept(ctx, user, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.MaxLifetime == nil && env.InterceptMaxLifetime > 0 {
+		spec.MaxLifetime = durationpb.New(env.InterceptMaxLifetime)
+	}
+	if spec.IdleTimeout == nil && env.InterceptIdleTimeout > 0 {
+		spec.IdleTimeout = durationpb.New(env.InterceptIdleTimeout)
+	}
+
+	if restricted {
+		if reason := checkGlobalIntercept(ctx, p, spec); reason != "" {
+			return m.state.AddDeniedIntercept(sessionID, apiKey, spec, m.clock.Now(), reason)
+		}
+	}
+	return m.state.AddIntercept(sessionID, apiKey, spec, m.clock.Now())
 }
 
 func (m *Manager) makeinterceptID(ctx context.Context, sessionID string, name string) (string, error) {
@@ -343,6 +425,10 @@ func (m *Manager) UpdateIntercept(ctx context.Context, req *rpc.UpdateInterceptR
 
 	dlog.Debugf(ctx, "UpdateIntercept called: %s", interceptID)
 
+	if err := m.authorizeInterceptChange(ctx, req.GetSession().GetSessionId(), interceptID); err != nil {
+		return nil, err
+	}
+
 	switch action := req.PreviewDomainAction.(type) {
 	case *rpc.UpdateInterceptRequest_AddPreviewDomain:
 		var domain string
@@ -439,6 +525,38 @@ func (m *Manager) UpdateIntercept(ctx context.Context, req *rpc.UpdateInterceptR
 	}
 }
 
+// ReportInterceptHealth lets a client report the health of the local process that handles one of
+// its intercepts. An ACTIVE intercept becomes UNHEALTHY when the process is unhealthy, and ACTIVE
+// again when it recovers. Intercepts in other dispositions are left as they are.
+func (m *Manager) ReportInterceptHealth(ctx context.Context, req *rpc.InterceptHealthRequest) (*rpc.InterceptInfo, error) {
+	ctx = managerutil.WithSessionInfo(ctx, req.GetSession())
+	interceptID, err := m.makeinterceptID(ctx, req.GetSession().GetSessionId(), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	dlog.Debugf(ctx, "ReportInterceptHealth called: %s healthy=%t", req.Name, req.Healthy)
+
+	if _, err := m.authenticateClient(ctx, req.GetSession().GetSessionId()); err != nil {
+		return nil, err
+	}
+
+	intercept := m.state.UpdateIntercept(interceptID, func(intercept *rpc.InterceptInfo) {
+		switch {
+		case !req.Healthy && intercept.Disposition == rpc.InterceptDispositionType_ACTIVE:
+			intercept.Disposition = rpc.InterceptDispositionType_UNHEALTHY
+			intercept.Message = req.Message
+		case req.Healthy && intercept.Disposition == rpc.InterceptDispositionType_UNHEALTHY:
+			intercept.Disposition = rpc.InterceptDispositionType_ACTIVE
+			intercept.Message = ""
+		}
+	})
+	if intercept == nil {
+		return nil, status.Errorf(codes.NotFound, "Intercept named %q not found", req.Name)
+	}
+	return intercept, nil
+}
+
 // RemoveIntercept lets a client remove an intercept.
 func (m *Manager) RemoveIntercept(ctx context.Context, riReq *rpc.RemoveInterceptRequest2) (*empty.Empty, error) {
 	ctx = managerutil.WithSessionInfo(ctx, riReq.GetSession())
@@ -450,6 +568,9 @@ func (m *Manager) RemoveIntercept(ctx context.Context, riReq *rpc.RemoveIntercep
 	if m.state.GetClient(sessionID) == nil {
 		return nil, status.Errorf(codes.NotFound, "Client session %q not found", sessionID)
 	}
+	if err := m.authorizeInterceptChange(ctx, sessionID, sessionID+":"+name); err != nil {
+		return nil, err
+	}
 
 	if !m.state.RemoveIntercept(sessionID + ":" + name) {
 		return nil, status.Errorf(codes.NotFound, "Intercept named %q not found", name)
@@ -464,6 +585,9 @@ func (m *Manager) GetIntercept(ctx context.Context, request *rpc.GetInterceptReq
 	if err != nil {
 		return nil, err
 	}
+	if _, err = m.authenticateClient(ctx, request.GetSession().GetSessionId()); err != nil {
+		return nil, err
+	}
 	if intercept, ok := m.state.GetIntercept(interceptID); ok {
 		return intercept, nil
 	} else {
@@ -471,6 +595,113 @@ func (m *Manager) GetIntercept(ctx context.Context, request *rpc.GetInterceptReq
 	}
 }
 
+// ReportInterceptEvents lets an agent report the traffic that it routes to intercepts. An agent
+// that names its session may only report the traffic of the intercepts of its own workload.
+func (m *Manager) ReportInterceptEvents(stream rpc.Manager_ReportInterceptEventsServer) error {
+	ctx := stream.Context()
+	sessionID, agent, err := m.authenticateAgentStream(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return stream.SendAndClose(&empty.Empty{})
+			}
+			return nil
+		}
+		if agent != nil {
+			ii, ok := m.state.GetIntercept(event.InterceptId)
+			if !ok || ii.Spec.Agent != agent.Name || ii.Spec.Namespace != agent.Namespace {
+				return status.Errorf(codes.PermissionDenied, "agent session %s doesn't own intercept %q", sessionID, event.InterceptId)
+			}
+		}
+		m.state.MarkInterceptActivity(event.InterceptId, m.clock.Now())
+		m.state.PostInterceptEvent(event)
+	}
+}
+
+// WatchInterceptEvents lets a client watch the traffic that is routed to one of its intercepts.
+// The stream ends when the intercept is removed.
+func (m *Manager) WatchInterceptEvents(request *rpc.InterceptEventsRequest, stream rpc.Manager_WatchInterceptEventsServer) error {
+	ctx := managerutil.WithSessionInfo(stream.Context(), request.GetSession())
+	interceptID, err := m.makeinterceptID(ctx, request.GetSession().GetSessionId(), request.GetName())
+	if err != nil {
+		return err
+	}
+	if _, err = m.authenticateClient(ctx, request.GetSession().GetSessionId()); err != nil {
+		return err
+	}
+	if _, ok := m.state.GetIntercept(interceptID); !ok {
+		return status.Errorf(codes.NotFound, "Intercept named %q not found", request.Name)
+	}
+	dlog.Debugf(ctx, "WatchInterceptEvents called: %s", request.Name)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := m.state.WatchInterceptEvents(ctx, interceptID)
+	snapshots := m.state.WatchIntercepts(ctx, func(id string, _ *rpc.InterceptInfo) bool {
+		return id == interceptID
+	})
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case snapshot, ok := <-snapshots:
+			if !ok {
+				return nil
+			}
+			if _, ok := snapshot.State[interceptID]; !ok {
+				return nil
+			}
+		case event := <-events:
+			if err := stream.Send(event); err != nil {
+				dlog.Errorf(ctx, "WatchInterceptEvents.Send() failed: %v", err)
+				return nil
+			}
+		}
+	}
+}
+
+// WatchNotifications lets a client receive the notifications that concern it, such as warnings
+// about intercepts that are about to expire. The stream ends when the client session ends.
+func (m *Manager) WatchNotifications(session *rpc.SessionInfo, stream rpc.Manager_WatchNotificationsServer) error {
+	ctx := managerutil.WithSessionInfo(stream.Context(), session)
+	sessionID := session.GetSessionId()
+	if m.state.GetClient(sessionID) == nil {
+		return status.Errorf(codes.NotFound, "Client session %q not found", sessionID)
+	}
+	if _, err := m.authenticateClient(ctx, sessionID); err != nil {
+		return err
+	}
+	sessionDone, err := m.state.SessionDone(sessionID)
+	if err != nil {
+		return err
+	}
+	dlog.Debug(ctx, "WatchNotifications called")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	notifications := m.state.WatchNotifications(ctx, sessionID)
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case <-sessionDone:
+			return nil
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(notification); err != nil {
+				dlog.Errorf(ctx, "WatchNotifications.Send() failed: %v", err)
+				return nil
+			}
+		}
+	}
+}
+
 // ReviewIntercept lets an agent approve or reject an intercept.
 func (m *Manager) ReviewIntercept(ctx context.Context, rIReq *rpc.ReviewInterceptRequest) (*empty.Empty, error) {
 	ctx = managerutil.WithSessionInfo(ctx, rIReq.GetSession())
@@ -483,6 +714,9 @@ func (m *Manager) ReviewIntercept(ctx context.Context, rIReq *rpc.ReviewIntercep
 	if agent == nil {
 		return nil, status.Errorf(codes.NotFound, "Agent session %q not found", sessionID)
 	}
+	if _, err := m.authenticateClient(ctx, sessionID); err != nil {
+		return nil, err
+	}
 
 	intercept := m.state.UpdateIntercept(ceptID, func(intercept *rpc.InterceptInfo) {
 		// Sanity check: The reviewing agent must be an agent for the intercept.
@@ -510,11 +744,14 @@ func (m *Manager) ReviewIntercept(ctx context.Context, rIReq *rpc.ReviewIntercep
 
 func (m *Manager) ClientTunnel(server rpc.Manager_ClientTunnelServer) error {
 	ctx := server.Context()
-	muxTunnel := connpool.NewMuxTunnel(server)
+	muxTunnel := connpool.NewMuxTunnel(metrics.CountingTunnel(metrics.TunnelClient, server))
 	sessionInfo, err := readTunnelSessionID(ctx, muxTunnel)
 	if err != nil {
 		return err
 	}
+	if _, err = m.authenticateClient(ctx, sessionInfo.GetSessionId()); err != nil {
+		return err
+	}
 	_, err = muxTunnel.ReadPeerVersion(ctx)
 	if err != nil {
 		return status.Errorf(codes.FailedPrecondition, "failed to read client tunnel version: %v", err)
@@ -527,7 +764,7 @@ func (m *Manager) ClientTunnel(server rpc.Manager_ClientTunnelServer) error {
 
 func (m *Manager) AgentTunnel(server rpc.Manager_AgentTunnelServer) error {
 	ctx := server.Context()
-	muxTunnel := connpool.NewMuxTunnel(server)
+	muxTunnel := connpool.NewMuxTunnel(metrics.CountingTunnel(metrics.TunnelAgent, server))
 	agentSessionInfo, err := readTunnelSessionID(ctx, muxTunnel)
 	if err != nil {
 		return err
@@ -536,6 +773,9 @@ func (m *Manager) AgentTunnel(server rpc.Manager_AgentTunnelServer) error {
 	if err != nil {
 		return err
 	}
+	if _, err = m.authenticateClient(ctx, agentSessionInfo.GetSessionId()); err != nil {
+		return err
+	}
 	_, err = muxTunnel.ReadPeerVersion(ctx)
 	if err != nil {
 		return status.Errorf(codes.FailedPrecondition, "failed to read agent tunnel version: %v", err)
@@ -567,12 +807,20 @@ func (m *Manager) Tunnel(server rpc.Manager_TunnelServer) error {
 	if err != nil {
 		return status.Errorf(codes.FailedPrecondition, "failed to connect stream: %v", err)
 	}
-	return m.state.Tunnel(ctx, stream)
+	if _, err = m.authenticateClient(ctx, stream.SessionID()); err != nil {
+		return err
+	}
+	metrics.TunnelStreams.Inc()
+	defer metrics.TunnelStreams.Dec()
+	return m.state.Tunnel(ctx, metrics.CountingTunnelStream(stream))
 }
 
 func (m *Manager) WatchDial(session *rpc.SessionInfo, stream rpc.Manager_WatchDialServer) error {
 	ctx := managerutil.WithSessionInfo(stream.Context(), session)
 	dlog.Debugf(ctx, "WatchDial called")
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return err
+	}
 	lrCh := m.state.WatchDial(session.SessionId)
 	for {
 		select {
@@ -594,7 +842,15 @@ func (m *Manager) LookupHost(ctx context.Context, request *rpc.LookupHostRequest
 	ctx = managerutil.WithSessionInfo(ctx, request.GetSession())
 	dlog.Debugf(ctx, "LookupHost called %s", request.Host)
 	sessionID := request.GetSession().GetSessionId()
+	if _, err := m.authenticateClient(ctx, sessionID); err != nil {
+		return nil, err
+	}
 
+	start := time.Now()
+	resolver := metrics.ResolverAgents
+	defer func() {
+		metrics.LookupHostDuration.WithLabelValues(resolver).Observe(time.Since(start).Seconds())
+	}()
 	ips, count, err := m.state.AgentsLookup(ctx, sessionID, request)
 	if err != nil {
 		dlog.Errorf(ctx, "AgentLookup: %v", err)
@@ -607,6 +863,7 @@ func (m *Manager) LookupHost(ctx context.Context, request *rpc.LookupHostRequest
 	}
 
 	if count == 0 {
+		resolver = metrics.ResolverManager
 		if addrs, err := net.DefaultResolver.LookupHost(ctx, request.Host); err != nil {
 			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
 				dlog.Debugf(ctx, "LookupHost on traffic-manager: %s -> NOT FOUND", request.Host)
@@ -630,6 +887,10 @@ func (m *Manager) LookupHost(ctx context.Context, request *rpc.LookupHostRequest
 func (m *Manager) AgentLookupHostResponse(ctx context.Context, response *rpc.LookupHostAgentResponse) (*empty.Empty, error) {
 	ctx = managerutil.WithSessionInfo(ctx, response.GetSession())
 	dlog.Debugf(ctx, "AgentLookupHostResponse called %s -> %s", response.Request.Host, iputil.IPsFromBytesSlice(response.Response.Ips))
+	if _, err := m.authenticateClient(ctx, response.GetSession().GetSessionId()); err != nil {
+		return nil, err
+	}
+	// The response only reaches a lookup that was sent to the agent of the session
 	m.state.PostLookupResponse(response)
 	return &empty.Empty{}, nil
 }
@@ -637,6 +898,9 @@ func (m *Manager) AgentLookupHostResponse(ctx context.Context, response *rpc.Loo
 func (m *Manager) WatchLookupHost(session *rpc.SessionInfo, stream rpc.Manager_WatchLookupHostServer) error {
 	ctx := managerutil.WithSessionInfo(stream.Context(), session)
 	dlog.Debugf(ctx, "WatchLookupHost called")
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return err
+	}
 	lrCh := m.state.WatchLookupHost(session.SessionId)
 	for {
 		select {
@@ -654,6 +918,101 @@ func (m *Manager) WatchLookupHost(session *rpc.SessionInfo, stream rpc.Manager_W
 	}
 }
 
+// reverseTTL is the TTL, in seconds, of the PTR records that are created from the manager's index of
+// pod and service IPs. It's kept short because pod IPs are frequently reused.
+const reverseTTL = 30
+
+func (m *Manager) LookupDNS(ctx context.Context, request *rpc.DNSRequest) (*rpc.DNSResponse, error) {
+	ctx = managerutil.WithSessionInfo(ctx, request.GetSession())
+	qType := dns.Type(request.Type)
+	dlog.Debugf(ctx, "LookupDNS called %s %s", qType, request.Name)
+	sessionID := request.GetSession().GetSessionId()
+	if _, err := m.authenticateClient(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resolver := metrics.ResolverIndex
+	defer func() {
+		metrics.LookupDNSDuration.WithLabelValues(resolver, metrics.QueryType(request.Type)).Observe(time.Since(start).Seconds())
+	}()
+	if uint16(request.Type) == dns.TypePTR {
+		// Reverse lookups of pod and service IPs are answered using the manager's own index.
+		if ip := dnsproxy.ReverseIP(request.Name); ip != nil {
+			if name := m.clusterInfo.LookupAddr(ip); name != "" {
+				dlog.Debugf(ctx, "LookupDNS on traffic-manager index: %s %s -> %s", qType, request.Name, name)
+				rrs := []dns.RR{&dns.PTR{
+					Hdr: dns.RR_Header{Name: dns.Fqdn(request.Name), Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: reverseTTL},
+					Ptr: name,
+				}}
+				bss, err := dnsproxy.PackRRs(rrs)
+				if err != nil {
+					return nil, err
+				}
+				return &rpc.DNSResponse{Rcode: dns.RcodeSuccess, Rrs: bss}, nil
+			}
+		}
+	}
+
+	resolver = metrics.ResolverAgents
+	response, count, err := m.state.AgentsLookupDNS(ctx, sessionID, request)
+	if err != nil {
+		dlog.Errorf(ctx, "AgentsLookupDNS: %v", err)
+	} else if count > 0 {
+		dlog.Debugf(ctx, "LookupDNS on agents: %s %s -> %s, %d RRs", qType, request.Name, dns.RcodeToString[int(response.Rcode)], len(response.Rrs))
+	}
+
+	if count == 0 {
+		resolver = metrics.ResolverManager
+		rrs, rcode, err := dnsproxy.Lookup(ctx, uint16(request.Type), request.Name)
+		if err != nil {
+			dlog.Errorf(ctx, "LookupDNS on traffic-manager: %v", err)
+		} else {
+			dlog.Debugf(ctx, "LookupDNS on traffic-manager: %s %s -> %s, %d RRs", qType, request.Name, dns.RcodeToString[rcode], len(rrs))
+		}
+		response = &rpc.DNSResponse{Rcode: int32(rcode)}
+		if response.Rrs, err = dnsproxy.PackRRs(rrs); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func (m *Manager) AgentLookupDNSResponse(ctx context.Context, response *rpc.DNSAgentResponse) (*empty.Empty, error) {
+	ctx = managerutil.WithSessionInfo(ctx, response.GetSession())
+	dlog.Debugf(ctx, "AgentLookupDNSResponse called %s %s -> %d RRs",
+		dns.Type(response.Request.Type), response.Request.Name, len(response.GetResponse().GetRrs()))
+	if _, err := m.authenticateClient(ctx, response.GetSession().GetSessionId()); err != nil {
+		return nil, err
+	}
+	// The response only reaches a lookup that was sent to the agent of the session
+	m.state.PostDNSResponse(response)
+	return &empty.Empty{}, nil
+}
+
+func (m *Manager) WatchLookupDNS(session *rpc.SessionInfo, stream rpc.Manager_WatchLookupDNSServer) error {
+	ctx := managerutil.WithSessionInfo(stream.Context(), session)
+	dlog.Debugf(ctx, "WatchLookupDNS called")
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return err
+	}
+	drCh := m.state.WatchLookupDNS(session.SessionId)
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case dr := <-drCh:
+			if dr == nil {
+				return nil
+			}
+			if err := stream.Send(dr); err != nil {
+				dlog.Errorf(ctx, "WatchLookupDNS.Send() failed: %v", err)
+				return nil
+			}
+		}
+	}
+}
+
 // GetLogs acquires the logs for the traffic-manager and/or traffic-agents specified by the
 // GetLogsRequest and returns them to the caller
 func (m *Manager) GetLogs(ctx context.Context, request *rpc.GetLogsRequest) (*rpc.LogsResponse, error) {
@@ -776,10 +1135,15 @@ func (m *Manager) WatchLogLevel(_ *empty.Empty, stream rpc.Manager_WatchLogLevel
 func (m *Manager) WatchClusterInfo(session *rpc.SessionInfo, stream rpc.Manager_WatchClusterInfoServer) error {
 	ctx := managerutil.WithSessionInfo(stream.Context(), session)
 	dlog.Debugf(ctx, "WatchClusterInfo called")
+	if _, err := m.authenticateClient(ctx, session.GetSessionId()); err != nil {
+		return err
+	}
 	return m.clusterInfo.Watch(ctx, stream)
 }
 
-// expire removes stale sessions.
+// expire removes stale sessions and the intercepts that have outlived their limits.
 func (m *Manager) expire(ctx context.Context) {
-	m.state.ExpireSessions(ctx, m.clock.Now().Add(-15*time.Second))
+	now := m.clock.Now()
+	m.state.ExpireSessions(ctx, now.Add(-15*time.Second))
+	m.state.ExpireIntercepts(ctx, now)
 }
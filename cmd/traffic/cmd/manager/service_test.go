@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/test/bufconn"
 	"google.golang.org/protobuf/proto"
@@ -22,6 +27,7 @@ import (
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/metrics"
 	testdata "github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/internal/test"
 	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
 	"github.com/telepresenceio/telepresence/v2/pkg/version"
@@ -234,6 +240,47 @@ func TestConnect(t *testing.T) {
 	a.Equal(rpc.InterceptDispositionType_ACTIVE, hSnapI.Intercepts[0].Disposition)
 	t.Logf("=> agent[hello] intercept snapshot = %s", dumps(hSnapI))
 
+	// Alice reports that the local process is unhealthy, which makes the intercept UNHEALTHY
+
+	unhealthy, err := client.ReportInterceptHealth(ctx, &rpc.InterceptHealthRequest{
+		Session: aliceSess2,
+		Name:    spec.Name,
+		Healthy: false,
+		Message: "connection refused",
+	})
+	a.NoError(err)
+	a.Equal(rpc.InterceptDispositionType_UNHEALTHY, unhealthy.Disposition)
+
+	aSnapI, err = aliceWI.Recv()
+	a.NoError(err)
+	a.Len(aSnapI.Intercepts, 1)
+	a.Equal(rpc.InterceptDispositionType_UNHEALTHY, aSnapI.Intercepts[0].Disposition)
+	a.Equal("connection refused", aSnapI.Intercepts[0].Message)
+
+	hSnapI, err = helloWI.Recv()
+	a.NoError(err)
+	a.Len(hSnapI.Intercepts, 1)
+	a.Equal(rpc.InterceptDispositionType_UNHEALTHY, hSnapI.Intercepts[0].Disposition)
+
+	// And that it recovered
+
+	healthy, err := client.ReportInterceptHealth(ctx, &rpc.InterceptHealthRequest{
+		Session: aliceSess2,
+		Name:    spec.Name,
+		Healthy: true,
+	})
+	a.NoError(err)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, healthy.Disposition)
+
+	aSnapI, err = aliceWI.Recv()
+	a.NoError(err)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, aSnapI.Intercepts[0].Disposition)
+	a.Empty(aSnapI.Intercepts[0].Message)
+
+	hSnapI, err = helloWI.Recv()
+	a.NoError(err)
+	a.Equal(rpc.InterceptDispositionType_ACTIVE, hSnapI.Intercepts[0].Disposition)
+
 	// Creating a duplicate intercept yields an error
 
 	second, err := client.CreateIntercept(ctx, &rpc.CreateInterceptRequest{
@@ -287,14 +334,14 @@ func TestConnect(t *testing.T) {
 }
 
 func getTestClientConn(t *testing.T) *grpc.ClientConn {
-	const bufsize = 64 * 1024
-	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, true))
-
-	lis := bufconn.Listen(bufsize)
-	bufDialer := func(context.Context, string) (net.Conn, error) {
-		return lis.Dial()
-	}
+	return getTestClientConnWithEnv(t, newTestK8sClient(), &managerutil.Env{
+		MaxReceiveSize:  resource.Quantity{},
+		PodCIDRStrategy: "environment",
+		PodCIDRs:        "192.168.0.0/16",
+	})
+}
 
+func newTestK8sClient() *fake.Clientset {
 	fakeClient := fake.NewSimpleClientset(&corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "default",
@@ -303,12 +350,20 @@ func getTestClientConn(t *testing.T) *grpc.ClientConn {
 	fakeClient.Discovery().(*fakeDiscovery.FakeDiscovery).FakedServerVersion = &k8sVersion.Info{
 		GitVersion: "v1.17.0",
 	}
+	return fakeClient
+}
+
+func getTestClientConnWithEnv(t *testing.T, fakeClient *fake.Clientset, env *managerutil.Env) *grpc.ClientConn {
+	const bufsize = 64 * 1024
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, true))
+
+	lis := bufconn.Listen(bufsize)
+	bufDialer := func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}
+
 	ctx = managerutil.WithK8SClientset(ctx, fakeClient)
-	ctx = managerutil.WithEnv(ctx, &managerutil.Env{
-		MaxReceiveSize:  resource.Quantity{},
-		PodCIDRStrategy: "environment",
-		PodCIDRs:        "192.168.0.0/16",
-	})
+	ctx = managerutil.WithEnv(ctx, env)
 
 	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithInsecure())
 	if err != nil {
@@ -335,3 +390,36 @@ func getTestClientConn(t *testing.T) *grpc.ClientConn {
 
 	return conn
 }
+
+func TestLookupDNS_Metrics(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	fakeClient := newTestK8sClient()
+	_, err := fakeClient.CoreV1().Services("default").Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "echo", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.20"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	conn := getTestClientConnWithEnv(t, fakeClient, &managerutil.Env{
+		MaxReceiveSize:  resource.Quantity{},
+		PodCIDRStrategy: "environment",
+		PodCIDRs:        "192.168.0.0/16",
+	})
+	defer conn.Close()
+	client := rpc.NewManagerClient(conn)
+	session, err := client.ArriveAsClient(ctx, testdata.GetTestClients(t)["alice"])
+	require.NoError(t, err)
+
+	sampleCount := func() uint64 {
+		m := &dto.Metric{}
+		require.NoError(t, metrics.LookupDNSDuration.WithLabelValues(metrics.ResolverIndex, "PTR").(prometheus.Histogram).Write(m))
+		return m.GetHistogram().GetSampleCount()
+	}
+	before := sampleCount()
+
+	// A reverse lookup of a service IP is answered by the traffic-manager's index
+	require.Eventually(t, func() bool {
+		r, err := client.LookupDNS(ctx, &rpc.DNSRequest{Session: session, Name: "20.0.96.10.in-addr.arpa.", Type: uint32(dns.TypePTR)})
+		return err == nil && len(r.Rrs) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, before+1, sampleCount())
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/cmd/traffic/cmd/manager/managerutil"
+)
+
+// resolveWorkloadKind returns the kind of the workload with the given name and namespace. The kind
+// is determined from the controller of the pod of one of the given traffic-agents of the workload,
+// so that the kind that a client claims in its intercept spec is never trusted. An error is returned
+// when no agent has arrived for the workload, or when the kind can't be determined.
+func resolveWorkloadKind(ctx context.Context, agents map[string]*rpc.AgentInfo, name, namespace string) (string, error) {
+	if len(agents) == 0 {
+		return "", fmt.Errorf("no traffic-agent has arrived for %s.%s", name, namespace)
+	}
+	var err error
+	for _, agent := range agents {
+		var kind string
+		if kind, err = podWorkloadKind(ctx, agent.PodIp, name, namespace); err == nil {
+			return kind, nil
+		}
+	}
+	return "", err
+}
+
+// podWorkloadKind returns the kind of the workload with the given name that controls the pod with
+// the given IP.
+func podWorkloadKind(ctx context.Context, podIP, name, namespace string) (string, error) {
+	pod, err := findPod(ctx, podIP, namespace)
+	if err != nil {
+		return "", err
+	}
+	return workloadKindOf(ctx, pod, name)
+}
+
+// findPod returns the pod with the given IP in the given namespace.
+func findPod(ctx context.Context, podIP, namespace string) (*corev1.Pod, error) {
+	pods, err := managerutil.GetK8sClientset(ctx).CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.podIP", podIP).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Status.PodIP == podIP {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unable to find the pod with IP %s in namespace %s", podIP, namespace)
+}
+
+// workloadKindOf returns the kind of the workload with the given name that controls the given pod.
+func workloadKindOf(ctx context.Context, pod *corev1.Pod, name string) (string, error) {
+	namespace := pod.Namespace
+	var kind, ownerName string
+	ref := metav1.GetControllerOf(pod)
+	switch {
+	case ref == nil:
+		kind, ownerName = "Pod", pod.Name
+	case ref.Kind == "ReplicaSet":
+		rs, err := managerutil.GetK8sClientset(ctx).AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		kind, ownerName = "ReplicaSet", rs.Name
+		if rsRef := metav1.GetControllerOf(rs); rsRef != nil {
+			switch rsRef.Kind {
+			case "Deployment", "Rollout":
+				kind, ownerName = rsRef.Kind, rsRef.Name
+			default:
+				return "", fmt.Errorf("pod %s.%s is controlled by an unknown kind of workload %s", pod.Name, namespace, rsRef.Kind)
+			}
+		}
+	case ref.Kind == "StatefulSet", ref.Kind == "DaemonSet":
+		kind, ownerName = ref.Kind, ref.Name
+	default:
+		return "", fmt.Errorf("pod %s.%s is controlled by an unknown kind of workload %s", pod.Name, namespace, ref.Kind)
+	}
+	if ownerName != name {
+		return "", fmt.Errorf("pod %s.%s belongs to %s %s, not to %s", pod.Name, namespace, kind, ownerName, name)
+	}
+	return kind, nil
+}
@@ -78,7 +78,7 @@ func (s *notConnectedSuite) Test_DNSIncludes() {
 		require.NoError(err)
 		defer rootLog.Close()
 
-		scanFor := fmt.Sprintf(`LookupHost "%s"`, host)
+		scanFor := fmt.Sprintf(`LookupDNS "%s"`, host)
 		scn := bufio.NewScanner(rootLog)
 		for scn.Scan() {
 			if strings.Contains(scn.Text(), scanFor) {
@@ -87,5 +87,5 @@ func (s *notConnectedSuite) Test_DNSIncludes() {
 		}
 		retryCount++
 		return false
-	}, 10*time.Second, time.Second, "daemon.log does not contain expected LookupHost entry")
+	}, 10*time.Second, time.Second, "daemon.log does not contain expected LookupDNS entry")
 }
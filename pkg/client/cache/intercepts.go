@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"os"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+)
+
+const interceptsFile = "intercepts.json"
+
+// SavedIntercept is the request that created an intercept, along with the ID of the session with
+// the traffic-manager that the intercept belongs to.
+type SavedIntercept struct {
+	SessionID string                            `json:"session_id"`
+	Request   *connector.CreateInterceptRequest `json:"request"`
+}
+
+// SavedIntercepts are the saved intercepts of one traffic-manager, keyed by intercept name.
+type SavedIntercepts map[string]*SavedIntercept
+
+// SaveInterceptsToUserCache saves the provided intercepts, keyed by traffic-manager, to user cache
+// and returns an error if something goes wrong while marshalling or persisting.
+func SaveInterceptsToUserCache(ctx context.Context, intercepts map[string]SavedIntercepts) error {
+	if len(intercepts) == 0 {
+		return DeleteInterceptsFromUserCache(ctx)
+	}
+	return SaveToUserCache(ctx, intercepts, interceptsFile)
+}
+
+// LoadInterceptsFromUserCache gets the intercepts from cache. An empty map is returned if the
+// file does not exist. An error is returned if something goes wrong while loading or unmarshalling.
+func LoadInterceptsFromUserCache(ctx context.Context) (map[string]SavedIntercepts, error) {
+	var intercepts map[string]SavedIntercepts
+	err := LoadFromUserCache(ctx, &intercepts, interceptsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		return make(map[string]SavedIntercepts), nil
+	}
+	return intercepts, nil
+}
+
+// DeleteInterceptsFromUserCache removes the intercepts cache if exists or returns an error. An
+// attempt to remove a non existing cache is a no-op and the function returns nil.
+func DeleteInterceptsFromUserCache(ctx context.Context) error {
+	return DeleteFromUserCache(ctx, interceptsFile)
+}
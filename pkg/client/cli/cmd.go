@@ -33,6 +33,8 @@ recommended) which in turn may result in a password prompt.`
 // global options
 var dnsIP string
 var mappedNamespaces []string
+var restoreIntercepts bool
+var connectionName string
 var kubeFlags *pflag.FlagSet
 var kubeConfig *kates.ConfigFlags
 
@@ -108,6 +110,9 @@ func Command(ctx context.Context) *cobra.Command {
 		SilenceUsage:       true, // our FlagErrorFunc will handle it
 		DisableFlagParsing: true, // Bc of the legacyCommand parsing, see legacy_command.go
 	}
+	oc := &outputCollector{}
+	rootCmd.PersistentPreRunE = oc.preRun
+	rootCmd.PersistentPostRunE = oc.postRun
 
 	// Since we had to DisableFlagParsing so we can parse legacy commands, this
 	// doesn't do anything. Leaving this commented because I don't know if we'll
@@ -140,7 +145,7 @@ func Command(ctx context.Context) *cobra.Command {
 		},
 		{
 			Name:     "Traffic Commands",
-			Commands: []*cobra.Command{listCommand(), interceptCommand(ctx), leaveCommand(), previewCommand()},
+			Commands: []*cobra.Command{listCommand(), interceptCommand(ctx), runCommand(ctx), leaveCommand(), previewCommand(), replayCommand()},
 		},
 		{
 			Name:     "Debug Commands",
@@ -200,6 +205,11 @@ func initGlobalFlagGroups() {
 				"no-report", false,
 				"turn off anonymous crash reports and log submission on failure",
 			)
+			flags.StringVar(&outputFormat,
+				"output", outputDefault, ``+
+					`Set the output format, one of "default", "json", or "yaml". The json and yaml formats `+
+					`emit a versioned structure on stdout, also when the command fails`,
+			)
 			return flags
 		}(),
 	})
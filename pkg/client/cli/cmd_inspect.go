@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	grpcCodes "google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+func interceptInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:  "inspect [flags] <intercept_name>",
+		Args: cobra.ExactArgs(1),
+
+		Short: "Stream the connections and HTTP requests that are routed to an intercept",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspectIntercept(cmd.Context(), cmd.OutOrStdout(), strings.TrimSpace(args[0]))
+		},
+	}
+}
+
+func inspectIntercept(ctx context.Context, out io.Writer, name string) error {
+	return cliutil.WithStartedConnector(ctx, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+		stream, err := connectorClient.WatchInterceptEvents(ctx, &manager.InterceptEventsRequest{Name: name})
+		if err == nil {
+			fmt.Fprintf(out, "Inspecting intercept %s. Press Ctrl-C to stop.\n", name)
+		}
+		for err == nil {
+			var event *manager.InterceptEvent
+			if event, err = stream.Recv(); err == nil {
+				fmt.Fprintln(out, formatInterceptEvent(event))
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			fmt.Fprintf(out, "Intercept %s was removed\n", name)
+			return nil
+		case ctx.Err() != nil || grpcStatus.Code(err) == grpcCodes.Canceled:
+			return nil
+		case grpcStatus.Code(err) == grpcCodes.NotFound:
+			return errcat.User.Newf("intercept %s not found", name)
+		default:
+			return err
+		}
+	})
+}
+
+// formatInterceptEvent formats an event as one line of text.
+func formatInterceptEvent(ev *manager.InterceptEvent) string {
+	sb := strings.Builder{}
+	sb.WriteString(ev.Time.AsTime().Local().Format("15:04:05.000"))
+	sb.WriteByte(' ')
+	peer := "unknown"
+	if len(ev.PeerIp) > 0 {
+		peer = net.JoinHostPort(net.IP(ev.PeerIp).String(), strconv.Itoa(int(ev.PeerPort)))
+	}
+	fmt.Fprintf(&sb, "%-21s ", peer)
+	switch ev.Type {
+	case manager.InterceptEvent_CONNECTION_OPENED:
+		sb.WriteString("connection opened")
+	case manager.InterceptEvent_CONNECTION_CLOSED:
+		fmt.Fprintf(&sb, "connection closed after %s", ev.Duration.AsDuration().Round(time.Millisecond))
+		fmt.Fprintf(&sb, ", %d bytes in, %d bytes out", ev.BytesIn, ev.BytesOut)
+	case manager.InterceptEvent_HTTP_REQUEST:
+		fmt.Fprintf(&sb, "%s %s -> %d in %s", ev.HttpMethod, ev.HttpPath, ev.HttpStatus, ev.Duration.AsDuration().Round(time.Millisecond))
+		fmt.Fprintf(&sb, ", %d bytes in, %d bytes out", ev.BytesIn, ev.BytesOut)
+	}
+	return sb.String()
+}
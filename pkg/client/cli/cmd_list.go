@@ -11,6 +11,7 @@ import (
 
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/healthcheck"
 )
 
 type listInfo struct {
@@ -38,7 +39,8 @@ func listCommand() *cobra.Command {
 	flags.BoolVar(&s.debug, "debug", false, "include debugging information")
 	flags.StringVarP(&s.namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request")
 	flags.BoolVarP(&s.json, "json", "j", false, "output as json array")
-	return cmd
+	_ = flags.MarkDeprecated("json", `use "--output json" instead`)
+	return withStructuredOutput(cmd)
 }
 
 // list requests a list current intercepts from the daemon
@@ -63,9 +65,12 @@ func (s *listInfo) list(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	if isStructuredOutput() {
+		return printStructured(cmd, "Workloads", protoData(r))
+	}
 	stdout := cmd.OutOrStdout()
 	if len(r.Workloads) == 0 {
-		fmt.Fprintln(stdout, "No Workloads (Deployments, StatefulSets, or ReplicaSets)")
+		fmt.Fprintln(stdout, "No Workloads (Deployments, StatefulSets, ReplicaSets, DaemonSets, Rollouts, or Pods)")
 		return nil
 	}
 
@@ -118,6 +123,12 @@ func (s *listInfo) list(cmd *cobra.Command, _ []string) error {
 
 func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, debug bool) string {
 	msg := "intercepted"
+	switch ii.Disposition {
+	case manager.InterceptDispositionType_UNHEALTHY:
+		msg = "intercept paused, the workload serves the traffic until the local process is healthy again"
+	case manager.InterceptDispositionType_POLICY_DENIED:
+		msg = "intercept denied by policy: " + ii.Message
+	}
 
 	type kv struct {
 		Key   string
@@ -129,7 +140,7 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 	fields = append(fields, kv{"Intercept name", ii.Spec.Name})
 	fields = append(fields, kv{"State", func() string {
 		msg := ""
-		if ii.Disposition > manager.InterceptDispositionType_WAITING {
+		if ii.Disposition > manager.InterceptDispositionType_WAITING && ii.Disposition != manager.InterceptDispositionType_UNHEALTHY {
 			msg += "error: "
 		}
 		msg += ii.Disposition.String()
@@ -144,11 +155,18 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 		fields = append(fields, kv{"ID", ii.Id})
 	}
 
-	fields = append(fields, kv{"Destination",
-		net.JoinHostPort(ii.Spec.TargetHost, fmt.Sprintf("%d", ii.Spec.TargetPort))})
+	if len(ii.Spec.Ports) > 0 {
+		for _, p := range ii.Spec.Ports {
+			fields = append(fields, kv{"Destination",
+				net.JoinHostPort(ii.Spec.TargetHost, fmt.Sprintf("%d", p.TargetPort)) + " (service port " + p.ServicePortIdentifier + ")"})
+		}
+	} else {
+		fields = append(fields, kv{"Destination",
+			net.JoinHostPort(ii.Spec.TargetHost, fmt.Sprintf("%d", ii.Spec.TargetPort))})
 
-	if ii.Spec.ServicePortIdentifier != "" {
-		fields = append(fields, kv{"Service Port Identifier", ii.Spec.ServicePortIdentifier})
+		if ii.Spec.ServicePortIdentifier != "" {
+			fields = append(fields, kv{"Service Port Identifier", ii.Spec.ServicePortIdentifier})
+		}
 	}
 	if debug {
 		fields = append(fields, kv{"Mechanism", ii.Spec.Mechanism})
@@ -167,6 +185,18 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 		}
 		return ii.MechanismArgsDesc
 	}()})
+	if hc := ii.Spec.HealthCheck; hc != nil {
+		fields = append(fields, kv{"Health check", describeHealthCheck(hc)})
+	}
+	if ii.Spec.Mirror {
+		fields = append(fields, kv{"Mode", "mirror (the workload keeps serving the traffic; local responses are discarded)"})
+	}
+	if ml := ii.Spec.MaxLifetime; ml != nil {
+		fields = append(fields, kv{"Max lifetime", ml.AsDuration().String()})
+	}
+	if it := ii.Spec.IdleTimeout; it != nil {
+		fields = append(fields, kv{"Idle timeout", it.AsDuration().String()})
+	}
 
 	if ii.PreviewDomain != "" {
 		previewURL := ii.PreviewDomain
@@ -196,3 +226,16 @@ func DescribeIntercept(ii *manager.InterceptInfo, volumeMountsPrevented error, d
 	}
 	return msg
 }
+
+func describeHealthCheck(hc *manager.HealthCheck) string {
+	what := "connect to"
+	if hc.Type == healthcheck.TypeHTTP {
+		path := hc.Path
+		if path == "" {
+			path = "/"
+		}
+		what = "GET " + path + " on"
+	}
+	return fmt.Sprintf("%s port %d every %v, unhealthy after %d failures",
+		what, hc.Port, healthcheck.Interval(hc), healthcheck.FailureThreshold(hc))
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/record"
+)
+
+type replayInfo struct {
+	to    string
+	speed float64
+}
+
+func replayCommand() *cobra.Command {
+	ri := replayInfo{}
+	cmd := &cobra.Command{
+		Use:   "replay <file>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Replay traffic recorded using 'telepresence intercept --record' against a local process",
+		RunE:  ri.run,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&ri.to, "to", "", "The address, e.g. localhost:8080, to replay the recorded traffic against")
+	flags.Float64Var(&ri.speed, "speed", 1, ``+
+		`The speed of the replay relative to the recording. Use 2 to replay twice as fast as the traffic was recorded, `+
+		`and 0 to replay as fast as possible`)
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func (ri *replayInfo) run(cmd *cobra.Command, args []string) error {
+	if _, _, err := net.SplitHostPort(ri.to); err != nil {
+		return errcat.User.Newf("invalid --to address %q: %v", ri.to, err)
+	}
+	rec, err := record.ReadFile(args[0])
+	if err != nil {
+		return errcat.User.New(err)
+	}
+
+	results := record.Replay(cmd.Context(), rec, ri.to, ri.speed)
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Replayed %d connections of intercept %s recorded at %s against %s\n",
+		len(results), rec.Intercept, rec.Started.Format("2006-01-02 15:04:05"), ri.to)
+	failed := 0
+	for _, r := range results {
+		conn := fmt.Sprintf("connection %d", r.Conn)
+		if r.Source != "" {
+			conn += " from " + r.Source
+		}
+		if r.Port != "" {
+			conn += " to port " + r.Port
+		}
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(out, "   %s: %v\n", conn, r.Err)
+			continue
+		}
+		fmt.Fprintf(out, "   %s: sent %d bytes, received %d bytes\n", conn, r.Sent, r.Received)
+		for _, rq := range r.Requests {
+			fmt.Fprintf(out, "      %s %s\n", rq.Method, rq.URL)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d connections failed", failed, len(results))
+	}
+	return nil
+}
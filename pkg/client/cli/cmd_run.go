@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/extensions"
+)
+
+func runCommand(ctx context.Context) *cobra.Command {
+	var specFile string
+	var namespace string
+	cmd := &cobra.Command{
+		Use:  "run -f <file>",
+		Args: cobra.NoArgs,
+
+		Short: "Start the intercepts and local processes declared in an intercept specification file",
+		Long: `Start the intercepts and local processes declared in an intercept specification file. The intercepts
+are removed when all local processes have exited, when a local process or a health check fails, or on
+interrupt.`,
+		PreRunE:  updateCheckIfDue,
+		PostRunE: raiseCloudMessage,
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&specFile, "file", "f", "", "The intercept specification file")
+	flags.StringVarP(&namespace, "namespace", "n", "", "The namespace of intercepts that don't declare one")
+	_ = cmd.MarkFlagRequired("file")
+
+	extState, extErr := extensions.LoadExtensions(ctx, flags)
+	cmd.RunE = func(cmd *cobra.Command, _ []string) error {
+		if extErr != nil {
+			return extErr
+		}
+		base := interceptArgs{namespace: namespace, extState: extState}
+		var err error
+		if base.extRequiresLogin, err = extState.RequiresAPIKeyOrLicense(); err != nil {
+			return err
+		}
+		sis, err := readInterceptSpecFile(specFile, base)
+		if err != nil {
+			return err
+		}
+		return interceptSpecs(cmd, sis, true)
+	}
+	return cmd
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -15,18 +16,27 @@ import (
 )
 
 func versionCommand() *cobra.Command {
-	return &cobra.Command{
+	return withStructuredOutput(&cobra.Command{
 		Use:  "version",
 		Args: cobra.NoArgs,
 
 		Short:   "Show version",
 		PreRunE: forcedUpdateCheck,
 		RunE:    printVersion,
-	}
+	})
+}
+
+type versionOutput struct {
+	Client     json.RawMessage `json:"client"` // common.VersionInfo
+	RootDaemon daemonOutput    `json:"rootDaemon"`
+	UserDaemon daemonOutput    `json:"userDaemon"`
 }
 
 // printVersion requests version info from the daemon and prints both client and daemon version.
 func printVersion(cmd *cobra.Command, _ []string) error {
+	if isStructuredOutput() {
+		return printStructuredVersion(cmd)
+	}
 	fmt.Fprintf(cmd.OutOrStdout(), "Client: %s\n",
 		client.DisplayVersion())
 
@@ -59,6 +69,27 @@ func printVersion(cmd *cobra.Command, _ []string) error {
 	return retErr
 }
 
+func printStructuredVersion(cmd *cobra.Command) error {
+	vo := &versionOutput{
+		Client: protoData(&common.VersionInfo{ApiVersion: client.APIVersion, Version: client.Version()}),
+	}
+	version, err := daemonVersion(cmd.Context())
+	switch {
+	case err == nil:
+		vo.RootDaemon = daemonOutput{Running: true, Version: protoData(version)}
+	case err != cliutil.ErrNoDaemon:
+		return err
+	}
+	version, err = connectorVersion(cmd.Context())
+	switch {
+	case err == nil:
+		vo.UserDaemon = daemonOutput{Running: true, Version: protoData(version)}
+	case err != cliutil.ErrNoConnector:
+		return err
+	}
+	return printStructured(cmd, "Version", vo)
+}
+
 func daemonVersion(ctx context.Context) (*common.VersionInfo, error) {
 	var version *common.VersionInfo
 	err := cliutil.WithStartedDaemon(ctx, func(ctx context.Context, daemonClient daemon.DaemonClient) error {
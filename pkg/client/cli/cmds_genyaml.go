@@ -116,6 +116,7 @@ type genContainerInfo struct {
 	appPort       int
 	agentPort     int
 	appProto      string
+	extraPorts    []int
 }
 
 func genContainerSubCommand(yamlInfo *genYAMLInfo) *cobra.Command {
@@ -135,6 +136,9 @@ func genContainerSubCommand(yamlInfo *genYAMLInfo) *cobra.Command {
 		"The protocol the app's port speaks")
 	cmd.Flags().IntVar(&info.agentPort, "agent-port", 9900,
 		"The port number you wish the agent to listen on.")
+	cmd.Flags().IntSliceVar(&info.extraPorts, "extra-port", nil,
+		`Additional port numbers you wish to intercept. The agent will front them using the port numbers that follow `+
+			`the --agent-port, so with the default --agent-port, the first extra port is fronted by port 9901, the second by 9902, and so on.`)
 	cmd.Flags().StringVar(&info.serviceName, "service-name", "",
 		`The name of the service that's exposing this deployment and that you will wish to intercept.
 Defaults to the name of the deployment.`)
@@ -212,6 +216,16 @@ func (i *genContainerInfo) run(cmd *cobra.Command, _ []string) error {
 	if agentImage == "" {
 		agentImage = "tel2:" + strings.TrimPrefix(version.Version, "v")
 	}
+	extraPorts := make([]install.PortMapping, len(i.extraPorts))
+	for x, appPort := range i.extraPorts {
+		extraPorts[x] = install.PortMapping{
+			AgentPort: corev1.ContainerPort{
+				Protocol:      corev1.Protocol(i.appProto),
+				ContainerPort: int32(i.agentPort + 1 + x),
+			},
+			AppPort: appPort,
+		}
+	}
 	agentContainer := install.AgentContainer(
 		i.serviceName,
 		fmt.Sprintf("%s/%s", registry, agentImage),
@@ -221,6 +235,7 @@ func (i *genContainerInfo) run(cmd *cobra.Command, _ []string) error {
 			ContainerPort: int32(i.agentPort),
 		},
 		i.appPort,
+		extraPorts,
 		k8sConfig.GetManagerNamespace(),
 		false,
 	)
@@ -2,22 +2,24 @@ package cli
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/durationpb"
 	empty "google.golang.org/protobuf/types/known/emptypb"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/dexec"
@@ -29,17 +31,25 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/extensions"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
+	"github.com/telepresenceio/telepresence/v2/pkg/healthcheck"
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
 	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+	"github.com/telepresenceio/telepresence/v2/pkg/sftpfs"
+)
+
+// The values of the --mount-mode flag.
+const (
+	mountModeFUSE = "fuse"
+	mountModeCopy = "copy"
 )
 
 type interceptArgs struct {
-	name        string // Args[0] || `${Args[0]}-${--namespace}` // which depends on a combinationof --workload and --namespace
-	agentName   string // --workload || Args[0] // only valid if !localOnly
-	namespace   string // --namespace
-	port        string // --port // only valid if !localOnly
-	serviceName string // --service // only valid if !localOnly
-	localOnly   bool   // --local-only
+	name        string   // Args[0] || `${Args[0]}-${--namespace}` // which depends on a combinationof --workload and --namespace
+	agentName   string   // --workload || Args[0] // only valid if !localOnly
+	namespace   string   // --namespace
+	ports       []string // --port // only valid if !localOnly
+	serviceName string   // --service // only valid if !localOnly
+	localOnly   bool     // --local-only
 
 	previewEnabled bool                 // --preview-url // only valid if !localOnly
 	previewSpec    *manager.PreviewSpec // --preview-url-* // only valid if !localOnly
@@ -50,6 +60,20 @@ type interceptArgs struct {
 	mountSet bool     // whether --mount was passed
 	toPod    []string // --to-pod
 
+	mountMode        string        // --mount-mode
+	copyInclude      []string      // --copy-include
+	copyExclude      []string      // --copy-exclude
+	copyMaxSize      string        // --copy-max-size
+	copySyncInterval time.Duration // --copy-sync-interval
+
+	recordFile string // --record
+	mirror     bool   // --mirror
+
+	healthCheck *manager.HealthCheck // --health-check*
+
+	maxLifetime time.Duration // --timeout
+	idleTimeout time.Duration // --idle-timeout
+
 	dockerRun   bool   // --docker-run
 	dockerMount string // --docker-mount // where to mount in a docker container. Defaults to mount unless mount is "true" or "false".
 
@@ -72,6 +96,7 @@ type safeCobraCommand interface {
 	OutOrStdout() io.Writer
 	ErrOrStderr() io.Writer
 	FlagError(error) error
+	PrintStructured(kind string, data interface{}) error
 }
 
 type safeCobraCommandImpl struct {
@@ -82,6 +107,10 @@ func (w safeCobraCommandImpl) FlagError(err error) error {
 	return w.Command.FlagErrorFunc()(w.Command, err)
 }
 
+func (w safeCobraCommandImpl) PrintStructured(kind string, data interface{}) error {
+	return printStructured(w.Command, kind, data)
+}
+
 type interceptState struct {
 	// static after newInterceptState() ////////////////////////////////////
 
@@ -101,12 +130,20 @@ type interceptState struct {
 	localPort  uint16 // the parsed <local port>
 
 	dockerPort uint16
+
+	extraDockerPorts []dockerPortMapping // the mappings of all but the first --port when using --docker-run
+}
+
+// dockerPortMapping maps a local port onto a port of the container started with --docker-run.
+type dockerPortMapping struct {
+	localPort     uint16
+	containerPort uint16
 }
 
 func interceptCommand(ctx context.Context) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:  "intercept [flags] <intercept_base_name> [-- <command with arguments...>]",
-		Args: cobra.MinimumNArgs(1),
+		Use:  "intercept [flags] { <intercept_base_name> [-- <command with arguments...>] | --spec <file> }",
+		Args: cobra.ArbitraryArgs,
 
 		Short:    "Intercept a service",
 		PreRunE:  updateCheckIfDue,
@@ -116,10 +153,12 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 	flags := cmd.Flags()
 
 	flags.StringVarP(&args.agentName, "workload", "w", "", "Name of workload (Deployment, ReplicaSet) to intercept, if different from <name>")
-	flags.StringVarP(&args.port, "port", "p", "8080", ``+
+	flags.StringArrayVarP(&args.ports, "port", "p", []string{"8080"}, ``+
 		`Local port to forward to. If intercepting a service with multiple ports, `+
 		`use <local port>:<svcPortIdentifier>, where the identifier is the port name or port number. `+
-		`With --docker-run, use <local port>:<container port> or <local port>:<container port>:<svcPortIdentifier>.`,
+		`With --docker-run, use <local port>:<container port> or <local port>:<container port>:<svcPortIdentifier>. `+
+		`Repeat the flag to intercept several ports of the service with one intercept, in which case each `+
+		`occurrence must include the svcPortIdentifier.`,
 	)
 
 	flags.StringVar(&args.serviceName, "service", "", "Name of service to intercept. If not provided, we will try to auto-detect one")
@@ -144,10 +183,54 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 		`The absolute path for the root directory where volumes will be mounted, $TELEPRESENCE_ROOT. Use "true" to `+
 		`have Telepresence pick a random mount point (default). Use "false" to disable filesystem mounting entirely.`)
 
+	flags.StringVar(&args.mountMode, "mount-mode", mountModeFUSE, ``+
+		`How the remote volumes are made available at the mount point. Use "fuse" to mount them (default), or "copy" `+
+		`to copy them to a local directory, which requires neither FUSE nor sshfs`)
+
+	flags.StringSliceVar(&args.copyInclude, "copy-include", nil, ``+
+		`Glob patterns of the files to copy with --mount-mode=copy. A pattern without a slash is matched against `+
+		`file names, and a matching directory includes all its files. All files are copied when not set`)
+
+	flags.StringSliceVar(&args.copyExclude, "copy-exclude", nil, ``+
+		`Glob patterns of the files and directories that are not copied with --mount-mode=copy`)
+
+	flags.StringVar(&args.copyMaxSize, "copy-max-size", "", ``+
+		`The maximum total size of the files copied with --mount-mode=copy, e.g. "100Mi". The intercept fails `+
+		`when the remote volumes are larger`)
+
+	flags.DurationVar(&args.copySyncInterval, "copy-sync-interval", 0, ``+
+		`Copy files that have changed in the remote volumes again at this interval. By default, the volumes `+
+		`are copied once when the intercept is created`)
+
 	flags.StringSliceVar(&args.toPod, "to-pod", []string{}, ``+
 		`An additional port to forward from the intercepted pod, will be made available at localhost:PORT `+
 		`Use this to, for example, access proxy/helper sidecars in the intercepted pod.`)
 
+	flags.StringVar(&args.recordFile, "record", "", ``+
+		`Record the intercepted TCP traffic to the given file for as long as the intercept is active. `+
+		`The recording can be replayed using 'telepresence replay'`)
+
+	flags.BoolVar(&args.mirror, "mirror", false, ``+
+		`Send a copy of the intercepted TCP traffic to the local process and let the workload keep serving it. `+
+		`Responses from the local process are discarded`)
+
+	flags.DurationVar(&args.maxLifetime, "timeout", 0, ``+
+		`Remove the intercept after this long, e.g. 2h. The traffic-manager's default applies when not set`)
+	flags.DurationVar(&args.idleTimeout, "idle-timeout", 0, ``+
+		`Remove the intercept when no traffic has been routed to it for this long. `+
+		`The traffic-manager's default applies when not set`)
+
+	var hc manager.HealthCheck
+	var hcInterval time.Duration
+	flags.StringVar(&hc.Type, "health-check", "", ``+
+		`Check the health of the local process using "tcp" to connect to it, or "http" to send it GET requests. `+
+		`The intercept is paused, and the workload serves the intercepted traffic, while the local process is unhealthy`)
+	flags.StringVar(&hc.Path, "health-check-path", "", `The path of the GET requests of --health-check=http (default "/")`)
+	flags.Int32Var(&hc.Port, "health-check-port", 0, `The local port to check. Defaults to the first local port of --port`)
+	flags.DurationVar(&hcInterval, "health-check-interval", time.Second, `The time between two health checks`)
+	flags.Int32Var(&hc.FailureThreshold, "health-check-failure-threshold", 3, ``+
+		`The number of consecutive failed health checks after which the local process is considered unhealthy`)
+
 	flags.BoolVarP(&args.dockerRun, "docker-run", "", false, ``+
 		`Run a Docker container with intercepted environment, volume mount, by passing arguments after -- to 'docker run', `+
 		`e.g. '--docker-run -- -it --rm ubuntu:20.04 /bin/bash'`)
@@ -166,6 +249,11 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 	flags.StringVar(&args.ingressL5, "ingress-l5", "", "If this flag is set, the ingress dialogue will be skipped,"+
 		" and this value will be used as the L5 hostname. If the dialogue is skipped, this flag will default to the ingress-host value")
 
+	var specFile string
+	flags.StringVar(&specFile, "spec", "", ``+
+		`Read the intercepts, and the local processes that handle them, from the given intercept specification `+
+		`file. The intercepts are started together and remain active unless the file declares local processes`)
+
 	var extErr error
 	args.extState, extErr = extensions.LoadExtensions(ctx, flags)
 
@@ -179,46 +267,111 @@ func interceptCommand(ctx context.Context) *cobra.Command {
 		if err != nil {
 			return err
 		}
-		args.name = positional[0]
-		args.cmdline = positional[1:]
-		switch args.localOnly { // a switch instead of an if/else to get gocritic to not suggest "else if"
-		case true:
-			// Not actually intercepting anything -- check that the flags make sense for that
-			if args.agentName != "" {
-				return errcat.User.New("a local-only intercept cannot have a workload")
-			}
-			if args.serviceName != "" {
-				return errcat.User.New("a local-only intercept cannot have a service")
+		if specFile != "" {
+			if len(positional) > 0 {
+				return errcat.User.New("--spec cannot be combined with an intercept name or a command; declare them in the spec file")
 			}
-			if cmd.Flag("port").Changed {
-				return errcat.User.New("a local-only intercept cannot have a port")
-			}
-			if cmd.Flag("mount").Changed {
-				return errcat.User.New("a local-only intercept cannot have mounts")
-			}
-			if cmd.Flag("preview-url").Changed && args.previewEnabled {
-				return errcat.User.New("a local-only intercept cannot be previewed")
-			}
-		case false:
-			// Actually intercepting something
-			if args.agentName == "" {
-				args.agentName = args.name
-				if args.namespace != "" {
-					args.name += "-" + args.namespace
-				}
-			}
-		}
-		args.mountSet = cmd.Flag("mount").Changed
-		if args.dockerRun {
-			if err := validateDockerArgs(args.cmdline); err != nil {
+			specs, err := readInterceptSpecFile(specFile, args)
+			if err != nil {
 				return err
 			}
+			return interceptSpecs(cmd, specs, false)
+		}
+		if len(positional) == 0 {
+			return errcat.User.New("an <intercept_base_name> or --spec is required")
+		}
+		args.name = positional[0]
+		args.cmdline = positional[1:]
+		if cmd.Flag("health-check").Changed {
+			hc.Interval = durationpb.New(hcInterval)
+			args.healthCheck = &hc
+		}
+		if err := args.validate(func(flag string) bool { return cmd.Flag(flag).Changed }); err != nil {
+			return err
 		}
 		// run
 		return intercept(cmd, args)
 	}
+	cmd.AddCommand(interceptInspectCommand())
 
-	return cmd
+	return withStructuredOutput(cmd)
+}
+
+// validate checks that the interceptArgs are consistent and fills in the defaults that depend on
+// other arguments. The isSet function tells if the flag with the given name was set explicitly.
+func (args *interceptArgs) validate(isSet func(flag string) bool) error {
+	switch args.localOnly { // a switch instead of an if/else to get gocritic to not suggest "else if"
+	case true:
+		// Not actually intercepting anything -- check that the flags make sense for that
+		if args.agentName != "" {
+			return errcat.User.New("a local-only intercept cannot have a workload")
+		}
+		if args.serviceName != "" {
+			return errcat.User.New("a local-only intercept cannot have a service")
+		}
+		if isSet("port") {
+			return errcat.User.New("a local-only intercept cannot have a port")
+		}
+		if isSet("mount") || isSet("mount-mode") {
+			return errcat.User.New("a local-only intercept cannot have mounts")
+		}
+		if isSet("preview-url") && args.previewEnabled {
+			return errcat.User.New("a local-only intercept cannot be previewed")
+		}
+		if args.recordFile != "" {
+			return errcat.User.New("a local-only intercept cannot be recorded")
+		}
+		if args.mirror {
+			return errcat.User.New("a local-only intercept cannot be a mirror")
+		}
+		if args.healthCheck != nil {
+			return errcat.User.New("a local-only intercept cannot have a health check")
+		}
+		if args.maxLifetime != 0 || args.idleTimeout != 0 {
+			return errcat.User.New("a local-only intercept cannot have a timeout")
+		}
+	case false:
+		// Actually intercepting something
+		if args.agentName == "" {
+			args.agentName = args.name
+			if args.namespace != "" {
+				args.name += "-" + args.namespace
+			}
+		}
+	}
+	if args.maxLifetime < 0 {
+		return errcat.User.New("--timeout cannot be negative")
+	}
+	if args.idleTimeout < 0 {
+		return errcat.User.New("--idle-timeout cannot be negative")
+	}
+	args.mountSet = isSet("mount")
+	switch args.mountMode {
+	case mountModeFUSE:
+		for _, f := range []string{"copy-include", "copy-exclude", "copy-max-size", "copy-sync-interval"} {
+			if isSet(f) {
+				return errcat.User.Newf("--%s can only be used with --mount-mode=%s", f, mountModeCopy)
+			}
+		}
+	case mountModeCopy:
+	default:
+		return errcat.User.Newf("--mount-mode must be %q or %q", mountModeFUSE, mountModeCopy)
+	}
+	if args.healthCheck == nil {
+		for _, f := range []string{"health-check-path", "health-check-port", "health-check-interval", "health-check-failure-threshold"} {
+			if isSet(f) {
+				return errcat.User.Newf("--%s can only be used with --health-check", f)
+			}
+		}
+	} else if err := healthcheck.Validate(args.healthCheck); err != nil {
+		return errcat.User.New(err)
+	}
+	if args.dockerRun {
+		if err := validateDockerArgs(args.cmdline); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func leaveCommand() *cobra.Command {
@@ -365,27 +518,14 @@ func interceptMessage(r *connector.InterceptResult) error {
 }
 
 func checkMountCapability(ctx context.Context) error {
-	// Use CombinedOutput to include stderr which has information about whether they
-	// need to upgrade to a newer version of macFUSE or not
-	var cmd *dexec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = dexec.CommandContext(ctx, "sshfs-win", "cmd", "-V")
-	} else {
-		cmd = dexec.CommandContext(ctx, "sshfs", "-V")
+	if runtime.GOOS != "windows" {
+		// The connector mounts the file system using its built-in SFTP client
+		return sftpfs.CheckSupport()
 	}
+	cmd := dexec.CommandContext(ctx, "sshfs-win", "cmd", "-V")
 	cmd.DisableLogging = true
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return errors.New("sshfs is not installed on your local machine")
-	}
-
-	// OSXFUSE changed to macFUSE and we've noticed that older versions of OSXFUSE
-	// can cause browsers to hang + kernel crashes, so we add an error to prevent
-	// our users from running into this problem.
-	// OSXFUSE isn't included in the output of sshfs -V in versions of 4.0.0 so
-	// we check for that as a proxy for if they have the right version or not.
-	if bytes.Contains(out, []byte("OSXFUSE")) {
-		return errors.New(`macFUSE 4.0.5 or higher is required on your local machine`)
+	if err := cmd.Run(); err != nil {
+		return errors.New("sshfs-win is not installed on your local machine")
 	}
 	return nil
 }
@@ -408,59 +548,54 @@ func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateI
 
 	spec.Agent = is.args.agentName
 	spec.TargetHost = "127.0.0.1"
-
-	// Parse port into spec based on how it's formatted
-	portMapping := strings.Split(is.args.port, ":")
-	portError := func() error {
-		if is.args.dockerRun {
-			return errcat.User.New("ports must be of the format --ports <local-port>:<container-port>[:<svcPortIdentifier>]")
-		}
-		return errcat.User.New("ports must be of the format --ports <local-port>[:<svcPortIdentifier>]")
+	spec.Mirror = is.args.mirror
+	spec.HealthCheck = is.args.healthCheck
+	if is.args.maxLifetime > 0 {
+		spec.MaxLifetime = durationpb.New(is.args.maxLifetime)
 	}
-
-	parsePort := func(portStr string) (uint16, error) {
-		port, err := strconv.ParseUint(portStr, 10, 16)
-		if err != nil {
-			return 0, errcat.User.Newf("port numbers must be a valid, positive int, you gave: %q", is.args.port)
-		}
-		return uint16(port), nil
+	if is.args.idleTimeout > 0 {
+		spec.IdleTimeout = durationpb.New(is.args.idleTimeout)
 	}
 
-	port, err := parsePort(portMapping[0])
-	if err != nil {
-		return nil, err
-	}
-	is.localPort = port
-	spec.TargetPort = int32(port)
-
-	switch len(portMapping) {
-	case 1:
-	case 2:
-		if port, err = parsePort(portMapping[1]); err == nil && is.args.dockerRun {
-			is.dockerPort = port
-		} else {
-			spec.ServicePortIdentifier = portMapping[1]
+	// Parse the ports into spec based on how they're formatted
+	for i, portStr := range is.args.ports {
+		localPort, dockerPort, svcPortIdentifier, err := is.parsePortMapping(portStr)
+		if err != nil {
+			return nil, err
 		}
-	case 3:
-		if !is.args.dockerRun {
-			return nil, portError()
+		if len(is.args.ports) > 1 {
+			if svcPortIdentifier == "" {
+				return nil, errcat.User.Newf("--port %q must include a svcPortIdentifier when the flag is repeated", portStr)
+			}
+			spec.Ports = append(spec.Ports, &manager.InterceptPort{
+				ServicePortIdentifier: svcPortIdentifier,
+				TargetPort:            int32(localPort),
+			})
 		}
-		if port, err = parsePort(portMapping[1]); err != nil {
-			return nil, err
+		if i == 0 {
+			is.localPort = localPort
+			is.dockerPort = dockerPort
+			spec.TargetPort = int32(localPort)
+			spec.ServicePortIdentifier = svcPortIdentifier
+		} else if dockerPort != 0 {
+			is.extraDockerPorts = append(is.extraDockerPorts, dockerPortMapping{localPort: localPort, containerPort: dockerPort})
 		}
-		is.dockerPort = port
-		spec.ServicePortIdentifier = portMapping[2]
-	default:
-		return nil, portError()
-	}
-
-	if is.args.dockerRun && is.dockerPort == 0 {
-		is.dockerPort = is.localPort
 	}
 
 	doMount := false
-	err = checkMountCapability(ctx)
-	if err == nil {
+	var err error
+	if is.args.mountMode == mountModeCopy {
+		// A copy requires neither FUSE nor sshfs
+		if ir.VolumeCopy, err = is.args.volumeCopy(); err != nil {
+			return nil, err
+		}
+		if ir.MountPoint, doMount, err = is.getMountPoint(); err != nil {
+			return nil, err
+		}
+		if !doMount {
+			ir.VolumeCopy = nil
+		}
+	} else if err = checkMountCapability(ctx); err == nil {
 		if ir.MountPoint, doMount, err = is.getMountPoint(); err != nil {
 			return nil, err
 		}
@@ -473,8 +608,25 @@ func (is *interceptState) createRequest(ctx context.Context) (*connector.CreateI
 		}
 	}
 
+	// The files are created by the connector, which doesn't share the working directory of the CLI.
+	if is.args.recordFile != "" {
+		if ir.RecordFile, err = filepath.Abs(is.args.recordFile); err != nil {
+			return nil, errcat.User.New(err)
+		}
+	}
+	if is.args.envFile != "" {
+		if ir.EnvFile, err = filepath.Abs(is.args.envFile); err != nil {
+			return nil, errcat.User.New(err)
+		}
+	}
+	if is.args.envJSON != "" {
+		if ir.EnvJson, err = filepath.Abs(is.args.envJSON); err != nil {
+			return nil, errcat.User.New(err)
+		}
+	}
+
 	for _, toPod := range is.args.toPod {
-		port, err := parsePort(toPod)
+		port, err := parsePort(toPod, toPod)
 		if err != nil {
 			return nil, errcat.User.Newf("Unable to parse port %s: %w", toPod, err)
 		}
@@ -515,11 +667,104 @@ func (is *interceptState) getMountPoint() (string, bool, error) {
 		err = nil
 	}
 	if doMount {
-		mountPoint, err = prepareMount(mountPoint)
+		if is.args.mountMode == mountModeCopy {
+			mountPoint, err = prepareCopyDir(mountPoint)
+		} else {
+			mountPoint, err = prepareMount(mountPoint)
+		}
 	}
 	return mountPoint, doMount, err
 }
 
+// prepareCopyDir creates the directory that the remote volumes are copied to and returns its
+// absolute path.
+func prepareCopyDir(dir string) (string, error) {
+	if dir == "" {
+		return os.MkdirTemp("", "telfs-")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errcat.User.New(err)
+	}
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// volumeCopy returns the VolumeCopy of a request for an intercept that uses --mount-mode=copy.
+func (args *interceptArgs) volumeCopy() (*connector.VolumeCopy, error) {
+	opts := sftpfs.CopyOptions{Include: args.copyInclude, Exclude: args.copyExclude}
+	if args.copyMaxSize != "" {
+		q, err := resource.ParseQuantity(args.copyMaxSize)
+		if err != nil {
+			return nil, errcat.User.Newf("invalid --copy-max-size %q: %w", args.copyMaxSize, err)
+		}
+		opts.MaxSize = q.Value()
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if args.copySyncInterval < 0 {
+		return nil, errcat.User.New("--copy-sync-interval cannot be negative")
+	}
+	vc := &connector.VolumeCopy{
+		Include: opts.Include,
+		Exclude: opts.Exclude,
+		MaxSize: opts.MaxSize,
+	}
+	if args.copySyncInterval > 0 {
+		vc.SyncInterval = durationpb.New(args.copySyncInterval)
+	}
+	return vc, nil
+}
+
+func parsePort(portStr, arg string) (uint16, error) {
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return 0, errcat.User.Newf("port numbers must be a valid, positive int, you gave: %q", arg)
+	}
+	return uint16(port), nil
+}
+
+// parsePortMapping parses one --port argument into its local port, container port (only when using
+// --docker-run), and service port identifier.
+func (is *interceptState) parsePortMapping(portStr string) (localPort, dockerPort uint16, svcPortIdentifier string, err error) {
+	portMapping := strings.Split(portStr, ":")
+	portError := func() error {
+		if is.args.dockerRun {
+			return errcat.User.New("ports must be of the format --ports <local-port>:<container-port>[:<svcPortIdentifier>]")
+		}
+		return errcat.User.New("ports must be of the format --ports <local-port>[:<svcPortIdentifier>]")
+	}
+
+	if localPort, err = parsePort(portMapping[0], portStr); err != nil {
+		return 0, 0, "", err
+	}
+
+	switch len(portMapping) {
+	case 1:
+	case 2:
+		if port, err := parsePort(portMapping[1], portStr); err == nil && is.args.dockerRun {
+			dockerPort = port
+		} else {
+			svcPortIdentifier = portMapping[1]
+		}
+	case 3:
+		if !is.args.dockerRun {
+			return 0, 0, "", portError()
+		}
+		if dockerPort, err = parsePort(portMapping[1], portStr); err != nil {
+			return 0, 0, "", err
+		}
+		svcPortIdentifier = portMapping[2]
+	default:
+		return 0, 0, "", portError()
+	}
+
+	if is.args.dockerRun && dockerPort == 0 {
+		dockerPort = localPort
+	}
+	return localPort, dockerPort, svcPortIdentifier, nil
+}
+
 func makeIngressInfo(ingressHost string, ingressPort int32, ingressTLS bool, ingressL5 string) (*manager.IngressInfo, error) {
 	ingress := &manager.IngressInfo{}
 	if hostRx.MatchString(ingressHost) {
@@ -593,7 +838,7 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 
 	if ir.MountPoint != "" {
 		defer func() {
-			if !acquired && runtime.GOOS != "windows" {
+			if !acquired && (runtime.GOOS != "windows" || ir.VolumeCopy != nil) {
 				// remove if empty
 				_ = os.Remove(ir.MountPoint)
 			}
@@ -611,6 +856,9 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 	case connector.InterceptError_UNSPECIFIED:
 		if is.args.agentName == "" {
 			// local-only
+			if isStructuredOutput() {
+				return true, is.cmd.PrintStructured("Intercept", protoData(r))
+			}
 			return true, nil
 		}
 		fmt.Fprintf(is.cmd.OutOrStdout(), "Using %s %s\n", r.WorkloadKind, is.args.agentName)
@@ -659,15 +907,23 @@ func (is *interceptState) EnsureState(ctx context.Context) (acquired bool, err e
 
 		var volumeMountProblem error
 		doMount, err := strconv.ParseBool(is.args.mount)
-		if doMount || err != nil {
+		if (doMount || err != nil) && is.args.mountMode != mountModeCopy {
 			volumeMountProblem = checkMountCapability(ctx)
 		}
+		if isStructuredOutput() {
+			r.InterceptInfo = intercept
+			return true, is.cmd.PrintStructured("Intercept", protoData(r))
+		}
 		fmt.Fprintln(is.cmd.OutOrStdout(), DescribeIntercept(intercept, volumeMountProblem, false))
 		return true, nil
 	default:
-		if r.GetInterceptInfo().GetDisposition() == manager.InterceptDispositionType_BAD_ARGS {
+		switch r.GetInterceptInfo().GetDisposition() {
+		case manager.InterceptDispositionType_BAD_ARGS:
 			_ = is.DeactivateState(ctx)
 			return false, is.cmd.FlagError(errcat.User.New(r.InterceptInfo.Message))
+		case manager.InterceptDispositionType_POLICY_DENIED:
+			// The denied intercept is of no use, so it's removed rather than kept in the way of another attempt.
+			_ = is.DeactivateState(ctx)
 		}
 		return false, interceptMessage(r)
 	}
@@ -736,6 +992,9 @@ func (is *interceptState) runInDocker(ctx context.Context, cmd safeCobraCommand,
 	if is.dockerPort != 0 {
 		ourArgs = append(ourArgs, "-p", fmt.Sprintf("%d:%d", is.localPort, is.dockerPort))
 	}
+	for _, pm := range is.extraDockerPorts {
+		ourArgs = append(ourArgs, "-p", fmt.Sprintf("%d:%d", pm.localPort, pm.containerPort))
+	}
 
 	dockerMount := ""
 	if is.mountPoint != "" { // do we have a mount point at all?
@@ -759,40 +1018,11 @@ func (is *interceptState) writeEnvFile() error {
 
 func (is *interceptState) writeEnvToFileAndClose(file *os.File) (err error) {
 	defer file.Close()
-	w := bufio.NewWriter(file)
-
-	keys := make([]string, len(is.env))
-	i := 0
-	for k := range is.env {
-		keys[i] = k
-		i++
-	}
-	sort.Strings(keys)
-
-	for _, k := range keys {
-		if _, err = w.WriteString(k); err != nil {
-			return err
-		}
-		if err = w.WriteByte('='); err != nil {
-			return err
-		}
-		if _, err = w.WriteString(is.env[k]); err != nil {
-			return err
-		}
-		if err = w.WriteByte('\n'); err != nil {
-			return err
-		}
-	}
-	return w.Flush()
+	return client.WriteEnv(file, is.env)
 }
 
 func (is *interceptState) writeEnvJSON() error {
-	data, err := json.MarshalIndent(is.env, "", "  ")
-	if err != nil {
-		// Creating JSON from a map[string]string should never fail
-		panic(err)
-	}
-	return os.WriteFile(is.args.envJSON, data, 0644)
+	return client.WriteEnvJSON(is.args.envJSON, is.env)
 }
 
 var hostRx = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9\-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9\-]*[a-zA-Z0-9])?)*$`)
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/datawire/ambassador/v2/pkg/kates"
+	"github.com/datawire/dlib/dcontext"
 	"github.com/telepresenceio/telepresence/rpc/v2/connector"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/actions"
@@ -19,7 +20,7 @@ import (
 // figure out what their cluster ID is. For now this is just used when
 // people are making licenses for air-gapped environments
 func ClusterIdCommand() *cobra.Command {
-	return &cobra.Command{
+	return withStructuredOutput(&cobra.Command{
 		Use:  "current-cluster-id",
 		Args: cobra.NoArgs,
 
@@ -34,14 +35,21 @@ func ClusterIdCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if isStructuredOutput() {
+				return printStructured(cmd, "ClusterID", &clusterIDOutput{ClusterID: clusterID})
+			}
 			fmt.Fprintf(cmd.OutOrStdout(), "Cluster ID: %s\n", clusterID)
 			return nil
 		},
-	}
+	})
+}
+
+type clusterIDOutput struct {
+	ClusterID string `json:"clusterId"`
 }
 
 func connectCommand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:  "connect [flags] [-- <command to run while connected>]",
 		Args: cobra.ArbitraryArgs,
 
@@ -52,11 +60,23 @@ func connectCommand() *cobra.Command {
 					return nil
 				})
 			}
-			return withConnector(cmd, false, func(ctx context.Context, _ connector.ConnectorClient, _ *connector.ConnectInfo) error {
+			return withConnector(cmd, false, func(ctx context.Context, connectorClient connector.ConnectorClient, ci *connector.ConnectInfo) error {
+				if ci.ConnectionName != "" && ci.Error == connector.ConnectInfo_UNSPECIFIED {
+					// The named connection was created for this command, so it ends with it.
+					defer func() {
+						_, _ = connectorClient.Disconnect(dcontext.WithoutCancel(ctx), &connector.DisconnectRequest{Name: ci.ConnectionName})
+					}()
+				}
 				return proc.Run(ctx, nil, args[0], args[1:]...)
 			})
 		},
 	}
+	cmd.Flags().BoolVar(&restoreIntercepts, "restore", false, ``+
+		`Re-create the intercepts that were active when telepresence was last connected to the same traffic-manager`)
+	cmd.Flags().StringVar(&connectionName, "name", "", ``+
+		`Name of a connection to create in addition to the default connection. Named connections make it possible `+
+		`to reach several clusters, or contexts, at the same time. Intercepts always use the default connection`)
+	return cmd
 }
 
 func dashboardCommand() *cobra.Command {
@@ -88,13 +108,22 @@ func dashboardCommand() *cobra.Command {
 }
 
 func quitCommand() *cobra.Command {
-	return &cobra.Command{
+	var name string
+	cmd := &cobra.Command{
 		Use:  "quit",
 		Args: cobra.NoArgs,
 
 		Short: "Tell telepresence daemon to quit",
 		RunE: func(cmd *cobra.Command, _ []string) error {
+			if n := client.NormalizeConnectionName(name); n != "" {
+				return cliutil.WithStartedConnector(cmd.Context(), func(ctx context.Context, connectorClient connector.ConnectorClient) error {
+					_, err := connectorClient.Disconnect(ctx, &connector.DisconnectRequest{Name: n})
+					return err
+				})
+			}
 			return cliutil.QuitDaemon(cmd.Context())
 		},
 	}
+	cmd.Flags().StringVar(&name, "name", "", "Name of a connection to close. The daemons keep running")
+	return cmd
 }
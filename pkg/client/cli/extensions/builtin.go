@@ -7,6 +7,8 @@ import (
 	"strings"
 
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
 )
 
 // builtinExtensions is a function instead of a would-be-const var because its result includes the
@@ -19,38 +21,79 @@ func builtinExtensions(ctx context.Context) map[string]ExtensionInfo {
 	image := fmt.Sprintf("%s/tel2:%s", registry, version)
 	// XXX: not using net.JoinHostPort means that setting cloud.SystemaHost to an IPv6 address won't work
 	extImage := fmt.Sprintf("grpc+https://%s:%s", cloud.SystemaHost, cloud.SystemaPort)
-	return map[string]ExtensionInfo{
+	sourceFlag := FlagInfo{
+		Type: "string-array",
+		Usage: `` +
+			`Only intercept traffic from this IP address or CIDR subnet. ` +
+			`If this flag is given multiple times, then it will intercept traffic from any of the sources. ` +
+			`Intercepts that select different traffic can share the same workload.`,
+	}
+	exts := map[string]ExtensionInfo{
 		// Real extensions won't have a "/" in the extname, by putting one builtin extension names
 		// we can avoid clashes.
 		"/builtin/telepresence": {
 			Image: image,
 			Mechanisms: map[string]MechanismInfo{
-				"tcp": {},
+				"tcp": {
+					Flags: map[string]FlagInfo{
+						"source": sourceFlag,
+					},
+				},
 			},
 		},
-		// FIXME(lukeshu): We shouldn't compile in the info about the Ambassador Smart Agent
-		// extension, but we don't yet have an installer to install the extension file; so this
-		// metadata here is fine in the mean-time.
-		"/builtin/ambassador": {
-			Image:                   extImage,
-			RequiresAPIKeyOrLicense: true,
-			Mechanisms: map[string]MechanismInfo{
-				"http": {
-					Preference: 100,
-					Flags: map[string]FlagInfo{
-						"match": {
-							Type:    "string-array",
-							Default: json.RawMessage(`["auto"]`),
-							Usage: `` +
-								`Rather than intercepting all traffic service, only intercept traffic that matches this "HTTP2_HEADER=REGEXP" specifier. ` +
-								`Instead of a "--http-match=HTTP2_HEADER=REGEXP" pair, you may say "--http-match=auto", which will automatically select a unique matcher for your intercept. ` +
-								`Alternatively, you may say "--http-match=all", which is a no-op, but will inhibit the default "--http-match=auto" when you are logged in. ` +
-								`If this flag is given multiple times, then it will only intercept traffic that matches *all* of the specifiers. ` +
-								`(default "auto" if you are logged in with 'telepresence login', default "all" otherwise)`,
-						},
+	}
+	if !cliutil.HasLoggedIn(ctx) {
+		// The open source traffic-agent implements an "http" mechanism that is compatible with
+		// the one in the Ambassador Smart Agent, but that doesn't require a login.
+		exts["/builtin/telepresence"].Mechanisms["http"] = MechanismInfo{
+			Flags: map[string]FlagInfo{
+				"match": {
+					Type:             "string-array",
+					Default:          json.RawMessage(`["auto"]`),
+					DefaultOnlyAlone: true,
+					Usage: `` +
+						`Rather than intercepting all traffic, only intercept HTTP/1.1 and h2c requests that match this "HTTP_HEADER=REGEXP" specifier. ` +
+						`Instead of a "--http-match=HTTP_HEADER=REGEXP" pair, you may say "--http-match=auto", which will only intercept requests that have an ` +
+						`"` + forwarder.InterceptIDHeader + `" header with the ID of the intercept. ` +
+						`Alternatively, you may say "--http-match=all", which will intercept all HTTP requests. ` +
+						`If this flag is given multiple times, then it will only intercept traffic that matches *all* of the specifiers. ` +
+						`The default "auto" only applies when neither --http-path-prefix nor --http-source is given.`,
+				},
+				"path-prefix": {
+					Type: "string",
+					Usage: `` +
+						`Only intercept HTTP requests with a URL path that starts with this prefix. ` +
+						`Intercepts with different path prefixes can share the same workload.`,
+				},
+				"source": sourceFlag,
+			},
+		}
+		return exts
+	}
+
+	// FIXME(lukeshu): We shouldn't compile in the info about the Ambassador Smart Agent
+	// extension, but we don't yet have an installer to install the extension file; so this
+	// metadata here is fine in the mean-time.
+	exts["/builtin/ambassador"] = ExtensionInfo{
+		Image:                   extImage,
+		RequiresAPIKeyOrLicense: true,
+		Mechanisms: map[string]MechanismInfo{
+			"http": {
+				Preference: 100,
+				Flags: map[string]FlagInfo{
+					"match": {
+						Type:    "string-array",
+						Default: json.RawMessage(`["auto"]`),
+						Usage: `` +
+							`Rather than intercepting all traffic service, only intercept traffic that matches this "HTTP2_HEADER=REGEXP" specifier. ` +
+							`Instead of a "--http-match=HTTP2_HEADER=REGEXP" pair, you may say "--http-match=auto", which will automatically select a unique matcher for your intercept. ` +
+							`Alternatively, you may say "--http-match=all", which is a no-op, but will inhibit the default "--http-match=auto" when you are logged in. ` +
+							`If this flag is given multiple times, then it will only intercept traffic that matches *all* of the specifiers. ` +
+							`(default "auto" if you are logged in with 'telepresence login', default "all" otherwise)`,
 					},
 				},
 			},
 		},
 	}
+	return exts
 }
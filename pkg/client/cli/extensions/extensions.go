@@ -370,14 +370,27 @@ func (es *ExtensionsState) MechanismArgs() ([]string, error) {
 	mechdata := es.exts[es.mech2ext[mechname]].Mechanisms[mechname]
 
 	var args []string
-	for flagname := range mechdata.Flags {
+	for flagname, flagdata := range mechdata.Flags {
 		flag := es.flags.Lookup(mechname + "-" + flagname)
+		if !flag.Changed && flagdata.DefaultOnlyAlone && es.anyFlagChanged(mechname, mechdata) {
+			continue
+		}
 		args = append(args, flag.Value.(Value).AsArgs(flagname)...)
 	}
 
 	return args, nil
 }
 
+// anyFlagChanged returns true if any of the flags of the given mechanism was given on the CLI.
+func (es *ExtensionsState) anyFlagChanged(mechname string, mechdata MechanismInfo) bool {
+	for flagname := range mechdata.Flags {
+		if es.flags.Lookup(mechname + "-" + flagname).Changed {
+			return true
+		}
+	}
+	return false
+}
+
 // ExtensionInfo is the type that the data in an extension YAML file must be.
 type ExtensionInfo struct {
 	// Image is the agent image name to install as a sidecar in order to use this extension.
@@ -427,4 +440,8 @@ type FlagInfo struct {
 	// Default is the default value for this flag.  This field is optional; if it isn't
 	// specitified then the zero value is used.
 	Default json.RawMessage `json:"default,omitempty"`
+	// DefaultOnlyAlone makes the Default apply only when none of the other flags of the mechanism
+	// are given on the CLI.  When one of them is, this flag isn't passed to the agent sidecar
+	// unless it's given too.  This field is optional.
+	DefaultOnlyAlone bool `json:"defaultOnlyAlone,omitempty"`
 }
@@ -0,0 +1,52 @@
+package extensions
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMechanismArgs_DefaultOnlyAlone(t *testing.T) {
+	newState := func(t *testing.T, args ...string) *ExtensionsState {
+		mech := MechanismInfo{
+			Flags: map[string]FlagInfo{
+				"match":       {Type: "string-array", Default: json.RawMessage(`["auto"]`), DefaultOnlyAlone: true},
+				"path-prefix": {Type: "string"},
+				"source":      {Type: "string-array"},
+			},
+		}
+		es := &ExtensionsState{
+			exts:     map[string]ExtensionInfo{"/builtin/telepresence": {Mechanisms: map[string]MechanismInfo{"http": mech}}},
+			mech2ext: map[string]string{"http": "/builtin/telepresence"},
+			flags:    pflag.NewFlagSet("intercept", pflag.ContinueOnError),
+		}
+		es.flags.String("mechanism", "http", "")
+		for flagname, flagdata := range mech.Flags {
+			val, err := flagdata.Type.NewFlagValue(flagdata.Default)
+			require.NoError(t, err)
+			es.flags.Var(val, "http-"+flagname, "")
+		}
+		require.NoError(t, es.flags.Parse(args))
+		return es
+	}
+	mechArgs := func(t *testing.T, args ...string) []string {
+		margs, err := newState(t, args...).MechanismArgs()
+		require.NoError(t, err)
+		return margs
+	}
+
+	// The default applies when no other flag is given
+	assert.Contains(t, mechArgs(t, "--mechanism=http"), "--match=auto")
+
+	// Other selectors replace the default
+	assert.NotContains(t, mechArgs(t, "--http-path-prefix=/api"), "--match=auto")
+	assert.NotContains(t, mechArgs(t, "--http-source=10.0.0.1"), "--match=auto")
+
+	// An explicit flag is always passed on
+	args := mechArgs(t, "--http-path-prefix=/api", "--http-match=auto")
+	assert.Contains(t, args, "--match=auto")
+	assert.Contains(t, args, "--path-prefix=/api")
+}
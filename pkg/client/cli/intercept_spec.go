@@ -0,0 +1,444 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"sigs.k8s.io/yaml"
+
+	"github.com/datawire/dlib/dgroup"
+	"github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cli/cliutil"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/healthcheck"
+	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+)
+
+// interceptSpecAPIVersion is the apiVersion that an intercept specification file must declare.
+const interceptSpecAPIVersion = "telepresence.io/v1alpha1"
+
+// interceptSpecFile is the YAML document read by "intercept --spec" and "run -f". It declares
+// one or more intercepts together with the local processes that handle them.
+//
+//	apiVersion: telepresence.io/v1alpha1
+//	namespace: default
+//	intercepts:
+//	- name: echo
+//	  workload: echo-easy
+//	  ports: ["8080:http"]
+//	  env:
+//	    json: echo-env.json
+//	  handler:
+//	    command: ["python3", "-m", "http.server", "8080"]
+//	    healthCheck:
+//	      type: http
+//	      path: /
+type interceptSpecFile struct {
+	APIVersion string `json:"apiVersion"`
+
+	// Namespace is the default namespace of the intercepts in this file.
+	Namespace string `json:"namespace,omitempty"`
+
+	Intercepts []*interceptSpec `json:"intercepts"`
+}
+
+// interceptSpec declares one intercept. The fields correspond to the flags of the intercept command.
+type interceptSpec struct {
+	Name      string   `json:"name"`
+	Workload  string   `json:"workload,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	Service   string   `json:"service,omitempty"`
+	LocalOnly bool     `json:"localOnly,omitempty"`
+	Ports     []string `json:"ports,omitempty"`
+	ToPod     []string `json:"toPod,omitempty"`
+	Mirror    bool     `json:"mirror,omitempty"`
+	Record    string   `json:"record,omitempty"`
+
+	Env     *interceptSpecEnv     `json:"env,omitempty"`
+	Mount   *interceptSpecMount   `json:"mount,omitempty"`
+	Preview *interceptSpecPreview `json:"preview,omitempty"`
+	Handler *interceptSpecHandler `json:"handler,omitempty"`
+}
+
+// interceptSpecEnv declares the files that the remote environment is written to.
+type interceptSpecEnv struct {
+	File string `json:"file,omitempty"`
+	JSON string `json:"json,omitempty"`
+}
+
+// interceptSpecMount declares how the remote volumes are made available.
+type interceptSpecMount struct {
+	Disabled bool   `json:"disabled,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+
+	Copy *interceptSpecCopy `json:"copy,omitempty"`
+}
+
+// interceptSpecCopy corresponds to the --copy-* flags used with --mount-mode=copy.
+type interceptSpecCopy struct {
+	Include      []string `json:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	MaxSize      string   `json:"maxSize,omitempty"`
+	SyncInterval string   `json:"syncInterval,omitempty"`
+}
+
+// interceptSpecPreview declares the preview URL of an intercept.
+type interceptSpecPreview struct {
+	Enabled       bool                  `json:"enabled"`
+	DisplayBanner bool                  `json:"displayBanner,omitempty"`
+	Ingress       *interceptSpecIngress `json:"ingress,omitempty"`
+}
+
+// interceptSpecIngress corresponds to the --ingress-* flags. The ingress dialogue is used when
+// a preview is enabled without an ingress.
+type interceptSpecIngress struct {
+	Host   string `json:"host"`
+	Port   int32  `json:"port"`
+	TLS    bool   `json:"tls,omitempty"`
+	L5Host string `json:"l5Host,omitempty"`
+}
+
+// interceptSpecHandler declares the local process that handles the intercepted traffic. It's
+// either a command or a docker container.
+type interceptSpecHandler struct {
+	Command     []string                  `json:"command,omitempty"`
+	Docker      *interceptSpecDocker      `json:"docker,omitempty"`
+	HealthCheck *interceptSpecHealthCheck `json:"healthCheck,omitempty"`
+}
+
+// interceptSpecDocker corresponds to --docker-run and --docker-mount.
+type interceptSpecDocker struct {
+	Args  []string `json:"args"`
+	Mount string   `json:"mount,omitempty"`
+}
+
+// interceptSpecHealthCheck corresponds to the --health-check flags. The local process must become
+// healthy within the timeout after it has been started. After that, the intercept is paused while
+// the local process is unhealthy.
+type interceptSpecHealthCheck struct {
+	Type             string `json:"type,omitempty"` // "tcp" (default) or "http"
+	Path             string `json:"path,omitempty"` // path of the HTTP GET, defaults to "/"
+	Port             uint16 `json:"port,omitempty"` // defaults to the local port of the intercept
+	Interval         string `json:"interval,omitempty"`
+	FailureThreshold int32  `json:"failureThreshold,omitempty"`
+	Timeout          string `json:"timeout,omitempty"`
+}
+
+// specifiedIntercept is an intercept read from an intercept specification file.
+type specifiedIntercept struct {
+	args interceptArgs
+
+	// readyTimeout is how long to wait for the local process to pass the health check of the
+	// intercept after it has been started.
+	readyTimeout time.Duration
+}
+
+func (si *specifiedIntercept) hasHandler() bool {
+	return si.args.dockerRun || len(si.args.cmdline) > 0
+}
+
+// readInterceptSpecFile reads the intercept specification file with the given name. The flags of
+// the intercept command that aren't declared per intercept, such as the extension flags, are
+// taken from base. Relative paths in the file are relative to the directory of the file.
+func readInterceptSpecFile(name string, base interceptArgs) ([]*specifiedIntercept, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errcat.User.Newf("unable to read intercept specification: %w", err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(name))
+	if err != nil {
+		return nil, errcat.User.New(err)
+	}
+	sis, err := parseInterceptSpecs(data, dir, base)
+	if err != nil {
+		return nil, errcat.User.Newf("%s: %w", name, err)
+	}
+	return sis, nil
+}
+
+func parseInterceptSpecs(data []byte, dir string, base interceptArgs) ([]*specifiedIntercept, error) {
+	var sf interceptSpecFile
+	if err := yaml.UnmarshalStrict(data, &sf); err != nil {
+		return nil, err
+	}
+	if sf.APIVersion != interceptSpecAPIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion %q, expected %q", sf.APIVersion, interceptSpecAPIVersion)
+	}
+	if len(sf.Intercepts) == 0 {
+		return nil, fmt.Errorf("no intercepts declared")
+	}
+	if sf.Namespace == "" {
+		sf.Namespace = base.namespace
+	}
+	sis := make([]*specifiedIntercept, len(sf.Intercepts))
+	names := make(map[string]struct{}, len(sf.Intercepts))
+	for i, spec := range sf.Intercepts {
+		si, err := spec.toIntercept(dir, sf.Namespace, base)
+		if err != nil {
+			return nil, fmt.Errorf("intercept %q: %w", spec.Name, err)
+		}
+		if _, ok := names[si.args.name]; ok {
+			return nil, fmt.Errorf("intercept %q is declared more than once", si.args.name)
+		}
+		names[si.args.name] = struct{}{}
+		sis[i] = si
+	}
+	return sis, nil
+}
+
+// toIntercept converts the spec into the interceptArgs that the equivalent intercept command
+// would produce, and validates them in the same way.
+func (spec *interceptSpec) toIntercept(dir, namespace string, base interceptArgs) (*specifiedIntercept, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if spec.Namespace != "" {
+		namespace = spec.Namespace
+	}
+	set := make(map[string]bool)
+	args := interceptArgs{
+		name:        spec.Name,
+		agentName:   spec.Workload,
+		namespace:   namespace,
+		ports:       []string{"8080"},
+		serviceName: spec.Service,
+		localOnly:   spec.LocalOnly,
+		previewSpec: &manager.PreviewSpec{},
+		mount:       "true",
+		toPod:       spec.ToPod,
+		mountMode:   mountModeFUSE,
+		recordFile:  absIn(dir, spec.Record),
+		mirror:      spec.Mirror,
+
+		extState:         base.extState,
+		extRequiresLogin: base.extRequiresLogin,
+	}
+	if len(spec.Ports) > 0 {
+		args.ports = spec.Ports
+		set["port"] = true
+	}
+	if e := spec.Env; e != nil {
+		args.envFile = absIn(dir, e.File)
+		args.envJSON = absIn(dir, e.JSON)
+	}
+	if m := spec.Mount; m != nil {
+		switch {
+		case m.Disabled && m.Path != "":
+			return nil, fmt.Errorf("mount.path cannot be used when the mount is disabled")
+		case m.Disabled:
+			args.mount = "false"
+			set["mount"] = true
+		case m.Path != "":
+			args.mount = absIn(dir, m.Path)
+			set["mount"] = true
+		}
+		if m.Mode != "" {
+			args.mountMode = m.Mode
+			set["mount-mode"] = true
+		}
+		if c := m.Copy; c != nil {
+			args.copyInclude = c.Include
+			args.copyExclude = c.Exclude
+			args.copyMaxSize = c.MaxSize
+			set["copy-include"] = len(c.Include) > 0
+			set["copy-exclude"] = len(c.Exclude) > 0
+			set["copy-max-size"] = c.MaxSize != ""
+			if c.SyncInterval != "" {
+				var err error
+				if args.copySyncInterval, err = time.ParseDuration(c.SyncInterval); err != nil {
+					return nil, fmt.Errorf("mount.copy.syncInterval: %w", err)
+				}
+				set["copy-sync-interval"] = true
+			}
+		}
+	}
+	if p := spec.Preview; p != nil {
+		args.previewEnabled = p.Enabled
+		args.previewSpec.DisplayBanner = p.DisplayBanner
+		set["preview-url"] = true
+		if in := p.Ingress; in != nil {
+			args.ingressHost = in.Host
+			args.ingressPort = in.Port
+			args.ingressTLS = in.TLS
+			args.ingressL5 = in.L5Host
+		}
+	}
+
+	si := &specifiedIntercept{}
+	if h := spec.Handler; h != nil {
+		switch {
+		case len(h.Command) > 0 && h.Docker != nil:
+			return nil, fmt.Errorf("handler.command and handler.docker are mutually exclusive")
+		case h.Docker != nil:
+			if len(h.Docker.Args) == 0 {
+				return nil, fmt.Errorf("handler.docker.args is required")
+			}
+			args.dockerRun = true
+			args.dockerMount = h.Docker.Mount
+			args.cmdline = h.Docker.Args
+		default:
+			args.cmdline = h.Command
+		}
+		if h.HealthCheck != nil {
+			var err error
+			if args.healthCheck, si.readyTimeout, err = h.HealthCheck.parse(); err != nil {
+				return nil, fmt.Errorf("handler.healthCheck: %w", err)
+			}
+		}
+	}
+	if err := args.validate(func(flag string) bool { return set[flag] }); err != nil {
+		return nil, err
+	}
+	si.args = args
+	return si, nil
+}
+
+func (spec *interceptSpecHealthCheck) parse() (*manager.HealthCheck, time.Duration, error) {
+	hc := &manager.HealthCheck{
+		Type:             spec.Type,
+		Path:             spec.Path,
+		Port:             int32(spec.Port),
+		FailureThreshold: spec.FailureThreshold,
+	}
+	if spec.Interval != "" {
+		interval, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return nil, 0, fmt.Errorf("interval: %w", err)
+		}
+		hc.Interval = durationpb.New(interval)
+	}
+	if err := healthcheck.Validate(hc); err != nil {
+		return nil, 0, err
+	}
+	timeout := 30 * time.Second
+	if spec.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(spec.Timeout); err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("timeout must be a positive duration")
+		}
+	}
+	return hc, timeout, nil
+}
+
+// waitUntilHealthy checks the local process until it passes the given health check, or until the
+// timeout expires. The defaultPort is used when the health check doesn't declare a port.
+func waitUntilHealthy(ctx context.Context, hc *manager.HealthCheck, defaultPort uint16, timeout time.Duration) error {
+	if hc.Port == 0 {
+		hc = proto.Clone(hc).(*manager.HealthCheck)
+		hc.Port = int32(defaultPort)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		err := healthcheck.Check(ctx, hc, "127.0.0.1")
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("local process at port %d isn't healthy after %v: %w", hc.Port, timeout, err)
+		case <-time.After(healthcheck.Interval(hc)):
+		}
+	}
+}
+
+// absIn returns the absolute form of the given path, using dir as the base of a relative path.
+// An empty path is returned as is.
+func absIn(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// interceptSpecs starts all the given intercepts, and then their local processes. The intercepts
+// are removed in the reverse order of their creation when the local processes have exited, or
+// when one of them, or its health check, fails. Intercepts without local processes remain
+// active unless wait is true, in which case they are removed on interrupt.
+func interceptSpecs(cmd *cobra.Command, sis []*specifiedIntercept, wait bool) error {
+	retain := !wait
+	for _, si := range sis {
+		if si.hasHandler() {
+			retain = false
+			break
+		}
+	}
+	return withConnector(cmd, retain, func(ctx context.Context, connectorClient connector.ConnectorClient, connInfo *connector.ConnectInfo) error {
+		for _, si := range sis {
+			if err := loginIfNeeded(ctx, si.args); err != nil {
+				return err
+			}
+		}
+		return cliutil.WithManager(ctx, func(ctx context.Context, managerClient manager.ManagerClient) error {
+			states := make([]*interceptState, len(sis))
+			for i, si := range sis {
+				states[i] = newInterceptState(ctx, safeCobraCommandImpl{cmd}, si.args, connectorClient, managerClient, connInfo)
+			}
+			return withEnsuredStates(ctx, states, retain, func() error {
+				return runInterceptHandlers(ctx, states, sis, retain)
+			})
+		})
+	})
+}
+
+// withEnsuredStates ensures the given states in order and then calls f. The states are deactivated
+// in the reverse order. A failure to ensure a state deactivates the states that were ensured before it.
+func withEnsuredStates(ctx context.Context, states []*interceptState, retain bool, f func() error) error {
+	if len(states) == 0 {
+		return f()
+	}
+	return client.WithEnsuredState(ctx, states[0], retain, func() error {
+		return withEnsuredStates(ctx, states[1:], retain, f)
+	})
+}
+
+// runInterceptHandlers runs the local processes and health checks of the given intercepts
+// and waits for them to finish. Unless retain is true, it also waits for an interrupt.
+func runInterceptHandlers(ctx context.Context, states []*interceptState, sis []*specifiedIntercept, retain bool) error {
+	g := dgroup.NewGroup(ctx, dgroup.GroupConfig{
+		EnableSignalHandling: !retain,
+		DisableLogging:       true,
+	})
+	waitForInterrupt := !retain
+	for i, is := range states {
+		is := is
+		name := is.args.name
+		if sis[i].hasHandler() {
+			waitForInterrupt = false
+			cmdline := is.args.cmdline
+			g.Go(name, func(ctx context.Context) error {
+				if is.args.dockerRun {
+					return is.runInDocker(ctx, is.cmd, cmdline)
+				}
+				return proc.Run(ctx, is.env, cmdline[0], cmdline[1:]...)
+			})
+		}
+		if hc := is.args.healthCheck; hc != nil {
+			timeout := sis[i].readyTimeout
+			g.Go(name+"-health", func(ctx context.Context) error {
+				if err := waitUntilHealthy(ctx, hc, is.localPort, timeout); err != nil {
+					return errcat.User.Newf("intercept %s: %w", name, err)
+				}
+				fmt.Fprintf(is.cmd.OutOrStdout(), "Intercept %s: local process is healthy\n", name)
+				return nil
+			})
+		}
+	}
+	if waitForInterrupt {
+		g.Go("wait", func(ctx context.Context) error {
+			fmt.Fprintln(states[0].cmd.OutOrStdout(), "Intercepts are active. Press Ctrl-C to remove them")
+			<-ctx.Done()
+			return nil
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func Test_parseInterceptSpecs(t *testing.T) {
+	dir := t.TempDir()
+	base := interceptArgs{namespace: "flag-ns"}
+
+	t.Run("full", func(t *testing.T) {
+		sis, err := parseInterceptSpecs([]byte(`
+apiVersion: telepresence.io/v1alpha1
+namespace: dev
+intercepts:
+- name: echo
+  workload: echo-easy
+  ports: ["8080:http", "8443:https"]
+  env:
+    json: echo.json
+  mount:
+    mode: copy
+    copy:
+      include: ["*.yaml"]
+      syncInterval: 10s
+  handler:
+    command: ["python3", "-m", "http.server", "8080"]
+    healthCheck:
+      type: http
+      path: /healthz
+      interval: 2s
+      failureThreshold: 5
+      timeout: 1m
+- name: web
+  namespace: other
+  mount:
+    disabled: true
+  handler:
+    docker:
+      args: ["--rm", "nginx"]
+`), dir, base)
+		require.NoError(t, err)
+		require.Len(t, sis, 2)
+
+		echo := sis[0].args
+		assert.Equal(t, "echo", echo.name)
+		assert.Equal(t, "echo-easy", echo.agentName)
+		assert.Equal(t, "dev", echo.namespace)
+		assert.Equal(t, []string{"8080:http", "8443:https"}, echo.ports)
+		assert.Equal(t, filepath.Join(dir, "echo.json"), echo.envJSON)
+		assert.Equal(t, mountModeCopy, echo.mountMode)
+		assert.Equal(t, []string{"*.yaml"}, echo.copyInclude)
+		assert.Equal(t, 10*time.Second, echo.copySyncInterval)
+		assert.Equal(t, []string{"python3", "-m", "http.server", "8080"}, echo.cmdline)
+		require.NotNil(t, echo.healthCheck)
+		assert.Equal(t, "http", echo.healthCheck.Type)
+		assert.Equal(t, "/healthz", echo.healthCheck.Path)
+		assert.Equal(t, 2*time.Second, echo.healthCheck.Interval.AsDuration())
+		assert.Equal(t, int32(5), echo.healthCheck.FailureThreshold)
+		assert.Equal(t, time.Minute, sis[0].readyTimeout)
+
+		web := sis[1].args
+		assert.Equal(t, "web-other", web.name)
+		assert.Equal(t, "web", web.agentName)
+		assert.Equal(t, "false", web.mount)
+		assert.True(t, web.mountSet)
+		assert.True(t, web.dockerRun)
+		assert.Equal(t, []string{"--rm", "nginx"}, web.cmdline)
+		assert.Equal(t, []string{"8080"}, web.ports)
+	})
+
+	t.Run("flag namespace", func(t *testing.T) {
+		sis, err := parseInterceptSpecs([]byte(`
+apiVersion: telepresence.io/v1alpha1
+intercepts:
+- name: echo
+`), dir, base)
+		require.NoError(t, err)
+		assert.Equal(t, "flag-ns", sis[0].args.namespace)
+		assert.Equal(t, "echo-flag-ns", sis[0].args.name)
+	})
+
+	errTests := []struct {
+		name string
+		spec string
+		err  string
+	}{
+		{
+			name: "bad version",
+			spec: "apiVersion: telepresence.io/v2\nintercepts:\n- name: echo\n",
+			err:  "unsupported apiVersion",
+		},
+		{
+			name: "no intercepts",
+			spec: "apiVersion: telepresence.io/v1alpha1\n",
+			err:  "no intercepts declared",
+		},
+		{
+			name: "unknown field",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  prot: 8080\n",
+			err:  `unknown field "prot"`,
+		},
+		{
+			name: "duplicate",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n- name: echo\n",
+			err:  "declared more than once",
+		},
+		{
+			name: "local-only with port",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  localOnly: true\n  ports: [\"8080\"]\n",
+			err:  "a local-only intercept cannot have a port",
+		},
+		{
+			name: "copy without copy mode",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  mount:\n    copy:\n      maxSize: 10Mi\n",
+			err:  "--copy-max-size can only be used with --mount-mode=copy",
+		},
+		{
+			name: "command and docker",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  handler:\n    command: [\"x\"]\n    docker:\n      args: [\"y\"]\n",
+			err:  "mutually exclusive",
+		},
+		{
+			name: "detached docker",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  handler:\n    docker:\n      args: [\"-d\", \"nginx\"]\n",
+			err:  "--detach is not supported",
+		},
+		{
+			name: "local-only with health check",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  localOnly: true\n  handler:\n    healthCheck:\n      port: 8080\n",
+			err:  "a local-only intercept cannot have a health check",
+		},
+		{
+			name: "bad health check",
+			spec: "apiVersion: telepresence.io/v1alpha1\nintercepts:\n- name: echo\n  handler:\n    healthCheck:\n      type: udp\n",
+			err:  "handler.healthCheck: the type of a health check must be",
+		},
+	}
+	for _, tt := range errTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseInterceptSpecs([]byte(tt.spec), dir, base)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func Test_waitUntilHealthy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	ctx := context.Background()
+
+	hc := &manager.HealthCheck{Interval: durationpb.New(10 * time.Millisecond)}
+	assert.NoError(t, waitUntilHealthy(ctx, hc, port, time.Second))
+	assert.Zero(t, hc.Port, "the health check must not be modified")
+
+	require.NoError(t, l.Close())
+	assert.Error(t, waitUntilHealthy(ctx, hc, port, 50*time.Millisecond))
+}
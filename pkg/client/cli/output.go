@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// outputAPIVersion is the version of the structures that the commands emit when --output is json or
+// yaml. It must change whenever those structures change in a way that isn't backward compatible.
+const outputAPIVersion = "telepresence.io/v1"
+
+const (
+	outputDefault = "default"
+	outputJSON    = "json"
+	outputYAML    = "yaml"
+)
+
+// annStructuredOutput is the annotation of the commands that emit their own structured output. The
+// text that other commands print is emitted as a structure of kind "Text".
+const annStructuredOutput = "telepresence.io/structured-output"
+
+// outputFormat is the value of the global --output flag
+var outputFormat string
+
+// structuredOutput is the envelope of everything that a command emits when --output is json or yaml.
+type structuredOutput struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Command    string           `json:"command"`
+	Data       interface{}      `json:"data,omitempty"`
+	Error      *structuredError `json:"error,omitempty"`
+}
+
+type structuredError struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// textOutput is the data of the commands that don't emit their own structured output.
+type textOutput struct {
+	Text string `json:"text"`
+}
+
+func isStructuredOutput() bool {
+	return outputFormat == outputJSON || outputFormat == outputYAML
+}
+
+// withStructuredOutput declares that the given command emits its own structured output using
+// printStructured when --output is json or yaml.
+func withStructuredOutput(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[annStructuredOutput] = "true"
+	return cmd
+}
+
+// outputCollector arranges the output of the executed command when --output is json or yaml. Only the
+// structured output is written to stdout. The human-readable text that a command prints is redirected
+// to stderr and, unless the command emits its own structured output, collected and emitted as text.
+type outputCollector struct {
+	text *strings.Builder
+}
+
+func (o *outputCollector) preRun(cmd *cobra.Command, _ []string) error {
+	switch outputFormat {
+	case outputDefault:
+		return nil
+	case outputJSON, outputYAML:
+	default:
+		return errcat.User.Newf("invalid --output %q, must be one of %s, %s, or %s", outputFormat, outputDefault, outputJSON, outputYAML)
+	}
+	if _, ok := cmd.Annotations[annStructuredOutput]; ok {
+		cmd.SetOut(cmd.ErrOrStderr())
+	} else {
+		o.text = &strings.Builder{}
+		cmd.SetOut(io.MultiWriter(cmd.ErrOrStderr(), o.text))
+	}
+	return nil
+}
+
+func (o *outputCollector) postRun(cmd *cobra.Command, _ []string) error {
+	if o.text == nil {
+		return nil
+	}
+	return printStructured(cmd, "Text", &textOutput{Text: o.text.String()})
+}
+
+// printStructured emits the given data as a structure of the given kind on the stdout of the command.
+func printStructured(cmd *cobra.Command, kind string, data interface{}) error {
+	return writeStructured(cmd.Root().OutOrStdout(), &structuredOutput{
+		APIVersion: outputAPIVersion,
+		Kind:       kind,
+		Command:    cmd.CommandPath(),
+		Data:       data,
+	})
+}
+
+// PrintStructuredError emits the given error, along with its errcat category, on the stdout of the given
+// command and returns true when --output is json or yaml. It returns false without printing anything
+// otherwise.
+func PrintStructuredError(cmd *cobra.Command, err error) bool {
+	if !isStructuredOutput() {
+		return false
+	}
+	werr := writeStructured(cmd.Root().OutOrStdout(), &structuredOutput{
+		APIVersion: outputAPIVersion,
+		Kind:       "Error",
+		Command:    cmd.CommandPath(),
+		Error: &structuredError{
+			Category: errcat.GetCategory(err).String(),
+			Message:  err.Error(),
+		},
+	})
+	return werr == nil
+}
+
+func writeStructured(out io.Writer, so *structuredOutput) error {
+	data, err := json.MarshalIndent(so, "", "  ")
+	if err != nil {
+		return err
+	}
+	if outputFormat == outputYAML {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			return err
+		}
+	} else {
+		data = append(data, '\n')
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// protoData returns the canonical protobuf JSON mapping of the given message, or nil when the
+// message is nil.
+func protoData(m proto.Message) json.RawMessage {
+	if m == nil || !m.ProtoReflect().IsValid() {
+		return nil
+	}
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		// Only happens when the message contains invalid UTF-8 or an unresolvable Any
+		return json.RawMessage(fmt.Sprintf("{%q:%q}", "marshalError", err.Error()))
+	}
+	return data
+}
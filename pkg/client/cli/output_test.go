@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/common"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+func testOutputCommand(structured bool, run func(cmd *cobra.Command) error) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	root := &cobra.Command{Use: "telepresence"}
+	oc := &outputCollector{}
+	root.PersistentPreRunE = oc.preRun
+	root.PersistentPostRunE = oc.postRun
+	root.PersistentFlags().StringVar(&outputFormat, "output", outputDefault, "")
+	sub := &cobra.Command{
+		Use: "sub",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd)
+		},
+	}
+	if structured {
+		sub = withStructuredOutput(sub)
+	}
+	root.AddCommand(sub)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	return root, stdout, stderr
+}
+
+func TestStructuredOutput(t *testing.T) {
+	defer func() { outputFormat = outputDefault }()
+	run := func(cmd *cobra.Command) error {
+		cmd.Println("progress")
+		if isStructuredOutput() {
+			return printStructured(cmd, "Version", &versionOutput{
+				Client:     protoData(&common.VersionInfo{ApiVersion: 3, Version: "v2.4.7"}),
+				UserDaemon: daemonOutput{Running: true, Version: protoData(&common.VersionInfo{ApiVersion: 3, Version: "v2.4.7"})},
+			})
+		}
+		return nil
+	}
+
+	root, stdout, stderr := testOutputCommand(true, run)
+	root.SetArgs([]string{"sub"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "progress\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	root, stdout, stderr = testOutputCommand(true, run)
+	root.SetArgs([]string{"sub", "--output", "json"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "progress\n", stderr.String())
+	var so map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &so))
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": outputAPIVersion,
+		"kind":       "Version",
+		"command":    "telepresence sub",
+		"data": map[string]interface{}{
+			"client":     map[string]interface{}{"apiVersion": float64(3), "version": "v2.4.7"},
+			"rootDaemon": map[string]interface{}{"running": false},
+			"userDaemon": map[string]interface{}{"running": true, "version": map[string]interface{}{"apiVersion": float64(3), "version": "v2.4.7"}},
+		},
+	}, so)
+
+	root, stdout, _ = testOutputCommand(true, run)
+	root.SetArgs([]string{"sub", "--output", "yaml"})
+	require.NoError(t, root.Execute())
+	so = nil
+	require.NoError(t, yaml.Unmarshal(stdout.Bytes(), &so))
+	assert.Equal(t, "Version", so["kind"])
+	assert.Equal(t, outputAPIVersion, so["apiVersion"])
+}
+
+func TestStructuredOutput_text(t *testing.T) {
+	defer func() { outputFormat = outputDefault }()
+	root, stdout, stderr := testOutputCommand(false, func(cmd *cobra.Command) error {
+		cmd.Println("Disconnected")
+		return nil
+	})
+	root.SetArgs([]string{"sub", "--output", "json"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "Disconnected\n", stderr.String())
+	var so structuredOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &so))
+	assert.Equal(t, "Text", so.Kind)
+	assert.Equal(t, map[string]interface{}{"text": "Disconnected\n"}, so.Data)
+}
+
+func TestStructuredOutput_error(t *testing.T) {
+	defer func() { outputFormat = outputDefault }()
+	root, stdout, _ := testOutputCommand(true, func(cmd *cobra.Command) error {
+		return errcat.User.New("no such workload")
+	})
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	root.SetArgs([]string{"sub", "--output", "json"})
+	err := root.Execute()
+	require.Error(t, err)
+	sub, _, _ := root.Find([]string{"sub"})
+	require.True(t, PrintStructuredError(sub, err))
+	var so structuredOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &so))
+	assert.Equal(t, "Error", so.Kind)
+	assert.Nil(t, so.Data)
+	assert.Equal(t, &structuredError{Category: "User", Message: "no such workload"}, so.Error)
+
+	outputFormat = outputDefault
+	assert.False(t, PrintStructuredError(sub, err))
+
+	root, _, _ = testOutputCommand(true, func(cmd *cobra.Command) error { return nil })
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	root.SetArgs([]string{"sub", "--output", "xml"})
+	err = root.Execute()
+	require.Error(t, err)
+	assert.Equal(t, errcat.User, errcat.GetCategory(err))
+}
@@ -62,13 +62,26 @@ func withConnector(cmd *cobra.Command, retain bool, f func(context.Context, conn
 	})
 }
 
+func printRestoredIntercepts(stdout io.Writer, results []*connector.InterceptResult) {
+	for _, r := range results {
+		name := r.GetInterceptInfo().GetSpec().GetName()
+		if err := interceptMessage(r); err != nil {
+			fmt.Fprintf(stdout, "Unable to restore intercept %s: %v\n", name, err)
+		} else {
+			fmt.Fprintf(stdout, "Restored intercept %s\n", name)
+		}
+	}
+}
+
 func setConnectInfo(ctx context.Context, stdout io.Writer) (*connector.ConnectInfo, error) {
 	var resp *connector.ConnectInfo
 	err := cliutil.WithStartedConnector(ctx, func(ctx context.Context, connectorClient connector.ConnectorClient) error {
 		var err error
 		resp, err = connectorClient.Connect(ctx, &connector.ConnectRequest{
-			KubeFlags:        kubeFlagMap(),
-			MappedNamespaces: mappedNamespaces,
+			KubeFlags:         kubeFlagMap(),
+			MappedNamespaces:  mappedNamespaces,
+			RestoreIntercepts: restoreIntercepts,
+			Name:              connectionName,
 		})
 		if err != nil {
 			return err
@@ -78,14 +91,23 @@ func setConnectInfo(ctx context.Context, stdout io.Writer) (*connector.ConnectIn
 		cat := errcat.Unknown
 		switch resp.Error {
 		case connector.ConnectInfo_UNSPECIFIED:
+			if resp.ConnectionName != "" {
+				fmt.Fprintf(stdout, "Connection %s connected to context %s (%s)\n", resp.ConnectionName, resp.ClusterContext, resp.ClusterServer)
+				return nil
+			}
 			fmt.Fprintf(stdout, "Connected to context %s (%s)\n", resp.ClusterContext, resp.ClusterServer)
+			printRestoredIntercepts(stdout, resp.RestoredIntercepts)
 			return nil
 		case connector.ConnectInfo_ALREADY_CONNECTED:
+			printRestoredIntercepts(stdout, resp.RestoredIntercepts)
 			return nil
 		case connector.ConnectInfo_DISCONNECTED:
 			msg = "Not connected"
 		case connector.ConnectInfo_MUST_RESTART:
 			msg = "Cluster configuration changed, please quit telepresence and reconnect"
+			if resp.ConnectionName != "" {
+				msg = fmt.Sprintf("Cluster configuration changed, please quit the connection with \"telepresence quit --name %s\" and reconnect", resp.ConnectionName)
+			}
 		case connector.ConnectInfo_TRAFFIC_MANAGER_FAILED, connector.ConnectInfo_CLUSTER_FAILED, connector.ConnectInfo_DAEMON_FAILED:
 			msg = resp.ErrorText
 			if resp.ErrorCategory != 0 {
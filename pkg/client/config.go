@@ -27,6 +27,7 @@ type Config struct {
 	Images    Images    `json:"images,omitempty" yaml:"images,omitempty"`
 	Cloud     Cloud     `json:"cloud,omitempty" yaml:"cloud,omitempty"`
 	Grpc      Grpc      `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	Tracing   Tracing   `json:"tracing,omitempty" yaml:"tracing,omitempty"`
 }
 
 // merge merges this instance with the non-zero values of the given argument. The argument values take priority.
@@ -36,6 +37,7 @@ func (c *Config) Merge(o *Config) {
 	c.Images.merge(&o.Images)
 	c.Cloud.merge(&o.Cloud)
 	c.Grpc.merge(&o.Grpc)
+	c.Tracing.merge(&o.Tracing)
 }
 
 func stringKey(n *yaml.Node) (string, error) {
@@ -83,6 +85,11 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) (err error) {
 			if err != nil {
 				return err
 			}
+		case kv == "tracing":
+			err := ms[i+1].Decode(&c.Tracing)
+			if err != nil {
+				return err
+			}
 		case parseContext != nil:
 			dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
 		}
@@ -631,6 +638,53 @@ func (g Grpc) MarshalYAML() (interface{}, error) {
 	return cm, nil
 }
 
+type Tracing struct {
+	// OTLPEndpoint is the URL of an OTLP/HTTP collector, e.g. "http://localhost:4318", that the CLI and the
+	// daemons export their trace spans to. Tracing is disabled when it's empty.
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty" yaml:"otlpEndpoint,omitempty"`
+}
+
+func (t *Tracing) merge(o *Tracing) {
+	if o.OTLPEndpoint != "" {
+		t.OTLPEndpoint = o.OTLPEndpoint
+	}
+}
+
+// UnmarshalYAML parses the tracing YAML
+func (t *Tracing) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind != yaml.MappingNode {
+		return errors.New(withLoc("tracing must be an object", node))
+	}
+
+	ms := node.Content
+	top := len(ms)
+	for i := 0; i < top; i += 2 {
+		kv, err := stringKey(ms[i])
+		if err != nil {
+			return err
+		}
+		v := ms[i+1]
+		switch kv {
+		case "otlpEndpoint":
+			t.OTLPEndpoint = v.Value
+		default:
+			if parseContext != nil {
+				dlog.Warn(parseContext, withLoc(fmt.Sprintf("unknown key %q", kv), ms[i]))
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalYAML is not using pointer receiver here, because Tracing is not pointer in the Config struct
+func (t Tracing) MarshalYAML() (interface{}, error) {
+	tm := make(map[string]interface{})
+	if t.OTLPEndpoint != "" {
+		tm["otlpEndpoint"] = t.OTLPEndpoint
+	}
+	return tm, nil
+}
+
 var parseContext context.Context
 
 type parsedFile struct{}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// connectionNameKey is the gRPC metadata key that the root daemon uses to tell the connector's
+// traffic-manager proxy which one of the connector's connections a call is intended for.
+const connectionNameKey = "x-telepresence-connection"
+
+// DefaultConnectionName is the name of the connection that is created by a connect that doesn't
+// specify a name. It's equivalent to an empty name.
+const DefaultConnectionName = "default"
+
+// NormalizeConnectionName returns the empty string for DefaultConnectionName and the given name
+// otherwise.
+func NormalizeConnectionName(name string) string {
+	if name == DefaultConnectionName {
+		return ""
+	}
+	return name
+}
+
+// ConnectionName returns the connection name that was passed in the metadata of an incoming
+// gRPC call, or the empty string when no name was passed.
+func ConnectionName(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vs := md.Get(connectionNameKey); len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
+
+// namedConn is a grpc.ClientConnInterface that adds a connection name to the outgoing metadata of
+// all calls.
+type namedConn struct {
+	grpc.ClientConnInterface
+	name string
+}
+
+// WithConnectionName returns a grpc.ClientConnInterface that passes the given connection name
+// in the metadata of all calls made using the given connection. The connection is returned
+// unchanged when the name is empty.
+func WithConnectionName(conn grpc.ClientConnInterface, name string) grpc.ClientConnInterface {
+	if name == "" {
+		return conn
+	}
+	return &namedConn{ClientConnInterface: conn, name: name}
+}
+
+func (c *namedConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return c.ClientConnInterface.Invoke(metadata.AppendToOutgoingContext(ctx, connectionNameKey, c.name), method, args, reply, opts...)
+}
+
+func (c *namedConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.ClientConnInterface.NewStream(metadata.AppendToOutgoingContext(ctx, connectionNameKey, c.name), desc, method, opts...)
+}
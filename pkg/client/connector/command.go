@@ -30,6 +30,7 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client/logging"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 const ProcessName = "connector"
@@ -63,6 +64,14 @@ type service struct {
 	connectMu   sync.Mutex
 	sharedState *sharedstate.State
 
+	// Named connections that are active at the same time as the default connection, keyed by
+	// name. Must hold connectMu to use.
+	connections map[string]*namedConnection
+
+	// managerConns dispatches the calls that the root daemon makes to the traffic-manager proxy
+	// to the traffic-manager of the right connection.
+	managerConns *userd_grpc.ManagerConns
+
 	// These are used to communicate between the various goroutines.
 	scout           chan ScoutReport          // any-of-scoutUsers -> background-metriton
 	connectRequest  chan parsedConnectRequest // server-grpc.connect() -> connectWorker
@@ -97,6 +106,16 @@ func (s *service) connect(c context.Context, cr *rpc.ConnectRequest, dryRun bool
 	s.connectMu.Lock()
 	defer s.connectMu.Unlock()
 
+	if name := client.NormalizeConnectionName(cr.Name); name != "" {
+		return s.connectNamed(c, cr, name, dryRun)
+	}
+	ci := s.connectDefault(c, cr, dryRun)
+	ci.ConnectionNames = s.connectionNames()
+	return ci
+}
+
+// connectDefault connects the default connection. Must be called with connectMu held.
+func (s *service) connectDefault(c context.Context, cr *rpc.ConnectRequest, dryRun bool) *rpc.ConnectInfo {
 	config, err := userd_k8s.NewConfig(c, cr.KubeFlags)
 	if err != nil && !dryRun {
 		return connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
@@ -122,7 +141,11 @@ func (s *service) connect(c context.Context, cr *rpc.ConnectRequest, dryRun bool
 				ClusterId:      cluster.GetClusterId(c),
 				IngressInfos:   ingressInfo,
 			}
-			s.sharedState.GetTrafficManagerNonBlocking().SetStatus(c, ret)
+			tmgr := s.sharedState.GetTrafficManagerNonBlocking()
+			if cr.RestoreIntercepts && tmgr != nil {
+				ret.RestoredIntercepts = tmgr.RestoreIntercepts(c)
+			}
+			tmgr.SetStatus(c, ret)
 			return ret
 		} else {
 			ret := &rpc.ConnectInfo{
@@ -152,7 +175,7 @@ func (s *service) connect(c context.Context, cr *rpc.ConnectRequest, dryRun bool
 	}
 }
 
-func (s *service) connectWorker(c context.Context, cr *rpc.ConnectRequest, k8sConfig *userd_k8s.Config, svc *grpc.Server) *rpc.ConnectInfo {
+func (s *service) connectWorker(c context.Context, cr *rpc.ConnectRequest, k8sConfig *userd_k8s.Config) *rpc.ConnectInfo {
 	mappedNamespaces := cr.MappedNamespaces
 	if len(mappedNamespaces) == 1 && mappedNamespaces[0] == "all" {
 		mappedNamespaces = nil
@@ -223,10 +246,11 @@ func (s *service) connectWorker(c context.Context, cr *rpc.ConnectRequest, k8sCo
 		s.scoutClient.Reporter.InstallID(),
 		userd_trafficmgr.Callbacks{
 			GetCloudAPIKey: s.sharedState.GetCloudAPIKey,
-			RegisterManagerServer: func(mgrSrv manager.ManagerServer) {
-				manager.RegisterManagerServer(svc, mgrSrv)
+			SetManagerConn: func(conn grpc.ClientConnInterface) {
+				s.managerConns.Set("", conn)
 			},
 			SetOutboundInfo: daemonClient.SetOutboundInfo,
+			Notify:          Notify,
 		})
 	if err != nil {
 		dlog.Errorf(c, "Unable to connect to TrafficManager: %s", err)
@@ -275,6 +299,9 @@ func (s *service) connectWorker(c context.Context, cr *rpc.ConnectRequest, k8sCo
 		ClusterId:      cluster.GetClusterId(c),
 		IngressInfos:   ingressInfo,
 	}
+	if cr.RestoreIntercepts {
+		ret.RestoredIntercepts = tmgr.RestoreIntercepts(c)
+	}
 	tmgr.SetStatus(c, ret)
 	return ret
 }
@@ -292,6 +319,14 @@ func run(c context.Context) error {
 		return err
 	}
 
+	shutdownTracing, err := tracing.Init(c, ProcessName, cfg.Tracing.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(dcontext.WithoutCancel(c))
+	}()
+
 	// Listen on domain unix domain socket or windows named pipe. The listener must be opened
 	// before other tasks because the CLI client will only wait for a short period of time for
 	// the socket/pipe to appear before it gives up.
@@ -310,6 +345,8 @@ func run(c context.Context) error {
 		scout:           make(chan ScoutReport, 10),
 		connectRequest:  make(chan parsedConnectRequest),
 		connectResponse: make(chan *rpc.ConnectInfo),
+		connections:     make(map[string]*namedConnection),
+		managerConns:    userd_grpc.NewManagerConns(),
 	}
 	if s.sharedState, err = sharedstate.NewState(c, ProcessName); err != nil {
 		return err
@@ -334,8 +371,6 @@ func run(c context.Context) error {
 	dlog.Infof(c, "PID is %d", os.Getpid())
 	dlog.Info(c, "")
 
-	svcCh := make(chan *grpc.Server, 1)
-
 	grpcQuitCh := make(chan func()) // Channel uses to propagate the grpcQuit cancel function. It must originate inside "server-grpc".
 	g.Go("server-grpc", func(c context.Context) (err error) {
 		// Prevent that the gRPC server is stopped before the "background-manager" completes. Termination goes like this:
@@ -351,7 +386,6 @@ func run(c context.Context) error {
 		close(grpcQuitCh)
 
 		defer func() {
-			close(svcCh)
 			if perr := derror.PanicToError(recover()); perr != nil {
 				dlog.Error(c, perr)
 			}
@@ -372,7 +406,7 @@ func run(c context.Context) error {
 			}
 		}()
 
-		opts := []grpc.ServerOption{}
+		opts := tracing.ServerOptions()
 		cfg := client.GetConfig(c)
 		if !cfg.Grpc.MaxReceiveSize.IsZero() {
 			if mz, ok := cfg.Grpc.MaxReceiveSize.AsInt64(); ok {
@@ -385,10 +419,13 @@ func run(c context.Context) error {
 				InterceptStatus: s.interceptStatus,
 				Cancel:          s.cancel,
 				Connect:         s.connect,
+				Disconnect:      s.disconnect,
 			},
 			s.sharedState,
 		))
-		svcCh <- svc
+
+		// The root daemon talks to the traffic-manager of each connection through this proxy.
+		manager.RegisterManagerServer(svc, userd_grpc.NewManagerProxy(manager.NewManagerClient(s.managerConns)))
 
 		sc := &dhttp.ServerConfig{
 			Handler: svc,
@@ -413,11 +450,7 @@ func run(c context.Context) error {
 		if !ok {
 			return nil
 		}
-		svc, ok := <-svcCh
-		if !ok {
-			return nil
-		}
-		s.connectResponse <- s.connectWorker(c, pcr.ConnectRequest, pcr.Config, svc)
+		s.connectResponse <- s.connectWorker(c, pcr.ConnectRequest, pcr.Config)
 
 		return nil
 	})
@@ -448,6 +481,13 @@ func run(c context.Context) error {
 		return mgr.Run(c)
 	})
 
+	// background-connections closes the named connections when the connector quits.
+	g.Go("background-connections", func(c context.Context) error {
+		<-c.Done()
+		s.closeConnections(dcontext.WithoutCancel(c))
+		return nil
+	})
+
 	// background-systema runs a localhost HTTP server for handling callbacks from the
 	// Ambassador Cloud login flow.
 	g.Go("background-systema", s.sharedState.LoginExecutor.Worker)
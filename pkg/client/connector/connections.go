@@ -0,0 +1,233 @@
+package connector
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/sharedstate"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_k8s"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_trafficmgr"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// namedConnection is a connection to a cluster that is active at the same time as the default
+// connection. Each named connection has its own traffic-manager session, and the root daemon
+// routes the subnets and DNS names of each connection to the traffic-manager of that connection.
+// Intercepts are always created using the default connection.
+type namedConnection struct {
+	cluster    *userd_k8s.Cluster
+	tmgr       sharedstate.TrafficManager
+	daemonConn *grpc.ClientConn
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// close ends the traffic-manager session of the connection, waits for its goroutines to exit,
+// and tells the root daemon to remove the routes and DNS configuration of the connection.
+func (nc *namedConnection) close(c context.Context, name string) {
+	nc.cancel()
+	<-nc.done
+	c, cancel := context.WithTimeout(c, 2*time.Second)
+	defer cancel()
+	if _, err := daemon.NewDaemonClient(nc.daemonConn).Disconnect(c, &daemon.DisconnectRequest{ConnectionName: name}); err != nil {
+		dlog.Errorf(c, "unable to remove connection %q from the daemon: %v", name, err)
+	}
+	_ = nc.daemonConn.Close()
+}
+
+// connectionNames returns the sorted names of the named connections. Must be called with
+// connectMu held.
+func (s *service) connectionNames() []string {
+	names := make([]string, 0, len(s.connections))
+	for name := range s.connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// connectNamed connects, or reports the status of, the connection with the given name. Must be
+// called with connectMu held.
+func (s *service) connectNamed(c context.Context, cr *rpc.ConnectRequest, name string, dryRun bool) *rpc.ConnectInfo {
+	config, err := userd_k8s.NewConfig(c, cr.KubeFlags)
+	if err != nil && !dryRun {
+		return connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
+	}
+	if nc, ok := s.connections[name]; ok {
+		ret := &rpc.ConnectInfo{
+			Error:          rpc.ConnectInfo_ALREADY_CONNECTED,
+			ClusterContext: nc.cluster.Config.Context,
+			ClusterServer:  nc.cluster.Config.Server,
+			ClusterId:      nc.cluster.GetClusterId(c),
+			ConnectionName: name,
+		}
+		if !dryRun && !nc.cluster.Config.ContextServiceAndFlagsEqual(config) {
+			ret.Error = rpc.ConnectInfo_MUST_RESTART
+		}
+		nc.tmgr.SetStatus(c, ret)
+		return ret
+	}
+	if dryRun {
+		return &rpc.ConnectInfo{
+			Error:          rpc.ConnectInfo_DISCONNECTED,
+			ConnectionName: name,
+		}
+	}
+	nc, ret := s.startConnection(c, cr, name, config)
+	if nc != nil {
+		s.connections[name] = nc
+	}
+	ret.ConnectionName = name
+	return ret
+}
+
+// startConnection creates a named connection. The returned connection is nil when the connection
+// couldn't be established, and the returned ConnectInfo then describes the error.
+func (s *service) startConnection(c context.Context, cr *rpc.ConnectRequest, name string, k8sConfig *userd_k8s.Config) (*namedConnection, *rpc.ConnectInfo) {
+	mappedNamespaces := cr.MappedNamespaces
+	if len(mappedNamespaces) == 1 && mappedNamespaces[0] == "all" {
+		mappedNamespaces = nil
+	}
+	sort.Strings(mappedNamespaces)
+
+	s.scout <- ScoutReport{
+		Action: "connect_named",
+	}
+
+	dlog.Infof(c, "Connecting connection %q to daemon...", name)
+	conn, err := client.DialSocket(c, client.DaemonSocketName)
+	if err != nil {
+		return nil, connectError(rpc.ConnectInfo_DAEMON_FAILED, err)
+	}
+	daemonClient := daemon.NewDaemonClient(conn)
+
+	// The connection outlives the request that creates it. It ends when it's disconnected or
+	// when the connector quits.
+	ctx, cancel := context.WithCancel(dcontext.WithoutCancel(c))
+	ctx = dgroup.WithGoroutineName(ctx, "/"+name)
+	nc := &namedConnection{daemonConn: conn, cancel: cancel, done: make(chan struct{})}
+	fail := func(t rpc.ConnectInfo_ErrType, err error) (*namedConnection, *rpc.ConnectInfo) {
+		dlog.Errorf(c, "unable to connect connection %q: %v", name, err)
+		cancel()
+		_ = conn.Close()
+		return nil, connectError(t, err)
+	}
+
+	dlog.Infof(c, "Connecting connection %q to k8s cluster...", name)
+	cluster, err := func() (*userd_k8s.Cluster, error) {
+		tc, cancel := client.GetConfig(c).Timeouts.TimeoutContext(c, client.TimeoutClusterConnect)
+		defer cancel()
+		return userd_k8s.NewCluster(tc,
+			k8sConfig,
+			mappedNamespaces,
+			userd_k8s.Callbacks{
+				SetDNSSearchPath: func(ctx context.Context, in *daemon.Paths, opts ...grpc.CallOption) (*empty.Empty, error) {
+					in.ConnectionName = name
+					return daemonClient.SetDnsSearchPath(ctx, in, opts...)
+				},
+			},
+		)
+	}()
+	if err != nil {
+		return fail(rpc.ConnectInfo_CLUSTER_FAILED, err)
+	}
+	nc.cluster = cluster
+	dlog.Infof(c, "Connection %q connected to context %s (%s)", name, cluster.Context, cluster.Server)
+
+	tmgr, err := userd_trafficmgr.New(ctx,
+		cluster,
+		s.scoutClient.Reporter.InstallID(),
+		userd_trafficmgr.Callbacks{
+			GetCloudAPIKey: s.sharedState.GetCloudAPIKey,
+			SetManagerConn: func(conn grpc.ClientConnInterface) {
+				s.managerConns.Set(name, conn)
+			},
+			SetOutboundInfo: func(ctx context.Context, in *daemon.OutboundInfo, opts ...grpc.CallOption) (*empty.Empty, error) {
+				in.ConnectionName = name
+				return daemonClient.SetOutboundInfo(ctx, in, opts...)
+			},
+			Notify: Notify,
+		})
+	if err != nil {
+		return fail(rpc.ConnectInfo_TRAFFIC_MANAGER_FAILED, err)
+	}
+	nc.tmgr = tmgr
+
+	go func() {
+		defer close(nc.done)
+		g := dgroup.NewGroup(ctx, dgroup.GroupConfig{})
+		g.Go("k8swatch", cluster.RunWatchers)
+		g.Go("manager", tmgr.Run)
+		if err := g.Wait(); err != nil {
+			dlog.Errorf(ctx, "connection %q ended with: %v", name, err)
+		}
+		s.managerConns.Delete(name)
+	}()
+
+	tc, tCancel := client.GetConfig(c).Timeouts.TimeoutContext(c, client.TimeoutTrafficManagerConnect)
+	defer tCancel()
+	if _, err := tmgr.GetClientBlocking(tc); err != nil {
+		nc.close(c, name)
+		return nil, connectError(rpc.ConnectInfo_TRAFFIC_MANAGER_FAILED, err)
+	}
+	if err = cluster.WaitUntilReady(c); err != nil {
+		nc.close(c, name)
+		return nil, connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
+	}
+	ingressInfo, err := cluster.DetectIngressBehavior(c)
+	if err != nil {
+		nc.close(c, name)
+		return nil, connectError(rpc.ConnectInfo_CLUSTER_FAILED, err)
+	}
+
+	ret := &rpc.ConnectInfo{
+		Error:          rpc.ConnectInfo_UNSPECIFIED,
+		ClusterContext: cluster.Config.Context,
+		ClusterServer:  cluster.Config.Server,
+		ClusterId:      cluster.GetClusterId(c),
+		IngressInfos:   ingressInfo,
+	}
+	tmgr.SetStatus(c, ret)
+	return nc, ret
+}
+
+// disconnect closes the named connection with the given name and tells the root daemon to remove
+// its routes and DNS configuration.
+func (s *service) disconnect(c context.Context, name string) error {
+	name = client.NormalizeConnectionName(name)
+	if name == "" {
+		return errcat.User.New("the default connection cannot be disconnected; use quit to end it")
+	}
+	s.connectMu.Lock()
+	nc, ok := s.connections[name]
+	delete(s.connections, name)
+	s.connectMu.Unlock()
+	if !ok {
+		return errcat.User.Newf("there is no connection named %q", name)
+	}
+	dlog.Infof(c, "Disconnecting connection %q", name)
+	nc.close(c, name)
+	return nil
+}
+
+// closeConnections closes all named connections.
+func (s *service) closeConnections(c context.Context) {
+	s.connectMu.Lock()
+	ncs := s.connections
+	s.connections = make(map[string]*namedConnection)
+	s.connectMu.Unlock()
+	for name, nc := range ncs {
+		dlog.Infof(c, "Closing connection %q", name)
+		nc.close(c, name)
+	}
+}
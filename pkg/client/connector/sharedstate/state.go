@@ -35,6 +35,8 @@ type TrafficManager interface {
 
 	AddIntercept(context.Context, *connector.CreateInterceptRequest) (*connector.InterceptResult, error)
 	RemoveIntercept(context.Context, string) error
+	RestoreIntercepts(context.Context) []*connector.InterceptResult
+	WatchInterceptEvents(context.Context, string) (manager.Manager_WatchInterceptEventsClient, error)
 	WorkloadInfoSnapshot(context.Context, *connector.ListRequest) *connector.WorkloadInfoSnapshot
 	Uninstall(context.Context, *connector.UninstallRequest) (*connector.UninstallResult, error)
 	SetStatus(context.Context, *connector.ConnectInfo)
@@ -0,0 +1,69 @@
+package userd_grpc
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+// ManagerConns is a grpc.ClientConnInterface that dispatches each call to the traffic-manager
+// connection of the connector connection that is named in the metadata of the incoming call. It
+// makes it possible to register one manager proxy that serves all connections.
+type ManagerConns struct {
+	mu    sync.RWMutex
+	conns map[string]grpc.ClientConnInterface
+}
+
+// NewManagerConns returns a ManagerConns that has no connections.
+func NewManagerConns() *ManagerConns {
+	return &ManagerConns{conns: make(map[string]grpc.ClientConnInterface)}
+}
+
+// Set makes calls for the connection with the given name use the given traffic-manager connection.
+func (m *ManagerConns) Set(name string, conn grpc.ClientConnInterface) {
+	m.mu.Lock()
+	m.conns[name] = conn
+	m.mu.Unlock()
+}
+
+// Delete removes the traffic-manager connection of the connection with the given name.
+func (m *ManagerConns) Delete(name string) {
+	m.mu.Lock()
+	delete(m.conns, name)
+	m.mu.Unlock()
+}
+
+func (m *ManagerConns) get(ctx context.Context) (grpc.ClientConnInterface, error) {
+	name := client.ConnectionName(ctx)
+	m.mu.RLock()
+	conn, ok := m.conns[name]
+	m.mu.RUnlock()
+	if !ok {
+		if name == "" {
+			return nil, status.Error(codes.Unavailable, "not connected to a traffic-manager")
+		}
+		return nil, status.Errorf(codes.Unavailable, "connection %q is not connected to a traffic-manager", name)
+	}
+	return conn, nil
+}
+
+func (m *ManagerConns) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	conn, err := m.get(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (m *ManagerConns) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, err := m.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.NewStream(ctx, desc, method, opts...)
+}
@@ -0,0 +1,72 @@
+package userd_grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+)
+
+// recordingConn is a grpc.ClientConnInterface that records the calls made to it.
+type recordingConn struct {
+	calls []string
+}
+
+func (c *recordingConn) Invoke(_ context.Context, method string, _, _ interface{}, _ ...grpc.CallOption) error {
+	c.calls = append(c.calls, method)
+	return nil
+}
+
+func (c *recordingConn) NewStream(_ context.Context, _ *grpc.StreamDesc, method string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+	c.calls = append(c.calls, method)
+	return nil, nil
+}
+
+// serverConn is a grpc.ClientConnInterface that passes the outgoing metadata of calls on as
+// incoming metadata, the way it would be received by a gRPC server.
+type serverConn struct {
+	next grpc.ClientConnInterface
+}
+
+func incoming(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func (c *serverConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return c.next.Invoke(incoming(ctx), method, args, reply, opts...)
+}
+
+func (c *serverConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.next.NewStream(incoming(ctx), desc, method, opts...)
+}
+
+func TestManagerConns(t *testing.T) {
+	ctx := context.Background()
+	defaultConn := &recordingConn{}
+	stagingConn := &recordingConn{}
+	mcs := NewManagerConns()
+	mcs.Set("", defaultConn)
+	mcs.Set("staging", stagingConn)
+
+	srv := &serverConn{next: mcs}
+	require.NoError(t, client.WithConnectionName(srv, "").Invoke(ctx, "/default", nil, nil))
+	require.NoError(t, client.WithConnectionName(srv, "staging").Invoke(ctx, "/staging", nil, nil))
+	_, err := client.WithConnectionName(srv, "staging").NewStream(ctx, &grpc.StreamDesc{}, "/staging-stream")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/default"}, defaultConn.calls)
+	assert.Equal(t, []string{"/staging", "/staging-stream"}, stagingConn.calls)
+
+	mcs.Delete("staging")
+	err = client.WithConnectionName(srv, "staging").Invoke(ctx, "/staging", nil, nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	err = client.WithConnectionName(srv, "unknown").Invoke(ctx, "/unknown", nil, nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sync/atomic"
 	"time"
@@ -28,6 +29,7 @@ type Callbacks struct {
 	InterceptStatus func() *rpc.InterceptResult
 	Cancel          func()
 	Connect         func(c context.Context, cr *rpc.ConnectRequest, dryRun bool) *rpc.ConnectInfo
+	Disconnect      func(c context.Context, name string) error
 }
 
 type service struct {
@@ -142,6 +144,32 @@ func (s *service) RemoveIntercept(c context.Context, rr *manager.RemoveIntercept
 	return result, nil
 }
 
+func (s *service) WatchInterceptEvents(rq *manager.InterceptEventsRequest, stream rpc.Connector_WatchInterceptEventsServer) error {
+	ctx := s.callCtx(stream.Context(), "WatchInterceptEvents")
+	dlog.Debug(ctx, "called")
+	defer dlog.Debug(ctx, "returned")
+	mgr, err := s.sharedState.GetTrafficManagerBlocking(ctx)
+	if mgr == nil {
+		return err
+	}
+	events, err := mgr.WatchInterceptEvents(ctx, rq.Name)
+	if err != nil {
+		return err
+	}
+	for {
+		event, err := events.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err = stream.Send(event); err != nil {
+			return err
+		}
+	}
+}
+
 func (s *service) List(c context.Context, lr *rpc.ListRequest) (result *rpc.WorkloadInfoSnapshot, err error) {
 	c = s.callCtx(c, "List")
 	dlog.Debug(c, "called")
@@ -296,3 +324,11 @@ func (s *service) Quit(ctx context.Context, _ *empty.Empty) (*empty.Empty, error
 	dlog.Debug(ctx, "returned")
 	return &empty.Empty{}, nil
 }
+
+func (s *service) Disconnect(ctx context.Context, dr *rpc.DisconnectRequest) (*empty.Empty, error) {
+	ctx = s.callCtx(ctx, "Disconnect")
+	dlog.Debug(ctx, "called")
+	err := s.callbacks.Disconnect(ctx, dr.Name)
+	dlog.Debug(ctx, "returned")
+	return &empty.Empty{}, err
+}
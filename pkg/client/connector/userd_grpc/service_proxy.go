@@ -110,10 +110,55 @@ func (p *mgrProxy) RemoveIntercept(ctx context.Context, arg *managerrpc.RemoveIn
 func (p *mgrProxy) UpdateIntercept(ctx context.Context, arg *managerrpc.UpdateInterceptRequest) (*managerrpc.InterceptInfo, error) {
 	return p.client.UpdateIntercept(ctx, arg, p.callOptions...)
 }
+func (p *mgrProxy) ReportInterceptHealth(ctx context.Context, arg *managerrpc.InterceptHealthRequest) (*managerrpc.InterceptInfo, error) {
+	return p.client.ReportInterceptHealth(ctx, arg, p.callOptions...)
+}
 func (p *mgrProxy) ReviewIntercept(ctx context.Context, arg *managerrpc.ReviewInterceptRequest) (*empty.Empty, error) {
 	return p.client.ReviewIntercept(ctx, arg, p.callOptions...)
 }
 
+func (p *mgrProxy) ReportInterceptEvents(managerrpc.Manager_ReportInterceptEventsServer) error {
+	return errors.New("must call manager.ReportInterceptEvents from an agent (intercepted Pod), not from a client (workstation)")
+}
+
+func (p *mgrProxy) WatchInterceptEvents(arg *managerrpc.InterceptEventsRequest, srv managerrpc.Manager_WatchInterceptEventsServer) error {
+	cli, err := p.client.WatchInterceptEvents(srv.Context(), arg, p.callOptions...)
+	if err != nil {
+		return err
+	}
+	for {
+		event, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF || srv.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err = srv.Send(event); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *mgrProxy) WatchNotifications(arg *managerrpc.SessionInfo, srv managerrpc.Manager_WatchNotificationsServer) error {
+	cli, err := p.client.WatchNotifications(srv.Context(), arg, p.callOptions...)
+	if err != nil {
+		return err
+	}
+	for {
+		notification, err := cli.Recv()
+		if err != nil {
+			if err == io.EOF || srv.Context().Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err = srv.Send(notification); err != nil {
+			return err
+		}
+	}
+}
+
 func (p *mgrProxy) ClientTunnel(fhDaemon managerrpc.Manager_ClientTunnelServer) error {
 	ctx := fhDaemon.Context()
 	fhManager, err := p.client.ClientTunnel(ctx, p.callOptions...)
@@ -269,6 +314,18 @@ func (p *mgrProxy) WatchLookupHost(_ *managerrpc.SessionInfo, server managerrpc.
 	return errors.New("must call manager.WatchLookupHost from an agent (intercepted Pod), not from a client (workstation)")
 }
 
+func (p *mgrProxy) LookupDNS(ctx context.Context, arg *managerrpc.DNSRequest) (*managerrpc.DNSResponse, error) {
+	return p.client.LookupDNS(ctx, arg, p.callOptions...)
+}
+
+func (p *mgrProxy) AgentLookupDNSResponse(ctx context.Context, arg *managerrpc.DNSAgentResponse) (*empty.Empty, error) {
+	return p.client.AgentLookupDNSResponse(ctx, arg, p.callOptions...)
+}
+
+func (p *mgrProxy) WatchLookupDNS(_ *managerrpc.SessionInfo, server managerrpc.Manager_WatchLookupDNSServer) error {
+	return errors.New("must call manager.WatchLookupDNS from an agent (intercepted Pod), not from a client (workstation)")
+}
+
 func (p *mgrProxy) WatchClusterInfo(arg *managerrpc.SessionInfo, srv managerrpc.Manager_WatchClusterInfoServer) error {
 	cli, err := p.client.WatchClusterInfo(srv.Context(), arg, p.callOptions...)
 	if err != nil {
@@ -0,0 +1,67 @@
+package userd_k8s
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// tokenCapturer is a http.RoundTripper that records the bearer token of the requests that it sends.
+type tokenCapturer struct {
+	sync.Mutex
+	rt    http.RoundTripper
+	token string
+}
+
+func (tc *tokenCapturer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		tc.Lock()
+		tc.token = strings.TrimPrefix(auth, "Bearer ")
+		tc.Unlock()
+	}
+	return tc.rt.RoundTrip(req)
+}
+
+// BearerToken returns the bearer token that the kubeconfig uses to authenticate with the cluster. Tokens that
+// are provided by an exec or auth-provider plugin are obtained by sending a request to the API server, since
+// such tokens are only known once the plugin has run.
+func (kf *Config) BearerToken(ctx context.Context) (string, error) {
+	if kf.config.BearerToken != "" {
+		return kf.config.BearerToken, nil
+	}
+	if kf.config.BearerTokenFile != "" {
+		token, err := os.ReadFile(kf.config.BearerTokenFile)
+		if err != nil {
+			return "", errcat.Config.Newf("unable to read the bearer token of context %q: %w", kf.Context, err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	cfg := rest.CopyConfig(kf.config)
+	capturer := &tokenCapturer{}
+	cfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		capturer.rt = rt
+		return capturer
+	})
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// The outcome of the request doesn't matter. Only its authorization header does.
+	_ = cs.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx)
+
+	capturer.Lock()
+	defer capturer.Unlock()
+	if capturer.token == "" {
+		return "", errcat.Config.Newf(
+			"the traffic-manager requires a bearer token, but the user of context %q doesn't authenticate with one", kf.Context)
+	}
+	return capturer.token, nil
+}
@@ -11,8 +11,6 @@ import (
 	"google.golang.org/grpc"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 	corev1 "k8s.io/api/core/v1"
-	k8err "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 
 	"github.com/datawire/ambassador/v2/pkg/kates"
@@ -126,45 +124,6 @@ func (kc *Cluster) check(c context.Context) error {
 	return c.Err()
 }
 
-// Deployments returns all deployments found in the given Namespace
-func (kc *Cluster) Deployments(c context.Context, namespace string) ([]kates.Object, error) {
-	var deployments []*kates.Deployment
-	if err := kc.client.List(c, kates.Query{Kind: "Deployment", Namespace: namespace}, &deployments); err != nil {
-		return nil, err
-	}
-	objs := make([]kates.Object, len(deployments))
-	for i, dep := range deployments {
-		objs[i] = dep
-	}
-	return objs, nil
-}
-
-// ReplicaSets returns all replica sets found in the given Namespace
-func (kc *Cluster) ReplicaSets(c context.Context, namespace string) ([]kates.Object, error) {
-	var replicaSets []*kates.ReplicaSet
-	if err := kc.client.List(c, kates.Query{Kind: "ReplicaSet", Namespace: namespace}, &replicaSets); err != nil {
-		return nil, err
-	}
-	objs := make([]kates.Object, len(replicaSets))
-	for i, rs := range replicaSets {
-		objs[i] = rs
-	}
-	return objs, nil
-}
-
-// StatefulSets returns all stateful sets found in the given Namespace
-func (kc *Cluster) StatefulSets(c context.Context, namespace string) ([]kates.Object, error) {
-	var statefulSets []*kates.StatefulSet
-	if err := kc.client.List(c, kates.Query{Kind: "StatefulSet", Namespace: namespace}, &statefulSets); err != nil {
-		return nil, err
-	}
-	objs := make([]kates.Object, len(statefulSets))
-	for i, ss := range statefulSets {
-		objs[i] = ss
-	}
-	return objs, nil
-}
-
 // Pods returns all pods found in the given Namespace
 func (kc *Cluster) Pods(c context.Context, namespace string) ([]*kates.Pod, error) {
 	var pods []*kates.Pod
@@ -233,32 +192,6 @@ func (kc *Cluster) FindPod(c context.Context, namespace, name string) (*kates.Po
 	return pod, nil
 }
 
-// FindWorkload returns a workload for the given name and namespace. We
-// search in a specific order based on how we prefer workload objects:
-// 1. Deployments
-// 2. ReplicaSets
-// 3. StatefulSets
-// And return the kind as soon as we find one that matches
-func (kc *Cluster) FindWorkload(c context.Context, namespace, name string) (kates.Object, error) {
-	type workLoad struct {
-		kind string
-		obj  kates.Object
-	}
-	for _, wl := range []workLoad{{"Deployment", &kates.Deployment{}}, {"ReplicaSet", &kates.ReplicaSet{}}, {"StatefulSet", &kates.StatefulSet{}}} {
-		wl.obj.(schema.ObjectKind).SetGroupVersionKind(schema.GroupVersionKind{Kind: wl.kind})
-		wl.obj.SetName(name)
-		wl.obj.SetNamespace(namespace)
-		if err := kc.client.Get(c, wl.obj, wl.obj); err != nil {
-			if kates.IsNotFound(err) {
-				continue
-			}
-			return nil, err
-		}
-		return wl.obj, nil
-	}
-	return nil, k8err.NewNotFound(corev1.Resource("workload"), name+"."+namespace)
-}
-
 // FindSvc finds a service with the given name in the given Namespace and returns
 // either a copy of that service or nil if no such service could be found.
 func (kc *Cluster) FindSvc(c context.Context, namespace, name string) (*kates.Service, error) {
@@ -52,13 +52,16 @@ func (tm *trafficManager) setCurrentAgents(agents []*manager.AgentInfo) {
 	tm.currentAgentsLock.Unlock()
 }
 
+// agentInfoWatcher keeps the current agents in sync with the traffic-manager. The watch is
+// established again when the stream ends, e.g. because a new traffic-manager took over after a
+// failover.
 func (tm *trafficManager) agentInfoWatcher(ctx context.Context) error {
 	backoff := 100 * time.Millisecond
 	for ctx.Err() == nil {
 		<-tm.startup
 		stream, err := tm.managerClient.WatchAgents(ctx, tm.session())
-		if err != nil {
-			err = fmt.Errorf("manager.WatchAgents dial: %w", err)
+		if err != nil && ctx.Err() == nil {
+			dlog.Errorf(ctx, "manager.WatchAgents dial: %v", err)
 		}
 		for err == nil && ctx.Err() == nil {
 			snapshot, err := stream.Recv()
@@ -69,6 +72,7 @@ func (tm *trafficManager) agentInfoWatcher(ctx context.Context) error {
 				tm.setCurrentAgents(nil)
 				break
 			}
+			backoff = 100 * time.Millisecond
 			tm.setCurrentAgents(snapshot.Agents)
 
 			// Notify waiters for agents
@@ -93,8 +97,20 @@ func (tm *trafficManager) agentInfoWatcher(ctx context.Context) error {
 	return nil
 }
 
-func (tm *trafficManager) addAgent(c context.Context, namespace, agentName, svcName, svcPortIdentifier, agentImageName string) *rpc.InterceptResult {
-	svcUID, kind, err := tm.EnsureAgent(c, namespace, agentName, svcName, svcPortIdentifier, agentImageName)
+// addAgent ensures that the agent of the workload of the given spec is installed and fronts all of
+// the spec's service ports. The container ports of a spec that spans several ports are updated
+// with the numbers of the corresponding app container ports.
+func (tm *trafficManager) addAgent(c context.Context, spec *manager.InterceptSpec, agentImageName string) *rpc.InterceptResult {
+	namespace := spec.Namespace
+	agentName := spec.Agent
+	svcPortIdentifiers := []string{spec.ServicePortIdentifier}
+	if len(spec.Ports) > 0 {
+		svcPortIdentifiers = make([]string, len(spec.Ports))
+		for i, ip := range spec.Ports {
+			svcPortIdentifiers[i] = ip.ServicePortIdentifier
+		}
+	}
+	svcUID, kind, containerPorts, err := tm.EnsureAgent(c, namespace, agentName, spec.ServiceName, svcPortIdentifiers, agentImageName)
 	if err != nil {
 		if err == agentNotFound {
 			return &rpc.InterceptResult{
@@ -109,6 +125,10 @@ func (tm *trafficManager) addAgent(c context.Context, namespace, agentName, svcN
 		}
 	}
 
+	for i, cp := range containerPorts {
+		spec.Ports[i].ContainerPort = cp
+	}
+
 	dlog.Infof(c, "Waiting for agent for %s %s.%s", kind, agentName, namespace)
 	agent, err := tm.waitForAgent(c, agentName, namespace)
 	if err != nil {
@@ -0,0 +1,86 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// failoverManagerClient is a manager.ManagerClient whose first WatchAgents stream fails the way a
+// stream does when the traffic-manager goes away, and whose subsequent streams deliver a snapshot.
+type failoverManagerClient struct {
+	manager.ManagerClient
+	sync.Mutex
+	calls int
+}
+
+func (c *failoverManagerClient) WatchAgents(ctx context.Context, _ *manager.SessionInfo, _ ...grpc.CallOption) (manager.Manager_WatchAgentsClient, error) {
+	c.Lock()
+	c.calls++
+	first := c.calls == 1
+	c.Unlock()
+	stream := &fakeAgentsStream{ctx: ctx, snapshots: make(chan *manager.AgentInfoSnapshot, 1)}
+	if first {
+		stream.err = status.Error(codes.Unavailable, "transport is closing")
+	} else {
+		stream.snapshots <- &manager.AgentInfoSnapshot{Agents: []*manager.AgentInfo{{Name: "hello", Namespace: "default"}}}
+	}
+	return stream, nil
+}
+
+type fakeAgentsStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	err       error
+	snapshots chan *manager.AgentInfoSnapshot
+}
+
+func (s *fakeAgentsStream) Recv() (*manager.AgentInfoSnapshot, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case snapshot := <-s.snapshots:
+		return snapshot, nil
+	}
+}
+
+func TestAgentInfoWatcher_Failover(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+
+	mc := &failoverManagerClient{}
+	tm := &trafficManager{
+		managerClient: mc,
+		sessionInfo:   &manager.SessionInfo{SessionId: "session-1"},
+		startup:       make(chan struct{}),
+	}
+	close(tm.startup)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = tm.agentInfoWatcher(ctx)
+	}()
+
+	// The watcher reconnects after the first stream fails
+	assert.Eventually(t, func() bool {
+		_, ok := tm.getCurrentAgentsInNamespace("default")["hello"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	mc.Lock()
+	assert.Equal(t, 2, mc.calls)
+	mc.Unlock()
+}
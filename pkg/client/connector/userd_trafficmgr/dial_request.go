@@ -2,17 +2,31 @@ package userd_trafficmgr
 
 import (
 	"context"
+	"time"
 
+	"github.com/datawire/dlib/dlog"
+	"github.com/datawire/dlib/dtime"
 	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
 )
 
 func (tm *trafficManager) dialRequestWatcher(ctx context.Context) error {
 	<-tm.startup
-	// Deal with dial requests from the manager
-	dialerStream, err := tm.managerClient.WatchDial(ctx, tm.sessionInfo)
-	if err != nil {
-		return err
+	// Deal with dial requests from the manager. The watch is established again when the stream
+	// ends, e.g. because a new traffic-manager took over after a failover.
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		dialerStream, err := tm.managerClient.WatchDial(ctx, tm.sessionInfo)
+		if err != nil {
+			dlog.Errorf(ctx, "manager.WatchDial dial: %v", err)
+		} else {
+			backoff = 100 * time.Millisecond
+			tunnel.DialWaitLoop(ctx, tm.managerClient, dialerStream, tm.sessionInfo.SessionId)
+		}
+		dtime.SleepWithContext(ctx, backoff)
+		backoff *= 2
+		if backoff > 3*time.Second {
+			backoff = 3 * time.Second
+		}
 	}
-	tunnel.DialWaitLoop(ctx, tm.managerClient, dialerStream, tm.sessionInfo.SessionId)
 	return nil
 }
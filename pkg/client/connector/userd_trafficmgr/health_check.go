@@ -0,0 +1,88 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/healthcheck"
+)
+
+// interceptHealth monitors the health of the local process that handles an intercept, and reports
+// changes in its health to the traffic-manager. The traffic-manager pauses an unhealthy intercept,
+// which makes the traffic-agent forward the intercepted traffic to the app container instead.
+type interceptHealth struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	healthy bool
+	message string
+}
+
+// startHealthCheck starts monitoring the local process of the given intercept unless it's already
+// monitored, in which case the disposition of the intercept is reconciled with the health of the
+// process.
+func (tm *trafficManager) startHealthCheck(ctx context.Context, ii *manager.InterceptInfo) {
+	name := ii.Spec.Name
+	if v, ok := tm.healthChecks.Load(name); ok {
+		v.(*interceptHealth).reconcile(tm, ii)
+		return
+	}
+	ih := &interceptHealth{healthy: true}
+	ih.ctx, ih.cancel = context.WithCancel(ctx)
+	tm.healthChecks.Store(name, ih)
+	hc := ii.Spec.HealthCheck
+	go healthcheck.Monitor(ih.ctx, hc, ii.Spec.TargetHost, func(healthy bool, err error) {
+		msg := ""
+		if healthy {
+			dlog.Infof(ih.ctx, "Local process of intercept %s is healthy again, resuming the intercept", name)
+		} else {
+			msg = fmt.Sprintf("local process fails its health check: %v", err)
+			dlog.Warningf(ih.ctx, "Local process of intercept %s is unhealthy, pausing the intercept: %v", name, err)
+		}
+		ih.mu.Lock()
+		ih.healthy = healthy
+		ih.message = msg
+		ih.mu.Unlock()
+		tm.reportHealth(ih.ctx, name, healthy, msg)
+	})
+}
+
+// reconcile reports the health of the local process again if the disposition of the intercept
+// doesn't reflect it, e.g. because the intercept was reviewed again by another traffic-agent.
+func (ih *interceptHealth) reconcile(tm *trafficManager, ii *manager.InterceptInfo) {
+	ih.mu.Lock()
+	healthy, msg := ih.healthy, ih.message
+	ih.mu.Unlock()
+	if healthy == (ii.Disposition == manager.InterceptDispositionType_UNHEALTHY) {
+		go tm.reportHealth(ih.ctx, ii.Spec.Name, healthy, msg)
+	}
+}
+
+func (tm *trafficManager) reportHealth(ctx context.Context, name string, healthy bool, msg string) {
+	_, err := tm.managerClient.ReportInterceptHealth(ctx, &manager.InterceptHealthRequest{
+		Session: tm.session(),
+		Name:    name,
+		Healthy: healthy,
+		Message: msg,
+	})
+	if err != nil && ctx.Err() == nil {
+		dlog.Errorf(ctx, "failed to report the health of intercept %s: %v", name, err)
+	}
+}
+
+// reconcileHealthChecks stops the health checks for which there no longer is an intercept
+func (tm *trafficManager) reconcileHealthChecks(ctx context.Context, existingIntercepts map[string]struct{}) {
+	tm.healthChecks.Range(func(key, value interface{}) bool {
+		if _, ok := existingIntercepts[key.(string)]; !ok {
+			if _, loaded := tm.healthChecks.LoadAndDelete(key); loaded {
+				dlog.Debugf(ctx, "Stopped health check of intercept %s", key)
+				value.(*interceptHealth).cancel()
+			}
+		}
+		return true
+	})
+}
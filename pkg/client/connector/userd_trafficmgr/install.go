@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -22,6 +23,7 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_k8s"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/install/helm"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 type installer struct {
@@ -30,7 +32,7 @@ type installer struct {
 
 type Installer interface {
 	userd_k8s.ResourceFinder
-	EnsureAgent(c context.Context, namespace, name, svcName, portNameOrNumber, agentImageName string) (string, string, error)
+	EnsureAgent(c context.Context, namespace, name, svcName string, portNameOrNumbers []string, agentImageName string) (string, string, []int32, error)
 	EnsureManager(c context.Context) error
 	RemoveManagerAndAgents(c context.Context, agentsOnly bool, agents []*manager.AgentInfo) error
 }
@@ -65,7 +67,7 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 		ai := ai // pin it
 		go func() {
 			defer wg.Done()
-			agent, err := ki.FindWorkload(c, ai.Namespace, ai.Name)
+			agent, err := findWorkload(c, ki.Client(), ai.Namespace, ai.Name)
 			if err != nil {
 				if !errors2.IsNotFound(err) {
 					addError(err)
@@ -134,14 +136,22 @@ func (ki *installer) RemoveManagerAndAgents(c context.Context, agentsOnly bool,
 	return nil
 }
 
-// recreates "kubectl rollout restart <obj>" for kates.obj
+// rolloutRestart replaces the pods of the given workload without modifying it.
 func (ki *installer) rolloutRestart(c context.Context, obj kates.Object) error {
-	restartAnnotation := fmt.Sprintf(
-		`{"spec": {"template": {"metadata": {"annotations": {"%srestartedAt": "%s"}}}}}`,
-		install.DomainPrefix,
-		time.Now().Format(time.RFC3339),
-	)
-	return ki.Client().Patch(c, obj, kates.StrategicMergePatchType, []byte(restartAnnotation), obj)
+	wk, err := workloadKindOf(obj)
+	if err != nil {
+		return err
+	}
+	return wk.Restart(c, ki.Client(), obj)
+}
+
+// applyWorkload writes a modified workload to the cluster.
+func (ki *installer) applyWorkload(c context.Context, obj kates.Object) error {
+	wk, err := workloadKindOf(obj)
+	if err != nil {
+		return err
+	}
+	return wk.Apply(c, ki.Client(), obj)
 }
 
 // Finds the Referenced Service in an objects' annotations
@@ -171,10 +181,10 @@ func (ki *installer) getSvcFromObjAnnotation(c context.Context, obj kates.Object
 }
 
 // Determines if the service associated with a pre-existing intercept exists or if
-// the port to-be-intercepted has changed. It raises an error if either of these
+// the ports to-be-intercepted have changed. It raises an error if either of these
 // cases exist since to go forward with an intercept would require changing the
 // configuration of the agent.
-func checkSvcSame(_ context.Context, obj kates.Object, svcName, portNameOrNumber string) error {
+func checkSvcSame(_ context.Context, obj kates.Object, svcName string, portNameOrNumbers []string) error {
 	var actions workloadActions
 	annotationsFound, err := getAnnotation(obj, &actions)
 	if err != nil {
@@ -188,14 +198,15 @@ func checkSvcSame(_ context.Context, obj kates.Object, svcName, portNameOrNumber
 			return install.ObjErrorf(obj, "associated Service changed from %q to %q", curSvc, svcName)
 		}
 
-		// If the portNameOrNumber passed in doesn't match the referenced service
+		// If a portNameOrNumber passed in doesn't match a referenced service
 		// port name or number in the annotation, then the servicePort to be intercepted
 		// has changed.
-		if portNameOrNumber != "" {
-			curSvcPortName := actions.ReferencedServicePortName
-			curSvcPort := actions.ReferencedServicePort
-			if curSvcPortName != portNameOrNumber && curSvcPort != portNameOrNumber {
-				return install.ObjErrorf(obj, "port changed from %q to %q", curSvcPort, portNameOrNumber)
+		for _, portNameOrNumber := range portNameOrNumbers {
+			if portNameOrNumber == "" {
+				continue
+			}
+			if _, ok := actions.containerPort(portNameOrNumber); !ok {
+				return install.ObjErrorf(obj, "port changed from %q to %q", actions.ReferencedServicePort, portNameOrNumber)
 			}
 		}
 	}
@@ -263,15 +274,76 @@ func (ki *installer) getSvcForInjectedPod(
 // is installed alongside the proper workload. In doing that, it also ensures that
 // the workload is referenced by a service. Lastly, it returns the service UID
 // associated with the workload since this is where that correlation is made.
-func (ki *installer) EnsureAgent(c context.Context, namespace, name, svcName, portNameOrNumber, agentImageName string) (string, string, error) {
-	obj, err := ki.FindWorkload(c, namespace, name)
+//
+// When more than one portNameOrNumber is given, the agent will front all of them and
+// the numbers of the app container ports that corresponds to each of them are returned.
+func (ki *installer) EnsureAgent(c context.Context, namespace, name, svcName string, portNameOrNumbers []string, agentImageName string) (
+	svcUID, kind string, containerPorts []int32, err error) {
+	c, span := tracing.Start(c, "EnsureAgent",
+		attribute.String("k8s.namespace.name", namespace),
+		attribute.String("telepresence.workload", name))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	if len(portNameOrNumbers) == 0 {
+		portNameOrNumbers = []string{""}
+	}
+	svcUID, kind, obj, err := ki.ensureAgent(c, namespace, name, svcName, portNameOrNumbers, agentImageName)
+	if err != nil || len(portNameOrNumbers) == 1 {
+		return svcUID, kind, nil, err
+	}
+
+	containerPorts = make([]int32, len(portNameOrNumbers))
+	var actions workloadActions
+	ok, err := getAnnotation(obj, &actions)
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
+	if ok {
+		for i, portNameOrNumber := range portNameOrNumbers {
+			cp, ok := actions.containerPort(portNameOrNumber)
+			if !ok {
+				return "", "", nil, install.ObjErrorf(obj, "the traffic-agent doesn't front service port %q", portNameOrNumber)
+			}
+			containerPorts[i] = int32(cp)
+		}
+		return svcUID, kind, containerPorts, nil
+	}
+
+	// The agent was injected by the webhook or manually, so the pod template is unaltered.
 	podTemplate, err := install.GetPodTemplateFromObject(obj)
 	if err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
+	svc, err := install.FindMatchingService(c, ki.Client(), portNameOrNumbers[0], svcName, namespace, podTemplate.Labels)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for i, portNameOrNumber := range portNameOrNumbers {
+		servicePort, container, containerPortIndex, err := install.FindMatchingPort(podTemplate.Spec.Containers, portNameOrNumber, svc)
+		if err != nil {
+			return "", "", nil, install.ObjErrorf(obj, err.Error())
+		}
+		tp, err := resolveTakenOverPort(obj, servicePort, container, containerPortIndex)
+		if err != nil {
+			return "", "", nil, err
+		}
+		containerPorts[i] = int32(tp.number)
+	}
+	return svcUID, kind, containerPorts, nil
+}
+
+func (ki *installer) ensureAgent(c context.Context, namespace, name, svcName string, portNameOrNumbers []string, agentImageName string) (string, string, kates.Object, error) {
+	obj, err := findWorkload(c, ki.Client(), namespace, name)
+	if err != nil {
+		return "", "", nil, err
+	}
+	podTemplate, err := install.GetPodTemplateFromObject(obj)
+	if err != nil {
+		return "", "", nil, err
+	}
+	portNameOrNumber := portNameOrNumbers[0]
 
 	kind := obj.GetObjectKind().GroupVersionKind().Kind
 
@@ -282,12 +354,12 @@ func (ki *installer) EnsureAgent(c context.Context, namespace, name, svcName, po
 	if webhookInjected != manuallyManaged {
 		svc, err := ki.getSvcForInjectedPod(c, namespace, name, svcName, portNameOrNumber, podTemplate, obj)
 		if err != nil {
-			return "", "", err
+			return "", "", nil, err
 		}
-		return string(svc.GetUID()), kind, nil
+		return string(svc.GetUID()), kind, obj, nil
 	} else if webhookInjected {
 		// If both are true that's likely to cause issues, since there may be two traffic agents on the pod.
-		return "", "", fmt.Errorf("workload is misconfigured; only one of %s and %s may be set at a time, but both are", install.InjectAnnotation, install.ManualInjectAnnotation)
+		return "", "", nil, fmt.Errorf("workload is misconfigured; only one of %s and %s may be set at a time, but both are", install.InjectAnnotation, install.ManualInjectAnnotation)
 	}
 
 	var agentContainer *kates.Container
@@ -299,13 +371,13 @@ func (ki *installer) EnsureAgent(c context.Context, namespace, name, svcName, po
 		}
 	}
 
-	if err := checkSvcSame(c, obj, svcName, portNameOrNumber); err != nil {
+	if err := checkSvcSame(c, obj, svcName, portNameOrNumbers); err != nil {
 		msg := fmt.Sprintf(
 			`%s already being used for intercept with a different service
 configuration. To intercept this with your new configuration, please use
 telepresence uninstall --agent %s This will cancel any intercepts that
 already exist for this service`, kind, obj.GetName())
-		return "", "", errors.Wrap(err, msg)
+		return "", "", nil, errors.Wrap(err, msg)
 	}
 
 	update := true
@@ -313,24 +385,24 @@ already exist for this service`, kind, obj.GetName())
 	case agentContainer == nil:
 		dlog.Infof(c, "no agent found for %s %s.%s", kind, name, namespace)
 		if portNameOrNumber != "" {
-			dlog.Infof(c, "Using port name or number %q", portNameOrNumber)
+			dlog.Infof(c, "Using port names or numbers %q", portNameOrNumbers)
 		}
 		matchingSvc, err := install.FindMatchingService(c, ki.Client(), portNameOrNumber, svcName, namespace, podTemplate.Labels)
 		if err != nil {
-			return "", "", err
+			return "", "", nil, err
 		}
-		obj, svc, err = addAgentToWorkload(c, portNameOrNumber, agentImageName, ki.GetManagerNamespace(), obj, matchingSvc)
+		obj, svc, err = addAgentToWorkload(c, portNameOrNumbers, agentImageName, ki.GetManagerNamespace(), obj, matchingSvc)
 		if err != nil {
-			return "", "", err
+			return "", "", nil, err
 		}
 	case agentContainer.Image != agentImageName:
 		var actions workloadActions
 		ok, err := getAnnotation(obj, &actions)
 		if err != nil {
-			return "", "", err
+			return "", "", nil, err
 		} else if !ok {
 			// This can only happen if someone manually tampered with the annTelepresenceActions annotation
-			return "", "", install.ObjErrorf(obj, "annotations[%q]: annotation is not set", annTelepresenceActions)
+			return "", "", nil, install.ObjErrorf(obj, "annotations[%q]: annotation is not set", annTelepresenceActions)
 		}
 
 		dlog.Debugf(c, "Updating agent for %s %s.%s", kind, name, namespace)
@@ -348,16 +420,16 @@ already exist for this service`, kind, obj.GetName())
 	}
 
 	if update {
-		if err := ki.Client().Update(c, obj, obj); err != nil {
-			return "", "", err
+		if err := ki.applyWorkload(c, obj); err != nil {
+			return "", "", nil, err
 		}
 		if svc != nil {
 			if err := ki.Client().Update(c, svc, svc); err != nil {
-				return "", "", err
+				return "", "", nil, err
 			}
 		}
 		if err := ki.waitForApply(c, namespace, name, obj); err != nil {
-			return "", "", err
+			return "", "", nil, err
 		}
 	}
 
@@ -366,121 +438,47 @@ already exist for this service`, kind, obj.GetName())
 		// So we get the service from the deployments annotation so that we can extract the UID.
 		svc, err = ki.getSvcFromObjAnnotation(c, obj)
 		if err != nil {
-			return "", "", err
+			return "", "", nil, err
 		}
 	}
-	return string(svc.GetUID()), kind, nil
+	return string(svc.GetUID()), kind, obj, nil
 }
 
-// The following <workload>Updated functions all contain the logic for
-// determining if that specific workload type has successfully been updated
-// based on the object's metadata. We have separate ones for each object
-// because the criteria is slightly different for each.
-func replicaSetUpdated(rs *kates.ReplicaSet, origGeneration int64) bool {
-	applied := rs.ObjectMeta.Generation >= origGeneration &&
-		rs.Status.ObservedGeneration == rs.ObjectMeta.Generation &&
-		(rs.Spec.Replicas == nil || rs.Status.Replicas >= *rs.Spec.Replicas) &&
-		rs.Status.FullyLabeledReplicas == rs.Status.Replicas &&
-		rs.Status.AvailableReplicas == rs.Status.Replicas
-	return applied
-}
+// waitForApply waits until the modifications of the given workload have been rolled out.
+func (ki *installer) waitForApply(c context.Context, namespace, name string, obj kates.Object) (err error) {
+	c, span := tracing.Start(c, "waitForApply",
+		attribute.String("k8s.namespace.name", namespace),
+		attribute.String("telepresence.workload", name))
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-func deploymentUpdated(dep *kates.Deployment, origGeneration int64) bool {
-	applied := dep.ObjectMeta.Generation >= origGeneration &&
-		dep.Status.ObservedGeneration == dep.ObjectMeta.Generation &&
-		(dep.Spec.Replicas == nil || dep.Status.UpdatedReplicas >= *dep.Spec.Replicas) &&
-		dep.Status.UpdatedReplicas == dep.Status.Replicas &&
-		dep.Status.AvailableReplicas == dep.Status.Replicas
-	return applied
-}
-
-func statefulSetUpdated(statefulSet *kates.StatefulSet, origGeneration int64) bool {
-	applied := statefulSet.ObjectMeta.Generation >= origGeneration &&
-		statefulSet.Status.ObservedGeneration == statefulSet.ObjectMeta.Generation &&
-		(statefulSet.Spec.Replicas == nil || statefulSet.Status.UpdatedReplicas >= *statefulSet.Spec.Replicas) &&
-		statefulSet.Status.UpdatedReplicas == statefulSet.Status.Replicas &&
-		statefulSet.Status.CurrentReplicas == statefulSet.Status.Replicas
-	return applied
-}
-
-func (ki *installer) waitForApply(c context.Context, namespace, name string, obj kates.Object) error {
 	tos := &client.GetConfig(c).Timeouts
 	c, cancel := tos.TimeoutContext(c, client.TimeoutApply)
 	defer cancel()
 
-	origGeneration := int64(0)
-	if obj != nil {
-		origGeneration = obj.GetGeneration()
-	}
-
-	var err error
-	if rs, ok := obj.(*kates.ReplicaSet); ok {
-		if err = ki.refreshReplicaSet(c, namespace, rs); err != nil {
-			return err
-		}
+	wk, err := workloadKindOf(obj)
+	if err != nil {
+		return err
 	}
+	origGeneration := obj.GetGeneration()
 	for {
 		dtime.SleepWithContext(c, time.Second)
 		if err = c.Err(); err != nil {
 			return err
 		}
 
-		if obj, err = ki.FindAgain(c, obj); err != nil {
+		updated, err := wk.Updated(c, ki.Client(), obj, origGeneration)
+		if err != nil {
 			return client.CheckTimeout(c, err)
 		}
-
-		updated := false
-		switch obj := obj.(type) {
-		case *kates.ReplicaSet:
-			updated = replicaSetUpdated(obj, origGeneration)
-		case *kates.Deployment:
-			updated = deploymentUpdated(obj, origGeneration)
-		case *kates.StatefulSet:
-			updated = statefulSetUpdated(obj, origGeneration)
-		}
 		if updated {
-			dlog.Debugf(c, "%s %s.%s successfully applied", obj.GetObjectKind().GroupVersionKind().Kind, name, namespace)
+			dlog.Debugf(c, "%s %s.%s successfully applied", wk.Kind(), name, namespace)
 			return nil
 		}
 	}
 }
 
-// refreshReplicaSet finds pods owned by a given ReplicaSet and deletes them.
-// We need this because updating a Replica Set does *not* generate new
-// pods if the desired amount already exists.
-func (ki *installer) refreshReplicaSet(c context.Context, namespace string, rs *kates.ReplicaSet) error {
-	pods, err := ki.Pods(c, namespace)
-	if err != nil {
-		return err
-	}
-
-	for _, pod := range pods {
-		for _, ownerRef := range pod.OwnerReferences {
-			if ownerRef.UID == rs.UID {
-				dlog.Infof(c, "Deleting pod %s.%s owned by rs %s", pod.Name, pod.Namespace, rs.Name)
-				pod := &kates.Pod{
-					TypeMeta: kates.TypeMeta{
-						Kind: "Pod",
-					},
-					ObjectMeta: kates.ObjectMeta{
-						Namespace: pod.Namespace,
-						Name:      pod.Name,
-					},
-				}
-				if err = ki.Client().Delete(c, pod, nil); err != nil {
-					if kates.IsNotFound(err) || kates.IsConflict(err) {
-						// If an intercept creates a new pod by installing an agent, and the agent is then uninstalled shortly after, the
-						// old pod may still show up here during removal, and even after it has been removed if the removal completed
-						// after we obtained the pods list. This is OK. This pod will not be in our way.
-						continue
-					}
-				}
-			}
-		}
-	}
-	return nil
-}
-
 func getAnnotation(obj kates.Object, data completeAction) (bool, error) {
 	ann := obj.GetAnnotations()
 	if ann == nil {
@@ -525,7 +523,7 @@ func (ki *installer) undoObjectMods(c context.Context, obj kates.Object) error {
 			return err
 		}
 	}
-	return ki.Client().Update(c, obj, obj)
+	return ki.applyWorkload(c, obj)
 }
 
 func undoObjectMods(c context.Context, obj kates.Object) (string, error) {
@@ -582,12 +580,71 @@ func undoServiceMods(c context.Context, svc *kates.Service) error {
 	return nil
 }
 
+// takenOverPort is a container port that a traffic-agent will take over, along with the
+// service port that references it.
+type takenOverPort struct {
+	servicePort *kates.ServicePort
+	name        string // If the existing container port doesn't have a name, we'll make one up.
+	number      uint16
+	protocol    corev1.Protocol
+
+	// usedContainerName is true when the name was taken from the container port.
+	usedContainerName bool
+
+	// svcHasTargetPort is false when the service port relies on that the target port defaults
+	// to the port.
+	svcHasTargetPort bool
+}
+
+// resolveTakenOverPort tries to detect the container port that a traffic-agent will take over.
+func resolveTakenOverPort(object kates.Object, servicePort *kates.ServicePort, container *kates.Container, containerPortIndex int) (*takenOverPort, error) {
+	tp := &takenOverPort{servicePort: servicePort, svcHasTargetPort: true}
+
+	// Start by filling from the servicePort; if these are the zero values, that's OK.
+	if servicePort.TargetPort.Type == intstr.Int {
+		if servicePort.TargetPort.IntVal == 0 {
+			tp.number = uint16(servicePort.Port)
+			tp.svcHasTargetPort = false
+		} else {
+			tp.number = uint16(servicePort.TargetPort.IntVal)
+		}
+	} else {
+		tp.name = servicePort.TargetPort.StrVal
+	}
+	tp.protocol = servicePort.Protocol
+
+	// Now fill from the Deployment's containerPort.
+	if containerPortIndex >= 0 {
+		if tp.name == "" {
+			tp.name = container.Ports[containerPortIndex].Name
+			if tp.name != "" {
+				tp.usedContainerName = true
+			}
+		}
+		if tp.number == 0 {
+			tp.number = uint16(container.Ports[containerPortIndex].ContainerPort)
+		}
+		if tp.protocol == "" {
+			tp.protocol = container.Ports[containerPortIndex].Protocol
+		}
+	}
+	if tp.number == 0 {
+		return nil, install.ObjErrorf(object, "unable to add: the container port cannot be determined")
+	}
+	if tp.name == "" {
+		tp.name = fmt.Sprintf("tx-%d", tp.number)
+	}
+	return tp, nil
+}
+
 // addAgentToWorkload takes a given workload object and a service and
-// determines which container + port to use for an intercept. It also
-// prepares and performs modifications to the obj and/or service.
+// determines which container + ports to use for an intercept. It also
+// prepares and performs modifications to the obj and/or service. The
+// agent will front all the given service ports, but the first one is
+// considered the primary port.
 func addAgentToWorkload(
 	c context.Context,
-	portNameOrNumber string,
+	portNameOrNumbers []string,
 	agentImageName string,
 	trafficManagerNamespace string,
 	object kates.Object, matchingService *kates.Service,
@@ -600,76 +657,54 @@ func addAgentToWorkload(
 	if err != nil {
 		return nil, nil, err
 	}
-
-	cns := podTemplate.Spec.Containers
-	servicePort, container, containerPortIndex, err := install.FindMatchingPort(cns, portNameOrNumber, matchingService)
-	if err != nil {
-		return nil, nil, install.ObjErrorf(object, err.Error())
+	if len(portNameOrNumbers) == 0 {
+		portNameOrNumbers = []string{""}
 	}
-	dlog.Debugf(c, "using service %q port %q when intercepting %s %q",
-		matchingService.Name,
-		func() string {
-			if servicePort.Name != "" {
-				return servicePort.Name
-			}
-			return strconv.Itoa(int(servicePort.Port))
-		}(),
-		object.GetObjectKind().GroupVersionKind().Kind,
-		object.GetName())
-
-	version := client.Semver().String()
 
-	// Try to detect the container port we'll be taking over.
-	var containerPort struct {
-		Name     string // If the existing container port doesn't have a name, we'll make one up.
-		Number   uint16
-		Protocol corev1.Protocol
-	}
-
-	// Start by filling from the servicePort; if these are the zero values, that's OK.
-	svcHasTargetPort := true
-	if servicePort.TargetPort.Type == intstr.Int {
-		if servicePort.TargetPort.IntVal == 0 {
-			containerPort.Number = uint16(servicePort.Port)
-			svcHasTargetPort = false
-		} else {
-			containerPort.Number = uint16(servicePort.TargetPort.IntVal)
+	cns := podTemplate.Spec.Containers
+	var container *kates.Container
+	tps := make([]*takenOverPort, len(portNameOrNumbers))
+	for i, portNameOrNumber := range portNameOrNumbers {
+		servicePort, cn, containerPortIndex, err := install.FindMatchingPort(cns, portNameOrNumber, matchingService)
+		if err != nil {
+			return nil, nil, install.ObjErrorf(object, err.Error())
 		}
-	} else {
-		containerPort.Name = servicePort.TargetPort.StrVal
-	}
-	containerPort.Protocol = servicePort.Protocol
-
-	// Now fill from the Deployment's containerPort.
-	usedContainerName := false
-	if containerPortIndex >= 0 {
-		if containerPort.Name == "" {
-			containerPort.Name = container.Ports[containerPortIndex].Name
-			if containerPort.Name != "" {
-				usedContainerName = true
-			}
+		if container == nil {
+			container = cn
+		} else if cn != container {
+			return nil, nil, install.ObjErrorf(object, "service ports %q and %q belong to different containers", portNameOrNumbers[0], portNameOrNumber)
 		}
-		if containerPort.Number == 0 {
-			containerPort.Number = uint16(container.Ports[containerPortIndex].ContainerPort)
+		for _, tp := range tps[:i] {
+			if tp.servicePort == servicePort {
+				return nil, nil, install.ObjErrorf(object, "service port %q is given more than once", portNameOrNumber)
+			}
 		}
-		if containerPort.Protocol == "" {
-			containerPort.Protocol = container.Ports[containerPortIndex].Protocol
+		dlog.Debugf(c, "using service %q port %q when intercepting %s %q",
+			matchingService.Name,
+			func() string {
+				if servicePort.Name != "" {
+					return servicePort.Name
+				}
+				return strconv.Itoa(int(servicePort.Port))
+			}(),
+			object.GetObjectKind().GroupVersionKind().Kind,
+			object.GetName())
+		if tps[i], err = resolveTakenOverPort(object, servicePort, container, containerPortIndex); err != nil {
+			return nil, nil, err
 		}
 	}
-	if containerPort.Number == 0 {
-		return nil, nil, install.ObjErrorf(object, "unable to add: the container port cannot be determined")
-	}
-	if containerPort.Name == "" {
-		containerPort.Name = fmt.Sprintf("tx-%d", containerPort.Number)
-	}
+
+	version := client.Semver().String()
+	primary := tps[0]
+	servicePort := primary.servicePort
 
 	var initContainerAction *addInitContainerAction
 	setGID := false
 	if matchingService.Spec.ClusterIP == "None" {
 		setGID = true
 		initContainerAction = &addInitContainerAction{
-			AppPortProto:  containerPort.Protocol,
-			AppPortNumber: containerPort.Number,
+			AppPortProto:  primary.protocol,
+			AppPortNumber: primary.number,
 			ImageName:     agentImageName,
 		}
 	}
@@ -685,49 +720,76 @@ func addAgentToWorkload(
 			containerName:           container.Name,
 			trafficManagerNamespace: trafficManagerNamespace,
 			setGID:                  setGID,
-			ContainerPortName:       containerPort.Name,
-			ContainerPortProto:      containerPort.Protocol,
-			ContainerPortNumber:     containerPort.Number,
+			ContainerPortName:       primary.name,
+			ContainerPortProto:      primary.protocol,
+			ContainerPortNumber:     primary.number,
 			ImageName:               agentImageName,
 		},
 	}
-	// Depending on whether the Service refers to the port by name or by number, we either need
+
+	// Depending on whether the Service refers to a port by name or by number, we either need
 	// to patch the names in the deployment, or the number in the service.
 	var serviceMod *svcActions
-	if servicePort.TargetPort.Type == intstr.Int {
-		// Change the port number that the Service refers to.
-		serviceMod = &svcActions{Version: version}
-		if svcHasTargetPort {
-			serviceMod.MakePortSymbolic = &makePortSymbolicAction{
-				PortName:     servicePort.Name,
-				TargetPort:   containerPort.Number,
-				SymbolicName: containerPort.Name,
+	for i, tp := range tps {
+		var hideAction *hideContainerPortAction
+		if tp.servicePort.TargetPort.Type == intstr.Int {
+			// Change the port number that the Service refers to.
+			if serviceMod == nil {
+				serviceMod = &svcActions{Version: version}
 			}
-		} else {
-			serviceMod.AddSymbolicPort = &addSymbolicPortAction{
-				makePortSymbolicAction{
-					PortName:     servicePort.Name,
-					TargetPort:   containerPort.Number,
-					SymbolicName: containerPort.Name,
-				},
+			symbolicAction := &makePortSymbolicAction{
+				PortName:     tp.servicePort.Name,
+				TargetPort:   tp.number,
+				SymbolicName: tp.name,
 			}
-		}
-		// Since we are updating the service to use the containerPort.Name
-		// if that value came from the container, then we need to hide it
-		// since the service is using the targetPort's int.
-		if usedContainerName {
-			workloadMod.HideContainerPort = &hideContainerPortAction{
+			switch {
+			case tp.svcHasTargetPort && i == 0:
+				serviceMod.MakePortSymbolic = symbolicAction
+			case tp.svcHasTargetPort:
+				serviceMod.MakePortsSymbolic = append(serviceMod.MakePortsSymbolic, symbolicAction)
+			case i == 0:
+				serviceMod.AddSymbolicPort = &addSymbolicPortAction{*symbolicAction}
+			default:
+				serviceMod.AddSymbolicPorts = append(serviceMod.AddSymbolicPorts, &addSymbolicPortAction{*symbolicAction})
+			}
+			// Since we are updating the service to use the containerPort.Name
+			// if that value came from the container, then we need to hide it
+			// since the service is using the targetPort's int.
+			if tp.usedContainerName {
+				hideAction = &hideContainerPortAction{
+					ContainerName: container.Name,
+					PortName:      tp.name,
+					ordinal:       i,
+				}
+			}
+		} else {
+			// Hijack the port name in the Deployment.
+			hideAction = &hideContainerPortAction{
 				ContainerName: container.Name,
-				PortName:      containerPort.Name,
-				ordinal:       0,
+				PortName:      tp.name,
+				ordinal:       i,
 			}
 		}
-	} else {
-		// Hijack the port name in the Deployment.
-		workloadMod.HideContainerPort = &hideContainerPortAction{
-			ContainerName: container.Name,
-			PortName:      containerPort.Name,
-			ordinal:       0,
+
+		if i == 0 {
+			workloadMod.HideContainerPort = hideAction
+			continue
+		}
+		if hideAction != nil {
+			workloadMod.HideContainerPorts = append(workloadMod.HideContainerPorts, hideAction)
+		}
+		workloadMod.AdditionalServicePorts = append(workloadMod.AdditionalServicePorts, &referencedServicePort{
+			Port: strconv.Itoa(int(tp.servicePort.Port)),
+			Name: tp.servicePort.Name,
+		})
+		acp := &agentContainerPort{
+			ContainerPortName:   tp.name,
+			ContainerPortProto:  tp.protocol,
+			ContainerPortNumber: tp.number,
+		}
+		workloadMod.AddTrafficAgent.ExtraPorts = append(workloadMod.AddTrafficAgent.ExtraPorts, acp)
+		if initContainerAction != nil {
+			initContainerAction.ExtraPorts = append(initContainerAction.ExtraPorts, acp)
 		}
 	}
 
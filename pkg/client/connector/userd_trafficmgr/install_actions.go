@@ -270,6 +270,11 @@ type svcActions struct {
 	Version          string                  `json:"version"`
 	MakePortSymbolic *makePortSymbolicAction `json:"make_port_symbolic,omitempty"`
 	AddSymbolicPort  *addSymbolicPortAction  `json:"add_symbolic_port,omitempty"`
+
+	// MakePortsSymbolic and AddSymbolicPorts are used for the additional ports of an agent
+	// that fronts several ports.
+	MakePortsSymbolic []*makePortSymbolicAction `json:"make_ports_symbolic,omitempty"`
+	AddSymbolicPorts  []*addSymbolicPortAction  `json:"add_symbolic_ports,omitempty"`
 }
 
 var _ completeAction = (*svcActions)(nil)
@@ -281,6 +286,12 @@ func (s *svcActions) actions() (actions multiAction) {
 	if s.AddSymbolicPort != nil {
 		actions = append(actions, s.AddSymbolicPort)
 	}
+	for _, a := range s.MakePortsSymbolic {
+		actions = append(actions, a)
+	}
+	for _, a := range s.AddSymbolicPorts {
+		actions = append(actions, a)
+	}
 	return actions
 }
 
@@ -330,6 +341,10 @@ type addTrafficAgentAction struct {
 	ContainerPortProto  corev1.Protocol `json:"container_port_proto"`
 	ContainerPortNumber uint16          `json:"app_port"`
 
+	// Additional container ports that the agent will take over. The agent will listen to
+	// the ports that follow the port of the primary container port.
+	ExtraPorts []*agentContainerPort `json:"extra_ports,omitempty"`
+
 	// The image name of the agent to add
 	ImageName string `json:"image_name"`
 
@@ -345,6 +360,33 @@ type addTrafficAgentAction struct {
 
 var _ partialAction = (*addTrafficAgentAction)(nil)
 
+// agentContainerPort is a pre-existing container port that a traffic-agent takes over.
+type agentContainerPort struct {
+	ContainerPortName   string          `json:"container_port_name,omitempty"`
+	ContainerPortProto  corev1.Protocol `json:"container_port_proto"`
+	ContainerPortNumber uint16          `json:"app_port"`
+}
+
+// extraPortMappings returns the port mappings for the given extra ports. The agent ports are
+// allocated sequentially starting with the port that follows the primary agent port.
+func extraPortMappings(ports []*agentContainerPort) []install.PortMapping {
+	if len(ports) == 0 {
+		return nil
+	}
+	pms := make([]install.PortMapping, len(ports))
+	for i, p := range ports {
+		pms[i] = install.PortMapping{
+			AgentPort: corev1.ContainerPort{
+				Name:          p.ContainerPortName,
+				Protocol:      p.ContainerPortProto,
+				ContainerPort: int32(9901 + i),
+			},
+			AppPort: int(p.ContainerPortNumber),
+		}
+	}
+	return pms
+}
+
 func (ata *addTrafficAgentAction) appContainer(cns []kates.Container) *kates.Container {
 	for i := range cns {
 		cn := &cns[i]
@@ -383,6 +425,7 @@ func (ata *addTrafficAgentAction) Do(obj kates.Object) error {
 				ContainerPort: 9900,
 			},
 			int(ata.ContainerPortNumber),
+			extraPortMappings(ata.ExtraPorts),
 			ata.trafficManagerNamespace,
 			ata.setGID,
 		))
@@ -469,6 +512,9 @@ type addInitContainerAction struct {
 	AppPortProto  corev1.Protocol `json:"container_port_proto"`
 	AppPortNumber uint16          `json:"app_port"`
 
+	// Additional container ports that are redirected to the agent.
+	ExtraPorts []*agentContainerPort `json:"extra_ports,omitempty"`
+
 	// The image name of the initContainer to add -- usually the same as the traffic agent image that will be used
 	ImageName string `json:"image_name"`
 }
@@ -490,6 +536,7 @@ func (ica *addInitContainerAction) Do(obj kates.Object) error {
 			Protocol:      ica.AppPortProto,
 		},
 		int(ica.AppPortNumber),
+		extraPortMappings(ica.ExtraPorts),
 	))
 
 	return nil
@@ -558,7 +605,6 @@ type hideContainerPortAction struct {
 
 	// ordinal is only used for avoiding ambiguities when generating the HiddenName. It
 	// is the zero based order of all hideContainerPortAction instances for a workload.
-	// Right now we only use one port so this is always zero.
 	ordinal int
 }
 
@@ -653,6 +699,17 @@ type workloadActions struct {
 	HideContainerPort         *hideContainerPortAction `json:"hide_container_port,omitempty"`
 	AddTrafficAgent           *addTrafficAgentAction   `json:"add_traffic_agent,omitempty"`
 	AddInitContainer          *addInitContainerAction  `json:"add_init_container,omitempty"`
+
+	// AdditionalServicePorts and HideContainerPorts are used for the additional ports of an
+	// agent that fronts several ports.
+	AdditionalServicePorts []*referencedServicePort   `json:"additional_service_ports,omitempty"`
+	HideContainerPorts     []*hideContainerPortAction `json:"hide_container_ports,omitempty"`
+}
+
+// referencedServicePort is an additional service port that is fronted by a traffic-agent.
+type referencedServicePort struct {
+	Port string `json:"port"`
+	Name string `json:"name,omitempty"`
 }
 
 var _ completeAction = (*workloadActions)(nil)
@@ -661,6 +718,9 @@ func (d *workloadActions) actions() (actions multiAction) {
 	if d.HideContainerPort != nil {
 		actions = append(actions, d.HideContainerPort)
 	}
+	for _, a := range d.HideContainerPorts {
+		actions = append(actions, a)
+	}
 	if d.AddTrafficAgent != nil {
 		actions = append(actions, d.AddTrafficAgent)
 	}
@@ -670,6 +730,24 @@ func (d *workloadActions) actions() (actions multiAction) {
 	return actions
 }
 
+// containerPort returns the number of the app container port that the agent fronts for the service
+// port with the given name or number.
+func (d *workloadActions) containerPort(portNameOrNumber string) (uint16, bool) {
+	ata := d.AddTrafficAgent
+	if ata == nil {
+		return 0, false
+	}
+	if portNameOrNumber == "" || portNameOrNumber == d.ReferencedServicePort || portNameOrNumber == d.ReferencedServicePortName {
+		return ata.ContainerPortNumber, true
+	}
+	for i, rp := range d.AdditionalServicePorts {
+		if (portNameOrNumber == rp.Port || portNameOrNumber == rp.Name) && i < len(ata.ExtraPorts) {
+			return ata.ExtraPorts[i].ContainerPortNumber, true
+		}
+	}
+	return 0, false
+}
+
 func (d *workloadActions) ExplainDo(dep kates.Object, out io.Writer) {
 	d.actions().ExplainDo(dep, out)
 }
@@ -13,6 +13,7 @@ import (
 	"text/template"
 
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
@@ -129,7 +130,7 @@ func TestAddAgentToWorkload(t *testing.T) {
 				sanitizeService(expectedSvc)
 
 				actualWrk, actualSvc, actualErr := addAgentToWorkload(ctx,
-					tc.InputPortName,
+					[]string{tc.InputPortName},
 					managerImageName(ctx), // ignore extensions
 					env.ManagerNamespace,
 					deepCopyObject(tc.InputWorkload),
@@ -256,6 +257,9 @@ func loadFile(filename, inputVersion string) (workload kates.Object, service *ka
 		Deployment  *kates.Deployment  `json:"deployment"`
 		ReplicaSet  *kates.ReplicaSet  `json:"replicaset"`
 		StatefulSet *kates.StatefulSet `json:"statefulset"`
+		DaemonSet   *appsv1.DaemonSet  `json:"daemonset"`
+		Rollout     *install.Rollout   `json:"rollout"`
+		Pod         *install.BarePod   `json:"pod"`
 
 		Service       *kates.Service `json:"service"`
 		InterceptPort string         `json:"interceptPort"`
@@ -277,8 +281,20 @@ func loadFile(filename, inputVersion string) (workload kates.Object, service *ka
 		cnt++
 		workload = dat.StatefulSet
 	}
+	if dat.DaemonSet != nil {
+		cnt++
+		workload = dat.DaemonSet
+	}
+	if dat.Rollout != nil {
+		cnt++
+		workload = dat.Rollout
+	}
+	if dat.Pod != nil {
+		cnt++
+		workload = dat.Pod
+	}
 	if cnt != 1 {
-		return nil, nil, "", fmt.Errorf("yaml must contain exactly one of 'deployment', 'replicaset', or 'statefulset'; got %d of them", cnt)
+		return nil, nil, "", fmt.Errorf("yaml must contain exactly one of 'deployment', 'replicaset', 'statefulset', 'daemonset', 'rollout', or 'pod'; got %d of them", cnt)
 	}
 
 	return workload, dat.Service, dat.InterceptPort, nil
@@ -11,6 +11,8 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	grpcCodes "google.golang.org/grpc/codes"
 	grpcStatus "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
@@ -25,9 +27,9 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_auth"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
-	"github.com/telepresenceio/telepresence/v2/pkg/dpipe"
 	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
-	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/healthcheck"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 type forwardKey struct {
@@ -117,6 +119,16 @@ func (tm *trafficManager) reconcileMountPoints(ctx context.Context, existingInte
 			// Execute the removal in a separate go-routine so that we don't hang the daemon in case
 			// the removal hangs on a "resource busy".
 			go func(mountPoint string) {
+				if vc, ok := tm.volumeCopies.LoadAndDelete(mountPoint); ok {
+					vc := vc.(*volumeCopy)
+					_ = vc.remote.Close()
+					if err := vc.snapshot.Remove(); err != nil {
+						dlog.Errorf(ctx, "Failed to remove copy of volumes at %q: %v", mountPoint, err)
+					} else {
+						dlog.Infof(ctx, "Removed copy of volumes at %q", mountPoint)
+					}
+					return
+				}
 				if runtime.GOOS == "darwin" {
 					//  macFUSE will sometimes not unmount in a timely manner so we do this to avoid "resource busy" and
 					//  "Device not configured" errors.
@@ -146,6 +158,13 @@ func (tm *trafficManager) workerPortForwardIntercepts(ctx context.Context) error
 	//     management on top anyway, so dgroup wouldn't actually save us any complexity.
 	portForwards := newPortForwards()
 	backoff := 100 * time.Millisecond
+
+	// The names of the intercepts that were kept in the last snapshot
+	var kept map[string]struct{}
+
+	// The watch is established again when the stream ends, e.g. because a new traffic-manager took
+	// over after a failover. The port forwards and mounts of the intercepts are retained until the
+	// new stream delivers its first snapshot.
 	for ctx.Err() == nil {
 		<-tm.startup
 		stream, err := tm.managerClient.WatchIntercepts(ctx, tm.session())
@@ -167,7 +186,9 @@ func (tm *trafficManager) workerPortForwardIntercepts(ctx context.Context) error
 				// context is cancelled. Continue as if we had an empty snapshot. This
 				// will ensure that volume mounts are cancelled correctly.
 			} else {
+				backoff = 100 * time.Millisecond
 				intercepts = snapshot.Intercepts
+				kept = tm.forgetRemovedIntercepts(ctx, kept, intercepts)
 			}
 			tm.setCurrentIntercepts(intercepts)
 
@@ -181,7 +202,11 @@ func (tm *trafficManager) workerPortForwardIntercepts(ctx context.Context) error
 
 				var iceptError error
 				switch intercept.Disposition {
-				case manager.InterceptDispositionType_ACTIVE:
+				case manager.InterceptDispositionType_ACTIVE, manager.InterceptDispositionType_UNHEALTHY:
+					// An unhealthy intercept is paused, but its mounts and port forwards remain.
+					if intercept.Spec.HealthCheck != nil {
+						tm.startHealthCheck(ctx, intercept)
+					}
 				case manager.InterceptDispositionType_WAITING:
 					continue
 				default:
@@ -206,6 +231,8 @@ func (tm *trafficManager) workerPortForwardIntercepts(ctx context.Context) error
 			}
 			portForwards.cancelUnwanted(ctx)
 			tm.reconcileMountPoints(ctx, allNames)
+			tm.reconcileRecorders(ctx, allNames)
+			tm.reconcileHealthChecks(ctx, allNames)
 			if ctx.Err() == nil {
 				tm.SetInterceptedNamespaces(ctx, namespaces)
 			}
@@ -244,6 +271,9 @@ func (tm *trafficManager) getCurrentIntercepts() []*manager.InterceptInfo {
 			}
 			return true
 		})
+		if r, ok := tm.recorders.Load(ii.Spec.Name); ok {
+			r.(*interceptRecorder).restoreTargetPorts(ii.Spec)
+		}
 	}
 	return intercepts
 }
@@ -262,8 +292,50 @@ func interceptError(tp rpc.InterceptError, err error) *rpc.InterceptResult {
 	}
 }
 
-// AddIntercept adds one intercept
+// targetPorts returns all ports on the workstation that the given intercept spec targets.
+func targetPorts(spec *manager.InterceptSpec) []int32 {
+	if len(spec.Ports) == 0 {
+		return []int32{spec.TargetPort}
+	}
+	ports := make([]int32, len(spec.Ports))
+	for i, ip := range spec.Ports {
+		ports[i] = ip.TargetPort
+	}
+	return ports
+}
+
+func targetPortsOverlap(a, b *manager.InterceptSpec) bool {
+	for _, ap := range targetPorts(a) {
+		for _, bp := range targetPorts(b) {
+			if ap == bp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddIntercept adds one intercept and saves the request that created it, so that the intercept
+// can be restored
 func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateInterceptRequest) (*rpc.InterceptResult, error) {
+	c, span := tracing.Start(c, "AddIntercept",
+		attribute.String("telepresence.intercept", ir.Spec.Name),
+		attribute.String("telepresence.workload", ir.Spec.Agent))
+	saved := proto.Clone(ir).(*rpc.CreateInterceptRequest)
+	result, err := tm.addIntercept(c, ir)
+	if err == nil && result.Error != rpc.InterceptError_UNSPECIFIED {
+		span.SetStatus(codes.Error, result.Error.String())
+	}
+	tracing.End(span, err)
+	if err == nil && result.Error == rpc.InterceptError_UNSPECIFIED {
+		// The namespace of the request has been resolved
+		saved.Spec.Namespace = ir.Spec.Namespace
+		tm.saveIntercept(c, saved)
+	}
+	return result, err
+}
+
+func (tm *trafficManager) addIntercept(c context.Context, ir *rpc.CreateInterceptRequest) (*rpc.InterceptResult, error) {
 	spec := ir.Spec
 	spec.Namespace = tm.ActualNamespace(spec.Namespace)
 	if spec.Namespace == "" {
@@ -280,7 +352,7 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 		if iCept.Spec.Name == spec.Name {
 			return interceptError(rpc.InterceptError_ALREADY_EXISTS, errcat.User.Newf(spec.Name)), nil
 		}
-		if iCept.Spec.TargetPort == spec.TargetPort && iCept.Spec.TargetHost == spec.TargetHost {
+		if iCept.Spec.TargetHost == spec.TargetHost && targetPortsOverlap(iCept.Spec, spec) {
 			return &rpc.InterceptResult{
 				Error:         rpc.InterceptError_LOCAL_TARGET_IN_USE,
 				ErrorText:     spec.Name,
@@ -302,7 +374,7 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	// It's OK to just call addAgent every time; if the agent is already installed then it's a
 	// no-op.
 	var result *rpc.InterceptResult
-	if result = tm.addAgent(c, spec.Namespace, spec.Agent, spec.ServiceName, spec.ServicePortIdentifier, ir.AgentImage); result.Error != rpc.InterceptError_UNSPECIFIED {
+	if result = tm.addAgent(c, spec, ir.AgentImage); result.Error != rpc.InterceptError_UNSPECIFIED {
 		return result, nil
 	}
 
@@ -310,22 +382,58 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	spec.WorkloadKind = result.WorkloadKind
 
 	deleteMount := false
+	var vc *volumeCopy
 	if ir.MountPoint != "" {
 		// Ensure that the mount-point is free to use
 		if prev, loaded := tm.mountPoints.LoadOrStore(ir.MountPoint, spec.Name); loaded {
 			return interceptError(rpc.InterceptError_MOUNT_POINT_BUSY, errcat.User.Newf(prev.(string))), nil
 		}
+		if ir.VolumeCopy != nil {
+			// The copy must be registered before the worker that serves the mount point starts.
+			vc = newVolumeCopy(ir.MountPoint, ir.VolumeCopy)
+			tm.volumeCopies.Store(ir.MountPoint, vc)
+		}
 
 		// Assume that the mount-point should to be removed from the busy map. Only a happy path
 		// to successful intercept that actually has remote mounts will set this to false.
 		deleteMount = true
 		defer func() {
 			if deleteMount {
+				if vc != nil {
+					tm.volumeCopies.Delete(ir.MountPoint)
+					_ = vc.remote.Close()
+					_ = vc.snapshot.Remove()
+				}
 				tm.mountPoints.Delete(ir.MountPoint)
 			}
 		}()
 	}
 
+	if hc := spec.HealthCheck; hc != nil {
+		if err := healthcheck.Validate(hc); err != nil {
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, errcat.User.New(err)), nil
+		}
+		if hc.Port == 0 {
+			// Check the port that the user asked for, not the port of a recording proxy.
+			hc.Port = spec.TargetPort
+		}
+	}
+
+	var recorder *interceptRecorder
+	if ir.RecordFile != "" {
+		var err error
+		if recorder, err = startRecorder(c, spec, ir.RecordFile); err != nil {
+			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, err), nil
+		}
+
+		// Stop the recorder unless the intercept is successfully established.
+		defer func() {
+			if recorder != nil {
+				recorder.stop(c)
+			}
+		}()
+	}
+
 	apiKey, err := tm.callbacks.GetCloudAPIKey(c, a8rcloud.KeyDescAgent(spec), false)
 	if err != nil {
 		if !errors.Is(err, userd_auth.ErrNotLoggedIn) {
@@ -333,6 +441,7 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 		}
 	}
 	dlog.Debugf(c, "creating intercept %s", spec.Name)
+	copyCtx := c // copying the volumes isn't bounded by the intercept timeout
 	tos := &client.GetConfig(c).Timeouts
 	spec.RoundtripLatency = int64(tos.Get(client.TimeoutRoundtripLatency)) * 2 // Account for extra hop
 	spec.DialTimeout = int64(tos.Get(client.TimeoutEndpointDial))
@@ -353,6 +462,10 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 	})
 	if err != nil {
 		dlog.Debugf(c, "manager responded to CreateIntercept with error %v", err)
+		switch grpcStatus.Code(err) {
+		case grpcCodes.Unauthenticated, grpcCodes.PermissionDenied:
+			return interceptError(rpc.InterceptError_TRAFFIC_MANAGER_ERROR, errcat.User.New(grpcStatus.Convert(err).Message())), nil
+		}
 		err = client.CheckTimeout(c, err)
 		return &rpc.InterceptResult{Error: rpc.InterceptError_TRAFFIC_MANAGER_ERROR, ErrorText: err.Error()}, nil
 	}
@@ -363,15 +476,36 @@ func (tm *trafficManager) AddIntercept(c context.Context, ir *rpc.CreateIntercep
 		return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, c.Err()), nil
 	case wr := <-waitCh:
 		ii = wr.intercept
+		if ii.Disposition == manager.InterceptDispositionType_POLICY_DENIED {
+			result := interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, errcat.User.Newf("denied by policy: %s", ii.Message))
+			result.InterceptInfo = ii
+			return result, nil
+		}
 		if wr.err != nil {
 			return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, wr.err), nil
 		}
 		result.InterceptInfo = wr.intercept
 		if ir.MountPoint != "" && ii.SftpPort > 0 {
+			if vc != nil {
+				if err := tm.copyVolumes(copyCtx, vc, ii, ir.MountPoint); err != nil {
+					if rmErr := tm.removeIntercept(copyCtx, spec.Name); rmErr != nil {
+						dlog.Errorf(c, "failed to remove intercept %s: %v", spec.Name, rmErr)
+					}
+					return interceptError(rpc.InterceptError_FAILED_TO_ESTABLISH, err), nil
+				}
+			}
 			result.Environment["TELEPRESENCE_ROOT"] = ir.MountPoint
 			deleteMount = false // Mount-point is busy until intercept ends
 			ii.Spec.MountPoint = ir.MountPoint
 		}
+		if recorder != nil {
+			// The recorder is stopped when the intercept ends
+			tm.recorders.Store(spec.Name, recorder)
+			ii = proto.Clone(ii).(*manager.InterceptInfo)
+			recorder.restoreTargetPorts(ii.Spec)
+			result.InterceptInfo = ii
+			recorder = nil
+		}
 		return result, nil
 	}
 }
@@ -415,85 +549,16 @@ func (tm *trafficManager) workerPortForwardIntercept(ctx context.Context, pf por
 	}
 }
 
-func (tm *trafficManager) workerMountForwardIntercept(ctx context.Context, mf mountForward, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	var mountPoint string
-	tm.mountPoints.Range(func(key, value interface{}) bool {
-		if mf.Name == value.(string) {
-			mountPoint = key.(string)
-			return false
-		}
-		return true
-	})
-	if mountPoint == "" {
-		dlog.Errorf(ctx, "No mount point found for intercept %q", mf.Name)
-		return
-	}
-
-	dlog.Infof(ctx, "Mounting file system for intercept %q at %q", mf.Name, mountPoint)
-
-	// The mounts performed here are synced on by podIP + sftpPort to keep track of active
-	// mounts. This is not enough in situations when a pod is deleted and another pod
-	// takes over. That is two different IPs so an additional synchronization on the actual
-	// mount point is necessary to prevent that it is established and deleted at the same
-	// time.
-	mountMutex := new(sync.Mutex)
-	mountMutex.Lock()
-	if oldMutex, loaded := tm.mountMutexes.LoadOrStore(mountPoint, mountMutex); loaded {
-		mountMutex.Unlock() // not stored, so unlock and throw away
-		mountMutex = oldMutex.(*sync.Mutex)
-		mountMutex.Lock()
-	}
-
-	defer func() {
-		tm.mountMutexes.Delete(mountPoint)
-		mountMutex.Unlock()
-	}()
-
-	// Retry mount in case it gets disconnected
-	err := client.Retry(ctx, "sshfs", func(ctx context.Context) error {
-		dl := &net.Dialer{Timeout: 3 * time.Second}
-		conn, err := dl.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", mf.PodIP, mf.SftpPort))
-		if err != nil {
-			return err
-		}
-		defer conn.Close()
-		sshfsArgs := []string{
-			"-F", "none", // don't load the user's config file
-			"-f", // foreground operation
-
-			// connection settings
-			"-C", // compression
-			"-oConnectTimeout=10",
-			"-oStrictHostKeyChecking=no",     // don't bother checking the host key...
-			"-oUserKnownHostsFile=/dev/null", // and since we're not checking it, don't bother remembering it either
-			"-o", "slave",                    // Unencrypted via stdin/stdout
-
-			// mount directives
-			"-o", "follow_symlinks",
-			"-o", "allow_root", // needed to make --docker-run work as docker runs as root
-			"localhost:" + install.TelAppMountPoint, // what to mount
-			mountPoint,                              // where to mount it
-		}
-		exe := "sshfs"
-		if runtime.GOOS == "windows" {
-			// Use sshfs-win to launch the sshfs
-			sshfsArgs = append([]string{"cmd", "-ouid=-1", "-ogid=-1"}, sshfsArgs...)
-			exe = "sshfs-win"
-		}
-		err = dpipe.DPipe(ctx, conn, exe, sshfsArgs...)
-		time.Sleep(time.Second)
-		return err
-	}, 3*time.Second, 6*time.Second)
-
-	if err != nil && ctx.Err() == nil {
-		dlog.Error(ctx, err)
+// RemoveIntercept removes one intercept by name and forgets it, so that it isn't restored
+func (tm *trafficManager) RemoveIntercept(c context.Context, name string) error {
+	err := tm.removeIntercept(c, name)
+	if err == nil || grpcStatus.Code(err) == grpcCodes.NotFound {
+		tm.forgetIntercept(c, name)
 	}
+	return err
 }
 
-// RemoveIntercept removes one intercept by name
-func (tm *trafficManager) RemoveIntercept(c context.Context, name string) error {
+func (tm *trafficManager) removeIntercept(c context.Context, name string) error {
 	if ns, ok := tm.LocalIntercepts[name]; ok {
 		return tm.RemoveLocalOnlyIntercept(c, name, ns)
 	}
@@ -506,11 +571,24 @@ func (tm *trafficManager) RemoveIntercept(c context.Context, name string) error
 	return err
 }
 
-// clearIntercepts removes all intercepts
+// WatchInterceptEvents streams the traffic events of the intercept with the given name
+func (tm *trafficManager) WatchInterceptEvents(c context.Context, name string) (manager.Manager_WatchInterceptEventsClient, error) {
+	if _, ok := tm.LocalIntercepts[name]; ok {
+		return nil, errcat.User.Newf("intercept %s is a local-only intercept and has no traffic", name)
+	}
+	<-tm.startup
+	return tm.managerClient.WatchInterceptEvents(c, &manager.InterceptEventsRequest{
+		Session: tm.session(),
+		Name:    name,
+	})
+}
+
+// clearIntercepts removes all intercepts. The intercepts are not forgotten, so they can be restored
+// by a later connect.
 func (tm *trafficManager) clearIntercepts(c context.Context) error {
 	<-tm.startup
 	for _, cept := range tm.getCurrentIntercepts() {
-		err := tm.RemoveIntercept(c, cept.Spec.Name)
+		err := tm.removeIntercept(c, cept.Spec.Name)
 		if err != nil && grpcStatus.Code(err) != grpcCodes.NotFound {
 			return err
 		}
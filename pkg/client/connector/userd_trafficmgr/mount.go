@@ -0,0 +1,244 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/dpipe"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+	"github.com/telepresenceio/telepresence/v2/pkg/sftpfs"
+)
+
+// sftpMount is a file system that is mounted using the built-in SFTP client. The mount is shared
+// by the workers of all pods that serve an intercept during its lifetime, so that it survives the
+// replacement of a pod.
+type sftpMount struct {
+	remote *sftpfs.Remote
+	users  int // number of workers that use this mount
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (tm *trafficManager) workerMountForwardIntercept(ctx context.Context, mf mountForward, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var mountPoint string
+	tm.mountPoints.Range(func(key, value interface{}) bool {
+		if mf.Name == value.(string) {
+			mountPoint = key.(string)
+			return false
+		}
+		return true
+	})
+	if mountPoint == "" {
+		dlog.Errorf(ctx, "No mount point found for intercept %q", mf.Name)
+		return
+	}
+
+	if vc, ok := tm.volumeCopies.Load(mountPoint); ok {
+		tm.syncVolumeCopy(ctx, mf, mountPoint, vc.(*volumeCopy))
+	} else if runtime.GOOS == "windows" {
+		tm.mountWithSSHFS(ctx, mf, mountPoint)
+	} else {
+		tm.mountWithSFTP(ctx, mf, mountPoint)
+	}
+}
+
+// sftpDialer returns a function that dials the SFTP server of the agent in the given pod.
+func sftpDialer(podIP string, sftpPort int32) sftpfs.DialFunc {
+	addr := net.JoinHostPort(podIP, strconv.Itoa(int(sftpPort)))
+	return func(ctx context.Context) (net.Conn, error) {
+		dl := &net.Dialer{Timeout: 3 * time.Second}
+		return dl.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// volumeCopy is a local copy of the remote volumes of an intercept, used instead of a mount when
+// the intercept was created with --mount-mode=copy.
+type volumeCopy struct {
+	remote   *sftpfs.Remote
+	snapshot *sftpfs.Snapshot
+	interval time.Duration // zero when the copy is never synced after it's been created
+}
+
+func newVolumeCopy(mountPoint string, vc *rpc.VolumeCopy) *volumeCopy {
+	remote := sftpfs.NewRemote(nil)
+	return &volumeCopy{
+		remote: remote,
+		snapshot: sftpfs.NewSnapshot(remote, install.TelAppMountPoint, mountPoint, sftpfs.CopyOptions{
+			Include: vc.Include,
+			Exclude: vc.Exclude,
+			MaxSize: vc.MaxSize,
+		}),
+		interval: vc.SyncInterval.AsDuration(),
+	}
+}
+
+// copyVolumes creates the initial copy of the remote volumes of the given intercept.
+func (tm *trafficManager) copyVolumes(ctx context.Context, vc *volumeCopy, ii *manager.InterceptInfo, mountPoint string) error {
+	vc.remote.SetDialer(sftpDialer(ii.PodIp, ii.SftpPort))
+	n, err := vc.snapshot.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	dlog.Infof(ctx, "Copied %d files of intercept %q to %q", n, ii.Spec.Name, mountPoint)
+	if vc.interval == 0 {
+		// The connection isn't needed anymore
+		_ = vc.remote.Close()
+	}
+	return nil
+}
+
+// syncVolumeCopy updates the given copy with the files that change in the remote volumes of the
+// given forward, until the context is cancelled.
+func (tm *trafficManager) syncVolumeCopy(ctx context.Context, mf mountForward, mountPoint string, vc *volumeCopy) {
+	if vc.interval == 0 {
+		return
+	}
+	vc.remote.SetDialer(sftpDialer(mf.PodIP, mf.SftpPort))
+	ticker := time.NewTicker(vc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := vc.snapshot.Sync(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				dlog.Errorf(ctx, "Failed to sync the copy of intercept %q at %q: %v", mf.Name, mountPoint, err)
+			}
+		case n > 0:
+			dlog.Infof(ctx, "Synced %d changed files of intercept %q to %q", n, mf.Name, mountPoint)
+		}
+	}
+}
+
+// mountWithSFTP mounts the file system of the given forward using the built-in SFTP client, or
+// lets an existing mount of the same mount point use the given forward. The mount is served until
+// the context is cancelled and no other worker uses it.
+func (tm *trafficManager) mountWithSFTP(ctx context.Context, mf mountForward, mountPoint string) {
+	addr := net.JoinHostPort(mf.PodIP, strconv.Itoa(int(mf.SftpPort)))
+	dial := sftpDialer(mf.PodIP, mf.SftpPort)
+
+	tm.sftpMountsLock.Lock()
+	m, ok := tm.sftpMounts[mountPoint]
+	if ok {
+		// The intercept has moved to another pod.
+		dlog.Infof(ctx, "Reconnecting file system for intercept %q at %q to %s", mf.Name, mountPoint, addr)
+		m.remote.SetDialer(dial)
+	} else {
+		dlog.Infof(ctx, "Mounting file system for intercept %q at %q", mf.Name, mountPoint)
+
+		// The mount must not end with the worker that created it
+		mountCtx, cancel := context.WithCancel(dcontext.WithoutCancel(ctx))
+		m = &sftpMount{remote: sftpfs.NewRemote(dial), cancel: cancel, done: make(chan struct{})}
+		if tm.sftpMounts == nil {
+			tm.sftpMounts = make(map[string]*sftpMount)
+		}
+		tm.sftpMounts[mountPoint] = m
+		go func() {
+			defer close(m.done)
+			if err := sftpfs.Mount(mountCtx, mountPoint, install.TelAppMountPoint, m.remote); err != nil {
+				dlog.Errorf(ctx, "Failed to mount file system at %q: %v", mountPoint, err)
+			}
+			_ = m.remote.Close()
+			tm.sftpMountsLock.Lock()
+			if tm.sftpMounts[mountPoint] == m {
+				delete(tm.sftpMounts, mountPoint)
+			}
+			tm.sftpMountsLock.Unlock()
+		}()
+	}
+	m.users++
+	tm.sftpMountsLock.Unlock()
+
+	select {
+	case <-ctx.Done():
+	case <-m.done:
+	}
+
+	tm.sftpMountsLock.Lock()
+	m.users--
+	last := m.users == 0
+	if last && tm.sftpMounts[mountPoint] == m {
+		delete(tm.sftpMounts, mountPoint)
+	}
+	tm.sftpMountsLock.Unlock()
+	if last {
+		// The mount point is removed once this worker is done, so the file system must be
+		// unmounted first.
+		m.cancel()
+		<-m.done
+	}
+}
+
+// mountWithSSHFS mounts the file system of the given forward using sshfs-win.
+func (tm *trafficManager) mountWithSSHFS(ctx context.Context, mf mountForward, mountPoint string) {
+	dlog.Infof(ctx, "Mounting file system for intercept %q at %q", mf.Name, mountPoint)
+
+	// The mounts performed here are synced on by podIP + sftpPort to keep track of active
+	// mounts. This is not enough in situations when a pod is deleted and another pod
+	// takes over. That is two different IPs so an additional synchronization on the actual
+	// mount point is necessary to prevent that it is established and deleted at the same
+	// time.
+	mountMutex := new(sync.Mutex)
+	mountMutex.Lock()
+	if oldMutex, loaded := tm.mountMutexes.LoadOrStore(mountPoint, mountMutex); loaded {
+		mountMutex.Unlock() // not stored, so unlock and throw away
+		mountMutex = oldMutex.(*sync.Mutex)
+		mountMutex.Lock()
+	}
+
+	defer func() {
+		tm.mountMutexes.Delete(mountPoint)
+		mountMutex.Unlock()
+	}()
+
+	// Retry mount in case it gets disconnected
+	err := client.Retry(ctx, "sshfs", func(ctx context.Context) error {
+		dl := &net.Dialer{Timeout: 3 * time.Second}
+		conn, err := dl.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", mf.PodIP, mf.SftpPort))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		sshfsArgs := []string{
+			"cmd", "-ouid=-1", "-ogid=-1", // use sshfs-win to launch the sshfs
+			"-F", "none", // don't load the user's config file
+			"-f", // foreground operation
+
+			// connection settings
+			"-C", // compression
+			"-oConnectTimeout=10",
+			"-oStrictHostKeyChecking=no",     // don't bother checking the host key...
+			"-oUserKnownHostsFile=/dev/null", // and since we're not checking it, don't bother remembering it either
+			"-o", "slave",                    // Unencrypted via stdin/stdout
+
+			// mount directives
+			"-o", "follow_symlinks",
+			"-o", "allow_root", // needed to make --docker-run work as docker runs as root
+			"localhost:" + install.TelAppMountPoint, // what to mount
+			mountPoint,                              // where to mount it
+		}
+		err = dpipe.DPipe(ctx, conn, "sshfs-win", sshfsArgs...)
+		time.Sleep(time.Second)
+		return err
+	}, 3*time.Second, 6*time.Second)
+
+	if err != nil && ctx.Err() == nil {
+		dlog.Error(ctx, err)
+	}
+}
@@ -0,0 +1,60 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// notificationWatcher relays the notifications that the traffic-manager sends about the intercepts
+// of this session, e.g. that an intercept is about to expire, to the user.
+func (tm *trafficManager) notificationWatcher(ctx context.Context) error {
+	<-tm.startup
+	if tm.managerClient == nil {
+		return nil
+	}
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		stream, err := tm.managerClient.WatchNotifications(ctx, tm.sessionInfo)
+		if err == nil {
+			var n *manager.Notification
+			for n, err = stream.Recv(); err == nil; n, err = stream.Recv() {
+				backoff = 100 * time.Millisecond
+				tm.handleNotification(ctx, n)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if status.Code(err) == codes.Unimplemented {
+			// Older traffic-managers don't send notifications
+			dlog.Debug(ctx, "the traffic-manager doesn't support notifications")
+			break
+		}
+		dlog.Errorf(ctx, "manager.WatchNotifications: %v", err)
+		dtime.SleepWithContext(ctx, backoff)
+		backoff *= 2
+		if backoff > 3*time.Second {
+			backoff = 3 * time.Second
+		}
+	}
+	return nil
+}
+
+func (tm *trafficManager) handleNotification(ctx context.Context, n *manager.Notification) {
+	if n.Type == manager.Notification_INTERCEPT_EXPIRED {
+		// The traffic-manager has already removed the intercept, so it mustn't be restored.
+		tm.forgetIntercept(ctx, n.InterceptName)
+	}
+	if tm.callbacks.Notify != nil {
+		tm.callbacks.Notify(ctx, n.Message)
+	} else {
+		dlog.Warn(ctx, n.Message)
+	}
+}
@@ -0,0 +1,117 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+	"github.com/telepresenceio/telepresence/v2/pkg/record"
+)
+
+// interceptRecorder records the traffic of an intercept. It does so by running a recording proxy
+// for each target port of the intercept, and letting the intercept target the proxies instead.
+type interceptRecorder struct {
+	file   string
+	cancel context.CancelFunc
+	writer *record.Writer
+
+	// targetPorts maps the port of each proxy to the target port that it replaces
+	targetPorts map[int32]int32
+}
+
+// startRecorder starts a recorder for the intercept with the given spec, and modifies the target
+// ports of the spec so that they point to the recording proxies. The recorder runs until it's
+// stopped, irrespective of the given context.
+func startRecorder(c context.Context, spec *manager.InterceptSpec, file string) (*interceptRecorder, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, errcat.User.Newf("unable to create recording: %v", err)
+	}
+	w, err := record.NewWriter(f, &record.Header{
+		Intercept: spec.Name,
+		Workload:  spec.Agent,
+		Namespace: spec.Namespace,
+		Started:   time.Now(),
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(dcontext.WithoutCancel(c))
+	r := &interceptRecorder{file: file, cancel: cancel, writer: w, targetPorts: make(map[int32]int32)}
+	proxy := func(port int32, portID string) (int32, error) {
+		p, err := record.NewProxy(w, net.JoinHostPort(spec.TargetHost, strconv.Itoa(int(port))), portID)
+		if err != nil {
+			return 0, err
+		}
+		r.targetPorts[p.Port()] = port
+		go func() {
+			if err := p.Serve(ctx); err != nil {
+				dlog.Errorf(ctx, "recording proxy for intercept %s failed: %v", spec.Name, err)
+			}
+		}()
+		return p.Port(), nil
+	}
+
+	if len(spec.Ports) == 0 {
+		spec.TargetPort, err = proxy(spec.TargetPort, spec.ServicePortIdentifier)
+	} else {
+		for _, ip := range spec.Ports {
+			if ip.TargetPort, err = proxy(ip.TargetPort, ip.ServicePortIdentifier); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			spec.TargetPort = spec.Ports[0].TargetPort
+		}
+	}
+	if err != nil {
+		r.stop(ctx)
+		return nil, fmt.Errorf("unable to start recording proxy: %w", err)
+	}
+	dlog.Infof(ctx, "Recording intercept %s to %s", spec.Name, file)
+	return r, nil
+}
+
+// stop stops the recording proxies and closes the recording.
+func (r *interceptRecorder) stop(ctx context.Context) {
+	r.cancel()
+	if err := r.writer.Close(); err != nil {
+		dlog.Errorf(ctx, "failed to close recording %s: %v", r.file, err)
+	}
+}
+
+// restoreTargetPorts changes the target ports of the given spec from the ports of the recording
+// proxies back to the ports that the user asked for.
+func (r *interceptRecorder) restoreTargetPorts(spec *manager.InterceptSpec) {
+	if p, ok := r.targetPorts[spec.TargetPort]; ok {
+		spec.TargetPort = p
+	}
+	for _, ip := range spec.Ports {
+		if p, ok := r.targetPorts[ip.TargetPort]; ok {
+			ip.TargetPort = p
+		}
+	}
+}
+
+// reconcileRecorders stops the recorders for which there no longer is an intercept
+func (tm *trafficManager) reconcileRecorders(ctx context.Context, existingIntercepts map[string]struct{}) {
+	tm.recorders.Range(func(key, value interface{}) bool {
+		if _, ok := existingIntercepts[key.(string)]; !ok {
+			if _, loaded := tm.recorders.LoadAndDelete(key); loaded {
+				r := value.(*interceptRecorder)
+				dlog.Infof(ctx, "Stopped recording intercept %s to %s", key, r.file)
+				r.stop(ctx)
+			}
+		}
+		return true
+	})
+}
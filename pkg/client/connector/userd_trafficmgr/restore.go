@@ -0,0 +1,195 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"os"
+	"runtime"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/connector"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/cache"
+)
+
+// savedInterceptsKey returns the key of this traffic-manager in the intercepts cache.
+func (tm *trafficManager) savedInterceptsKey() string {
+	return tm.Server + "/" + tm.GetManagerNamespace()
+}
+
+// updateSavedIntercepts calls the given function with the saved intercepts of this traffic-manager
+// and persists the result.
+func (tm *trafficManager) updateSavedIntercepts(c context.Context, f func(cache.SavedIntercepts)) {
+	tm.savedInterceptsLock.Lock()
+	defer tm.savedInterceptsLock.Unlock()
+	all, err := cache.LoadInterceptsFromUserCache(c)
+	if err != nil {
+		dlog.Errorf(c, "unable to load saved intercepts: %v", err)
+		return
+	}
+	key := tm.savedInterceptsKey()
+	saved := all[key]
+	if saved == nil {
+		saved = make(cache.SavedIntercepts)
+	}
+	f(saved)
+	if len(saved) == 0 {
+		delete(all, key)
+	} else {
+		all[key] = saved
+	}
+	if err = cache.SaveInterceptsToUserCache(c, all); err != nil {
+		dlog.Errorf(c, "unable to save intercepts: %v", err)
+	}
+}
+
+// saveIntercept saves the request that created an intercept, so that the intercept can be
+// restored by a later connect. The request is modified and must not be used by the caller.
+func (tm *trafficManager) saveIntercept(c context.Context, ir *rpc.CreateInterceptRequest) {
+	// A restored intercept must not overwrite the recording of the intercept that it replaces.
+	ir.RecordFile = ""
+	tm.updateSavedIntercepts(c, func(saved cache.SavedIntercepts) {
+		saved[ir.Spec.Name] = &cache.SavedIntercept{SessionID: tm.session().SessionId, Request: ir}
+	})
+}
+
+// forgetIntercept removes a saved intercept.
+func (tm *trafficManager) forgetIntercept(c context.Context, name string) {
+	tm.updateSavedIntercepts(c, func(saved cache.SavedIntercepts) {
+		delete(saved, name)
+	})
+}
+
+// forgetRemovedIntercepts forgets the saved intercepts that were kept in the previous snapshot of
+// the intercepts of this session but aren't kept in the current one, because the traffic-manager
+// removed them, e.g. when they expired, or denied them by policy. Such intercepts must not be
+// restored. It returns the names of the intercepts that are kept in the current snapshot.
+func (tm *trafficManager) forgetRemovedIntercepts(c context.Context, previous map[string]struct{}, intercepts []*manager.InterceptInfo) map[string]struct{} {
+	kept := make(map[string]struct{}, len(intercepts))
+	for _, ii := range intercepts {
+		if ii.Disposition != manager.InterceptDispositionType_POLICY_DENIED {
+			kept[ii.Spec.Name] = struct{}{}
+		}
+	}
+	for name := range previous {
+		if _, ok := kept[name]; !ok {
+			tm.forgetIntercept(c, name)
+		}
+	}
+	return kept
+}
+
+// ownsSession returns true if the session that the given intercept was saved from is still known to
+// the traffic-manager, and the intercept that it holds in it was created by this client.
+func (tm *trafficManager) ownsSession(c context.Context, si *cache.SavedIntercept) bool {
+	ii, err := tm.managerClient.GetIntercept(c, &manager.GetInterceptRequest{
+		Session: &manager.SessionInfo{SessionId: si.SessionID},
+		Name:    si.Request.Spec.Name,
+	})
+	if err != nil {
+		dlog.Debugf(c, "not ending previous session %s: %v", si.SessionID, err)
+		return false
+	}
+	return ii.Spec.Client == tm.userAndHost
+}
+
+// RestoreIntercepts re-creates the saved intercepts of this traffic-manager. Sessions that the
+// intercepts belonged to are ended when the traffic-manager confirms that they were created by
+// this client, so that it removes intercepts that it still holds for a connector that is gone.
+// Intercepts that already exist in the current session are left as they are. Intercepts that
+// cannot be re-created are forgotten.
+func (tm *trafficManager) RestoreIntercepts(c context.Context) []*rpc.InterceptResult {
+	if tm == nil {
+		return nil
+	}
+	<-tm.startup
+	if tm.managerClient == nil {
+		return nil
+	}
+	all, err := cache.LoadInterceptsFromUserCache(c)
+	if err != nil {
+		dlog.Errorf(c, "unable to load saved intercepts: %v", err)
+		return nil
+	}
+	saved := all[tm.savedInterceptsKey()]
+	if len(saved) == 0 {
+		return nil
+	}
+
+	current := tm.session().SessionId
+	checked := make(map[string]struct{})
+	for _, si := range saved {
+		if _, ok := checked[si.SessionID]; !ok && si.SessionID != current {
+			checked[si.SessionID] = struct{}{}
+			if tm.ownsSession(c, si) {
+				dlog.Debugf(c, "ending previous session %s", si.SessionID)
+				_, _ = tm.managerClient.Depart(c, &manager.SessionInfo{SessionId: si.SessionID})
+			}
+		}
+	}
+
+	existing := make(map[string]*manager.InterceptInfo)
+	for _, ii := range tm.getCurrentIntercepts() {
+		existing[ii.Spec.Name] = ii
+	}
+
+	var results []*rpc.InterceptResult
+	for name, si := range saved {
+		if ii, ok := existing[name]; ok {
+			results = append(results, &rpc.InterceptResult{InterceptInfo: ii})
+			continue
+		}
+		if _, ok := tm.LocalIntercepts[name]; ok {
+			results = append(results, &rpc.InterceptResult{InterceptInfo: &manager.InterceptInfo{
+				Spec:              si.Request.Spec,
+				Disposition:       manager.InterceptDispositionType_ACTIVE,
+				MechanismArgsDesc: "as local-only",
+			}})
+			continue
+		}
+		results = append(results, tm.restoreIntercept(c, si.Request))
+	}
+	return results
+}
+
+func (tm *trafficManager) restoreIntercept(c context.Context, ir *rpc.CreateInterceptRequest) *rpc.InterceptResult {
+	name := ir.Spec.Name
+	dlog.Infof(c, "restoring intercept %s", name)
+	if ir.MountPoint != "" && (runtime.GOOS != "windows" || ir.VolumeCopy != nil) {
+		if err := os.MkdirAll(ir.MountPoint, 0700); err != nil {
+			dlog.Errorf(c, "unable to create mount point %s: %v", ir.MountPoint, err)
+			ir.MountPoint = ""
+		}
+	}
+	result, err := tm.AddIntercept(c, ir)
+	if err != nil {
+		result = interceptError(rpc.InterceptError_TRAFFIC_MANAGER_ERROR, err)
+	}
+	if result.Error != rpc.InterceptError_UNSPECIFIED {
+		dlog.Errorf(c, "unable to restore intercept %s: %s", name, result.ErrorText)
+		tm.forgetIntercept(c, name)
+		if result.InterceptInfo == nil {
+			// Let the caller know what intercept this result is for.
+			result.InterceptInfo = &manager.InterceptInfo{Spec: ir.Spec}
+		}
+		return result
+	}
+	if ir.Spec.Agent != "" && (ir.EnvFile != "" || ir.EnvJson != "") {
+		env := make(map[string]string, len(result.Environment)+1)
+		for k, v := range result.Environment {
+			env[k] = v
+		}
+		env["TELEPRESENCE_INTERCEPT_ID"] = result.InterceptInfo.Id
+		if ir.EnvFile != "" {
+			if err := client.WriteEnvFile(ir.EnvFile, env); err != nil {
+				dlog.Errorf(c, "unable to write environment file %s: %v", ir.EnvFile, err)
+			}
+		}
+		if ir.EnvJson != "" {
+			if err := client.WriteEnvJSON(ir.EnvJson, env); err != nil {
+				dlog.Errorf(c, "unable to write environment file %s: %v", ir.EnvJson, err)
+			}
+		}
+	}
+	return result
+}
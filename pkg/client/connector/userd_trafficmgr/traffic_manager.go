@@ -26,18 +26,19 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/a8rcloud"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
-	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_grpc"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/connector/userd_k8s"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
 	"github.com/telepresenceio/telepresence/v2/pkg/dnet"
 	"github.com/telepresenceio/telepresence/v2/pkg/install"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 type Callbacks struct {
-	GetCloudAPIKey        func(context.Context, string, bool) (string, error)
-	RegisterManagerServer func(server manager.ManagerServer)
-	SetOutboundInfo       func(ctx context.Context, in *daemon.OutboundInfo, opts ...grpc.CallOption) (*empty.Empty, error)
+	GetCloudAPIKey  func(context.Context, string, bool) (string, error)
+	SetManagerConn  func(conn grpc.ClientConnInterface)
+	SetOutboundInfo func(ctx context.Context, in *daemon.OutboundInfo, opts ...grpc.CallOption) (*empty.Empty, error)
+	Notify          func(ctx context.Context, message string)
 }
 
 // trafficManager is a handle to access the Traffic Manager in a
@@ -67,6 +68,22 @@ type trafficManager struct {
 	// mount points concurrently
 	mountMutexes sync.Map
 
+	// File systems mounted using the built-in SFTP client, keyed by mount point
+	sftpMounts     map[string]*sftpMount
+	sftpMountsLock sync.Mutex
+
+	// Map of *volumeCopy keyed by mount point, for intercepts that copy the remote volumes
+	volumeCopies sync.Map
+
+	// Map of *interceptRecorder keyed by intercept name
+	recorders sync.Map
+
+	// Map of *interceptHealth keyed by intercept name
+	healthChecks sync.Map
+
+	// savedInterceptsLock serializes updates of the intercepts cache
+	savedInterceptsLock sync.Mutex
+
 	// currentIntercepts is the latest snapshot returned by the intercept watcher
 	currentIntercepts     []*manager.InterceptInfo
 	currentInterceptsLock sync.Mutex
@@ -158,11 +175,16 @@ func (tm *trafficManager) Run(c context.Context) error {
 		}
 	}()
 
-	opts := []grpc.DialOption{grpc.WithContextDialer(grpcDialer),
+	// The token is only sent once the traffic-manager asks for it, and is then sent with all calls
+	// that use the connection, including the ones that the root daemon makes through the proxy.
+	token := &bearerToken{fetch: tm.BearerToken}
+	opts := append([]grpc.DialOption{grpc.WithContextDialer(grpcDialer),
 		grpc.WithInsecure(),
+		grpc.WithPerRPCCredentials(token),
+		grpc.WithChainUnaryInterceptor(token.unaryInterceptor),
 		grpc.WithNoProxy(),
 		grpc.WithBlock(),
-		grpc.WithReturnConnectionError()}
+		grpc.WithReturnConnectionError()}, tracing.DialOptions()...)
 
 	conn, err = grpc.DialContext(tc, grpcAddr, opts...)
 	if err != nil {
@@ -170,7 +192,7 @@ func (tm *trafficManager) Run(c context.Context) error {
 	}
 
 	mClient := manager.NewManagerClient(conn)
-	si, err := mClient.ArriveAsClient(tc, &manager.ClientInfo{
+	clientInfo := &manager.ClientInfo{
 		Name:      tm.userAndHost,
 		InstallId: tm.installID,
 		Product:   "telepresence",
@@ -181,16 +203,29 @@ func (tm *trafficManager) Run(c context.Context) error {
 			tok, _ := tm.callbacks.GetCloudAPIKey(c, a8rcloud.KeyDescTrafficManager, false)
 			return tok
 		}(),
-	})
+	}
+	si, err := mClient.ArriveAsClient(tc, clientInfo)
+	if status.Code(err) == codes.Unauthenticated {
+		// The traffic-manager requires that the client presents its Kubernetes identity. The token
+		// is only sent when it's asked for, so that it isn't disclosed to managers that don't verify it.
+		if err = token.enable(tc); err != nil {
+			return err
+		}
+		si, err = mClient.ArriveAsClient(tc, clientInfo)
+	}
 	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return errcat.User.Newf("manager.ArriveAsClient: %s", status.Convert(err).Message())
+		}
 		return client.CheckTimeout(tc, fmt.Errorf("manager.ArriveAsClient: %w", err))
 	}
 	tm.managerClient = mClient
 	tm.sessionInfo = si
 
-	// Gotta call RegisterManagerServer before we call daemon.SetOutboundInfo which tells the
+	// Gotta call SetManagerConn before we call daemon.SetOutboundInfo which tells the
 	// daemon to use the proxy.
-	tm.callbacks.RegisterManagerServer(userd_grpc.NewManagerProxy(tm.managerClient))
+	tm.callbacks.SetManagerConn(conn)
 
 	// Tell daemon what it needs to know in order to establish outbound traffic to the cluster
 	if _, err := tm.callbacks.SetOutboundInfo(c, tm.getOutboundInfo(c)); err != nil {
@@ -205,7 +240,89 @@ func (tm *trafficManager) Run(c context.Context) error {
 	g.Go("intercept-port-forward", tm.workerPortForwardIntercepts)
 	g.Go("agent-watcher", tm.agentInfoWatcher)
 	g.Go("dial-request-watcher", tm.dialRequestWatcher)
-	return g.Wait()
+	g.Go("notification-watcher", tm.notificationWatcher)
+	err = g.Wait()
+
+	// The connection is closed here, rather than left for the process to close, because a named
+	// connection can be disconnected while the connector keeps running.
+	_ = conn.Close()
+	return err
+}
+
+// bearerToken is a credentials.PerRPCCredentials that sends a Kubernetes bearer token to the
+// traffic-manager once it has been enabled. Tokens that are provided by exec plugins, or that are
+// bound service account tokens, expire, so the token is fetched again when the traffic-manager
+// rejects it.
+type bearerToken struct {
+	sync.Mutex
+	fetch   func(context.Context) (string, error)
+	enabled bool
+	token   string
+}
+
+// enable fetches the token and makes it part of the metadata of all subsequent calls.
+func (t *bearerToken) enable(ctx context.Context) error {
+	token, err := t.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	t.Lock()
+	t.enabled = true
+	t.token = token
+	t.Unlock()
+	return nil
+}
+
+// refresh fetches the token again, and returns true if it changed.
+func (t *bearerToken) refresh(ctx context.Context) (bool, error) {
+	t.Lock()
+	enabled, old := t.enabled, t.token
+	t.Unlock()
+	if !enabled {
+		return false, nil
+	}
+	token, err := t.fetch(ctx)
+	if err != nil {
+		return false, err
+	}
+	t.Lock()
+	t.token = token
+	t.Unlock()
+	return token != old, nil
+}
+
+func (t *bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	t.Lock()
+	defer t.Unlock()
+	if !t.enabled {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity returns false because the connection to the traffic-manager is
+// port-forwarded through the API server.
+func (t *bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// unaryInterceptor is a grpc.UnaryClientInterceptor that fetches the token again when a call is
+// rejected as unauthenticated, and then retries the call once if the token changed. Streams that
+// are opened after that use the new token.
+func (t *bearerToken) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if status.Code(err) != codes.Unauthenticated {
+		return err
+	}
+	changed, rErr := t.refresh(ctx)
+	if rErr != nil {
+		dlog.Errorf(ctx, "unable to refresh the bearer token: %v", rErr)
+		return err
+	}
+	if !changed {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
 }
 
 func (tm *trafficManager) session() *manager.SessionInfo {
@@ -213,52 +330,24 @@ func (tm *trafficManager) session() *manager.SessionInfo {
 }
 
 // hasOwner parses an object and determines whether the object has an
-// owner that is of a kind we prefer. Currently the only owner that we
-// prefer is a Deployment, but this may grow in the future
+// owner that is of a kind we prefer. Currently the owners that we prefer
+// are Deployments and Argo Rollouts, since they own ReplicaSets.
 func (tm *trafficManager) hasOwner(obj kates.Object) bool {
 	for _, owner := range obj.GetOwnerReferences() {
-		if owner.Kind == "Deployment" {
+		if owner.Kind == "Deployment" || owner.Kind == "Rollout" {
 			return true
 		}
 	}
 	return false
 }
 
-// getReasonAndLabels gets the workload's associated labels, as well as a reason
-// it cannot be intercepted if that is the case.
-func (tm *trafficManager) getReasonAndLabels(workload kates.Object, namespace, name string) (map[string]string, string, error) {
-	var labels map[string]string
-	var reason string
-	switch workload := workload.(type) {
-	case *kates.Deployment:
-		if workload.Status.Replicas == int32(0) {
-			reason = "Has 0 replicas"
-		}
-		labels = workload.Spec.Template.Labels
-
-	case *kates.ReplicaSet:
-		if workload.Status.Replicas == int32(0) {
-			reason = "Has 0 replicas"
-		}
-		labels = workload.Spec.Template.Labels
-
-	case *kates.StatefulSet:
-		if workload.Status.Replicas == int32(0) {
-			reason = "Has 0 replicas"
-		}
-		labels = workload.Spec.Template.Labels
-	default:
-		reason = "No workload telepresence knows how to intercept"
-	}
-	return labels, reason, nil
-}
-
 // getInfosForWorkload creates a WorkloadInfo for every workload in names
 // of the given objectKind.  Additionally, it uses information about the
 // filter param, which is configurable, to decide which workloads to add
 // or ignore based on the filter criteria.
 func (tm *trafficManager) getInfosForWorkloads(
 	ctx context.Context,
+	wk WorkloadKind,
 	workloads []kates.Object,
 	namespace string,
 	iMap map[string]*manager.InterceptInfo,
@@ -279,10 +368,7 @@ func (tm *trafficManager) getInfosForWorkloads(
 		reason := ""
 		if agent == nil && iCept == nil {
 			var labels map[string]string
-			var err error
-			if labels, reason, err = tm.getReasonAndLabels(workload, namespace, name); err != nil {
-				continue
-			}
+			labels, reason = wk.Interceptable(workload)
 			if reason == "" {
 				// If an object is owned by a higher level workload, then users should
 				// intercept that workload so we will not include it in our slice.
@@ -313,7 +399,7 @@ func (tm *trafficManager) getInfosForWorkloads(
 			NotInterceptableReason: reason,
 			AgentInfo:              agent,
 			InterceptInfo:          iCept,
-			WorkloadResourceType:   workload.GetObjectKind().GroupVersionKind().Kind,
+			WorkloadResourceType:   wk.Kind(),
 		})
 	}
 	return workloadInfos
@@ -340,22 +426,14 @@ func (tm *trafficManager) WorkloadInfoSnapshot(ctx context.Context, rq *rpc.List
 	filter := rq.Filter
 	workloadInfos := make([]*rpc.WorkloadInfo, 0)
 
-	// These are all the workloads we care about and their associated function
-	// to get the names of those workloads
-	workloadsToGet := map[string]func(context.Context, string) ([]kates.Object, error){
-		"Deployment":  tm.Deployments,
-		"ReplicaSet":  tm.ReplicaSets,
-		"StatefulSet": tm.StatefulSets,
-	}
-
-	for workloadKind, getFunc := range workloadsToGet {
-		workloads, err := getFunc(ctx, namespace)
+	for _, wk := range workloadKinds {
+		workloads, err := wk.List(ctx, tm.Client(), namespace)
 		if err != nil {
 			dlog.Error(ctx, err)
-			dlog.Infof(ctx, "Skipping getting info for workloads: %s", workloadKind)
+			dlog.Infof(ctx, "Skipping getting info for workloads: %s", wk.Kind())
 			continue
 		}
-		newWorkloadInfos := tm.getInfosForWorkloads(ctx, workloads, namespace, iMap, aMap, filter)
+		newWorkloadInfos := tm.getInfosForWorkloads(ctx, wk, workloads, namespace, iMap, aMap, filter)
 		workloadInfos = append(workloadInfos, newWorkloadInfos...)
 	}
 
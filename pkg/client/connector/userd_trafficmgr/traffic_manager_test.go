@@ -0,0 +1,94 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// rotatingManagerServer is a manager.ManagerServer that only accepts calls that carry its current token.
+type rotatingManagerServer struct {
+	manager.UnimplementedManagerServer
+	sync.Mutex
+	token string
+}
+
+func (s *rotatingManagerServer) setToken(token string) {
+	s.Lock()
+	s.token = token
+	s.Unlock()
+}
+
+func (s *rotatingManagerServer) Remain(ctx context.Context, _ *manager.RemainRequest) (*empty.Empty, error) {
+	s.Lock()
+	defer s.Unlock()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			if auth == "Bearer "+s.token {
+				return &empty.Empty{}, nil
+			}
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "the token of the client is not valid")
+}
+
+func TestBearerToken_Rotation(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	srv := &rotatingManagerServer{token: "token-1"}
+	lis := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	manager.RegisterManagerServer(gs, srv)
+	go func() { _ = gs.Serve(lis) }()
+	defer gs.Stop()
+
+	// The token source is the kubeconfig, which hands out the token that the server accepts
+	var fetches int
+	token := &bearerToken{fetch: func(context.Context) (string, error) {
+		fetches++
+		srv.Lock()
+		defer srv.Unlock()
+		return srv.token, nil
+	}}
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithPerRPCCredentials(token),
+		grpc.WithChainUnaryInterceptor(token.unaryInterceptor))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := manager.NewManagerClient(conn)
+
+	// No token is sent until it's enabled
+	_, err = client.Remain(ctx, &manager.RemainRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 0, fetches)
+
+	require.NoError(t, token.enable(ctx))
+	_, err = client.Remain(ctx, &manager.RemainRequest{})
+	require.NoError(t, err)
+	_, err = client.Remain(ctx, &manager.RemainRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// When the token expires, the call that is rejected fetches the new token and is retried with it
+	srv.setToken("token-2")
+	_, err = client.Remain(ctx, &manager.RemainRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+	_, err = client.Remain(ctx, &manager.RemainRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+}
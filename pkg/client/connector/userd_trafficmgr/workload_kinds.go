@@ -0,0 +1,595 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8err "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/datawire/ambassador/v2/pkg/kates"
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/v2/pkg/install"
+)
+
+// WorkloadKind knows how to find, list, and modify workloads of one kind. A workload is modified
+// by changing the pod template that install.GetPodTemplateFromObject returns for it, and then
+// applying it.
+type WorkloadKind interface {
+	// Kind returns the Kubernetes kind of the workloads, e.g. "Deployment".
+	Kind() string
+
+	// List returns all workloads of this kind in the given namespace.
+	List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error)
+
+	// Find returns the workload of this kind with the given name and namespace, or an error for
+	// which kates.IsNotFound is true if no such workload exists.
+	Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error)
+
+	// Interceptable returns the labels of the pods of the workload, and the reason why the workload
+	// cannot be intercepted, or the empty string if it can.
+	Interceptable(obj kates.Object) (labels map[string]string, reason string)
+
+	// Apply writes a modified workload to the cluster and makes sure that its pods are
+	// replaced with pods that use the modified pod template.
+	Apply(c context.Context, kc *kates.Client, obj kates.Object) error
+
+	// Updated fetches the workload again and returns true if the modifications that were
+	// applied when the workload had the given generation have been rolled out.
+	Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error)
+
+	// Restart replaces the pods of the workload without modifying it, so that the pods are
+	// subjected to the agent injector again.
+	Restart(c context.Context, kc *kates.Client, obj kates.Object) error
+}
+
+// workloadKinds are the known kinds of workloads, in the order that they are searched when finding
+// a workload by name.
+var workloadKinds = []WorkloadKind{
+	deploymentKind{},
+	replicaSetKind{},
+	statefulSetKind{},
+	daemonSetKind{},
+	rolloutKind{},
+	podKind{},
+}
+
+// RegisterWorkloadKind adds a kind of workload that can be listed and intercepted. It must be
+// called before any connection is made.
+func RegisterWorkloadKind(wk WorkloadKind) {
+	workloadKinds = append(workloadKinds, wk)
+}
+
+// workloadKindOf returns the WorkloadKind of the given workload.
+func workloadKindOf(obj kates.Object) (WorkloadKind, error) {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	for _, wk := range workloadKinds {
+		if wk.Kind() == kind {
+			return wk, nil
+		}
+	}
+	return nil, install.ObjErrorf(obj, "unsupported workload kind %q", kind)
+}
+
+// findWorkload returns the workload with the given name and namespace. The kinds are searched in
+// the order of workloadKinds and the first workload found is returned.
+func findWorkload(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	for _, wk := range workloadKinds {
+		obj, err := wk.Find(c, kc, namespace, name)
+		if err != nil {
+			if kates.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		return obj, nil
+	}
+	return nil, k8err.NewNotFound(corev1.Resource("workload"), name+"."+namespace)
+}
+
+// restartTemplate recreates "kubectl rollout restart <obj>" by adding an annotation to the pod
+// template of the given workload.
+func restartTemplate(c context.Context, kc *kates.Client, obj kates.Object, pt kates.PatchType) error {
+	restartAnnotation := fmt.Sprintf(
+		`{"spec": {"template": {"metadata": {"annotations": {"%srestartedAt": "%s"}}}}}`,
+		install.DomainPrefix,
+		time.Now().Format(time.RFC3339),
+	)
+	return kc.Patch(c, obj, pt, []byte(restartAnnotation), obj)
+}
+
+func replicasReason(replicas int32) string {
+	if replicas == 0 {
+		return "Has 0 replicas"
+	}
+	return ""
+}
+
+type deploymentKind struct{}
+
+func (deploymentKind) Kind() string {
+	return "Deployment"
+}
+
+func (deploymentKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	var deployments []*kates.Deployment
+	if err := kc.List(c, kates.Query{Kind: "Deployment", Namespace: namespace}, &deployments); err != nil {
+		return nil, err
+	}
+	objs := make([]kates.Object, len(deployments))
+	for i, dep := range deployments {
+		objs[i] = dep
+	}
+	return objs, nil
+}
+
+func (deploymentKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	dep := &kates.Deployment{
+		TypeMeta:   kates.TypeMeta{Kind: "Deployment"},
+		ObjectMeta: kates.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := kc.Get(c, dep, dep); err != nil {
+		return nil, err
+	}
+	return dep, nil
+}
+
+func (deploymentKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	dep := obj.(*kates.Deployment)
+	return dep.Spec.Template.Labels, replicasReason(dep.Status.Replicas)
+}
+
+func (deploymentKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return kc.Update(c, obj, obj)
+}
+
+func (deploymentKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error) {
+	dep := obj.(*kates.Deployment)
+	if err := kc.Get(c, dep, dep); err != nil {
+		return false, err
+	}
+	return dep.ObjectMeta.Generation >= origGeneration &&
+		dep.Status.ObservedGeneration == dep.ObjectMeta.Generation &&
+		(dep.Spec.Replicas == nil || dep.Status.UpdatedReplicas >= *dep.Spec.Replicas) &&
+		dep.Status.UpdatedReplicas == dep.Status.Replicas &&
+		dep.Status.AvailableReplicas == dep.Status.Replicas, nil
+}
+
+func (deploymentKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return restartTemplate(c, kc, obj, kates.StrategicMergePatchType)
+}
+
+type replicaSetKind struct{}
+
+func (replicaSetKind) Kind() string {
+	return "ReplicaSet"
+}
+
+func (replicaSetKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	var replicaSets []*kates.ReplicaSet
+	if err := kc.List(c, kates.Query{Kind: "ReplicaSet", Namespace: namespace}, &replicaSets); err != nil {
+		return nil, err
+	}
+	objs := make([]kates.Object, len(replicaSets))
+	for i, rs := range replicaSets {
+		objs[i] = rs
+	}
+	return objs, nil
+}
+
+func (replicaSetKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	rs := &kates.ReplicaSet{
+		TypeMeta:   kates.TypeMeta{Kind: "ReplicaSet"},
+		ObjectMeta: kates.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := kc.Get(c, rs, rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (replicaSetKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	rs := obj.(*kates.ReplicaSet)
+	return rs.Spec.Template.Labels, replicasReason(rs.Status.Replicas)
+}
+
+// Apply updates the ReplicaSet and deletes the pods that it owns. This is necessary because
+// updating a ReplicaSet does *not* generate new pods if the desired amount already exists.
+func (replicaSetKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	if err := kc.Update(c, obj, obj); err != nil {
+		return err
+	}
+	var pods []*kates.Pod
+	if err := kc.List(c, kates.Query{Kind: "Pod", Namespace: obj.GetNamespace()}, &pods); err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		for _, ownerRef := range pod.OwnerReferences {
+			if ownerRef.UID == obj.GetUID() {
+				dlog.Infof(c, "Deleting pod %s.%s owned by rs %s", pod.Name, pod.Namespace, obj.GetName())
+				pod := &kates.Pod{
+					TypeMeta: kates.TypeMeta{
+						Kind: "Pod",
+					},
+					ObjectMeta: kates.ObjectMeta{
+						Namespace: pod.Namespace,
+						Name:      pod.Name,
+					},
+				}
+				if err := kc.Delete(c, pod, nil); err != nil {
+					if kates.IsNotFound(err) || kates.IsConflict(err) {
+						// If an intercept creates a new pod by installing an agent, and the agent is then uninstalled shortly after, the
+						// old pod may still show up here during removal, and even after it has been removed if the removal completed
+						// after we obtained the pods list. This is OK. This pod will not be in our way.
+						continue
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (replicaSetKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error) {
+	rs := obj.(*kates.ReplicaSet)
+	if err := kc.Get(c, rs, rs); err != nil {
+		return false, err
+	}
+	return rs.ObjectMeta.Generation >= origGeneration &&
+		rs.Status.ObservedGeneration == rs.ObjectMeta.Generation &&
+		(rs.Spec.Replicas == nil || rs.Status.Replicas >= *rs.Spec.Replicas) &&
+		rs.Status.FullyLabeledReplicas == rs.Status.Replicas &&
+		rs.Status.AvailableReplicas == rs.Status.Replicas, nil
+}
+
+func (replicaSetKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return restartTemplate(c, kc, obj, kates.StrategicMergePatchType)
+}
+
+type statefulSetKind struct{}
+
+func (statefulSetKind) Kind() string {
+	return "StatefulSet"
+}
+
+func (statefulSetKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	var statefulSets []*kates.StatefulSet
+	if err := kc.List(c, kates.Query{Kind: "StatefulSet", Namespace: namespace}, &statefulSets); err != nil {
+		return nil, err
+	}
+	objs := make([]kates.Object, len(statefulSets))
+	for i, ss := range statefulSets {
+		objs[i] = ss
+	}
+	return objs, nil
+}
+
+func (statefulSetKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	ss := &kates.StatefulSet{
+		TypeMeta:   kates.TypeMeta{Kind: "StatefulSet"},
+		ObjectMeta: kates.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := kc.Get(c, ss, ss); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (statefulSetKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	ss := obj.(*kates.StatefulSet)
+	return ss.Spec.Template.Labels, replicasReason(ss.Status.Replicas)
+}
+
+func (statefulSetKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return kc.Update(c, obj, obj)
+}
+
+func (statefulSetKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error) {
+	ss := obj.(*kates.StatefulSet)
+	if err := kc.Get(c, ss, ss); err != nil {
+		return false, err
+	}
+	return ss.ObjectMeta.Generation >= origGeneration &&
+		ss.Status.ObservedGeneration == ss.ObjectMeta.Generation &&
+		(ss.Spec.Replicas == nil || ss.Status.UpdatedReplicas >= *ss.Spec.Replicas) &&
+		ss.Status.UpdatedReplicas == ss.Status.Replicas &&
+		ss.Status.CurrentReplicas == ss.Status.Replicas, nil
+}
+
+func (statefulSetKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return restartTemplate(c, kc, obj, kates.StrategicMergePatchType)
+}
+
+type daemonSetKind struct{}
+
+func (daemonSetKind) Kind() string {
+	return "DaemonSet"
+}
+
+func (daemonSetKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	var daemonSets []*appsv1.DaemonSet
+	if err := kc.List(c, kates.Query{Kind: "DaemonSet", Namespace: namespace}, &daemonSets); err != nil {
+		return nil, err
+	}
+	objs := make([]kates.Object, len(daemonSets))
+	for i, ds := range daemonSets {
+		objs[i] = ds
+	}
+	return objs, nil
+}
+
+func (daemonSetKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	ds := &appsv1.DaemonSet{
+		TypeMeta:   kates.TypeMeta{Kind: "DaemonSet"},
+		ObjectMeta: kates.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := kc.Get(c, ds, ds); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+func (daemonSetKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	ds := obj.(*appsv1.DaemonSet)
+	reason := ""
+	if ds.Status.DesiredNumberScheduled == 0 {
+		reason = "Has no scheduled pods"
+	}
+	return ds.Spec.Template.Labels, reason
+}
+
+func (daemonSetKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return kc.Update(c, obj, obj)
+}
+
+func (daemonSetKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error) {
+	ds := obj.(*appsv1.DaemonSet)
+	if err := kc.Get(c, ds, ds); err != nil {
+		return false, err
+	}
+	return ds.ObjectMeta.Generation >= origGeneration &&
+		ds.Status.ObservedGeneration == ds.ObjectMeta.Generation &&
+		ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled, nil
+}
+
+func (daemonSetKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return restartTemplate(c, kc, obj, kates.StrategicMergePatchType)
+}
+
+// rolloutKind is the kind of Argo Rollouts. Rollouts are custom resources, so a cluster that
+// doesn't have Argo Rollouts installed just has no rollouts.
+type rolloutKind struct{}
+
+// rolloutQueryKind is qualified with the group so that other custom resources named Rollout aren't
+// mistaken for Argo Rollouts.
+const rolloutQueryKind = "Rollout.argoproj.io"
+
+func (rolloutKind) Kind() string {
+	return "Rollout"
+}
+
+// isUnknownResource returns true if the error is the one that kates returns when the cluster
+// doesn't have the resource type that was queried.
+func isUnknownResource(err error) bool {
+	return strings.Contains(err.Error(), "the server doesn't have a resource type")
+}
+
+func (rolloutKind) list(c context.Context, kc *kates.Client, query kates.Query) ([]kates.Object, error) {
+	var rollouts []*install.Rollout
+	if err := kc.List(c, query, &rollouts); err != nil {
+		if isUnknownResource(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	objs := make([]kates.Object, len(rollouts))
+	for i, ro := range rollouts {
+		objs[i] = ro
+	}
+	return objs, nil
+}
+
+func (rk rolloutKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	return rk.list(c, kc, kates.Query{Kind: rolloutQueryKind, Namespace: namespace})
+}
+
+// Find uses a list query because kates panics when asked to get a resource of an unknown type.
+func (rk rolloutKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	objs, err := rk.list(c, kc, kates.Query{Kind: rolloutQueryKind, Namespace: namespace, FieldSelector: "metadata.name=" + name})
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) == 0 {
+		return nil, k8err.NewNotFound(corev1.Resource("rollout"), name+"."+namespace)
+	}
+	return objs[0], nil
+}
+
+func (rolloutKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	ro := obj.(*install.Rollout)
+	return ro.Spec.Template.Labels, replicasReason(ro.Status.Replicas)
+}
+
+func (rolloutKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return kc.Update(c, obj, obj)
+}
+
+func (rolloutKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, origGeneration int64) (bool, error) {
+	ro := obj.(*install.Rollout)
+	if err := kc.Get(c, ro, ro); err != nil {
+		return false, err
+	}
+	return ro.ObjectMeta.Generation >= origGeneration &&
+		ro.Status.ObservedGeneration == strconv.FormatInt(ro.ObjectMeta.Generation, 10) &&
+		ro.Status.Phase == "Healthy" &&
+		(ro.Spec.Replicas == nil || ro.Status.UpdatedReplicas >= *ro.Spec.Replicas) &&
+		ro.Status.AvailableReplicas == ro.Status.Replicas, nil
+}
+
+// Restart uses a merge patch, because custom resources don't support strategic merge patches.
+func (rolloutKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return restartTemplate(c, kc, obj, kates.MergePatchType)
+}
+
+// podKind is the kind of pods that aren't owned by another workload. Such pods are represented by
+// an install.BarePod. The containers of a pod cannot be changed, so a pod is modified by deleting
+// it and creating it again.
+type podKind struct{}
+
+func (podKind) Kind() string {
+	return "Pod"
+}
+
+func (podKind) List(c context.Context, kc *kates.Client, namespace string) ([]kates.Object, error) {
+	var pods []*kates.Pod
+	if err := kc.List(c, kates.Query{Kind: "Pod", Namespace: namespace}, &pods); err != nil {
+		return nil, err
+	}
+	var objs []kates.Object
+	for _, pod := range pods {
+		if len(pod.OwnerReferences) == 0 {
+			objs = append(objs, install.NewBarePod(pod))
+		}
+	}
+	return objs, nil
+}
+
+func (podKind) Find(c context.Context, kc *kates.Client, namespace, name string) (kates.Object, error) {
+	pod := &kates.Pod{
+		TypeMeta:   kates.TypeMeta{Kind: "Pod"},
+		ObjectMeta: kates.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	if err := kc.Get(c, pod, pod); err != nil {
+		return nil, err
+	}
+	if len(pod.OwnerReferences) > 0 {
+		// The pod belongs to another workload
+		return nil, k8err.NewNotFound(corev1.Resource("pod"), name+"."+namespace)
+	}
+	return install.NewBarePod(pod), nil
+}
+
+func (podKind) Interceptable(obj kates.Object) (map[string]string, string) {
+	bp := obj.(*install.BarePod)
+	reason := ""
+	if bp.Status.Phase != corev1.PodRunning && bp.Status.Phase != corev1.PodPending {
+		reason = fmt.Sprintf("Pod is %s", bp.Status.Phase)
+	}
+	return bp.Spec.Template.Labels, reason
+}
+
+func (podKind) Apply(c context.Context, kc *kates.Client, obj kates.Object) error {
+	bp := obj.(*install.BarePod)
+	pod := bp.Pod()
+	if err := replacePod(c, kc, pod); err != nil {
+		return err
+	}
+	*bp = *install.NewBarePod(pod)
+	return nil
+}
+
+// podClient is the part of a kates.Client that replacePod uses.
+type podClient interface {
+	Get(ctx context.Context, resource, target interface{}) error
+	Create(ctx context.Context, resource, target interface{}) error
+	Delete(ctx context.Context, resource, target interface{}) error
+}
+
+// replacePodTimeout is how long replacePod waits for a deleted pod to go away and for the pod that
+// replaces it to be created.
+const replacePodTimeout = 2 * time.Minute
+
+// replacePod deletes the pod with the name and namespace of the given pod, and creates the given pod
+// in its place. The pod that was deleted is created again if the given pod can't be created, e.g.
+// because an admission webhook or a quota rejects it, so that the user's pod isn't lost. Once the pod
+// has been deleted, the replacement runs to completion even if the given context is cancelled.
+func replacePod(c context.Context, pc podClient, pod *kates.Pod) error {
+	orig := &kates.Pod{TypeMeta: pod.TypeMeta, ObjectMeta: kates.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+	if err := pc.Get(c, orig, orig); err != nil {
+		return err
+	}
+	c = dcontext.WithoutCancel(c)
+	tc, cancel := context.WithTimeout(c, replacePodTimeout)
+	defer cancel()
+	dlog.Infof(c, "Deleting pod %s.%s so that it can be created again with a modified spec", pod.Name, pod.Namespace)
+	if err := pc.Delete(tc, orig, nil); err != nil && !kates.IsNotFound(err) {
+		return err
+	}
+
+	err := waitForPodDeleted(tc, pc, pod)
+	if err == nil {
+		resetPodForCreate(pod)
+		if err = pc.Create(tc, pod, pod); err == nil {
+			return nil
+		}
+	}
+	dlog.Errorf(c, "Unable to create pod %s.%s, creating the original pod again: %v", pod.Name, pod.Namespace, err)
+	rc, rcancel := context.WithTimeout(c, replacePodTimeout)
+	defer rcancel()
+	resetPodForCreate(orig)
+	rerr := waitForPodDeleted(rc, pc, orig)
+	if rerr == nil {
+		rerr = pc.Create(rc, orig, orig)
+	}
+	if rerr != nil {
+		return fmt.Errorf("unable to create pod %s.%s: %w; the original pod could not be created again: %v", pod.Name, pod.Namespace, err, rerr)
+	}
+	return fmt.Errorf("unable to create pod %s.%s: %w; the original pod was created again", pod.Name, pod.Namespace, err)
+}
+
+// waitForPodDeleted waits until the pod with the name and namespace of the given pod is gone. A pod
+// can't be created while another pod with the same name is terminating.
+func waitForPodDeleted(c context.Context, pc podClient, pod *kates.Pod) error {
+	for {
+		if err := pc.Get(c, &kates.Pod{TypeMeta: pod.TypeMeta, ObjectMeta: kates.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}, nil); err != nil {
+			if kates.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		dtime.SleepWithContext(c, time.Second)
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// resetPodForCreate clears the fields of a pod that are assigned by the cluster.
+func resetPodForCreate(pod *kates.Pod) {
+	pod.ResourceVersion = ""
+	pod.UID = ""
+	pod.CreationTimestamp = kates.Time{}
+	pod.DeletionTimestamp = nil
+	pod.DeletionGracePeriodSeconds = nil
+	pod.Status = corev1.PodStatus{}
+}
+
+func (podKind) Updated(c context.Context, kc *kates.Client, obj kates.Object, _ int64) (bool, error) {
+	bp := obj.(*install.BarePod)
+	pod := bp.Pod()
+	if err := kc.Get(c, pod, pod); err != nil {
+		return false, err
+	}
+	*bp = *install.NewBarePod(pod)
+	if pod.Status.Phase != corev1.PodRunning || len(pod.Status.ContainerStatuses) != len(pod.Spec.Containers) {
+		return false, nil
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if !cs.Ready {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Restart deletes the pod and creates it again without modifying it.
+func (pk podKind) Restart(c context.Context, kc *kates.Client, obj kates.Object) error {
+	return pk.Apply(c, kc, obj)
+}
@@ -0,0 +1,130 @@
+package userd_trafficmgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	k8err "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/datawire/ambassador/v2/pkg/kates"
+	"github.com/datawire/dlib/dlog"
+)
+
+// fakePodClient is a podClient that keeps pods in memory and rejects the creation of pods that
+// the reject function returns an error for. Like a real client, it fails when its context is done.
+// The onDelete function, when set, is called after a pod has been deleted.
+type fakePodClient struct {
+	pods     map[string]*kates.Pod
+	reject   func(*kates.Pod) error
+	onDelete func()
+}
+
+func (fc *fakePodClient) Get(ctx context.Context, resource, target interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pod := resource.(*kates.Pod)
+	stored, ok := fc.pods[pod.Name]
+	if !ok {
+		return k8err.NewNotFound(corev1.Resource("pod"), pod.Name)
+	}
+	if target != nil {
+		*target.(*kates.Pod) = *stored.DeepCopy()
+	}
+	return nil
+}
+
+func (fc *fakePodClient) Create(ctx context.Context, resource, target interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pod := resource.(*kates.Pod)
+	if err := fc.reject(pod); err != nil {
+		return err
+	}
+	if _, ok := fc.pods[pod.Name]; ok {
+		return k8err.NewAlreadyExists(corev1.Resource("pod"), pod.Name)
+	}
+	fc.pods[pod.Name] = pod.DeepCopy()
+	if target != nil {
+		*target.(*kates.Pod) = *pod.DeepCopy()
+	}
+	return nil
+}
+
+func (fc *fakePodClient) Delete(ctx context.Context, resource, _ interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pod := resource.(*kates.Pod)
+	if _, ok := fc.pods[pod.Name]; !ok {
+		return k8err.NewNotFound(corev1.Resource("pod"), pod.Name)
+	}
+	delete(fc.pods, pod.Name)
+	if fc.onDelete != nil {
+		fc.onDelete()
+	}
+	return nil
+}
+
+func TestReplacePod_CreateFails(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	newPod := func(containers ...string) *kates.Pod {
+		pod := &kates.Pod{
+			TypeMeta:   kates.TypeMeta{Kind: "Pod"},
+			ObjectMeta: kates.ObjectMeta{Name: "hello", Namespace: "default", ResourceVersion: "1"},
+		}
+		for _, c := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: c, Image: c})
+		}
+		return pod
+	}
+	webhookErr := errors.New(`admission webhook "policy" denied the request`)
+	rejectAgent := func(pod *kates.Pod) error {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == "traffic-agent" {
+				return webhookErr
+			}
+		}
+		return nil
+	}
+
+	t.Run("original is restored", func(t *testing.T) {
+		fc := &fakePodClient{pods: map[string]*kates.Pod{"hello": newPod("app")}, reject: rejectAgent}
+		err := replacePod(ctx, fc, newPod("app", "traffic-agent"))
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, webhookErr))
+		assert.Contains(t, err.Error(), "the original pod was created again")
+
+		restored, ok := fc.pods["hello"]
+		require.True(t, ok)
+		require.Len(t, restored.Spec.Containers, 1)
+		assert.Equal(t, "app", restored.Spec.Containers[0].Name)
+		assert.Empty(t, restored.ResourceVersion)
+	})
+
+	t.Run("original can't be restored", func(t *testing.T) {
+		fc := &fakePodClient{pods: map[string]*kates.Pod{"hello": newPod("app")}, reject: func(*kates.Pod) error { return webhookErr }}
+		err := replacePod(ctx, fc, newPod("app", "traffic-agent"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "the original pod could not be created again")
+	})
+
+	t.Run("modified pod is created", func(t *testing.T) {
+		fc := &fakePodClient{pods: map[string]*kates.Pod{"hello": newPod("app")}, reject: func(*kates.Pod) error { return nil }}
+		require.NoError(t, replacePod(ctx, fc, newPod("app", "traffic-agent")))
+		assert.Len(t, fc.pods["hello"].Spec.Containers, 2)
+	})
+
+	t.Run("cancelled after delete", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		fc := &fakePodClient{pods: map[string]*kates.Pod{"hello": newPod("app")}, reject: func(*kates.Pod) error { return nil }, onDelete: cancel}
+		require.NoError(t, replacePod(ctx, fc, newPod("app", "traffic-agent")))
+		assert.Len(t, fc.pods["hello"].Spec.Containers, 2)
+	})
+}
@@ -14,7 +14,10 @@ import (
 	"github.com/datawire/dlib/dlog"
 )
 
-type Resolver func(ctx context.Context, domain string) []net.IP
+// Resolver resolves the given query. It returns nil when the name isn't found, and an empty slice when
+// the name exists but has no RRs of the query type. The TTL of each returned RR is the number of seconds
+// that it may be cached.
+type Resolver func(ctx context.Context, q *dns.Question) []dns.RR
 
 // recursionCheck is a special host name in a well known namespace that isn't expected to exist. It
 // is used once for determining if the cluster's DNS resolver will call the Telepresence DNS resolver
@@ -33,6 +36,12 @@ type Server struct {
 	cacheResolve func(*dns.Question) []dns.RR
 }
 
+// cacheKey is the key of an entry in the local DNS cache.
+type cacheKey struct {
+	name  string
+	qType uint16
+}
+
 type dnsValue struct {
 	created   time.Time
 	recursion int32 // will be set to the current qType during call to cluster
@@ -40,11 +49,18 @@ type dnsValue struct {
 	wait      chan struct{}
 }
 
-// cacheTTL is the time to live for an entry in the local DNS cache.
+// cacheTTL is the max time to live for an entry in the local DNS cache. An entry expires earlier
+// when one of its RRs has a shorter TTL.
 const cacheTTL = 60 * time.Second
 
 func (dv *dnsValue) expired() bool {
-	return time.Since(dv.created) > cacheTTL
+	ttl := cacheTTL
+	for _, rr := range dv.answer {
+		if rrTTL := time.Duration(rr.Header().Ttl) * time.Second; rrTTL < ttl {
+			ttl = rrTTL
+		}
+	}
+	return time.Since(dv.created) > ttl
 }
 
 // NewServer returns a new dns.Server
@@ -64,14 +80,21 @@ func (s *Server) RequestCount() int {
 	return int(atomic.LoadInt64(&s.requestCount))
 }
 
-func copyRRs(rrs []dns.RR, qType uint16) []dns.RR {
+// copyRRs returns a copy of the RRs in the given value where the TTL of each RR is decreased by the
+// time that has passed since the value was created.
+func copyRRs(dv *dnsValue) []dns.RR {
+	rrs := dv.answer
 	if len(rrs) == 0 {
 		return rrs
 	}
-	cp := make([]dns.RR, 0, len(rrs))
-	for _, rr := range rrs {
-		if rr.Header().Rrtype == qType {
-			cp = append(cp, dns.Copy(rr))
+	age := uint32(time.Since(dv.created) / time.Second)
+	cp := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		cp[i] = dns.Copy(rr)
+		if h := cp[i].Header(); h.Ttl > age {
+			h.Ttl -= age
+		} else {
+			h.Ttl = 0
 		}
 	}
 	return cp
@@ -81,8 +104,9 @@ func copyRRs(rrs []dns.RR, qType uint16) []dns.RR {
 // entry is found that hasn't expired, it's returned. If not, this function will call
 // resolveQuery() to resolve and store in the case.
 func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
+	key := cacheKey{name: q.Name, qType: q.Qtype}
 	newDv := &dnsValue{wait: make(chan struct{}), created: time.Now()}
-	if v, loaded := s.cache.LoadOrStore(q.Name, newDv); loaded {
+	if v, loaded := s.cache.LoadOrStore(key, newDv); loaded {
 		oldDv := v.(*dnsValue)
 		if atomic.LoadInt32(&s.recursive) == 2 && atomic.LoadInt32(&oldDv.recursion) == int32(q.Qtype) {
 			// We have to assume that this is a recursion from the cluster.
@@ -90,9 +114,9 @@ func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
 		}
 		<-oldDv.wait
 		if !oldDv.expired() {
-			return copyRRs(oldDv.answer, q.Qtype)
+			return copyRRs(oldDv)
 		}
-		s.cache.Store(q.Name, newDv)
+		s.cache.Store(key, newDv)
 	}
 	return s.resolveQuery(q, newDv)
 }
@@ -101,8 +125,9 @@ func (s *Server) resolveThruCache(q *dns.Question) []dns.RR {
 // recursionCheck query has completed, and it has been determined whether a query that is propagated
 // to the cluster will recurse back to this resolver or not.
 func (s *Server) resolveWithRecursionCheck(q *dns.Question) []dns.RR {
+	key := cacheKey{name: q.Name, qType: q.Qtype}
 	newDv := &dnsValue{wait: make(chan struct{}), created: time.Now()}
-	if v, loaded := s.cache.LoadOrStore(q.Name, newDv); loaded {
+	if v, loaded := s.cache.LoadOrStore(key, newDv); loaded {
 		oldDv := v.(*dnsValue)
 		if atomic.LoadInt32(&oldDv.recursion) == int32(q.Qtype) {
 			if q.Name == recursionCheck+"." {
@@ -114,9 +139,9 @@ func (s *Server) resolveWithRecursionCheck(q *dns.Question) []dns.RR {
 		}
 		<-oldDv.wait
 		if !oldDv.expired() {
-			return copyRRs(oldDv.answer, q.Qtype)
+			return copyRRs(oldDv)
 		}
-		s.cache.Store(q.Name, newDv)
+		s.cache.Store(key, newDv)
 	}
 
 	answer := s.resolveQuery(q, newDv)
@@ -192,10 +217,6 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	}
 }
 
-// dnsTTL is the number of seconds that a found DNS record should be allowed to live in the callers cache. We
-// keep this low to avoid such caching.
-const dnsTTL = 4
-
 func (s *Server) resolveQuery(q *dns.Question, dv *dnsValue) []dns.RR {
 	atomic.StoreInt32(&dv.recursion, int32(q.Qtype))
 	defer func() {
@@ -203,44 +224,15 @@ func (s *Server) resolveQuery(q *dns.Question, dv *dnsValue) []dns.RR {
 		close(dv.wait)
 	}()
 
-	switch q.Qtype {
-	case dns.TypeA, dns.TypeAAAA:
-		ips := s.resolve(s.ctx, q.Name)
-		if len(ips) == 0 {
-			break
-		}
-
-		answer := make([]dns.RR, 0, len(ips))
-		for _, ip := range ips {
-			var rr dns.RR
-			if ip4 := ip.To4(); ip4 != nil {
-				rr = &dns.A{
-					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: dnsTTL},
-					A:   ip4,
-				}
-			} else {
-				rr = &dns.AAAA{
-					Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: dnsTTL},
-					AAAA: ip,
-				}
-			}
-			answer = append(answer, rr)
-		}
-		dv.answer = answer
-	default:
-		ips := s.resolve(s.ctx, q.Name)
-		if len(ips) > 0 {
-			dv.answer = []dns.RR{}
-		}
-	}
+	dv.answer = s.resolve(s.ctx, q)
 	if len(dv.answer) == 0 {
-		s.cache.Delete(q.Name) // Don't cache unless the entry is found.
+		s.cache.Delete(cacheKey{name: q.Name, qType: q.Qtype}) // Don't cache unless the entry is found.
 	}
 
-	// Return a result for the correct query type. The result will be nil (nxdomain) if nothing was found. It might
-	// also be empty if no RRs were found for the given query type and that is OK.
+	// The result will be nil (nxdomain) if nothing was found. It might also be empty if no RRs were found
+	// for the given query type and that is OK.
 	// See https://datatracker.ietf.org/doc/html/rfc4074#section-3
-	return copyRRs(dv.answer, q.Qtype)
+	return copyRRs(dv)
 }
 
 // Run starts the DNS server(s) and waits for them to end
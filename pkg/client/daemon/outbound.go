@@ -4,10 +4,15 @@ import (
 	"context"
 	"math/rand"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/datawire/dlib/dgroup"
@@ -16,7 +21,9 @@ import (
 	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/scout"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 // outbound does stuff, idk, I didn't write it.
@@ -36,6 +43,10 @@ type outbound struct {
 
 	searchPathCh chan []string
 
+	// connPaths are the search paths and namespaces of each connection, keyed by connection name
+	connPaths     map[string]*rpc.Paths
+	connPathsLock sync.Mutex
+
 	dnsCache sync.Map
 
 	dnsConfig *rpc.DNSConfig
@@ -64,6 +75,7 @@ func newOutbound(c context.Context, dnsIPStr string, noSearch bool, scout chan<-
 		domains:      make(map[string]struct{}),
 		search:       []string{""},
 		searchPathCh: make(chan []string, 5),
+		connPaths:    make(map[string]*rpc.Paths),
 		scout:        scout,
 	}
 
@@ -93,12 +105,20 @@ func (o *outbound) shouldDoClusterLookup(query string) bool {
 		return false
 	}
 
+	// Reverse lookups of IPs in the cluster's subnets are always done in the cluster, even though
+	// the ".arpa" domain is excluded by default.
+	if ip := dnsproxy.ReverseIP(query); ip != nil && o.router.isClusterIP(ip) {
+		return true
+	}
+
 	query = query[:len(query)-1] // skip last dot
 
 	// Always include configured includeSuffixes
-	for _, sfx := range o.dnsConfig.IncludeSuffixes {
-		if strings.HasSuffix(query, sfx) {
-			return true
+	for _, s := range o.router.sortedSessions() {
+		for _, sfx := range s.dnsConfig.GetIncludeSuffixes() {
+			if strings.HasSuffix(query, sfx) {
+				return true
+			}
 		}
 	}
 
@@ -111,8 +131,8 @@ func (o *outbound) shouldDoClusterLookup(query string) bool {
 	return true
 }
 
-func (o *outbound) resolveInCluster(c context.Context, query string) (results []net.IP) {
-	query = strings.ToLower(query)
+func (o *outbound) resolveInCluster(c context.Context, q *dns.Question) (results []dns.RR) {
+	query := strings.ToLower(q.Name)
 	query = strings.TrimSuffix(query, tel2SubDomainDot)
 
 	if query == "localhost." {
@@ -123,12 +143,16 @@ func (o *outbound) resolveInCluster(c context.Context, query string) (results []
 		// But it does, so I need this in order to be
 		// productive at home.  We should really
 		// root-cause this, because it's weird.
-		return localhostIPs
+		return ipsToRRs(q, localhostIPs)
 	}
 
 	if !o.shouldDoClusterLookup(query) {
 		return nil
 	}
+	s := o.sessionForQuery(query)
+	if s == nil {
+		return nil
+	}
 	// Don't report queries that won't be resolved in-cluster, since that'll report every single DNS query on the user's machine
 	defer func() {
 		r := scout.ScoutReport{
@@ -148,11 +172,72 @@ func (o *outbound) resolveInCluster(c context.Context, query string) (results []
 	c, cancel := context.WithTimeout(c, o.dnsConfig.LookupTimeout.AsDuration())
 	defer cancel()
 
-	queryWithNoTrailingDot := query[:len(query)-1]
-	dlog.Debugf(c, "LookupHost %q", queryWithNoTrailingDot)
-	response, err := o.router.managerClient.LookupHost(c, &manager.LookupHostRequest{
-		Session: o.router.session,
-		Host:    queryWithNoTrailingDot,
+	// A reverse lookup of an IP in a remapped subnet must use the IP that it's mapped to in the cluster
+	clusterQuery := query
+	if ip := dnsproxy.ReverseIP(query); ip != nil {
+		if cip := s.nat.ToCluster(ip); !cip.Equal(ip) {
+			if rq, err := dns.ReverseAddr(cip.String()); err == nil {
+				clusterQuery = rq
+			}
+		}
+	}
+
+	queryWithNoTrailingDot := clusterQuery[:len(clusterQuery)-1]
+	c, span := tracing.Start(c, "LookupDNS",
+		attribute.String("dns.question.name", queryWithNoTrailingDot),
+		attribute.String("dns.question.type", dns.Type(q.Qtype).String()))
+	defer func() {
+		span.SetAttributes(attribute.Int("dns.answers", len(results)))
+		span.End()
+	}()
+	dlog.Debugf(c, "LookupDNS %q, type %s", queryWithNoTrailingDot, dns.Type(q.Qtype))
+	response, err := s.managerClient.LookupDNS(c, &manager.DNSRequest{
+		Session: s.session,
+		Name:    queryWithNoTrailingDot,
+		Type:    uint32(q.Qtype),
+	})
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			// The traffic-manager predates LookupDNS
+			return o.lookupHost(c, s, q, queryWithNoTrailingDot)
+		}
+		err = client.CheckTimeout(c, err)
+		span.RecordError(err)
+		dlog.Error(c, err)
+		return nil
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+	rrs, err := dnsproxy.UnpackRRs(response.Rrs)
+	if err != nil {
+		dlog.Error(c, err)
+		return nil
+	}
+	// The RRs are owned by the name that was sent to the cluster. Give them the name of the query,
+	// and translate the IPs of remapped cluster subnets to their virtual IPs.
+	for _, rr := range rrs {
+		if h := rr.Header(); strings.EqualFold(h.Name, clusterQuery) {
+			h.Name = q.Name
+		}
+		if a, ok := rr.(*dns.A); ok {
+			a.A = s.nat.ToVirtual(a.A)
+		}
+	}
+	return rrs
+}
+
+// dnsTTL is the number of seconds that a found DNS record should be allowed to live in the callers cache
+// when the cluster doesn't provide a TTL. We keep this low to avoid such caching.
+const dnsTTL = 4
+
+// lookupHost resolves A and AAAA queries using the LookupHost call of traffic-managers that don't
+// support LookupDNS. Queries of other types are reported as empty as long as the host exists.
+func (o *outbound) lookupHost(c context.Context, s *clusterSession, q *dns.Question, host string) []dns.RR {
+	dlog.Debugf(c, "LookupHost %q", host)
+	response, err := s.managerClient.LookupHost(c, &manager.LookupHostRequest{
+		Session: s.session,
+		Host:    host,
 	})
 	if err != nil {
 		dlog.Error(c, client.CheckTimeout(c, err))
@@ -163,9 +248,30 @@ func (o *outbound) resolveInCluster(c context.Context, query string) (results []
 	}
 	ips := make(iputil.IPs, len(response.Ips))
 	for i, ip := range response.Ips {
-		ips[i] = ip
+		ips[i] = s.nat.ToVirtual(ip)
+	}
+	return ipsToRRs(q, ips)
+}
+
+// ipsToRRs returns the A or AAAA records for the given IPs that match the type of the query.
+func ipsToRRs(q *dns.Question, ips []net.IP) []dns.RR {
+	rrs := make([]dns.RR, 0, len(ips))
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		switch {
+		case q.Qtype == dns.TypeA && ip4 != nil:
+			rrs = append(rrs, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: dnsTTL},
+				A:   ip4,
+			})
+		case q.Qtype == dns.TypeAAAA && ip4 == nil:
+			rrs = append(rrs, &dns.AAAA{
+				Hdr:  dns.RR_Header{Name: q.Name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: dnsTTL},
+				AAAA: ip,
+			})
+		}
 	}
-	return ips
+	return rrs
 }
 
 func (o *outbound) setInfo(ctx context.Context, info *rpc.OutboundInfo) error {
@@ -188,8 +294,12 @@ func (o *outbound) setInfo(ctx context.Context, info *rpc.OutboundInfo) error {
 	if info.Dns.LookupTimeout.AsDuration() <= 0 {
 		info.Dns.LookupTimeout = durationpb.New(4 * time.Second)
 	}
-	o.dnsConfig = info.Dns
-	return o.router.setOutboundInfo(ctx, info)
+	// The DNS configuration of named connections is only used for the names that are resolved
+	// by those connections. The DNS server is configured by the default, or the first, connection.
+	if info.ConnectionName == "" || o.router.primarySession() == nil {
+		o.dnsConfig = info.Dns
+	}
+	return o.router.addSession(ctx, info)
 }
 
 func (o *outbound) getInfo() *rpc.OutboundInfo {
@@ -205,35 +315,132 @@ func (o *outbound) getInfo() *rpc.OutboundInfo {
 		info.Dns.LookupTimeout = o.dnsConfig.LookupTimeout
 	}
 
-	if len(o.router.alsoProxySubnets) > 0 {
-		info.AlsoProxySubnets = make([]*manager.IPNet, len(o.router.alsoProxySubnets))
-		for i, ap := range o.router.alsoProxySubnets {
-			info.AlsoProxySubnets[i] = iputil.IPNetToRPC(ap)
+	for _, s := range o.router.sortedSessions() {
+		for _, ap := range s.alsoProxySubnets {
+			info.AlsoProxySubnets = append(info.AlsoProxySubnets, iputil.IPNetToRPC(ap))
 		}
-	}
-
-	if len(o.router.neverProxySubnets) > 0 {
-		info.NeverProxySubnets = make([]*manager.IPNet, len(o.router.neverProxySubnets))
-		for i, np := range o.router.neverProxySubnets {
-			info.NeverProxySubnets[i] = iputil.IPNetToRPC(np.RoutedNet)
+		for _, np := range s.neverProxySubnets {
+			info.NeverProxySubnets = append(info.NeverProxySubnets, iputil.IPNetToRPC(np.RoutedNet))
 		}
 	}
 
 	return &info
 }
 
-// SetSearchPath updates the DNS search path used by the resolver
-func (o *outbound) setSearchPath(ctx context.Context, paths, namespaces []string) {
-	// Provide direct access to intercepted namespaces
-	for _, ns := range namespaces {
-		paths = append(paths, ns+".svc."+o.router.clusterDomain)
+// SetSearchPath updates the DNS search path of the given connection. The resolver uses the search
+// paths of all connections.
+func (o *outbound) setSearchPath(ctx context.Context, paths *rpc.Paths) {
+	o.connPathsLock.Lock()
+	o.connPaths[paths.ConnectionName] = paths
+	all := o.searchPaths()
+	o.connPathsLock.Unlock()
+	o.postSearchPaths(ctx, all)
+}
+
+// removeConnection removes the search paths and the router session of the given connection.
+func (o *outbound) removeConnection(ctx context.Context, name string) error {
+	o.connPathsLock.Lock()
+	_, ok := o.connPaths[name]
+	delete(o.connPaths, name)
+	all := o.searchPaths()
+	o.connPathsLock.Unlock()
+	if ok {
+		o.postSearchPaths(ctx, all)
 	}
+	return o.router.removeSession(ctx, name)
+}
+
+func (o *outbound) postSearchPaths(ctx context.Context, paths []string) {
 	select {
 	case <-ctx.Done():
 	case o.searchPathCh <- paths:
 	}
 }
 
+// searchPaths returns the unique search paths of all connections, those of the primary connection
+// first. Must be called with connPathsLock held.
+func (o *outbound) searchPaths() []string {
+	var paths, nsPaths []string
+	seen := make(map[string]struct{})
+	add := func(ps []string, p string) []string {
+		if _, ok := seen[p]; ok {
+			return ps
+		}
+		seen[p] = struct{}{}
+		return append(ps, p)
+	}
+	addConn := func(name string, cp *rpc.Paths) {
+		for _, p := range cp.Paths {
+			paths = add(paths, p)
+		}
+		// Provide direct access to intercepted namespaces
+		clusterDomain := o.router.clusterDomain
+		o.router.sessionsLock.RLock()
+		if s, ok := o.router.sessions[name]; ok && s.clusterDomain != "" {
+			clusterDomain = s.clusterDomain
+		}
+		o.router.sessionsLock.RUnlock()
+		for _, ns := range cp.Namespaces {
+			nsPaths = add(nsPaths, ns+".svc."+clusterDomain)
+		}
+	}
+	names := make([]string, 0, len(o.connPaths))
+	for name := range o.connPaths {
+		names = append(names, name)
+	}
+	sort.Strings(names) // the empty name of the default connection comes first
+	for _, name := range names {
+		addConn(name, o.connPaths[name])
+	}
+	return append(paths, nsPaths...)
+}
+
+// sessionForQuery returns the session of the connection that resolves the given query. Reverse
+// lookups are resolved by the connection whose subnets contain the IP, and other queries by the
+// first connection that maps the namespace of the query or that includes the suffix of the query.
+// Queries that match no connection are resolved by the primary connection.
+func (o *outbound) sessionForQuery(query string) *clusterSession {
+	if ip := dnsproxy.ReverseIP(query); ip != nil {
+		return o.router.sessionFor(ip)
+	}
+	ss := o.router.sortedSessions()
+	if len(ss) == 0 {
+		return nil
+	}
+	if len(ss) == 1 {
+		return ss[0]
+	}
+	name := strings.TrimSuffix(query, ".")
+	var namespace string
+	if labels := strings.Split(name, "."); len(labels) > 1 {
+		// <service>.<namespace> or <service>.<namespace>.svc.<cluster domain>
+		namespace = labels[1]
+	}
+
+	o.connPathsLock.Lock()
+	defer o.connPathsLock.Unlock()
+	for _, s := range ss {
+		if cp, ok := o.connPaths[s.name]; ok && namespace != "" {
+			for _, ns := range cp.Paths {
+				if ns == namespace {
+					return s
+				}
+			}
+			for _, ns := range cp.Namespaces {
+				if ns == namespace {
+					return s
+				}
+			}
+		}
+		for _, sfx := range s.dnsConfig.GetIncludeSuffixes() {
+			if strings.HasSuffix(name, sfx) {
+				return s
+			}
+		}
+	}
+	return ss[0]
+}
+
 func (o *outbound) processSearchPaths(g *dgroup.Group, processor func(context.Context, []string) error) {
 	g.Go("SearchPaths", func(c context.Context) error {
 		var prevPaths []string
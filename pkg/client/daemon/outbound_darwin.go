@@ -213,6 +213,9 @@ func (o *outbound) updateResolverFiles(c context.Context, resolverDirName, resol
 	for _, sfx := range o.dnsConfig.IncludeSuffixes {
 		domains[strings.TrimPrefix(sfx, ".")] = struct{}{}
 	}
+	for _, zone := range o.router.reverseZones() {
+		domains[zone] = struct{}{}
+	}
 
 	o.domainsLock.Lock()
 	defer o.domainsLock.Unlock()
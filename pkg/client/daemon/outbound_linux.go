@@ -18,6 +18,7 @@ import (
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dlib/dtime"
 	"github.com/telepresenceio/telepresence/v2/pkg/client/daemon/dns"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 )
 
 var errResolveDNotConfigured = errors.New("resolved not configured")
@@ -49,6 +50,11 @@ func (o *outbound) shouldApplySearch(query string) bool {
 		return false
 	}
 
+	// Don't apply search paths to reverse lookups
+	if dnsproxy.ReverseIP(query) != nil {
+		return false
+	}
+
 	// Don't apply search paths to the kubernetes zone
 	if strings.HasSuffix(query, "."+o.router.clusterDomain) {
 		return false
@@ -78,8 +84,8 @@ func (o *outbound) shouldApplySearch(query string) bool {
 // TODO: With the DNS lookups now being done in the cluster, there's only one reason left to have a search path,
 // and that's the local-only intercepts which means that using search-paths really should be limited to that
 // use-case.
-func (o *outbound) resolveInSearch(c context.Context, query string) []net.IP {
-	query = strings.ToLower(query)
+func (o *outbound) resolveInSearch(c context.Context, q *dns2.Question) []dns2.RR {
+	query := strings.ToLower(q.Name)
 	query = strings.TrimSuffix(query, tel2SubDomainDot)
 
 	if !o.shouldDoClusterLookup(query) {
@@ -88,12 +94,19 @@ func (o *outbound) resolveInSearch(c context.Context, query string) []net.IP {
 
 	if o.shouldApplySearch(query) {
 		for _, s := range o.search {
-			if ips := o.resolveInCluster(c, query+s); len(ips) > 0 {
-				return ips
+			sq := *q
+			sq.Name = query + s
+			if rrs := o.resolveInCluster(c, &sq); len(rrs) > 0 {
+				for _, rr := range rrs {
+					if h := rr.Header(); h.Name == sq.Name {
+						h.Name = q.Name
+					}
+				}
+				return rrs
 			}
 		}
 	}
-	return o.resolveInCluster(c, query)
+	return o.resolveInCluster(c, q)
 }
 
 func (o *outbound) runOverridingServer(c context.Context) error {
@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/daemon"
+)
+
+func Test_outbound_sessionForQuery(t *testing.T) {
+	all := []string{"", "a", "b"}
+	tests := []struct {
+		name     string
+		sessions []string
+		query    string
+		want     string
+		wantNil  bool
+	}{
+		{
+			name:     "namespace in paths",
+			sessions: all,
+			query:    "svc.team-a.",
+			want:     "a",
+		},
+		{
+			name:     "namespace in paths, fully qualified",
+			sessions: all,
+			query:    "svc.team-b.svc.cluster.local.",
+			want:     "b",
+		},
+		{
+			name:     "intercepted namespace",
+			sessions: all,
+			query:    "svc.ns1.",
+			want:     "",
+		},
+		{
+			name:     "namespace of several connections goes to oldest",
+			sessions: all,
+			query:    "svc.shared.",
+			want:     "a",
+		},
+		{
+			name:     "namespace of several connections goes to default connection",
+			sessions: []string{"b", ""},
+			query:    "svc.default.",
+			want:     "",
+		},
+		{
+			name:     "include suffix",
+			sessions: all,
+			query:    "host.corp-a.",
+			want:     "a",
+		},
+		{
+			name:     "include suffix of several labels",
+			sessions: all,
+			query:    "www.example.com.",
+			want:     "b",
+		},
+		{
+			name:     "single label matches no connection",
+			sessions: all,
+			query:    "team-a.",
+			want:     "",
+		},
+		{
+			name:     "unknown namespace",
+			sessions: all,
+			query:    "svc.unknown.",
+			want:     "",
+		},
+		{
+			name:     "unknown namespace without default connection",
+			sessions: []string{"a", "b"},
+			query:    "svc.unknown.",
+			want:     "a",
+		},
+		{
+			name:     "single session",
+			sessions: []string{"b"},
+			query:    "svc.team-a.",
+			want:     "b",
+		},
+		{
+			name:     "reverse lookup, longest prefix",
+			sessions: all,
+			query:    "1.5.100.10.in-addr.arpa.",
+			want:     "b",
+		},
+		{
+			name:     "reverse lookup, tie",
+			sessions: all,
+			query:    "1.1.244.10.in-addr.arpa.",
+			want:     "a",
+		},
+		{
+			name:     "reverse lookup, no match",
+			sessions: all,
+			query:    "8.8.8.8.in-addr.arpa.",
+			want:     "",
+		},
+		{
+			name:    "no sessions",
+			query:   "svc.team-a.",
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			o := &outbound{
+				router: testRouter(t, tt.sessions...),
+				connPaths: map[string]*rpc.Paths{
+					"":  {Paths: []string{"default"}, Namespaces: []string{"ns1"}},
+					"a": {Paths: []string{"team-a"}, Namespaces: []string{"shared"}, ConnectionName: "a"},
+					"b": {Paths: []string{"team-b", "shared", "default"}, ConnectionName: "b"},
+				},
+			}
+			s := o.sessionForQuery(tt.query)
+			if tt.wantNil {
+				assert.Nil(t, s)
+				return
+			}
+			if assert.NotNil(t, s) {
+				assert.Equal(t, tt.want, s.name)
+			}
+		})
+	}
+}
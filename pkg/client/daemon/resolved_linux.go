@@ -123,6 +123,9 @@ func (o *outbound) updateLinkDomains(c context.Context, paths []string) error {
 	for _, sfx := range o.dnsConfig.IncludeSuffixes {
 		paths = append(paths, "~"+strings.TrimPrefix(sfx, "."))
 	}
+	for _, zone := range o.router.reverseZones() {
+		paths = append(paths, "~"+zone)
+	}
 	paths = append(paths, o.router.clusterDomain)
 	namespaces[tel2SubDomain] = struct{}{}
 
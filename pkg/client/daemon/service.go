@@ -15,6 +15,7 @@ import (
 	"google.golang.org/grpc"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/datawire/dlib/dcontext"
 	"github.com/datawire/dlib/derror"
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dhttp"
@@ -29,6 +30,7 @@ import (
 	"github.com/telepresenceio/telepresence/v2/pkg/filelocation"
 	"github.com/telepresenceio/telepresence/v2/pkg/log"
 	"github.com/telepresenceio/telepresence/v2/pkg/proc"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 const ProcessName = "daemon"
@@ -81,6 +83,7 @@ func (d *service) Version(_ context.Context, _ *empty.Empty) (*common.VersionInf
 func (d *service) Status(_ context.Context, _ *empty.Empty) (*rpc.DaemonStatus, error) {
 	r := &rpc.DaemonStatus{
 		OutboundConfig: d.outbound.getInfo(),
+		SubnetMappings: d.outbound.router.subnetMappings(),
 	}
 	return r, nil
 }
@@ -92,10 +95,14 @@ func (d *service) Quit(ctx context.Context, _ *empty.Empty) (*empty.Empty, error
 }
 
 func (d *service) SetDnsSearchPath(ctx context.Context, paths *rpc.Paths) (*empty.Empty, error) {
-	d.outbound.setSearchPath(ctx, paths.Paths, paths.Namespaces)
+	d.outbound.setSearchPath(ctx, paths)
 	return &empty.Empty{}, nil
 }
 
+func (d *service) Disconnect(ctx context.Context, req *rpc.DisconnectRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, d.outbound.removeConnection(ctx, req.ConnectionName)
+}
+
 func (d *service) SetOutboundInfo(ctx context.Context, info *rpc.OutboundInfo) (*empty.Empty, error) {
 	return &empty.Empty{}, d.outbound.setInfo(ctx, info)
 }
@@ -130,6 +137,14 @@ func run(c context.Context, loggingDir, configDir, dns string) error {
 		return err
 	}
 
+	shutdownTracing, err := tracing.Init(c, ProcessName, cfg.Tracing.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = shutdownTracing(dcontext.WithoutCancel(c))
+	}()
+
 	dlog.Info(c, "---")
 	dlog.Infof(c, "Telepresence %s %s starting...", ProcessName, client.DisplayVersion())
 	dlog.Infof(c, "PID is %d", os.Getpid())
@@ -226,7 +241,7 @@ func run(c context.Context, loggingDir, configDir, dns string) error {
 			}
 		}()
 
-		opts := []grpc.ServerOption{}
+		opts := tracing.ServerOptions()
 		cfg := client.GetConfig(c)
 		if !cfg.Grpc.MaxReceiveSize.IsZero() {
 			if mz, ok := cfg.Grpc.MaxReceiveSize.AsInt64(); ok {
@@ -0,0 +1,276 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/datawire/dlib/dgroup"
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/client"
+	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/nat"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/routing"
+)
+
+// clusterSession is the state of the router that belongs to one of the connector's connections,
+// i.e. to one traffic-manager. The default connection has the empty name.
+type clusterSession struct {
+	name string
+
+	// seq is the order in which the session was created
+	seq int
+
+	conn *grpc.ClientConn
+
+	// managerClient provides the gRPC tunnel to the traffic-manager
+	managerClient manager.ManagerClient
+
+	// session contains the manager session
+	session *manager.SessionInfo
+
+	// tunnel is the bidirectional gRPC tunnel to the traffic-manager
+	muxTunnel connpool.MuxTunnel
+
+	// clusterDomain reported by the traffic-manager
+	clusterDomain string
+
+	// Subnets that the cluster subnets reported by the traffic-manager are routed as. A cluster
+	// subnet that conflicts with a subnet routed by the host is routed as the virtual subnet that
+	// it's mapped to in nat. Protected by the tunRouter's sessionsLock
+	clusterSubnets []*net.IPNet
+
+	// nat translates between the IPs of remapped cluster subnets and their virtual subnets
+	nat *nat.Table
+
+	// remapDisabled is set when the traffic-manager only offers the multiplexing tunnel, which
+	// can't dial the cluster IP of a remapped subnet. Protected by the tunRouter's sessionsLock
+	remapDisabled bool
+
+	// Subnets configured by the user
+	alsoProxySubnets []*net.IPNet
+
+	// Subnets configured not to be proxied
+	neverProxySubnets []routing.Route
+
+	// dnsConfig is the DNS configuration sent by the connection
+	dnsConfig *daemon.DNSConfig
+
+	// cfgComplete will be closed as soon as the connector has sent over the correct port to
+	// the traffic manager and the managerClient has been connected.
+	cfgComplete chan struct{}
+
+	// tmVerOk will be closed as soon as the correct tunnel version has been negotiated with
+	// the traffic manager
+	tmVerOk     chan struct{}
+	tmVerOkOnce sync.Once
+
+	// cancel ends the goroutines of the session. Protected by the tunRouter's sessionsLock
+	cancel context.CancelFunc
+}
+
+func newClusterSession(ctx context.Context, mi *daemon.OutboundInfo, conn *grpc.ClientConn) *clusterSession {
+	s := &clusterSession{
+		name:          mi.ConnectionName,
+		conn:          conn,
+		managerClient: manager.NewManagerClient(client.WithConnectionName(conn, mi.ConnectionName)),
+		session:       mi.Session,
+		dnsConfig:     mi.Dns,
+		nat:           &nat.Table{},
+		cfgComplete:   make(chan struct{}),
+		tmVerOk:       make(chan struct{}),
+	}
+	if len(mi.AlsoProxySubnets) > 0 {
+		s.alsoProxySubnets = make([]*net.IPNet, len(mi.AlsoProxySubnets))
+		for i, ap := range mi.AlsoProxySubnets {
+			apSn := iputil.IPNetFromRPC(ap)
+			dlog.Infof(ctx, "Adding also-proxy subnet %s", apSn)
+			s.alsoProxySubnets[i] = apSn
+		}
+	}
+	if len(mi.NeverProxySubnets) > 0 {
+		s.neverProxySubnets = []routing.Route{}
+		for _, np := range mi.NeverProxySubnets {
+			npSn := iputil.IPNetFromRPC(np)
+			dlog.Infof(ctx, "Adding never-proxy subnet %s", npSn)
+			route, err := routing.GetRoute(ctx, npSn)
+			if err != nil {
+				dlog.Errorf(ctx, "unable to get route for never-proxied subnet %s. "+
+					"If this is your kubernetes API server you may want to open an issue, since telepresence may not work if it falls within the CIDR for pods/services. "+
+					"Error: %v",
+					iputil.IPNetFromRPC(np), err)
+				continue
+			}
+			s.neverProxySubnets = append(s.neverProxySubnets, route)
+		}
+	}
+	return s
+}
+
+// versionNegotiated closes the tmVerOk channel of the session, and of the router unless it's
+// already closed.
+func (s *clusterSession) versionNegotiated(t *tunRouter) {
+	s.tmVerOkOnce.Do(func() { close(s.tmVerOk) })
+	t.tmVerOkOnce.Do(func() { close(t.tmVerOk) })
+}
+
+// addSession creates a session for the connection named in the given info, unless it already
+// exists, and hands it over to the router's run function which starts its goroutines.
+func (t *tunRouter) addSession(ctx context.Context, mi *daemon.OutboundInfo) error {
+	t.sessionsLock.RLock()
+	_, ok := t.sessions[mi.ConnectionName]
+	t.sessionsLock.RUnlock()
+	if ok {
+		return nil
+	}
+
+	// First check. Establish connection
+	clientConfig := client.GetConfig(ctx)
+	tos := &clientConfig.Timeouts
+	tc, cancel := tos.TimeoutContext(ctx, client.TimeoutTrafficManagerAPI)
+	defer cancel()
+
+	conn, err := client.DialSocket(tc, client.ConnectorSocketName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// The connector called us, and then it died which means we will die too. This is
+			// a race, but it's not an error.
+			return nil
+		}
+		return client.CheckTimeout(tc, err)
+	}
+	if mi.ConnectionName != "" {
+		ctx = dgroup.WithGoroutineName(ctx, "/"+mi.ConnectionName)
+	}
+	s := newClusterSession(ctx, mi, conn)
+
+	t.sessionsLock.Lock()
+	if _, ok = t.sessions[s.name]; ok {
+		t.sessionsLock.Unlock()
+		_ = conn.Close()
+		return nil
+	}
+	t.nextSeq++
+	s.seq = t.nextSeq
+	t.sessions[s.name] = s
+	if t.dnsIP == nil {
+		t.dnsIP = mi.Dns.RemoteIp
+	}
+	t.sessionsLock.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case t.sessionCh <- s:
+		return nil
+	}
+}
+
+// startSession starts the goroutines of the given session. It's called from the router's run
+// function.
+func (t *tunRouter) startSession(c context.Context, s *clusterSession) {
+	if s.name != "" {
+		c = dgroup.WithGoroutineName(c, "/"+s.name)
+	}
+	c, cancel := context.WithCancel(c)
+	t.sessionsLock.Lock()
+	if t.sessions[s.name] != s {
+		// Removed before it was started
+		t.sessionsLock.Unlock()
+		cancel()
+		return
+	}
+	s.cancel = cancel
+	t.sessionsLock.Unlock()
+
+	go func() {
+		g := dgroup.NewGroup(c, dgroup.GroupConfig{})
+		g.Go("watch-cluster-info", func(c context.Context) error {
+			t.watchClusterInfo(c, s)
+			return nil
+		})
+		g.Go("MGR stream", func(c context.Context) error {
+			return t.mgrStream(c, s)
+		})
+		if err := g.Wait(); err != nil {
+			dlog.Error(c, err)
+		}
+	}()
+}
+
+// removeSession ends the session of the connection with the given name and removes its subnets
+// from the TUN device.
+func (t *tunRouter) removeSession(ctx context.Context, name string) error {
+	t.sessionsLock.Lock()
+	s, ok := t.sessions[name]
+	delete(t.sessions, name)
+	t.sessionsLock.Unlock()
+	if !ok {
+		return nil
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	_ = s.conn.Close()
+	return t.refreshSubnets(ctx)
+}
+
+// sortedSessions returns all sessions, ordered so that the primary session comes first and the
+// others follow in the order that they were created.
+func (t *tunRouter) sortedSessions() []*clusterSession {
+	t.sessionsLock.RLock()
+	ss := make([]*clusterSession, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		ss = append(ss, s)
+	}
+	t.sessionsLock.RUnlock()
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].name == "" || ss[j].name == "" {
+			return ss[i].name == ""
+		}
+		return ss[i].seq < ss[j].seq
+	})
+	return ss
+}
+
+// primarySession returns the session of the default connection, or the oldest session when there
+// is no default connection. It returns nil when there are no sessions.
+func (t *tunRouter) primarySession() *clusterSession {
+	if ss := t.sortedSessions(); len(ss) > 0 {
+		return ss[0]
+	}
+	return nil
+}
+
+// sessionFor returns the session whose subnets contain the given IP. The session with the most
+// specific subnet is returned when the subnets of several sessions contain the IP, the first one in
+// the order of sortedSessions when their subnets are equally specific, and the primary session is
+// returned when no subnet contains it.
+func (t *tunRouter) sessionFor(ip net.IP) *clusterSession {
+	ss := t.sortedSessions()
+	t.sessionsLock.RLock()
+	var best *clusterSession
+	bestOnes := -1
+	for _, s := range ss {
+		for _, sns := range [][]*net.IPNet{s.clusterSubnets, s.alsoProxySubnets} {
+			for _, sn := range sns {
+				if ones, _ := sn.Mask.Size(); ones > bestOnes && sn.Contains(ip) {
+					best, bestOnes = s, ones
+				}
+			}
+		}
+	}
+	t.sessionsLock.RUnlock()
+	if best == nil && len(ss) > 0 {
+		best = ss[0]
+	}
+	return best
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+)
+
+// testRouter returns a router with sessions for the given connections, created in the given order.
+// The subnets of connection "a" are more specific than those of the default connection, those of
+// "b" are even more specific, and some subnets are shared by two connections.
+func testRouter(t *testing.T, names ...string) *tunRouter {
+	all := []*clusterSession{
+		{
+			name:             "",
+			clusterSubnets:   cidrs(t, "10.96.0.0/12", "10.1.0.0/16"),
+			alsoProxySubnets: cidrs(t, "192.168.100.0/24"),
+			dnsConfig:        &daemon.DNSConfig{},
+		},
+		{
+			name:           "a",
+			clusterSubnets: cidrs(t, "10.100.0.0/16", "10.244.0.0/16"),
+			dnsConfig:      &daemon.DNSConfig{IncludeSuffixes: []string{".corp-a"}},
+		},
+		{
+			name:             "b",
+			clusterSubnets:   cidrs(t, "10.100.5.0/24", "10.244.0.0/16", "10.1.0.0/16"),
+			alsoProxySubnets: cidrs(t, "172.30.0.0/16"),
+			dnsConfig:        &daemon.DNSConfig{IncludeSuffixes: []string{".example.com"}},
+		},
+	}
+	r := &tunRouter{sessions: make(map[string]*clusterSession)}
+	for _, name := range names {
+		for _, s := range all {
+			if s.name == name {
+				r.nextSeq++
+				s.seq = r.nextSeq
+				r.sessions[name] = s
+			}
+		}
+	}
+	return r
+}
+
+func Test_tunRouter_sessionFor(t *testing.T) {
+	all := []string{"", "a", "b"}
+	tests := []struct {
+		name     string
+		sessions []string
+		ip       string
+		want     string
+		wantNil  bool
+	}{
+		{
+			name:     "only match",
+			sessions: all,
+			ip:       "10.97.1.1",
+			want:     "",
+		},
+		{
+			name:     "longest prefix",
+			sessions: all,
+			ip:       "10.100.1.1",
+			want:     "a",
+		},
+		{
+			name:     "longest prefix of three",
+			sessions: all,
+			ip:       "10.100.5.1",
+			want:     "b",
+		},
+		{
+			name:     "also-proxy subnet",
+			sessions: all,
+			ip:       "172.30.0.1",
+			want:     "b",
+		},
+		{
+			name:     "also-proxy subnet of default connection",
+			sessions: all,
+			ip:       "192.168.100.1",
+			want:     "",
+		},
+		{
+			name:     "tie goes to oldest",
+			sessions: all,
+			ip:       "10.244.1.1",
+			want:     "a",
+		},
+		{
+			name:     "tie goes to default connection",
+			sessions: all,
+			ip:       "10.1.0.1",
+			want:     "",
+		},
+		{
+			name:     "tie goes to default connection created after the others",
+			sessions: []string{"b", ""},
+			ip:       "10.1.0.1",
+			want:     "",
+		},
+		{
+			name:     "no match goes to default connection",
+			sessions: all,
+			ip:       "8.8.8.8",
+			want:     "",
+		},
+		{
+			name:     "no match goes to oldest without default connection",
+			sessions: []string{"a", "b"},
+			ip:       "8.8.8.8",
+			want:     "a",
+		},
+		{
+			name:    "no sessions",
+			ip:      "10.97.1.1",
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRouter(t, tt.sessions...)
+			s := r.sessionFor(iputil.Parse(tt.ip))
+			if tt.wantNil {
+				assert.Nil(t, s)
+				return
+			}
+			if assert.NotNil(t, s) {
+				assert.Equal(t, tt.want, s.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"context"
+	"net"
+
+	"github.com/datawire/dlib/dlog"
+	rpc "github.com/telepresenceio/telepresence/rpc/v2/daemon"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/subnet"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/nat"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/routing"
+)
+
+// virtualSubnetPools are the ranges, in order of preference, that the virtual subnets of cluster
+// subnets that conflict with the host's routes are allocated from. The first one is reserved for
+// benchmarking (RFC 2544) and the second for carrier grade NAT (RFC 6598), so they are less likely
+// to be in use than the private ranges that follow.
+var virtualSubnetPools = func() []*net.IPNet {
+	cidrs := []string{"198.18.0.0/15", "100.64.0.0/10", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+	pools := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, pools[i], _ = net.ParseCIDR(c)
+	}
+	return pools
+}()
+
+// hostSubnets returns the subnets that the host routes to other interfaces than the TUN device.
+// The default route, host routes, and routes that the user has configured to never proxy aren't
+// considered to be conflicting and are excluded.
+func (t *tunRouter) hostSubnets(ctx context.Context, s *clusterSession) []*net.IPNet {
+	routes, err := routing.GetRoutingTable(ctx)
+	if err != nil {
+		dlog.Warnf(ctx, "unable to check cluster subnets for conflicts: %v", err)
+		return nil
+	}
+	devName := t.dev.Name()
+	var subnets []*net.IPNet
+nextRoute:
+	for _, r := range routes {
+		if r.Interface.Name == devName {
+			continue
+		}
+		if ones, bits := r.RoutedNet.Mask.Size(); ones == bits || ones == 0 {
+			continue
+		}
+		for _, np := range s.neverProxySubnets {
+			if subnet.Overlaps(np.RoutedNet, r.RoutedNet) {
+				continue nextRoute
+			}
+		}
+		subnets = append(subnets, r.RoutedNet)
+	}
+	return subnets
+}
+
+// setClusterSubnets sets the cluster subnets of the given session. A cluster subnet that overlaps a
+// subnet that the host already routes, or a subnet that is routed for another session, is remapped
+// to a free virtual subnet of the same size, and the session's NAT table is updated with the
+// mappings.
+func (t *tunRouter) setClusterSubnets(ctx context.Context, s *clusterSession, clusterSubnets []*net.IPNet) {
+	avoid := t.hostSubnets(ctx, s)
+	t.sessionsLock.RLock()
+	remapDisabled := s.remapDisabled
+	for _, other := range t.sessions {
+		if other != s {
+			avoid = append(avoid, other.clusterSubnets...)
+			avoid = append(avoid, other.alsoProxySubnets...)
+		}
+	}
+	t.sessionsLock.RUnlock()
+	avoid = append(avoid, s.alsoProxySubnets...)
+	routed, mappings := remap(ctx, clusterSubnets, avoid, virtualSubnetPools, s.nat, remapDisabled)
+
+	t.sessionsLock.Lock()
+	defer t.sessionsLock.Unlock()
+	if s.remapDisabled && !remapDisabled {
+		// Remapping was disabled while the subnets were remapped
+		routed, mappings = remap(ctx, clusterSubnets, avoid, virtualSubnetPools, s.nat, true)
+	}
+	s.nat.Set(mappings)
+	s.clusterSubnets = routed
+}
+
+// remap returns the subnets that the given cluster subnets are routed as, and the mappings of the
+// cluster subnets that are remapped. A cluster subnet that overlaps one of the subnets to avoid is
+// remapped to a free subnet of the same size from the given pools, unless remapping is disabled.
+// The mapping that a cluster subnet has in the given table is kept as long as its virtual subnet
+// doesn't overlap the subnets to avoid.
+func remap(ctx context.Context, clusterSubnets, avoid, pools []*net.IPNet, table *nat.Table, disabled bool) ([]*net.IPNet, []*nat.Mapping) {
+	routed := make([]*net.IPNet, len(clusterSubnets))
+	var mappings []*nat.Mapping
+	for i, csn := range clusterSubnets {
+		conflict := firstOverlap(csn, avoid)
+		if conflict == nil {
+			routed[i] = csn
+			continue
+		}
+		if disabled {
+			dlog.Warnf(ctx, "cluster subnet %s conflicts with %s and can't be remapped because the traffic-manager is too old", csn, conflict)
+			routed[i] = csn
+			continue
+		}
+		m := table.Find(csn)
+		if m == nil || firstOverlap(m.Virtual, avoid) != nil {
+			ones, bits := csn.Mask.Size()
+			vsn := subnet.FindFree(ones, bits, pools, append(avoid, clusterSubnets...))
+			if vsn == nil {
+				dlog.Errorf(ctx, "cluster subnet %s conflicts with %s and no free subnet could be found to remap it to", csn, conflict)
+				routed[i] = csn
+				continue
+			}
+			m = &nat.Mapping{Cluster: csn, Virtual: vsn}
+		}
+		dlog.Warnf(ctx, "cluster subnet %s conflicts with %s and is remapped to %s", csn, conflict, m.Virtual)
+		mappings = append(mappings, m)
+		avoid = append(avoid, m.Virtual)
+		routed[i] = m.Virtual
+	}
+	return routed, mappings
+}
+
+// disableRemap stops remapping the cluster subnets of the given session and routes the subnets that
+// are already remapped as is. It's used when the traffic-manager only offers the multiplexing tunnel,
+// because the connections on that tunnel are dialed using the destination that the TUN device sees,
+// which is the virtual IP of a remapped subnet.
+func (t *tunRouter) disableRemap(ctx context.Context, s *clusterSession, mgrVersion string) {
+	t.sessionsLock.Lock()
+	dnsIP, ok := s.disableRemap(t.dnsIP)
+	if ok {
+		// The DNS resolver isn't configured until the tunnel version has been negotiated, so it
+		// will use the cluster IP.
+		t.dnsIP = dnsIP
+	}
+	t.sessionsLock.Unlock()
+	if !ok {
+		return
+	}
+	dlog.Warnf(ctx, "traffic-manager %s is too old to reach remapped cluster subnets, so they are routed as is; upgrade it to use remapping", mgrVersion)
+	if err := t.refreshSubnets(ctx); err != nil {
+		dlog.Error(ctx, err)
+	}
+}
+
+// disableRemap stops remapping the cluster subnets of the session and replaces the virtual subnets
+// of the remapped cluster subnets with the cluster subnets. It returns the cluster IP of the given
+// DNS IP, and false if no subnets were remapped. The tunRouter's sessionsLock must be locked.
+func (s *clusterSession) disableRemap(dnsIP net.IP) (net.IP, bool) {
+	s.remapDisabled = true
+	mappings := s.nat.Mappings()
+	if len(mappings) == 0 {
+		return dnsIP, false
+	}
+	if dnsIP != nil {
+		dnsIP = s.nat.ToCluster(dnsIP)
+	}
+	subnets := make([]*net.IPNet, len(s.clusterSubnets))
+	for i, sn := range s.clusterSubnets {
+		subnets[i] = sn
+		for _, m := range mappings {
+			if subnet.Equal(sn, m.Virtual) {
+				subnets[i] = m.Cluster
+				break
+			}
+		}
+	}
+	s.clusterSubnets = subnets
+	s.nat.Set(nil)
+	return dnsIP, true
+}
+
+// subnetMappings returns the mappings of the remapped cluster subnets of all sessions.
+func (t *tunRouter) subnetMappings() []*rpc.SubnetMapping {
+	var sms []*rpc.SubnetMapping
+	for _, s := range t.sortedSessions() {
+		for _, m := range s.nat.Mappings() {
+			sms = append(sms, &rpc.SubnetMapping{
+				ClusterSubnet:  iputil.IPNetToRPC(m.Cluster),
+				VirtualSubnet:  iputil.IPNetToRPC(m.Virtual),
+				ConnectionName: s.name,
+			})
+		}
+	}
+	return sms
+}
+
+// firstOverlap returns the first subnet in subnets that overlaps sn, or nil if there is none.
+func firstOverlap(sn *net.IPNet, subnets []*net.IPNet) *net.IPNet {
+	for _, o := range subnets {
+		if subnet.Overlaps(sn, o) {
+			return o
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/vif/nat"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, sn, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return sn
+}
+
+func cidrs(t *testing.T, ss ...string) []*net.IPNet {
+	t.Helper()
+	sns := make([]*net.IPNet, len(ss))
+	for i, s := range ss {
+		sns[i] = cidr(t, s)
+	}
+	return sns
+}
+
+func Test_remap(t *testing.T) {
+	type mapping struct {
+		cluster string
+		virtual string
+	}
+	tests := []struct {
+		name     string
+		cluster  []string
+		avoid    []string
+		pools    []string
+		previous []mapping
+		disabled bool
+		routed   []string
+		mappings []mapping
+	}{
+		{
+			name:    "no conflict",
+			cluster: []string{"10.96.0.0/16", "10.244.0.0/16"},
+			avoid:   []string{"192.168.1.0/24"},
+			pools:   []string{"198.18.0.0/15"},
+			routed:  []string{"10.96.0.0/16", "10.244.0.0/16"},
+		},
+		{
+			name:     "overlaps local route",
+			cluster:  []string{"10.96.0.0/16", "172.20.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			routed:   []string{"198.18.0.0/16", "172.20.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/16", "198.18.0.0/16"}},
+		},
+		{
+			name:     "local route overlaps part of cluster subnet",
+			cluster:  []string{"10.96.0.0/12"},
+			avoid:    []string{"10.100.1.0/24"},
+			pools:    []string{"198.18.0.0/15", "100.64.0.0/10"},
+			routed:   []string{"100.64.0.0/12"},
+			mappings: []mapping{{"10.96.0.0/12", "100.64.0.0/12"}},
+		},
+		{
+			name:     "remapped subnets don't overlap each other",
+			cluster:  []string{"10.96.0.0/16", "10.244.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			routed:   []string{"198.18.0.0/16", "198.19.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/16", "198.18.0.0/16"}, {"10.244.0.0/16", "198.19.0.0/16"}},
+		},
+		{
+			name:     "virtual subnet doesn't overlap other cluster subnet",
+			cluster:  []string{"10.96.0.0/16", "198.18.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			routed:   []string{"198.19.0.0/16", "198.18.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/16", "198.19.0.0/16"}},
+		},
+		{
+			name:     "previous mapping is kept",
+			cluster:  []string{"10.96.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			previous: []mapping{{"10.96.0.0/16", "198.19.0.0/16"}},
+			routed:   []string{"198.19.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/16", "198.19.0.0/16"}},
+		},
+		{
+			name:     "conflicting previous mapping is replaced",
+			cluster:  []string{"10.96.0.0/16"},
+			avoid:    []string{"10.0.0.0/8", "198.19.0.0/16"},
+			pools:    []string{"198.18.0.0/15"},
+			previous: []mapping{{"10.96.0.0/16", "198.19.0.0/16"}},
+			routed:   []string{"198.18.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/16", "198.18.0.0/16"}},
+		},
+		{
+			name:    "no free range",
+			cluster: []string{"10.96.0.0/16"},
+			avoid:   []string{"10.0.0.0/8", "198.18.0.0/15"},
+			pools:   []string{"198.18.0.0/15"},
+			routed:  []string{"10.96.0.0/16"},
+		},
+		{
+			name:    "no pool large enough",
+			cluster: []string{"10.0.0.0/8"},
+			avoid:   []string{"10.1.0.0/16"},
+			pools:   []string{"198.18.0.0/15"},
+			routed:  []string{"10.0.0.0/8"},
+		},
+		{
+			name:     "no free range for second subnet",
+			cluster:  []string{"10.96.0.0/15", "10.244.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			routed:   []string{"198.18.0.0/15", "10.244.0.0/16"},
+			mappings: []mapping{{"10.96.0.0/15", "198.18.0.0/15"}},
+		},
+		{
+			name:     "remap disabled",
+			cluster:  []string{"10.96.0.0/16"},
+			avoid:    []string{"10.0.0.0/8"},
+			pools:    []string{"198.18.0.0/15"},
+			previous: []mapping{{"10.96.0.0/16", "198.19.0.0/16"}},
+			disabled: true,
+			routed:   []string{"10.96.0.0/16"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := dlog.NewTestContext(t, false)
+			table := &nat.Table{}
+			var previous []*nat.Mapping
+			for _, m := range tt.previous {
+				previous = append(previous, &nat.Mapping{Cluster: cidr(t, m.cluster), Virtual: cidr(t, m.virtual)})
+			}
+			table.Set(previous)
+
+			routed, mappings := remap(ctx, cidrs(t, tt.cluster...), cidrs(t, tt.avoid...), cidrs(t, tt.pools...), table, tt.disabled)
+			assert.Equal(t, cidrs(t, tt.routed...), routed)
+			require.Len(t, mappings, len(tt.mappings))
+			for i, m := range tt.mappings {
+				assert.Equal(t, cidr(t, m.cluster), mappings[i].Cluster)
+				assert.Equal(t, cidr(t, m.virtual), mappings[i].Virtual)
+			}
+		})
+	}
+}
+
+func Test_clusterSession_disableRemap(t *testing.T) {
+	tests := []struct {
+		name     string
+		subnets  []string
+		mappings []*nat.Mapping
+		dnsIP    net.IP
+		want     []string
+		wantDNS  net.IP
+		wantOK   bool
+	}{
+		{
+			name:    "nothing remapped",
+			subnets: []string{"10.96.0.0/16", "10.244.0.0/16"},
+			dnsIP:   iputil.Parse("10.96.0.10"),
+			want:    []string{"10.96.0.0/16", "10.244.0.0/16"},
+			wantDNS: iputil.Parse("10.96.0.10"),
+		},
+		{
+			name:    "remapped subnets are routed as is",
+			subnets: []string{"198.18.0.0/16", "10.244.0.0/16", "198.19.0.0/16"},
+			mappings: []*nat.Mapping{
+				{Cluster: cidr(t, "10.96.0.0/16"), Virtual: cidr(t, "198.18.0.0/16")},
+				{Cluster: cidr(t, "10.97.0.0/16"), Virtual: cidr(t, "198.19.0.0/16")},
+			},
+			dnsIP:   iputil.Parse("198.18.0.10"),
+			want:    []string{"10.96.0.0/16", "10.244.0.0/16", "10.97.0.0/16"},
+			wantDNS: iputil.Parse("10.96.0.10"),
+			wantOK:  true,
+		},
+		{
+			name:    "DNS IP outside remapped subnets",
+			subnets: []string{"198.18.0.0/16", "10.244.0.0/16"},
+			mappings: []*nat.Mapping{
+				{Cluster: cidr(t, "10.96.0.0/16"), Virtual: cidr(t, "198.18.0.0/16")},
+			},
+			dnsIP:   iputil.Parse("10.244.0.10"),
+			want:    []string{"10.96.0.0/16", "10.244.0.0/16"},
+			wantDNS: iputil.Parse("10.244.0.10"),
+			wantOK:  true,
+		},
+		{
+			name:    "no DNS IP",
+			subnets: []string{"198.18.0.0/16"},
+			mappings: []*nat.Mapping{
+				{Cluster: cidr(t, "10.96.0.0/16"), Virtual: cidr(t, "198.18.0.0/16")},
+			},
+			want:   []string{"10.96.0.0/16"},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &clusterSession{nat: &nat.Table{}, clusterSubnets: cidrs(t, tt.subnets...)}
+			s.nat.Set(tt.mappings)
+
+			dnsIP, ok := s.disableRemap(tt.dnsIP)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.True(t, tt.wantDNS.Equal(dnsIP), "expected DNS IP %s, got %s", tt.wantDNS, dnsIP)
+			assert.Equal(t, cidrs(t, tt.want...), s.clusterSubnets)
+			assert.Empty(t, s.nat.Mappings())
+			assert.True(t, s.remapDisabled)
+
+			// Subnets that conflict are routed as is from now on
+			ctx := dlog.NewTestContext(t, false)
+			routed, mappings := remap(ctx, s.clusterSubnets, cidrs(t, "10.0.0.0/8"), virtualSubnetPools, s.nat, s.remapDisabled)
+			assert.Equal(t, s.clusterSubnets, routed)
+			assert.Empty(t, mappings)
+		})
+	}
+}
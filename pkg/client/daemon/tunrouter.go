@@ -7,23 +7,21 @@ import (
 	"io"
 	"math/rand"
 	"net"
-	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/blang/semver"
 	"golang.org/x/net/ipv4"
-	"google.golang.org/grpc"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/datawire/dlib/dgroup"
 	"github.com/datawire/dlib/dlog"
 	"github.com/datawire/dlib/dtime"
-	"github.com/telepresenceio/telepresence/rpc/v2/daemon"
-	"github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/client"
 	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/dnsproxy"
 	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
 	"github.com/telepresenceio/telepresence/v2/pkg/subnet"
@@ -67,11 +65,15 @@ type tunRouter struct {
 	// dev is the TUN device that gets configured with the subnets found in the cluster
 	dev *vif.Device
 
-	// managerClient provides the gRPC tunnel to the traffic-manager
-	managerClient manager.ManagerClient
+	// sessions contains one session for each of the connector's connections, keyed by connection
+	// name. The TUN device is configured with the subnets of all sessions, and each packet is
+	// dispatched to the traffic-manager of the session whose subnets contain its destination.
+	sessions     map[string]*clusterSession
+	sessionsLock sync.RWMutex
+	nextSeq      int
 
-	// tunnel is the bidirectional gRPC tunnel to the traffic-manager
-	muxTunnel connpool.MuxTunnel
+	// sessionCh hands new sessions over to the run function, which starts their goroutines
+	sessionCh chan *clusterSession
 
 	// connPool contains handlers that represent active connections. Those handlers
 	// are obtained using a connpool.ConnID.
@@ -90,21 +92,15 @@ type tunRouter struct {
 	// dnsLocalAddr is the address of the local DNS server
 	dnsLocalAddr *net.UDPAddr
 
-	// clusterDomain reported by the traffic-manager
+	// clusterDomain reported by the traffic-manager of the first session that is configured
 	clusterDomain string
+	configOnce    sync.Once
 
-	// Cluster subnets reported by the traffic-manager
-	clusterSubnets []*net.IPNet
-
-	// Subnets configured by the user
-	alsoProxySubnets []*net.IPNet
-
-	// Subnets configured not to be proxied
-	neverProxySubnets []routing.Route
 	// Subnets that the router is currently configured with. Managed, and only used in
 	// the refreshSubnets() method.
 	curSubnets      []*net.IPNet
 	curStaticRoutes []routing.Route
+	curSubnetsLock  sync.Mutex
 
 	// closing is set during shutdown and can have the values:
 	//   0 = running
@@ -112,16 +108,10 @@ type tunRouter struct {
 	//   2 = closed
 	closing int32
 
-	// session contains the manager session
-	session *manager.SessionInfo
-
-	// cfgComplete will be closed as soon as the connector has sent over the correct port to
-	// the traffic manager and the managerClient has been connected.
-	cfgComplete chan struct{}
-
 	// tmVerOk will be closed as soon as the correct tunnel version has been negotiated with
-	// the traffic manager
-	tmVerOk chan struct{}
+	// the traffic manager of the first session
+	tmVerOk     chan struct{}
+	tmVerOkOnce sync.Once
 
 	// rndSource is the source for the random number generator in the TCP handlers
 	rndSource rand.Source
@@ -135,7 +125,8 @@ func newTunRouter(ctx context.Context) (*tunRouter, error) {
 	return &tunRouter{
 		dev:         td,
 		handlers:    tunnel.NewPool(),
-		cfgComplete: make(chan struct{}),
+		sessions:    make(map[string]*clusterSession),
+		sessionCh:   make(chan *clusterSession),
 		tmVerOk:     make(chan struct{}),
 		fragmentMap: make(map[uint16][]*buffer.Data),
 		rndSource:   rand.NewSource(time.Now().UnixNano()),
@@ -151,12 +142,12 @@ func (t *tunRouter) configureDNS(_ context.Context, dnsLocalAddr *net.UDPAddr) {
 	t.dnsLocalAddr = dnsLocalAddr
 }
 
-func (t *tunRouter) reconcileStaticRoutes(ctx context.Context) error {
+func (t *tunRouter) reconcileStaticRoutes(ctx context.Context, neverProxySubnets []routing.Route) error {
 	desired := []routing.Route{}
 
 	// We're not going to add static routes unless they're actually needed
 	// (i.e. unless the existing CIDRs overlap with the never-proxy subnets)
-	for _, r := range t.neverProxySubnets {
+	for _, r := range neverProxySubnets {
 		for _, s := range t.curSubnets {
 			if s.Contains(r.RoutedNet.IP) || r.Routes(s.IP) {
 				desired = append(desired, r)
@@ -194,10 +185,19 @@ removing:
 }
 
 func (t *tunRouter) refreshSubnets(ctx context.Context) error {
-	// Create a unique slice of all desired subnets.
-	desired := make([]*net.IPNet, len(t.clusterSubnets)+len(t.alsoProxySubnets))
-	copy(desired, t.clusterSubnets)
-	copy(desired[len(t.clusterSubnets):], t.alsoProxySubnets)
+	t.curSubnetsLock.Lock()
+	defer t.curSubnetsLock.Unlock()
+
+	// Create a unique slice of all desired subnets of all sessions.
+	var desired []*net.IPNet
+	var neverProxySubnets []routing.Route
+	t.sessionsLock.RLock()
+	for _, s := range t.sessions {
+		desired = append(desired, s.clusterSubnets...)
+		desired = append(desired, s.alsoProxySubnets...)
+		neverProxySubnets = append(neverProxySubnets, s.neverProxySubnets...)
+	}
+	t.sessionsLock.RUnlock()
 	desired = subnet.Unique(desired)
 
 	// Remove all no longer desired subnets from the t.curSubnets
@@ -236,71 +236,43 @@ func (t *tunRouter) refreshSubnets(ctx context.Context) error {
 		}
 	}
 
-	return t.reconcileStaticRoutes(ctx)
+	return t.reconcileStaticRoutes(ctx, neverProxySubnets)
 }
 
-func (t *tunRouter) setOutboundInfo(ctx context.Context, mi *daemon.OutboundInfo) (err error) {
-	if t.managerClient == nil {
-		// First check. Establish connection
-		clientConfig := client.GetConfig(ctx)
-		tos := &clientConfig.Timeouts
-		tc, cancel := tos.TimeoutContext(ctx, client.TimeoutTrafficManagerAPI)
-		defer cancel()
-
-		var conn *grpc.ClientConn
-
-		conn, err = client.DialSocket(tc, client.ConnectorSocketName)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				// The connector called us, and then it died which means we will die too. This is
-				// a race, but it's not an error.
-				return nil
+// isClusterIP returns true if the given IP belongs to one of the pod or service subnets of the cluster.
+func (t *tunRouter) isClusterIP(ip net.IP) bool {
+	t.sessionsLock.RLock()
+	defer t.sessionsLock.RUnlock()
+	for _, s := range t.sessions {
+		for _, sn := range s.clusterSubnets {
+			if sn.Contains(ip) {
+				return true
 			}
-			return client.CheckTimeout(tc, err)
 		}
-		t.session = mi.Session
-		t.managerClient = manager.NewManagerClient(conn)
+	}
+	return false
+}
 
-		if len(mi.AlsoProxySubnets) > 0 {
-			t.alsoProxySubnets = make([]*net.IPNet, len(mi.AlsoProxySubnets))
-			for i, ap := range mi.AlsoProxySubnets {
-				apSn := iputil.IPNetFromRPC(ap)
-				dlog.Infof(ctx, "Adding also-proxy subnet %s", apSn)
-				t.alsoProxySubnets[i] = apSn
-			}
-		}
-		if len(mi.NeverProxySubnets) > 0 {
-			t.neverProxySubnets = []routing.Route{}
-			for _, np := range mi.NeverProxySubnets {
-				npSn := iputil.IPNetFromRPC(np)
-				dlog.Infof(ctx, "Adding never-proxy subnet %s", npSn)
-				route, err := routing.GetRoute(ctx, npSn)
-				if err != nil {
-					dlog.Errorf(ctx, "unable to get route for never-proxied subnet %s. "+
-						"If this is your kubernetes API server you may want to open an issue, since telepresence may not work if it falls within the CIDR for pods/services. "+
-						"Error: %v",
-						iputil.IPNetFromRPC(np), err)
-					continue
-				}
-				t.neverProxySubnets = append(t.neverProxySubnets, route)
-			}
+// reverseZones returns the names of the reverse DNS zones that cover the pod and service subnets of
+// the cluster.
+func (t *tunRouter) reverseZones() []string {
+	t.sessionsLock.RLock()
+	defer t.sessionsLock.RUnlock()
+	var zones []string
+	for _, s := range t.sessions {
+		for _, sn := range s.clusterSubnets {
+			zones = append(zones, dnsproxy.ReverseZones(sn)...)
 		}
-		t.dnsIP = mi.Dns.RemoteIp
-
-		dgroup.ParentGroup(ctx).Go("watch-cluster-info", func(ctx context.Context) error {
-			t.watchClusterInfo(ctx)
-			return nil
-		})
 	}
-	return nil
+	return zones
 }
 
-func (t *tunRouter) watchClusterInfo(ctx context.Context) {
-	cfgComplete := t.cfgComplete
+func (t *tunRouter) watchClusterInfo(ctx context.Context, s *clusterSession) {
+	cfgComplete := s.cfgComplete
 	backoff := 100 * time.Millisecond
 
 	for ctx.Err() == nil {
-		infoStream, err := t.managerClient.WatchClusterInfo(ctx, t.session)
+		infoStream, err := s.managerClient.WatchClusterInfo(ctx, s.session)
 		if err != nil {
 			err = fmt.Errorf("error when calling WatchClusterInfo: %w", err)
 			dlog.Warn(ctx, err)
@@ -328,25 +300,31 @@ func (t *tunRouter) watchClusterInfo(ctx context.Context) {
 				dlog.Infof(ctx, "Adding pod subnet %s", cidr)
 				subnets = append(subnets, cidr)
 			}
-
-			t.clusterSubnets = subnets
+			t.setClusterSubnets(ctx, s, subnets)
 			if err := t.refreshSubnets(ctx); err != nil {
 				dlog.Error(ctx, err)
 			}
 
 			if cfgComplete != nil {
-				// Only set clusterDNS when it hasn't been explicitly set with the --dns option
-				if t.dnsIP == nil {
-					dlog.Infof(ctx, "Setting cluster DNS to %s", net.IP(mgrInfo.KubeDnsIp))
-					t.dnsIP = mgrInfo.KubeDnsIp
-				}
 				dlog.Infof(ctx, "Setting cluster domain to %q", mgrInfo.ClusterDomain)
-				t.clusterDomain = mgrInfo.ClusterDomain
-				if t.clusterDomain == "" {
+				s.clusterDomain = mgrInfo.ClusterDomain
+				if s.clusterDomain == "" {
 					// Traffic manager predates 2.4.3 and doesn't report a cluster domain. Only thing
 					// left to do then is to assume it's the standard one.
-					t.clusterDomain = "cluster.local."
+					s.clusterDomain = "cluster.local."
 				}
+
+				// The first session that is configured provides the cluster DNS and domain that
+				// the DNS resolver uses.
+				t.configOnce.Do(func() {
+					// Only set clusterDNS when it hasn't been explicitly set with the --dns option
+					if t.dnsIP == nil {
+						dnsIP := s.nat.ToVirtual(mgrInfo.KubeDnsIp)
+						dlog.Infof(ctx, "Setting cluster DNS to %s", dnsIP)
+						t.dnsIP = dnsIP
+					}
+					t.clusterDomain = s.clusterDomain
+				})
 				close(cfgComplete)
 				cfgComplete = nil
 			}
@@ -381,6 +359,9 @@ func (t *tunRouter) stop(c context.Context) {
 	}
 }
 
+// errNoSession is returned when a packet arrives before the router has a session.
+var errNoSession = errors.New("not connected to a traffic-manager")
+
 var blockedUDPPorts = map[uint16]bool{
 	137: true, // NETBIOS Name Service
 	138: true, // NETBIOS Datagram Service
@@ -390,63 +371,15 @@ var blockedUDPPorts = map[uint16]bool{
 func (t *tunRouter) run(c context.Context) error {
 	g := dgroup.NewGroup(c, dgroup.GroupConfig{})
 
-	g.Go("MGR stream", func(c context.Context) error {
-		dlog.Debug(c, "Waiting until manager gRPC is configured")
-		select {
-		case <-c.Done():
-			return nil
-		case <-t.cfgComplete:
-		}
-		return client.Retry(c, "MGR stream", func(c context.Context) error {
-			ver, err := t.managerClient.Version(c, &empty.Empty{})
-			if err != nil {
-				return err
-			}
-			verStr := strings.TrimPrefix(ver.Version, "v")
-			dlog.Infof(c, "Connected to Manager %s", verStr)
-			mgrVer, err := semver.Parse(verStr)
-			if err != nil {
-				return fmt.Errorf("failed to parse manager version %q: %s", verStr, err)
-			}
-
-			clientTunnel, err := t.managerClient.ClientTunnel(c)
-			if err != nil {
-				return err
-			}
-			muxTunnel := connpool.NewMuxTunnel(clientTunnel)
-			if err = muxTunnel.Send(c, connpool.SessionInfoControl(t.session)); err != nil {
-				return err
-			}
-
-			var peerVersion uint16
-			if mgrVer.LE(semver.MustParse("2.4.2")) {
-				peerVersion = 0
-			} else {
-				if err = muxTunnel.Send(c, connpool.VersionControl()); err != nil {
-					return err
-				}
-				peerVersion, err = muxTunnel.ReadPeerVersion(c)
-				if err != nil {
-					return err
-				}
-			}
-			// Versions >= 2 don't use connpool.Tunnel. They use tunnel.Stream.
-			if peerVersion < 2 {
-				t.muxTunnel = muxTunnel
-				close(t.tmVerOk)
-				dlog.Debug(c, "MGR read loop starting")
-				err = t.muxTunnel.DialLoop(c, t.handlers)
-				var recvErr *client.RecvEOF
-				if errors.As(err, &recvErr) {
-					<-c.Done()
-				}
-			} else {
-				close(t.tmVerOk)
-				dlog.Debug(c, "closing since a more recent system detected")
-				err = muxTunnel.CloseSend()
+	g.Go("sessions", func(c context.Context) error {
+		for {
+			select {
+			case <-c.Done():
+				return nil
+			case s := <-t.sessionCh:
+				t.startSession(c, s)
 			}
-			return err
-		})
+		}
 	})
 
 	g.Go("TUN reader", func(c context.Context) error {
@@ -493,6 +426,68 @@ func (t *tunRouter) run(c context.Context) error {
 	return g.Wait()
 }
 
+// mgrStream negotiates the tunnel version with the traffic-manager of the given session, and
+// runs the read loop of the session's muxTunnel when the traffic-manager uses one.
+func (t *tunRouter) mgrStream(c context.Context, s *clusterSession) error {
+	dlog.Debug(c, "Waiting until manager gRPC is configured")
+	select {
+	case <-c.Done():
+		return nil
+	case <-s.cfgComplete:
+	}
+	return client.Retry(c, "MGR stream", func(c context.Context) error {
+		ver, err := s.managerClient.Version(c, &empty.Empty{})
+		if err != nil {
+			return err
+		}
+		verStr := strings.TrimPrefix(ver.Version, "v")
+		dlog.Infof(c, "Connected to Manager %s", verStr)
+		mgrVer, err := semver.Parse(verStr)
+		if err != nil {
+			return fmt.Errorf("failed to parse manager version %q: %s", verStr, err)
+		}
+
+		clientTunnel, err := s.managerClient.ClientTunnel(c)
+		if err != nil {
+			return err
+		}
+		muxTunnel := connpool.NewMuxTunnel(clientTunnel)
+		if err = muxTunnel.Send(c, connpool.SessionInfoControl(s.session)); err != nil {
+			return err
+		}
+
+		var peerVersion uint16
+		if mgrVer.LE(semver.MustParse("2.4.2")) {
+			peerVersion = 0
+		} else {
+			if err = muxTunnel.Send(c, connpool.VersionControl()); err != nil {
+				return err
+			}
+			peerVersion, err = muxTunnel.ReadPeerVersion(c)
+			if err != nil {
+				return err
+			}
+		}
+		// Versions >= 2 don't use connpool.Tunnel. They use tunnel.Stream.
+		if peerVersion < 2 {
+			t.disableRemap(c, s, verStr)
+			s.muxTunnel = muxTunnel
+			s.versionNegotiated(t)
+			dlog.Debug(c, "MGR read loop starting")
+			err = s.muxTunnel.DialLoop(c, t.handlers)
+			var recvErr *client.RecvEOF
+			if errors.As(err, &recvErr) {
+				<-c.Done()
+			}
+		} else {
+			s.versionNegotiated(t)
+			dlog.Debug(c, "closing since a more recent system detected")
+			err = muxTunnel.CloseSend()
+		}
+		return err
+	})
+}
+
 func (t *tunRouter) handlePacket(c context.Context, data *buffer.Data) {
 	defer func() {
 		if data != nil {
@@ -612,7 +607,11 @@ func (t *tunRouter) tcp(c context.Context, pkt tcp.Packet) {
 	}
 
 	wf, _, err := t.handlers.GetOrCreateTCP(c, connID, func(c context.Context, remove func()) (tunnel.Handler, error) {
-		return tcp.NewHandler(t.streamCreator(connID), t.muxTunnel, &t.closing, vifWriter{t.dev}, connID, remove, t.rndSource), nil
+		s := t.sessionFor(connID.Destination())
+		if s == nil {
+			return nil, errNoSession
+		}
+		return tcp.NewHandler(t.streamCreator(s, connID), s.muxTunnel, &t.closing, vifWriter{t.dev}, connID, remove, t.rndSource), nil
 	}, pkt)
 	if err != nil {
 		dlog.Error(c, err)
@@ -631,11 +630,15 @@ func (t *tunRouter) udp(c context.Context, dg udp.Datagram) {
 		if t.dnsLocalAddr != nil && udpHdr.DestinationPort() == t.dnsPort && ipHdr.Destination().Equal(t.dnsIP) {
 			return udp.NewDnsInterceptor(w, connID, remove, t.dnsLocalAddr)
 		}
-		stream, err := t.maybeOpenStream(c, connID)
+		s := t.sessionFor(connID.Destination())
+		if s == nil {
+			return nil, errNoSession
+		}
+		stream, err := t.maybeOpenStream(c, s, connID)
 		if err != nil {
 			return nil, err
 		}
-		return udp.NewHandler(stream, t.muxTunnel, w, connID, remove), nil
+		return udp.NewHandler(stream, s.muxTunnel, w, connID, remove), nil
 	})
 	if err != nil {
 		dlog.Error(c, err)
@@ -644,22 +647,24 @@ func (t *tunRouter) udp(c context.Context, dg udp.Datagram) {
 	uh.(udp.DatagramHandler).HandleDatagram(c, dg)
 }
 
-func (t *tunRouter) maybeOpenStream(c context.Context, id tunnel.ConnID) (tunnel.Stream, error) {
-	if t.muxTunnel != nil {
+func (t *tunRouter) maybeOpenStream(c context.Context, s *clusterSession, id tunnel.ConnID) (tunnel.Stream, error) {
+	if s.muxTunnel != nil {
 		// tunnelVersion <= 2, so use the multiplexing tunnel
 		return nil, nil
 	}
-	return t.streamCreator(id)(c)
+	return t.streamCreator(s, id)(c)
 }
 
-func (t *tunRouter) streamCreator(id tunnel.ConnID) tcp.StreamCreator {
+func (t *tunRouter) streamCreator(s *clusterSession, id tunnel.ConnID) tcp.StreamCreator {
+	// The traffic-manager must dial the cluster IP when the destination is in a remapped subnet
+	id = s.nat.ConnIDToCluster(id)
 	return func(c context.Context) (tunnel.Stream, error) {
 		dlog.Debugf(c, "Opening tunnel for id %s", id)
-		ct, err := t.managerClient.Tunnel(c)
+		ct, err := s.managerClient.Tunnel(c)
 		if err != nil {
 			return nil, err
 		}
 		tc := client.GetConfig(c).Timeouts
-		return tunnel.NewClientStream(c, ct, id, t.session.SessionId, tc.Get(client.TimeoutRoundtripLatency), tc.Get(client.TimeoutEndpointDial))
+		return tunnel.NewClientStream(c, ct, id, s.session.SessionId, tc.Get(client.TimeoutRoundtripLatency), tc.Get(client.TimeoutEndpointDial))
 	}
 }
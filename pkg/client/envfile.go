@@ -0,0 +1,57 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+// WriteEnv writes the given environment to w as KEY=VALUE lines, sorted by key.
+func WriteEnv(w io.Writer, env map[string]string) error {
+	keys := make([]string, len(env))
+	i := 0
+	for k := range env {
+		keys[i] = k
+		i++
+	}
+	sort.Strings(keys)
+
+	bw := bufio.NewWriter(w)
+	for _, k := range keys {
+		if _, err := bw.WriteString(k); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('='); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(env[k]); err != nil {
+			return err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteEnvFile writes the given environment to the given file as KEY=VALUE lines.
+func WriteEnvFile(path string, env map[string]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteEnv(file, env)
+}
+
+// WriteEnvJSON writes the given environment to the given file as a JSON blob.
+func WriteEnvJSON(path string, env map[string]string) error {
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		// Creating JSON from a map[string]string should never fail
+		panic(err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
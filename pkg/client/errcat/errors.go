@@ -22,6 +22,23 @@ const (
 	Unknown // Something else. Consult the logs
 )
 
+func (c Category) String() string {
+	switch c {
+	case OK:
+		return "OK"
+	case User:
+		return "User"
+	case Config:
+		return "Config"
+	case NoLogs:
+		return "NoLogs"
+	case Unknown:
+		return "Unknown"
+	default:
+		return fmt.Sprintf("Category(%d)", int(c))
+	}
+}
+
 // New creates a new categorized error based in its argument. The argument
 // can be an error or a string. If it isn't, it will be converted to a string
 // using its '%v' formatter.
@@ -7,11 +7,14 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
-// DialSocket dials the given socket and returns the resulting connection
+// DialSocket dials the given socket and returns the resulting connection. The trace context of
+// each call made on the connection is propagated to the server.
 func DialSocket(ctx context.Context, socketName string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	return dialSocket(ctx, socketName, opts...)
+	return dialSocket(ctx, socketName, append(tracing.DialOptions(), opts...)...)
 }
 
 // ListenSocket returns a listener for the given socket and returns the resulting connection
@@ -0,0 +1,86 @@
+package dnsproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// resolvConf is the file that holds the configuration of the resolver used by Lookup.
+const resolvConf = "/etc/resolv.conf"
+
+// exchangeTimeout is the timeout for a single exchange with one of the name servers.
+const exchangeTimeout = 2 * time.Second
+
+// Lookup performs a DNS query of the given type using the name servers and search path of the
+// resolver configured for this host (i.e. the cluster resolver when running in a pod). A name that
+// isn't fully qualified is tried with each of the search domains, and the owner name of the RRs that
+// were found using a search domain are changed to the fully qualified form of the given name.
+//
+// The returned rcode is dns.RcodeNameError when no name in the search list was found, and
+// dns.RcodeSuccess together with an empty answer when the name exists but has no RRs of the given
+// type.
+func Lookup(ctx context.Context, qType uint16, name string) ([]dns.RR, int, error) {
+	cfg, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil {
+		return nil, dns.RcodeServerFailure, err
+	}
+	fqn := dns.Fqdn(name)
+	rcode := dns.RcodeNameError
+	for _, n := range cfg.NameList(name) {
+		r, err := exchange(ctx, cfg, n, qType)
+		if err != nil {
+			return nil, dns.RcodeServerFailure, err
+		}
+		switch r.Rcode {
+		case dns.RcodeNameError:
+			continue
+		case dns.RcodeSuccess:
+			if len(r.Answer) == 0 {
+				// The name exists but has no RRs of the given type. Continue the search, and
+				// return an empty answer if nothing else is found.
+				rcode = dns.RcodeSuccess
+				continue
+			}
+		default:
+			return nil, r.Rcode, nil
+		}
+		for _, rr := range r.Answer {
+			if h := rr.Header(); h.Name == n {
+				h.Name = fqn
+			}
+		}
+		return r.Answer, r.Rcode, nil
+	}
+	return nil, rcode, nil
+}
+
+// exchange sends a query to the configured name servers and returns the first response. The query
+// is retried using TCP if the UDP response is truncated.
+func exchange(ctx context.Context, cfg *dns.ClientConfig, name string, qType uint16) (*dns.Msg, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(name, qType)
+	var err error
+	for _, server := range cfg.Servers {
+		addr := net.JoinHostPort(server, cfg.Port)
+		var r *dns.Msg
+		c := dns.Client{Net: "udp", Timeout: exchangeTimeout}
+		if r, _, err = c.ExchangeContext(ctx, q, addr); err != nil {
+			continue
+		}
+		if r.Truncated {
+			c.Net = "tcp"
+			if r, _, err = c.ExchangeContext(ctx, q, addr); err != nil {
+				continue
+			}
+		}
+		return r, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("no name servers found in %s", resolvConf)
+	}
+	return nil, err
+}
@@ -0,0 +1,99 @@
+package dnsproxy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ReverseIP returns the IP that is represented by the given name in the "in-addr.arpa." or "ip6.arpa."
+// domain, or nil if the name isn't a complete reverse name for an IPv4 or IPv6 address. This is the
+// inverse of dns.ReverseAddr.
+func ReverseIP(name string) net.IP {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		ip := make(net.IP, net.IPv4len)
+		for i, label := range labels {
+			b, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[net.IPv4len-1-i] = byte(b)
+		}
+		return ip
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(labels) != 2*net.IPv6len {
+			return nil
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil
+			}
+			// The labels are the nibbles of the address in reverse order.
+			pos := 2*net.IPv6len - 1 - i
+			if pos%2 == 0 {
+				ip[pos/2] |= byte(n) << 4
+			} else {
+				ip[pos/2] |= byte(n)
+			}
+		}
+		return ip
+	}
+	return nil
+}
+
+// ReverseZones returns the names of the reverse DNS zones that together cover the given subnet. A
+// zone always covers a whole number of octets (IPv4) or nibbles (IPv6), so a subnet whose mask doesn't
+// end on such a boundary is covered by several zones. The names have no trailing dot.
+func ReverseZones(sn *net.IPNet) []string {
+	ones, bits := sn.Mask.Size()
+	ip := sn.IP.Mask(sn.Mask)
+	labelBits, suffix := 8, "in-addr.arpa"
+	if bits == 8*net.IPv6len {
+		labelBits, suffix = 4, "ip6.arpa"
+	} else {
+		ip = ip.To4()
+	}
+	if ip == nil || bits == 0 {
+		return nil
+	}
+	labels := (ones + labelBits - 1) / labelBits
+	extra := labels*labelBits - ones
+	zones := make([]string, 0, 1<<extra)
+	for i := 0; i < 1<<extra; i++ {
+		zone := suffix
+		for l := 0; l < labels; l++ {
+			v := labelValue(ip, l, labelBits)
+			if l == labels-1 {
+				v += i
+			}
+			if labelBits == 8 {
+				zone = strconv.Itoa(v) + "." + zone
+			} else {
+				zone = strconv.FormatInt(int64(v), 16) + "." + zone
+			}
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// labelValue returns the value of the l'th octet or nibble of the given IP.
+func labelValue(ip net.IP, l, labelBits int) int {
+	if labelBits == 8 {
+		return int(ip[l])
+	}
+	b := ip[l/2]
+	if l%2 == 0 {
+		return int(b >> 4)
+	}
+	return int(b & 0xf)
+}
@@ -0,0 +1,45 @@
+package dnsproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReverseIP(t *testing.T) {
+	for _, s := range []string{"10.0.0.1", "192.168.17.254", "fd00::1", "2001:db8:85a3::8a2e:370:7334"} {
+		ip := net.ParseIP(s)
+		name, err := dns.ReverseAddr(s)
+		assert.NoError(t, err)
+		assert.True(t, ip.Equal(ReverseIP(name)), "%s -> %s", s, name)
+	}
+	assert.True(t, net.ParseIP("10.0.0.1").Equal(ReverseIP("1.0.0.10.IN-ADDR.ARPA")))
+
+	for _, name := range []string{
+		"0.10.in-addr.arpa.",
+		"256.0.0.10.in-addr.arpa.",
+		"x.0.0.10.in-addr.arpa.",
+		"1.0.ip6.arpa.",
+		"echo.default.svc.cluster.local.",
+	} {
+		assert.Nil(t, ReverseIP(name), name)
+	}
+}
+
+func TestReverseZones(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, sn, err := net.ParseCIDR(s)
+		assert.NoError(t, err)
+		return sn
+	}
+	assert.Equal(t, []string{"96.10.in-addr.arpa"}, ReverseZones(cidr("10.96.0.0/16")))
+	assert.Equal(t, []string{"0.0.10.in-addr.arpa"}, ReverseZones(cidr("10.0.0.0/24")))
+	assert.Equal(t, []string{"10.in-addr.arpa"}, ReverseZones(cidr("10.0.0.0/8")))
+	assert.Equal(t,
+		[]string{"16.172.in-addr.arpa", "17.172.in-addr.arpa", "18.172.in-addr.arpa", "19.172.in-addr.arpa"},
+		ReverseZones(cidr("172.16.0.0/14")))
+	assert.Equal(t, []string{"0.0.d.f.ip6.arpa"}, ReverseZones(cidr("fd00::/16")))
+	assert.Equal(t, []string{"0.2.0.0.d.f.ip6.arpa", "1.2.0.0.d.f.ip6.arpa"}, ReverseZones(cidr("fd00:2000::/23")))
+}
@@ -0,0 +1,32 @@
+package dnsproxy
+
+import (
+	"github.com/miekg/dns"
+)
+
+// PackRRs returns the DNS wire format of each of the given RRs.
+func PackRRs(rrs []dns.RR) ([][]byte, error) {
+	bss := make([][]byte, len(rrs))
+	for i, rr := range rrs {
+		bs := make([]byte, dns.Len(rr))
+		n, err := dns.PackRR(rr, bs, 0, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		bss[i] = bs[:n]
+	}
+	return bss, nil
+}
+
+// UnpackRRs is the inverse of PackRRs.
+func UnpackRRs(bss [][]byte) ([]dns.RR, error) {
+	rrs := make([]dns.RR, len(bss))
+	for i, bs := range bss {
+		rr, _, err := dns.UnpackRR(bs, 0)
+		if err != nil {
+			return nil, err
+		}
+		rrs[i] = rr
+	}
+	return rrs, nil
+}
@@ -0,0 +1,38 @@
+package dnsproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackUnpackRRs(t *testing.T) {
+	hdr := func(name string, rrType uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrType, Class: dns.ClassINET, Ttl: 30}
+	}
+	rrs := []dns.RR{
+		&dns.A{Hdr: hdr("echo.default.", dns.TypeA), A: net.IP{10, 0, 0, 1}.To4()},
+		&dns.AAAA{Hdr: hdr("echo.default.", dns.TypeAAAA), AAAA: net.ParseIP("fd00::1")},
+		&dns.CNAME{Hdr: hdr("alias.default.", dns.TypeCNAME), Target: "echo.default.svc.cluster.local."},
+		&dns.SRV{Hdr: hdr("_http._tcp.echo.default.", dns.TypeSRV), Priority: 0, Weight: 100, Port: 8080, Target: "echo-0.echo.default.svc.cluster.local."},
+		&dns.PTR{Hdr: hdr("1.0.0.10.in-addr.arpa.", dns.TypePTR), Ptr: "echo-0.echo.default.svc.cluster.local."},
+		&dns.TXT{Hdr: hdr("echo.default.", dns.TypeTXT), Txt: []string{"hello", "world"}},
+	}
+	bss, err := PackRRs(rrs)
+	require.NoError(t, err)
+	require.Len(t, bss, len(rrs))
+
+	unpacked, err := UnpackRRs(bss)
+	require.NoError(t, err)
+	require.Len(t, unpacked, len(rrs))
+	for i, rr := range rrs {
+		assert.True(t, dns.IsDuplicate(rr, unpacked[i]), "%s != %s", rr, unpacked[i])
+		assert.Equal(t, rr.Header().Ttl, unpacked[i].Header().Ttl)
+	}
+
+	_, err = UnpackRRs([][]byte{{1, 2, 3}})
+	assert.Error(t, err)
+}
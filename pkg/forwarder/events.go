@@ -0,0 +1,299 @@
+package forwarder
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// sniffQueueSize is the number of reads or writes that can be queued for the HTTP sniffer of a
+// connection before the sniffer gives up.
+const sniffQueueSize = 64
+
+// InterceptEventHandler receives the events that describe the traffic that a Forwarder routes to
+// intercepts. The handler is called from the goroutines that route the traffic, so it must not
+// block.
+type InterceptEventHandler func(*manager.InterceptEvent)
+
+// SetInterceptEventHandler sets the handler that receives the events that describe the traffic
+// that this forwarder routes to intercepts. Connections that are routed before a handler is set
+// don't produce any events.
+func (f *Forwarder) SetInterceptEventHandler(h InterceptEventHandler) {
+	f.mu.Lock()
+	f.eventHandler = h
+	f.mu.Unlock()
+}
+
+func (f *Forwarder) interceptEventHandler() InterceptEventHandler {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.eventHandler
+}
+
+func newInterceptEvent(tp manager.InterceptEvent_Type, interceptID, peer string) *manager.InterceptEvent {
+	ev := &manager.InterceptEvent{
+		Type:        tp,
+		InterceptId: interceptID,
+		Time:        timestamppb.Now(),
+	}
+	if host, port, err := net.SplitHostPort(peer); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			ev.PeerIp = ip
+		}
+		if p, err := strconv.Atoi(port); err == nil {
+			ev.PeerPort = int32(p)
+		}
+	}
+	return ev
+}
+
+// eventConn is a net.Conn that reports the opening and closing of a connection that is routed to
+// an intercept, along with the HTTP requests that it carries. Read returns data from the peer and
+// Write sends data to the peer.
+type eventConn struct {
+	net.Conn
+	interceptID string
+	handler     InterceptEventHandler
+	start       time.Time
+	bytesIn     int64
+	bytesOut    int64
+	closeOnce   sync.Once
+
+	// requests and responses are fed with the data that is read and written, so that
+	// HTTP requests can be reported.
+	requests  *chunkReader
+	responses *chunkReader
+}
+
+// newEventConn wraps the given connection in an eventConn that reports the connection as opened.
+func newEventConn(conn net.Conn, interceptID string, handler InterceptEventHandler) *eventConn {
+	c := &eventConn{
+		Conn:        conn,
+		interceptID: interceptID,
+		handler:     handler,
+		start:       time.Now(),
+		requests:    newChunkReader(sniffQueueSize),
+		responses:   newChunkReader(sniffQueueSize),
+	}
+	c.handler(newInterceptEvent(manager.InterceptEvent_CONNECTION_OPENED, interceptID, conn.RemoteAddr().String()))
+	go c.sniffHTTP()
+	return c
+}
+
+func (c *eventConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddInt64(&c.bytesIn, int64(n))
+		c.requests.feed(b[:n])
+	}
+	return n, err
+}
+
+func (c *eventConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddInt64(&c.bytesOut, int64(n))
+		c.responses.feed(b[:n])
+	}
+	return n, err
+}
+
+func (c *eventConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.requests.close()
+		c.responses.close()
+		ev := newInterceptEvent(manager.InterceptEvent_CONNECTION_CLOSED, c.interceptID, c.RemoteAddr().String())
+		ev.BytesIn = atomic.LoadInt64(&c.bytesIn)
+		ev.BytesOut = atomic.LoadInt64(&c.bytesOut)
+		ev.Duration = durationpb.New(time.Since(c.start))
+		c.handler(ev)
+	})
+	return err
+}
+
+// pendingRequest is a request that has been read from the peer and awaits its response.
+type pendingRequest struct {
+	ev     *manager.InterceptEvent
+	start  time.Time
+	method string
+}
+
+// sniffHTTP parses the data that passes through the connection as HTTP/1.x requests and responses
+// and reports each request once its response has been read. Sniffing stops at the first data that
+// doesn't parse.
+func (c *eventConn) sniffHTTP() {
+	pending := make(chan *pendingRequest, 16)
+	go func() {
+		// Responses to requests that have been read are still parsed when this parser stops.
+		defer close(pending)
+		defer c.requests.disable()
+		br := bufio.NewReader(c.requests)
+		for {
+			if !startsWithMethod(br) {
+				return
+			}
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				return
+			}
+			pr := &pendingRequest{
+				ev:     newInterceptEvent(manager.InterceptEvent_HTTP_REQUEST, c.interceptID, c.RemoteAddr().String()),
+				start:  time.Now(),
+				method: req.Method,
+			}
+			pr.ev.HttpMethod = req.Method
+			pr.ev.HttpPath = req.URL.Path
+			n, err := io.Copy(io.Discard, req.Body)
+			_ = req.Body.Close()
+			pr.ev.BytesIn = n
+			pending <- pr
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	br := bufio.NewReader(c.responses)
+	for pr := range pending {
+		resp, err := readFinalResponse(br, pr.method)
+		if err != nil {
+			break
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		pr.ev.HttpStatus = int32(resp.StatusCode)
+		pr.ev.BytesOut = n
+		pr.ev.Duration = durationpb.New(time.Since(pr.start))
+		c.handler(pr.ev)
+		if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+	}
+
+	// Let the request parser run to completion.
+	c.requests.disable()
+	c.responses.disable()
+	for range pending {
+	}
+}
+
+// startsWithMethod returns true if the next data of the given reader starts with something that
+// looks like an HTTP method followed by a space. It's used to give up early on connections that
+// don't carry HTTP.
+func startsWithMethod(br *bufio.Reader) bool {
+	for i := 1; i <= 8; i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return false
+		}
+		c := b[i-1]
+		if c == ' ' {
+			return i > 1
+		}
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return false
+}
+
+// readFinalResponse reads a response, skipping informational responses other than 101 Switching
+// Protocols.
+func readFinalResponse(br *bufio.Reader, method string) (*http.Response, error) {
+	for {
+		resp, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+	}
+}
+
+// chunkReader is an io.Reader that returns the data that is fed to it. Feeding never blocks. The
+// reader is disabled when it can't keep up, and then returns io.EOF from Read and ignores all
+// further data.
+type chunkReader struct {
+	chunks      chan []byte
+	buf         []byte
+	disabled    int32
+	done        chan struct{}
+	doneOnce    sync.Once
+	dropped     chan struct{}
+	droppedOnce sync.Once
+}
+
+// newChunkReader creates a chunkReader that can queue the given number of chunks.
+func newChunkReader(size int) *chunkReader {
+	return &chunkReader{chunks: make(chan []byte, size), done: make(chan struct{}), dropped: make(chan struct{})}
+}
+
+func (r *chunkReader) feed(data []byte) {
+	if atomic.LoadInt32(&r.disabled) != 0 {
+		return
+	}
+	chunk := make([]byte, len(data))
+	copy(chunk, data)
+	select {
+	case r.chunks <- chunk:
+	default:
+		r.disable()
+	}
+}
+
+// close makes Read return io.EOF once all data fed so far has been read.
+func (r *chunkReader) close() {
+	r.doneOnce.Do(func() { close(r.done) })
+}
+
+// disable makes Read return io.EOF immediately.
+func (r *chunkReader) disable() {
+	atomic.StoreInt32(&r.disabled, 1)
+	r.droppedOnce.Do(func() { close(r.dropped) })
+	r.close()
+}
+
+// whenDisabled returns a channel that is closed when the reader is disabled.
+func (r *chunkReader) whenDisabled() <-chan struct{} {
+	return r.dropped
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if atomic.LoadInt32(&r.disabled) != 0 {
+			return 0, io.EOF
+		}
+		select {
+		case r.buf = <-r.chunks:
+		default:
+			select {
+			case r.buf = <-r.chunks:
+			case <-r.done:
+				// Data may have been fed before the reader was closed.
+				select {
+				case r.buf = <-r.chunks:
+				default:
+					return 0, io.EOF
+				}
+			}
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
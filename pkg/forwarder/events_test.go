@@ -0,0 +1,105 @@
+package forwarder
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+type eventCollector struct {
+	lock   sync.Mutex
+	events map[manager.InterceptEvent_Type][]*manager.InterceptEvent
+}
+
+func (ec *eventCollector) handle(ev *manager.InterceptEvent) {
+	ec.lock.Lock()
+	ec.events[ev.Type] = append(ec.events[ev.Type], ev)
+	ec.lock.Unlock()
+}
+
+func (ec *eventCollector) get(tp manager.InterceptEvent_Type) []*manager.InterceptEvent {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	return ec.events[tp]
+}
+
+// exchange lets the peer send data through the eventConn and then lets the eventConn respond.
+func exchange(t *testing.T, peer net.Conn, c *eventConn, request, response string) {
+	go func() {
+		_, _ = peer.Write([]byte(request))
+	}()
+	buf := make([]byte, len(request))
+	_, err := io.ReadFull(c, buf)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, len(response))
+		_, err := io.ReadFull(peer, buf)
+		done <- err
+	}()
+	_, err = c.Write([]byte(response))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+}
+
+func TestEventConn_HTTP(t *testing.T) {
+	ec := &eventCollector{events: make(map[manager.InterceptEvent_Type][]*manager.InterceptEvent)}
+	peer, ours := net.Pipe()
+	defer peer.Close()
+	peerAddr := &net.TCPAddr{IP: net.IP{10, 1, 2, 3}, Port: 4711}
+	c := newEventConn(&addrConn{Conn: ours, remoteAddr: peerAddr}, "sid:echo", ec.handle)
+
+	get := "GET /hello HTTP/1.1\r\nHost: echo\r\n\r\n"
+	post := "POST /data HTTP/1.1\r\nHost: echo\r\nContent-Length: 4\r\n\r\ndata"
+	exchange(t, peer, c, get, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+	exchange(t, peer, c, post, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n")
+	require.NoError(t, c.Close())
+
+	require.Eventually(t, func() bool {
+		return len(ec.get(manager.InterceptEvent_HTTP_REQUEST)) == 2
+	}, 5*time.Second, 10*time.Millisecond, "%v", ec.get(manager.InterceptEvent_HTTP_REQUEST))
+
+	opened := ec.get(manager.InterceptEvent_CONNECTION_OPENED)
+	require.Len(t, opened, 1)
+	assert.Equal(t, "sid:echo", opened[0].InterceptId)
+	assert.Equal(t, net.IP{10, 1, 2, 3}, net.IP(opened[0].PeerIp))
+	assert.Equal(t, int32(4711), opened[0].PeerPort)
+
+	reqs := ec.get(manager.InterceptEvent_HTTP_REQUEST)
+	assert.Equal(t, "GET", reqs[0].HttpMethod)
+	assert.Equal(t, "/hello", reqs[0].HttpPath)
+	assert.Equal(t, int32(200), reqs[0].HttpStatus)
+	assert.Equal(t, int64(5), reqs[0].BytesOut)
+	assert.Equal(t, "POST", reqs[1].HttpMethod)
+	assert.Equal(t, "/data", reqs[1].HttpPath)
+	assert.Equal(t, int32(404), reqs[1].HttpStatus)
+	assert.Equal(t, int64(4), reqs[1].BytesIn)
+
+	closed := ec.get(manager.InterceptEvent_CONNECTION_CLOSED)
+	require.Len(t, closed, 1)
+	assert.Equal(t, int64(len(get)+len(post)), closed[0].BytesIn)
+	assert.NotNil(t, closed[0].Duration)
+}
+
+func TestEventConn_NotHTTP(t *testing.T) {
+	ec := &eventCollector{events: make(map[manager.InterceptEvent_Type][]*manager.InterceptEvent)}
+	peer, ours := net.Pipe()
+	defer peer.Close()
+	c := newEventConn(ours, "sid:db", ec.handle)
+
+	exchange(t, peer, c, "\x00\x01binary stuff", "\x00\x02more binary stuff")
+	require.NoError(t, c.Close())
+
+	closed := ec.get(manager.InterceptEvent_CONNECTION_CLOSED)
+	require.Len(t, closed, 1)
+	assert.Equal(t, int64(14), closed[0].BytesIn)
+	assert.Equal(t, int64(19), closed[0].BytesOut)
+	assert.Empty(t, ec.get(manager.InterceptEvent_HTTP_REQUEST))
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blang/semver"
@@ -18,23 +19,70 @@ import (
 )
 
 type Forwarder struct {
+	// The number of connections that have been routed to the target and to intercepts. Accessed
+	// atomically, and declared first to guarantee 64-bit alignment.
+	targetConns    uint64
+	interceptConns uint64
+
 	mu sync.Mutex
 
-	lCtx       context.Context
-	lCancel    context.CancelFunc
-	listenAddr *net.TCPAddr
+	lCtx          context.Context
+	lCancel       context.CancelFunc
+	listenAddr    *net.TCPAddr
+	udpListenAddr *net.UDPAddr
+
+	// udpSessions are the current sessions of a UDP forwarder, keyed by peer address. The mu
+	// must not be locked while the udpSessionsLock is held.
+	udpSessions     map[string]*udpSession
+	udpSessionsLock sync.Mutex
 
-	tCtx       context.Context
-	tCancel    context.CancelFunc
 	targetHost string
 	targetPort int32
 
 	manager     manager.ManagerClient
 	sessionInfo *manager.SessionInfo
 
-	intercept  *manager.InterceptInfo
-	muxTunnel  connpool.MuxTunnel
+	routes     []*route
 	mgrVersion semver.Version
+
+	eventHandler InterceptEventHandler
+
+	// httpSniffTimeout is how long a connection to a port with http intercepts may stay silent
+	// before it's considered to not carry HTTP. Zero means DefaultHTTPSniffTimeout.
+	httpSniffTimeout time.Duration
+}
+
+// route is an active intercept together with the predicate that selects the traffic that it
+// receives.
+type route struct {
+	intercept *manager.InterceptInfo
+	predicate *Predicate
+
+	// targetPort is the port on the intercepting client that this forwarder's port maps to.
+	targetPort int32
+
+	// ctx is cancelled when the intercept is removed, so connections that are routed to the
+	// intercept survive when other intercepts come and go.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// The traffic-manager, agent session, and tunnel that connections are routed through. They
+	// never change. SetManager replaces all routes when the traffic-manager changes.
+	manager     manager.ManagerClient
+	sessionInfo *manager.SessionInfo
+	muxTunnel   connpool.MuxTunnel
+}
+
+func (r *route) close() {
+	if r.muxTunnel != nil {
+		_ = r.muxTunnel.CloseSend()
+	}
+	r.cancel()
+}
+
+func (r *route) String() string {
+	is := r.intercept.Spec
+	return fmt.Sprintf("'%s' (%s:%d)", is.Name, is.Client, is.TargetPort)
 }
 
 func NewForwarder(listen *net.TCPAddr, targetHost string, targetPort int32) *Forwarder {
@@ -50,11 +98,31 @@ func (f *Forwarder) SetManager(sessionInfo *manager.SessionInfo, manager manager
 	defer f.mu.Unlock()
 	f.sessionInfo = sessionInfo
 	f.manager = manager
-	f.muxTunnel = nil // any existing tunnel is lost when a reconnect happens
 	f.mgrVersion = version
+	if len(f.routes) == 0 {
+		return
+	}
+
+	// Any existing tunnel is lost when a reconnect happens, so the routes are replaced with
+	// routes that use the new traffic-manager. A route that can't be replaced is dropped, and
+	// is created again by the next call to SetIntercepting.
+	routes := make([]*route, 0, len(f.routes))
+	for _, r := range f.routes {
+		r.close()
+		nr, err := f.unlockedNewRoute(r.intercept, r.predicate)
+		if err != nil {
+			dlog.Error(f.lCtx, err)
+			continue
+		}
+		routes = append(routes, nr)
+	}
+	f.routes = routes
 }
 
 func (f *Forwarder) Serve(ctx context.Context) error {
+	if f.udpListenAddr != nil {
+		return f.serveUDP(ctx)
+	}
 	listener, err := f.Listen(ctx)
 	if err != nil {
 		return err
@@ -102,9 +170,6 @@ func (f *Forwarder) Listen(ctx context.Context) (*net.TCPListener, error) {
 	// Set up listener lifetime (same as the overall forwarder lifetime)
 	f.lCtx, f.lCancel = context.WithCancel(ctx)
 	f.lCtx = dlog.WithField(f.lCtx, "lis", f.listenAddr.String())
-
-	// Set up target lifetime
-	f.tCtx, f.tCancel = context.WithCancel(f.lCtx)
 	listenAddr := f.listenAddr
 
 	f.mu.Unlock()
@@ -115,8 +180,8 @@ func (f *Forwarder) Close() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if f.muxTunnel != nil {
-		_ = f.muxTunnel.CloseSend()
+	for _, r := range f.routes {
+		r.close()
 	}
 	f.lCancel()
 	return nil
@@ -129,75 +194,165 @@ func (f *Forwarder) Target() (string, int32) {
 	return f.targetHost, f.targetPort
 }
 
+// Connections returns the number of connections that the forwarder has routed to its target and to
+// intercepts since it started. A connection that is subject to request level ("http") intercepts
+// is counted as a target connection, even if some of its requests are routed to intercepts. UDP
+// sessions are counted as connections.
+func (f *Forwarder) Connections() (target, intercepted uint64) {
+	return atomic.LoadUint64(&f.targetConns), atomic.LoadUint64(&f.interceptConns)
+}
+
 func (f *Forwarder) Intercepting() bool {
 	f.mu.Lock()
-	intercepting := f.intercept != nil
+	intercepting := len(f.routes) > 0
 	f.mu.Unlock()
 	return intercepting
 }
 
-func (f *Forwarder) SetIntercepting(intercept *manager.InterceptInfo) {
+// SetIntercepting replaces the set of active intercepts. The order of the given intercepts is
+// significant. A connection or request that matches the predicates of several intercepts is routed
+// to the first one, and connection level ("tcp") intercepts take precedence over request level
+// ("http") intercepts. The agent is responsible for rejecting intercepts that conflict.
+//
+// Only the connections that are routed to removed intercepts are closed. Connections that were
+// routed to the app container stay there, while the requests of HTTP connections are routed
+// using the current set of intercepts. UDP sessions that were routed to the app container are
+// closed when an intercept selects their peer, so that the next datagram from the peer starts a
+// session that is routed to the intercept.
+func (f *Forwarder) SetIntercepting(intercepts []*manager.InterceptInfo) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	iceptInfo := func(ii *manager.InterceptInfo) string {
-		is := ii.Spec
-		return fmt.Sprintf("'%s' (%s:%d)", is.Name, is.Client, is.TargetPort)
-	}
-	if intercept == nil {
-		if f.intercept == nil {
+	if len(intercepts) == len(f.routes) {
+		same := true
+		for i, r := range f.routes {
+			if r.intercept.Id != intercepts[i].Id {
+				same = false
+				break
+			}
+		}
+		if same {
 			return
 		}
-		dlog.Debugf(f.lCtx, "Forward target changed from intercept %s to %s:%d", iceptInfo(f.intercept), f.targetHost, f.targetPort)
-	} else {
-		if f.intercept == nil {
-			dlog.Debugf(f.lCtx, "Forward target changed from %s:%d to intercept %s", f.targetHost, f.targetPort, iceptInfo(intercept))
-		} else {
-			if f.intercept.Id == intercept.Id {
-				return
-			}
-			dlog.Debugf(f.lCtx, "Forward target changed from intercept %s to intercept %q", iceptInfo(f.intercept), iceptInfo(intercept))
+	}
+
+	oldRoutes := make(map[string]*route, len(f.routes))
+	for _, r := range f.routes {
+		oldRoutes[r.intercept.Id] = r
+	}
+	routes := make([]*route, 0, len(intercepts))
+	for _, ii := range intercepts {
+		if r, ok := oldRoutes[ii.Id]; ok {
+			delete(oldRoutes, ii.Id)
+			routes = append(routes, r)
+			continue
+		}
+		predicate, err := ParsePredicate(ii.Id, ii.Spec.Mechanism, ii.Spec.MechanismArgs)
+		if err != nil {
+			// The agent rejects intercepts with bad args, so this should never happen.
+			dlog.Errorf(f.lCtx, "unable to parse args for intercept %s: %v", ii.Spec.Name, err)
+			continue
 		}
+		r, err := f.unlockedNewRoute(ii, predicate)
+		if err != nil {
+			dlog.Error(f.lCtx, err)
+			continue
+		}
+		dlog.Debugf(f.lCtx, "Forwarding %s to intercept %s", predicate.Description(ii.Spec.Mechanism, f.Protocol()), r)
+		routes = append(routes, r)
+	}
+	for _, r := range oldRoutes {
+		dlog.Debugf(f.lCtx, "Intercept %s removed", r)
+		r.close()
 	}
+	if len(routes) == 0 {
+		dlog.Debugf(f.lCtx, "Forward target changed to %s:%d", f.targetHost, f.targetPort)
+	}
+	f.routes = routes
+	if f.udpListenAddr != nil {
+		f.unlockedRerouteUDPSessions()
+	}
+}
 
-	// Drop existing connections
-	if f.muxTunnel != nil {
-		_ = f.muxTunnel.CloseSend()
-		f.muxTunnel = nil
+// unlockedNewRoute (1) assumes that f.mu is already locked, and (2) returns a route to the given
+// intercept that is tunneled through the current traffic-manager.
+func (f *Forwarder) unlockedNewRoute(ii *manager.InterceptInfo, predicate *Predicate) (*route, error) {
+	r := &route{
+		intercept:   ii,
+		predicate:   predicate,
+		targetPort:  f.interceptTargetPort(ii.Spec),
+		manager:     f.manager,
+		sessionInfo: f.sessionInfo,
 	}
-	f.tCancel()
+	r.ctx, r.cancel = context.WithCancel(f.lCtx)
+	if f.manager != nil {
+		muxTunnel, err := f.startManagerTunnel(r.ctx, ii.ClientSession)
+		if err != nil {
+			r.cancel()
+			return nil, err
+		}
+		r.muxTunnel = muxTunnel
+	}
+	return r, nil
+}
 
-	// Set up new target and lifetime
-	f.tCtx, f.tCancel = context.WithCancel(f.lCtx)
-	if intercept != nil {
-		if f.manager != nil {
-			muxTunnel, err := f.startManagerTunnel(f.tCtx, intercept.ClientSession)
-			if err != nil {
-				dlog.Error(f.tCtx, err)
-				return
-			}
-			f.muxTunnel = muxTunnel
+// httpRoutes returns the current request level ("http") routes that select connections from the
+// given source.
+func (f *Forwarder) httpRoutes(srcIP net.IP) []*route {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var routes []*route
+	for _, r := range f.routes {
+		if r.intercept.Spec.Mechanism == "http" && !r.intercept.Spec.Mirror && r.predicate.MatchesSource(srcIP) {
+			routes = append(routes, r)
 		}
 	}
-	f.intercept = intercept
+	return routes
 }
 
 func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 	f.mu.Lock()
-	ctx := f.tCtx
+	ctx := f.lCtx
 	targetHost := f.targetHost
 	targetPort := f.targetPort
-	intercept := f.intercept
-	muxTunnel := f.muxTunnel
+	routes := f.routes
+	sniffTimeout := f.httpSniffTimeout
 	f.mu.Unlock()
-	if intercept != nil {
-		return f.interceptConn(ctx, clientConn, intercept, muxTunnel)
+
+	// Mirror intercepts receive a copy of the connection, regardless of where it's routed.
+	conn := f.mirrorConn(clientConn, routes)
+
+	isHTTP := false
+	srcIP := clientConn.RemoteAddr().(*net.TCPAddr).IP
+	for _, r := range routes {
+		if r.intercept.Spec.Mirror || !r.predicate.MatchesSource(srcIP) {
+			continue
+		}
+		if r.intercept.Spec.Mechanism != "http" {
+			if h := f.interceptEventHandler(); h != nil {
+				conn = newEventConn(conn, r.intercept.Id, h)
+			}
+			atomic.AddUint64(&f.interceptConns, 1)
+			return f.interceptConn(r.ctx, conn, conn.RemoteAddr(), r)
+		}
+		isHTTP = true
 	}
+	atomic.AddUint64(&f.targetConns, 1)
 
 	targetAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", targetHost, targetPort))
 	if err != nil {
 		return fmt.Errorf("error on resolve(%s:%d): %w", targetHost, targetPort, err)
 	}
+	if isHTTP {
+		// Only connections that carry HTTP can be routed request by request. Other connections to
+		// the same port are forwarded to the app container as is.
+		if sniffTimeout == 0 {
+			sniffTimeout = DefaultHTTPSniffTimeout
+		}
+		if conn, isHTTP = sniffHTTP(conn, sniffTimeout); isHTTP {
+			return f.forwardHTTPConn(ctx, conn, func() []*route { return f.httpRoutes(srcIP) }, targetAddr.String())
+		}
+	}
 
 	ctx = dlog.WithField(ctx, "client", clientConn.RemoteAddr().String())
 	ctx = dlog.WithField(ctx, "target", targetAddr.String())
@@ -205,7 +360,7 @@ func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 	dlog.Debug(ctx, "Forwarding...")
 	defer dlog.Debug(ctx, "Done forwarding")
 
-	defer clientConn.Close()
+	defer conn.Close()
 
 	targetConn, err := net.DialTCP("tcp", nil, targetAddr)
 	if err != nil {
@@ -216,7 +371,7 @@ func (f *Forwarder) forwardConn(clientConn *net.TCPConn) error {
 	done := make(chan struct{})
 
 	go func() {
-		if _, err := io.Copy(targetConn, clientConn); err != nil {
+		if _, err := io.Copy(targetConn, conn); err != nil {
 			dlog.Debugf(ctx, "Error clientConn->targetConn: %+v", err)
 		}
 		_ = targetConn.CloseWrite()
@@ -323,21 +478,35 @@ func (f *Forwarder) startManagerTunnel(ctx context.Context, clientSession *manag
 	return muxTunnel, nil
 }
 
-func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, iCept *manager.InterceptInfo, muxTunnel connpool.MuxTunnel) error {
+// interceptTargetPort returns the port on the intercepting client that corresponds to the app port
+// of this forwarder.
+func (f *Forwarder) interceptTargetPort(spec *manager.InterceptSpec) int32 {
+	for _, ip := range spec.Ports {
+		if ip.ContainerPort == f.targetPort {
+			return ip.TargetPort
+		}
+	}
+	return spec.TargetPort
+}
+
+// interceptConn routes the given connection to the intercept of the given route. The ConnID of the
+// tunneled connection uses the given source address, which is the remote address of the connection
+// unless the connection is a mirror copy.
+func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, src net.Addr, r *route) error {
 	dlog.Infof(ctx, "Accept got connection from %s", conn.RemoteAddr())
 
-	srcIp, srcPort, err := iputil.SplitToIPPort(conn.RemoteAddr())
+	srcIp, srcPort, err := iputil.SplitToIPPort(src)
 	if err != nil {
-		return fmt.Errorf("failed to parse intercept source address %s", conn.RemoteAddr())
+		return fmt.Errorf("failed to parse intercept source address %s", src)
 	}
 
-	spec := iCept.Spec
+	spec := r.intercept.Spec
 	destIp := iputil.Parse(spec.TargetHost)
-	id := tunnel.NewConnID(tunnel.IPProto(conn.RemoteAddr().Network()), srcIp, destIp, srcPort, uint16(spec.TargetPort))
+	id := tunnel.NewConnID(tunnel.IPProto(src.Network()), srcIp, destIp, srcPort, uint16(r.targetPort))
 
-	if muxTunnel != nil {
+	if r.muxTunnel != nil {
 		_, found, err := tunnel.GetPool(ctx).GetOrCreate(ctx, id, func(ctx context.Context, release func()) (tunnel.Handler, error) {
-			return connpool.HandlerFromConn(id, muxTunnel, release, conn), nil
+			return connpool.HandlerFromConn(id, r.muxTunnel, release, conn), nil
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create intercept tunnel connection for %s: %v", id, err)
@@ -349,16 +518,19 @@ func (f *Forwarder) interceptConn(ctx context.Context, conn net.Conn, iCept *man
 		return nil
 	}
 
-	ms, err := f.manager.Tunnel(ctx)
+	if r.manager == nil {
+		return fmt.Errorf("unable to route %s to intercept %s: not connected to the traffic-manager", id, r)
+	}
+	ms, err := r.manager.Tunnel(ctx)
 	if err != nil {
 		return fmt.Errorf("call to manager.Tunnel() failed. Id %s: %v", id, err)
 	}
 
-	s, err := tunnel.NewClientStream(ctx, ms, id, f.sessionInfo.SessionId, time.Duration(spec.RoundtripLatency), time.Duration(spec.DialTimeout))
+	s, err := tunnel.NewClientStream(ctx, ms, id, r.sessionInfo.SessionId, time.Duration(spec.RoundtripLatency), time.Duration(spec.DialTimeout))
 	if err != nil {
 		return err
 	}
-	if err = s.Send(ctx, tunnel.SessionMessage(iCept.ClientSession.SessionId)); err != nil {
+	if err = s.Send(ctx, tunnel.SessionMessage(r.intercept.ClientSession.SessionId)); err != nil {
 		return fmt.Errorf("unable to send client session id. Id %s: %v", id, err)
 	}
 	d := tunnel.NewConnEndpoint(s, conn)
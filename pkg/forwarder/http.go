@@ -0,0 +1,498 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// InterceptIDHeader is the header that an "auto" matcher will use when selecting the requests
+// that should be routed to an intercept.
+const InterceptIDHeader = "x-telepresence-intercept-id"
+
+// DefaultHTTPSniffTimeout is how long the forwarder waits for the first bytes of a connection when
+// it determines if the connection carries HTTP. An HTTP client sends its request as soon as it has
+// connected, but the client of a server-first protocol, such as SMTP or MySQL, sends nothing until
+// it has received the greeting of the server. Such connections are forwarded to the app container
+// when the time is up, so their greeting is delayed by this long. Use SetHTTPSniffTimeout to change
+// it.
+const DefaultHTTPSniffTimeout = 250 * time.Millisecond
+
+// maxRequestLineLength is the number of bytes that sniffHTTP peeks at before it gives up on finding
+// the end of an HTTP request-line. Longer request-lines are rare, and the connections that carry
+// them are forwarded to the app container as is.
+const maxRequestLineLength = 8192
+
+// peekConn is a net.Conn that returns the bytes that have been peeked at before the remaining bytes
+// of the conn that it wraps.
+type peekConn struct {
+	net.Conn
+	peeked []byte
+}
+
+func (c *peekConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// SetHTTPSniffTimeout sets how long a connection to a port with http intercepts may stay silent
+// before it's forwarded to the app container as is. Zero means DefaultHTTPSniffTimeout.
+func (f *Forwarder) SetHTTPSniffTimeout(timeout time.Duration) {
+	f.mu.Lock()
+	f.httpSniffTimeout = timeout
+	f.mu.Unlock()
+}
+
+// sniffHTTP peeks at the first bytes of the given connection and returns true if they are the start
+// of an HTTP/1.x request or of an h2c connection. The returned conn must be used in place of the
+// given one, because it returns the bytes that were peeked at.
+func sniffHTTP(conn net.Conn, timeout time.Duration) (net.Conn, bool) {
+	pc := &peekConn{Conn: conn}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return pc, false
+	}
+	defer func() {
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	buf := make([]byte, 512)
+	for {
+		isHTTP, candidate := matchRequestLine(pc.peeked)
+		if isHTTP || !candidate || len(pc.peeked) >= maxRequestLineLength {
+			return pc, isHTTP
+		}
+		n, err := conn.Read(buf)
+		pc.peeked = append(pc.peeked, buf[:n]...)
+		if err != nil {
+			// A closed connection returns its error again on the next read, and a timeout means
+			// that the client is waiting for the server to speak first.
+			isHTTP, _ = matchRequestLine(pc.peeked)
+			return pc, isHTTP
+		}
+	}
+}
+
+// matchRequestLine checks if the given bytes start with something shaped like an HTTP request-line,
+// i.e. "METHOD SP request-target SP HTTP/". The method is any sequence of upper case letters,
+// digits, '-', and '_', so extension methods such as PROPFIND are recognized, and so is the
+// "PRI * HTTP/2.0" that starts the connection preface of h2c with prior knowledge. It returns true
+// if the shape is complete, and candidate is true if the bytes can still become a match when more
+// bytes arrive.
+func matchRequestLine(b []byte) (isHTTP, candidate bool) {
+	const (
+		method = iota
+		target
+		version
+	)
+	state := method
+	start := 0
+	for i, c := range b {
+		switch state {
+		case method:
+			switch {
+			case c == ' ' && i > 0:
+				state = target
+				start = i + 1
+			case 'A' <= c && c <= 'Z', '0' <= c && c <= '9' && i > 0, (c == '-' || c == '_') && i > 0:
+			default:
+				return false, false
+			}
+		case target:
+			switch {
+			case c == ' ' && i > start:
+				state = version
+				start = i + 1
+			case c <= ' ' || c >= 0x7f:
+				return false, false
+			}
+		case version:
+			v := b[start : i+1]
+			if !bytes.HasPrefix([]byte("HTTP/"), v) {
+				return false, false
+			}
+			if len(v) == len("HTTP/") {
+				return true, false
+			}
+		}
+	}
+	return false, true
+}
+
+// HeaderMatcher matches an HTTP request that has a header with the given name and a value that
+// matches the given regular expression.
+type HeaderMatcher struct {
+	Name  string
+	Text  string
+	Value *regexp.Regexp
+}
+
+// Matches returns true if at least one of the values of the header matches.
+func (hm *HeaderMatcher) Matches(h http.Header) bool {
+	for _, v := range h.Values(hm.Name) {
+		if hm.Value.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (hm *HeaderMatcher) String() string {
+	return fmt.Sprintf("'%s: %s'", hm.Name, hm.Text)
+}
+
+// HeaderMatchers is a conjunction of HeaderMatcher. An empty HeaderMatchers will match all
+// requests.
+type HeaderMatchers []*HeaderMatcher
+
+// Matches returns true if all matchers match the given headers
+func (hms HeaderMatchers) Matches(h http.Header) bool {
+	for _, hm := range hms {
+		if !hm.Matches(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// Description returns a human-friendly description of what requests that the matchers select. It
+// is suitable for use as the MechanismArgsDesc of an intercept.
+func (hms HeaderMatchers) Description() string {
+	if len(hms) == 0 {
+		return "all HTTP requests"
+	}
+	sb := strings.Builder{}
+	sb.WriteString("HTTP requests that match all of the headers:")
+	hms.writeTo(&sb)
+	return sb.String()
+}
+
+func (hms HeaderMatchers) writeTo(sb *strings.Builder) {
+	for _, hm := range hms {
+		sb.WriteString("\n  ")
+		sb.WriteString(hm.String())
+	}
+}
+
+// connListener is a net.Listener that returns one single connection and then blocks until that
+// connection has been closed. It makes it possible to serve an already accepted connection using
+// a http.Server.
+type connListener struct {
+	conn     net.Conn
+	accepted bool
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.doneOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// addrConn is a net.Conn that reports a remote address other than the one of the
+// conn that it wraps.
+type addrConn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// interceptTransport holds the transports used when sending requests to one intercepting client.
+type interceptTransport struct {
+	id string
+	h1 *http.Transport
+	h2 *http2.Transport
+}
+
+func (it *interceptTransport) closeIdleConnections() {
+	it.h1.CloseIdleConnections()
+	it.h2.CloseIdleConnections()
+}
+
+// routingTransport is a http.RoundTripper that sends requests that match an intercept to the
+// intercepting client and all other requests to the app container. A request that matches several
+// intercepts is sent to the first one. The intercepts are those that are current when the request
+// is sent.
+type routingTransport struct {
+	routes       func() []*route
+	newTransport func(*route) *interceptTransport
+	app          *http.Transport
+	app2         *http2.Transport
+	handler      InterceptEventHandler
+
+	mu     sync.Mutex
+	icepts map[*route]*interceptTransport
+}
+
+func (rt *routingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h2 := req.ProtoMajor == 2
+	for i, r := range rt.routes() {
+		if r.predicate.MatchesRequest(req) {
+			dlog.Debugf(req.Context(), "%s %s routed to intercept #%d", req.Method, req.URL.Path, i)
+			return rt.interceptRoundTrip(rt.transportFor(r), req, h2)
+		}
+	}
+	restoreInboundHeader(req)
+	if h2 {
+		return rt.app2.RoundTrip(req)
+	}
+	return rt.app.RoundTrip(req)
+}
+
+type inboundHeaderKey struct{}
+
+// withInboundHeader returns a handler that retains the header of each request, so that the header
+// can be restored once the request has passed through a httputil.ReverseProxy.
+func withInboundHeader(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), inboundHeaderKey{}, r.Header.Clone())))
+	})
+}
+
+// restoreInboundHeader replaces the header of the given request with the header that it had when it
+// arrived. A httputil.ReverseProxy removes hop-by-hop headers and adds an X-Forwarded-For header,
+// which is fine for requests that are sent to an intercepting client, but the requests that are
+// sent to the app container must arrive as if there was no proxy.
+func restoreInboundHeader(req *http.Request) {
+	if h, ok := req.Context().Value(inboundHeaderKey{}).(http.Header); ok {
+		req.Header = h
+	}
+}
+
+// transportFor returns the transport of the given route, and creates it if it doesn't exist. The
+// transports of routes that have been removed are closed.
+func (rt *routingTransport) transportFor(r *route) *interceptTransport {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for or, it := range rt.icepts {
+		if or.ctx.Err() != nil {
+			it.closeIdleConnections()
+			delete(rt.icepts, or)
+		}
+	}
+	it, ok := rt.icepts[r]
+	if !ok {
+		it = rt.newTransport(r)
+		rt.icepts[r] = it
+	}
+	return it
+}
+
+// interceptRoundTrip sends the given request to an intercepting client and, when an event handler
+// is set, reports the request once the body of the response has been consumed.
+func (rt *routingTransport) interceptRoundTrip(it *interceptTransport, req *http.Request, h2 bool) (*http.Response, error) {
+	var ev *manager.InterceptEvent
+	if rt.handler != nil {
+		ev = newInterceptEvent(manager.InterceptEvent_HTTP_REQUEST, it.id, req.RemoteAddr)
+		ev.HttpMethod = req.Method
+		ev.HttpPath = req.URL.Path
+		if req.ContentLength > 0 {
+			ev.BytesIn = req.ContentLength
+		}
+	}
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	if h2 {
+		resp, err = it.h2.RoundTrip(req)
+	} else {
+		resp, err = it.h1.RoundTrip(req)
+	}
+	if ev != nil && err == nil {
+		ev.HttpStatus = int32(resp.StatusCode)
+		resp.Body = &eventBody{ReadCloser: resp.Body, done: func(n int64) {
+			ev.BytesOut = n
+			ev.Duration = durationpb.New(time.Since(start))
+			rt.handler(ev)
+		}}
+	}
+	return resp, err
+}
+
+// eventBody is the body of a response from an intercepting client. It counts the bytes that are
+// read and calls done when it's closed.
+type eventBody struct {
+	io.ReadCloser
+	n        int64
+	done     func(int64)
+	doneOnce sync.Once
+}
+
+func (b *eventBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *eventBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.doneOnce.Do(func() { b.done(b.n) })
+	return err
+}
+
+func (rt *routingTransport) closeIdleConnections() {
+	rt.app.CloseIdleConnections()
+	rt.app2.CloseIdleConnections()
+	rt.mu.Lock()
+	for _, it := range rt.icepts {
+		it.closeIdleConnections()
+	}
+	rt.mu.Unlock()
+}
+
+// forwardHTTPConn serves HTTP/1.1 and h2c requests arriving on the given connection and routes each
+// request to either one of the intercepting clients or the app container depending on whether it
+// matches the predicate of one of the routes that the given function returns.
+func (f *Forwarder) forwardHTTPConn(ctx context.Context, conn net.Conn, routes func() []*route, targetAddr string) error {
+	ctx = dlog.WithField(ctx, "client", conn.RemoteAddr().String())
+	dlog.Debug(ctx, "Forwarding HTTP...")
+	defer dlog.Debug(ctx, "Done forwarding HTTP")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// All connections to an intercepting client will use the remote address of the
+	// intercepted connection as their source, so only one such connection can exist at
+	// any given time. For HTTP/1.1 that's fine since the requests that arrive on one
+	// connection are serialized, and HTTP/2 multiplexes all requests on one connection.
+	// The tunnel must outlive the request that caused the dial, so the context of the
+	// intercepted connection is used rather than the one passed to the dial function.
+	dialIntercept := func(r *route) (net.Conn, error) {
+		ours, theirs := net.Pipe()
+		go func() {
+			if err := f.interceptConn(ctx, &addrConn{Conn: theirs, remoteAddr: conn.RemoteAddr()}, conn.RemoteAddr(), r); err != nil {
+				dlog.Error(ctx, err)
+				_ = theirs.Close()
+			}
+		}()
+		return ours, nil
+	}
+	dialApp := func(ctx context.Context) (net.Conn, error) {
+		d := net.Dialer{}
+		return d.DialContext(ctx, "tcp", targetAddr)
+	}
+
+	rt := &routingTransport{
+		routes:  routes,
+		handler: f.interceptEventHandler(),
+		icepts:  make(map[*route]*interceptTransport),
+		app: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialApp(ctx)
+			},
+		},
+		app2: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(_, _ string, _ *tls.Config) (net.Conn, error) {
+				return dialApp(ctx)
+			},
+		},
+	}
+	rt.newTransport = func(r *route) *interceptTransport {
+		return &interceptTransport{
+			id: r.intercept.Id,
+			h1: &http.Transport{
+				MaxConnsPerHost: 1,
+				DialContext: func(context.Context, string, string) (net.Conn, error) {
+					return dialIntercept(r)
+				},
+			},
+			h2: &http2.Transport{
+				AllowHTTP: true,
+				DialTLS: func(string, string, *tls.Config) (net.Conn, error) {
+					return dialIntercept(r)
+				},
+			},
+		}
+	}
+	defer rt.closeIdleConnections()
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = targetAddr
+		},
+		Transport:     rt,
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			dlog.Errorf(ctx, "%s %s: %v", req.Method, req.URL.Path, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	// A connection that is hijacked (an h2c upgrade or a protocol switch performed by the proxy)
+	// is served by the handler, so the listener is closed when the handler returns.
+	l := &connListener{conn: conn, done: make(chan struct{})}
+	hijacked := int32(0)
+	handler := h2c.NewHandler(withInboundHeader(proxy), &http2.Server{})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler.ServeHTTP(w, r)
+			if atomic.LoadInt32(&hijacked) != 0 {
+				_ = l.Close()
+			}
+		}),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateClosed:
+				_ = l.Close()
+			case http.StateHijacked:
+				atomic.StoreInt32(&hijacked, 1)
+			}
+		},
+		ErrorLog: dlog.StdLogger(ctx, dlog.LogLevelDebug),
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+		_ = conn.Close()
+	}()
+	go func() {
+		<-l.done
+		cancel()
+	}()
+	if err := srv.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
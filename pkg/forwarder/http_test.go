@@ -0,0 +1,143 @@
+package forwarder
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func TestSniffHTTP(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		isHTTP bool
+	}{
+		{"HTTP/1.1", "GET / HTTP/1.1\r\nHost: x\r\n\r\n", true},
+		{"h2c prior knowledge", "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", true},
+		{"TLS", "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03", false},
+		{"extension method", "PROPFIND /dav HTTP/1.1\r\nHost: x\r\n\r\n", true},
+		{"absolute-form", "OPTIONS http://x/ HTTP/1.1\r\n\r\n", true},
+		{"lowercase method", "get / HTTP/1.1\r\n\r\n", false},
+		{"not a request-line", "SET key value\r\n", false},
+		{"HTTP/0.9", "GET /\r\n", false},
+		{"truncated", "GE", false},
+		{"server first", "", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			peer, ours := net.Pipe()
+			if tt.data != "" {
+				go func() {
+					_, _ = peer.Write([]byte(tt.data))
+					_ = peer.Close()
+				}()
+			}
+			conn, isHTTP := sniffHTTP(ours, 50*time.Millisecond)
+			assert.Equal(t, tt.isHTTP, isHTTP)
+			if tt.data == "" {
+				_ = peer.Close()
+			}
+
+			// All bytes are available to the reader of the returned conn
+			data, _ := io.ReadAll(conn)
+			assert.Equal(t, tt.data, string(data))
+		})
+	}
+}
+
+// startHTTPForwarder starts a forwarder to the given target with an http intercept that matches no
+// requests, and returns the address that it listens to.
+func startHTTPForwarder(ctx context.Context, t *testing.T, targetAddr *net.TCPAddr) *net.TCPAddr {
+	f := NewForwarder(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, targetAddr.IP.String(), int32(targetAddr.Port))
+	l, err := f.Listen(ctx)
+	require.NoError(t, err)
+	go func() {
+		_ = f.ServeListener(ctx, l)
+	}()
+	f.SetIntercepting([]*manager.InterceptInfo{{
+		Id: "intercept-01",
+		Spec: &manager.InterceptSpec{
+			Name:          "cept1Name",
+			Client:        "user@host1",
+			Mechanism:     "http",
+			MechanismArgs: []string{"--match=x-intercept=yes"},
+		},
+	}})
+	return l.Addr().(*net.TCPAddr)
+}
+
+func TestForwarder_HTTPIntercept_NotHTTP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A TCP echo server
+	el, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer el.Close()
+	go func() {
+		for {
+			conn, err := el.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	// Connections that don't carry HTTP, such as TLS, pass through unchanged
+	conn, err := net.Dial("tcp", startHTTPForwarder(ctx, t, el.Addr().(*net.TCPAddr)).String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	msg := "\x16\x03\x01\x00\x05hello"
+	_, err = conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(buf))
+}
+
+func TestForwarder_HTTPIntercept_AppHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	targetAddr, err := net.ResolveTCPAddr("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", startHTTPForwarder(ctx, t, targetAddr).String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example\r\nConnection: keep-alive, X-Hop\r\nX-Hop: 1\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// A request that is sent to the app container arrives as if there was no proxy
+	h := <-headers
+	assert.Empty(t, h.Values("X-Forwarded-For"))
+	assert.Equal(t, "1", h.Get("X-Hop"))
+	assert.Equal(t, "keep-alive, X-Hop", h.Get("Connection"))
+}
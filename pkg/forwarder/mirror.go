@@ -0,0 +1,122 @@
+package forwarder
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// mirrorQueueSize is the number of reads from a connection that can be queued for the client of a
+// mirror intercept. A mirror that falls further behind than that is dropped, so that a slow client
+// never stalls the traffic to the app container.
+const mirrorQueueSize = 256
+
+// mirrorConn is a net.Conn that sends a copy of all data that it reads from the peer to the clients
+// of mirror intercepts.
+type mirrorConn struct {
+	net.Conn
+	copies    []*chunkReader
+	closeOnce sync.Once
+}
+
+func (c *mirrorConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		for _, cr := range c.copies {
+			cr.feed(b[:n])
+		}
+	}
+	if err != nil {
+		c.closeCopies()
+	}
+	return n, err
+}
+
+func (c *mirrorConn) Close() error {
+	err := c.Conn.Close()
+	c.closeCopies()
+	return err
+}
+
+func (c *mirrorConn) closeCopies() {
+	c.closeOnce.Do(func() {
+		for _, cr := range c.copies {
+			cr.close()
+		}
+	})
+}
+
+// mirrorConn returns a connection that sends a copy of the data that it reads to the mirror
+// intercepts among the given routes that match its source, or the given connection when there
+// are no such intercepts.
+func (f *Forwarder) mirrorConn(conn net.Conn, routes []*route) net.Conn {
+	srcIP := conn.RemoteAddr().(*net.TCPAddr).IP
+	var copies []*chunkReader
+	for _, r := range routes {
+		if r.intercept.Spec.Mirror && r.predicate.MatchesSource(srcIP) {
+			cr := newChunkReader(mirrorQueueSize)
+			copies = append(copies, cr)
+			go f.mirror(r, conn.LocalAddr(), conn.RemoteAddr(), cr)
+		}
+	}
+	if len(copies) == 0 {
+		return conn
+	}
+	return &mirrorConn{Conn: conn, copies: copies}
+}
+
+// mirror sends the data read from the given chunkReader to the client of the given mirror intercept
+// and discards the client's responses.
+//
+// The copy is tunneled with a source port that is reserved on the local IP of the connection for as
+// long as the copy lasts, so that its ConnID never equals the ConnID of the connection itself, or of
+// any other connection, when an intercept routes that to the same port of the same client.
+func (f *Forwarder) mirror(r *route, localAddr, remoteAddr net.Addr, cr *chunkReader) {
+	ctx := r.ctx
+	var localIP net.IP
+	if la, ok := localAddr.(*net.TCPAddr); ok {
+		localIP = la.IP
+	}
+	reserved, err := net.ListenTCP("tcp", &net.TCPAddr{IP: localIP})
+	if err != nil {
+		dlog.Errorf(ctx, "Unable to mirror connection from %s to intercept %s: %v", remoteAddr, r, err)
+		cr.disable()
+		return
+	}
+	defer reserved.Close()
+
+	ours, theirs := net.Pipe()
+	defer ours.Close()
+
+	var conn net.Conn = &addrConn{Conn: theirs, remoteAddr: remoteAddr}
+	if h := f.interceptEventHandler(); h != nil {
+		conn = newEventConn(conn, r.intercept.Id, h)
+	}
+	go func() {
+		if err := f.interceptConn(ctx, conn, reserved.Addr(), r); err != nil {
+			dlog.Error(ctx, err)
+			_ = conn.Close()
+		}
+	}()
+	go func() {
+		_, _ = io.Copy(io.Discard, ours)
+	}()
+
+	// A write to a client that doesn't keep up blocks, so the pipe is closed when the mirror
+	// is dropped or the intercept is removed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-cr.whenDisabled():
+			dlog.Infof(ctx, "Dropping mirror of connection from %s to intercept %s because the client doesn't keep up", remoteAddr, r)
+		case <-ctx.Done():
+		}
+		_ = ours.Close()
+	}()
+	_, _ = io.Copy(ours, cr)
+}
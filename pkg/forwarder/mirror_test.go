@@ -0,0 +1,168 @@
+package forwarder
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// readChunks lets the peer write the given chunks and reads them from the given conn.
+func readChunks(t *testing.T, peer, conn net.Conn, chunks []string) {
+	go func() {
+		for _, c := range chunks {
+			_, _ = peer.Write([]byte(c))
+		}
+	}()
+	for _, c := range chunks {
+		buf := make([]byte, len(c))
+		_, err := io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, c, string(buf))
+	}
+}
+
+func TestMirrorConn_Copy(t *testing.T) {
+	peer, ours := net.Pipe()
+	defer peer.Close()
+	cr := newChunkReader(mirrorQueueSize)
+	mc := &mirrorConn{Conn: ours, copies: []*chunkReader{cr}}
+
+	readChunks(t, peer, mc, []string{"hello ", "mirrored ", "world"})
+	require.NoError(t, mc.Close())
+
+	data, err := io.ReadAll(cr)
+	require.NoError(t, err)
+	assert.Equal(t, "hello mirrored world", string(data))
+}
+
+func TestMirrorConn_SlowMirror(t *testing.T) {
+	peer, ours := net.Pipe()
+	defer peer.Close()
+	cr := newChunkReader(2)
+	mc := &mirrorConn{Conn: ours, copies: []*chunkReader{cr}}
+
+	// The mirror is never read, so it's dropped when its queue is full, but the
+	// connection itself is unaffected.
+	readChunks(t, peer, mc, []string{"one", "two", "three", "four"})
+	select {
+	case <-cr.whenDisabled():
+	default:
+		t.Fatal("slow mirror was not dropped")
+	}
+	data, err := io.ReadAll(cr)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	require.NoError(t, mc.Close())
+}
+
+// connectRecorder is a manager.ManagerClient whose agent tunnels record the IDs of the connections
+// that are opened through them.
+type connectRecorder struct {
+	manager.ManagerClient
+	sync.Mutex
+	connects []tunnel.ConnID
+}
+
+func (m *connectRecorder) AgentTunnel(ctx context.Context, _ ...grpc.CallOption) (manager.Manager_AgentTunnelClient, error) {
+	return &recordingAgentTunnel{ctx: ctx, recorder: m}, nil
+}
+
+func (m *connectRecorder) connected() []tunnel.ConnID {
+	m.Lock()
+	defer m.Unlock()
+	return append([]tunnel.ConnID(nil), m.connects...)
+}
+
+type recordingAgentTunnel struct {
+	grpc.ClientStream
+	ctx      context.Context
+	recorder *connectRecorder
+}
+
+func (t *recordingAgentTunnel) Send(cm *manager.ConnMessage) error {
+	if msg := connpool.FromConnMessage(cm); msg != nil {
+		if ctrl, ok := msg.(connpool.Control); ok && ctrl.Code() == connpool.Connect {
+			t.recorder.Lock()
+			t.recorder.connects = append(t.recorder.connects, ctrl.ID())
+			t.recorder.Unlock()
+		}
+	}
+	return nil
+}
+
+func (t *recordingAgentTunnel) Recv() (*manager.ConnMessage, error) {
+	<-t.ctx.Done()
+	return nil, io.EOF
+}
+
+func (t *recordingAgentTunnel) CloseSend() error {
+	return nil
+}
+
+func (t *recordingAgentTunnel) Context() context.Context {
+	return t.ctx
+}
+
+func TestForwarder_MirrorAndIntercept(t *testing.T) {
+	ctx, cancel := context.WithCancel(dlog.NewTestContext(t, false))
+	defer cancel()
+	ctx = tunnel.WithPool(ctx, tunnel.NewPool())
+
+	f := NewForwarder(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, "127.0.0.1", 8080)
+	l, err := f.Listen(ctx)
+	require.NoError(t, err)
+	go func() {
+		_ = f.ServeListener(ctx, l)
+	}()
+
+	// A traffic-manager that uses the multiplexing tunnel, where all connections of the agent share one pool
+	mgr := &connectRecorder{}
+	f.SetManager(&manager.SessionInfo{SessionId: "agent-session"}, mgr, semver.MustParse("2.4.2"))
+
+	// A tcp intercept and a mirror intercept of the same client, on the same client port
+	cept := func(id string, mirror bool) *manager.InterceptInfo {
+		return &manager.InterceptInfo{
+			Id: id,
+			Spec: &manager.InterceptSpec{
+				Name:       id,
+				Client:     "user@host1",
+				Mechanism:  "tcp",
+				TargetHost: "127.0.0.1",
+				TargetPort: 9090,
+				Mirror:     mirror,
+			},
+			ClientSession: &manager.SessionInfo{SessionId: "client-session"},
+		}
+	}
+	f.SetIntercepting([]*manager.InterceptInfo{cept("intercept-01", false), cept("mirror-01", true)})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// Both the connection and its copy are tunneled, using different IDs
+	require.Eventually(t, func() bool {
+		return len(mgr.connected()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	ids := mgr.connected()
+	assert.NotEqual(t, ids[0], ids[1])
+	assert.Equal(t, 2, tunnel.GetPool(ctx).Len())
+	for _, id := range ids {
+		assert.Equal(t, uint16(9090), id.DestinationPort())
+	}
+}
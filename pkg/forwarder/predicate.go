@@ -0,0 +1,211 @@
+package forwarder
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Predicate determines what traffic an intercept will receive. Several intercepts can share the
+// same agent as long as their predicates differ. The zero Predicate matches all traffic.
+type Predicate struct {
+	// Sources limits the intercept to connections originating from one of the given subnets.
+	// Applies to all mechanisms.
+	Sources []*net.IPNet
+
+	// PathPrefix limits the intercept to requests with a URL path that starts with the given
+	// prefix. Only applies to the "http" mechanism.
+	PathPrefix string
+
+	// Headers limits the intercept to requests that match all the given headers. Only applies
+	// to the "http" mechanism.
+	Headers HeaderMatchers
+}
+
+// ParsePredicate parses the mechanism args of an intercept into a Predicate. The "tcp" mechanism
+// understands the --source flag and the "http" mechanism understands --source, --path-prefix, and
+// --match.
+func ParsePredicate(interceptID, mechanism string, args []string) (*Predicate, error) {
+	var sources, matches []string
+	var pathPrefix string
+	flags := pflag.NewFlagSet(mechanism, pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringArrayVar(&sources, "source", nil, "")
+	if mechanism == "http" {
+		flags.StringArrayVar(&matches, "match", nil, "")
+		flags.StringVar(&pathPrefix, "path-prefix", "", "")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected positional arguments %q", flags.Args())
+	}
+
+	p := &Predicate{PathPrefix: pathPrefix}
+	for _, s := range sources {
+		ipNet, err := parseSource(s)
+		if err != nil {
+			return nil, err
+		}
+		p.Sources = append(p.Sources, ipNet)
+	}
+	if pathPrefix != "" && !strings.HasPrefix(pathPrefix, "/") {
+		return nil, fmt.Errorf("invalid --path-prefix %q, must start with a '/'", pathPrefix)
+	}
+	for _, m := range matches {
+		switch m {
+		case "all":
+		case "auto":
+			p.Headers = append(p.Headers, &HeaderMatcher{
+				Name:  InterceptIDHeader,
+				Text:  interceptID,
+				Value: regexp.MustCompile("^" + regexp.QuoteMeta(interceptID) + "$"),
+			})
+		default:
+			eqIdx := strings.IndexByte(m, '=')
+			if eqIdx <= 0 {
+				return nil, fmt.Errorf(`invalid --match %q, must be on the form HEADER=REGEXP, "auto", or "all"`, m)
+			}
+			text := m[eqIdx+1:]
+			rx, err := regexp.Compile("^(?:" + text + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid --match %q: %w", m, err)
+			}
+			p.Headers = append(p.Headers, &HeaderMatcher{Name: m[:eqIdx], Text: text, Value: rx})
+		}
+	}
+	return p, nil
+}
+
+// parseSource parses an IP or a CIDR into an IPNet.
+func parseSource(s string) (*net.IPNet, error) {
+	if strings.IndexByte(s, '/') < 0 {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid --source %q, must be an IP address or a CIDR", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			bits = 8 * net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --source %q, must be an IP address or a CIDR", s)
+	}
+	return ipNet, nil
+}
+
+// MatchesSource returns true if the given IP is contained in one of the Sources, or if no
+// Sources are given.
+func (p *Predicate) MatchesSource(ip net.IP) bool {
+	if len(p.Sources) == 0 {
+		return true
+	}
+	for _, ipNet := range p.Sources {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesRequest returns true if the request matches both the PathPrefix and the Headers.
+func (p *Predicate) MatchesRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, p.PathPrefix) && p.Headers.Matches(req.Header)
+}
+
+// IsUnconditional returns true if the predicate will match all traffic that reaches the agent.
+func (p *Predicate) IsUnconditional() bool {
+	return len(p.Sources) == 0 && p.PathPrefix == "" && len(p.Headers) == 0
+}
+
+// SourcesOverlap returns true if a connection from some IP can match the Sources of both predicates.
+func (p *Predicate) SourcesOverlap(o *Predicate) bool {
+	if len(p.Sources) == 0 || len(o.Sources) == 0 {
+		return true
+	}
+	for _, s := range p.Sources {
+		for _, os := range o.Sources {
+			if s.Contains(os.IP) || os.Contains(s.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Equal returns true if the two predicates will select exactly the same traffic. The mechanism isn't
+// part of a predicate, so predicates of different mechanisms must not be compared using Equal.
+func (p *Predicate) Equal(o *Predicate) bool {
+	if p.PathPrefix != o.PathPrefix || len(p.Sources) != len(o.Sources) || len(p.Headers) != len(o.Headers) {
+		return false
+	}
+	for i, s := range p.Sources {
+		if s.String() != o.Sources[i].String() {
+			return false
+		}
+	}
+	for i, h := range p.Headers {
+		oh := o.Headers[i]
+		if !strings.EqualFold(h.Name, oh.Name) || h.Text != oh.Text {
+			return false
+		}
+	}
+	return true
+}
+
+// Description returns a human-friendly description of what the predicate selects from traffic of
+// the given protocols, "tcp" or "udp", which default to "tcp". It is suitable for use as the
+// MechanismArgsDesc of an intercept.
+func (p *Predicate) Description(mechanism string, protocols ...string) string {
+	sb := strings.Builder{}
+	if mechanism == "http" {
+		switch {
+		case p.PathPrefix != "" && len(p.Headers) > 0:
+			fmt.Fprintf(&sb, "HTTP requests with path prefix %q that match all of the headers:", p.PathPrefix)
+			p.Headers.writeTo(&sb)
+		case p.PathPrefix != "":
+			fmt.Fprintf(&sb, "HTTP requests with path prefix %q", p.PathPrefix)
+		default:
+			sb.WriteString(p.Headers.Description())
+		}
+	} else {
+		var tcp, udp bool
+		for _, proto := range protocols {
+			switch strings.ToLower(proto) {
+			case "udp":
+				udp = true
+			default:
+				tcp = true
+			}
+		}
+		switch {
+		case tcp && udp:
+			sb.WriteString("all TCP connections and UDP datagrams")
+		case udp:
+			sb.WriteString("all UDP datagrams")
+		default:
+			sb.WriteString("all TCP connections")
+		}
+	}
+	if len(p.Sources) > 0 {
+		ss := make([]string, len(p.Sources))
+		for i, s := range p.Sources {
+			ss[i] = s.String()
+		}
+		if mechanism == "http" {
+			sb.WriteString("\n ")
+		}
+		fmt.Fprintf(&sb, " from %s", strings.Join(ss, ", "))
+	}
+	return sb.String()
+}
@@ -0,0 +1,306 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+// udpSessionTTL controls how long a UDP session remains alive without receiving or sending any
+// datagrams.
+const udpSessionTTL = 1 * time.Minute
+
+// udpSessionBufferSize is the number of datagrams that a session can have in its buffer before
+// it starts dropping them.
+const udpSessionBufferSize = 100
+
+// NewUDPForwarder creates a Forwarder that listens for UDP datagrams on the given address. Datagrams
+// are grouped into sessions, one for each peer address, and each session is routed as a whole,
+// either to an intercepting client or to the target.
+func NewUDPForwarder(listen *net.UDPAddr, targetHost string, targetPort int32) *Forwarder {
+	return &Forwarder{
+		udpListenAddr: listen,
+		targetHost:    targetHost,
+		targetPort:    targetPort,
+	}
+}
+
+// Protocol returns the network protocol that this forwarder handles, i.e. "tcp" or "udp".
+func (f *Forwarder) Protocol() string {
+	if f.udpListenAddr != nil {
+		return "udp"
+	}
+	return "tcp"
+}
+
+func (f *Forwarder) serveUDP(ctx context.Context) error {
+	f.mu.Lock()
+
+	// Set up listener lifetime (same as the overall forwarder lifetime)
+	f.lCtx, f.lCancel = context.WithCancel(ctx)
+	f.lCtx = dlog.WithField(f.lCtx, "lis", "udp/"+f.udpListenAddr.String())
+	listenAddr := f.udpListenAddr
+
+	f.mu.Unlock()
+
+	conn, err := net.ListenUDP("udp", listenAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dlog.Debugf(ctx, "Forwarding UDP from %s", listenAddr)
+	defer dlog.Debugf(ctx, "Done forwarding UDP from %s", listenAddr)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	f.udpSessionsLock.Lock()
+	f.udpSessions = make(map[string]*udpSession)
+	f.udpSessionsLock.Unlock()
+	buf := make([]byte, 0x10000)
+	for {
+		n, peer, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			dlog.Infof(ctx, "Error on read: %+v", err)
+			continue
+		}
+
+		key := peer.String()
+		f.udpSessionsLock.Lock()
+		s, ok := f.udpSessions[key]
+		if !ok {
+			s = newUDPSession(conn, peer, func() {
+				f.udpSessionsLock.Lock()
+				if f.udpSessions[key] == s {
+					delete(f.udpSessions, key)
+				}
+				f.udpSessionsLock.Unlock()
+			})
+			f.udpSessions[key] = s
+		}
+		f.udpSessionsLock.Unlock()
+
+		if !ok {
+			if err = f.forwardUDPSession(s); err != nil {
+				dlog.Error(ctx, err)
+				s.Close()
+				continue
+			}
+		}
+		s.deliver(buf[:n])
+	}
+}
+
+// unlockedUDPRoute (1) assumes that f.mu is already locked, and (2) returns the first route that
+// selects the datagrams from the given peer, or nil if the datagrams go to the target.
+func (f *Forwarder) unlockedUDPRoute(peer net.IP) *route {
+	for _, r := range f.routes {
+		// Request level ("http") intercepts don't apply to datagrams
+		if r.intercept.Spec.Mechanism != "http" && r.predicate.MatchesSource(peer) {
+			return r
+		}
+	}
+	return nil
+}
+
+// unlockedRerouteUDPSessions (1) assumes that f.mu is already locked, and (2) closes the sessions
+// that are routed to the target although an intercept now selects their peer.
+func (f *Forwarder) unlockedRerouteUDPSessions() {
+	var reroute []*udpSession
+	f.udpSessionsLock.Lock()
+	for _, s := range f.udpSessions {
+		if s.toTarget && f.unlockedUDPRoute(s.peer.IP) != nil {
+			reroute = append(reroute, s)
+		}
+	}
+	f.udpSessionsLock.Unlock()
+	for _, s := range reroute {
+		dlog.Debugf(f.lCtx, "Rerouting UDP session from %s", s.peer)
+		s.Close()
+	}
+}
+
+// forwardUDPSession routes the given session to the first intercept that selects its peer, or to
+// the target when no such intercept exists.
+func (f *Forwarder) forwardUDPSession(s *udpSession) error {
+	f.mu.Lock()
+	ctx := f.lCtx
+	targetHost := f.targetHost
+	targetPort := f.targetPort
+	r := f.unlockedUDPRoute(s.peer.IP)
+	s.toTarget = r == nil
+	f.mu.Unlock()
+
+	if r != nil {
+		atomic.AddUint64(&f.interceptConns, 1)
+		go func() {
+			select {
+			case <-r.ctx.Done():
+				s.Close()
+			case <-s.done:
+			}
+		}()
+		go func() {
+			if err := f.interceptConn(r.ctx, s, s.RemoteAddr(), r); err != nil {
+				dlog.Error(r.ctx, err)
+				s.Close()
+			}
+		}()
+		return nil
+	}
+
+	targetAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", targetHost, targetPort))
+	if err != nil {
+		return fmt.Errorf("error on resolve(%s:%d): %w", targetHost, targetPort, err)
+	}
+	targetConn, err := net.DialUDP("udp", nil, targetAddr)
+	if err != nil {
+		return fmt.Errorf("error on dial: %w", err)
+	}
+	atomic.AddUint64(&f.targetConns, 1)
+
+	ctx = dlog.WithField(ctx, "client", s.peer.String())
+	ctx = dlog.WithField(ctx, "target", targetAddr.String())
+	dlog.Debug(ctx, "Forwarding UDP...")
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+		_ = targetConn.Close()
+		dlog.Debug(ctx, "Done forwarding UDP")
+	}()
+	go func() {
+		buf := make([]byte, 0x10000)
+		for {
+			n, err := s.Read(buf)
+			if err != nil {
+				return
+			}
+			if _, err = targetConn.Write(buf[:n]); err != nil {
+				dlog.Debugf(ctx, "Error client->target: %+v", err)
+				s.Close()
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 0x10000)
+		for {
+			n, err := targetConn.Read(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					dlog.Debugf(ctx, "Error target->client: %+v", err)
+				}
+				s.Close()
+				return
+			}
+			if _, err = s.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// udpSession is a net.Conn that represents the datagrams exchanged with one peer of a UDP listener.
+// Each Read returns one datagram received from the peer, and each Write sends one datagram to the
+// peer. The session closes itself when it has been idle for udpSessionTTL.
+type udpSession struct {
+	lConn     *net.UDPConn
+	peer      *net.UDPAddr
+	toTarget  bool // set when the session is routed to the target. Protected by the forwarder's mu
+	incoming  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	idleTimer *time.Timer
+	onClose   func()
+}
+
+func newUDPSession(lConn *net.UDPConn, peer *net.UDPAddr, onClose func()) *udpSession {
+	s := &udpSession{
+		lConn:    lConn,
+		peer:     peer,
+		incoming: make(chan []byte, udpSessionBufferSize),
+		done:     make(chan struct{}),
+		onClose:  onClose,
+	}
+	s.idleTimer = time.AfterFunc(udpSessionTTL, func() { s.Close() })
+	return s
+}
+
+// deliver adds a copy of the given datagram to the session's buffer. The datagram is dropped if
+// the buffer is full.
+func (s *udpSession) deliver(data []byte) {
+	dg := make([]byte, len(data))
+	copy(dg, data)
+	select {
+	case <-s.done:
+	case s.incoming <- dg:
+		s.idleTimer.Reset(udpSessionTTL)
+	default:
+	}
+}
+
+func (s *udpSession) Read(b []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, io.EOF
+	case dg := <-s.incoming:
+		return copy(b, dg), nil
+	}
+}
+
+func (s *udpSession) Write(b []byte) (int, error) {
+	select {
+	case <-s.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	s.idleTimer.Reset(udpSessionTTL)
+	return s.lConn.WriteToUDP(b, s.peer)
+}
+
+func (s *udpSession) Close() error {
+	s.closeOnce.Do(func() {
+		s.idleTimer.Stop()
+		close(s.done)
+		s.onClose()
+	})
+	return nil
+}
+
+func (s *udpSession) LocalAddr() net.Addr {
+	return s.lConn.LocalAddr()
+}
+
+func (s *udpSession) RemoteAddr() net.Addr {
+	return s.peer
+}
+
+func (s *udpSession) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (s *udpSession) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (s *udpSession) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,224 @@
+package forwarder_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/forwarder"
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// udpEcho starts a UDP server that echoes all datagrams and returns its port.
+func udpEcho(ctx context.Context, t *testing.T) int32 {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go func() {
+		buf := make([]byte, 0x10000)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return int32(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// freeUDPAddr returns a loopback address with a port that is currently unused.
+func freeUDPAddr(t *testing.T) *net.UDPAddr {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	addr := conn.LocalAddr().(*net.UDPAddr)
+	require.NoError(t, conn.Close())
+	return addr
+}
+
+// udpInterceptor is a manager.ManagerClient whose agent tunnels play the part of an intercepting
+// client. The client accepts all connections and answers each datagram with the datagram prefixed
+// by "intercepted ".
+type udpInterceptor struct {
+	manager.ManagerClient
+	sync.Mutex
+	connects []tunnel.ConnID
+	received []string
+}
+
+func (m *udpInterceptor) AgentTunnel(ctx context.Context, _ ...grpc.CallOption) (manager.Manager_AgentTunnelClient, error) {
+	return &interceptorTunnel{ctx: ctx, interceptor: m, replies: make(chan *manager.ConnMessage, 10)}, nil
+}
+
+func (m *udpInterceptor) connected() []tunnel.ConnID {
+	m.Lock()
+	defer m.Unlock()
+	return append([]tunnel.ConnID(nil), m.connects...)
+}
+
+func (m *udpInterceptor) datagrams() []string {
+	m.Lock()
+	defer m.Unlock()
+	return append([]string(nil), m.received...)
+}
+
+type interceptorTunnel struct {
+	grpc.ClientStream
+	ctx         context.Context
+	interceptor *udpInterceptor
+	replies     chan *manager.ConnMessage
+}
+
+func (t *interceptorTunnel) Send(cm *manager.ConnMessage) error {
+	var reply connpool.Message
+	msg := connpool.FromConnMessage(cm)
+	m := t.interceptor
+	m.Lock()
+	if ctrl, ok := msg.(connpool.Control); ok {
+		if ctrl.Code() == connpool.Connect {
+			m.connects = append(m.connects, ctrl.ID())
+			reply = connpool.NewControl(ctrl.ID(), connpool.ConnectOK, nil)
+		}
+	} else {
+		m.received = append(m.received, string(msg.Payload()))
+		reply = connpool.NewMessage(msg.ID(), append([]byte("intercepted "), msg.Payload()...))
+	}
+	m.Unlock()
+	if reply != nil {
+		select {
+		case <-t.ctx.Done():
+		case t.replies <- reply.TunnelMessage():
+		}
+	}
+	return nil
+}
+
+func (t *interceptorTunnel) Recv() (*manager.ConnMessage, error) {
+	select {
+	case <-t.ctx.Done():
+		return nil, t.ctx.Err()
+	case cm := <-t.replies:
+		return cm, nil
+	}
+}
+
+func (t *interceptorTunnel) CloseSend() error {
+	return nil
+}
+
+func (t *interceptorTunnel) Context() context.Context {
+	return t.ctx
+}
+
+// exchange sends the given message from the peer and returns the reply, or an empty string when
+// no reply arrives in time.
+func exchange(t *testing.T, peer *net.UDPConn, msg string) string {
+	_, err := peer.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, 100)
+	_ = peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := peer.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestUDPForwarder(t *testing.T) {
+	// The sessions log after the test has ended, so a test logger can't be used.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = tunnel.WithPool(ctx, tunnel.NewPool())
+
+	lAddr := freeUDPAddr(t)
+	f := forwarder.NewUDPForwarder(lAddr, "127.0.0.1", udpEcho(ctx, t))
+	assert.Equal(t, "udp", f.Protocol())
+	go func() {
+		_ = f.Serve(ctx)
+	}()
+
+	// Each peer gets its own session, and replies are routed back to the peer that sent the datagram.
+	var peers []*net.UDPConn
+	for i := 0; i < 2; i++ {
+		conn, err := net.DialUDP("udp", nil, lAddr)
+		require.NoError(t, err)
+		defer conn.Close()
+		peers = append(peers, conn)
+	}
+
+	buf := make([]byte, 100)
+	for i, conn := range peers {
+		msg := []byte{'p', 'e', 'e', 'r', '0' + byte(i)}
+		require.Eventually(t, func() bool {
+			if _, err := conn.Write(msg); err != nil {
+				return false
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := conn.Read(buf)
+			return err == nil && string(buf[:n]) == string(msg)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	target, intercepted := f.Connections()
+	assert.Equal(t, uint64(2), target)
+	assert.Zero(t, intercepted)
+
+	// An intercept takes over the existing session of a peer that it selects, using the multiplexing
+	// tunnel of a traffic-manager
+	mgr := &udpInterceptor{}
+	f.SetManager(&manager.SessionInfo{SessionId: "agent-session"}, mgr, semver.MustParse("2.4.2"))
+	f.SetIntercepting([]*manager.InterceptInfo{{
+		Id: "intercept-01",
+		Spec: &manager.InterceptSpec{
+			Name:       "intercept-01",
+			Client:     "user@host1",
+			Mechanism:  "tcp",
+			TargetHost: "127.0.0.1",
+			TargetPort: 9090,
+		},
+		ClientSession: &manager.SessionInfo{SessionId: "client-session"},
+	}})
+	peer := peers[0]
+	require.Eventually(t, func() bool {
+		return exchange(t, peer, "one") == "intercepted one"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Later datagrams of the session go to the intercept as well, using the same connection
+	assert.Equal(t, "intercepted two", exchange(t, peer, "two"))
+	assert.Equal(t, "intercepted three", exchange(t, peer, "three"))
+	ids := mgr.connected()
+	require.Len(t, ids, 1)
+	assert.Equal(t, ipproto.UDP, ids[0].Protocol())
+	assert.Equal(t, uint16(peer.LocalAddr().(*net.UDPAddr).Port), ids[0].SourcePort())
+	assert.Equal(t, uint16(9090), ids[0].DestinationPort())
+	assert.Subset(t, mgr.datagrams(), []string{"one", "two", "three"})
+	target, intercepted = f.Connections()
+	assert.Equal(t, uint64(2), target)
+	assert.Equal(t, uint64(1), intercepted)
+
+	// Removing the intercept tears down its session, so the next datagram starts a session that
+	// is routed to the target
+	f.SetIntercepting(nil)
+	require.Eventually(t, func() bool {
+		return exchange(t, peer, "four") == "four"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "five", exchange(t, peer, "five"))
+	assert.NotContains(t, mgr.datagrams(), "five")
+	assert.Len(t, mgr.connected(), 1)
+	target, intercepted = f.Connections()
+	assert.Equal(t, uint64(3), target)
+	assert.Equal(t, uint64(1), intercepted)
+}
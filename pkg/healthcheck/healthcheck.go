@@ -0,0 +1,131 @@
+// Package healthcheck implements the checks that tell if the local process that handles an
+// intercept is healthy.
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datawire/dlib/dtime"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+// The types of health check.
+const (
+	TypeTCP  = "tcp"
+	TypeHTTP = "http"
+)
+
+const (
+	defaultInterval         = time.Second
+	defaultFailureThreshold = 3
+)
+
+// Validate checks that the given health check is well-formed.
+func Validate(hc *manager.HealthCheck) error {
+	switch hc.Type {
+	case "", TypeTCP:
+		if hc.Path != "" {
+			return fmt.Errorf("a path can only be used with a health check of type %s", TypeHTTP)
+		}
+	case TypeHTTP:
+	default:
+		return fmt.Errorf("the type of a health check must be %q or %q", TypeTCP, TypeHTTP)
+	}
+	if hc.Port < 0 || hc.Port > 0xffff {
+		return fmt.Errorf("invalid health check port %d", hc.Port)
+	}
+	if hc.Interval != nil && hc.Interval.AsDuration() <= 0 {
+		return fmt.Errorf("the interval of a health check must be positive")
+	}
+	if hc.FailureThreshold < 0 {
+		return fmt.Errorf("the failure threshold of a health check cannot be negative")
+	}
+	return nil
+}
+
+// Interval returns the time between two checks of the given health check.
+func Interval(hc *manager.HealthCheck) time.Duration {
+	if hc.Interval != nil {
+		if d := hc.Interval.AsDuration(); d > 0 {
+			return d
+		}
+	}
+	return defaultInterval
+}
+
+// FailureThreshold returns the number of consecutive failed checks after which the local process
+// is considered unhealthy.
+func FailureThreshold(hc *manager.HealthCheck) int {
+	if hc.FailureThreshold > 0 {
+		return int(hc.FailureThreshold)
+	}
+	return defaultFailureThreshold
+}
+
+// Check performs one check of the process that listens to the port of the health check on the
+// given host. The check fails unless it succeeds within the interval of the health check.
+func Check(ctx context.Context, hc *manager.HealthCheck, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, Interval(hc))
+	defer cancel()
+	addr := net.JoinHostPort(host, strconv.Itoa(int(hc.Port)))
+	if hc.Type != TypeHTTP {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	path := hc.Path
+	if path == "" {
+		path = "/"
+	}
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		return err
+	}
+	rs, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	rs.Body.Close()
+	if rs.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("GET %s returned %s", path, rs.Status)
+	}
+	return nil
+}
+
+// Monitor checks the given health check at its interval until the context is cancelled. The
+// process is initially assumed to be healthy. The report function is called when the process
+// becomes unhealthy, i.e. after FailureThreshold consecutive failed checks, and when it becomes
+// healthy again after a successful check.
+func Monitor(ctx context.Context, hc *manager.HealthCheck, host string, report func(healthy bool, err error)) {
+	interval := Interval(hc)
+	threshold := FailureThreshold(hc)
+	healthy := true
+	failures := 0
+	for ctx.Err() == nil {
+		err := Check(ctx, hc, host)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			if !healthy {
+				healthy = true
+				report(true, nil)
+			}
+		} else {
+			failures++
+			if healthy && failures >= threshold {
+				healthy = false
+				report(false, err)
+			}
+		}
+		dtime.SleepWithContext(ctx, interval)
+	}
+}
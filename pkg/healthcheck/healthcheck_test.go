@@ -0,0 +1,87 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+)
+
+func serverPort(t *testing.T, addr string) int32 {
+	_, ps, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(ps)
+	require.NoError(t, err)
+	return int32(port)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(&manager.HealthCheck{}))
+	assert.NoError(t, Validate(&manager.HealthCheck{Type: TypeHTTP, Path: "/healthz"}))
+	assert.Error(t, Validate(&manager.HealthCheck{Type: "udp"}))
+	assert.Error(t, Validate(&manager.HealthCheck{Type: TypeTCP, Path: "/healthz"}))
+	assert.Error(t, Validate(&manager.HealthCheck{Interval: durationpb.New(0)}))
+	assert.Error(t, Validate(&manager.HealthCheck{FailureThreshold: -1}))
+}
+
+func TestCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	port := serverPort(t, srv.Listener.Addr().String())
+	ctx := context.Background()
+
+	assert.NoError(t, Check(ctx, &manager.HealthCheck{Port: port}, "127.0.0.1"))
+
+	hc := &manager.HealthCheck{Type: TypeHTTP, Path: "/healthz", Port: port}
+	assert.NoError(t, Check(ctx, hc, "127.0.0.1"))
+	status = http.StatusServiceUnavailable
+	assert.Error(t, Check(ctx, hc, "127.0.0.1"))
+
+	srv.Close()
+	assert.Error(t, Check(ctx, &manager.HealthCheck{Port: port}, "127.0.0.1"))
+}
+
+func TestMonitor(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := serverPort(t, l.Addr().String())
+	hc := &manager.HealthCheck{Port: port, Interval: durationpb.New(10 * time.Millisecond), FailureThreshold: 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := make(chan bool, 10)
+	go Monitor(ctx, hc, "127.0.0.1", func(healthy bool, _ error) {
+		reports <- healthy
+	})
+
+	require.NoError(t, l.Close())
+	select {
+	case healthy := <-reports:
+		assert.False(t, healthy)
+	case <-time.After(5 * time.Second):
+		t.Fatal("unhealthy process wasn't reported")
+	}
+
+	l, err = net.Listen("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer l.Close()
+	select {
+	case healthy := <-reports:
+		assert.True(t, healthy)
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovered process wasn't reported")
+	}
+}
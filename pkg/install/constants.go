@@ -3,6 +3,7 @@ package install
 const (
 	AgentContainerName        = "traffic-agent"
 	AgentAnnotationVolumeName = "traffic-annotations"
+	AgentMetricsPortName      = "tel-metrics"
 	AgentInjectorName         = "agent-injector"
 	DomainPrefix              = "telepresence.getambassador.io/"
 	InjectAnnotation          = DomainPrefix + "inject-" + AgentContainerName
@@ -10,6 +11,7 @@ const (
 	ServiceNameAnnotation     = DomainPrefix + "inject-service-name"
 	ManualInjectAnnotation    = DomainPrefix + "manually-injected"
 	ManagerAppName            = "traffic-manager"
+	AgentSessionIDMetadata    = "x-telepresence-agent-session-id"
 	ManagerPortHTTP           = 8081
 	MutatorWebhookPortHTTPS   = 8443
 	MutatorWebhookTLSName     = "mutator-webhook-tls"
@@ -1,9 +1,11 @@
 package install
 
 import (
+	"fmt"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -14,13 +16,72 @@ const EnvPrefix = "_TEL_AGENT_"
 const InitContainerName = "tel-agent-init"
 const AgentUID = int64(7777)
 
-// AgentContainer will return a configured traffic agent
+// PortMapping maps a port that the traffic-agent listens to onto the port of the app container
+// that the agent forwards to when the port isn't intercepted.
+type PortMapping struct {
+	AgentPort corev1.ContainerPort
+	AppPort   int
+}
+
+// FormatPortMappings formats the given mappings as a comma separated list of
+// <agent port>:<app port>[/<protocol>] entries, where the protocol is omitted for TCP. The result is
+// parsed by ParsePortMappings.
+func FormatPortMappings(pms []PortMapping) string {
+	ps := make([]string, len(pms))
+	for i, pm := range pms {
+		ps[i] = fmt.Sprintf("%d:%d", pm.AgentPort.ContainerPort, pm.AppPort)
+		if p := pm.AgentPort.Protocol; p != "" && p != corev1.ProtocolTCP {
+			ps[i] += "/" + string(p)
+		}
+	}
+	return strings.Join(ps, ",")
+}
+
+// ParsePortMappings parses a comma separated list of <agent port>:<app port>[/<protocol>] entries.
+func ParsePortMappings(s string) ([]PortMapping, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ps := strings.Split(s, ",")
+	pms := make([]PortMapping, len(ps))
+	for i, p := range ps {
+		proto := corev1.ProtocolTCP
+		if slash := strings.IndexByte(p, '/'); slash >= 0 {
+			proto = corev1.Protocol(strings.ToUpper(p[slash+1:]))
+			if proto != corev1.ProtocolTCP && proto != corev1.ProtocolUDP {
+				return nil, fmt.Errorf("invalid protocol in port mapping %q, must be TCP or UDP", p)
+			}
+			p = p[:slash]
+		}
+		colon := strings.IndexByte(p, ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid port mapping %q, must be on the form <agent port>:<app port>[/<protocol>]", p)
+		}
+		agentPort, err := strconv.ParseUint(p[:colon], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent port in port mapping %q: %w", p, err)
+		}
+		appPort, err := strconv.ParseUint(p[colon+1:], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid app port in port mapping %q: %w", p, err)
+		}
+		pms[i] = PortMapping{
+			AgentPort: corev1.ContainerPort{ContainerPort: int32(agentPort), Protocol: proto},
+			AppPort:   int(appPort),
+		}
+	}
+	return pms, nil
+}
+
+// AgentContainer will return a configured traffic agent. The agent will listen to the given port
+// and forward to the appPort, and then do the same for each of the extraPorts.
 func AgentContainer(
 	name string,
 	imageName string,
 	appContainer *corev1.Container,
 	port corev1.ContainerPort,
 	appPort int,
+	extraPorts []PortMapping,
 	managerNamespace string,
 	setGID bool,
 ) corev1.Container {
@@ -32,12 +93,17 @@ func AgentContainer(
 			RunAsUser:    func() *int64 { i := AgentUID; return &i }(),
 		}
 	}
+	ports := make([]corev1.ContainerPort, 0, 1+len(extraPorts))
+	ports = append(ports, port)
+	for _, pm := range extraPorts {
+		ports = append(ports, pm.AgentPort)
+	}
 	return corev1.Container{
 		Name:            AgentContainerName,
 		Image:           imageName,
 		Args:            []string{"agent"},
-		Ports:           []corev1.ContainerPort{port},
-		Env:             agentEnvironment(name, appContainer, appPort, managerNamespace, port),
+		Ports:           ports,
+		Env:             agentEnvironment(name, appContainer, appPort, extraPorts, managerNamespace, port),
 		EnvFrom:         appContainer.EnvFrom,
 		VolumeMounts:    agentVolumeMounts(appContainer.VolumeMounts),
 		SecurityContext: securityContext,
@@ -51,8 +117,41 @@ func AgentContainer(
 	}
 }
 
-// InitContainer will return a configured init container for an agent.
-func InitContainer(imageName string, port corev1.ContainerPort, appPort int) corev1.Container {
+// EnableAgentMetrics makes the given traffic agent container serve Prometheus metrics on the
+// given port, and declares that port as a container port named AgentMetricsPortName.
+func EnableAgentMetrics(agentContainer *corev1.Container, port int32) {
+	agentContainer.Ports = append(agentContainer.Ports, corev1.ContainerPort{
+		Name:          AgentMetricsPortName,
+		ContainerPort: port,
+		Protocol:      corev1.ProtocolTCP,
+	})
+	agentContainer.Env = append(agentContainer.Env, corev1.EnvVar{
+		Name:  EnvPrefix + "METRICS_PORT",
+		Value: strconv.Itoa(int(port)),
+	})
+}
+
+// SetAgentHTTPSniffTimeout sets how long the given traffic agent container waits for the first bytes
+// of a connection when it determines if the connection carries HTTP.
+func SetAgentHTTPSniffTimeout(agentContainer *corev1.Container, timeout time.Duration) {
+	agentContainer.Env = append(agentContainer.Env, corev1.EnvVar{
+		Name:  EnvPrefix + "HTTP_SNIFF_TIMEOUT",
+		Value: timeout.String(),
+	})
+}
+
+// EnableAgentTracing makes the given traffic agent container export its trace spans to the
+// OTLP/HTTP collector at the given endpoint.
+func EnableAgentTracing(agentContainer *corev1.Container, endpoint string) {
+	agentContainer.Env = append(agentContainer.Env, corev1.EnvVar{
+		Name:  EnvPrefix + "OTLP_ENDPOINT",
+		Value: endpoint,
+	})
+}
+
+// InitContainer will return a configured init container for an agent. The init container redirects
+// the appPort to the port of the agent, and then does the same for each of the extraPorts.
+func InitContainer(imageName string, port corev1.ContainerPort, appPort int, extraPorts []PortMapping) corev1.Container {
 	env := []corev1.EnvVar{
 		{
 			Name:  "APP_PORT",
@@ -67,6 +166,12 @@ func InitContainer(imageName string, port corev1.ContainerPort, appPort int) cor
 			Value: string(port.Protocol),
 		},
 	}
+	if len(extraPorts) > 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  "EXTRA_PORTS",
+			Value: FormatPortMappings(extraPorts),
+		})
+	}
 	return corev1.Container{
 		Name:  InitContainerName,
 		Image: imageName,
@@ -82,7 +187,7 @@ func InitContainer(imageName string, port corev1.ContainerPort, appPort int) cor
 	}
 }
 
-func agentEnvironment(agentName string, appContainer *kates.Container, appPort int, managerNamespace string, port corev1.ContainerPort) []corev1.EnvVar {
+func agentEnvironment(agentName string, appContainer *kates.Container, appPort int, extraPorts []PortMapping, managerNamespace string, port corev1.ContainerPort) []corev1.EnvVar {
 	appEnv := appEnvironment(appContainer)
 	env := make([]corev1.EnvVar, len(appEnv), len(appEnv)+7)
 	copy(env, appEnv)
@@ -120,6 +225,19 @@ func agentEnvironment(agentName string, appContainer *kates.Container, appPort i
 			Value: strconv.Itoa(int(port.ContainerPort)),
 		},
 	)
+	if port.Protocol == corev1.ProtocolUDP {
+		// TCP is the default, so the protocol is only declared when it differs.
+		env = append(env, corev1.EnvVar{
+			Name:  EnvPrefix + "PROTOCOL",
+			Value: string(port.Protocol),
+		})
+	}
+	if len(extraPorts) > 0 {
+		env = append(env, corev1.EnvVar{
+			Name:  EnvPrefix + "EXTRA_PORTS",
+			Value: FormatPortMappings(extraPorts),
+		})
+	}
 	if len(appContainer.VolumeMounts) > 0 {
 		env = append(env, corev1.EnvVar{
 			Name:  EnvPrefix + "APP_MOUNTS",
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/go-multierror"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/datawire/ambassador/v2/pkg/kates"
@@ -19,6 +20,15 @@ func GetPodTemplateFromObject(obj kates.Object) (*kates.PodTemplateSpec, error)
 		tplSpec = &obj.Spec.Template
 	case *kates.StatefulSet:
 		tplSpec = &obj.Spec.Template
+	case *appsv1.DaemonSet:
+		tplSpec = &obj.Spec.Template
+	case *Rollout:
+		tplSpec = &obj.Spec.Template
+	case *BarePod:
+		// The metadata of the template is the metadata of the pod
+		obj.Spec.Template.Labels = obj.Labels
+		obj.Spec.Template.Annotations = obj.Annotations
+		tplSpec = &obj.Spec.Template
 	default:
 		return nil, ObjErrorf(obj, "unsupported workload kind %q", obj.GetObjectKind().GroupVersionKind().Kind)
 	}
@@ -0,0 +1,174 @@
+package install
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/datawire/ambassador/v2/pkg/kates"
+)
+
+// Rollout is an Argo Rollout. Only the parts of the spec and status that Telepresence inspects or
+// modifies are typed. All other fields of the spec are retained as-is, so that an update of the
+// rollout doesn't drop them.
+type Rollout struct {
+	kates.TypeMeta   `json:",inline"`
+	kates.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RolloutSpec   `json:"spec"`
+	Status RolloutStatus `json:"status,omitempty"`
+}
+
+// RolloutSpec is the spec of an Argo Rollout.
+type RolloutSpec struct {
+	Replicas *int32
+	Template kates.PodTemplateSpec
+
+	// other contains all fields of the spec except replicas and template
+	other map[string]interface{}
+}
+
+// RolloutStatus is the status of an Argo Rollout.
+type RolloutStatus struct {
+	// ObservedGeneration is a string in Argo Rollouts
+	ObservedGeneration string `json:"observedGeneration,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	Replicas           int32  `json:"replicas,omitempty"`
+	UpdatedReplicas    int32  `json:"updatedReplicas,omitempty"`
+	AvailableReplicas  int32  `json:"availableReplicas,omitempty"`
+}
+
+func (s RolloutSpec) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(s.other)+2)
+	for k, v := range s.other {
+		m[k] = v
+	}
+	if s.Replicas != nil {
+		m["replicas"] = *s.Replicas
+	}
+	m["template"] = &s.Template
+	return json.Marshal(m)
+}
+
+func (s *RolloutSpec) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*s = RolloutSpec{}
+	if r, ok := m["replicas"]; ok {
+		if err := json.Unmarshal(r, &s.Replicas); err != nil {
+			return err
+		}
+		delete(m, "replicas")
+	}
+	if t, ok := m["template"]; ok {
+		if err := json.Unmarshal(t, &s.Template); err != nil {
+			return err
+		}
+		delete(m, "template")
+	}
+	if len(m) > 0 {
+		s.other = make(map[string]interface{}, len(m))
+		for k, r := range m {
+			var v interface{}
+			if err := json.Unmarshal(r, &v); err != nil {
+				return err
+			}
+			s.other[k] = v
+		}
+	}
+	return nil
+}
+
+func (ro *Rollout) DeepCopy() *Rollout {
+	if ro == nil {
+		return nil
+	}
+	out := &Rollout{
+		TypeMeta: ro.TypeMeta,
+		Spec: RolloutSpec{
+			Template: *ro.Spec.Template.DeepCopy(),
+		},
+		Status: ro.Status,
+	}
+	ro.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if ro.Spec.Replicas != nil {
+		replicas := *ro.Spec.Replicas
+		out.Spec.Replicas = &replicas
+	}
+	if ro.Spec.other != nil {
+		out.Spec.other = runtime.DeepCopyJSON(ro.Spec.other)
+	}
+	return out
+}
+
+func (ro *Rollout) DeepCopyObject() runtime.Object {
+	return ro.DeepCopy()
+}
+
+// BarePod is a Pod that isn't owned by another workload. It's represented as a workload whose pod
+// template is the pod itself, so that it can be modified in the same way as the pod templates of
+// other workloads. The metadata of the template is the metadata of the pod. A BarePod is encoded
+// as a Pod.
+type BarePod struct {
+	kates.TypeMeta
+	kates.ObjectMeta
+
+	Spec   BarePodSpec
+	Status corev1.PodStatus
+}
+
+// BarePodSpec is the spec of a BarePod.
+type BarePodSpec struct {
+	Template kates.PodTemplateSpec
+}
+
+// Pod returns the Pod that the BarePod represents.
+func (bp *BarePod) Pod() *kates.Pod {
+	pod := &kates.Pod{
+		TypeMeta: bp.TypeMeta,
+		Spec:     *bp.Spec.Template.Spec.DeepCopy(),
+		Status:   *bp.Status.DeepCopy(),
+	}
+	bp.ObjectMeta.DeepCopyInto(&pod.ObjectMeta)
+	return pod
+}
+
+// NewBarePod returns the BarePod that represents the given Pod.
+func NewBarePod(pod *kates.Pod) *BarePod {
+	bp := &BarePod{
+		TypeMeta: pod.TypeMeta,
+		Status:   *pod.Status.DeepCopy(),
+	}
+	pod.ObjectMeta.DeepCopyInto(&bp.ObjectMeta)
+	bp.Spec.Template.Labels = bp.Labels
+	bp.Spec.Template.Annotations = bp.Annotations
+	pod.Spec.DeepCopyInto(&bp.Spec.Template.Spec)
+	return bp
+}
+
+func (bp *BarePod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bp.Pod())
+}
+
+func (bp *BarePod) UnmarshalJSON(data []byte) error {
+	var pod kates.Pod
+	if err := json.Unmarshal(data, &pod); err != nil {
+		return err
+	}
+	*bp = *NewBarePod(&pod)
+	return nil
+}
+
+func (bp *BarePod) DeepCopy() *BarePod {
+	if bp == nil {
+		return nil
+	}
+	return NewBarePod(bp.Pod())
+}
+
+func (bp *BarePod) DeepCopyObject() runtime.Object {
+	return bp.DeepCopy()
+}
@@ -0,0 +1,103 @@
+// Package metrics contains the parts that the traffic-manager and the traffic-agent share when
+// exposing Prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/datawire/dlib/dhttp"
+	"github.com/telepresenceio/telepresence/rpc/v2/manager"
+	"github.com/telepresenceio/telepresence/v2/pkg/connpool"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// Namespace is the namespace of all metrics exposed by Telepresence
+const Namespace = "telepresence"
+
+// Path is the HTTP path that serves the metrics
+const Path = "/metrics"
+
+// NewRegistry returns a registry that contains the standard Go runtime and process collectors.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// Handler returns a http.Handler that serves the metrics of the given gatherer.
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics of the given gatherer on the given address until the context is cancelled.
+func Serve(ctx context.Context, addr string, g prometheus.Gatherer) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, Handler(g))
+	sc := &dhttp.ServerConfig{Handler: mux}
+	return sc.ListenAndServe(ctx, addr)
+}
+
+// countingStream is a connpool.BidiStream that counts the payload bytes that it sends and receives.
+type countingStream struct {
+	connpool.BidiStream
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+// CountingStream returns a connpool.BidiStream that adds the size of the payload of each message
+// that it sends and receives to the given counters.
+func CountingStream(stream connpool.BidiStream, sent, received prometheus.Counter) connpool.BidiStream {
+	return &countingStream{BidiStream: stream, sent: sent, received: received}
+}
+
+func (s *countingStream) Send(msg *manager.ConnMessage) error {
+	err := s.BidiStream.Send(msg)
+	if err == nil {
+		s.sent.Add(float64(len(msg.Payload)))
+	}
+	return err
+}
+
+func (s *countingStream) Recv() (*manager.ConnMessage, error) {
+	msg, err := s.BidiStream.Recv()
+	if err == nil {
+		s.received.Add(float64(len(msg.Payload)))
+	}
+	return msg, err
+}
+
+// countingTunnelStream is a tunnel.Stream that counts the payload bytes that it sends and receives.
+type countingTunnelStream struct {
+	tunnel.Stream
+	sent     prometheus.Counter
+	received prometheus.Counter
+}
+
+// CountingTunnelStream returns a tunnel.Stream that adds the size of the payload of each data
+// message that it sends and receives to the given counters.
+func CountingTunnelStream(stream tunnel.Stream, sent, received prometheus.Counter) tunnel.Stream {
+	return &countingTunnelStream{Stream: stream, sent: sent, received: received}
+}
+
+func (s *countingTunnelStream) Send(ctx context.Context, msg tunnel.Message) error {
+	err := s.Stream.Send(ctx, msg)
+	if err == nil && msg.Code() == tunnel.Normal {
+		s.sent.Add(float64(len(msg.Payload())))
+	}
+	return err
+}
+
+func (s *countingTunnelStream) Receive(ctx context.Context) (tunnel.Message, error) {
+	msg, err := s.Stream.Receive(ctx)
+	if err == nil && msg.Code() == tunnel.Normal {
+		s.received.Add(float64(len(msg.Payload())))
+	}
+	return msg, err
+}
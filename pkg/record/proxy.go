@@ -0,0 +1,173 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// sourceLookupTimeout is how long the proxy waits for the tunnel dialer that connected to it to
+// register the original peer of the connection.
+const sourceLookupTimeout = 100 * time.Millisecond
+
+// Proxy is a TCP proxy that records all traffic that passes through it.
+type Proxy struct {
+	listener net.Listener
+	target   string
+	port     string
+	w        *Writer
+}
+
+// NewProxy creates a Proxy that listens to a random port on localhost and forwards all connections
+// to the given target address while recording them using the given Writer. The port is the service
+// port identifier of the intercepted port.
+func NewProxy(w *Writer, target, port string) (*Proxy, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{listener: l, target: target, port: port, w: w}, nil
+}
+
+// Port returns the port that the Proxy listens to.
+func (p *Proxy) Port() int32 {
+	return int32(p.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// Serve accepts connections until the given context is cancelled.
+func (p *Proxy) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		p.listener.Close()
+	}()
+	dlog.Infof(ctx, "Recording traffic to %s using proxy port %d", p.target, p.Port())
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go p.handleConn(ctx, conn)
+	}
+}
+
+func (p *Proxy) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	id := p.w.NextConn()
+	p.write(ctx, &Event{Time: time.Now(), Conn: id, Type: EventOpen, Target: p.target, Source: p.source(conn), Port: p.port})
+
+	d := net.Dialer{}
+	tc, err := d.DialContext(ctx, "tcp", p.target)
+	if err != nil {
+		dlog.Errorf(ctx, "recording proxy failed to dial %s: %v", p.target, err)
+		p.write(ctx, &Event{Conn: id, Type: EventClose, Error: err.Error()})
+		return
+	}
+	defer tc.Close()
+
+	// The inbound data is also fed to an HTTP parser, so that the requests can be recorded.
+	pr, pw := io.Pipe()
+	go p.parseHTTP(ctx, id, pr)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.copy(ctx, id, Inbound, tc, conn, pw)
+		_ = pw.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		p.copy(ctx, id, Outbound, conn, tc, nil)
+	}()
+	wg.Wait()
+	p.write(ctx, &Event{Conn: id, Type: EventClose})
+}
+
+// copy copies data from src to dst, records it, and writes it to tee unless tee is nil. The write
+// side of dst is closed when src reaches EOF.
+func (p *Proxy) copy(ctx context.Context, id uint64, dir Direction, dst, src net.Conn, tee io.Writer) {
+	buf := make([]byte, 0x8000)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			p.write(ctx, &Event{Conn: id, Type: EventData, Direction: dir, Data: data})
+			if tee != nil {
+				if _, terr := tee.Write(data); terr != nil {
+					tee = nil
+				}
+			}
+			if _, err = dst.Write(data); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			if tcp, ok := dst.(*net.TCPConn); ok {
+				_ = tcp.CloseWrite()
+			}
+			return
+		}
+	}
+}
+
+// parseHTTP reads HTTP requests from the given reader and records them. Parsing stops at the first
+// error, but the reader is always drained.
+func (p *Proxy) parseHTTP(ctx context.Context, id uint64, r *io.PipeReader) {
+	br := bufio.NewReader(r)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			break
+		}
+		n, err := io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+		p.write(ctx, &Event{Conn: id, Type: EventHTTP, HTTP: &HTTPRequest{
+			Method:     req.Method,
+			URL:        req.RequestURI,
+			Proto:      req.Proto,
+			Host:       req.Host,
+			Header:     req.Header,
+			BodyLength: n,
+		}})
+		if err != nil {
+			break
+		}
+	}
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// source returns the address of the peer that opened the intercepted connection. Connections from
+// the cluster are dialed by a tunnel dialer in this process, which knows the original peer. Other
+// connections are recorded using their remote address.
+func (p *Proxy) source(conn net.Conn) string {
+	deadline := time.Now().Add(sourceLookupTimeout)
+	for {
+		// The dialer registers the connection once its dial has returned, which may be after the
+		// connection has been accepted here.
+		if id, ok := tunnel.DialedConnID(conn.RemoteAddr()); ok {
+			return id.SourceAddr().String()
+		}
+		if time.Now().After(deadline) {
+			return conn.RemoteAddr().String()
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (p *Proxy) write(ctx context.Context, ev *Event) {
+	if err := p.w.Write(ev); err != nil {
+		dlog.Errorf(ctx, "failed to write recording: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Package record implements recording of intercepted traffic to a portable file format, and replay
+// of such recordings.
+//
+// A recording is a file in JSON Lines format. The first line is a Header, and every subsequent line
+// is an Event. All events that belong to the same TCP connection share the same Conn number, and the
+// events of a connection always start with an EventOpen and end with an EventClose.
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Version is the version of the recording format.
+const Version = 1
+
+// Header is the first line of a recording.
+type Header struct {
+	Version   int       `json:"version"`
+	Intercept string    `json:"intercept"`
+	Workload  string    `json:"workload,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// EventType is the type of an Event.
+type EventType string
+
+const (
+	// EventOpen is recorded when an intercepted connection is accepted.
+	EventOpen = EventType("open")
+
+	// EventData is recorded for each chunk of data that is read from either side of a connection.
+	EventData = EventType("data")
+
+	// EventHTTP is recorded for each HTTP request that is parsed from the data sent to the
+	// intercept target. The request data is also recorded as EventData.
+	EventHTTP = EventType("http")
+
+	// EventClose is recorded when both sides of a connection have been closed.
+	EventClose = EventType("close")
+)
+
+// Direction tells which way the data of an EventData flows.
+type Direction string
+
+const (
+	// Inbound is data sent from the intercepted peer to the intercept target.
+	Inbound = Direction("in")
+
+	// Outbound is data sent from the intercept target back to the intercepted peer.
+	Outbound = Direction("out")
+)
+
+// Event is one line of a recording.
+type Event struct {
+	Time time.Time `json:"time"`
+	Conn uint64    `json:"conn"`
+	Type EventType `json:"type"`
+
+	// Target is the address of the intercept target. Only set for EventOpen.
+	Target string `json:"target,omitempty"`
+
+	// Source is the address of the peer that opened the intercepted connection, and Port is the
+	// service port of the intercept that the connection arrived at. Only set for EventOpen.
+	Source string `json:"source,omitempty"`
+	Port   string `json:"port,omitempty"`
+
+	// Direction and Data are only set for EventData.
+	Direction Direction `json:"dir,omitempty"`
+	Data      []byte    `json:"data,omitempty"`
+
+	// HTTP is only set for EventHTTP.
+	HTTP *HTTPRequest `json:"http,omitempty"`
+
+	// Error is the error, if any, that caused an EventClose.
+	Error string `json:"error,omitempty"`
+}
+
+// HTTPRequest describes an HTTP request that was parsed from an intercepted connection.
+type HTTPRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto"`
+	Host       string      `json:"host,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	BodyLength int64       `json:"bodyLength"`
+}
+
+// Writer writes a recording. It's safe for concurrent use.
+type Writer struct {
+	lock     sync.Mutex
+	out      io.WriteCloser
+	bw       *bufio.Writer
+	enc      *json.Encoder
+	closed   bool
+	lastConn uint64
+}
+
+// NewWriter writes the given header to out and returns a Writer that will write events to it. The
+// out writer is closed when the Writer is closed.
+func NewWriter(out io.WriteCloser, hdr *Header) (*Writer, error) {
+	bw := bufio.NewWriter(out)
+	w := &Writer{out: out, bw: bw, enc: json.NewEncoder(bw)}
+	hdr.Version = Version
+	if err := w.enc.Encode(hdr); err != nil {
+		return nil, err
+	}
+	return w, w.bw.Flush()
+}
+
+// NextConn returns a new number to use for the events of a connection.
+func (w *Writer) NextConn() uint64 {
+	return atomic.AddUint64(&w.lastConn, 1)
+}
+
+// Write writes the given event. The event's Time is set unless it's already set. Events written
+// after the Writer has been closed are silently discarded.
+func (w *Writer) Write(ev *Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	if err := w.enc.Encode(ev); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+// Close closes the Writer and the underlying writer.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.bw.Flush()
+	if cerr := w.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Recording is the in-memory representation of a recording.
+type Recording struct {
+	Header
+	Events []*Event
+}
+
+// Read reads a recording from the given reader.
+func Read(in io.Reader) (*Recording, error) {
+	dec := json.NewDecoder(in)
+	rec := &Recording{}
+	if err := dec.Decode(&rec.Header); err != nil {
+		return nil, fmt.Errorf("unable to read recording header: %w", err)
+	}
+	if rec.Version != Version {
+		return nil, fmt.Errorf("unsupported recording version %d", rec.Version)
+	}
+	for {
+		ev := &Event{}
+		if err := dec.Decode(ev); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// A truncated last line is expected when the recording process was killed.
+				return rec, nil
+			}
+			return nil, fmt.Errorf("unable to read recording event %d: %w", len(rec.Events)+1, err)
+		}
+		rec.Events = append(rec.Events, ev)
+	}
+}
+
+// ReadFile reads a recording from the given file.
+func ReadFile(name string) (*Recording, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
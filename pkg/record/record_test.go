@@ -0,0 +1,195 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/record"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// lockedBuffer is an io.WriteCloser that can be read while it's being written.
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(data)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func (*lockedBuffer) Close() error {
+	return nil
+}
+
+// httpServer starts an HTTP server that responds with the request path and returns its address.
+func httpServer(ctx context.Context, t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s %s %d", r.Method, r.URL.Path, len(body))
+	})}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	return l.Addr().String()
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	// The proxy logs after the test has ended, so a test logger can't be used.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target := httpServer(ctx, t)
+
+	buf := &lockedBuffer{}
+	w, err := record.NewWriter(buf, &record.Header{Intercept: "echo", Namespace: "default"})
+	require.NoError(t, err)
+	p, err := record.NewProxy(w, target, "http")
+	require.NoError(t, err)
+	go func() {
+		_ = p.Serve(ctx)
+	}()
+
+	// Use a client that doesn't reuse connections so that each request gets its own connection.
+	hc := http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	base := fmt.Sprintf("http://127.0.0.1:%d", p.Port())
+	resp, err := hc.Get(base + "/hello")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "GET /hello 0", string(body))
+
+	resp, err = hc.Post(base+"/data", "text/plain", strings.NewReader("some data"))
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "POST /data 9", string(body))
+
+	// Wait for both connections to be recorded as closed.
+	require.Eventually(t, func() bool {
+		return strings.Count(buf.String(), `"type":"close"`) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.Close())
+
+	rec, err := record.Read(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, record.Version, rec.Version)
+	assert.Equal(t, "echo", rec.Intercept)
+
+	var requests []*record.HTTPRequest
+	sent := make(map[uint64]int64)
+	for _, ev := range rec.Events {
+		switch ev.Type {
+		case record.EventOpen:
+			assert.Equal(t, target, ev.Target)
+			assert.Equal(t, "http", ev.Port)
+			// Connections that don't come through a tunnel are recorded with their remote address
+			assert.Contains(t, ev.Source, "127.0.0.1:")
+		case record.EventHTTP:
+			requests = append(requests, ev.HTTP)
+		case record.EventData:
+			if ev.Direction == record.Inbound {
+				sent[ev.Conn] += int64(len(ev.Data))
+			}
+		}
+	}
+	require.Len(t, requests, 2)
+	assert.Equal(t, "GET", requests[0].Method)
+	assert.Equal(t, "/hello", requests[0].URL)
+	assert.Equal(t, "POST", requests[1].Method)
+	assert.Equal(t, "/data", requests[1].URL)
+	assert.Equal(t, int64(9), requests[1].BodyLength)
+
+	results := record.Replay(ctx, rec, target, 0)
+	require.Len(t, results, 2)
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, sent[r.Conn], r.Sent)
+		assert.Greater(t, r.Received, int64(0))
+		assert.Len(t, r.Requests, 1)
+		assert.Equal(t, "http", r.Port)
+	}
+}
+
+// tunnelStream is a tunnel.Stream that delivers the messages sent on its in channel, and discards
+// the messages that are sent to it.
+type tunnelStream struct {
+	id tunnel.ConnID
+	in chan tunnel.Message
+}
+
+func (s *tunnelStream) Tag() string                                { return "TEST" }
+func (s *tunnelStream) ID() tunnel.ConnID                          { return s.id }
+func (s *tunnelStream) Send(context.Context, tunnel.Message) error { return nil }
+func (s *tunnelStream) CloseSend(context.Context) error            { return nil }
+func (s *tunnelStream) PeerVersion() uint16                        { return 2 }
+func (s *tunnelStream) SessionID() string                          { return "session-1" }
+func (s *tunnelStream) DialTimeout() time.Duration                 { return time.Second }
+func (s *tunnelStream) RoundtripLatency() time.Duration            { return time.Second }
+
+func (s *tunnelStream) Receive(ctx context.Context) (tunnel.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case m := <-s.in:
+		return m, nil
+	}
+}
+
+func TestProxy_TunnelSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	target := httpServer(ctx, t)
+
+	buf := &lockedBuffer{}
+	w, err := record.NewWriter(buf, &record.Header{Intercept: "echo", Namespace: "default"})
+	require.NoError(t, err)
+	p, err := record.NewProxy(w, target, "8080")
+	require.NoError(t, err)
+	go func() {
+		_ = p.Serve(ctx)
+	}()
+
+	// A tunnel dialer connects to the proxy on behalf of a peer in the cluster
+	id := tunnel.NewConnID(ipproto.TCP, net.IP{10, 1, 2, 3}, net.IP{127, 0, 0, 1}, 34567, uint16(p.Port()))
+	s := &tunnelStream{id: id, in: make(chan tunnel.Message, 1)}
+	tunnel.NewDialer(s).Start(ctx)
+	s.in <- tunnel.NewMessage(tunnel.Normal, []byte("GET /hello HTTP/1.1\r\nHost: echo\r\n\r\n"))
+	require.Eventually(t, func() bool {
+		return strings.Contains(buf.String(), `"type":"http"`)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.Close())
+
+	rec, err := record.Read(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	require.NotEmpty(t, rec.Events)
+	open := rec.Events[0]
+	assert.Equal(t, record.EventOpen, open.Type)
+	assert.Equal(t, "10.1.2.3:34567", open.Source)
+	assert.Equal(t, "8080", open.Port)
+}
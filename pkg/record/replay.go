@@ -0,0 +1,114 @@
+package record
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/datawire/dlib/dtime"
+)
+
+// replayDrainTimeout is how long a replayed connection waits for the target to send its response
+// after all recorded data has been sent.
+const replayDrainTimeout = 5 * time.Second
+
+// ConnResult is the outcome of replaying one recorded connection.
+type ConnResult struct {
+	Conn     uint64
+	Source   string
+	Port     string
+	Requests []*HTTPRequest
+	Sent     int64
+	Received int64
+	Err      error
+}
+
+// Replay replays the inbound data of all connections in the given recording against the given
+// address and returns the result of each connection, ordered by connection number.
+//
+// The time between the events of the recording is preserved, divided by the given speed, so that a
+// speed of 2 replays the recording twice as fast as it was recorded. A speed of zero or less replays
+// the recording as fast as possible. Connections are replayed concurrently, just like they were
+// recorded.
+func Replay(ctx context.Context, rec *Recording, to string, speed float64) []*ConnResult {
+	if len(rec.Events) == 0 {
+		return nil
+	}
+	start := time.Now()
+	first := rec.Events[0].Time
+	delay := func(t time.Time) {
+		if speed > 0 {
+			dtime.SleepWithContext(ctx, time.Duration(float64(t.Sub(first))/speed)-time.Since(start))
+		}
+	}
+
+	conns := make(map[uint64][]*Event)
+	for _, ev := range rec.Events {
+		conns[ev.Conn] = append(conns[ev.Conn], ev)
+	}
+	results := make([]*ConnResult, 0, len(conns))
+	wg := sync.WaitGroup{}
+	for id, evs := range conns {
+		r := &ConnResult{Conn: id}
+		if open := evs[0]; open.Type == EventOpen {
+			r.Source = open.Source
+			r.Port = open.Port
+		}
+		results = append(results, r)
+		wg.Add(1)
+		go func(evs []*Event) {
+			defer wg.Done()
+			delay(evs[0].Time)
+			replayConn(ctx, to, evs, delay, r)
+		}(evs)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Conn < results[j].Conn })
+	return results
+}
+
+func replayConn(ctx context.Context, to string, evs []*Event, delay func(time.Time), r *ConnResult) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", to)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	defer conn.Close()
+
+	received := make(chan int64, 1)
+	go func() {
+		n, _ := io.Copy(io.Discard, conn)
+		received <- n
+	}()
+
+	for _, ev := range evs {
+		if ctx.Err() != nil {
+			r.Err = ctx.Err()
+			return
+		}
+		switch ev.Type {
+		case EventData:
+			if ev.Direction != Inbound {
+				continue
+			}
+			delay(ev.Time)
+			n, err := conn.Write(ev.Data)
+			r.Sent += int64(n)
+			if err != nil {
+				r.Err = err
+				return
+			}
+		case EventHTTP:
+			r.Requests = append(r.Requests, ev.HTTP)
+		}
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.CloseWrite()
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(replayDrainTimeout))
+	r.Received = <-received
+}
@@ -0,0 +1,160 @@
+package sftpfs
+
+import (
+	"container/list"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blockSize is the size of the blocks in which file content is read and cached.
+const blockSize = 64 * 1024
+
+// cacheBlocks is the maximum number of blocks that are cached by one mount.
+const cacheBlocks = 1024
+
+// attrTimeout is how long the attributes of files and the results of lookups are cached, both by
+// the kernel and by the file system.
+const attrTimeout = time.Second
+
+// isUnder returns true if the given path equals dir or is a path in the directory dir.
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir) && (strings.HasSuffix(dir, "/") || path[len(dir)] == '/')
+}
+
+// statCache caches the file info of remote files for a short time.
+type statCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]statEntry
+	nextSweep time.Time
+}
+
+type statEntry struct {
+	info    os.FileInfo
+	expires time.Time
+}
+
+func newStatCache(ttl time.Duration) *statCache {
+	return &statCache{ttl: ttl, entries: make(map[string]statEntry)}
+}
+
+func (c *statCache) get(path string) (os.FileInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, path)
+		return nil, false
+	}
+	return e.info, true
+}
+
+func (c *statCache) put(path string, info os.FileInfo) {
+	c.mu.Lock()
+	now := time.Now()
+	if now.After(c.nextSweep) {
+		for p, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, p)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[path] = statEntry{info: info, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+}
+
+// invalidate removes the entries for the given path and all paths under it.
+func (c *statCache) invalidate(path string) {
+	c.mu.Lock()
+	for p := range c.entries {
+		if isUnder(p, path) {
+			delete(c.entries, p)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// fileVersion identifies the content of a file. Cached blocks of a file are discarded when the
+// size or modification time of the file changes.
+type fileVersion struct {
+	size  int64
+	mtime time.Time
+}
+
+func versionOf(info os.FileInfo) fileVersion {
+	return fileVersion{size: info.Size(), mtime: info.ModTime()}
+}
+
+type blockKey struct {
+	path  string
+	index int64
+}
+
+type block struct {
+	key     blockKey
+	version fileVersion
+	data    []byte
+}
+
+// blockCache is a least recently used cache of file content.
+type blockCache struct {
+	mu     sync.Mutex
+	max    int
+	lru    *list.List // of *block, most recently used first
+	blocks map[blockKey]*list.Element
+}
+
+func newBlockCache(max int) *blockCache {
+	return &blockCache{max: max, lru: list.New(), blocks: make(map[blockKey]*list.Element)}
+}
+
+// get returns the cached data of the given block, provided that it was read from the given
+// version of the file.
+func (c *blockCache) get(key blockKey, version fileVersion) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.blocks[key]
+	if !ok {
+		return nil, false
+	}
+	b := el.Value.(*block)
+	if b.version != version {
+		c.lru.Remove(el)
+		delete(c.blocks, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return b.data, true
+}
+
+func (c *blockCache) put(key blockKey, version fileVersion, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.blocks[key]; ok {
+		c.lru.Remove(el)
+	}
+	c.blocks[key] = c.lru.PushFront(&block{key: key, version: version, data: data})
+	for c.lru.Len() > c.max {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.blocks, el.Value.(*block).key)
+	}
+}
+
+// invalidate removes the blocks of the given path and all paths under it.
+func (c *blockCache) invalidate(path string) {
+	c.mu.Lock()
+	for key, el := range c.blocks {
+		if isUnder(key.path, path) {
+			c.lru.Remove(el)
+			delete(c.blocks, key)
+		}
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,64 @@
+package sftpfs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnder(t *testing.T) {
+	assert.True(t, isUnder("/a/b", "/a/b"))
+	assert.True(t, isUnder("/a/b/c", "/a/b"))
+	assert.True(t, isUnder("/a/b", "/"))
+	assert.False(t, isUnder("/a/bc", "/a/b"))
+	assert.False(t, isUnder("/a", "/a/b"))
+}
+
+func TestBlockCache(t *testing.T) {
+	v1 := fileVersion{size: 10, mtime: time.Unix(1000, 0)}
+	v2 := fileVersion{size: 12, mtime: time.Unix(1001, 0)}
+	c := newBlockCache(2)
+
+	a := blockKey{path: "/a", index: 0}
+	b := blockKey{path: "/b", index: 0}
+	bc := blockKey{path: "/b/c", index: 3}
+
+	c.put(a, v1, []byte("a"))
+	data, ok := c.get(a, v1)
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(data))
+
+	// A block is discarded when the file changes
+	_, ok = c.get(a, v2)
+	assert.False(t, ok)
+	_, ok = c.get(a, v1)
+	assert.False(t, ok)
+
+	// The least recently used block is evicted
+	c.put(a, v1, []byte("a"))
+	c.put(b, v1, []byte("b"))
+	_, _ = c.get(a, v1)
+	c.put(bc, v1, []byte("bc"))
+	_, ok = c.get(b, v1)
+	assert.False(t, ok)
+	_, ok = c.get(a, v1)
+	assert.True(t, ok)
+
+	// Invalidation covers the paths under the given path
+	c.invalidate("/b")
+	_, ok = c.get(bc, v1)
+	assert.False(t, ok)
+	_, ok = c.get(a, v1)
+	assert.True(t, ok)
+}
+
+func TestStatCache_Expiry(t *testing.T) {
+	c := newStatCache(50 * time.Millisecond)
+	c.put("/a", nil)
+	_, ok := c.get("/a")
+	assert.True(t, ok)
+	time.Sleep(100 * time.Millisecond)
+	_, ok = c.get("/a")
+	assert.False(t, ok)
+}
@@ -0,0 +1,395 @@
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+
+	"github.com/datawire/dlib/dlog"
+	"github.com/telepresenceio/telepresence/v2/pkg/client/errcat"
+)
+
+// CopyOptions control which files a Snapshot copies.
+type CopyOptions struct {
+	// Include are glob patterns of the files to copy. All files are copied when empty.
+	Include []string
+
+	// Exclude are glob patterns of the files and directories that aren't copied.
+	Exclude []string
+
+	// MaxSize is the maximum total size of the copied files. Zero means that there's no limit.
+	MaxSize int64
+}
+
+// Validate returns an error if one of the patterns is malformed.
+func (o *CopyOptions) Validate() error {
+	for _, ps := range [][]string{o.Include, o.Exclude} {
+		for _, p := range ps {
+			if _, err := path.Match(p, ""); err != nil {
+				return errcat.User.Newf("invalid glob pattern %q: %w", p, err)
+			}
+		}
+	}
+	if o.MaxSize < 0 {
+		return errcat.User.New("the maximum size cannot be negative")
+	}
+	return nil
+}
+
+// matches returns true if the given pattern matches the given slash separated relative path. A
+// pattern that contains no slash is matched against the base name of the path.
+func matches(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	ok, _ := path.Match(pattern, rel)
+	return ok
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matches(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included returns true if the given file is matched by an include pattern, either by itself or
+// by one of its parent directories.
+func (o *CopyOptions) included(rel string) bool {
+	if len(o.Include) == 0 {
+		return true
+	}
+	for ; rel != "."; rel = path.Dir(rel) {
+		if matchesAny(o.Include, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// copiedEntry is what a Snapshot knows about a file that it has copied.
+type copiedEntry struct {
+	version fileVersion
+	link    string // target of a symbolic link
+	dir     bool
+}
+
+// Snapshot is a local copy of a remote directory that can be brought up to date with Sync.
+type Snapshot struct {
+	remote *Remote
+	root   string
+	dir    string
+	opts   CopyOptions
+
+	mu      sync.Mutex
+	copied  map[string]copiedEntry // keyed by slash separated path relative to root
+	removed bool
+}
+
+// NewSnapshot returns a Snapshot that copies the remote directory root to the local directory dir.
+func NewSnapshot(remote *Remote, root, dir string, opts CopyOptions) *Snapshot {
+	return &Snapshot{remote: remote, root: root, dir: dir, opts: opts, copied: make(map[string]copiedEntry)}
+}
+
+// remoteEntry is a file found in the remote directory.
+type remoteEntry struct {
+	rel  string
+	info os.FileInfo
+}
+
+// Sync copies the files that are new or have changed since the last call and removes the files
+// that no longer exist in the remote directory. It returns the number of files that were copied or
+// removed. Nothing is copied when the total size of the files exceeds the maximum size.
+func (s *Snapshot) Sync(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.removed {
+		return 0, errors.New("the copy has been removed")
+	}
+	var n int
+	err := s.remote.do(ctx, func(c *sftp.Client) error {
+		entries, err := s.list(c)
+		if err != nil {
+			return err
+		}
+		n, err = s.update(ctx, c, entries)
+		return err
+	})
+	return n, err
+}
+
+// list returns the files to copy, parents first.
+func (s *Snapshot) list(c *sftp.Client) ([]remoteEntry, error) {
+	var entries []remoteEntry
+	var size int64
+	w := c.Walk(s.root)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			if w.Path() == s.root {
+				return nil, err
+			}
+			// A file that is removed during the walk is simply not copied
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(w.Path(), s.root), "/")
+		if rel == "" {
+			continue
+		}
+		info := w.Stat()
+		if matchesAny(s.opts.Exclude, rel) {
+			if info.IsDir() {
+				w.SkipDir()
+			}
+			continue
+		}
+		if !s.opts.included(rel) {
+			// The parent directories of included files are created when the files are copied
+			continue
+		}
+		if info.IsDir() {
+			entries = append(entries, remoteEntry{rel: rel, info: info})
+			continue
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+			if s.opts.MaxSize > 0 && size > s.opts.MaxSize {
+				return nil, errcat.User.Newf("the remote volumes exceed the maximum copy size of %d bytes", s.opts.MaxSize)
+			}
+		}
+		entries = append(entries, remoteEntry{rel: rel, info: info})
+	}
+	return entries, nil
+}
+
+func (s *Snapshot) update(ctx context.Context, c *sftp.Client, entries []remoteEntry) (int, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return 0, err
+	}
+	n := 0
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		seen[e.rel] = struct{}{}
+		local := filepath.Join(s.dir, filepath.FromSlash(e.rel))
+		mode := e.info.Mode()
+		prev, known := s.copied[e.rel]
+		if known && !prev.sameType(mode) {
+			// The local copy, and the files in it, are removed before the entry is replaced, so
+			// that nothing is written or removed through a stale local entry.
+			s.forget(e.rel)
+			if err := s.removeLocal(e.rel); err != nil {
+				return n, err
+			}
+			known = false
+		}
+		if !mode.IsDir() {
+			if err := s.mkdirAll(path.Dir(e.rel)); err != nil {
+				return n, err
+			}
+		}
+		switch {
+		case mode.IsDir():
+			if known {
+				continue
+			}
+			if err := s.mkdirAll(e.rel); err != nil {
+				return n, err
+			}
+			s.copied[e.rel] = copiedEntry{dir: true}
+			continue
+		case mode&os.ModeSymlink != 0:
+			target, err := c.ReadLink(path.Join(s.root, e.rel))
+			if err != nil {
+				return n, err
+			}
+			if known && prev.link == target {
+				continue
+			}
+			_ = os.RemoveAll(local)
+			if err := os.Symlink(filepath.FromSlash(target), local); err != nil {
+				dlog.Warnf(ctx, "unable to create symbolic link %q: %v", local, err)
+				continue
+			}
+			s.copied[e.rel] = copiedEntry{link: target}
+		case mode.IsRegular():
+			v := versionOf(e.info)
+			if known && prev.version == v {
+				continue
+			}
+			if err := copyFile(c, path.Join(s.root, e.rel), local, e.info); err != nil {
+				return n, err
+			}
+			s.copied[e.rel] = copiedEntry{version: v}
+		default:
+			// Sockets, devices, and pipes can't be copied
+			continue
+		}
+		n++
+	}
+
+	for rel := range s.copied {
+		if _, ok := seen[rel]; !ok {
+			delete(s.copied, rel)
+			if err := s.removeLocal(rel); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// sameType returns true if the copied entry is of the same type as a remote file with the given mode.
+func (e copiedEntry) sameType(mode os.FileMode) bool {
+	switch {
+	case mode.IsDir():
+		return e.dir
+	case mode&os.ModeSymlink != 0:
+		return e.link != ""
+	default:
+		return !e.dir && e.link == ""
+	}
+}
+
+// forget removes the given entry, and the entries of the files below it, from the copied entries.
+func (s *Snapshot) forget(rel string) {
+	delete(s.copied, rel)
+	prefix := rel + "/"
+	for r := range s.copied {
+		if strings.HasPrefix(r, prefix) {
+			delete(s.copied, r)
+		}
+	}
+}
+
+// mkdirAll creates the local directory of the given relative path along with its parents. Symbolic
+// links are never followed, because a link that was copied from the remote directory can point
+// anywhere.
+func (s *Snapshot) mkdirAll(rel string) error {
+	if rel == "." {
+		return nil
+	}
+	dir := s.dir
+	for _, name := range strings.Split(rel, "/") {
+		dir = filepath.Join(dir, name)
+		info, err := os.Lstat(dir)
+		switch {
+		case os.IsNotExist(err):
+			if err = os.Mkdir(dir, 0700); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !info.IsDir():
+			return fmt.Errorf("refusing to copy %s because %s is not a directory", rel, dir)
+		}
+	}
+	return nil
+}
+
+// inTree returns true if all local parent directories of the given relative path are directories
+// rather than symbolic links, i.e. if the path refers to a file in the local directory.
+func (s *Snapshot) inTree(rel string) (bool, error) {
+	dir := s.dir
+	for _, name := range strings.Split(path.Dir(rel), "/") {
+		if name == "." {
+			break
+		}
+		dir = filepath.Join(dir, name)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !info.IsDir() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// removeLocal removes the local copy of the given relative path. Nothing is removed when the path
+// isn't in the local directory, because one of its parents has been replaced by a symbolic link.
+func (s *Snapshot) removeLocal(rel string) error {
+	ok, err := s.inTree(rel)
+	if !ok || err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, filepath.FromSlash(rel)))
+}
+
+// Remove removes the copied files, and the local directory unless it contains other files. Sync
+// fails once the copy has been removed.
+func (s *Snapshot) Remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = true
+	var err error
+	dirs := make(map[string]struct{})
+	for rel, e := range s.copied {
+		local := filepath.Join(s.dir, filepath.FromSlash(rel))
+		if e.dir {
+			dirs[local] = struct{}{}
+		} else if ok, _ := s.inTree(rel); ok {
+			if rmErr := os.Remove(local); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+				err = rmErr
+			}
+		}
+		for d := filepath.Dir(local); d != s.dir && len(d) > len(s.dir); d = filepath.Dir(d) {
+			dirs[d] = struct{}{}
+		}
+	}
+	s.copied = nil
+
+	// Remove the directories that are empty now, deepest first.
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	sorted = append(sorted, s.dir)
+	for _, d := range sorted {
+		if rel, relErr := filepath.Rel(s.dir, d); relErr == nil {
+			if ok, _ := s.inTree(filepath.ToSlash(rel)); ok {
+				_ = os.Remove(d)
+			}
+		}
+	}
+	return err
+}
+
+// copyFile copies the content, permissions, and modification time of a remote file to a local file.
+func copyFile(c *sftp.Client, remotePath, localPath string, info os.FileInfo) error {
+	rf, err := c.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+
+	// A symbolic link in place of the file is removed rather than followed
+	_ = os.RemoveAll(localPath)
+	lf, err := os.OpenFile(localPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(lf, rf); err != nil {
+		_ = lf.Close()
+		return fmt.Errorf("failed to copy %s: %w", remotePath, err)
+	}
+	if err = lf.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(localPath, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,251 @@
+package sftpfs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/datawire/dlib/dlog"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+}
+
+// listFiles returns the slash separated relative paths of all regular files in dir.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	require.NoError(t, filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.yaml", "app.yaml", true},
+		{"*.yaml", "config/app.yaml", true},
+		{"config/*.yaml", "config/app.yaml", true},
+		{"config/*.yaml", "other/app.yaml", false},
+		{"config", "config", true},
+		{"*.yaml", "app.json", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matches(tt.pattern, tt.rel), "%s %s", tt.pattern, tt.rel)
+	}
+}
+
+func TestSnapshot_Sync(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	writeFiles(t, remoteDir, map[string]string{
+		"config/app.yaml":   "a: 1",
+		"config/app.json":   "{}",
+		"secrets/token":     "secret",
+		"cache/tmp/data.db": "data",
+	})
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{
+		Include: []string{"config", "secrets"},
+		Exclude: []string{"*.json"},
+	})
+	n, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"config/app.yaml", "secrets/token"}, listFiles(t, localDir))
+
+	// Nothing has changed
+	n, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Changed and removed files are synced
+	p := filepath.Join(remoteDir, "config", "app.yaml")
+	require.NoError(t, os.WriteFile(p, []byte("a: 2"), 0600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(p, later, later))
+	require.NoError(t, os.Remove(filepath.Join(remoteDir, "secrets", "token")))
+	n, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"config/app.yaml"}, listFiles(t, localDir))
+	data, err := os.ReadFile(filepath.Join(localDir, "config", "app.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "a: 2", string(data))
+}
+
+func TestSnapshot_Symlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+
+	// The layout of a mounted ConfigMap
+	writeFiles(t, remoteDir, map[string]string{"..2021_11_01/key": "value"})
+	require.NoError(t, os.Symlink("..2021_11_01", filepath.Join(remoteDir, "..data")))
+	require.NoError(t, os.Symlink("..data/key", filepath.Join(remoteDir, "key")))
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, remoteDir, localDir, CopyOptions{})
+	_, err := s.Sync(ctx)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(localDir, "key"))
+	require.NoError(t, err)
+	assert.Equal(t, "value", string(data))
+}
+
+func TestSnapshot_MaxSize(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	writeFiles(t, remoteDir, map[string]string{"a": "12345", "b": "67890"})
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{MaxSize: 8})
+	_, err := s.Sync(ctx)
+	assert.Error(t, err)
+	assert.Empty(t, listFiles(t, localDir))
+}
+
+func TestSnapshot_Remove(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := filepath.Join(t.TempDir(), "copy")
+	writeFiles(t, remoteDir, map[string]string{"a/b/c": "c", "d": "d"})
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{Include: []string{"c"}})
+	_, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b/c"}, listFiles(t, localDir))
+
+	require.NoError(t, s.Remove())
+	_, err = os.Stat(localDir)
+	assert.True(t, os.IsNotExist(err))
+	_, err = s.Sync(ctx)
+	assert.Error(t, err)
+}
+
+func TestSnapshot_RemoveKeepsOtherFiles(t *testing.T) {
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	writeFiles(t, remoteDir, map[string]string{"a/b": "b"})
+	writeFiles(t, localDir, map[string]string{"a/mine": "mine"})
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{})
+	_, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b", "a/mine"}, listFiles(t, localDir))
+
+	require.NoError(t, s.Remove())
+	assert.Equal(t, []string{"a/mine"}, listFiles(t, localDir))
+}
+
+func TestSnapshot_DirReplacedBySymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, remoteDir, map[string]string{"a/f": "remote"})
+	writeFiles(t, outside, map[string]string{"f": "mine"})
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{})
+	_, err := s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/f"}, listFiles(t, localDir))
+
+	// The stale a/f must not be removed through the new link
+	require.NoError(t, os.RemoveAll(filepath.Join(remoteDir, "a")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(remoteDir, "a")))
+	_, err = s.Sync(ctx)
+	require.NoError(t, err)
+	target, err := os.Readlink(filepath.Join(localDir, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, outside, target)
+	assert.Equal(t, []string{"f"}, listFiles(t, outside))
+
+	require.NoError(t, s.Remove())
+	assert.Equal(t, []string{"f"}, listFiles(t, outside))
+}
+
+func TestSnapshot_SymlinkReplacedByDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(remoteDir, "a")))
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{})
+	_, err := s.Sync(ctx)
+	require.NoError(t, err)
+
+	// The new a/f must not be written through the old link
+	require.NoError(t, os.Remove(filepath.Join(remoteDir, "a")))
+	writeFiles(t, remoteDir, map[string]string{"a/f": "remote"})
+	_, err = s.Sync(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, listFiles(t, outside))
+	info, err := os.Lstat(filepath.Join(localDir, "a"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.Equal(t, []string{"a/f"}, listFiles(t, localDir))
+}
+
+func TestSnapshot_RefusesLocalSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	ctx := dlog.NewTestContext(t, false)
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, remoteDir, map[string]string{"a/f": "remote"})
+	require.NoError(t, os.Symlink(outside, filepath.Join(localDir, "a")))
+
+	r := NewRemote((&sftpServers{}).dial)
+	defer r.Close()
+	s := NewSnapshot(r, filepath.ToSlash(remoteDir), localDir, CopyOptions{})
+	_, err := s.Sync(ctx)
+	assert.Error(t, err)
+	assert.Empty(t, listFiles(t, outside))
+}
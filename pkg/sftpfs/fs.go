@@ -0,0 +1,519 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/pkg/sftp"
+)
+
+// fileSystem is the state that is shared by all nodes of a mounted file system.
+type fileSystem struct {
+	remote *Remote
+	root   string
+	stats  *statCache
+	blocks *blockCache
+	uid    uint32
+	gid    uint32
+}
+
+func newFileSystem(remote *Remote, root string) *fileSystem {
+	return &fileSystem{
+		remote: remote,
+		root:   root,
+		stats:  newStatCache(attrTimeout),
+		blocks: newBlockCache(cacheBlocks),
+		uid:    uint32(os.Getuid()),
+		gid:    uint32(os.Getgid()),
+	}
+}
+
+// stat returns the info of the given remote file, following symbolic links.
+func (fsys *fileSystem) stat(ctx context.Context, p string) (os.FileInfo, error) {
+	if info, ok := fsys.stats.get(p); ok {
+		return info, nil
+	}
+	var info os.FileInfo
+	err := fsys.remote.do(ctx, func(c *sftp.Client) (err error) {
+		info, err = c.Stat(p)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	fsys.stats.put(p, info)
+	return info, nil
+}
+
+// invalidate discards everything that is cached for the given path and the paths under it.
+func (fsys *fileSystem) invalidate(p string) {
+	fsys.stats.invalidate(p)
+	fsys.blocks.invalidate(p)
+}
+
+func (fsys *fileSystem) fillAttr(info os.FileInfo, a *fuse.Attr) {
+	a.Mode = modeType(info.Mode()) | uint32(info.Mode().Perm())
+	a.Size = uint64(info.Size())
+	a.Blocks = (a.Size + 511) / 512
+	mtime := info.ModTime()
+	atime := mtime
+	if st, ok := info.Sys().(*sftp.FileStat); ok {
+		atime = time.Unix(int64(st.Atime), 0)
+	}
+	a.SetTimes(&atime, &mtime, &mtime)
+
+	// The remote owner means nothing on this host, so files are presented as owned by the user
+	// that mounted them. The SFTP server checks the permissions.
+	a.Uid = fsys.uid
+	a.Gid = fsys.gid
+}
+
+func modeType(m os.FileMode) uint32 {
+	switch {
+	case m.IsDir():
+		return syscall.S_IFDIR
+	case m&os.ModeSymlink != 0:
+		return syscall.S_IFLNK
+	default:
+		return syscall.S_IFREG
+	}
+}
+
+// openFlags returns the flags of a FUSE open request that are meaningful to the SFTP server.
+// Appending is done by the kernel, which passes the offsets to write at.
+func openFlags(flags uint32) int {
+	return int(flags) & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_EXCL | os.O_TRUNC)
+}
+
+func toErrno(err error) syscall.Errno {
+	var errno syscall.Errno
+	var se *sftp.StatusError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EACCES
+	case errors.Is(err, os.ErrExist):
+		return syscall.EEXIST
+	case errors.Is(err, sftp.ErrSSHFxConnectionLost), errors.Is(err, sftp.ErrSSHFxNoConnection):
+		return syscall.ENOTCONN
+	case errors.As(err, &se) && se.FxCode() == sftp.ErrSSHFxOpUnsupported:
+		return syscall.ENOTSUP
+	default:
+		return syscall.EIO
+	}
+}
+
+// node is a file or directory of a mounted file system.
+type node struct {
+	fs.Inode
+	fsys *fileSystem
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*node)(nil))
+	_ = (fs.NodeSetattrer)((*node)(nil))
+	_ = (fs.NodeLookuper)((*node)(nil))
+	_ = (fs.NodeReaddirer)((*node)(nil))
+	_ = (fs.NodeOpener)((*node)(nil))
+	_ = (fs.NodeCreater)((*node)(nil))
+	_ = (fs.NodeMkdirer)((*node)(nil))
+	_ = (fs.NodeUnlinker)((*node)(nil))
+	_ = (fs.NodeRmdirer)((*node)(nil))
+	_ = (fs.NodeRenamer)((*node)(nil))
+	_ = (fs.NodeReadlinker)((*node)(nil))
+	_ = (fs.NodeSymlinker)((*node)(nil))
+	_ = (fs.NodeStatfser)((*node)(nil))
+)
+
+// remotePath returns the remote path of this node, or of the given child of this node.
+func (n *node) remotePath(name ...string) string {
+	return path.Join(append([]string{n.fsys.root, n.Path(nil)}, name...)...)
+}
+
+// newChild returns a new inode for the child of this node that has the given info.
+func (n *node) newChild(ctx context.Context, info os.FileInfo, out *fuse.EntryOut) *fs.Inode {
+	n.fsys.fillAttr(info, &out.Attr)
+	return n.NewInode(ctx, &node{fsys: n.fsys}, fs.StableAttr{Mode: modeType(info.Mode())})
+}
+
+func (n *node) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := n.fsys.stat(ctx, n.remotePath())
+	if err != nil {
+		return toErrno(err)
+	}
+	n.fsys.fillAttr(info, &out.Attr)
+	return 0
+}
+
+func (n *node) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	p := n.remotePath()
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		if mode, ok := in.GetMode(); ok {
+			if err := c.Chmod(p, os.FileMode(mode).Perm()); err != nil {
+				return err
+			}
+		}
+		if size, ok := in.GetSize(); ok {
+			if err := c.Truncate(p, int64(size)); err != nil {
+				return err
+			}
+		}
+		mtime, mok := in.GetMTime()
+		atime, aok := in.GetATime()
+		if mok || aok {
+			if !mok {
+				mtime = atime
+			} else if !aok {
+				atime = mtime
+			}
+			if err := c.Chtimes(p, atime, mtime); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	n.fsys.invalidate(p)
+	if err != nil {
+		return toErrno(err)
+	}
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	info, err := n.fsys.stat(ctx, n.remotePath(name))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	p := n.remotePath()
+	var infos []os.FileInfo
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) (err error) {
+		infos, err = c.ReadDir(p)
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	entries := make([]fuse.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fuse.DirEntry{Name: info.Name(), Mode: modeType(info.Mode())}
+		if info.Mode()&os.ModeSymlink == 0 {
+			// Prime the cache, so that the lookups that usually follow a listing don't need
+			// a round trip each.
+			n.fsys.stats.put(path.Join(p, info.Name()), info)
+		}
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	h := &handle{fsys: n.fsys, path: n.remotePath(), flags: openFlags(flags)}
+	if err := h.open(ctx); err != nil {
+		return nil, 0, toErrno(err)
+	}
+	return h, 0, 0
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	p := n.remotePath(name)
+	h := &handle{fsys: n.fsys, path: p, flags: openFlags(flags) | os.O_CREATE}
+	if err := h.open(ctx); err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	n.fsys.invalidate(p)
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		return c.Chmod(p, os.FileMode(mode).Perm())
+	})
+	var info os.FileInfo
+	if err == nil {
+		info, err = n.fsys.stat(ctx, p)
+	}
+	if err != nil {
+		_ = h.Release(ctx)
+		return nil, nil, 0, toErrno(err)
+	}
+	return n.newChild(ctx, info, out), h, 0, 0
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	p := n.remotePath(name)
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		if err := c.Mkdir(p); err != nil {
+			if _, serr := c.Stat(p); serr == nil {
+				// The SFTP protocol has no status for an existing file.
+				return os.ErrExist
+			}
+			return err
+		}
+		return c.Chmod(p, os.FileMode(mode).Perm())
+	})
+	n.fsys.invalidate(p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	info, err := n.fsys.stat(ctx, p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	p := n.remotePath(name)
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		return c.Remove(p)
+	})
+	n.fsys.invalidate(p)
+	return toErrno(err)
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	p := n.remotePath(name)
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		if err := c.RemoveDirectory(p); err != nil {
+			if infos, rerr := c.ReadDir(p); rerr == nil && len(infos) > 0 {
+				return syscall.ENOTEMPTY
+			}
+			return err
+		}
+		return nil
+	})
+	n.fsys.invalidate(p)
+	return toErrno(err)
+}
+
+func (n *node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags != 0 {
+		return syscall.ENOTSUP
+	}
+	from := n.remotePath(name)
+	to := newParent.(*node).remotePath(newName)
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+			return c.PosixRename(from, to)
+		}
+		return c.Rename(from, to)
+	})
+	n.fsys.invalidate(from)
+	n.fsys.invalidate(to)
+	return toErrno(err)
+}
+
+func (n *node) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	p := n.remotePath()
+	var target string
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) (err error) {
+		target, err = c.ReadLink(p)
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return []byte(target), 0
+}
+
+func (n *node) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	p := n.remotePath(name)
+	var info os.FileInfo
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) (err error) {
+		if err = c.Symlink(target, p); err == nil {
+			info, err = c.Lstat(p)
+		}
+		return err
+	})
+	n.fsys.invalidate(p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *node) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	p := n.remotePath()
+	var vfs *sftp.StatVFS
+	err := n.fsys.remote.do(ctx, func(c *sftp.Client) (err error) {
+		if _, ok := c.HasExtension("statvfs@openssh.com"); ok {
+			vfs, err = c.StatVFS(p)
+		}
+		return err
+	})
+	if err != nil {
+		return toErrno(err)
+	}
+	if vfs != nil {
+		out.Blocks = vfs.Blocks
+		out.Bfree = vfs.Bfree
+		out.Bavail = vfs.Bavail
+		out.Files = vfs.Files
+		out.Ffree = vfs.Ffree
+		out.Bsize = uint32(vfs.Bsize)
+		out.Frsize = uint32(vfs.Frsize)
+		out.NameLen = uint32(vfs.Namemax)
+	}
+	return 0
+}
+
+// handle is an open remote file. The file is opened again when the connection to the SFTP
+// server has been replaced.
+type handle struct {
+	fsys  *fileSystem
+	path  string
+	mu    sync.Mutex
+	flags int
+	// client is the client that file was opened with
+	client *sftp.Client
+	file   *sftp.File
+}
+
+var (
+	_ = (fs.FileReader)((*handle)(nil))
+	_ = (fs.FileWriter)((*handle)(nil))
+	_ = (fs.FileFlusher)((*handle)(nil))
+	_ = (fs.FileFsyncer)((*handle)(nil))
+	_ = (fs.FileReleaser)((*handle)(nil))
+)
+
+func (h *handle) open(ctx context.Context) error {
+	return h.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		_, err := h.fileFor(c)
+		return err
+	})
+}
+
+// fileFor returns the remote file, opening it using the given client unless it's already open
+// using that client.
+func (h *handle) fileFor(c *sftp.Client) (*sftp.File, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client == c {
+		return h.file, nil
+	}
+	if h.file != nil {
+		_ = h.file.Close()
+		h.client, h.file = nil, nil
+	}
+	f, err := c.OpenFile(h.path, h.flags)
+	if err != nil {
+		return nil, err
+	}
+	if h.flags&os.O_TRUNC != 0 {
+		h.fsys.invalidate(h.path)
+	}
+	// The file must not be created or truncated again when it's reopened.
+	h.flags &^= os.O_CREATE | os.O_EXCL | os.O_TRUNC
+	h.client, h.file = c, f
+	return f, nil
+}
+
+// block returns the data of the block with the given index, from the cache if possible.
+func (h *handle) block(ctx context.Context, index int64, version fileVersion) ([]byte, error) {
+	key := blockKey{path: h.path, index: index}
+	if data, ok := h.fsys.blocks.get(key, version); ok {
+		return data, nil
+	}
+	data := make([]byte, blockSize)
+	var n int
+	err := h.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		f, err := h.fileFor(c)
+		if err != nil {
+			return err
+		}
+		n, err = f.ReadAt(data, index*blockSize)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	data = data[:n]
+	h.fsys.blocks.put(key, version, data)
+	return data, nil
+}
+
+func (h *handle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	info, err := h.fsys.stat(ctx, h.path)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	version := versionOf(info)
+	n := 0
+	for n < len(dest) {
+		pos := off + int64(n)
+		if pos >= info.Size() {
+			break
+		}
+		index := pos / blockSize
+		data, err := h.block(ctx, index, version)
+		if err != nil {
+			return nil, toErrno(err)
+		}
+		bo := pos - index*blockSize
+		if bo >= int64(len(data)) {
+			break
+		}
+		n += copy(dest[n:], data[bo:])
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *handle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	var n int
+	err := h.fsys.remote.do(ctx, func(c *sftp.Client) error {
+		f, err := h.fileFor(c)
+		if err != nil {
+			return err
+		}
+		n, err = f.WriteAt(data, off)
+		return err
+	})
+	h.fsys.invalidate(h.path)
+	if err != nil {
+		return 0, toErrno(err)
+	}
+	return uint32(n), 0
+}
+
+// Flush is a no-op, because writes are sent to the SFTP server immediately.
+func (h *handle) Flush(context.Context) syscall.Errno {
+	return 0
+}
+
+// Fsync is a no-op, because the SFTP protocol has no means to sync a file.
+func (h *handle) Fsync(context.Context, uint32) syscall.Errno {
+	return 0
+}
+
+func (h *handle) Release(context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return 0
+	}
+	err := h.file.Close()
+	h.client, h.file = nil, nil
+	if err != nil && !errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		return toErrno(err)
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package sftpfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mountForTest mounts the given directory using in-process SFTP servers. A direct mount is used,
+// which requires root, so that the test doesn't depend on fusermount.
+func mountForTest(t *testing.T, remoteDir string) (string, *sftpServers) {
+	if os.Getuid() != 0 {
+		t.Skip("mounting requires root")
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("FUSE is not available")
+	}
+	mountPoint := t.TempDir()
+	servers := &sftpServers{}
+	remote := NewRemote(servers.dial)
+	timeout := attrTimeout
+	server, err := fs.Mount(mountPoint, &node{fsys: newFileSystem(remote, remoteDir)}, &fs.Options{
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		MountOptions: fuse.MountOptions{DirectMount: true, FsName: "telepresence", Name: "sftpfs"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Unmount()
+		_ = remote.Close()
+	})
+	return mountPoint, servers
+}
+
+func TestMount_ReadWrite(t *testing.T) {
+	remoteDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(remoteDir, "hello.txt"), []byte("hello world"), 0644))
+	mountPoint, _ := mountForTest(t, remoteDir)
+
+	data, err := os.ReadFile(filepath.Join(mountPoint, "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	require.NoError(t, os.Mkdir(filepath.Join(mountPoint, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mountPoint, "sub", "f.txt"), []byte("abc"), 0600))
+	data, err = os.ReadFile(filepath.Join(remoteDir, "sub", "f.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(data))
+
+	assert.True(t, os.IsExist(os.Mkdir(filepath.Join(mountPoint, "sub"), 0755)))
+	require.NoError(t, os.Rename(filepath.Join(mountPoint, "sub", "f.txt"), filepath.Join(mountPoint, "g.txt")))
+	require.NoError(t, os.Remove(filepath.Join(mountPoint, "sub")))
+	entries, err := os.ReadDir(mountPoint)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"g.txt", "hello.txt"}, names)
+
+	f, err := os.OpenFile(filepath.Join(mountPoint, "hello.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("!")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data, err = os.ReadFile(filepath.Join(remoteDir, "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(data))
+
+	require.NoError(t, os.Truncate(filepath.Join(mountPoint, "hello.txt"), 5))
+	data, err = os.ReadFile(filepath.Join(mountPoint, "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestMount_Reconnect(t *testing.T) {
+	remoteDir := t.TempDir()
+	big := make([]byte, 5*blockSize/2)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(remoteDir, "big"), big, 0644))
+	mountPoint, servers := mountForTest(t, remoteDir)
+
+	f, err := os.Open(filepath.Join(mountPoint, "big"))
+	require.NoError(t, err)
+	defer f.Close()
+	buf := make([]byte, blockSize)
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(t, err)
+
+	// The open file is reopened when the connection has been replaced
+	servers.kill()
+	time.Sleep(100 * time.Millisecond)
+	tail := make([]byte, len(big)-2*blockSize)
+	_, err = f.ReadAt(tail, 2*blockSize)
+	require.NoError(t, err)
+	assert.Equal(t, big[2*blockSize:], tail)
+	assert.Equal(t, 2, servers.count())
+}
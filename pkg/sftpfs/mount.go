@@ -0,0 +1,56 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package sftpfs
+
+import (
+	"context"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/datawire/dlib/dcontext"
+	"github.com/datawire/dlib/dlog"
+)
+
+// Mount mounts the directory root of the SFTP server of the given remote at the given mount point,
+// and serves the file system until the context is cancelled.
+func Mount(ctx context.Context, mountPoint, root string, remote *Remote) error {
+	timeout := attrTimeout
+	server, err := fs.Mount(mountPoint, &node{fsys: newFileSystem(remote, root)}, &fs.Options{
+		EntryTimeout:    &timeout,
+		AttrTimeout:     &timeout,
+		NegativeTimeout: &timeout,
+		MountOptions: fuse.MountOptions{
+			FsName: "telepresence",
+			Name:   "sftpfs",
+
+			// Needed to make --docker-run work as docker runs as root
+			Options: []string{"allow_root"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	served := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(served)
+	}()
+	select {
+	case <-served:
+		// Unmounted by someone else
+		return nil
+	case <-ctx.Done():
+	}
+	if err = server.Unmount(); err == nil {
+		<-served
+		return nil
+	}
+
+	// The file system is busy. Detach it, so that it's unmounted as soon as it's no longer in
+	// use, and leave the server running until then.
+	dlog.Errorf(ctx, "unable to unmount %s: %v", mountPoint, err)
+	return forceUnmount(dcontext.WithoutCancel(ctx), mountPoint)
+}
@@ -0,0 +1,28 @@
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+// CheckSupport returns an error if file systems cannot be mounted on this host.
+func CheckSupport() error {
+	if _, err := os.Stat("/Library/Filesystems/macfuse.fs/Contents/Resources/mount_macfuse"); err == nil {
+		return nil
+	}
+	// OSXFUSE changed to macFUSE and we've noticed that older versions of OSXFUSE
+	// can cause browsers to hang + kernel crashes, so we add an error to prevent
+	// our users from running into this problem.
+	if _, err := os.Stat("/Library/Filesystems/osxfuse.fs/Contents/Resources/mount_osxfuse"); err == nil {
+		return errors.New("macFUSE 4.0.5 or higher is required on your local machine")
+	}
+	return errors.New("macFUSE is not installed on your local machine")
+}
+
+// forceUnmount unmounts a busy file system.
+func forceUnmount(ctx context.Context, mountPoint string) error {
+	return dexec.CommandContext(ctx, "umount", "-f", mountPoint).Run()
+}
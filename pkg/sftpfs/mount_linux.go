@@ -0,0 +1,26 @@
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/datawire/dlib/dexec"
+)
+
+// CheckSupport returns an error if file systems cannot be mounted on this host.
+func CheckSupport() error {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		return errors.New("FUSE is not available on your local machine")
+	}
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		return errors.New("fusermount is not installed on your local machine")
+	}
+	return nil
+}
+
+// forceUnmount detaches a busy file system. It's unmounted as soon as it's no longer in use.
+func forceUnmount(ctx context.Context, mountPoint string) error {
+	return dexec.CommandContext(ctx, "fusermount", "-u", "-z", mountPoint).Run()
+}
@@ -0,0 +1,19 @@
+package sftpfs
+
+import (
+	"context"
+	"errors"
+)
+
+var errNotSupported = errors.New("FUSE mounts are not supported on windows")
+
+// CheckSupport returns an error, because the file system can't be mounted on Windows. The
+// sshfs-win program is used there instead.
+func CheckSupport() error {
+	return errNotSupported
+}
+
+// Mount returns an error, because the file system can't be mounted on Windows.
+func Mount(context.Context, string, string, *Remote) error {
+	return errNotSupported
+}
@@ -0,0 +1,119 @@
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// DialFunc dials a connection to an SFTP server.
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Remote is an SFTP client that connects lazily and reconnects when its connection is lost.
+type Remote struct {
+	mu     sync.Mutex
+	dial   DialFunc
+	client *sftp.Client
+	lost   chan struct{} // closed when the connection of client is lost
+}
+
+// NewRemote returns a Remote that uses the given function to dial the SFTP server. The function
+// can be nil when it's provided later using SetDialer.
+func NewRemote(dial DialFunc) *Remote {
+	return &Remote{dial: dial}
+}
+
+// SetDialer replaces the function that dials the SFTP server and drops the current connection, so
+// that the next request is sent to the new server. It's used when the pod that runs the server
+// is replaced.
+func (r *Remote) SetDialer(dial DialFunc) {
+	r.mu.Lock()
+	r.dial = dial
+	client := r.client
+	r.client = nil
+	r.mu.Unlock()
+	if client != nil {
+		_ = client.Close()
+	}
+}
+
+// Close closes the current connection, if any. A closed Remote reconnects on the next request.
+func (r *Remote) Close() error {
+	r.mu.Lock()
+	client := r.client
+	r.client = nil
+	r.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+// get returns the current client, and connects a new one if there is none.
+func (r *Remote) get(ctx context.Context) (*sftp.Client, <-chan struct{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client != nil {
+		return r.client, r.lost, nil
+	}
+	if r.dial == nil {
+		return nil, nil, errors.New("there is no SFTP server to connect to")
+	}
+	conn, err := r.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClientPipe(conn, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	lost := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(lost)
+		r.drop(client)
+	}()
+	r.client, r.lost = client, lost
+	return client, lost, nil
+}
+
+// drop forgets the given client, unless it has already been replaced.
+func (r *Remote) drop(client *sftp.Client) {
+	r.mu.Lock()
+	if r.client == client {
+		r.client = nil
+	}
+	r.mu.Unlock()
+}
+
+// do calls the given function with a connected client. The call is retried once using a new
+// connection when the connection is lost during the call.
+func (r *Remote) do(ctx context.Context, f func(*sftp.Client) error) error {
+	for retry := false; ; retry = true {
+		client, lost, err := r.get(ctx)
+		if err != nil {
+			return err
+		}
+		err = f(client)
+		if err == nil || retry || !connectionLost(err, lost) {
+			return err
+		}
+		r.drop(client)
+	}
+}
+
+func connectionLost(err error, lost <-chan struct{}) bool {
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+		return true
+	}
+	select {
+	case <-lost:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package sftpfs
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sftpServers dials in-process SFTP servers that serve the local file system.
+type sftpServers struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (s *sftpServers) dial(context.Context) (net.Conn, error) {
+	ours, theirs := net.Pipe()
+	srv, err := sftp.NewServer(theirs)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = srv.Serve()
+	}()
+	s.mu.Lock()
+	s.conns = append(s.conns, theirs)
+	s.mu.Unlock()
+	return ours, nil
+}
+
+func (s *sftpServers) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// kill closes the connection of the most recently dialed server.
+func (s *sftpServers) kill() {
+	s.mu.Lock()
+	_ = s.conns[len(s.conns)-1].Close()
+	s.mu.Unlock()
+}
+
+func statSize(ctx context.Context, t *testing.T, r *Remote, p string) int64 {
+	var info os.FileInfo
+	require.NoError(t, r.do(ctx, func(c *sftp.Client) (err error) {
+		info, err = c.Stat(p)
+		return err
+	}))
+	return info.Size()
+}
+
+func TestRemote_Reconnect(t *testing.T) {
+	ctx := context.Background()
+	p := filepath.Join(t.TempDir(), "hello.txt")
+	require.NoError(t, os.WriteFile(p, []byte("hello"), 0600))
+
+	servers := &sftpServers{}
+	r := NewRemote(servers.dial)
+	defer r.Close()
+
+	assert.Equal(t, int64(5), statSize(ctx, t, r, p))
+	assert.Equal(t, int64(5), statSize(ctx, t, r, p))
+	assert.Equal(t, 1, servers.count())
+
+	// The connection is lost when the pod that runs the server goes away.
+	servers.kill()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.client == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(5), statSize(ctx, t, r, p))
+	assert.Equal(t, 2, servers.count())
+}
+
+func TestRemote_SetDialer(t *testing.T) {
+	ctx := context.Background()
+	p := filepath.Join(t.TempDir(), "hello.txt")
+	require.NoError(t, os.WriteFile(p, []byte("hello"), 0600))
+
+	oldServers := &sftpServers{}
+	r := NewRemote(oldServers.dial)
+	defer r.Close()
+	assert.Equal(t, int64(5), statSize(ctx, t, r, p))
+
+	newServers := &sftpServers{}
+	r.SetDialer(newServers.dial)
+	assert.Equal(t, int64(5), statSize(ctx, t, r, p))
+	assert.Equal(t, 1, oldServers.count())
+	assert.Equal(t, 1, newServers.count())
+}
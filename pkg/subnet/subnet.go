@@ -3,6 +3,7 @@ package subnet
 
 import (
 	"bytes"
+	"encoding/binary"
 	"net"
 	"sort"
 )
@@ -173,3 +174,41 @@ func Covers(a, b *net.IPNet) bool {
 	}
 	return a.Contains(m)
 }
+
+// Overlaps returns true if the network ranges a and b have at least one IP in common
+func Overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// FindFree returns a subnet of the given size, expressed as the number of ones and bits of its
+// mask, that lies within one of the given pools and overlaps none of the subnets in avoid. The
+// pools are searched in order. Nil is returned when no such subnet exists. Only IPv4 is supported.
+func FindFree(ones, bits int, pools, avoid []*net.IPNet) *net.IPNet {
+	if bits != 32 {
+		return nil
+	}
+	mask := net.CIDRMask(ones, bits)
+	for _, pool := range pools {
+		poolIP := pool.IP.To4()
+		poolOnes, poolBits := pool.Mask.Size()
+		if poolIP == nil || poolBits != bits || poolOnes > ones {
+			continue
+		}
+		base := binary.BigEndian.Uint32(poolIP)
+		step := uint64(1) << (bits - ones)
+		count := uint64(1) << (ones - poolOnes)
+	candidates:
+		for i := uint64(0); i < count; i++ {
+			ip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(ip, base+uint32(i*step))
+			candidate := &net.IPNet{IP: ip, Mask: mask}
+			for _, sn := range avoid {
+				if Overlaps(candidate, sn) {
+					continue candidates
+				}
+			}
+			return candidate
+		}
+	}
+	return nil
+}
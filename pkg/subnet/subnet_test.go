@@ -187,3 +187,33 @@ func TestUnique(t *testing.T) {
 		})
 	}
 }
+
+func TestFindFree(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, sn, err := net.ParseCIDR(s)
+		require.NoError(t, err)
+		return sn
+	}
+	pools := []*net.IPNet{cidr("198.18.0.0/15"), cidr("10.0.0.0/8")}
+
+	// The first free block of the first pool that is large enough
+	assert.Equal(t, cidr("198.18.0.0/16"), FindFree(16, 32, pools, nil))
+	assert.Equal(t, cidr("198.19.0.0/16"), FindFree(16, 32, pools, []*net.IPNet{cidr("198.18.128.0/24")}))
+
+	// The first pool is too small
+	assert.Equal(t, cidr("10.0.0.0/12"), FindFree(12, 32, pools, nil))
+	assert.Equal(t, cidr("10.16.0.0/12"), FindFree(12, 32, pools, []*net.IPNet{cidr("10.0.0.0/16")}))
+
+	// Nothing is free
+	assert.Nil(t, FindFree(8, 32, pools, []*net.IPNet{cidr("10.1.0.0/16")}))
+	assert.Nil(t, FindFree(64, 128, pools, nil))
+}
+
+func TestOverlaps(t *testing.T) {
+	_, a, _ := net.ParseCIDR("10.0.0.0/8")
+	_, b, _ := net.ParseCIDR("10.1.0.0/16")
+	_, c, _ := net.ParseCIDR("192.168.0.0/16")
+	assert.True(t, Overlaps(a, b))
+	assert.True(t, Overlaps(b, a))
+	assert.False(t, Overlaps(a, c))
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadataCarrier makes gRPC metadata usable as a carrier of the trace context.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if vs := metadata.MD(c).Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// DialOptions returns the options that make a gRPC client create spans for its calls and
+// propagate the trace context to the server.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(streamClientInterceptor),
+	}
+}
+
+// ServerOptions returns the options that make a gRPC server create spans for the calls that it
+// serves, as children of the trace context propagated by the client.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryServerInterceptor),
+		grpc.ChainStreamInterceptor(streamServerInterceptor),
+	}
+}
+
+// rpcAttributes splits a full gRPC method name, such as "/telepresence.manager.Manager/Version",
+// into the span name and attributes of a call.
+func rpcAttributes(fullMethod string) (string, []attribute.KeyValue) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	if slash := strings.IndexByte(name, '/'); slash >= 0 {
+		attrs = append(attrs,
+			semconv.RPCServiceKey.String(name[:slash]),
+			semconv.RPCMethodKey.String(name[slash+1:]))
+	}
+	return name, attrs
+}
+
+func startClientSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	name, attrs := rpcAttributes(fullMethod)
+	ctx, span := tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = propagator.Extract(ctx, metadataCarrier(md))
+	}
+	name, attrs := rpcAttributes(fullMethod)
+	return tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+func unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	ctx, span := startClientSpan(ctx, method)
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	End(span, err)
+	return err
+}
+
+func streamClientInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	ctx, span := startClientSpan(ctx, method)
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	// The context of a client stream is cancelled when the stream ends.
+	go func() {
+		<-s.Context().Done()
+		span.End()
+	}()
+	return s, nil
+}
+
+func unaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, span := startServerSpan(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	End(span, err)
+	return resp, err
+}
+
+// tracedServerStream is a grpc.ServerStream with a context that contains the span of the call.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+	err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+	End(span, err)
+	return err
+}
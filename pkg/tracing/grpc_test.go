@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestInterceptors(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(ServerOptions()...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	ctx := context.Background()
+	opts := append([]grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+	}, DialOptions()...)
+	conn, err := grpc.DialContext(ctx, "bufnet", opts...)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, root := Start(ctx, "root")
+	client := healthpb.NewHealthClient(conn)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Error(t, err)
+	root.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 5)
+	byKind := make(map[trace.SpanKind][]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		assert.Equal(t, root.SpanContext().TraceID(), s.SpanContext().TraceID(), s.Name())
+		byKind[s.SpanKind()] = append(byKind[s.SpanKind()], s)
+	}
+	require.Len(t, byKind[trace.SpanKindClient], 2)
+	require.Len(t, byKind[trace.SpanKindServer], 2)
+	for i, cs := range byKind[trace.SpanKindClient] {
+		assert.Equal(t, "grpc.health.v1.Health/Check", cs.Name())
+		assert.Equal(t, root.SpanContext().SpanID(), cs.Parent().SpanID())
+		ss := byKind[trace.SpanKindServer][i]
+		assert.Equal(t, cs.SpanContext().SpanID(), ss.Parent().SpanID())
+		assert.True(t, ss.Parent().IsRemote())
+	}
+	assert.Contains(t, byKind[trace.SpanKindServer][1].Attributes(), semconv.RPCMethodKey.String("Check"))
+	assert.Equal(t, "Error", byKind[trace.SpanKindServer][1].Status().Code.String())
+}
@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// tracesPath is the path that an OTLP/HTTP collector receives traces on.
+const tracesPath = "/v1/traces"
+
+// exporter is a sdktrace.SpanExporter that sends spans to an OTLP/HTTP collector, using the
+// binary protobuf encoding.
+type exporter struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	shutDown bool
+}
+
+// NewExporter returns a span exporter that sends spans to the OTLP/HTTP collector at the given
+// endpoint, e.g. "http://localhost:4318". The spans are posted to the path of the endpoint, or to
+// /v1/traces when the endpoint has no path.
+func NewExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+	return &exporter{url: u.String(), client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (e *exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	shutDown := e.shutDown
+	e.mu.Unlock()
+	if shutDown || len(spans) == 0 {
+		return nil
+	}
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: resourceSpans(spans)})
+	if err != nil {
+		return err
+	}
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Content-Type", "application/x-protobuf")
+	rs, err := e.client.Do(rq)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, rs.Body)
+	rs.Body.Close()
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return fmt.Errorf("export of %d spans to %s failed: %s", len(spans), e.url, rs.Status)
+	}
+	return nil
+}
+
+func (e *exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	e.shutDown = true
+	e.mu.Unlock()
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// resourceSpans groups the given spans by resource and instrumentation library.
+func resourceSpans(spans []sdktrace.ReadOnlySpan) []*tracepb.ResourceSpans {
+	var rss []*tracepb.ResourceSpans
+	byResource := make(map[attribute.Distinct]*tracepb.ResourceSpans)
+	byLibrary := make(map[attribute.Distinct]map[string]*tracepb.InstrumentationLibrarySpans)
+	for _, s := range spans {
+		res := s.Resource()
+		key := res.Equivalent()
+		rs, ok := byResource[key]
+		if !ok {
+			rs = &tracepb.ResourceSpans{
+				Resource:  &resourcepb.Resource{Attributes: keyValues(res.Attributes())},
+				SchemaUrl: res.SchemaURL(),
+			}
+			rss = append(rss, rs)
+			byResource[key] = rs
+			byLibrary[key] = make(map[string]*tracepb.InstrumentationLibrarySpans)
+		}
+		lib := s.InstrumentationLibrary()
+		libKey := lib.Name + "@" + lib.Version
+		ils, ok := byLibrary[key][libKey]
+		if !ok {
+			ils = &tracepb.InstrumentationLibrarySpans{
+				InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: lib.Name, Version: lib.Version},
+				SchemaUrl:              lib.SchemaURL,
+			}
+			rs.InstrumentationLibrarySpans = append(rs.InstrumentationLibrarySpans, ils)
+			byLibrary[key][libKey] = ils
+		}
+		ils.Spans = append(ils.Spans, toSpan(s))
+	}
+	return rss
+}
+
+// toSpan converts the given span to its OTLP representation.
+func toSpan(s sdktrace.ReadOnlySpan) *tracepb.Span {
+	sc := s.SpanContext()
+	traceID := sc.TraceID()
+	spanID := sc.SpanID()
+	ps := &tracepb.Span{
+		TraceId:                traceID[:],
+		SpanId:                 spanID[:],
+		TraceState:             sc.TraceState().String(),
+		Name:                   s.Name(),
+		Kind:                   spanKind(s.SpanKind()),
+		StartTimeUnixNano:      uint64(s.StartTime().UnixNano()),
+		EndTimeUnixNano:        uint64(s.EndTime().UnixNano()),
+		Attributes:             keyValues(s.Attributes()),
+		DroppedAttributesCount: uint32(s.DroppedAttributes()),
+		DroppedEventsCount:     uint32(s.DroppedEvents()),
+		DroppedLinksCount:      uint32(s.DroppedLinks()),
+		Status:                 status(s.Status()),
+	}
+	if p := s.Parent(); p.HasSpanID() {
+		parentID := p.SpanID()
+		ps.ParentSpanId = parentID[:]
+	}
+	for _, ev := range s.Events() {
+		ps.Events = append(ps.Events, &tracepb.Span_Event{
+			TimeUnixNano:           uint64(ev.Time.UnixNano()),
+			Name:                   ev.Name,
+			Attributes:             keyValues(ev.Attributes),
+			DroppedAttributesCount: uint32(ev.DroppedAttributeCount),
+		})
+	}
+	for _, l := range s.Links() {
+		traceID := l.SpanContext.TraceID()
+		spanID := l.SpanContext.SpanID()
+		ps.Links = append(ps.Links, &tracepb.Span_Link{
+			TraceId:                traceID[:],
+			SpanId:                 spanID[:],
+			TraceState:             l.SpanContext.TraceState().String(),
+			Attributes:             keyValues(l.Attributes),
+			DroppedAttributesCount: uint32(l.DroppedAttributeCount),
+		})
+	}
+	return ps
+}
+
+func spanKind(kind trace.SpanKind) tracepb.Span_SpanKind {
+	switch kind {
+	case trace.SpanKindInternal:
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	case trace.SpanKindServer:
+		return tracepb.Span_SPAN_KIND_SERVER
+	case trace.SpanKindClient:
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case trace.SpanKindProducer:
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case trace.SpanKindConsumer:
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+}
+
+func status(st sdktrace.Status) *tracepb.Status {
+	ps := &tracepb.Status{Message: st.Description}
+	switch st.Code {
+	case codes.Ok:
+		ps.Code = tracepb.Status_STATUS_CODE_OK
+	case codes.Error:
+		ps.Code = tracepb.Status_STATUS_CODE_ERROR
+	}
+	return ps
+}
+
+func keyValues(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]*commonpb.KeyValue, len(attrs))
+	for i, a := range attrs {
+		kvs[i] = &commonpb.KeyValue{Key: string(a.Key), Value: anyValue(a.Value)}
+	}
+	return kvs
+}
+
+func anyValue(v attribute.Value) *commonpb.AnyValue {
+	av := &commonpb.AnyValue{}
+	switch v.Type() {
+	case attribute.BOOL:
+		av.Value = &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}
+	case attribute.INT64:
+		av.Value = &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}
+	case attribute.FLOAT64:
+		av.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}
+	case attribute.STRING:
+		av.Value = &commonpb.AnyValue_StringValue{StringValue: v.AsString()}
+	case attribute.BOOLSLICE:
+		bs := v.AsBoolSlice()
+		vs := make([]*commonpb.AnyValue, len(bs))
+		for i, b := range bs {
+			vs[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: b}}
+		}
+		av.Value = &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: vs}}
+	case attribute.INT64SLICE:
+		is := v.AsInt64Slice()
+		vs := make([]*commonpb.AnyValue, len(is))
+		for i, n := range is {
+			vs[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: n}}
+		}
+		av.Value = &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: vs}}
+	case attribute.FLOAT64SLICE:
+		fs := v.AsFloat64Slice()
+		vs := make([]*commonpb.AnyValue, len(fs))
+		for i, f := range fs {
+			vs[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+		}
+		av.Value = &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: vs}}
+	case attribute.STRINGSLICE:
+		ss := v.AsStringSlice()
+		vs := make([]*commonpb.AnyValue, len(ss))
+		for i, s := range ss {
+			vs[i] = &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+		}
+		av.Value = &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: vs}}
+	default:
+		av.Value = &commonpb.AnyValue_StringValue{StringValue: v.Emit()}
+	}
+	return av
+}
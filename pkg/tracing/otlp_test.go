@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewExporter(t *testing.T) {
+	for _, ep := range []string{"", "localhost:4318", "grpc://localhost:4317", "http://"} {
+		_, err := NewExporter(ep)
+		assert.Error(t, err, ep)
+	}
+	e, err := NewExporter("http://localhost:4318")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:4318/v1/traces", e.(*exporter).url)
+	e, err = NewExporter("https://collector.example.com/otlp/traces")
+	require.NoError(t, err)
+	assert.Equal(t, "https://collector.example.com/otlp/traces", e.(*exporter).url)
+}
+
+// collectorStub is an OTLP/HTTP collector that records the requests that it receives.
+func collectorStub(t *testing.T) (*httptest.Server, <-chan *coltracepb.ExportTraceServiceRequest) {
+	rqs := make(chan *coltracepb.ExportTraceServiceRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, tracesPath, r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		data, err := io.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rq := &coltracepb.ExportTraceServiceRequest{}
+		if !assert.NoError(t, proto.Unmarshal(data, rq)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rqs <- rq
+	}))
+	t.Cleanup(srv.Close)
+	return srv, rqs
+}
+
+func TestExporter(t *testing.T) {
+	srv, rqs := collectorStub(t)
+	ctx := context.Background()
+	shutdown, err := Init(ctx, "test", srv.URL)
+	require.NoError(t, err)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx, parent := Start(ctx, "parent", attribute.String("str", "value"), attribute.Int64Slice("ints", []int64{1, 2}))
+	_, child := Start(ctx, "child")
+	End(child, assert.AnError)
+	End(parent, nil)
+	require.NoError(t, shutdown(ctx))
+
+	var rq *coltracepb.ExportTraceServiceRequest
+	select {
+	case rq = <-rqs:
+	default:
+		t.Fatal("collector received no spans")
+	}
+	require.Len(t, rq.ResourceSpans, 1)
+	rs := rq.ResourceSpans[0]
+	var service string
+	for _, kv := range rs.Resource.Attributes {
+		if kv.Key == "service.name" {
+			service = kv.Value.GetStringValue()
+		}
+	}
+	assert.Equal(t, "test", service)
+
+	require.Len(t, rs.InstrumentationLibrarySpans, 1)
+	ils := rs.InstrumentationLibrarySpans[0]
+	assert.Equal(t, instrumentationName, ils.InstrumentationLibrary.Name)
+	require.Len(t, ils.Spans, 2)
+	cs, ps := ils.Spans[0], ils.Spans[1]
+	assert.Equal(t, "child", cs.Name)
+	assert.Equal(t, "parent", ps.Name)
+	assert.Equal(t, ps.TraceId, cs.TraceId)
+	assert.Equal(t, ps.SpanId, cs.ParentSpanId)
+	assert.Empty(t, ps.ParentSpanId)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, cs.Status.Code)
+	assert.Equal(t, assert.AnError.Error(), cs.Status.Message)
+	require.Len(t, cs.Events, 1)
+	assert.Equal(t, "exception", cs.Events[0].Name)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_UNSET, ps.Status.Code)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, ps.Kind)
+
+	require.Len(t, ps.Attributes, 2)
+	assert.Equal(t, "str", ps.Attributes[0].Key)
+	assert.Equal(t, "value", ps.Attributes[0].Value.GetStringValue())
+	assert.Equal(t, "ints", ps.Attributes[1].Key)
+	ints := ps.Attributes[1].Value.GetArrayValue().GetValues()
+	require.Len(t, ints, 2)
+	assert.Equal(t, int64(2), ints[1].GetIntValue())
+}
+
+func TestExporter_failure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	e, err := NewExporter(srv.URL)
+	require.NoError(t, err)
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	_, span := tp.Tracer("test").Start(context.Background(), "span", trace.WithSpanKind(trace.SpanKindServer))
+	span.SetStatus(codes.Ok, "")
+	span.End()
+
+	ctx := context.Background()
+	assert.NoError(t, e.ExportSpans(ctx, nil))
+	assert.Error(t, e.ExportSpans(ctx, sr.Ended()))
+	require.NoError(t, e.Shutdown(ctx))
+	assert.NoError(t, e.ExportSpans(ctx, sr.Ended()))
+}
+
+func TestSpan(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	_, span := tp.Tracer("test").Start(context.Background(), "span", trace.WithSpanKind(trace.SpanKindServer))
+	span.SetStatus(codes.Ok, "")
+	span.End()
+	require.Len(t, sr.Ended(), 1)
+	ps := toSpan(sr.Ended()[0])
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, ps.Kind)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_OK, ps.Status.Code)
+	assert.Len(t, ps.TraceId, 16)
+	assert.Len(t, ps.SpanId, 8)
+}
@@ -0,0 +1,67 @@
+// Package tracing provides the OpenTelemetry tracing of the telepresence CLI, its daemons, the
+// traffic-manager, and the traffic-agents. The trace context is propagated through the gRPC calls
+// between them, and the spans are exported to an OTLP/HTTP endpoint.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/version"
+)
+
+const instrumentationName = "github.com/telepresenceio/telepresence/v2"
+
+// propagator is used to propagate the trace context, regardless of whether the process exports
+// spans, so that a process without an exporter doesn't break the trace.
+var propagator = propagation.TraceContext{}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start creates a span with the given name and attributes, and a context that contains it. The
+// span must be ended, typically using End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the given error, if any, in the given span and then ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Init installs a global tracer provider that exports the spans of the given service to the given
+// OTLP/HTTP endpoint. Nothing is installed when the endpoint is empty. The returned function flushes
+// any spans that haven't been exported yet and stops the export. It must be called before the
+// process exits.
+func Init(ctx context.Context, serviceName, endpoint string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exp, err := NewExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(version.Version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
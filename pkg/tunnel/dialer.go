@@ -10,9 +10,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/datawire/dlib/dlog"
 	rpc "github.com/telepresenceio/telepresence/rpc/v2/manager"
 	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/tracing"
 )
 
 // The idleDuration controls how long a dialer for a specific proto+from-to address combination remains alive without
@@ -28,6 +31,21 @@ const (
 	disconnecting
 )
 
+// dialedConns maps the local address of each connection that a dialer in this process has established
+// to the ConnID of the tunneled connection, so that the original peer of an intercepted connection can
+// be found by the process that the dialer connects to.
+var dialedConns sync.Map
+
+// DialedConnID returns the ConnID of the tunneled connection that a dialer in this process has
+// established from the given local address. The source of the ConnID is the original peer of the
+// connection.
+func DialedConnID(localAddr net.Addr) (ConnID, bool) {
+	if id, ok := dialedConns.Load(localAddr.String()); ok {
+		return id.(ConnID), true
+	}
+	return "", false
+}
+
 // The dialer takes care of dispatching messages between gRPC and UDP connections
 type dialer struct {
 	stream    Stream
@@ -78,7 +96,9 @@ func (h *dialer) Start(ctx context.Context) {
 
 			dlog.Debugf(ctx, "   CONN %s, dialing", id)
 			d := net.Dialer{Timeout: h.stream.DialTimeout()}
-			conn, err := d.DialContext(ctx, id.ProtocolString(), id.DestinationAddr().String())
+			dc, span := tracing.Start(ctx, "tunnel.Dial", attribute.String("telepresence.conn_id", id.String()))
+			conn, err := d.DialContext(dc, id.ProtocolString(), id.DestinationAddr().String())
+			tracing.End(span, err)
 			if err != nil {
 				dlog.Errorf(ctx, "!! CONN %s, failed to establish connection: %v", id, err)
 				if err = h.stream.Send(ctx, NewMessage(DialReject, nil)); err != nil {
@@ -87,6 +107,9 @@ func (h *dialer) Start(ctx context.Context) {
 				h.connected = notConnected
 				return
 			}
+			localAddr := conn.LocalAddr().String()
+			dialedConns.Store(localAddr, id)
+			defer dialedConns.Delete(localAddr)
 			if err = h.stream.Send(ctx, NewMessage(DialOK, nil)); err != nil {
 				_ = conn.Close()
 				dlog.Errorf(ctx, "!! CONN %s, failed to send DialOK: %v", id, err)
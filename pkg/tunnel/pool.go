@@ -187,6 +187,14 @@ func (p *Pool) GetOrCreateTCP(ctx context.Context, id ConnID, createHandler Hand
 	return handler, false, nil
 }
 
+// Len returns the number of handlers in the pool.
+func (p *Pool) Len() int {
+	p.lock.RLock()
+	count := len(p.handlers)
+	p.lock.RUnlock()
+	return count
+}
+
 func (p *Pool) CloseAll(ctx context.Context) {
 	p.lock.RLock()
 	handlers := make([]Handler, len(p.handlers))
@@ -0,0 +1,116 @@
+// Package nat contains the translation between the subnets of a cluster and the virtual subnets
+// that they are routed as when they conflict with subnets that are already routed by the host.
+package nat
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+// Mapping maps a subnet of the cluster to a virtual subnet of the same size.
+type Mapping struct {
+	Cluster *net.IPNet
+	Virtual *net.IPNet
+}
+
+func (m *Mapping) String() string {
+	return m.Cluster.String() + " -> " + m.Virtual.String()
+}
+
+// ToCluster returns the cluster IP of the given virtual IP, or nil if the IP isn't in the
+// virtual subnet.
+func (m *Mapping) ToCluster(ip net.IP) net.IP {
+	return translate(ip, m.Virtual, m.Cluster)
+}
+
+// ToVirtual returns the virtual IP of the given cluster IP, or nil if the IP isn't in the
+// cluster subnet.
+func (m *Mapping) ToVirtual(ip net.IP) net.IP {
+	return translate(ip, m.Cluster, m.Virtual)
+}
+
+// translate replaces the network part of an IP in from with the network part of to. Both subnets
+// must be IPv4 subnets of the same size.
+func translate(ip net.IP, from, to *net.IPNet) net.IP {
+	ip4 := ip.To4()
+	fromIP := from.IP.To4()
+	toIP := to.IP.To4()
+	if ip4 == nil || fromIP == nil || toIP == nil || !from.Contains(ip4) {
+		return nil
+	}
+	host := binary.BigEndian.Uint32(ip4) - binary.BigEndian.Uint32(fromIP)
+	result := make(net.IP, 4)
+	binary.BigEndian.PutUint32(result, binary.BigEndian.Uint32(toIP)+host)
+	return result
+}
+
+// Table is a set of mappings that is safe for concurrent use.
+type Table struct {
+	lock     sync.RWMutex
+	mappings []*Mapping
+}
+
+// Set replaces the mappings of the table.
+func (t *Table) Set(mappings []*Mapping) {
+	t.lock.Lock()
+	t.mappings = mappings
+	t.lock.Unlock()
+}
+
+// Mappings returns the mappings of the table.
+func (t *Table) Mappings() []*Mapping {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.mappings
+}
+
+// Find returns the mapping for the given cluster subnet, or nil if there is none.
+func (t *Table) Find(cluster *net.IPNet) *Mapping {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, m := range t.mappings {
+		if m.Cluster.IP.Equal(cluster.IP) && net.IP(m.Cluster.Mask).Equal(net.IP(cluster.Mask)) {
+			return m
+		}
+	}
+	return nil
+}
+
+// ToCluster returns the cluster IP of the given IP. The IP is returned unchanged when it isn't in
+// a virtual subnet.
+func (t *Table) ToCluster(ip net.IP) net.IP {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, m := range t.mappings {
+		if cip := m.ToCluster(ip); cip != nil {
+			return cip
+		}
+	}
+	return ip
+}
+
+// ToVirtual returns the virtual IP of the given IP. The IP is returned unchanged when it isn't in
+// a remapped cluster subnet.
+func (t *Table) ToVirtual(ip net.IP) net.IP {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for _, m := range t.mappings {
+		if vip := m.ToVirtual(ip); vip != nil {
+			return vip
+		}
+	}
+	return ip
+}
+
+// ConnIDToCluster returns the given ConnID with its destination translated to the cluster IP.
+func (t *Table) ConnIDToCluster(id tunnel.ConnID) tunnel.ConnID {
+	dst := id.Destination()
+	cdst := t.ToCluster(dst)
+	if cdst.Equal(dst) {
+		return id
+	}
+	return tunnel.NewConnID(id.Protocol(), id.Source(), cdst, id.SourcePort(), id.DestinationPort())
+}
@@ -0,0 +1,44 @@
+package nat
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/telepresenceio/telepresence/v2/pkg/ipproto"
+	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
+	"github.com/telepresenceio/telepresence/v2/pkg/tunnel"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	_, sn, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return sn
+}
+
+func TestTable(t *testing.T) {
+	tbl := &Table{}
+	assert.Equal(t, iputil.Parse("10.0.1.2"), tbl.ToVirtual(iputil.Parse("10.0.1.2")))
+
+	m := &Mapping{Cluster: cidr(t, "10.0.0.0/16"), Virtual: cidr(t, "198.18.0.0/16")}
+	tbl.Set([]*Mapping{m})
+	assert.Equal(t, m, tbl.Find(cidr(t, "10.0.0.0/16")))
+	assert.Nil(t, tbl.Find(cidr(t, "10.0.0.0/24")))
+
+	assert.True(t, iputil.Parse("198.18.1.2").Equal(tbl.ToVirtual(iputil.Parse("10.0.1.2"))))
+	assert.True(t, iputil.Parse("10.0.1.2").Equal(tbl.ToCluster(iputil.Parse("198.18.1.2"))))
+
+	// IPs outside the mapped subnets are unchanged
+	assert.True(t, iputil.Parse("10.1.1.2").Equal(tbl.ToVirtual(iputil.Parse("10.1.1.2"))))
+	assert.True(t, iputil.Parse("198.19.1.2").Equal(tbl.ToCluster(iputil.Parse("198.19.1.2"))))
+
+	id := tunnel.NewConnID(ipproto.TCP, iputil.Parse("192.168.0.1"), iputil.Parse("198.18.1.2"), 4711, 80)
+	cid := tbl.ConnIDToCluster(id)
+	assert.True(t, iputil.Parse("10.0.1.2").Equal(cid.Destination()))
+	assert.True(t, iputil.Parse("192.168.0.1").Equal(cid.Source()))
+	assert.Equal(t, uint16(4711), cid.SourcePort())
+	assert.Equal(t, uint16(80), cid.DestinationPort())
+	assert.Equal(t, ipproto.TCP, cid.Protocol())
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/datawire/dlib/dexec"
 	"github.com/datawire/dlib/dlog"
@@ -58,3 +60,71 @@ func GetRoute(ctx context.Context, routedNet *net.IPNet) (Route, error) {
 	}
 	return Route{}, fmt.Errorf("interface %s has no local addresses; do not know how to route", ifaceName)
 }
+
+// GetRoutingTable returns the IPv4 routes of the host's routing table. The default route is not
+// included.
+func GetRoutingTable(ctx context.Context) ([]Route, error) {
+	cmd := dexec.CommandContext(ctx, "netstat", "-rn", "-f", "inet")
+	cmd.DisableLogging = true
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run 'netstat -rn -f inet': %w", err)
+	}
+	var routes []Route
+	for _, line := range strings.Split(string(out), "\n") {
+		// Destination Gateway Flags Netif Expire
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] == "default" {
+			continue
+		}
+		routedNet := parseDestination(fields[0])
+		if routedNet == nil {
+			continue
+		}
+		iface, err := net.InterfaceByName(fields[3])
+		if err != nil {
+			continue
+		}
+		routes = append(routes, Route{
+			RoutedNet: routedNet,
+			Interface: iface,
+			Gateway:   iputil.Parse(fields[1]),
+		})
+	}
+	return routes, nil
+}
+
+// parseDestination parses a destination in the abbreviated form used by netstat, where trailing
+// zero octets may be omitted (e.g. "10/8", or "192.168.1" which means 192.168.1.0/24). A
+// destination without a mask is a host route unless octets were omitted. Link-local scoped
+// destinations such as "169.254.1.1%en0" are not supported.
+func parseDestination(dest string) *net.IPNet {
+	if strings.ContainsRune(dest, '%') {
+		return nil
+	}
+	addr := dest
+	ones := -1
+	if slash := strings.IndexByte(dest, '/'); slash >= 0 {
+		var err error
+		if ones, err = strconv.Atoi(dest[slash+1:]); err != nil || ones < 0 || ones > 32 {
+			return nil
+		}
+		addr = dest[:slash]
+	}
+	octets := strings.Split(addr, ".")
+	if len(octets) > 4 {
+		return nil
+	}
+	if ones < 0 {
+		ones = 8 * len(octets)
+	}
+	for len(octets) < 4 {
+		octets = append(octets, "0")
+	}
+	ip := iputil.Parse(strings.Join(octets, "."))
+	if ip == nil || ip.To4() == nil {
+		return nil
+	}
+	mask := net.CIDRMask(ones, 32)
+	return &net.IPNet{IP: ip.To4().Mask(mask), Mask: mask}
+}
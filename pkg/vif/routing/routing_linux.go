@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strings"
 
 	"github.com/datawire/dlib/dexec"
 	"github.com/telepresenceio/telepresence/v2/pkg/iputil"
@@ -45,3 +46,61 @@ func GetRoute(ctx context.Context, routedNet *net.IPNet) (Route, error) {
 		LocalIP:   localIP,
 	}, nil
 }
+
+// GetRoutingTable returns the IPv4 routes of the host's main routing table. The default route is
+// not included.
+func GetRoutingTable(ctx context.Context) ([]Route, error) {
+	cmd := dexec.CommandContext(ctx, "ip", "-4", "route", "show")
+	cmd.DisableLogging = true
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routing table: %w", err)
+	}
+	var routes []Route
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "default" {
+			continue
+		}
+		routedNet := parseDestination(fields[0])
+		if routedNet == nil {
+			continue
+		}
+		route := Route{RoutedNet: routedNet}
+		for i := 1; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "via":
+				route.Gateway = iputil.Parse(fields[i+1])
+			case "src":
+				route.LocalIP = iputil.Parse(fields[i+1])
+			case "dev":
+				route.Interface, _ = net.InterfaceByName(fields[i+1])
+			}
+		}
+		if route.Interface == nil {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// parseDestination parses a destination that is either a CIDR or an IP. An IP is treated as a
+// host route.
+func parseDestination(dest string) *net.IPNet {
+	if strings.ContainsRune(dest, '/') {
+		_, routedNet, err := net.ParseCIDR(dest)
+		if err != nil {
+			return nil
+		}
+		return routedNet
+	}
+	ip := iputil.Parse(dest)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
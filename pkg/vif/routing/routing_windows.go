@@ -53,3 +53,42 @@ $obj.InterfaceIndex[0]
 		RoutedNet: routedNet,
 	}, nil
 }
+
+// GetRoutingTable returns the IPv4 routes of the host's routing table. The default route is not
+// included.
+func GetRoutingTable(ctx context.Context) ([]Route, error) {
+	pshScript := `
+Get-NetRoute -AddressFamily IPv4 | ForEach-Object { "$($_.DestinationPrefix) $($_.NextHop) $($_.InterfaceIndex)" }
+`
+	cmd := dexec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", pshScript)
+	cmd.DisableLogging = true
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to run 'Get-NetRoute -AddressFamily IPv4': %w", err)
+	}
+	var routes []Route
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] == "0.0.0.0/0" {
+			continue
+		}
+		_, routedNet, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			continue
+		}
+		interfaceIndex, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		iface, err := net.InterfaceByIndex(interfaceIndex)
+		if err != nil {
+			continue
+		}
+		routes = append(routes, Route{
+			RoutedNet: routedNet,
+			Interface: iface,
+			Gateway:   iputil.Parse(fields[1]),
+		})
+	}
+	return routes, nil
+}
@@ -39,6 +39,10 @@ type ConnectorClient interface {
 	// Deactivates and removes an existent workload intercept.
 	// Requires having already called Connect.
 	RemoveIntercept(ctx context.Context, in *manager.RemoveInterceptRequest2, opts ...grpc.CallOption) (*InterceptResult, error)
+	// Streams the traffic events of an intercept until the intercept is
+	// removed. No need to set the session of the request; the connector
+	// will fill that in for you.
+	WatchInterceptEvents(ctx context.Context, in *manager.InterceptEventsRequest, opts ...grpc.CallOption) (Connector_WatchInterceptEventsClient, error)
 	// Uninstalls traffic-agents and traffic-manager from the cluster.
 	// Requires having already called Connect.
 	Uninstall(ctx context.Context, in *UninstallRequest, opts ...grpc.CallOption) (*UninstallResult, error)
@@ -58,6 +62,9 @@ type ConnectorClient interface {
 	SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// Quits (terminates) the connector process.
 	Quit(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Disconnect closes a named connection that was created by a Connect call
+	// with a name.
+	Disconnect(ctx context.Context, in *DisconnectRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type connectorClient struct {
@@ -113,6 +120,38 @@ func (c *connectorClient) RemoveIntercept(ctx context.Context, in *manager.Remov
 	return out, nil
 }
 
+func (c *connectorClient) WatchInterceptEvents(ctx context.Context, in *manager.InterceptEventsRequest, opts ...grpc.CallOption) (Connector_WatchInterceptEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[0], "/telepresence.connector.Connector/WatchInterceptEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &connectorWatchInterceptEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Connector_WatchInterceptEventsClient interface {
+	Recv() (*manager.InterceptEvent, error)
+	grpc.ClientStream
+}
+
+type connectorWatchInterceptEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *connectorWatchInterceptEventsClient) Recv() (*manager.InterceptEvent, error) {
+	m := new(manager.InterceptEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *connectorClient) Uninstall(ctx context.Context, in *UninstallRequest, opts ...grpc.CallOption) (*UninstallResult, error) {
 	out := new(UninstallResult)
 	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/Uninstall", in, out, opts...)
@@ -132,7 +171,7 @@ func (c *connectorClient) List(ctx context.Context, in *ListRequest, opts ...grp
 }
 
 func (c *connectorClient) UserNotifications(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Connector_UserNotificationsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[0], "/telepresence.connector.Connector/UserNotifications", opts...)
+	stream, err := c.cc.NewStream(ctx, &Connector_ServiceDesc.Streams[1], "/telepresence.connector.Connector/UserNotifications", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -226,6 +265,15 @@ func (c *connectorClient) Quit(ctx context.Context, in *emptypb.Empty, opts ...g
 	return out, nil
 }
 
+func (c *connectorClient) Disconnect(ctx context.Context, in *DisconnectRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.connector.Connector/Disconnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ConnectorServer is the server API for Connector service.
 // All implementations must embed UnimplementedConnectorServer
 // for forward compatibility
@@ -248,6 +296,10 @@ type ConnectorServer interface {
 	// Deactivates and removes an existent workload intercept.
 	// Requires having already called Connect.
 	RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*InterceptResult, error)
+	// Streams the traffic events of an intercept until the intercept is
+	// removed. No need to set the session of the request; the connector
+	// will fill that in for you.
+	WatchInterceptEvents(*manager.InterceptEventsRequest, Connector_WatchInterceptEventsServer) error
 	// Uninstalls traffic-agents and traffic-manager from the cluster.
 	// Requires having already called Connect.
 	Uninstall(context.Context, *UninstallRequest) (*UninstallResult, error)
@@ -267,6 +319,9 @@ type ConnectorServer interface {
 	SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error)
 	// Quits (terminates) the connector process.
 	Quit(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	// Disconnect closes a named connection that was created by a Connect call
+	// with a name.
+	Disconnect(context.Context, *DisconnectRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedConnectorServer()
 }
 
@@ -289,6 +344,9 @@ func (UnimplementedConnectorServer) CreateIntercept(context.Context, *CreateInte
 func (UnimplementedConnectorServer) RemoveIntercept(context.Context, *manager.RemoveInterceptRequest2) (*InterceptResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RemoveIntercept not implemented")
 }
+func (UnimplementedConnectorServer) WatchInterceptEvents(*manager.InterceptEventsRequest, Connector_WatchInterceptEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchInterceptEvents not implemented")
+}
 func (UnimplementedConnectorServer) Uninstall(context.Context, *UninstallRequest) (*UninstallResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Uninstall not implemented")
 }
@@ -319,6 +377,9 @@ func (UnimplementedConnectorServer) SetLogLevel(context.Context, *manager.LogLev
 func (UnimplementedConnectorServer) Quit(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Quit not implemented")
 }
+func (UnimplementedConnectorServer) Disconnect(context.Context, *DisconnectRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Disconnect not implemented")
+}
 func (UnimplementedConnectorServer) mustEmbedUnimplementedConnectorServer() {}
 
 // UnsafeConnectorServer may be embedded to opt out of forward compatibility for this service.
@@ -422,6 +483,27 @@ func _Connector_RemoveIntercept_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_WatchInterceptEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(manager.InterceptEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConnectorServer).WatchInterceptEvents(m, &connectorWatchInterceptEventsServer{stream})
+}
+
+type Connector_WatchInterceptEventsServer interface {
+	Send(*manager.InterceptEvent) error
+	grpc.ServerStream
+}
+
+type connectorWatchInterceptEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *connectorWatchInterceptEventsServer) Send(m *manager.InterceptEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Connector_Uninstall_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UninstallRequest)
 	if err := dec(in); err != nil {
@@ -605,6 +687,24 @@ func _Connector_Quit_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Connector_Disconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisconnectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConnectorServer).Disconnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.connector.Connector/Disconnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConnectorServer).Disconnect(ctx, req.(*DisconnectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Connector_ServiceDesc is the grpc.ServiceDesc for Connector service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -668,8 +768,17 @@ var Connector_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Quit",
 			Handler:    _Connector_Quit_Handler,
 		},
+		{
+			MethodName: "Disconnect",
+			Handler:    _Connector_Disconnect_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchInterceptEvents",
+			Handler:       _Connector_WatchInterceptEvents_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "UserNotifications",
 			Handler:       _Connector_UserNotifications_Handler,
@@ -31,6 +31,9 @@ type DaemonClient interface {
 	SetOutboundInfo(ctx context.Context, in *OutboundInfo, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// SetDnsSearchPath sets a new search path.
 	SetDnsSearchPath(ctx context.Context, in *Paths, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Disconnect removes the routes and DNS configuration of a named
+	// connection.
+	Disconnect(ctx context.Context, in *DisconnectRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined b the request.
 	SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
@@ -88,6 +91,15 @@ func (c *daemonClient) SetDnsSearchPath(ctx context.Context, in *Paths, opts ...
 	return out, nil
 }
 
+func (c *daemonClient) Disconnect(ctx context.Context, in *DisconnectRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/Disconnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *daemonClient) SetLogLevel(ctx context.Context, in *manager.LogLevelRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
 	out := new(emptypb.Empty)
 	err := c.cc.Invoke(ctx, "/telepresence.daemon.Daemon/SetLogLevel", in, out, opts...)
@@ -111,6 +123,9 @@ type DaemonServer interface {
 	SetOutboundInfo(context.Context, *OutboundInfo) (*emptypb.Empty, error)
 	// SetDnsSearchPath sets a new search path.
 	SetDnsSearchPath(context.Context, *Paths) (*emptypb.Empty, error)
+	// Disconnect removes the routes and DNS configuration of a named
+	// connection.
+	Disconnect(context.Context, *DisconnectRequest) (*emptypb.Empty, error)
 	// SetLogLevel will temporarily set the log-level for the daemon for a duration that is determined b the request.
 	SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedDaemonServer()
@@ -135,6 +150,9 @@ func (UnimplementedDaemonServer) SetOutboundInfo(context.Context, *OutboundInfo)
 func (UnimplementedDaemonServer) SetDnsSearchPath(context.Context, *Paths) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetDnsSearchPath not implemented")
 }
+func (UnimplementedDaemonServer) Disconnect(context.Context, *DisconnectRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Disconnect not implemented")
+}
 func (UnimplementedDaemonServer) SetLogLevel(context.Context, *manager.LogLevelRequest) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
 }
@@ -241,6 +259,24 @@ func _Daemon_SetDnsSearchPath_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Daemon_Disconnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DisconnectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).Disconnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.daemon.Daemon/Disconnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).Disconnect(ctx, req.(*DisconnectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Daemon_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(manager.LogLevelRequest)
 	if err := dec(in); err != nil {
@@ -286,6 +322,10 @@ var Daemon_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SetDnsSearchPath",
 			Handler:    _Daemon_SetDnsSearchPath_Handler,
 		},
+		{
+			MethodName: "Disconnect",
+			Handler:    _Daemon_Disconnect_Handler,
+		},
 		{
 			MethodName: "SetLogLevel",
 			Handler:    _Daemon_SetLogLevel_Handler,
@@ -69,6 +69,10 @@ type ManagerClient interface {
 	// RemoveIntercept lets a client remove an intercept.
 	RemoveIntercept(ctx context.Context, in *RemoveInterceptRequest2, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	UpdateIntercept(ctx context.Context, in *UpdateInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error)
+	// ReportInterceptHealth lets a client report the health of the local
+	// process that handles one of its intercepts. It moves an "ACTIVE"
+	// intercept to "UNHEALTHY" and back. Other dispositions are retained.
+	ReportInterceptHealth(ctx context.Context, in *InterceptHealthRequest, opts ...grpc.CallOption) (*InterceptInfo, error)
 	// GetIntercept gets info from intercept name
 	GetIntercept(ctx context.Context, in *GetInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error)
 	// ReviewIntercept lets an agent approve or reject an intercept by
@@ -90,6 +94,23 @@ type ManagerClient interface {
 	AgentLookupHostResponse(ctx context.Context, in *LookupHostAgentResponse, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	// WatchLookupHost lets an agent receive lookup requests
 	WatchLookupHost(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchLookupHostClient, error)
+	// LookupDNS performs a DNS query of any type in the cluster and returns
+	// the full RR set of the answer. If the caller has intercepts active, the
+	// query will be performed from the intercepted pods.
+	LookupDNS(ctx context.Context, in *DNSRequest, opts ...grpc.CallOption) (*DNSResponse, error)
+	// AgentLookupDNSResponse lets an agent respond to DNS queries
+	AgentLookupDNSResponse(ctx context.Context, in *DNSAgentResponse, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// WatchLookupDNS lets an agent receive DNS queries
+	WatchLookupDNS(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchLookupDNSClient, error)
+	// ReportInterceptEvents lets an agent report the traffic that it routes
+	// to intercepts.
+	ReportInterceptEvents(ctx context.Context, opts ...grpc.CallOption) (Manager_ReportInterceptEventsClient, error)
+	// WatchInterceptEvents streams the traffic events of one of the caller's
+	// intercepts. The stream ends when the intercept is removed.
+	WatchInterceptEvents(ctx context.Context, in *InterceptEventsRequest, opts ...grpc.CallOption) (Manager_WatchInterceptEventsClient, error)
+	// WatchNotifications streams the notifications that concern the caller,
+	// such as warnings about intercepts that are about to expire.
+	WatchNotifications(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchNotificationsClient, error)
 	// WatchLogLevel lets an agent receive log-level updates
 	WatchLogLevel(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Manager_WatchLogLevelClient, error)
 	// A Tunnel represents one single connection where the client or
@@ -331,6 +352,15 @@ func (c *managerClient) UpdateIntercept(ctx context.Context, in *UpdateIntercept
 	return out, nil
 }
 
+func (c *managerClient) ReportInterceptHealth(ctx context.Context, in *InterceptHealthRequest, opts ...grpc.CallOption) (*InterceptInfo, error) {
+	out := new(InterceptInfo)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/ReportInterceptHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *managerClient) GetIntercept(ctx context.Context, in *GetInterceptRequest, opts ...grpc.CallOption) (*InterceptInfo, error) {
 	out := new(InterceptInfo)
 	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/GetIntercept", in, out, opts...)
@@ -461,8 +491,156 @@ func (x *managerWatchLookupHostClient) Recv() (*LookupHostRequest, error) {
 	return m, nil
 }
 
+func (c *managerClient) LookupDNS(ctx context.Context, in *DNSRequest, opts ...grpc.CallOption) (*DNSResponse, error) {
+	out := new(DNSResponse)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/LookupDNS", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) AgentLookupDNSResponse(ctx context.Context, in *DNSAgentResponse, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/telepresence.manager.Manager/AgentLookupDNSResponse", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) WatchLookupDNS(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchLookupDNSClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[6], "/telepresence.manager.Manager/WatchLookupDNS", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchLookupDNSClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchLookupDNSClient interface {
+	Recv() (*DNSRequest, error)
+	grpc.ClientStream
+}
+
+type managerWatchLookupDNSClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchLookupDNSClient) Recv() (*DNSRequest, error) {
+	m := new(DNSRequest)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) ReportInterceptEvents(ctx context.Context, opts ...grpc.CallOption) (Manager_ReportInterceptEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[7], "/telepresence.manager.Manager/ReportInterceptEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerReportInterceptEventsClient{stream}
+	return x, nil
+}
+
+type Manager_ReportInterceptEventsClient interface {
+	Send(*InterceptEvent) error
+	CloseAndRecv() (*emptypb.Empty, error)
+	grpc.ClientStream
+}
+
+type managerReportInterceptEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerReportInterceptEventsClient) Send(m *InterceptEvent) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *managerReportInterceptEventsClient) CloseAndRecv() (*emptypb.Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(emptypb.Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) WatchInterceptEvents(ctx context.Context, in *InterceptEventsRequest, opts ...grpc.CallOption) (Manager_WatchInterceptEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[8], "/telepresence.manager.Manager/WatchInterceptEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchInterceptEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchInterceptEventsClient interface {
+	Recv() (*InterceptEvent, error)
+	grpc.ClientStream
+}
+
+type managerWatchInterceptEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchInterceptEventsClient) Recv() (*InterceptEvent, error) {
+	m := new(InterceptEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *managerClient) WatchNotifications(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchNotificationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[9], "/telepresence.manager.Manager/WatchNotifications", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &managerWatchNotificationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Manager_WatchNotificationsClient interface {
+	Recv() (*Notification, error)
+	grpc.ClientStream
+}
+
+type managerWatchNotificationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *managerWatchNotificationsClient) Recv() (*Notification, error) {
+	m := new(Notification)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *managerClient) WatchLogLevel(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Manager_WatchLogLevelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[6], "/telepresence.manager.Manager/WatchLogLevel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[10], "/telepresence.manager.Manager/WatchLogLevel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -494,7 +672,7 @@ func (x *managerWatchLogLevelClient) Recv() (*LogLevelRequest, error) {
 }
 
 func (c *managerClient) Tunnel(ctx context.Context, opts ...grpc.CallOption) (Manager_TunnelClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[7], "/telepresence.manager.Manager/Tunnel", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[11], "/telepresence.manager.Manager/Tunnel", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -525,7 +703,7 @@ func (x *managerTunnelClient) Recv() (*TunnelMessage, error) {
 }
 
 func (c *managerClient) WatchDial(ctx context.Context, in *SessionInfo, opts ...grpc.CallOption) (Manager_WatchDialClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[8], "/telepresence.manager.Manager/WatchDial", opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[12], "/telepresence.manager.Manager/WatchDial", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -610,6 +788,10 @@ type ManagerServer interface {
 	// RemoveIntercept lets a client remove an intercept.
 	RemoveIntercept(context.Context, *RemoveInterceptRequest2) (*emptypb.Empty, error)
 	UpdateIntercept(context.Context, *UpdateInterceptRequest) (*InterceptInfo, error)
+	// ReportInterceptHealth lets a client report the health of the local
+	// process that handles one of its intercepts. It moves an "ACTIVE"
+	// intercept to "UNHEALTHY" and back. Other dispositions are retained.
+	ReportInterceptHealth(context.Context, *InterceptHealthRequest) (*InterceptInfo, error)
 	// GetIntercept gets info from intercept name
 	GetIntercept(context.Context, *GetInterceptRequest) (*InterceptInfo, error)
 	// ReviewIntercept lets an agent approve or reject an intercept by
@@ -631,6 +813,23 @@ type ManagerServer interface {
 	AgentLookupHostResponse(context.Context, *LookupHostAgentResponse) (*emptypb.Empty, error)
 	// WatchLookupHost lets an agent receive lookup requests
 	WatchLookupHost(*SessionInfo, Manager_WatchLookupHostServer) error
+	// LookupDNS performs a DNS query of any type in the cluster and returns
+	// the full RR set of the answer. If the caller has intercepts active, the
+	// query will be performed from the intercepted pods.
+	LookupDNS(context.Context, *DNSRequest) (*DNSResponse, error)
+	// AgentLookupDNSResponse lets an agent respond to DNS queries
+	AgentLookupDNSResponse(context.Context, *DNSAgentResponse) (*emptypb.Empty, error)
+	// WatchLookupDNS lets an agent receive DNS queries
+	WatchLookupDNS(*SessionInfo, Manager_WatchLookupDNSServer) error
+	// ReportInterceptEvents lets an agent report the traffic that it routes
+	// to intercepts.
+	ReportInterceptEvents(Manager_ReportInterceptEventsServer) error
+	// WatchInterceptEvents streams the traffic events of one of the caller's
+	// intercepts. The stream ends when the intercept is removed.
+	WatchInterceptEvents(*InterceptEventsRequest, Manager_WatchInterceptEventsServer) error
+	// WatchNotifications streams the notifications that concern the caller,
+	// such as warnings about intercepts that are about to expire.
+	WatchNotifications(*SessionInfo, Manager_WatchNotificationsServer) error
 	// WatchLogLevel lets an agent receive log-level updates
 	WatchLogLevel(*emptypb.Empty, Manager_WatchLogLevelServer) error
 	// A Tunnel represents one single connection where the client or
@@ -704,6 +903,9 @@ func (UnimplementedManagerServer) RemoveIntercept(context.Context, *RemoveInterc
 func (UnimplementedManagerServer) UpdateIntercept(context.Context, *UpdateInterceptRequest) (*InterceptInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateIntercept not implemented")
 }
+func (UnimplementedManagerServer) ReportInterceptHealth(context.Context, *InterceptHealthRequest) (*InterceptInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportInterceptHealth not implemented")
+}
 func (UnimplementedManagerServer) GetIntercept(context.Context, *GetInterceptRequest) (*InterceptInfo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetIntercept not implemented")
 }
@@ -725,6 +927,24 @@ func (UnimplementedManagerServer) AgentLookupHostResponse(context.Context, *Look
 func (UnimplementedManagerServer) WatchLookupHost(*SessionInfo, Manager_WatchLookupHostServer) error {
 	return status.Errorf(codes.Unimplemented, "method WatchLookupHost not implemented")
 }
+func (UnimplementedManagerServer) LookupDNS(context.Context, *DNSRequest) (*DNSResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupDNS not implemented")
+}
+func (UnimplementedManagerServer) AgentLookupDNSResponse(context.Context, *DNSAgentResponse) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AgentLookupDNSResponse not implemented")
+}
+func (UnimplementedManagerServer) WatchLookupDNS(*SessionInfo, Manager_WatchLookupDNSServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchLookupDNS not implemented")
+}
+func (UnimplementedManagerServer) ReportInterceptEvents(Manager_ReportInterceptEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReportInterceptEvents not implemented")
+}
+func (UnimplementedManagerServer) WatchInterceptEvents(*InterceptEventsRequest, Manager_WatchInterceptEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchInterceptEvents not implemented")
+}
+func (UnimplementedManagerServer) WatchNotifications(*SessionInfo, Manager_WatchNotificationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchNotifications not implemented")
+}
 func (UnimplementedManagerServer) WatchLogLevel(*emptypb.Empty, Manager_WatchLogLevelServer) error {
 	return status.Errorf(codes.Unimplemented, "method WatchLogLevel not implemented")
 }
@@ -1044,6 +1264,24 @@ func _Manager_UpdateIntercept_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Manager_ReportInterceptHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InterceptHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).ReportInterceptHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.Manager/ReportInterceptHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).ReportInterceptHealth(ctx, req.(*InterceptHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Manager_GetIntercept_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetInterceptRequest)
 	if err := dec(in); err != nil {
@@ -1189,6 +1427,131 @@ func (x *managerWatchLookupHostServer) Send(m *LookupHostRequest) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Manager_LookupDNS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DNSRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).LookupDNS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.Manager/LookupDNS",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).LookupDNS(ctx, req.(*DNSRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_AgentLookupDNSResponse_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DNSAgentResponse)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).AgentLookupDNSResponse(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/telepresence.manager.Manager/AgentLookupDNSResponse",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).AgentLookupDNSResponse(ctx, req.(*DNSAgentResponse))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_WatchLookupDNS_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SessionInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchLookupDNS(m, &managerWatchLookupDNSServer{stream})
+}
+
+type Manager_WatchLookupDNSServer interface {
+	Send(*DNSRequest) error
+	grpc.ServerStream
+}
+
+type managerWatchLookupDNSServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchLookupDNSServer) Send(m *DNSRequest) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Manager_ReportInterceptEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ManagerServer).ReportInterceptEvents(&managerReportInterceptEventsServer{stream})
+}
+
+type Manager_ReportInterceptEventsServer interface {
+	SendAndClose(*emptypb.Empty) error
+	Recv() (*InterceptEvent, error)
+	grpc.ServerStream
+}
+
+type managerReportInterceptEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerReportInterceptEventsServer) SendAndClose(m *emptypb.Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *managerReportInterceptEventsServer) Recv() (*InterceptEvent, error) {
+	m := new(InterceptEvent)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Manager_WatchInterceptEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(InterceptEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchInterceptEvents(m, &managerWatchInterceptEventsServer{stream})
+}
+
+type Manager_WatchInterceptEventsServer interface {
+	Send(*InterceptEvent) error
+	grpc.ServerStream
+}
+
+type managerWatchInterceptEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchInterceptEventsServer) Send(m *InterceptEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Manager_WatchNotifications_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SessionInfo)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).WatchNotifications(m, &managerWatchNotificationsServer{stream})
+}
+
+type Manager_WatchNotificationsServer interface {
+	Send(*Notification) error
+	grpc.ServerStream
+}
+
+type managerWatchNotificationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *managerWatchNotificationsServer) Send(m *Notification) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Manager_WatchLogLevel_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(emptypb.Empty)
 	if err := stream.RecvMsg(m); err != nil {
@@ -1316,6 +1679,10 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateIntercept",
 			Handler:    _Manager_UpdateIntercept_Handler,
 		},
+		{
+			MethodName: "ReportInterceptHealth",
+			Handler:    _Manager_ReportInterceptHealth_Handler,
+		},
 		{
 			MethodName: "GetIntercept",
 			Handler:    _Manager_GetIntercept_Handler,
@@ -1332,6 +1699,14 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "AgentLookupHostResponse",
 			Handler:    _Manager_AgentLookupHostResponse_Handler,
 		},
+		{
+			MethodName: "LookupDNS",
+			Handler:    _Manager_LookupDNS_Handler,
+		},
+		{
+			MethodName: "AgentLookupDNSResponse",
+			Handler:    _Manager_AgentLookupDNSResponse_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1366,6 +1741,26 @@ var Manager_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Manager_WatchLookupHost_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchLookupDNS",
+			Handler:       _Manager_WatchLookupDNS_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReportInterceptEvents",
+			Handler:       _Manager_ReportInterceptEvents_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchInterceptEvents",
+			Handler:       _Manager_WatchInterceptEvents_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchNotifications",
+			Handler:       _Manager_WatchNotifications_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "WatchLogLevel",
 			Handler:       _Manager_WatchLogLevel_Handler,